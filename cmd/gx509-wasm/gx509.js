@@ -0,0 +1,37 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// gx509.analyze(certificates) resolves to the constraint analysis of each
+// certificate in a PEM string or a Uint8Array of DER, as gx509 -json writes
+// them. It loads gx509.wasm on first use; call gx509.load(url) first to load
+// it from elsewhere. Requires wasm_exec.js.
+(function (global) {
+  "use strict";
+
+  var ready;
+
+  function load(url) {
+    if (!ready) {
+      var go = new Go();
+      ready = WebAssembly.instantiateStreaming(fetch(url || "gx509.wasm"), go.importObject)
+        .then(function (result) {
+          // Resolves when the program exits, which it does not
+          go.run(result.instance);
+        });
+    }
+    return ready;
+  }
+
+  function analyze(certificates) {
+    return load().then(function () {
+      var response = JSON.parse(global.gx509Analyze(certificates));
+      if (response.error) {
+        throw new Error(response.error);
+      }
+      return response.certificates;
+    });
+  }
+
+  global.gx509 = { load: load, analyze: analyze };
+})(globalThis);
@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command gx509-wasm is the constraint analysis built for WebAssembly, so a
+// page can analyze pasted certificates without sending them anywhere. Build
+// it with
+//
+//	GOOS=js GOARCH=wasm go build -o gx509.wasm ./cmd/gx509-wasm
+//
+// and serve gx509.wasm with gx509.js, index.html and the wasm_exec.js of the
+// same Go release, from $(go env GOROOT)/lib/wasm (misc/wasm before Go 1.24).
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// An analyzeResponse is what gx509Analyze returns, as JSON: the analysis of
+// each certificate, or why there is none.
+type analyzeResponse struct {
+	Certificates []gx509.ConstraintResult `json:"certificates,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+}
+
+// analyze reads the certificates in data, PEM or DER, and analyzes each.
+func analyze(data []byte) analyzeResponse {
+	certs, err := gx509.ParseCertificatesFromBytes(data)
+	if err != nil {
+		return analyzeResponse{Error: err.Error()}
+	}
+	var response analyzeResponse
+	for _, cert := range certs {
+		response.Certificates = append(response.Certificates, gx509.NewConstraintResult("input", cert, gx509.AnalyzeTechnicalConstraints(cert)))
+	}
+	return response
+}
+
+func main() {
+	js.Global().Set("gx509Analyze", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var response analyzeResponse
+		switch {
+		case len(args) != 1:
+			response.Error = "Expected one argument, the certificates"
+		case args[0].Type() == js.TypeString:
+			response = analyze([]byte(args[0].String()))
+		default:
+			// A Uint8Array, such as the contents of a dropped .der file
+			data := make([]byte, args[0].Get("length").Int())
+			js.CopyBytesToGo(data, args[0])
+			response = analyze(data)
+		}
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			encoded, _ = json.Marshal(analyzeResponse{Error: err.Error()})
+		}
+		return string(encoded)
+	}))
+	// Keep the functions above callable for the life of the page
+	select {}
+}
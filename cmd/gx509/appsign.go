@@ -0,0 +1,117 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// readAppSignatures extracts the signatures from an APK, an IPA or a
+// Mach-O binary, telling the archives apart by extension. IPA signatures
+// are keyed by the binary within the archive.
+func readAppSignatures(path string) (map[string][]gx509.CodeSignature, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	var signatures []gx509.CodeSignature
+	switch {
+	case string(header) != "PK\x03\x04":
+		signatures, err = gx509.ExtractMachOSignatures(file)
+	case strings.EqualFold(filepath.Ext(path), ".ipa"):
+		return gx509.ExtractIPASignatures(file, info.Size())
+	default:
+		signatures, err = gx509.ExtractAPKSignatures(file, info.Size())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	return map[string][]gx509.CodeSignature{"": signatures}, nil
+}
+
+func runAppSign(args []string) {
+	flags := flag.NewFlagSet("appsign", flag.ExitOnError)
+	atFlag := flags.String("at", "", "Analyze as of this RFC 3339 time (default now)")
+	extract := flags.Bool("pem", false, "Print the certificates each signature carries as PEM")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 appsign [flags] file.apk|file.ipa|binary...\n\n")
+		fmt.Fprintf(flags.Output(), "Extracts the certificate chains from signed Android APKs, iOS IPAs and code\n")
+		fmt.Fprintf(flags.Output(), "signed Mach-O binaries and checks them against the code signing\n")
+		fmt.Fprintf(flags.Output(), "requirements. Signatures are not verified.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the files to analyze")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	flagged := 0
+	for _, path := range positional {
+		binaries, err := readAppSignatures(path)
+		if err != nil {
+			log.Fatalf("Could not read signatures from %s: %s", path, err)
+			return
+		}
+
+		if len(binaries) == 0 {
+			fmt.Printf("%s: not signed\n", path)
+			flagged++
+			continue
+		}
+		var names []string
+		for name := range binaries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			label := path
+			if len(name) > 0 {
+				label = path + ":" + name
+			}
+			count, err := reportSignatures(label, binaries[name], at, *extract)
+			if err != nil {
+				log.Fatalf("Could not write certificates: %s", err)
+				return
+			}
+			flagged += count
+		}
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
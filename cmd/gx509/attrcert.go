@@ -0,0 +1,152 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runAttrCert(args []string) {
+	flags := flag.NewFlagSet("attrcert", flag.ExitOnError)
+	var certPaths stringList
+	flags.Var(&certPaths, "certs", "File or directory of certificates to find holders and attribute authorities among (repeatable)")
+	atFlag := flags.String("at", "", "Check validity as of this RFC 3339 time (default now)")
+	policyName := flags.String("policy", gx509.DefaultPolicy.Name, "Policy to judge the issuing CAs' technical constraints by")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 attrcert [flags] ac.pem...\n\n")
+		fmt.Fprintf(flags.Output(), "Prints RFC 5755 attribute certificates, as PEM ATTRIBUTE CERTIFICATE blocks\n")
+		fmt.Fprintf(flags.Output(), "or DER, and links each to the certificates of its holder and attribute\n")
+		fmt.Fprintf(flags.Output(), "authority among those given with -certs, verifying its signature. Exits 1\n")
+		fmt.Fprintf(flags.Output(), "if any attribute certificate has problems.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the attribute certificates to analyze")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+	policy, ok := gx509.LookupPolicy(*policyName)
+	if !ok {
+		log.Fatalf("Unknown policy: %s", *policyName)
+		return
+	}
+
+	var pool []*x509.Certificate
+	if len(certPaths) > 0 {
+		err := scanCertificates(certPaths, func(path string, certs []*x509.Certificate) {
+			pool = append(pool, certs...)
+		})
+		if err != nil {
+			log.Fatalf("Could not read certificates: %s", err)
+			return
+		}
+	}
+
+	flagged := 0
+	for _, path := range positional {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		acs, err := gx509.ParseAttributeCertificates(data)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", path, err)
+			return
+		}
+		for _, ac := range acs {
+			if printAttributeCertificate(path, ac, pool, policy, at) {
+				flagged++
+			}
+		}
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
+
+// printAttributeCertificate prints ac, read from path, with its linkage to
+// the certificates in pool, and returns true if it has problems.
+func printAttributeCertificate(path string, ac *gx509.AttributeCertificate, pool []*x509.Certificate, policy gx509.Policy, at time.Time) bool {
+	fmt.Printf("%s: attribute certificate %X, version %d, valid %s to %s\n", path, ac.SerialNumber, ac.Version,
+		ac.NotBefore.UTC().Format(time.RFC3339), ac.NotAfter.UTC().Format(time.RFC3339))
+	holder := ac.Holder
+	if holder.BaseCertificateSerial != nil {
+		fmt.Printf("  Holder certificate: serial %X issued by %s\n", holder.BaseCertificateSerial, strings.Join(holder.BaseCertificateIssuer, ", "))
+	}
+	if len(holder.EntityNames) > 0 {
+		fmt.Printf("  Holder name: %s\n", strings.Join(holder.EntityNames, ", "))
+	}
+	if holder.ObjectDigest != nil {
+		fmt.Printf("  Holder digest: %s %X (type %d)\n", holder.ObjectDigest.Algorithm, holder.ObjectDigest.Digest, holder.ObjectDigest.Type)
+	}
+	fmt.Printf("  Issuer: %s\n", strings.Join(ac.IssuerNames, ", "))
+	for _, attribute := range ac.Attributes {
+		for _, value := range attribute.Values {
+			fmt.Printf("  Attribute %s: %s\n", attribute.Name, value)
+		}
+	}
+	for _, ext := range ac.Extensions {
+		decoded := gx509.DecodeExtension(ext)
+		critical := ""
+		if decoded.Critical {
+			critical = " (critical)"
+		}
+		fmt.Printf("  Extension %s%s\n", decoded.Name, critical)
+		for _, line := range decoded.Lines {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+
+	linkage := ac.Link(pool, at)
+	if linkage.Holder != nil {
+		fmt.Printf("  Holder: %s, by %s\n", certificateLine(linkage.Holder), linkage.HolderMatch)
+		printIssuingCA(linkage.Holder, pool, policy)
+	}
+	if linkage.Issuer != nil {
+		fmt.Printf("  Attribute authority: %s\n", certificateLine(linkage.Issuer))
+		printIssuingCA(linkage.Issuer, pool, policy)
+	}
+	for _, problem := range linkage.Problems {
+		fmt.Printf("  * %s\n", problem)
+	}
+	return len(linkage.Problems) > 0
+}
+
+// printIssuingCA prints whether the CA in pool that issued cert, if there is
+// one, is technically constrained under policy.
+func printIssuingCA(cert *x509.Certificate, pool []*x509.Certificate, policy gx509.Policy) {
+	for _, ca := range pool {
+		if !bytes.Equal(ca.RawSubject, cert.RawIssuer) || cert.CheckSignatureFrom(ca) != nil {
+			continue
+		}
+		verdict := "not technically constrained"
+		if gx509.AnalyzeTechnicalConstraintsForPolicy(ca, policy).Constrained {
+			verdict = "technically constrained"
+		}
+		fmt.Printf("    issued by %s, %s under %s\n", ca.Subject.CommonName, verdict, policy.Name)
+		return
+	}
+}
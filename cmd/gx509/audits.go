@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runAudits(args []string) {
+	flags := flag.NewFlagSet("audits", flag.ExitOnError)
+	statementsPath := flags.String("statements", "", "YAML file of audit statement metadata")
+	var letters stringList
+	flags.Var(&letters, "letter", "Audit letter PDF or text to cross-check fingerprints against (experimental, repeatable)")
+	at := flags.String("at", "", "Evaluation time as RFC 3339 (default now)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 audits [-statements audits.yaml] [-letter letter.pdf] [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Reports unexpired intermediates that are neither technically constrained\n")
+		fmt.Fprintf(flags.Output(), "nor covered by a current BR audit, and certificates whose fingerprints are\n")
+		fmt.Fprintf(flags.Output(), "absent from every audit letter. Each path is a PEM file or a directory.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if (len(*statementsPath) == 0 && len(letters) == 0) || len(positional) == 0 {
+		flags.Usage()
+		log.Fatalf("You must specify audit statements or letters, and the intermediates to check")
+		return
+	}
+
+	var certs []*x509.Certificate
+	for _, path := range positional {
+		found, err := loadCertificatesFromPath(path)
+		if err != nil {
+			log.Fatalf("Could not load certificates from %s: %s", path, err)
+			return
+		}
+		certs = append(certs, found...)
+	}
+
+	checkAt := time.Now()
+	if len(*at) > 0 {
+		var err error
+		if checkAt, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	if len(*statementsPath) > 0 {
+		data, err := ioutil.ReadFile(*statementsPath)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *statementsPath, err)
+			return
+		}
+		audits, err := gx509.ParseAuditStatements(data)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", *statementsPath, err)
+			return
+		}
+
+		gaps := gx509.FindAuditGaps(certs, audits, checkAt)
+		for _, gap := range gaps {
+			fmt.Printf("%s (expires %s): %s\n", gap.Cert.Subject.CommonName,
+				gap.Cert.NotAfter.Format("2006-01-02"), gap.Reason)
+		}
+		fmt.Printf("\n%d of %d certificates lack audit coverage\n", len(gaps), len(certs))
+	}
+
+	if len(letters) > 0 {
+		var extracted []gx509.AuditLetter
+		for _, path := range letters {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Fatalf("Could not read %s: %s", path, err)
+				return
+			}
+			letter := gx509.ExtractAuditLetter(data)
+			var dates []string
+			for _, date := range letter.Dates {
+				dates = append(dates, date.Format("2006-01-02"))
+			}
+			mentioned := 0
+			for _, cert := range certs {
+				if letter.Mentions(cert) {
+					mentioned++
+				}
+			}
+			fmt.Printf("%s: mentions %d certificates, dates %v\n", path, mentioned, dates)
+			extracted = append(extracted, letter)
+		}
+
+		missing := gx509.MissingFromAuditLetters(certs, extracted)
+		for _, cert := range missing {
+			fmt.Printf("Not in any audit letter: %s (%X)\n", cert.Subject.CommonName, sha256.Sum256(cert.Raw))
+		}
+		fmt.Printf("\n%d of %d certificates are absent from the audit letters\n", len(missing), len(certs))
+	}
+}
@@ -0,0 +1,104 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runAuthenticode(args []string) {
+	flags := flag.NewFlagSet("authenticode", flag.ExitOnError)
+	atFlag := flags.String("at", "", "Analyze as of this RFC 3339 time (default now)")
+	extract := flags.Bool("pem", false, "Print the certificates each signature carries as PEM")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 authenticode [flags] file.exe...\n\n")
+		fmt.Fprintf(flags.Output(), "Extracts the certificate chains from signed Windows PE files and checks them\n")
+		fmt.Fprintf(flags.Output(), "against the code signing requirements. Signatures are not verified.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the files to analyze")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	flagged := 0
+	for _, path := range positional {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", path, err)
+			return
+		}
+		signatures, err := gx509.ExtractAuthenticode(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read signatures from %s: %s", path, err)
+			return
+		}
+
+		if len(signatures) == 0 {
+			fmt.Printf("%s: not signed\n", path)
+			flagged++
+			continue
+		}
+		count, err := reportSignatures(path, signatures, at, *extract)
+		if err != nil {
+			log.Fatalf("Could not write certificates: %s", err)
+			return
+		}
+		flagged += count
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
+
+// reportSignatures prints each code signature on the file at path with its
+// chain and problems, and the certificates it carries if extract is set. It
+// returns the number of signatures with problems.
+func reportSignatures(path string, signatures []gx509.CodeSignature, at time.Time, extract bool) (int, error) {
+	flagged := 0
+	for i, signature := range signatures {
+		timestamp := "no timestamp"
+		if signature.Timestamped {
+			timestamp = "timestamped"
+		}
+		fmt.Printf("%s: signature %d (%s), %s digests, %s\n", path, i+1, signature.Format, signature.DigestAlgorithm, timestamp)
+		for _, cert := range signature.Chain {
+			fmt.Printf("  %s\n", certificateLine(cert))
+		}
+
+		problems := gx509.AnalyzeCodeSigning(signature, at)
+		for _, problem := range problems {
+			fmt.Printf("  * %s\n", problem)
+		}
+		if len(problems) > 0 {
+			flagged++
+		}
+
+		if extract {
+			if err := writeCertificates(os.Stdout, signature.Certificates); err != nil {
+				return flagged, err
+			}
+		}
+	}
+	return flagged, nil
+}
@@ -0,0 +1,59 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runAWSPCA(args []string) {
+	region := os.Getenv("AWS_REGION")
+	if len(region) == 0 {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	flags := flag.NewFlagSet("awspca", flag.ExitOnError)
+	flags.StringVar(&region, "region", region, "The AWS region; defaults to $AWS_REGION")
+	since := flags.Duration("since", 30*24*time.Hour, "Only examine certificates in the audit reports issued this recently")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 awspca [flags] [audit-report.json...]\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether each AWS Private CA in the region is technically constrained.\n")
+		fmt.Fprintf(flags.Output(), "Certificates listed in the given audit reports, as written by\n")
+		fmt.Fprintf(flags.Output(), "'aws acm-pca create-certificate-authority-audit-report' and downloaded from S3,\n")
+		fmt.Fprintf(flags.Output(), "are fetched and linted, with the risks of the templates they were issued through.\n")
+		fmt.Fprintf(flags.Output(), "Credentials are read from $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and\n")
+		fmt.Fprintf(flags.Output(), "$AWS_SESSION_TOKEN. Exits non-zero if any CA is unconstrained or any lint fails.\n")
+		flags.PrintDefaults()
+	}
+	reports := parseInterspersed(flags, args)
+
+	if len(region) == 0 {
+		log.Fatalf("You must specify the region with -region or $AWS_REGION")
+		return
+	}
+	pca := gx509.NewAWSPrivateCA(region, os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"))
+
+	for _, path := range reports {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		entries, err := gx509.ParseAWSAuditReport(data)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", path, err)
+			return
+		}
+		pca.AuditEntries = append(pca.AuditEntries, entries...)
+	}
+
+	auditCloudCA(pca, *since)
+}
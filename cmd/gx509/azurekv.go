@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runAzureKeyVault(args []string) {
+	flags := flag.NewFlagSet("azurekv", flag.ExitOnError)
+	since := flags.Duration("since", 30*24*time.Hour, "Only examine certificates created this recently")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 azurekv [flags] https://example.vault.azure.net\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether each CA certificate in an Azure Key Vault is technically\n")
+		fmt.Fprintf(flags.Output(), "constrained, and lints the other certificates created recently, with the risks of\n")
+		fmt.Fprintf(flags.Output(), "their certificate policies. The access token is read from $AZURE_KEYVAULT_TOKEN, or\n")
+		fmt.Fprintf(flags.Output(), "'az account get-access-token'. Exits non-zero if any CA is unconstrained or any\n")
+		fmt.Fprintf(flags.Output(), "lint fails.\n")
+		flags.PrintDefaults()
+	}
+	vaults := parseInterspersed(flags, args)
+
+	if len(vaults) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	token := os.Getenv("AZURE_KEYVAULT_TOKEN")
+	if len(token) == 0 {
+		output, err := exec.Command("az", "account", "get-access-token", "--resource", "https://vault.azure.net",
+			"--query", "accessToken", "--output", "tsv").Output()
+		if err != nil {
+			log.Fatalf("Could not get an access token from az: %s", err)
+			return
+		}
+		token = strings.TrimSpace(string(output))
+	}
+
+	auditCloudCA(gx509.NewAzureKeyVault(vaults[0], token), *since)
+}
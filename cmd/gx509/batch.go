@@ -0,0 +1,112 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runBatch(args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of certificates to analyze at once")
+	policyArg := flags.String("policy", gx509.DefaultPolicy.Name, "Judge by this preset, \"issuance\", or policy configuration YAML file, as gx509 impact takes")
+	at := flags.String("at", "", "Run lints as of this RFC 3339 time (default now)")
+	output := flags.String("o", "", "Write the results to this file instead of stdout")
+	resultsPath := flags.String("results", "", "Also store the verdicts in this SQLite result store, for gx509 query -results")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 batch [flags] [file]\n\n")
+		fmt.Fprintf(flags.Output(), "Analyzes a stream of certificates, from file or standard input if none or -,\n")
+		fmt.Fprintf(flags.Output(), "with a pool of workers and writes a line of JSON for each, in input order.\n")
+		fmt.Fprintf(flags.Output(), "Certificates are PEM blocks, or one a line as base64 DER, base64 CT\n")
+		fmt.Fprintf(flags.Output(), "MerkleTreeLeafs (leaf_input), or CT get-entries entries as JSON. Entries that\n")
+		fmt.Fprintf(flags.Output(), "cannot be parsed are written with an error. With -results, the verdicts are\n")
+		fmt.Fprintf(flags.Output(), "also kept in an SQLite database, one row per certificate.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) > 1 {
+		flags.Usage()
+		log.Fatalf("You can only specify one file")
+		return
+	}
+	policy, err := loadPolicyConfig(*policyArg)
+	if err != nil {
+		log.Fatalf("Could not load policy %s: %s", *policyArg, err)
+		return
+	}
+	options := gx509.BatchOptions{Workers: *workers, Tenant: policy, At: time.Now()}
+	if len(*at) > 0 {
+		if options.At, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	name := "-"
+	var input io.Reader = os.Stdin
+	if len(positional) == 1 && positional[0] != "-" {
+		name = positional[0]
+		file, err := os.Open(name)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", name, err)
+			return
+		}
+		defer file.Close()
+		input = file
+	}
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+	var store *gx509.ResultStore
+	if len(*resultsPath) > 0 {
+		if store, err = gx509.OpenResultStore(*resultsPath); err != nil {
+			log.Fatalf("Could not open result store %s: %s", *resultsPath, err)
+			return
+		}
+	}
+
+	buffered := bufio.NewWriter(out)
+	encoder := json.NewEncoder(buffered)
+
+	started := time.Now()
+	summary, err := gx509.RunBatch(name, input, options, func(result gx509.BatchResult) error {
+		if store != nil && result.Certificate != nil {
+			store.Add(result.Certificate, result.ConstraintResult, fmt.Sprintf("%s:%d", name, result.Line), started)
+		}
+		return encoder.Encode(result)
+	})
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Fatalf("Could not analyze %s: %s", name, err)
+		return
+	}
+	if store != nil {
+		if err := store.Save(); err != nil {
+			log.Fatalf("Could not save result store %s: %s", *resultsPath, err)
+			return
+		}
+	}
+	log.Printf("Analyzed %d certificates in %s with %d workers; %d entries could not be parsed",
+		summary.Certificates, time.Since(started).Round(time.Millisecond), *workers, summary.Errors)
+}
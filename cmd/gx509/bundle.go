@@ -0,0 +1,112 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func writeCertificates(out io.Writer, certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runBundle(args []string) {
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	intermediatesPath := flags.String("intermediates", "", "PEM file or directory of candidate intermediates")
+	rootsPath := flags.String("roots", "system", "PEM file or directory of trusted roots, or \"system\"")
+	includeRoot := flags.Bool("include-root", false, "Append the root to the output")
+	output := flags.String("o", "", "Write the chain to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 bundle leaf.pem [flags]\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the leaf .pem file")
+		return
+	}
+
+	leaf, err := loadCertificate(positional[0])
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", positional[0], err)
+		return
+	}
+
+	var intermediates []*x509.Certificate
+	if len(*intermediatesPath) > 0 {
+		if intermediates, err = loadCertificatesFromPath(*intermediatesPath); err != nil {
+			log.Fatalf("Could not load intermediates from %s: %s", *intermediatesPath, err)
+			return
+		}
+	}
+
+	roots, err := loadRoots(*rootsPath)
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", *rootsPath, err)
+		return
+	}
+
+	chain := gx509.BestChain(gx509.BuildChains(leaf, intermediates, roots), time.Now())
+	if chain == nil {
+		chain = gx509.PartialChain(leaf, intermediates)
+		last := chain[len(chain)-1]
+		log.Printf("Warning: no path to a trusted root; missing the issuer of %s (%s)",
+			last.Subject.CommonName, last.Issuer.CommonName)
+	} else if !*includeRoot {
+		chain = chain[:len(chain)-1]
+	}
+
+	for _, intermediate := range intermediates {
+		if !intermediate.Equal(leaf) && !chainContains(chain, intermediate) {
+			log.Printf("Warning: superfluous intermediate %s (issued by %s) is not in the chain",
+				intermediate.Subject.CommonName, intermediate.Issuer.CommonName)
+		}
+	}
+
+	now := time.Now()
+	for _, cert := range chain {
+		if now.After(cert.NotAfter) {
+			log.Printf("Warning: %s expired at %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+
+	if err := writeCertificates(out, chain); err != nil {
+		log.Fatalf("Could not write chain: %s", err)
+		return
+	}
+}
+
+func chainContains(chain []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, candidate := range chain {
+		if candidate.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
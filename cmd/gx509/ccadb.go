@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runCCADB(args []string) {
+	if len(args) > 0 && args[0] == "check" {
+		runCCADBCheck(args[1:])
+		return
+	}
+
+	flags := flag.NewFlagSet("ccadb", flag.ExitOnError)
+	output := flags.String("o", "", "Write the CSV to this file instead of stdout")
+	includeLeaves := flags.Bool("include-leaves", false, "Include certificates that are not CAs")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 ccadb [flags] path...\n")
+		fmt.Fprintf(flags.Output(), "       gx509 ccadb check [flags] report.csv [path...]\n\n")
+		fmt.Fprintf(flags.Output(), "Each path is a PEM file or a directory of them. Audit columns are left blank.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the intermediates to disclose")
+		return
+	}
+
+	var certs []*x509.Certificate
+	for _, path := range positional {
+		found, err := loadCertificatesFromPath(path)
+		if err != nil {
+			log.Fatalf("Could not load certificates from %s: %s", path, err)
+			return
+		}
+		for _, cert := range found {
+			if !cert.IsCA && !*includeLeaves {
+				log.Printf("Skipping %s, which is not a CA", cert.Subject.CommonName)
+				continue
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		var err error
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+
+	if err := gx509.WriteCCADBCSV(out, certs); err != nil {
+		log.Fatalf("Could not write CSV: %s", err)
+		return
+	}
+}
+
+func runCCADBCheck(args []string) {
+	flags := flag.NewFlagSet("ccadb check", flag.ExitOnError)
+	policyName := flags.String("policy", gx509.DefaultPolicy.Name, "Judge constraints by this policy: mozilla-2.2, mozilla-2.5, mozilla-2.7 or cabr-baseline")
+	at := flags.String("at", "", "Evaluation time as RFC 3339 (default now)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 ccadb check [flags] report.csv [path...]\n\n")
+		fmt.Fprintf(flags.Output(), "Cross-checks a CCADB All Certificate Records or intermediate certificate\n")
+		fmt.Fprintf(flags.Output(), "report against gx509's analysis, reporting certificates whose technical\n")
+		fmt.Fprintf(flags.Output(), "constraint status disagrees with the CCADB's, unconstrained certificates the\n")
+		fmt.Fprintf(flags.Output(), "CCADB records no BR audit for, and, among the certificates in the given PEM\n")
+		fmt.Fprintf(flags.Output(), "files or directories, unconstrained CAs the CCADB lacks. Certificates come\n")
+		fmt.Fprintf(flags.Output(), "from the report's PEM Info column and from the paths. Exits 1 on any mismatch.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		flags.Usage()
+		log.Fatalf("You must specify the CCADB report to check")
+		return
+	}
+	policy, ok := gx509.LookupPolicy(*policyName)
+	if !ok {
+		log.Fatalf("Unknown policy: %s", *policyName)
+		return
+	}
+	checkAt := time.Now()
+	if len(*at) > 0 {
+		var err error
+		if checkAt, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		log.Fatalf("Could not open %s: %s", positional[0], err)
+		return
+	}
+	records, err := gx509.ParseCCADBReport(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Could not parse %s: %s", positional[0], err)
+		return
+	}
+
+	var certs []*x509.Certificate
+	for _, path := range positional[1:] {
+		found, err := loadCertificatesFromPath(path)
+		if err != nil {
+			log.Fatalf("Could not load certificates from %s: %s", path, err)
+			return
+		}
+		certs = append(certs, found...)
+	}
+
+	check := gx509.CrossCheckCCADB(records, certs, policy, checkAt)
+	for _, mismatch := range check.Mismatches {
+		location := "not in the CCADB"
+		if mismatch.Record != nil {
+			location = fmt.Sprintf("line %d, %s", mismatch.Record.Line, mismatch.Record.Name)
+		}
+		fmt.Printf("%s: %s (%s)\n    %s\n", mismatch.Kind, certificateLine(mismatch.Cert), location, mismatch.Message)
+	}
+	fmt.Printf("\n%d certificates checked under %s, %d mismatches; %d records had no certificate to check\n",
+		check.Checked, policy.Name, len(check.Mismatches), len(check.Unchecked))
+	if len(check.Mismatches) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,129 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// queryCertManager gets the cert-manager resources and secrets in every
+// namespace from the cluster kubectl is configured for.
+func queryCertManager(kubeconfig, context string) ([]byte, error) {
+	args := []string{"get", "--all-namespaces", "-o", "yaml",
+		"issuers.cert-manager.io,clusterissuers.cert-manager.io,certificates.cert-manager.io,certificaterequests.cert-manager.io,secrets"}
+	if len(kubeconfig) > 0 {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	if len(context) > 0 {
+		args = append(args, "--context", context)
+	}
+	cmd := exec.Command("kubectl", args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+func runCertManager(args []string) {
+	flags := flag.NewFlagSet("certmanager", flag.ExitOnError)
+	cluster := flags.Bool("cluster", false, "Query the cluster with kubectl instead of reading files")
+	kubeconfig := flags.String("kubeconfig", "", "With -cluster, the kubeconfig file to use")
+	context := flags.String("context", "", "With -cluster, the kubeconfig context to use")
+	namespace := flags.String("cluster-resource-namespace", "cert-manager", "The namespace holding the secrets of ClusterIssuers")
+	constrained := flags.Bool("constrained", false, "Exit non-zero if any in-cluster CA is not technically constrained")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 certmanager [flags] file...\n")
+		fmt.Fprintf(flags.Output(), "       gx509 certmanager -cluster [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Each file is YAML holding cert-manager Issuers, ClusterIssuers, Certificates and\n")
+		fmt.Fprintf(flags.Output(), "CertificateRequests, and the TLS secrets they use, such as the output of kubectl get\n")
+		fmt.Fprintf(flags.Output(), "-o yaml. Reports whether each CA issuer and isCA certificate is technically\n")
+		fmt.Fprintf(flags.Output(), "constrained, and lints each issued certificate.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	var data []byte
+	if *cluster {
+		var err error
+		if data, err = queryCertManager(*kubeconfig, *context); err != nil {
+			log.Fatalf("Could not query the cluster: %s", err)
+			return
+		}
+	} else if len(positional) == 0 {
+		log.Fatalf("You must specify the files to read, or -cluster")
+		return
+	}
+	for _, path := range positional {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		data = append(append(data, "\n---\n"...), contents...)
+	}
+
+	inventory, err := gx509.ParseCertManager(data, *namespace)
+	if err != nil {
+		log.Fatalf("Could not parse cert-manager resources: %s", err)
+		return
+	}
+
+	var cas, unconstrained int
+	// checkCA prints whether the in-cluster CA cert is technically constrained
+	checkCA := func(cert *x509.Certificate) {
+		cas++
+		fmt.Printf("  %s\n", certificateLine(cert))
+		if analysis := gx509.AnalyzeTechnicalConstraints(cert); analysis.Constrained {
+			fmt.Printf("  CA; technically constrained\n")
+		} else {
+			fmt.Printf("  UNCONSTRAINED CA: %s\n", analysis.Details())
+			unconstrained++
+		}
+	}
+
+	for _, issuer := range inventory.Issuers {
+		fmt.Printf("%s (%s)\n", issuer.Ref, issuer.Type)
+		if issuer.Type == "ca" {
+			if issuer.Cert == nil {
+				fmt.Printf("  secret %s not found\n", issuer.SecretName)
+				continue
+			}
+			checkCA(issuer.Cert)
+		}
+	}
+
+	now := time.Now()
+	for _, certificate := range inventory.Certificates {
+		fmt.Printf("%s (issuer %s)\n", certificate.Name, certificate.IssuerRef)
+		if len(certificate.Certs) == 0 {
+			fmt.Printf("  not issued\n")
+			continue
+		}
+		cert := certificate.Certs[0]
+		if certificate.IsCA || cert.IsCA {
+			checkCA(cert)
+		} else {
+			fmt.Printf("  %s\n", certificateLine(cert))
+		}
+		report := gx509.Report{Generated: now}
+		report.LintCertificate(certificate.Name, cert, now)
+		for _, finding := range report.Failures() {
+			fmt.Printf("  %s %s: %s\n", finding.Lint.Severity, finding.Lint.Name, finding.Message)
+		}
+	}
+
+	fmt.Printf("\n%d issuers, %d certificates; %d of %d in-cluster CAs not technically constrained\n",
+		len(inventory.Issuers), len(inventory.Certificates), unconstrained, cas)
+	if *constrained && unconstrained > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,293 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runChain(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 chain fix|policies|validate [flags] fullchain.pem")
+		return
+	}
+
+	switch args[0] {
+	case "fix":
+		runChainFix(args[1:])
+	case "policies":
+		runChainPolicies(args[1:])
+	case "validate":
+		runChainValidate(args[1:])
+	default:
+		log.Fatalf("Unknown chain command: %s", args[0])
+	}
+}
+
+func certificateLine(cert *x509.Certificate) string {
+	return fmt.Sprintf("%x %s (issuer %s, expires %s)", sha256.Sum256(cert.Raw),
+		cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+}
+
+// printChainDiff writes a line-based diff between the certificates in before
+// and after, using the longest common subsequence of the two.
+func printChainDiff(before, after []*x509.Certificate) {
+	lengths := make([][]int, len(before)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i].Equal(after[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i].Equal(after[j]):
+			fmt.Printf("  %s\n", certificateLine(before[i]))
+			i++
+			j++
+		case j == len(after) || (i < len(before) && lengths[i+1][j] >= lengths[i][j+1]):
+			fmt.Printf("- %s\n", certificateLine(before[i]))
+			i++
+		default:
+			fmt.Printf("+ %s\n", certificateLine(after[j]))
+			j++
+		}
+	}
+}
+
+func runChainFix(args []string) {
+	flags := flag.NewFlagSet("chain fix", flag.ExitOnError)
+	at := flags.String("at", "", "Evaluate expiry as of this RFC 3339 time (default now)")
+	output := flags.String("o", "", "Write the repaired chain to this file")
+	inPlace := flags.Bool("w", false, "Overwrite the input file with the repaired chain")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 chain fix [flags] fullchain.pem\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+
+	when := time.Now()
+	if len(*at) > 0 {
+		if when, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	fixed, notes := gx509.FixChain(certs, when)
+	if len(notes) == 0 {
+		fmt.Printf("%s needs no changes\n", path)
+		return
+	}
+
+	fmt.Printf("--- %s\n+++ %s (fixed)\n", path, path)
+	printChainDiff(certs, fixed)
+	fmt.Printf("\n")
+	for _, note := range notes {
+		fmt.Printf("* %s\n", note)
+	}
+
+	destination := *output
+	if *inPlace {
+		destination = path
+	}
+	if len(destination) == 0 {
+		return
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		log.Fatalf("Could not create %s: %s", destination, err)
+		return
+	}
+	defer out.Close()
+
+	if err := writeCertificates(out, fixed); err != nil {
+		log.Fatalf("Could not write %s: %s", destination, err)
+		return
+	}
+}
+
+func runChainPolicies(args []string) {
+	flags := flag.NewFlagSet("chain policies", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 chain policies fullchain.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Prints the policy constraining extensions of each certificate in the chain, which\n")
+		fmt.Fprintf(flags.Output(), "starts with the leaf and ends with the root, and the policies the chain is valid\n")
+		fmt.Fprintf(flags.Output(), "for. Exits non-zero if the chain requires a policy and none is valid.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+
+	for _, cert := range certs {
+		fmt.Printf("%s\n", certificateLine(cert))
+		fmt.Printf("  policies: %s\n", cert.PolicyIdentifiers)
+		constraints, err := gx509.ParsePolicyConstraints(cert)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", cert.Subject.CommonName, err)
+			return
+		}
+		if len(constraints.String()) > 0 {
+			fmt.Printf("  constraints: %s\n", constraints)
+		}
+	}
+
+	result, err := gx509.ProcessChainPolicies(certs)
+	if err != nil {
+		log.Fatalf("Could not process policies: %s", err)
+		return
+	}
+	fmt.Printf("\n")
+	for _, note := range result.Notes {
+		fmt.Printf("* %s\n", note)
+	}
+	fmt.Printf("Valid policies: %s\n", result.Policies)
+	fmt.Printf("Explicit policy required: %t, anyPolicy inhibited: %t, mapping inhibited: %t\n",
+		result.ExplicitPolicyRequired, result.AnyPolicyInhibited, result.MappingInhibited)
+	if !result.Valid {
+		fmt.Printf("The chain requires an explicit policy, but none is valid\n")
+		os.Exit(1)
+	}
+}
+
+// parsePolicyOIDs parses a comma-separated list of dotted policy OIDs, in
+// which "any" stands for anyPolicy.
+func parsePolicyOIDs(list string) ([]asn1.ObjectIdentifier, error) {
+	var policies []asn1.ObjectIdentifier
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "any" {
+			policies = append(policies, gx509.OIDAnyPolicy)
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		for _, arc := range strings.Split(field, ".") {
+			n, err := strconv.Atoi(arc)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid OID %q", field)
+			}
+			oid = append(oid, n)
+		}
+		if len(oid) < 2 {
+			return nil, fmt.Errorf("Invalid OID %q", field)
+		}
+		policies = append(policies, oid)
+	}
+	return policies, nil
+}
+
+func runChainValidate(args []string) {
+	flags := flag.NewFlagSet("chain validate", flag.ExitOnError)
+	at := flags.String("at", "", "Validate as of this RFC 3339 time (default now)")
+	policies := flags.String("policy", "", "Comma-separated user-initial-policy-set OIDs (default anyPolicy)")
+	explicitPolicy := flags.Bool("explicit-policy", false, "Set initial-explicit-policy")
+	inhibitMapping := flags.Bool("inhibit-mapping", false, "Set initial-policy-mapping-inhibit")
+	inhibitAny := flags.Bool("inhibit-any", false, "Set initial-any-policy-inhibit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 chain validate [flags] fullchain.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Runs RFC 5280 path validation over the chain, which starts with the leaf and ends\n")
+		fmt.Fprintf(flags.Output(), "with the trust anchor, and prints the valid policy tree. Exits non-zero if the\n")
+		fmt.Fprintf(flags.Output(), "path is not valid.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+
+	input := gx509.PathValidationInput{
+		InitialExplicitPolicy:       *explicitPolicy,
+		InitialPolicyMappingInhibit: *inhibitMapping,
+		InitialAnyPolicyInhibit:     *inhibitAny,
+	}
+	if len(*at) > 0 {
+		if input.Time, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+	if len(*policies) > 0 {
+		if input.InitialPolicySet, err = parsePolicyOIDs(*policies); err != nil {
+			log.Fatalf("Invalid -policy: %s", err)
+			return
+		}
+	}
+
+	for _, cert := range certs {
+		fmt.Printf("%s\n", certificateLine(cert))
+	}
+
+	result := gx509.ValidatePath(certs, input)
+	fmt.Printf("\n")
+	if result.PolicyTree == nil {
+		fmt.Printf("Valid policy tree: NULL\n")
+	} else {
+		fmt.Printf("Valid policy tree:\n%s", result.PolicyTree)
+	}
+	fmt.Printf("Authorities-constrained policies: %s\n", result.AuthoritiesConstrainedPolicies)
+	fmt.Printf("User-constrained policies: %s\n", result.UserConstrainedPolicies)
+	for _, problem := range result.Errors {
+		fmt.Printf("* %s\n", problem)
+	}
+	if !result.Valid {
+		fmt.Printf("The path is not valid\n")
+		os.Exit(1)
+	}
+	fmt.Printf("The path is valid\n")
+}
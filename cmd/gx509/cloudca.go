@@ -0,0 +1,83 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// auditCloudCA prints the report of gx509.AuditCloudCA for ca, and exits
+// non-zero if any CA is unconstrained or any lint fails.
+func auditCloudCA(ca gx509.CloudCA, since time.Duration) {
+	now := time.Now()
+	report, err := gx509.AuditCloudCA(ca, now.Add(-since), now)
+	if err != nil {
+		log.Fatalf("Could not audit %s: %s", ca.Provider(), err)
+		return
+	}
+
+	printConstraints := func(id string) {
+		if a, ok := report.Constraints[id]; ok {
+			if a.Constrained {
+				fmt.Printf("    technically constrained\n")
+			} else {
+				fmt.Printf("    not technically constrained: %s\n", a.Details())
+			}
+		}
+	}
+
+	fmt.Printf("Certificate authorities:\n")
+	for _, authority := range report.Authorities {
+		kind := "subordinate"
+		if authority.Root {
+			kind = "root"
+		}
+		fmt.Printf("  %s %s %s\n", authority.ID, kind, authority.Status)
+		if authority.Cert == nil {
+			fmt.Printf("    no certificate installed\n")
+			continue
+		}
+		fmt.Printf("    %s\n", certificateLine(authority.Cert))
+		printConstraints(authority.ID)
+		if len(authority.Risks) > 0 {
+			fmt.Printf("    %s\n", strings.Join(authority.Risks, "; "))
+		}
+	}
+
+	fmt.Printf("\nIssued certificates:\n")
+	failures := report.Lints.Failures()
+	for _, cert := range report.Certificates {
+		var findings []gx509.Finding
+		for _, finding := range failures {
+			if finding.Path == cert.ID {
+				findings = append(findings, finding)
+			}
+		}
+		if _, ok := report.Constraints[cert.ID]; !ok && len(cert.Risks) == 0 && len(findings) == 0 {
+			continue
+		}
+		fmt.Printf("  %s\n    %s\n", cert.ID, certificateLine(cert.Cert))
+		printConstraints(cert.ID)
+		if len(cert.Risks) > 0 {
+			fmt.Printf("    template %s %s\n", cert.Template, strings.Join(cert.Risks, "; "))
+		}
+		for _, finding := range findings {
+			fmt.Printf("    %s %s: %s\n", finding.Lint.Severity, finding.Lint.Name, finding.Message)
+		}
+	}
+
+	unconstrained := report.Unconstrained()
+	fmt.Printf("\n%d CAs, %d certificates examined; %d unconstrained CAs, %d lints failed\n",
+		len(report.Authorities), len(report.Certificates), len(unconstrained), len(failures))
+	if len(unconstrained) > 0 || len(failures) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runCrawl(args []string) {
+	flags := flag.NewFlagSet("crawl", flag.ExitOnError)
+	hostsPath := flags.String("hosts", "", "File listing the subresource hosts or URLs, one per line")
+	harPath := flags.String("har", "", "HAR file whose HTTPS requests name the subresource hosts")
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file (default the embedded one)")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout for each connection")
+	store := flags.Bool("store", false, "Store the certificates found in the warehouse")
+	warehousePath := addWarehouseFlag(flags)
+	constrained := flags.Bool("constrained", false, "Flag hosts whose issuing CA is not technically constrained")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 crawl [flags] https://site...\n\n")
+		fmt.Fprintf(flags.Output(), "Connects to each site and to the hosts its subresources are loaded from,\n")
+		fmt.Fprintf(flags.Output(), "then summarizes which issuing CAs, and CA owners, the page depends on.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	var addresses []string
+	seen := make(map[string]bool)
+	add := func(found []string) {
+		for _, address := range found {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	for _, site := range positional {
+		address, ok := gx509.HostAddress(site)
+		if !ok {
+			log.Fatalf("Not an HTTPS URL or host: %s", site)
+			return
+		}
+		add([]string{address})
+	}
+	if len(*hostsPath) > 0 {
+		file, err := os.Open(*hostsPath)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", *hostsPath, err)
+			return
+		}
+		found, err := gx509.ParseHostList(file, nil)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *hostsPath, err)
+			return
+		}
+		add(found)
+	}
+	if len(*harPath) > 0 {
+		data, err := ioutil.ReadFile(*harPath)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *harPath, err)
+			return
+		}
+		found, err := gx509.ParseHAR(data)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *harPath, err)
+			return
+		}
+		add(found)
+	}
+	if len(addresses) == 0 {
+		log.Fatalf("You must specify a site, -hosts or -har")
+		return
+	}
+
+	table, err := loadOwnerTable(*ownersPath)
+	if err != nil {
+		log.Fatalf("Could not load owner table: %s", err)
+		return
+	}
+
+	flagged := 0
+	var servers []gx509.ServerChain
+	for _, server := range gx509.ScanHosts(addresses, *timeout, 8, 0) {
+		if server.Err != nil {
+			fmt.Printf("%s: %s\n", server.Address, server.Err)
+			flagged++
+			continue
+		}
+		fmt.Printf("%s: %s\n", server.Address, certificateLine(server.Certificates[0]))
+		servers = append(servers, server)
+	}
+
+	if *store {
+		if err := storeServerChains(*warehousePath, servers); err != nil {
+			log.Fatalf("Could not store certificates: %s", err)
+			return
+		}
+	}
+
+	fmt.Printf("\n")
+	flagged += printExposures(servers, gx509.SummarizeCAExposure(servers, table), *constrained)
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
+
+// printExposures summarizes the issuing CAs of servers. If constrained is
+// set, it returns the number of servers whose CAs are not technically
+// constrained.
+func printExposures(servers []gx509.ServerChain, exposures []gx509.CAExposure, constrained bool) int {
+	owners := make(map[string]bool)
+	for _, exposure := range exposures {
+		owners[exposure.Owner] = true
+	}
+	fmt.Printf("%d hosts use %d issuing CAs from %d owners\n", len(servers), len(exposures), len(owners))
+
+	flagged := 0
+	for _, exposure := range exposures {
+		status := "technically constrained"
+		if !exposure.Constrained {
+			status = "not technically constrained: " + exposure.Reason
+			if constrained {
+				flagged += len(exposure.Addresses)
+			}
+		}
+		fmt.Printf("%6d  %s (%s), %s\n", len(exposure.Addresses), exposure.IssuerName, exposure.Owner, status)
+		fmt.Printf("        %s\n", strings.Join(exposure.Addresses, ", "))
+	}
+	return flagged
+}
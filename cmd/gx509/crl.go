@@ -0,0 +1,196 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// printCRLHeader prints what header says of the CRL, indented.
+func printCRLHeader(header *gx509.CRLHeader) {
+	fmt.Printf("  issuer: %s\n", header.Issuer.CommonName)
+	fmt.Printf("  thisUpdate: %s\n", header.ThisUpdate.Format(time.RFC3339))
+	if !header.NextUpdate.IsZero() {
+		fmt.Printf("  nextUpdate: %s\n", header.NextUpdate.Format(time.RFC3339))
+		if header.NextUpdate.Before(time.Now()) {
+			fmt.Printf("  * the CRL is stale\n")
+		}
+	}
+	fmt.Printf("  entries: %d\n", header.Entries)
+	if !header.Verified {
+		fmt.Printf("  signature: not checked\n")
+	}
+}
+
+// printRevocation prints whether revocation, the entry for serial, revokes
+// it.
+func printRevocation(serial *big.Int, revocation *gx509.Revocation) {
+	if revocation == nil {
+		fmt.Printf("  serial %x: not revoked\n", serial)
+		return
+	}
+	fmt.Printf("  serial %x: revoked at %s", serial, revocation.RevokedAt.Format(time.RFC3339))
+	if revocation.HasReason {
+		fmt.Printf(" (%s)", revocation.Reason)
+	}
+	fmt.Printf("\n")
+}
+
+func runCRL(args []string) {
+	flags := flag.NewFlagSet("crl", flag.ExitOnError)
+	issuerPath := flags.String("issuer", "", "The issuer the CRL must be signed by, instead of the next certificate in the file or the one at its AIA caIssuers URL")
+	crlPath := flags.String("crl", "", "Read this DER or PEM CRL instead of downloading those at the certificate's CRL distribution points")
+	serialHex := flags.String("serial", "", "With -crl, look up this hex serial instead of a certificate's")
+	timeout := flags.Duration("timeout", time.Minute, "How long to wait for each CRL download")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 crl [flags] cert.pem\n")
+		fmt.Fprintf(flags.Output(), "       gx509 crl -crl file.crl [-issuer issuer.pem] [-serial hex | cert.pem]\n\n")
+		fmt.Fprintf(flags.Output(), "Downloads the CRL at each of the certificate's CRL distribution points, checks\n")
+		fmt.Fprintf(flags.Output(), "its issuer signed it, and reports whether the certificate is revoked, when and\n")
+		fmt.Fprintf(flags.Output(), "why. CRLs are read from disk a piece at a time, however large. With -crl, a\n")
+		fmt.Fprintf(flags.Output(), "local CRL is searched instead, or without a serial or certificate summarised\n")
+		fmt.Fprintf(flags.Output(), "by revocation reason; its signature is checked only with -issuer.\n")
+		fmt.Fprintf(flags.Output(), "Exits non-zero if the certificate is revoked or a CRL could not be checked.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	var issuer *x509.Certificate
+	if *issuerPath != "" {
+		issuers, err := loadCertificates(*issuerPath)
+		if err != nil {
+			log.Fatalf("Could not process file %s: %s", *issuerPath, err)
+			return
+		}
+		issuer = issuers[0]
+	}
+
+	var certs []*x509.Certificate
+	if len(positional) == 1 {
+		var err error
+		certs, err = loadCertificates(positional[0])
+		if err != nil {
+			log.Fatalf("Could not process file %s: %s", positional[0], err)
+			return
+		}
+	} else if len(positional) > 1 || *crlPath == "" {
+		log.Fatalf("You must specify the path to the certificate .pem file")
+		return
+	}
+
+	if *crlPath != "" {
+		var serial *big.Int
+		switch {
+		case *serialHex != "":
+			var ok bool
+			if serial, ok = new(big.Int).SetString(strings.Replace(*serialHex, ":", "", -1), 16); !ok {
+				log.Fatalf("Could not parse serial %s", *serialHex)
+				return
+			}
+		case len(certs) > 0:
+			serial = certs[0].SerialNumber
+			if issuer == nil && len(certs) > 1 {
+				issuer = certs[1]
+			}
+		}
+
+		file, err := os.Open(*crlPath)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", *crlPath, err)
+			return
+		}
+		defer file.Close()
+
+		fmt.Printf("%s\n", *crlPath)
+		if serial != nil {
+			header, revocation, err := gx509.FindRevocation(file, issuer, serial)
+			if err != nil {
+				log.Fatalf("Could not read %s: %s", *crlPath, err)
+				return
+			}
+			printCRLHeader(header)
+			printRevocation(serial, revocation)
+			if revocation != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		reasons := make(map[string]int)
+		header, err := gx509.ScanCRL(file, issuer, func(revocation gx509.Revocation) error {
+			if revocation.HasReason {
+				reasons[revocation.Reason.String()]++
+			} else {
+				reasons["no reason code"]++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *crlPath, err)
+			return
+		}
+		printCRLHeader(header)
+		var names []string
+		for name := range reasons {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			fmt.Printf("  reasons:\n")
+		}
+		for _, name := range names {
+			fmt.Printf("    %s: %d\n", name, reasons[name])
+		}
+		return
+	}
+
+	cert := certs[0]
+	if issuer == nil && len(certs) > 1 {
+		issuer = certs[1]
+	}
+	if issuer == nil {
+		issuers, err := gx509.FetchMissingIssuers(gx509.NewAIA(aiaTimeout, aiaMaxRedirects), certs[:1])
+		if err != nil {
+			log.Printf("%s", err)
+		}
+		if len(issuers) == 0 {
+			log.Fatalf("Could not find the issuer of %s; specify it with -issuer", cert.Subject.CommonName)
+			return
+		}
+		issuer = issuers[0]
+	}
+
+	fmt.Printf("%s\n", certificateLine(cert))
+	if len(cert.CRLDistributionPoints) == 0 {
+		fmt.Printf("  no CRL distribution points\n")
+		return
+	}
+	failed := false
+	for _, status := range gx509.CheckCRLs(&http.Client{Timeout: *timeout}, cert, issuer) {
+		fmt.Printf("%s\n", status.URL)
+		if status.Err != nil {
+			fmt.Printf("  error: %s\n", status.Err)
+			failed = true
+			continue
+		}
+		printCRLHeader(status.Header)
+		printRevocation(cert.SerialNumber, status.Revocation)
+		failed = failed || status.Revocation != nil
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
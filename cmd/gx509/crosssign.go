@@ -0,0 +1,105 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func pathNames(path []*x509.Certificate) string {
+	names := make([]string, len(path))
+	for i, cert := range path {
+		names[i] = cert.Subject.CommonName
+	}
+	return strings.Join(names, " -> ")
+}
+
+func runCrossSign(args []string) {
+	flags := flag.NewFlagSet("crosssign", flag.ExitOnError)
+	rootsPath := flags.String("roots", "system", "PEM file or directory of trusted roots, or \"system\"")
+	at := flags.String("at", "", "Verification time as RFC 3339 (default now)")
+	kbPath := flags.String("kb", "", "Path to a knowledge base YAML file (default the fetched or embedded one)")
+	output := flags.String("o", "", "Write the recommended chain to this file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 crosssign [flags] served-chain.pem\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the served chain .pem file")
+		return
+	}
+
+	served, err := loadCertificates(positional[0])
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", positional[0], err)
+		return
+	}
+
+	roots, err := loadRoots(*rootsPath)
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", *rootsPath, err)
+		return
+	}
+
+	when := time.Now()
+	if len(*at) > 0 {
+		if when, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	kb, err := loadKnowledgeBase(*kbPath)
+	if err != nil {
+		log.Fatalf("Could not load knowledge base: %s", err)
+		return
+	}
+
+	analysis := kb.AnalyzeCrossSigns(served, roots, when)
+
+	fmt.Printf("Served path: %s\n", pathNames(analysis.ServedPath))
+	fmt.Printf("Paths to a trusted root:\n")
+	for _, chain := range analysis.Chains {
+		fmt.Printf("  %s\n", pathNames(chain))
+	}
+
+	fmt.Printf("\n")
+	for _, verdict := range analysis.Verdicts {
+		outcome := "fails"
+		if verdict.Accepted {
+			outcome = "ok"
+		}
+		fmt.Printf("%-16s %-5s %s\n", verdict.Client, outcome, verdict.Reason)
+	}
+
+	fmt.Printf("\n")
+	if analysis.Recommended == nil {
+		fmt.Printf("No chain is valid at %s\n", when.Format(time.RFC3339))
+		return
+	}
+	fmt.Printf("Recommended chain to serve: %s\n", pathNames(analysis.Recommended))
+
+	if len(*output) > 0 {
+		out, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+
+		if err := writeCertificates(out, analysis.Recommended); err != nil {
+			log.Fatalf("Could not write %s: %s", *output, err)
+			return
+		}
+	}
+}
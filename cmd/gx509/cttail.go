@@ -0,0 +1,167 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runCTTail(args []string) {
+	flags := flag.NewFlagSet("ct-tail", flag.ExitOnError)
+	logURL := flags.String("log", "", "Base URL of the RFC 6962 log, under which ct/v1/get-entries is found")
+	statePath := flags.String("state", "", "File the index of the next entry to download is saved in")
+	start := flags.Int64("start", -1, "Index to start from if the state file has none (default the log's tree size, so only new entries)")
+	var analysisNames stringList
+	flags.Var(&analysisNames, "analyses", "Analyses to run on each entry (repeatable, default unconstrained-ca)")
+	policyName := flags.String("policy", gx509.DefaultPolicy.Name, "Policy to judge technical constraints by")
+	batchSize := flags.Uint64("batch", 256, "Number of entries to ask the log for at once")
+	max := flags.Uint64("max", 0, "Download at most this many entries a poll (default no limit)")
+	follow := flags.Bool("follow", false, "Keep polling for new entries until interrupted")
+	interval := flags.Duration("interval", time.Minute, "Time between polls with -follow")
+	webhook := flags.String("webhook", "", "Also POST the alerts of each poll to this URL")
+	alertsFile := flags.String("alerts-file", "", "Also append the alerts to this file")
+	resultsPath := flags.String("results", "", "Store the verdict on every certificate in this SQLite result store, for gx509 query -results")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 ct-tail -log URL -state state.json [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Downloads the entries of a Certificate Transparency log from the index saved\n")
+		fmt.Fprintf(flags.Output(), "in the state file, analyzes the certificate or precertificate of each, and\n")
+		fmt.Fprintf(flags.Output(), "writes a line of JSON to stdout for each alert. The index is saved after\n")
+		fmt.Fprintf(flags.Output(), "every batch, so the next run resumes where this one stopped. With -results,\n")
+		fmt.Fprintf(flags.Output(), "the verdict on every certificate is kept in an SQLite database. Analyses:\n\n")
+		for _, analysis := range gx509.CTAnalyses {
+			fmt.Fprintf(flags.Output(), "  %-18s %s\n", analysis.Name, analysis.Description)
+		}
+		fmt.Fprintf(flags.Output(), "\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *logURL == "" || *statePath == "" {
+		flags.Usage()
+		log.Fatalf("You must specify the log with -log and the state file with -state")
+		return
+	}
+	policy, ok := gx509.LookupPolicy(*policyName)
+	if !ok {
+		log.Fatalf("Unknown policy: %s", *policyName)
+		return
+	}
+	if len(analysisNames) == 0 {
+		analysisNames = stringList{"unconstrained-ca"}
+	}
+	tailer := &gx509.CTTailer{
+		Log:       gx509.NewCTLogClient(*logURL),
+		StatePath: *statePath,
+		BatchSize: *batchSize,
+		Policy:    policy,
+		Job:       "ct-tail",
+	}
+	for _, name := range analysisNames {
+		analysis := gx509.LookupCTAnalysis(name)
+		if analysis == nil {
+			log.Fatalf("Unknown analysis: %s", name)
+			return
+		}
+		tailer.Analyses = append(tailer.Analyses, analysis)
+	}
+	var sinks []gx509.AlertSink
+	if len(*webhook) > 0 {
+		sinks = append(sinks, &gx509.WebhookSink{URL: *webhook, Client: &http.Client{Timeout: 30 * time.Second}})
+	}
+	if len(*alertsFile) > 0 {
+		sinks = append(sinks, &gx509.FileSink{Path: *alertsFile})
+	}
+
+	var store *gx509.ResultStore
+	if len(*resultsPath) > 0 {
+		var err error
+		if store, err = gx509.OpenResultStore(*resultsPath); err != nil {
+			log.Fatalf("Could not open result store %s: %s", *resultsPath, err)
+			return
+		}
+	}
+
+	if _, saved, err := gx509.LoadCTState(*statePath, tailer.Log.URL); err != nil {
+		log.Fatalf("Could not load %s: %s", *statePath, err)
+		return
+	} else if !saved {
+		next := uint64(*start)
+		if *start < 0 {
+			if next, err = tailer.Log.TreeSize(); err != nil {
+				log.Fatalf("Could not get the tree size of %s: %s", tailer.Log.URL, err)
+				return
+			}
+		}
+		if err := gx509.SaveCTState(*statePath, tailer.Log.URL, next); err != nil {
+			log.Fatalf("Could not save %s: %s", *statePath, err)
+			return
+		}
+		log.Printf("Starting %s at entry %d", tailer.Log.URL, next)
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Received %s, stopping after this poll", <-signals)
+		close(stop)
+	}()
+
+	encoder := json.NewEncoder(os.Stdout)
+	for {
+		var alerts []gx509.Alert
+		at := time.Now().UTC()
+		poll, err := tailer.Poll(*max, at, func(entry *gx509.CTEntry, found []gx509.Alert) {
+			for _, alert := range found {
+				encoder.Encode(alert)
+			}
+			alerts = append(alerts, found...)
+			if store != nil && entry.Certificate != nil {
+				analysis := gx509.AnalyzeTechnicalConstraintsForPolicy(entry.Certificate, policy)
+				store.Add(entry.Certificate, gx509.NewConstraintResult("", entry.Certificate, analysis), fmt.Sprintf("%s#%d", tailer.Log.URL, entry.Index), at)
+			}
+		})
+		if store != nil {
+			if err := store.Save(); err != nil {
+				log.Printf("Could not save result store %s: %s", *resultsPath, err)
+			}
+		}
+		if len(alerts) > 0 {
+			for _, sink := range sinks {
+				if err := sink.Send(alerts); err != nil {
+					log.Printf("Could not send %d alerts: %s", len(alerts), err)
+				}
+			}
+		}
+		if err != nil {
+			if !*follow {
+				log.Fatalf("Could not poll %s: %s", tailer.Log.URL, err)
+				return
+			}
+			log.Printf("Could not poll %s: %s", tailer.Log.URL, err)
+		} else {
+			log.Printf("Analyzed entries %d to %d of %d: %d alerts, %d unparseable",
+				poll.Start, poll.Next, poll.TreeSize, poll.Alerts, poll.Unparseable)
+		}
+		if !*follow {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
@@ -0,0 +1,248 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// maxCTDownloads bounds the certificates a CT job downloads from crt.sh in
+// one run; the rest are left for later runs.
+const maxCTDownloads = 100
+
+// A daemon runs the scan jobs of its configuration, sharing one warehouse
+// between them.
+type daemon struct {
+	config *gx509.DaemonConfig
+	// verdicts, if set, records the verdict on everything the jobs find.
+	verdicts *gx509.VerdictLog
+
+	// mu guards the warehouse file and the fields below.
+	mu sync.Mutex
+	// alerted holds the alerts already sent, by fingerprint and message, so
+	// each is sent once.
+	alerted map[string]bool
+	// seenCT holds the crt.sh IDs already downloaded.
+	seenCT map[int64]bool
+}
+
+// addToWarehouse is storeInWarehouse that also returns the fingerprints of
+// the certificates new to the warehouse.
+func addToWarehouse(path string, found map[string][]*x509.Certificate, at time.Time) (map[[sha256.Size]byte]bool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	warehouse, err := gx509.OpenWarehouse(path)
+	if err != nil {
+		return nil, err
+	}
+	added := make(map[[sha256.Size]byte]bool)
+	for source, certs := range found {
+		for _, cert := range certs {
+			if warehouse.Add(cert, source, at) {
+				added[sha256.Sum256(cert.Raw)] = true
+			}
+		}
+	}
+	warehouse.Compact(warehouse.Retention, at)
+	return added, warehouse.Save()
+}
+
+// scan runs job once, returning the certificates it found by source and
+// alerts for the sources it could not scan.
+func (d *daemon) scan(job gx509.DaemonJob, at time.Time) (map[string][]*x509.Certificate, []gx509.Alert) {
+	found := make(map[string][]*x509.Certificate)
+	var alerts []gx509.Alert
+	failed := func(source string, err error) {
+		alerts = append(alerts, gx509.Alert{Job: job.Name, Time: at, Source: source, Message: err.Error()})
+	}
+
+	if len(job.Directories) > 0 {
+		err := scanCertificates(job.Directories, func(path string, certs []*x509.Certificate) {
+			found[path] = certs
+		})
+		if err != nil {
+			failed(fmt.Sprintf("%v", job.Directories), err)
+		}
+	}
+
+	for _, server := range gx509.ScanHosts(job.Endpoints, job.Timeout, 8, 0) {
+		if server.Err != nil {
+			failed(server.Address, fmt.Errorf("Could not fetch chain: %s", server.Err))
+			continue
+		}
+		found[server.Address] = server.Certificates
+	}
+
+	if len(job.CTDomains) > 0 {
+		crtsh := gx509.NewCrtSh()
+		crtsh.Client.Timeout = job.Timeout
+		for _, domain := range job.CTDomains {
+			source := "crt.sh:" + domain
+			ids, err := crtsh.Search(url.Values{"q": {domain}, "exclude": {"expired"}})
+			if err != nil {
+				failed(source, fmt.Errorf("Could not search crt.sh: %s", err))
+				continue
+			}
+			downloads := 0
+			for _, id := range ids {
+				d.mu.Lock()
+				seen := d.seenCT[id]
+				d.mu.Unlock()
+				if seen {
+					continue
+				}
+				if downloads == maxCTDownloads {
+					log.Printf("%s: leaving further crt.sh results for %s to the next run", job.Name, domain)
+					break
+				}
+				downloads++
+				cert, err := crtsh.Certificate(id)
+				if err != nil {
+					failed(source, fmt.Errorf("Could not download crt.sh ID %d: %s", id, err))
+					continue
+				}
+				found[source] = append(found[source], cert)
+				d.mu.Lock()
+				d.seenCT[id] = true
+				d.mu.Unlock()
+			}
+		}
+	}
+	return found, alerts
+}
+
+// run runs job once, stores what it found and sends alerts about it.
+func (d *daemon) run(job gx509.DaemonJob, at time.Time) {
+	start := time.Now()
+	found, alerts := d.scan(job, at)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	added, err := addToWarehouse(d.config.Warehouse, found, at)
+	if err != nil {
+		log.Printf("%s: Could not store certificates: %s", job.Name, err)
+	}
+
+	certificates := 0
+	for source, certs := range found {
+		certificates += len(certs)
+		record := gx509.VerdictRecord{
+			Time:       at,
+			Caller:     job.Name,
+			Source:     source,
+			InputHash:  gx509.CertificatesHash(certs),
+			PolicyHash: d.config.ConfigHash(),
+		}
+		for _, cert := range certs {
+			verdict := gx509.NewVerdict(cert, gx509.DefaultPolicy)
+			for _, alert := range gx509.CertificateAlerts(job.Name, source, cert, added[sha256.Sum256(cert.Raw)], at, d.config.ExpiryWarning) {
+				verdict.Alerts = append(verdict.Alerts, alert.Message)
+				key := alert.Fingerprint + "\n" + alert.Message
+				if !d.alerted[key] {
+					d.alerted[key] = true
+					alerts = append(alerts, alert)
+				}
+			}
+			record.Verdicts = append(record.Verdicts, verdict)
+		}
+		if d.verdicts != nil {
+			if err := d.verdicts.Write(record); err != nil {
+				log.Printf("%s: %s", job.Name, err)
+			}
+		}
+	}
+	log.Printf("%s: found %d certificates, %d new, and raised %d alerts in %s", job.Name, certificates, len(added), len(alerts),
+		time.Since(start).Round(time.Millisecond))
+
+	if len(alerts) == 0 {
+		return
+	}
+	for _, sink := range d.config.Alerts {
+		if err := sink.Send(alerts); err != nil {
+			log.Printf("%s: Could not send alerts: %s", job.Name, err)
+		}
+	}
+}
+
+func runDaemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := flags.String("config", "", "Path to the daemon configuration YAML file")
+	once := flags.Bool("once", false, "Run every job once, in order, and exit instead of following their schedules")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 daemon -config daemon.yaml\n\n")
+		fmt.Fprintf(flags.Output(), "Runs the scan jobs in the configuration, which scan directories, fetch the\n")
+		fmt.Fprintf(flags.Output(), "chains of TLS endpoints or search Certificate Transparency through crt.sh,\n")
+		fmt.Fprintf(flags.Output(), "whenever their cron schedules fall due. What they find is kept in the\n")
+		fmt.Fprintf(flags.Output(), "warehouse, and new intermediates that are not technically constrained,\n")
+		fmt.Fprintf(flags.Output(), "certificates near expiry and failed scans are sent to the alert sinks.\n")
+		fmt.Fprintf(flags.Output(), "With a verdictLog, the verdict on every certificate found is recorded.\n")
+		fmt.Fprintf(flags.Output(), "Runs until interrupted, letting running jobs finish.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *configPath == "" {
+		log.Fatalf("You must specify the configuration with -config")
+		return
+	}
+	data, err := ioutil.ReadFile(*configPath)
+	if err != nil {
+		log.Fatalf("Could not read %s: %s", *configPath, err)
+		return
+	}
+	config, err := gx509.ParseDaemonConfig(data)
+	if err != nil {
+		log.Fatalf("Could not parse %s: %s", *configPath, err)
+		return
+	}
+
+	d := &daemon{config: config, alerted: make(map[string]bool), seenCT: make(map[int64]bool)}
+	if config.VerdictLog != "" {
+		if d.verdicts, err = gx509.OpenVerdictLog(config.VerdictLog, config.VerdictLogMaxSize, config.VerdictLogBackups); err != nil {
+			log.Fatalf("%s", err)
+			return
+		}
+		defer d.verdicts.Close()
+	}
+	if *once {
+		for _, job := range config.Jobs {
+			d.run(job, time.Now().UTC())
+		}
+		return
+	}
+
+	var jobs []gx509.ScheduledJob
+	for _, job := range config.Jobs {
+		job := job
+		jobs = append(jobs, gx509.ScheduledJob{Name: job.Name, Schedule: job.Schedule, Run: func(at time.Time) {
+			d.run(job, at.UTC())
+		}})
+		log.Printf("%s: scheduled %q, next at %s", job.Name, job.Schedule.Spec, job.Schedule.Next(time.Now()).Format(time.RFC3339))
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Received %s, stopping once running jobs finish", <-signals)
+		close(stop)
+	}()
+	gx509.RunScheduler(jobs, stop)
+}
@@ -0,0 +1,77 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runData(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 data show|dump [flags]")
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		runDataShow(args[1:])
+	case "dump":
+		runDataDump(args[1:])
+	default:
+		log.Fatalf("Unknown data command: %s", args[0])
+	}
+}
+
+func runDataShow(args []string) {
+	flags := flag.NewFlagSet("data show", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 data show\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the data built into this binary, with the version of each.\n")
+		flags.PrintDefaults()
+	}
+	if positional := parseInterspersed(flags, args); len(positional) != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	for _, data := range gx509.DataSets() {
+		source := "compiled in"
+		if len(data.File) > 0 {
+			source = fmt.Sprintf("%s, %d bytes", data.File, len(data.Contents))
+		}
+		fmt.Printf("%-14s %-20s %s\n", data.Name, data.Version, source)
+		fmt.Printf("%-14s %-20s %s\n", "", "", data.Description)
+	}
+}
+
+func runDataDump(args []string) {
+	flags := flag.NewFlagSet("data dump", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 data dump name\n\n")
+		fmt.Fprintf(flags.Output(), "Writes the embedded file of a data set that gx509 data show lists.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the data set to dump")
+		return
+	}
+	data, ok := gx509.LookupDataSet(positional[0])
+	if !ok {
+		log.Fatalf("Unknown data set: %s", positional[0])
+		return
+	}
+	if len(data.File) == 0 {
+		log.Fatalf("%s is compiled in, not embedded from a file", data.Name)
+		return
+	}
+	os.Stdout.Write(data.Contents)
+}
@@ -0,0 +1,11 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command gx509 reports whether CA certificates are technically constrained,
+// and audits certificates, chains and trust stores more broadly. Run it
+// without arguments for its usage.
+//
+// The data it needs, such as client behaviors, CA owners and OID names, is
+// embedded in the binary, so it runs air-gapped; gx509 data show lists it.
+package main
@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runGCPCAS(args []string) {
+	flags := flag.NewFlagSet("gcpcas", flag.ExitOnError)
+	project := flags.String("project", os.Getenv("CLOUDSDK_CORE_PROJECT"), "The Google Cloud project; defaults to $CLOUDSDK_CORE_PROJECT")
+	location := flags.String("location", "", "The location of the CA pools, such as us-central1")
+	since := flags.Duration("since", 30*24*time.Hour, "Only examine certificates issued this recently")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 gcpcas [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether each Google Certificate Authority Service CA in a location is\n")
+		fmt.Fprintf(flags.Output(), "technically constrained, with the risks of its pool's issuance policy, and lints\n")
+		fmt.Fprintf(flags.Output(), "the certificates issued recently with the risks of their templates. The access\n")
+		fmt.Fprintf(flags.Output(), "token is read from $GOOGLE_OAUTH_ACCESS_TOKEN, or 'gcloud auth print-access-token'.\n")
+		fmt.Fprintf(flags.Output(), "Exits non-zero if any CA is unconstrained or any lint fails.\n")
+		flags.PrintDefaults()
+	}
+	parseInterspersed(flags, args)
+
+	if len(*project) == 0 || len(*location) == 0 {
+		log.Fatalf("You must specify -project and -location")
+		return
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if len(token) == 0 {
+		output, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+		if err != nil {
+			log.Fatalf("Could not get an access token from gcloud: %s", err)
+			return
+		}
+		token = strings.TrimSpace(string(output))
+	}
+
+	auditCloudCA(gx509.NewGoogleCAS(*project, *location, token), *since)
+}
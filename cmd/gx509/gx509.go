@@ -5,65 +5,746 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jcjones/gx509/gx509"
 )
 
 var printHeaders = flag.Bool("headers", false, "Add PEM-headers to each block (not compatible with OpenSSL)")
+var findAlternates = flag.Bool("alternates", false, "Search crt.sh for alternate issuers and rank every viable chain")
+var alternateRoots = flag.String("roots", "system", "Trusted roots for -alternates: PEM file, directory, or \"system\"")
+var constraintPolicy = flag.String("policy", "", "Judge constraints by this policy: mozilla-2.2, mozilla-2.5, mozilla-2.7, cabr-baseline, or \"issuance\" for the Mozilla policy in force when the certificate was issued")
+var constraintsAt = flag.String("at", "", "Judge constraints by the Mozilla policy in force on this date (YYYY-MM-DD)")
+var recursive = flag.Bool("r", false, "Recurse into the subdirectories of directory arguments")
+var jsonOutput = flag.Bool("json", false, "Write the analysis of each certificate as a line of JSON instead of text; short for -format json")
+var outputFormat = flag.String("format", "", "Write the analyses in this format instead of text: "+strings.Join(gx509.RendererFormats(), ", "))
+var printExtensions = flag.Bool("extensions", false, "Print every extension of each certificate, decoded where gx509 knows it")
+var textOutput = flag.Bool("text", false, "Print each certificate in full as openssl x509 -text does, instead of its constraints; short for -format openssl")
+var fetchAIA = flag.Bool("fetch-aia", false, "Download missing issuers from the caIssuers URLs of each file's certificates, and analyze them too")
+var crtshLookup = flag.Bool("crtsh", false, "Look each argument up on crt.sh as a SHA-256 fingerprint, and analyze the certificate and its logged issuers instead of reading files")
+var crtshIssuer = flag.String("crtsh-issuer", "", "With -crtsh, look arguments up as hex serial numbers of certificates whose issuer name contains this")
+var checkOneCRL = flag.Bool("onecrl", false, "Download Mozilla's OneCRL and report whether it revokes each certificate")
+var oneCRLFile = flag.String("onecrl-file", "", "Report whether each certificate is revoked by the OneCRL records in this JSON file, as Remote Settings serves them")
 
-func processCertData(file *os.File) (*x509.Certificate, error) {
-	pemBytes, err := ioutil.ReadAll(file)
+// AIA downloads are limited to this long and this many redirects each.
+const (
+	aiaTimeout      = 10 * time.Second
+	aiaMaxRedirects = 5
+)
+
+// oneCRLTimeout limits the download of OneCRL.
+const oneCRLTimeout = 30 * time.Second
+
+// processCertData returns every certificate in file, which holds DER, a
+// PKCS#7 bundle or a bundle of PEM blocks. PEM blocks other than
+// certificates and PKCS#7, such as keys, are logged and skipped.
+func processCertData(file io.Reader) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		return nil, err
 	}
 
-	pemObj, _ := pem.Decode(pemBytes)
-	if pemObj.Type != "CERTIFICATE" {
-		return nil, fmt.Errorf("Unknown PEM type: %s", pemObj.Type)
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" && block.Type != "PKCS7" {
+			log.Printf("Skipping %s block", block.Type)
+		}
 	}
 
-	certObj, err := x509.ParseCertificate(pemObj.Bytes)
+	return gx509.ParseCertificatesFromBytes(data)
+}
+
+// loadCertificate reads the first PEM or DER certificate from path.
+func loadCertificate(path string) (*x509.Certificate, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	return certObj, nil
+	certs, err := processCertData(file)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
 }
 
-func main() {
-	flag.Parse()
-	if flag.NArg() != 1 {
-		log.Fatalf("You must specify the path to the .pem file as the last argument")
-		return
+// loadCertificates reads every PEM or DER certificate from path, or standard
+// input if path is "-", in order.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	if path == "-" {
+		return processCertData(os.Stdin)
 	}
 
-	file, err := os.Open(flag.Arg(0))
+	file, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Could not open file %s: %s", flag.Arg(0), err)
-		return
+		return nil, err
 	}
+	defer file.Close()
+
+	return processCertData(file)
+}
 
-	cert, err := processCertData(file)
+// certificateExtensions are the file names considered when loading a
+// directory of certificates.
+var certificateExtensions = map[string]bool{".pem": true, ".crt": true, ".cer": true, ".der": true, ".p7b": true, ".p7c": true}
+
+// loadCertificatesFromPath reads every certificate in path, which may be a
+// PEM or DER file or a directory of them. Files in a directory that cannot
+// be read are skipped.
+func loadCertificatesFromPath(path string) ([]*x509.Certificate, error) {
+	files, err := expandInputs([]string{path}, false)
 	if err != nil {
-		log.Fatalf("Could not process file: %s", flag.Arg(0), err)
-		return
+		return nil, err
+	}
+	if len(files) == 1 && files[0] == path {
+		return loadCertificates(path)
 	}
 
-	fmt.Printf("\n")
-	fmt.Printf("X509v3 Name Constraints (critical): %t\n", cert.PermittedDNSDomainsCritical)
-	fmt.Printf("X509v3 PermittedDNSDomains: %s\n", cert.PermittedDNSDomains)
-	fmt.Printf("X509v3 PermittedIPAddresses: %s\n", cert.PermittedIPAddresses)
-	fmt.Printf("X509v3 ExcludedDNSDomains: %s\n", cert.ExcludedDNSDomains)
-	fmt.Printf("X509v3 ExcludedIPAddresses: %s\n", cert.ExcludedIPAddresses)
+	var certs []*x509.Certificate
+	for _, file := range files {
+		found, err := loadCertificates(file)
+		if err != nil {
+			log.Printf("Skipping %s: %s", file, err)
+			continue
+		}
+		certs = append(certs, found...)
+	}
+	return certs, nil
+}
+
+// expandInputs turns the file, directory and glob pattern arguments into the
+// files to read, leaving "-" for standard input as it is. Directories
+// contribute the files with certificateExtensions in them, and in their
+// subdirectories if recurse is set.
+func expandInputs(args []string, recurse bool) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+		matches := []string{arg}
+		if _, err := os.Stat(arg); os.IsNotExist(err) && strings.ContainsAny(arg, "*?[") {
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("Invalid pattern %s: %s", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("No files match %s", arg)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, match)
+				continue
+			}
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					if path != match && !recurse {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if certificateExtensions[strings.ToLower(filepath.Ext(path))] {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
 
-	result, details := gx509.DetermineIfTechnicallyConstrained(cert)
+// systemRootFiles are the usual locations of the platform trust store.
+var systemRootFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt", // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",   // Fedora/RHEL
+	"/etc/ssl/ca-bundle.pem",             // OpenSUSE
+	"/etc/pki/tls/cacert.pem",            // OpenELEC
+	"/etc/ssl/cert.pem",                  // OpenBSD, macOS
+}
 
-	log.Printf("%s result: %v details: %s", flag.Arg(0), result, details)
+// isCertdata reports whether path is an NSS certdata.txt file rather than
+// PEM.
+func isCertdata(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	contents, err := ioutil.ReadFile(path)
+	return err == nil && bytes.Contains(contents, []byte("CKO_CERTIFICATE"))
+}
+
+// isSST reports whether path is a Windows serialized certificate store.
+func isSST(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	contents, err := ioutil.ReadFile(path)
+	return err == nil && gx509.IsSST(contents)
+}
+
+// loadSST reads the certificates and the purposes they are trusted for from
+// a serialized certificate store.
+func loadSST(path string) ([]gx509.TrustedRoot, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gx509.ParseSST(contents)
+}
+
+// nssDatabasePath returns the cert9.db at path, which is either the database
+// or an NSS profile directory holding one.
+func nssDatabasePath(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "cert9.db")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	header := make([]byte, 16)
+	_, err = io.ReadFull(file, header)
+	return path, err == nil && gx509.IsSQLite(header)
+}
+
+// loadNSSDatabase reads the certificates in the NSS database at path, noting
+// which have keys if there is a key4.db beside it.
+func loadNSSDatabase(path string) ([]gx509.NSSCertificate, error) {
+	cert9, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key4, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), "key4.db"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return gx509.ParseNSSDatabase(cert9, key4)
+}
+
+// loadCertdata reads the roots and their trust bits from a certdata.txt file.
+func loadCertdata(path string) ([]gx509.TrustedRoot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return gx509.ParseCertdata(file)
+}
+
+// loadTrustedRoots is like loadRoots, but keeps the trust bits from a
+// certdata.txt, SST or NSS database. Roots from PEM files are trusted for
+// everything, and labelled with their common names, or organizations or
+// fingerprints if they have none.
+func loadTrustedRoots(path string) ([]gx509.TrustedRoot, error) {
+	if path != "system" && isCertdata(path) {
+		return loadCertdata(path)
+	}
+	if path != "system" && isSST(path) {
+		return loadSST(path)
+	}
+	if database, ok := nssDatabasePath(path); path != "system" && ok {
+		certs, err := loadNSSDatabase(database)
+		if err != nil {
+			return nil, err
+		}
+		roots := make([]gx509.TrustedRoot, 0, len(certs))
+		for _, cert := range certs {
+			roots = append(roots, cert.Root())
+		}
+		return roots, nil
+	}
+
+	certs, err := loadRoots(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]gx509.TrustedRoot, 0, len(certs))
+	for _, cert := range certs {
+		label := cert.Subject.CommonName
+		if label == "" && len(cert.Subject.Organization) > 0 {
+			label = cert.Subject.Organization[0]
+		}
+		if label == "" {
+			label = fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+		}
+		roots = append(roots, gx509.TrustedRoot{Label: label, Cert: cert, Trust: gx509.TrustAll})
+	}
+	return roots, nil
+}
+
+// loadRoots reads a trust store from path, or from the platform if path is
+// "system". Only the roots a certdata.txt, SST or NSS database trusts for
+// server authentication are returned.
+func loadRoots(path string) ([]*x509.Certificate, error) {
+	_, nss := nssDatabasePath(path)
+	if path != "system" && (isCertdata(path) || isSST(path) || nss) {
+		trusted, err := loadTrustedRoots(path)
+		if err != nil {
+			return nil, err
+		}
+		var roots []*x509.Certificate
+		for _, root := range gx509.FilterRoots(trusted, gx509.RootFilter{Trust: gx509.TrustServerAuth}) {
+			roots = append(roots, root.Cert)
+		}
+		return roots, nil
+	}
+	if path != "system" {
+		return loadCertificatesFromPath(path)
+	}
+	for _, file := range systemRootFiles {
+		if roots, err := loadCertificates(file); err == nil {
+			return roots, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find a system trust store")
+}
+
+// parseInterspersed parses flags that may appear before, between or after the
+// positional arguments, and returns the positional arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Subcommands take the arguments following their name on the command line.
+var commands = map[string]func(args []string){
+	"appsign":      runAppSign,
+	"attrcert":     runAttrCert,
+	"audits":       runAudits,
+	"authenticode": runAuthenticode,
+	"awspca":       runAWSPCA,
+	"azurekv":      runAzureKeyVault,
+	"batch":        runBatch,
+	"bundle":       runBundle,
+	"ccadb":        runCCADB,
+	"certmanager":  runCertManager,
+	"chain":        runChain,
+	"crawl":        runCrawl,
+	"crl":          runCRL,
+	"crosssign":    runCrossSign,
+	"ct-tail":      runCTTail,
+	"daemon":       runDaemon,
+	"data":         runData,
+	"gcpcas":       runGCPCAS,
+	"image":        runImage,
+	"impact":       runImpact,
+	"inventory":    runInventory,
+	"jwt":          runJWT,
+	"kb":           runKnowledgeBase,
+	"lint":         runLint,
+	"match":        runMatch,
+	"matrix":       runMatrix,
+	"ocsp":         runOCSP,
+	"orgs":         runOrgs,
+	"owners":       runOwners,
+	"pkcs12":       runPKCS12,
+	"precert":      runPrecert,
+	"probe":        runProbe,
+	"query":        runQuery,
+	"replay":       runReplay,
+	"risk":         runRisk,
+	"roots":        runRoots,
+	"scan":         runScan,
+	"scan-hosts":   runScanHosts,
+	"serve":        runServe,
+	"sct":          runSCT,
+	"simulate":     runSimulate,
+	"ssh":          runSSH,
+	"stepca":       runStepCA,
+	"terraform":    runTerraform,
+	"vault":        runVault,
+	"verify":       runVerify,
+	"warehouse":    runWarehouse,
+}
+
+// Exit codes of the constraint check, for scripts and CI gates. Where several
+// apply, exitParseError wins over exitNotConstrained, which wins over
+// exitNotCA.
+const (
+	exitConstrained    = 0
+	exitNotConstrained = 1
+	exitParseError     = 2
+	exitNotCA          = 3
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: gx509 [flags] path...\n       gx509 command [flags] args...\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Reports whether each certificate in the given files, directories or glob\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "patterns, or - for standard input, is technically constrained. Exits with:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %d  every CA certificate is technically constrained\n", exitConstrained)
+		fmt.Fprintf(flag.CommandLine.Output(), "  %d  a CA certificate is not technically constrained\n", exitNotConstrained)
+		fmt.Fprintf(flag.CommandLine.Output(), "  %d  a file could not be read or parsed, a lookup failed, or the arguments were invalid\n", exitParseError)
+		fmt.Fprintf(flag.CommandLine.Output(), "  %d  none of the certificates is a CA\n", exitNotCA)
+		fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(flag.CommandLine.Output(), " %s\n\n", strings.Join(names, ", "))
+		flag.PrintDefaults()
+	}
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	args := parseInterspersed(flag.CommandLine, os.Args[1:])
+	if len(*crtshIssuer) > 0 && !*crtshLookup {
+		log.Printf("-crtsh-issuer can only be used with -crtsh")
+		os.Exit(exitParseError)
+	}
+	if len(args) == 0 && *crtshLookup {
+		log.Printf("You must specify the fingerprints or serial numbers to look up")
+		os.Exit(exitParseError)
+	}
+	if len(args) == 0 {
+		// Read a pipeline, but don't wait on a terminal
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			log.Printf("You must specify the certificate files, directories or glob patterns to check, or - for standard input")
+			os.Exit(exitParseError)
+		}
+		args = []string{"-"}
+	}
+	if len(*constraintsAt) > 0 && len(*constraintPolicy) > 0 {
+		log.Printf("Only one of -at and -policy can be given")
+		os.Exit(exitParseError)
+	}
+	format := *outputFormat
+	for _, shorthand := range []struct {
+		set    bool
+		format string
+	}{{*jsonOutput, "json"}, {*textOutput, "openssl"}} {
+		if !shorthand.set {
+			continue
+		}
+		if len(format) > 0 {
+			log.Printf("Only one of -format, -json and -text can be given")
+			os.Exit(exitParseError)
+		}
+		format = shorthand.format
+	}
+	var renderer gx509.Renderer
+	if len(format) > 0 {
+		if *findAlternates {
+			log.Printf("-alternates cannot be used with -format, -json or -text")
+			os.Exit(exitParseError)
+		}
+		var err error
+		if renderer, err = gx509.NewRenderer(format, os.Stdout); err != nil {
+			log.Printf("%s", err)
+			os.Exit(exitParseError)
+		}
+	}
+	var at time.Time
+	if len(*constraintsAt) > 0 {
+		var err error
+		if at, err = time.Parse("2006-01-02", *constraintsAt); err != nil {
+			log.Printf("Could not parse date %s: %s", *constraintsAt, err)
+			os.Exit(exitParseError)
+		}
+	} else if len(*constraintPolicy) > 0 && *constraintPolicy != "issuance" {
+		if _, ok := gx509.LookupPolicy(*constraintPolicy); !ok {
+			log.Printf("Unknown policy: %s", *constraintPolicy)
+			os.Exit(exitParseError)
+		}
+	}
+
+	if *checkOneCRL && len(*oneCRLFile) > 0 {
+		log.Printf("Only one of -onecrl and -onecrl-file can be given")
+		os.Exit(exitParseError)
+	}
+	var onecrl *gx509.OneCRL
+	if *checkOneCRL {
+		var err error
+		if onecrl, err = gx509.FetchOneCRL(&http.Client{Timeout: oneCRLTimeout}, gx509.OneCRLURL); err != nil {
+			log.Printf("Could not download OneCRL: %s", err)
+			os.Exit(exitParseError)
+		}
+	} else if len(*oneCRLFile) > 0 {
+		data, err := ioutil.ReadFile(*oneCRLFile)
+		if err == nil {
+			onecrl, err = gx509.ParseOneCRL(data)
+		}
+		if err != nil {
+			log.Printf("Could not load OneCRL from %s: %s", *oneCRLFile, err)
+			os.Exit(exitParseError)
+		}
+	}
+
+	files, load := args, loadCertificates
+	if *crtshLookup {
+		crtsh := gx509.NewCrtSh()
+		load = func(query string) ([]*x509.Certificate, error) {
+			return loadFromCrtSh(crtsh, query)
+		}
+	} else {
+		var err error
+		if files, err = expandInputs(args, *recursive); err != nil {
+			log.Printf("%s", err)
+			os.Exit(exitParseError)
+		}
+	}
+
+	report := gx509.Report{Kind: gx509.AnalysisReport, Generated: time.Now()}
+	var checked, constrained, failed, cas, unconstrainedCAs int
+	for _, path := range files {
+		certs, err := load(path)
+		if err != nil {
+			log.Printf("Could not process file %s: %s", path, err)
+			failed++
+			continue
+		}
+		if *fetchAIA {
+			fetched, err := gx509.FetchMissingIssuers(gx509.NewAIA(aiaTimeout, aiaMaxRedirects), certs)
+			if err != nil {
+				log.Printf("%s: %s", path, err)
+			}
+			certs = append(certs, fetched...)
+		}
+
+		for i, cert := range certs {
+			name := path
+			if len(certs) > 1 {
+				name = fmt.Sprintf("%s#%d", path, i+1)
+			}
+
+			policy := gx509.DefaultPolicy
+			if !at.IsZero() {
+				policy = gx509.MozillaPolicyAt(at)
+			} else if *constraintPolicy == "issuance" {
+				policy = gx509.MozillaPolicyAt(cert.NotBefore)
+			} else if len(*constraintPolicy) > 0 {
+				policy, _ = gx509.LookupPolicy(*constraintPolicy)
+			}
+			analysis := gx509.AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+
+			checked++
+			if analysis.Constrained {
+				constrained++
+			}
+			if cert.IsCA {
+				cas++
+				if !analysis.Constrained {
+					unconstrainedCAs++
+				}
+			}
+			var revocation *gx509.OneCRLResult
+			if onecrl != nil {
+				revocation = gx509.NewOneCRLResult(onecrl, cert)
+			}
+			if renderer != nil {
+				result := gx509.NewConstraintResult(name, cert, analysis)
+				result.OneCRL = revocation
+				report.Results = append(report.Results, result)
+				if format == "openssl" {
+					for _, deviation := range gx509.EncodingDeviations(cert) {
+						log.Printf("%s: %s", name, deviation)
+					}
+					log.Printf("%s result under %s: %v details: %s", name, policy.Name, analysis.Constrained, analysis.Details())
+				}
+				continue
+			}
+
+			fmt.Printf("\n")
+			fmt.Printf("%s: %s\n", name, cert.Subject.CommonName)
+			for _, deviation := range gx509.EncodingDeviations(cert) {
+				fmt.Printf("Deviation: %s\n", deviation)
+			}
+			fmt.Printf("Extension order: %s\n", strings.Join(gx509.ExtensionOrder(cert), ", "))
+			fmt.Printf("X509v3 Name Constraints (critical): %t\n", cert.PermittedDNSDomainsCritical)
+			fmt.Printf("X509v3 PermittedDNSDomains: %s\n", cert.PermittedDNSDomains)
+			fmt.Printf("X509v3 PermittedIPAddresses: %s\n", cert.PermittedIPAddresses)
+			fmt.Printf("X509v3 ExcludedDNSDomains: %s\n", cert.ExcludedDNSDomains)
+			fmt.Printf("X509v3 ExcludedIPAddresses: %s\n", cert.ExcludedIPAddresses)
+			fmt.Printf("X509v3 Certificate Policies: %s\n", cert.PolicyIdentifiers)
+			if policyConstraints, err := gx509.ParsePolicyConstraints(cert); err != nil {
+				log.Printf("%s: %s", name, err)
+			} else if len(policyConstraints.String()) > 0 {
+				fmt.Printf("X509v3 Policy Constraints: %s\n", policyConstraints)
+			}
+			if *printExtensions {
+				for _, ext := range gx509.DecodeExtensions(cert) {
+					marks := ""
+					if ext.Critical {
+						marks = " (critical)"
+					}
+					if ext.Duplicate {
+						marks += " (duplicate)"
+					}
+					fmt.Printf("%s%s:\n", ext.Name, marks)
+					for _, line := range ext.Lines {
+						fmt.Printf("    %s\n", line)
+					}
+					if ext.Err != nil {
+						log.Printf("%s: %s", name, ext.Err)
+					}
+				}
+			}
+
+			log.Printf("%s result under %s: %v details: %s", name, policy.Name, analysis.Constrained, analysis.Details())
+			if revocation != nil {
+				printOneCRLResult(revocation)
+			}
+
+			if *findAlternates {
+				if err := printAlternateChains(cert); err != nil {
+					log.Printf("%s: %s", name, err)
+					os.Exit(exitParseError)
+				}
+			}
+		}
+	}
+
+	code := exitConstrained
+	switch {
+	case failed > 0:
+		code = exitParseError
+	case unconstrainedCAs > 0:
+		code = exitNotConstrained
+	case cas == 0:
+		code = exitNotCA
+	}
+	if renderer != nil {
+		if err := renderer.Render(report); err != nil {
+			log.Printf("Could not write the analyses: %s", err)
+			os.Exit(exitParseError)
+		}
+	} else {
+		fmt.Printf("\n%d certificates in %d files: %d technically constrained, %d not", checked, len(files)-failed, constrained, checked-constrained)
+		if failed > 0 {
+			fmt.Printf(", %d files could not be read", failed)
+		}
+		fmt.Printf("\n")
+	}
+	os.Exit(code)
+}
+
+// loadFromCrtSh looks query, a SHA-256 fingerprint or, with -crtsh-issuer, a
+// serial number, up on crt.sh, logs where and when each match was logged,
+// and returns the matches and their issuers.
+func loadFromCrtSh(crtsh *gx509.CrtSh, query string) ([]*x509.Certificate, error) {
+	var found []*gx509.CrtShCertificate
+	if len(*crtshIssuer) > 0 {
+		serial, ok := new(big.Int).SetString(strings.Replace(query, ":", "", -1), 16)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a hex serial number", query)
+		}
+		matches, err := crtsh.LookupSerial(serial, *crtshIssuer)
+		if err != nil {
+			return nil, err
+		}
+		found = matches
+	} else {
+		fingerprint, err := gx509.ParseFingerprint(query)
+		if err != nil {
+			return nil, err
+		}
+		match, err := crtsh.LookupSHA256(fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, match)
+	}
+
+	var certs []*x509.Certificate
+	for _, match := range found {
+		logged := "at an unknown time"
+		if !match.LoggedAt.IsZero() {
+			logged = match.LoggedAt.Format(time.RFC3339)
+		}
+		kind := "certificate"
+		if gx509.IsPrecertificate(match.Certificate) {
+			kind = "precertificate"
+		}
+		log.Printf("%s: %s https://crt.sh/?id=%d, logged %s, with %d logged issuers", query, kind, match.ID, logged, len(match.Issuers))
+		certs = append(certs, match.Certificate)
+		certs = append(certs, match.Issuers...)
+	}
+	return certs, nil
+}
+
+func printOneCRLResult(result *gx509.OneCRLResult) {
+	fmt.Printf("OneCRL: %s\n", result)
+}
+
+// printAlternateChains prints the viable chains for leaf, ranked, or returns
+// why they could not be found.
+func printAlternateChains(leaf *x509.Certificate) error {
+	roots, err := loadRoots(*alternateRoots)
+	if err != nil {
+		return fmt.Errorf("Could not load roots from %s: %s", *alternateRoots, err)
+	}
+
+	kb, err := loadKnowledgeBase("")
+	if err != nil {
+		return fmt.Errorf("Could not load knowledge base: %s", err)
+	}
+
+	ranked, err := kb.FindAlternateChains(leaf, nil, roots, gx509.NewCrtSh(), time.Now())
+	if err != nil {
+		return fmt.Errorf("Could not search for alternate chains: %s", err)
+	}
+
+	fmt.Printf("\n%d viable chains:\n", len(ranked))
+	for i, entry := range ranked {
+		constrained := "unconstrained"
+		if entry.Constrained {
+			constrained = "technically constrained"
+		}
+		fmt.Printf("%d. %s\n", i+1, pathNames(entry.Chain))
+		fmt.Printf("   %s; accepted by %d of %d clients %v\n", constrained,
+			len(entry.Accepted), len(entry.Accepted)+len(entry.Rejected), entry.Accepted)
+	}
+	return nil
 }
@@ -0,0 +1,106 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runImage(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 image scan [flags] image-ref")
+		return
+	}
+
+	switch args[0] {
+	case "scan":
+		runImageScan(args[1:])
+	default:
+		log.Fatalf("Unknown image command: %s", args[0])
+	}
+}
+
+func runImageScan(args []string) {
+	flags := flag.NewFlagSet("image scan", flag.ExitOnError)
+	platform := flags.String("platform", "linux/amd64", "Platform to pull from a multi-platform image")
+	archive := flags.Bool("archive", false, "Treat the argument as a `docker save` tarball instead of a reference")
+	summary := flags.Bool("summary", false, "Only print counts for each file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 image scan [flags] image-ref\n\n")
+		fmt.Fprintf(flags.Output(), "Pulls the image anonymously and reports the unconstrained CAs and expired\n")
+		fmt.Fprintf(flags.Output(), "certificates its filesystem ships.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the image to scan")
+		return
+	}
+
+	var files gx509.ImageFiles
+	if *archive {
+		file, err := os.Open(positional[0])
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", positional[0], err)
+			return
+		}
+		defer file.Close()
+
+		if files, err = gx509.ArchiveFiles(file); err != nil {
+			log.Fatalf("Could not read %s: %s", positional[0], err)
+			return
+		}
+	} else {
+		ref, err := gx509.ParseImageReference(positional[0])
+		if err != nil {
+			log.Fatalf("%s", err)
+			return
+		}
+
+		registry := gx509.NewRegistry()
+		registry.Platform = *platform
+		log.Printf("Pulling %s", ref)
+		if files, err = registry.ImageFiles(ref); err != nil {
+			log.Fatalf("Could not pull %s: %s", ref, err)
+			return
+		}
+	}
+
+	findings := gx509.AnalyzeImageFiles(files, time.Now())
+	counts := make(map[string]map[string]int)
+	for _, finding := range findings {
+		if counts[finding.Path] == nil {
+			counts[finding.Path] = make(map[string]int)
+		}
+		counts[finding.Path][finding.Problem]++
+		if !*summary {
+			fmt.Printf("%s: %s: %s (expires %s)\n", finding.Path, finding.Problem,
+				finding.Cert.Subject.CommonName, finding.Cert.NotAfter.Format("2006-01-02"))
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	total := 0
+	for path, certs := range files {
+		paths = append(paths, path)
+		total += len(certs)
+	}
+	sort.Strings(paths)
+
+	fmt.Printf("\n%d certificates in %d files:\n", total, len(files))
+	for _, path := range paths {
+		fmt.Printf("  %s: %d certificates, %d unconstrained CAs, %d expired anchors, %d other expired\n",
+			path, len(files[path]), counts[path][gx509.ImageUnconstrainedCA],
+			counts[path][gx509.ImageExpiredAnchor], counts[path][gx509.ImageExpiredCertificate])
+	}
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// loadPolicyConfig returns the preset named arg, or else the policy
+// configuration in the file arg.
+func loadPolicyConfig(arg string) (*gx509.Tenant, error) {
+	if config, ok := gx509.LookupPolicyConfig(arg); ok {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	return gx509.ParsePolicyConfig(data)
+}
+
+// describeLintResult says how a lint came out, for gx509 impact.
+func describeLintResult(result *gx509.LintResult) string {
+	switch {
+	case result == nil:
+		return "not run"
+	case result.Passed:
+		return "passed"
+	}
+	return "failed"
+}
+
+func runImpact(args []string) {
+	flags := flag.NewFlagSet("impact", flag.ExitOnError)
+	beforeArg := flags.String("before", "", "Current policy: a preset such as mozilla-2.5, \"issuance\", or a policy configuration YAML file")
+	afterArg := flags.String("after", "", "Proposed policy: a preset such as mozilla-2.7, \"issuance\", or a policy configuration YAML file")
+	at := flags.String("at", "", "Run lints as of this RFC 3339 time (default now)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 impact -before current.yaml -after proposed.yaml [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Judges every PEM certificate in each file or directory, recursively, under\n")
+		fmt.Fprintf(flags.Output(), "both policies and reports exactly which flip between constrained and\n")
+		fmt.Fprintf(flags.Output(), "unconstrained, or between passing and failing a lint, and why. A policy\n")
+		fmt.Fprintf(flags.Output(), "configuration file holds a tenant's rules without its keys:\n\n")
+		fmt.Fprintf(flags.Output(), "  name: proposed\n  policy: mozilla-2.7\n  disabledLints: [weak-signature]\n\n")
+		fmt.Fprintf(flags.Output(), "Exits 1 if any verdict flips.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(*beforeArg) == 0 || len(*afterArg) == 0 || len(positional) == 0 {
+		flags.Usage()
+		log.Fatalf("You must specify both policies and the paths to judge")
+		return
+	}
+	before, err := loadPolicyConfig(*beforeArg)
+	if err != nil {
+		log.Fatalf("Could not load policy %s: %s", *beforeArg, err)
+		return
+	}
+	after, err := loadPolicyConfig(*afterArg)
+	if err != nil {
+		log.Fatalf("Could not load policy %s: %s", *afterArg, err)
+		return
+	}
+	lintAt := time.Now()
+	if len(*at) > 0 {
+		if lintAt, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	impact := gx509.NewPolicyImpact(before, after, lintAt)
+	err = scanCertificates(positional, func(path string, certs []*x509.Certificate) {
+		for _, cert := range certs {
+			impact.Add(path, cert)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not scan: %s", err)
+		return
+	}
+
+	for _, change := range impact.Changes {
+		fmt.Printf("%s: %s\n", change.Path, certificateLine(change.Cert))
+		if change.ConstraintChanged() {
+			fmt.Printf("    constrained %t under %s, %t under %s: %s\n", change.Before.Constrained, change.Before.Policy,
+				change.After.Constrained, change.After.Policy, change.After.Details)
+		}
+		for _, lint := range change.Lints {
+			message := ""
+			if lint.NowFails() {
+				message = ": " + lint.After.Message
+			} else if lint.Before != nil {
+				message = ": " + lint.Before.Message
+			}
+			fmt.Printf("    %s %s under %s, %s under %s%s\n", lint.Lint, describeLintResult(lint.Before), before.Name,
+				describeLintResult(lint.After), after.Name, message)
+		}
+	}
+	summary := impact.Summary()
+	fmt.Printf("\n%d certificates judged under %s and %s: %d changed; %d newly constrained, %d newly unconstrained; %d lints newly failing, %d newly passing\n",
+		impact.Certificates, before.Name, after.Name, len(impact.Changes), summary.NowConstrained, summary.NowUnconstrained,
+		summary.NowFailing, summary.NowPassing)
+	if len(impact.Changes) > 0 {
+		os.Exit(1)
+	}
+}
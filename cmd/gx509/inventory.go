@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runInventory(args []string) {
+	flags := flag.NewFlagSet("inventory", flag.ExitOnError)
+	format := flags.String("format", "cyclonedx", "Output format: "+strings.Join(gx509.RendererFormats(), ", "))
+	output := flags.String("o", "", "Write the inventory to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 inventory [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Scans each file or directory, recursively, for PEM certificates.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the paths to scan")
+		return
+	}
+	out := os.Stdout
+	if len(*output) > 0 {
+		var err error
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+	renderer, err := gx509.NewRenderer(*format, out)
+	if err != nil {
+		log.Fatalf("%s", err)
+		return
+	}
+
+	var items []gx509.InventoryItem
+	err = scanCertificates(positional, func(path string, certs []*x509.Certificate) {
+		for _, cert := range certs {
+			items = gx509.AddToInventory(items, cert, path)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not scan: %s", err)
+		return
+	}
+	log.Printf("Found %d distinct certificates", len(items))
+
+	if err := renderer.Render(gx509.Report{Kind: gx509.InventoryReport, Generated: time.Now(), Inventory: items}); err != nil {
+		log.Fatalf("Could not write inventory: %s", err)
+		return
+	}
+}
@@ -0,0 +1,133 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// maxJWKSSize bounds the JWKS documents fetched.
+const maxJWKSSize = 1 << 20
+
+// loadJWTKeys reads the keys from a JWT, or from a JWKS at a URL, or from a
+// file holding either.
+func loadJWTKeys(source string) ([]gx509.JWTKey, error) {
+	var data []byte
+	switch {
+	case strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://"):
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %s", source, resp.Status)
+		}
+		if data, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSSize)); err != nil {
+			return nil, err
+		}
+	case strings.Count(source, ".") >= 2 && !strings.ContainsAny(source, "/\\"):
+		data = []byte(source)
+	default:
+		var err error
+		if data, err = ioutil.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return gx509.ParseJWKS(trimmed)
+	}
+	key, err := gx509.ParseJWTHeader(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return []gx509.JWTKey{key}, nil
+}
+
+func runJWT(args []string) {
+	flags := flag.NewFlagSet("jwt", flag.ExitOnError)
+	rootsPath := flags.String("roots", "system", "PEM file or directory of trusted roots, or \"system\"")
+	atFlag := flags.String("at", "", "Analyze as of this RFC 3339 time (default now)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 jwt [flags] <token|jwks-url|file>\n\n")
+		fmt.Fprintf(flags.Output(), "Analyzes the x5c certificate chains in a JWT header or JWKS.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify a token, a JWKS URL, or a file holding either")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	keys, err := loadJWTKeys(positional[0])
+	if err != nil {
+		log.Fatalf("Could not read keys: %s", err)
+		return
+	}
+	if len(keys) == 0 {
+		log.Fatalf("No keys with x5c chains found")
+		return
+	}
+	roots, err := loadRoots(*rootsPath)
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", *rootsPath, err)
+		return
+	}
+
+	flagged := 0
+	for _, key := range keys {
+		fmt.Printf("Key %q (%s):\n", key.KeyID, key.Algorithm)
+		for i, cert := range key.Chain {
+			fmt.Printf("  x5c[%d] %s\n", i, certificateLine(cert))
+		}
+
+		problems := gx509.AnalyzeJWTKey(key, at)
+		if len(key.Chain) > 0 {
+			chain := gx509.BestChain(gx509.BuildChains(key.Chain[0], key.Chain[1:], roots), at)
+			if chain == nil {
+				problems = append(problems, "No chain to a trusted root")
+			} else {
+				fmt.Printf("  Chain: %s\n", pathNames(chain))
+				for _, ca := range chain[1 : len(chain)-1] {
+					analysis := gx509.AnalyzeTechnicalConstraints(ca)
+					fmt.Printf("  %s: technically constrained %v: %s\n", ca.Subject.CommonName, analysis.Constrained, analysis.Details())
+				}
+			}
+		}
+
+		for _, problem := range problems {
+			fmt.Printf("  * %s\n", problem)
+		}
+		if len(problems) > 0 {
+			flagged++
+		}
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
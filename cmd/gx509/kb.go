@@ -0,0 +1,187 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+const defaultKnowledgeBaseURL = "https://raw.githubusercontent.com/jcjones/gx509/master/gx509/clients.yaml"
+
+// maxKnowledgeBaseSize bounds the knowledge base `gx509 kb fetch` downloads.
+const maxKnowledgeBaseSize = 4 << 20
+
+// knowledgeBaseCachePath is where `gx509 kb fetch` stores the latest
+// knowledge base.
+func knowledgeBaseCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gx509", "clients.yaml"), nil
+}
+
+// compareVersions compares dotted versions such as "2026.10.2" part by part,
+// numerically where both parts are numbers, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart string
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		aNumber, aErr := strconv.ParseUint(aPart, 10, 64)
+		bNumber, bErr := strconv.ParseUint(bPart, 10, 64)
+		switch {
+		case aErr == nil && bErr == nil && aNumber != bNumber:
+			if aNumber < bNumber {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && aPart != bPart:
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// loadKnowledgeBase reads the knowledge base at path, or if path is empty the
+// fetched copy in the cache if it is newer than the embedded one, which is
+// used otherwise.
+func loadKnowledgeBase(path string) (*gx509.KnowledgeBase, error) {
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return gx509.ParseKnowledgeBase(data)
+	}
+
+	cachePath, err := knowledgeBaseCachePath()
+	if err != nil {
+		return gx509.DefaultKnowledgeBase, nil
+	}
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return gx509.DefaultKnowledgeBase, nil
+	}
+	kb, err := gx509.ParseKnowledgeBase(data)
+	if err != nil {
+		log.Printf("Ignoring fetched knowledge base %s: %s", cachePath, err)
+		return gx509.DefaultKnowledgeBase, nil
+	}
+	// A copy fetched before this binary was built may be older than its own
+	if compareVersions(kb.Version, gx509.DefaultKnowledgeBase.Version) <= 0 {
+		return gx509.DefaultKnowledgeBase, nil
+	}
+	return kb, nil
+}
+
+func runKnowledgeBase(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 kb show|fetch|dump [flags]")
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		runKnowledgeBaseShow(args[1:])
+	case "fetch":
+		runKnowledgeBaseFetch(args[1:])
+	case "dump":
+		os.Stdout.Write(gx509.EmbeddedKnowledgeBase())
+	default:
+		log.Fatalf("Unknown kb command: %s", args[0])
+	}
+}
+
+func runKnowledgeBaseShow(args []string) {
+	flags := flag.NewFlagSet("kb show", flag.ExitOnError)
+	kbPath := flags.String("kb", "", "Path to a knowledge base YAML file")
+	flags.Parse(args)
+
+	kb, err := loadKnowledgeBase(*kbPath)
+	if err != nil {
+		log.Fatalf("Could not load knowledge base: %s", err)
+		return
+	}
+
+	fmt.Printf("Knowledge base version %s (embedded %s)\n", kb.Version, gx509.DefaultKnowledgeBase.Version)
+	for _, client := range kb.Clients {
+		fmt.Printf("  %s\n", client.Name)
+	}
+}
+
+func runKnowledgeBaseFetch(args []string) {
+	flags := flag.NewFlagSet("kb fetch", flag.ExitOnError)
+	url := flags.String("url", defaultKnowledgeBaseURL, "Where to download the knowledge base from")
+	flags.Parse(args)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(*url)
+	if err != nil {
+		log.Fatalf("Could not fetch %s: %s", *url, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Could not fetch %s: %s", *url, resp.Status)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxKnowledgeBaseSize+1))
+	if err != nil {
+		log.Fatalf("Could not fetch %s: %s", *url, err)
+		return
+	}
+	if len(data) > maxKnowledgeBaseSize {
+		log.Fatalf("Could not fetch %s: more than %d bytes", *url, maxKnowledgeBaseSize)
+		return
+	}
+
+	// Never replace a working cache with something we can't use
+	kb, err := gx509.ParseKnowledgeBase(data)
+	if err != nil {
+		log.Fatalf("Fetched knowledge base is invalid: %s", err)
+		return
+	}
+
+	cachePath, err := knowledgeBaseCachePath()
+	if err != nil {
+		log.Fatalf("Could not locate cache directory: %s", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		log.Fatalf("Could not create %s: %s", filepath.Dir(cachePath), err)
+		return
+	}
+	if err := ioutil.WriteFile(cachePath, data, 0644); err != nil {
+		log.Fatalf("Could not write %s: %s", cachePath, err)
+		return
+	}
+
+	fmt.Printf("Saved knowledge base version %s to %s\n", kb.Version, cachePath)
+	if compareVersions(kb.Version, gx509.DefaultKnowledgeBase.Version) <= 0 {
+		fmt.Printf("It is no newer than the embedded version %s, which is used instead\n", gx509.DefaultKnowledgeBase.Version)
+	}
+}
@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "Output format: "+strings.Join(gx509.RendererFormats(), ", "))
+	output := flags.String("o", "", "Write the report to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 lint [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Lints every PEM certificate in each file or directory, recursively, and exits\n")
+		fmt.Fprintf(flags.Output(), "non-zero if any lint of error severity fails. Lints:\n")
+		for _, lint := range gx509.Lints {
+			fmt.Fprintf(flags.Output(), "  %-24s %s %s\n", lint.Name, lint.Severity, lint.Description)
+		}
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the paths to lint")
+		return
+	}
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		var err error
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+	renderer, err := gx509.NewRenderer(*format, out)
+	if err != nil {
+		log.Fatalf("%s", err)
+		return
+	}
+
+	report := gx509.Report{Generated: time.Now()}
+	err = scanCertificates(positional, func(path string, certs []*x509.Certificate) {
+		for _, cert := range certs {
+			report.LintCertificate(path, cert, report.Generated)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not scan: %s", err)
+		return
+	}
+	if err := renderer.Render(report); err != nil {
+		log.Fatalf("Could not write report: %s", err)
+		return
+	}
+
+	for _, finding := range report.Failures() {
+		if finding.Lint.Severity == gx509.SeverityError {
+			out.Close()
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// matchResult is the JSON output of `gx509 match`.
+type matchResult struct {
+	Match            bool   `json:"match"`
+	Key              string `json:"key"`
+	KeyType          string `json:"keyType"`
+	KeyAlgorithm     string `json:"keyAlgorithm"`
+	KeySPKISHA256    string `json:"keySpkiSha256"`
+	Target           string `json:"target"`
+	TargetType       string `json:"targetType"`
+	TargetSubject    string `json:"targetSubject"`
+	TargetAlgorithm  string `json:"targetAlgorithm"`
+	TargetSPKISHA256 string `json:"targetSpkiSha256"`
+}
+
+func runMatch(args []string) {
+	flags := flag.NewFlagSet("match", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the result as JSON")
+	passwords := addKeyPasswordFlags(flags, true)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 match [flags] key.pem cert.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Checks whether a private or public key belongs to a certificate or CSR, and exits\n")
+		fmt.Fprintf(flags.Output(), "non-zero if it does not.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 2 {
+		flags.Usage()
+		os.Exit(2)
+		return
+	}
+
+	keyPublic, private, err := loadKey(positional[0], passwords)
+	if err != nil {
+		log.Fatalf("Could not load key from %s: %s", positional[0], err)
+		return
+	}
+	targetPublic, targetType, subject, err := loadPublicKeyHolder(positional[1])
+	if err != nil {
+		log.Fatalf("Could not load %s: %s", positional[1], err)
+		return
+	}
+
+	keyHash := sha256.Sum256(keyPublic)
+	targetHash := sha256.Sum256(targetPublic)
+	result := matchResult{
+		Match:            gx509.PublicKeysMatch(keyPublic, targetPublic),
+		Key:              positional[0],
+		KeyType:          "public",
+		KeyAlgorithm:     gx509.DescribePublicKeyInfo(keyPublic),
+		KeySPKISHA256:    hex.EncodeToString(keyHash[:]),
+		Target:           positional[1],
+		TargetType:       targetType,
+		TargetSubject:    subject,
+		TargetAlgorithm:  gx509.DescribePublicKeyInfo(targetPublic),
+		TargetSPKISHA256: hex.EncodeToString(targetHash[:]),
+	}
+	if private {
+		result.KeyType = "private"
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			log.Fatalf("Could not encode result: %s", err)
+			return
+		}
+	} else if result.Match {
+		fmt.Printf("%s key %s matches %s %s (%s)\n", result.KeyAlgorithm, result.Key,
+			result.TargetType, result.Target, result.TargetSubject)
+	} else {
+		fmt.Printf("%s key %s does NOT match %s %s (%s), which has a %s key\n", result.KeyAlgorithm,
+			result.Key, result.TargetType, result.Target, result.TargetSubject, result.TargetAlgorithm)
+	}
+
+	if !result.Match {
+		os.Exit(1)
+	}
+}
+
+// loadKey reads the first key PEM block in path, returning its DER
+// SubjectPublicKeyInfo and whether it was private.
+func loadKey(path string, passwords *keyPasswords) ([]byte, bool, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, false, fmt.Errorf("No key PEM block found")
+		}
+		if gx509.IsPrivateKeyBlock(block) {
+			key, err := passwords.parsePrivateKey(path, block)
+			if err != nil {
+				return nil, true, err
+			}
+			return key.Public, true, nil
+		}
+		// Skip EC PARAMETERS, certificates and the like
+		if public, private, err := gx509.ParseKeyBlock(block); err == nil {
+			return public, private, err
+		}
+	}
+}
+
+// loadPublicKeyHolder reads the first certificate or CSR in path, returning
+// its DER SubjectPublicKeyInfo, what it is, and its subject common name.
+func loadPublicKeyHolder(path string) ([]byte, string, string, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", "", err
+	}
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, "", "", fmt.Errorf("No certificate or certificate request found")
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, "", "", err
+			}
+			return cert.RawSubjectPublicKeyInfo, "certificate", cert.Subject.CommonName, nil
+		case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return nil, "", "", err
+			}
+			return csr.RawSubjectPublicKeyInfo, "certificate request", csr.Subject.CommonName, nil
+		}
+	}
+}
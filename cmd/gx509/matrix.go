@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// printVerdicts writes one row per client and one column per check, followed
+// by the reasons behind each cell.
+func printVerdicts(verdicts []gx509.ClientVerdict) {
+	width := len("Client")
+	for _, verdict := range verdicts {
+		if len(verdict.Client) > width {
+			width = len(verdict.Client)
+		}
+	}
+
+	fmt.Printf("%-*s %-8s", width, "Client", "Result")
+	for _, check := range gx509.Checks {
+		fmt.Printf(" %-10s", check)
+	}
+	fmt.Printf("\n")
+
+	for _, verdict := range verdicts {
+		outcome := "rejected"
+		if verdict.Accepted {
+			outcome = "accepted"
+		}
+		fmt.Printf("%-*s %-8s", width, verdict.Client, outcome)
+		for _, check := range gx509.Checks {
+			cell := "ok"
+			if !verdict.Outcome(check).Passed {
+				cell = "FAIL"
+			}
+			fmt.Printf(" %-10s", cell)
+		}
+		fmt.Printf("\n")
+	}
+
+	for _, verdict := range verdicts {
+		for _, reason := range verdict.Reasons() {
+			fmt.Printf("  %s %s\n", verdict.Client, reason)
+		}
+	}
+}
+
+func runMatrix(args []string) {
+	flags := flag.NewFlagSet("matrix", flag.ExitOnError)
+	at := flags.String("at", "", "Verification time as RFC 3339 (default now)")
+	kbPath := flags.String("kb", "", "Path to a knowledge base YAML file (default the fetched or embedded one)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 matrix [flags] chain.pem\n\n")
+		fmt.Fprintf(flags.Output(), "chain.pem holds the leaf first, followed by each issuer in turn.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file as the last argument")
+		return
+	}
+
+	chain, err := loadCertificates(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", flags.Arg(0), err)
+		return
+	}
+
+	verifyAt := time.Now()
+	if len(*at) > 0 {
+		if verifyAt, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	kb, err := loadKnowledgeBase(*kbPath)
+	if err != nil {
+		log.Fatalf("Could not load knowledge base: %s", err)
+		return
+	}
+
+	fmt.Printf("Knowledge base version %s\n", kb.Version)
+	printVerdicts(kb.AcceptanceMatrix(chain, verifyAt))
+}
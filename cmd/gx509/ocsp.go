@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runOCSP(args []string) {
+	flags := flag.NewFlagSet("ocsp", flag.ExitOnError)
+	nonce := flags.Bool("nonce", true, "Send a nonce and report whether each responder honours it")
+	timeout := flags.Duration("timeout", 10*time.Second, "How long to wait for each responder")
+	issuerPath := flags.String("issuer", "", "The issuer of a lone certificate, instead of fetching it from its AIA caIssuers URL")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 ocsp [flags] fullchain.pem\n")
+		fmt.Fprintf(flags.Output(), "       gx509 ocsp [flags] [-issuer issuer.pem] cert.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Queries the OCSP responder of each certificate in the chain, which starts with\n")
+		fmt.Fprintf(flags.Output(), "the leaf and ends with the root, and reports its status, the response's\n")
+		fmt.Fprintf(flags.Output(), "thisUpdate and nextUpdate, the certificate that signed it, whether the\n")
+		fmt.Fprintf(flags.Output(), "responder honours nonces and whether its responses are valid for longer than\n")
+		fmt.Fprintf(flags.Output(), "the Baseline Requirements allow. A lone certificate is queried with the issuer\n")
+		fmt.Fprintf(flags.Output(), "from -issuer or, failing that, from its AIA caIssuers URL.\n")
+		fmt.Fprintf(flags.Output(), "Exits non-zero if any responder could not be checked or has findings.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+	if len(certs) == 1 {
+		var issuers []*x509.Certificate
+		if *issuerPath != "" {
+			issuers, err = loadCertificates(*issuerPath)
+			if err != nil {
+				log.Fatalf("Could not process file %s: %s", *issuerPath, err)
+				return
+			}
+			issuers = gx509.FindIssuers(certs[0], issuers)
+		} else {
+			issuers, err = gx509.FetchMissingIssuers(gx509.NewAIA(aiaTimeout, aiaMaxRedirects), certs)
+			if err != nil {
+				log.Printf("%s", err)
+			}
+		}
+		if len(issuers) == 0 {
+			log.Fatalf("Could not find the issuer of %s", certs[0].Subject.CommonName)
+			return
+		}
+		certs = append(certs, issuers[0])
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	failed := false
+	for i := 0; i+1 < len(certs); i++ {
+		cert, issuer := certs[i], certs[i+1]
+		fmt.Printf("%s\n", certificateLine(cert))
+		if len(cert.OCSPServer) == 0 {
+			fmt.Printf("  no OCSP responder\n")
+			continue
+		}
+
+		check, err := gx509.CheckOCSP(client, cert, issuer, *nonce, time.Now())
+		if err != nil {
+			fmt.Printf("  error: %s\n", err)
+			failed = true
+			continue
+		}
+		response := check.Response
+		fmt.Printf("  responder: %s\n", check.URL)
+		if response.Delegated {
+			fmt.Printf("  signed by delegated responder: %s\n", certificateLine(response.Signer))
+		} else {
+			fmt.Printf("  signed by issuer: %s\n", certificateLine(response.Signer))
+		}
+		fmt.Printf("    valid %s to %s\n", response.Signer.NotBefore.Format(time.RFC3339), response.Signer.NotAfter.Format(time.RFC3339))
+		fmt.Printf("  status: %s", response.Status)
+		if response.Status == "revoked" {
+			fmt.Printf(" at %s", response.RevokedAt.Format(time.RFC3339))
+		}
+		fmt.Printf("\n  thisUpdate: %s\n", response.ThisUpdate.Format(time.RFC3339))
+		if !response.NextUpdate.IsZero() {
+			fmt.Printf("  nextUpdate: %s (valid for %s)\n", response.NextUpdate.Format(time.RFC3339), check.Window())
+		}
+		switch {
+		case !*nonce:
+			fmt.Printf("  nonce: not sent\n")
+		case check.NonceHonored:
+			fmt.Printf("  nonce: honoured\n")
+		default:
+			fmt.Printf("  nonce: not honoured\n")
+		}
+		for _, finding := range check.Findings {
+			fmt.Printf("  * %s\n", finding)
+		}
+		failed = failed || len(check.Findings) > 0
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+)
+
+func runOrgs(args []string) {
+	flags := flag.NewFlagSet("orgs", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "List the certificates in each group")
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file (default the embedded one)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 orgs [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Groups certificates by the CA owner, or else the normalized organization, of\n")
+		fmt.Fprintf(flags.Output(), "their issuers.\n")
+		fmt.Fprintf(flags.Output(), "Each path is a PEM file or a directory of them.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the certificates to group")
+		return
+	}
+
+	var certs []*x509.Certificate
+	for _, path := range positional {
+		found, err := loadCertificatesFromPath(path)
+		if err != nil {
+			log.Fatalf("Could not load certificates from %s: %s", path, err)
+			return
+		}
+		certs = append(certs, found...)
+	}
+
+	table, err := loadOwnerTable(*ownersPath)
+	if err != nil {
+		log.Fatalf("Could not load owner table: %s", err)
+		return
+	}
+
+	for _, group := range table.GroupByIssuerOwner(certs) {
+		fmt.Printf("%6d  %s\n", len(group.Certificates), group.Name)
+		if *verbose {
+			for _, cert := range group.Certificates {
+				fmt.Printf("        %s (issued by %s)\n", cert.Subject.CommonName, cert.Issuer.CommonName)
+			}
+		}
+	}
+}
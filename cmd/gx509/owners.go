@@ -0,0 +1,152 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+	"gopkg.in/yaml.v2"
+)
+
+// loadOwnerTable reads the owner table at path, or the embedded one if path
+// is empty.
+func loadOwnerTable(path string) (*gx509.OwnerTable, error) {
+	if len(path) == 0 {
+		return gx509.DefaultOwnerTable, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gx509.ParseOwnerTable(data)
+}
+
+func runOwners(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 owners show|import|lookup [flags]")
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		runOwnersShow(args[1:])
+	case "import":
+		runOwnersImport(args[1:])
+	case "lookup":
+		runOwnersLookup(args[1:])
+	default:
+		log.Fatalf("Unknown owners command: %s", args[0])
+	}
+}
+
+func runOwnersShow(args []string) {
+	flags := flag.NewFlagSet("owners show", flag.ExitOnError)
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file (default the embedded one)")
+	flags.Parse(args)
+
+	table, err := loadOwnerTable(*ownersPath)
+	if err != nil {
+		log.Fatalf("Could not load owner table: %s", err)
+		return
+	}
+
+	fmt.Printf("Owner table version %s\n", table.Version)
+	for _, owner := range table.Owners {
+		fmt.Printf("  %-36s %3d organizations, %4d CA certificates\n", owner.Name,
+			len(owner.Organizations), len(owner.SubjectSPKI))
+	}
+}
+
+func runOwnersImport(args []string) {
+	flags := flag.NewFlagSet("owners import", flag.ExitOnError)
+	version := flags.String("version", time.Now().UTC().Format("2006.01.02"), "Version of the generated table")
+	output := flags.String("o", "", "Write the table to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 owners import [flags] AllCertificateRecordsReport.csv\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the CCADB report to import")
+		return
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		log.Fatalf("Could not open %s: %s", positional[0], err)
+		return
+	}
+	defer file.Close()
+
+	table, err := gx509.ImportCCADBOwners(file, *version)
+	if err != nil {
+		log.Fatalf("Could not import %s: %s", positional[0], err)
+		return
+	}
+
+	data, err := yaml.Marshal(table)
+	if err != nil {
+		log.Fatalf("Could not encode owner table: %s", err)
+		return
+	}
+
+	if len(*output) > 0 {
+		if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+			log.Fatalf("Could not write %s: %s", *output, err)
+			return
+		}
+		log.Printf("Wrote %d owners to %s", len(table.Owners), *output)
+		return
+	}
+	os.Stdout.Write(data)
+}
+
+func runOwnersLookup(args []string) {
+	flags := flag.NewFlagSet("owners lookup", flag.ExitOnError)
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file (default the embedded one)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 owners lookup [flags] path...\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the certificates to look up")
+		return
+	}
+
+	table, err := loadOwnerTable(*ownersPath)
+	if err != nil {
+		log.Fatalf("Could not load owner table: %s", err)
+		return
+	}
+
+	for _, path := range positional {
+		certs, err := loadCertificatesFromPath(path)
+		if err != nil {
+			log.Fatalf("Could not load certificates from %s: %s", path, err)
+			return
+		}
+		for _, cert := range certs {
+			owner, ok := table.IssuerOwner(cert)
+			if cert.IsCA {
+				if subjectOwner, found := table.Owner(cert); found {
+					owner, ok = subjectOwner, true
+				}
+			}
+			if !ok {
+				owner = "unknown"
+			}
+			fmt.Printf("%-40s %s\n", cert.Subject.CommonName, owner)
+		}
+	}
+}
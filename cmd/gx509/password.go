@@ -0,0 +1,115 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// keyPasswords supplies the password for encrypted private keys from an
+// environment variable, a file, or, where allowed, a terminal prompt.
+type keyPasswords struct {
+	env    *string
+	file   *string
+	prompt bool
+	cached []byte
+}
+
+// addKeyPasswordFlags registers the flags that supply key passwords. If
+// prompt is set and neither flag is given, the password is asked for on the
+// terminal.
+func addKeyPasswordFlags(flags *flag.FlagSet, prompt bool) *keyPasswords {
+	return &keyPasswords{
+		env:    flags.String("key-password-env", "", "Read the password for encrypted private keys from this environment variable"),
+		file:   flags.String("key-password-file", "", "Read the password for encrypted private keys from the first line of this file"),
+		prompt: prompt,
+	}
+}
+
+func (p *keyPasswords) password(path string) ([]byte, error) {
+	if p.cached != nil {
+		return p.cached, nil
+	}
+
+	switch {
+	case len(*p.env) > 0:
+		value, ok := os.LookupEnv(*p.env)
+		if !ok {
+			return nil, fmt.Errorf("Environment variable %s is not set", *p.env)
+		}
+		p.cached = []byte(value)
+	case len(*p.file) > 0:
+		contents, err := ioutil.ReadFile(*p.file)
+		if err != nil {
+			return nil, err
+		}
+		if i := bytes.IndexAny(contents, "\r\n"); i >= 0 {
+			contents = contents[:i]
+		}
+		p.cached = contents
+	case p.prompt:
+		password, err := promptPassword(fmt.Sprintf("Password for %s: ", path))
+		if err != nil {
+			return nil, err
+		}
+		p.cached = password
+	default:
+		return nil, gx509.ErrEncryptedPrivateKey
+	}
+	return p.cached, nil
+}
+
+// parsePrivateKey parses a private key block from path, decrypting it if
+// need be.
+func (p *keyPasswords) parsePrivateKey(path string, block *pem.Block) (*gx509.PrivateKey, error) {
+	key, err := gx509.ParsePrivateKeyBlock(block)
+	if err != gx509.ErrEncryptedPrivateKey {
+		return key, err
+	}
+
+	password, err := p.password(path)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := gx509.DecryptPrivateKeyBlock(block, password)
+	if err != nil {
+		return nil, err
+	}
+	return gx509.ParsePrivateKeyBlock(decrypted)
+}
+
+// promptPassword reads a line from the terminal without echoing it, where
+// stty is available to turn echo off.
+func promptPassword(prompt string) ([]byte, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("Cannot prompt for a password without a terminal; use -key-password-env or -key-password-file")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err == nil {
+		defer stty("echo")
+	}
+	defer fmt.Fprintln(os.Stderr)
+
+	line, err := bufio.NewReader(os.Stdin).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("No password entered: %s", err)
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
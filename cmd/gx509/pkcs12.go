@@ -0,0 +1,96 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runPKCS12(args []string) {
+	flags := flag.NewFlagSet("pkcs12", flag.ExitOnError)
+	password := flags.String("password", "", "The password of the files; -key-password-env and -key-password-file avoid exposing it in the process list")
+	passwords := addKeyPasswordFlags(flags, false)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 pkcs12 [flags] file.p12...\n\n")
+		fmt.Fprintf(flags.Output(), "Reads the leaf and CA certificates in each PKCS#12 (.p12 or .pfx) file and reports\n")
+		fmt.Fprintf(flags.Output(), "whether each CA is technically constrained. Without a password, the empty password\n")
+		fmt.Fprintf(flags.Output(), "is tried. Exits non-zero if any file could not be read.\n")
+		flags.PrintDefaults()
+	}
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) == 0 {
+		log.Fatalf("You must specify the .p12 files to read")
+		return
+	}
+
+	failed := false
+	for _, path := range paths {
+		pass := *password
+		if len(pass) == 0 {
+			found, err := passwords.password(path)
+			if err != nil && err != gx509.ErrEncryptedPrivateKey {
+				log.Fatalf("Could not read the password: %s", err)
+				return
+			}
+			pass = string(found)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("Could not read %s: %s", path, err)
+			failed = true
+			continue
+		}
+		contents, err := gx509.ParsePKCS12(data, pass)
+		if err != nil {
+			log.Printf("Could not parse %s: %s", path, err)
+			failed = true
+			continue
+		}
+
+		fmt.Printf("%s:\n", path)
+		if contents.Leaf != nil {
+			key := ""
+			if contents.HasPrivateKey {
+				key = ", with its private key"
+			}
+			fmt.Printf("  leaf%s\n", key)
+			printPKCS12Certificate(contents.Leaf)
+		}
+		for _, cert := range contents.CAs {
+			fmt.Printf("  CA\n")
+			printPKCS12Certificate(cert)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printPKCS12Certificate(cert *x509.Certificate) {
+	fmt.Printf("    %s\n", certificateLine(cert))
+	if !cert.IsCA {
+		return
+	}
+	analysis := gx509.AnalyzeTechnicalConstraints(cert)
+	switch {
+	case analysis.Constrained:
+		fmt.Printf("    technically constrained: %s\n", analysis.Details())
+	case bytes.Equal(cert.RawIssuer, cert.RawSubject):
+		fmt.Printf("    self-signed root; not technically constrained: %s\n", analysis.Details())
+	default:
+		fmt.Printf("    not technically constrained: %s\n", analysis.Details())
+	}
+}
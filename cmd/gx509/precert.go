@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runPrecert(args []string) {
+	flags := flag.NewFlagSet("precert", flag.ExitOnError)
+	finalPath := flags.String("final", "", "Path to the final certificate to compare the precertificate with")
+	tbsPath := flags.String("tbs", "", "Write the precertificate's TBS as the final certificate's would be, in DER, to this path")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 precert [flags] precert.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether the first certificate in precert.pem is a CT precertificate,\n")
+		fmt.Fprintf(flags.Output(), "and whether its TBS, without the poison extension, matches that of the final\n")
+		fmt.Fprintf(flags.Output(), "certificate without its SCTs. Exits non-zero if they differ.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the precertificate .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+	precert := certs[0]
+	fmt.Printf("%s\n", certificateLine(precert))
+	fmt.Printf("  precertificate: %t\n", gx509.IsPrecertificate(precert))
+	if len(certs) > 1 && gx509.IsPrecertificateSigningCert(certs[1]) {
+		fmt.Printf("  signed by a precertificate signing certificate: %s\n", certificateLine(certs[1]))
+	}
+
+	tbs, err := gx509.ComparableTBS(precert)
+	if err != nil {
+		log.Fatalf("Could not rebuild TBS: %s", err)
+		return
+	}
+	if len(*tbsPath) > 0 {
+		if err := ioutil.WriteFile(*tbsPath, tbs, 0644); err != nil {
+			log.Fatalf("Could not write TBS: %s", err)
+			return
+		}
+	}
+	if len(*finalPath) == 0 {
+		return
+	}
+
+	finals, err := loadCertificates(*finalPath)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", *finalPath, err)
+		return
+	}
+	finalTBS, err := gx509.ComparableTBS(finals[0])
+	if err != nil {
+		log.Fatalf("Could not rebuild TBS: %s", err)
+		return
+	}
+	fmt.Printf("%s\n", certificateLine(finals[0]))
+	if !bytes.Equal(tbs, finalTBS) {
+		fmt.Printf("  does not match the precertificate\n")
+		os.Exit(1)
+	}
+	fmt.Printf("  matches the precertificate\n")
+}
@@ -0,0 +1,83 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runProbe(args []string) {
+	flags := flag.NewFlagSet("probe", flag.ExitOnError)
+	rounds := flags.Int("rounds", 10, "How many times to probe each endpoint")
+	interval := flags.Duration("interval", 30*time.Second, "How long to wait between rounds")
+	timeout := flags.Duration("timeout", 15*time.Second, "How long to wait for each response")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 probe [flags] fullchain.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Repeatedly requests the OCSP responders, CRLs and AIA certificates the chain,\n")
+		fmt.Fprintf(flags.Output(), "which starts with the leaf and ends with the root, names, and reports each\n")
+		fmt.Fprintf(flags.Output(), "endpoint's availability and response times. Exits non-zero if any probe\n")
+		fmt.Fprintf(flags.Output(), "failed or an OCSP or CRL response took longer than the Baseline Requirements'\n")
+		fmt.Fprintf(flags.Output(), "ten seconds.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	if *rounds < 1 {
+		log.Fatalf("You must probe at least once")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+	endpoints := gx509.HierarchyEndpoints(certs)
+	if len(endpoints) == 0 {
+		log.Fatalf("The chain in %s names no OCSP, CRL or AIA endpoints", path)
+		return
+	}
+
+	start := time.Now()
+	client := &http.Client{Timeout: *timeout}
+	results := gx509.ProbeEndpoints(client, endpoints, *rounds, *interval)
+
+	fmt.Printf("Probed %d endpoints %d times over %s\n", len(results), *rounds, time.Since(start).Round(time.Second))
+	failed := false
+	for _, result := range results {
+		fmt.Printf("\n%s %s\n", result.Kind, result.URL)
+		fmt.Printf("  named by: %s\n", certificateLine(result.Cert))
+		fmt.Printf("  availability: %.1f%% (%d/%d)\n", 100*result.Availability(), len(result.Latencies), result.Probes)
+		if len(result.Latencies) > 0 {
+			fmt.Printf("  response time: median %s, p95 %s, max %s\n",
+				result.Percentile(0.5).Round(time.Millisecond),
+				result.Percentile(0.95).Round(time.Millisecond),
+				result.Percentile(1).Round(time.Millisecond))
+		}
+		if len(result.Errors) > 0 {
+			fmt.Printf("  last error: %s\n", result.Errors[len(result.Errors)-1])
+		}
+		for _, finding := range result.Findings() {
+			fmt.Printf("  * %s\n", finding)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runQuery(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	format := flags.String("format", "text", "Output format: "+strings.Join(gx509.RendererFormats(), ", "))
+	resultsPath := flags.String("results", "", "Query this SQLite result store, written by batch or ct-tail -results, instead of the warehouse")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 query [flags] \"condition\"\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the certificates in the warehouse that meet a SQL-like condition, such as\n")
+		fmt.Fprintf(flags.Output(), "  issuer_cn LIKE '%%Acme%%' AND constrained = false AND not_after > now()\n")
+		fmt.Fprintf(flags.Output(), "With -results, constrained is the verdict stored rather than one reached afresh.\n")
+		fmt.Fprintf(flags.Output(), "Fields: %s\n", strings.Join(gx509.QueryFields(), ", "))
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the query as a single argument")
+		return
+	}
+	query, err := gx509.ParseQuery(positional[0], time.Now())
+	if err != nil {
+		log.Fatalf("Invalid query: %s", err)
+		return
+	}
+	renderer, err := gx509.NewRenderer(*format, os.Stdout)
+	if err != nil {
+		log.Fatalf("%s", err)
+		return
+	}
+	report := gx509.Report{Kind: gx509.QueryReport, Generated: time.Now()}
+	if len(*resultsPath) > 0 {
+		store, err := gx509.OpenResultStore(*resultsPath)
+		if err != nil {
+			log.Fatalf("Could not open result store %s: %s", *resultsPath, err)
+			return
+		}
+		report.Selected, report.StoredVerdicts = store.Select(query), true
+	} else {
+		warehouse, err := gx509.OpenWarehouse(*path)
+		if err != nil {
+			log.Fatalf("Could not open warehouse %s: %s", *path, err)
+			return
+		}
+		for _, entry := range query.Select(warehouse.Entries()) {
+			report.Selected = append(report.Selected, &gx509.StoredResult{WarehouseEntry: *entry})
+		}
+	}
+
+	if err := renderer.Render(report); err != nil {
+		log.Fatalf("Could not write results: %s", err)
+		return
+	}
+}
@@ -0,0 +1,90 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	var logs stringList
+	flags.Var(&logs, "audit-log", "Verdict log written by serve -verdict-log or the daemon's verdictLog (repeatable, for rotated logs)")
+	policyName := flags.String("policy", "", "Policy to replay under: mozilla-2.2, mozilla-2.5, mozilla-2.7 or cabr-baseline; v2.7 is short for mozilla-2.7")
+	warehousePath := addWarehouseFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 replay -audit-log verdicts.jsonl -policy v2.7 [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Re-evaluates every verdict in the logs under another policy, finding each\n")
+		fmt.Fprintf(flags.Output(), "certificate in the warehouse by its fingerprint, and reports the verdicts\n")
+		fmt.Fprintf(flags.Output(), "that change. Exits 1 if any does.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if len(logs) == 0 || *policyName == "" {
+		flags.Usage()
+		log.Fatalf("You must specify the verdict logs and the policy to replay under")
+		return
+	}
+	policy, ok := gx509.LookupPolicy(*policyName)
+	if !ok {
+		log.Fatalf("Unknown policy: %s", *policyName)
+		return
+	}
+
+	var records []gx509.VerdictRecord
+	for _, path := range logs {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", path, err)
+			return
+		}
+		found, err := gx509.ReadVerdictLog(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		records = append(records, found...)
+	}
+
+	warehouse, err := gx509.OpenWarehouse(*warehousePath)
+	if err != nil {
+		log.Fatalf("Could not open warehouse %s: %s", *warehousePath, err)
+		return
+	}
+	replay := gx509.ReplayVerdicts(records, func(fingerprint [sha256.Size]byte) *x509.Certificate {
+		if entry, ok := warehouse.Get(fingerprint); ok {
+			return entry.Certificate
+		}
+		return nil
+	}, policy)
+
+	for _, change := range replay.Changes {
+		caller := change.Record.Caller
+		if len(change.Record.Source) > 0 {
+			caller += " " + change.Record.Source
+		}
+		fmt.Printf("%s %s: %s\n", change.Record.Time.Format(time.RFC3339), caller, certificateLine(change.Cert))
+		fmt.Printf("    constrained %t under %s, %t under %s: %s\n", change.Before.Constrained, change.Before.Policy,
+			change.After.Constrained, change.After.Policy, change.Details)
+	}
+	for _, fingerprint := range replay.Missing {
+		log.Printf("%s is not in the warehouse, so was not replayed", fingerprint)
+	}
+	fmt.Printf("\n%d verdicts in %d records replayed under %s: %d changed, %d certificates missing from the warehouse\n",
+		replay.Verdicts, replay.Records, policy.Name, len(replay.Changes), len(replay.Missing))
+	if len(replay.Changes) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,74 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// loadRiskModel reads the risk model at path, or the default one if path is
+// empty.
+func loadRiskModel(path string) (*gx509.RiskModel, error) {
+	if len(path) == 0 {
+		return gx509.DefaultRiskModel, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gx509.ParseRiskModel(data)
+}
+
+func runRisk(args []string) {
+	flags := flag.NewFlagSet("risk", flag.ExitOnError)
+	modelPath := flags.String("model", "", "Path to a risk model YAML file (default the built-in one)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 risk [flags] path...\n\n")
+		fmt.Fprintf(flags.Output(), "Scores every PEM certificate in each file or directory, recursively, from 0 to\n")
+		fmt.Fprintf(flags.Output(), "100, and each file as a hierarchy, counting each factor once. A model file has\n")
+		fmt.Fprintf(flags.Output(), "weights for any of the factors below and maxValidityDays. Factors:\n")
+		for _, factor := range gx509.RiskFactors {
+			fmt.Fprintf(flags.Output(), "  %-18s %3d %s\n", factor.Name, gx509.DefaultRiskModel.Weights[factor.Name], factor.Description)
+		}
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the paths to score")
+		return
+	}
+	model, err := loadRiskModel(*modelPath)
+	if err != nil {
+		log.Fatalf("Could not load risk model: %s", err)
+		return
+	}
+
+	levels := make(map[string]int)
+	err = scanCertificates(positional, func(path string, certs []*x509.Certificate) {
+		risk := model.ScoreHierarchy(certs)
+		levels[gx509.RiskLevel(risk.Score)]++
+		fmt.Printf("%s: %d (%s)\n", path, risk.Score, gx509.RiskLevel(risk.Score))
+		for _, score := range risk.Certificates {
+			fmt.Printf("  %3d %s\n", score.Score, certificateLine(score.Cert))
+			for _, applied := range score.Factors {
+				fmt.Printf("      +%d %s: %s\n", applied.Weight, applied.Factor.Name, applied.Message)
+			}
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not scan: %s", err)
+		return
+	}
+
+	fmt.Printf("\nHierarchies: %d critical, %d high, %d medium, %d low\n",
+		levels["critical"], levels["high"], levels["medium"], levels["low"])
+}
@@ -0,0 +1,417 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runRoots(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 roots age|build|nss|policy|report [flags] store")
+		return
+	}
+
+	switch args[0] {
+	case "age":
+		runRootsAge(args[1:])
+	case "build":
+		runRootsBuild(args[1:])
+	case "nss":
+		runRootsNSS(args[1:])
+	case "policy":
+		runRootsPolicy(args[1:])
+	case "report":
+		runRootsReport(args[1:])
+	default:
+		log.Fatalf("Unknown roots command: %s", args[0])
+	}
+}
+
+func runRootsAge(args []string) {
+	flags := flag.NewFlagSet("roots age", flag.ExitOnError)
+	within := flags.Int("within", 730, "Flag roots expiring within this many days")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 roots age [flags] store\n\n")
+		fmt.Fprintf(flags.Output(), "store is a PEM, certdata.txt or SST file, an NSS profile or cert9.db, a directory\nof PEM files, or \"system\".\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the trust store to report on")
+		return
+	}
+
+	roots, err := loadRoots(positional[0])
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", positional[0], err)
+		return
+	}
+
+	report := gx509.AgeTrustStore(roots, time.Now(), time.Duration(*within)*24*time.Hour)
+
+	var expired, soon, weak, constrained int
+	for _, age := range report {
+		var labels []string
+		if age.Expired {
+			labels = append(labels, "EXPIRED")
+			expired++
+		} else if age.ExpiringSoon {
+			labels = append(labels, "EXPIRING")
+			soon++
+		}
+		if age.WeakKey {
+			labels = append(labels, "WEAK-KEY")
+			weak++
+		}
+		if age.Constrained {
+			labels = append(labels, "CONSTRAINED")
+			constrained++
+		}
+
+		fmt.Printf("%s %6d days  %-14s %-40s %v\n", age.Cert.NotAfter.Format("2006-01-02"),
+			age.DaysRemaining, age.Key, age.Cert.Subject.CommonName, labels)
+	}
+
+	fmt.Printf("\n%d roots: %d expired, %d expiring within %d days, %d with weak keys, %d constrained\n",
+		len(report), expired, soon, *within, weak, constrained)
+
+	timeline := gx509.ExpiryTimeline(report)
+	years := make([]int, 0, len(timeline))
+	for year := range timeline {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	fmt.Printf("\nExpiry timeline:\n")
+	for _, year := range years {
+		fmt.Printf("  %d: %d\n", year, timeline[year])
+	}
+}
+
+// loadAllowlist reads SHA-256 fingerprints from path, one per line. Blank
+// lines and lines starting with # are ignored.
+func loadAllowlist(path string) (map[[sha256.Size]byte]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	allowlist := make(map[[sha256.Size]byte]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprint, err := gx509.ParseFingerprint(line)
+		if err != nil {
+			return nil, err
+		}
+		allowlist[fingerprint] = true
+	}
+	return allowlist, scanner.Err()
+}
+
+func runRootsBuild(args []string) {
+	flags := flag.NewFlagSet("roots build", flag.ExitOnError)
+	trust := flags.String("trust", "serverAuth", "Comma-separated purposes roots must be trusted for: serverAuth, emailProtection, codeSigning")
+	excludeWeak := flags.Bool("exclude-weak", false, "Leave out roots with weak keys")
+	allowlistPath := flags.String("allowlist", "", "Only include roots whose SHA-256 fingerprints are listed in this file")
+	format := flags.String("format", "pem", "Output format: pem, certdata, or jks")
+	password := flags.String("password", "changeit", "Password sealing the Java KeyStore")
+	output := flags.String("o", "", "Write the store to this file instead of stdout")
+	verbose := flags.Bool("v", false, "Explain why each root was left out")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 roots build [flags] store\n\n")
+		fmt.Fprintf(flags.Output(), "store is a PEM, certdata.txt or SST file, an NSS profile or cert9.db, a directory\nof PEM files, or \"system\".\n")
+		fmt.Fprintf(flags.Output(), "Only certdata.txt, SST files and NSS databases record trust bits; other roots are\ntrusted for everything.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the trust store to build from")
+		return
+	}
+
+	var filter gx509.RootFilter
+	var err error
+	if filter.Trust, err = gx509.ParseTrustBits(*trust); err != nil {
+		log.Fatalf("Could not parse -trust: %s", err)
+		return
+	}
+	filter.ExcludeWeakKeys = *excludeWeak
+	if len(*allowlistPath) > 0 {
+		if filter.Allowlist, err = loadAllowlist(*allowlistPath); err != nil {
+			log.Fatalf("Could not load allowlist from %s: %s", *allowlistPath, err)
+			return
+		}
+	}
+
+	var write func(io.Writer, []gx509.TrustedRoot) error
+	switch *format {
+	case "pem":
+		write = func(out io.Writer, roots []gx509.TrustedRoot) error {
+			certs := make([]*x509.Certificate, 0, len(roots))
+			for _, root := range roots {
+				certs = append(certs, root.Cert)
+			}
+			return writeCertificates(out, certs)
+		}
+	case "certdata":
+		write = gx509.WriteCertdata
+	case "jks":
+		write = func(out io.Writer, roots []gx509.TrustedRoot) error {
+			return gx509.WriteJKS(out, roots, *password, time.Now())
+		}
+	default:
+		log.Fatalf("Unknown format: %s", *format)
+		return
+	}
+
+	roots, err := loadTrustedRoots(positional[0])
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", positional[0], err)
+		return
+	}
+
+	var included []gx509.TrustedRoot
+	for _, root := range roots {
+		if ok, reason := filter.Include(root); ok {
+			included = append(included, root)
+		} else if *verbose {
+			log.Printf("Excluding %s: %s", root.Label, reason)
+		}
+	}
+	log.Printf("Including %d of %d roots", len(included), len(roots))
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+
+	if err := write(out, included); err != nil {
+		log.Fatalf("Could not write store: %s", err)
+		return
+	}
+}
+
+func runRootsNSS(args []string) {
+	flags := flag.NewFlagSet("roots nss", flag.ExitOnError)
+	overrides := flags.Bool("overrides", false, "Only list certificates the user has set trust for")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 roots nss [flags] profile\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the certificates added to an NSS database, such as a Firefox or Thunderbird\n")
+		fmt.Fprintf(flags.Output(), "profile's cert9.db, with the trust set for them and whether key4.db holds their\n")
+		fmt.Fprintf(flags.Output(), "private keys. profile is the profile directory or the cert9.db itself.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the profile to report on")
+		return
+	}
+	path, ok := nssDatabasePath(positional[0])
+	if !ok {
+		log.Fatalf("No NSS database found at %s", positional[0])
+		return
+	}
+	certs, err := loadNSSDatabase(path)
+	if err != nil {
+		log.Fatalf("Could not read %s: %s", path, err)
+		return
+	}
+
+	var cas, distrusted, peers, keys int
+	for _, cert := range certs {
+		var settings []string
+		if cert.Trusted != 0 {
+			settings = append(settings, "trusted CA for "+cert.Trusted.String())
+			cas++
+		}
+		if cert.TrustedPeer != 0 {
+			settings = append(settings, "trusted peer for "+cert.TrustedPeer.String())
+			peers++
+		}
+		if cert.Distrusted != 0 {
+			settings = append(settings, "distrusted for "+cert.Distrusted.String())
+			distrusted++
+		}
+		if cert.HasPrivateKey {
+			keys++
+		}
+		if *overrides && len(settings) == 0 {
+			continue
+		}
+		if cert.HasPrivateKey {
+			settings = append(settings, "has private key")
+		}
+		if len(settings) == 0 {
+			settings = append(settings, "no trust set")
+		}
+		fmt.Printf("%s\n", certificateLine(cert.Cert))
+		fmt.Printf("  %q: %s\n", cert.Label, strings.Join(settings, "; "))
+	}
+
+	fmt.Printf("\n%d certificates: %d trusted CAs, %d trusted peers, %d distrusted, %d with private keys\n",
+		len(certs), cas, peers, distrusted, keys)
+}
+
+func runRootsPolicy(args []string) {
+	flags := flag.NewFlagSet("roots policy", flag.ExitOnError)
+	constrained := flags.Bool("constrained", false, "Exit non-zero if policy trusts a CA without limiting it, and the CA is not technically constrained")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 roots policy [flags] policy...\n\n")
+		fmt.Fprintf(flags.Output(), "Reports the CAs that Chrome or Edge enterprise policies trust, constrain, distrust\n")
+		fmt.Fprintf(flags.Output(), "or hint, and whether each is technically constrained. Each policy is a JSON policy\n")
+		fmt.Fprintf(flags.Output(), "file or a regedit export of the browser's policy key.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the policies to report on")
+		return
+	}
+	policy := &gx509.BrowserPolicy{}
+	for _, path := range positional {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		found, err := gx509.ParseBrowserPolicy(data)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", path, err)
+			return
+		}
+		policy.Trusted = append(policy.Trusted, found.Trusted...)
+		policy.Constrained = append(policy.Constrained, found.Constrained...)
+		policy.Distrusted = append(policy.Distrusted, found.Distrusted...)
+		policy.Hints = append(policy.Hints, found.Hints...)
+	}
+
+	unconstrained := 0
+	// report prints cert's status and whether it is technically constrained
+	report := func(cert *x509.Certificate, status string) bool {
+		analysis := gx509.AnalyzeTechnicalConstraints(cert)
+		if analysis.Constrained {
+			status += "; technically constrained"
+		} else {
+			status += "; not technically constrained: " + analysis.Details()
+		}
+		fmt.Printf("%s\n  %s\n", certificateLine(cert), status)
+		return analysis.Constrained
+	}
+	for _, cert := range policy.Trusted {
+		if !report(cert, "trusted") {
+			unconstrained++
+		}
+	}
+	for _, ca := range policy.Constrained {
+		limits := append(append([]string{}, ca.PermittedDNSNames...), ca.PermittedCIDRs...)
+		report(ca.Cert, "trusted for "+strings.Join(limits, ", ")+" only")
+	}
+	for _, cert := range policy.Distrusted {
+		report(cert, "distrusted")
+	}
+	for _, cert := range policy.Hints {
+		report(cert, "path-building hint, not trusted")
+	}
+
+	fmt.Printf("\n%d trusted, %d trusted with constraints, %d distrusted, %d hints; %d trusted without constraints\n",
+		len(policy.Trusted), len(policy.Constrained), len(policy.Distrusted), len(policy.Hints), unconstrained)
+	if *constrained && unconstrained > 0 {
+		os.Exit(1)
+	}
+}
+
+func runRootsReport(args []string) {
+	flags := flag.NewFlagSet("roots report", flag.ExitOnError)
+	format := flags.String("format", "text", "Output format: "+strings.Join(gx509.RendererFormats(), ", "))
+	title := flags.String("title", "", "Title for the report, such as the change ticket number")
+	within := flags.Int("within", 730, "Flag CAs expiring within this many days")
+	var crlPaths stringList
+	flags.Var(&crlPaths, "crl", "PEM or DER CRL to check the CAs against (repeatable)")
+	output := flags.String("o", "", "Write the report to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 roots report [flags] store...\n\n")
+		fmt.Fprintf(flags.Output(), "Reports, for each CA about to be distributed by group policy or MDM, whether it\n")
+		fmt.Fprintf(flags.Output(), "is constrained, expired, weak-keyed or revoked, for a change-management ticket.\n")
+		fmt.Fprintf(flags.Output(), "Each store is read as by roots build.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the CAs to report on")
+		return
+	}
+	out := os.Stdout
+	if len(*output) > 0 {
+		var err error
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Could not create %s: %s", *output, err)
+			return
+		}
+		defer out.Close()
+	}
+	renderer, err := gx509.NewRenderer(*format, out)
+	if err != nil {
+		log.Fatalf("%s", err)
+		return
+	}
+
+	var roots []gx509.TrustedRoot
+	for _, path := range positional {
+		found, err := loadTrustedRoots(path)
+		if err != nil {
+			log.Fatalf("Could not load roots from %s: %s", path, err)
+			return
+		}
+		roots = append(roots, found...)
+	}
+	var crls []*pkix.CertificateList
+	for _, path := range crlPaths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		crl, err := x509.ParseCRL(data)
+		if err != nil {
+			log.Fatalf("Could not parse CRL %s: %s", path, err)
+			return
+		}
+		crls = append(crls, crl)
+	}
+	cas := gx509.NewCAReport(*title, roots, crls, time.Now(), time.Duration(*within)*24*time.Hour)
+	if err := renderer.Render(gx509.Report{Kind: gx509.CAStatusReport, Generated: cas.Generated, CAs: cas}); err != nil {
+		log.Fatalf("Could not write report: %s", err)
+		return
+	}
+}
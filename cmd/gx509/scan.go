@@ -0,0 +1,210 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runScan(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	checkKeys := flags.Bool("keys", false, "Also find private keys, and check each against the certificates found")
+	store := flags.Bool("store", false, "Store the certificates found in the warehouse")
+	warehousePath := addWarehouseFlag(flags)
+	passwords := addKeyPasswordFlags(flags, false)
+	handshake := addTLSScanFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 scan [flags] path...\n")
+		fmt.Fprintf(flags.Output(), "       gx509 scan [flags] host:port...\n\n")
+		fmt.Fprintf(flags.Output(), "Scans each file or directory, recursively, for PEM certificates and, with -keys,\n")
+		fmt.Fprintf(flags.Output(), "flags private keys that are mismatched, orphaned, or belong to a CA. Given\n")
+		fmt.Fprintf(flags.Output(), "TLS endpoints instead, completes a handshake with each, after STARTTLS for\n")
+		fmt.Fprintf(flags.Output(), "mail and directory servers with -starttls, and analyzes the constraints and\n")
+		fmt.Fprintf(flags.Output(), "extensions of every certificate presented.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the paths to scan")
+		return
+	}
+	endpoints := 0
+	for _, arg := range positional {
+		if isEndpoint(arg) {
+			endpoints++
+		}
+	}
+	if endpoints > 0 {
+		if endpoints != len(positional) || *checkKeys {
+			log.Fatalf("TLS endpoints cannot be scanned along with paths or -keys")
+			return
+		}
+		harvested := scanEndpoints(positional, handshake)
+		if *store {
+			if err := storeInWarehouse(*warehousePath, harvested); err != nil {
+				log.Fatalf("Could not store certificates: %s", err)
+				return
+			}
+		}
+		if len(harvested) < len(positional) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var certs []gx509.LocatedCertificate
+	var keys []gx509.LocatedKey
+	harvested := make(map[string][]*x509.Certificate)
+	err := scanFiles(positional, func(path string, found []*x509.Certificate, blocks []*pem.Block) {
+		if len(found) > 0 {
+			harvested[path] = found
+		}
+		for _, cert := range found {
+			certs = append(certs, gx509.LocatedCertificate{Path: path, Cert: cert})
+			fmt.Printf("%s: %s (expires %s)\n", path, cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+		}
+		if !*checkKeys {
+			return
+		}
+		for _, block := range blocks {
+			key, err := passwords.parsePrivateKey(path, block)
+			if err != nil {
+				// Keys that cannot be decrypted are still reported
+				if block.Type != "ENCRYPTED PRIVATE KEY" && !x509.IsEncryptedPEMBlock(block) {
+					log.Printf("Skipping a private key in %s: %s", path, err)
+					continue
+				}
+				if err != gx509.ErrEncryptedPrivateKey {
+					log.Printf("Could not decrypt the private key in %s: %s", path, err)
+				}
+			}
+			keys = append(keys, gx509.LocatedKey{Path: path, Key: key})
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not scan: %s", err)
+		return
+	}
+	if *store {
+		if err := storeInWarehouse(*warehousePath, harvested); err != nil {
+			log.Fatalf("Could not store certificates: %s", err)
+			return
+		}
+	}
+
+	if !*checkKeys {
+		return
+	}
+
+	fmt.Printf("\n%d certificates, %d private keys\n", len(certs), len(keys))
+	flagged := 0
+	for _, finding := range gx509.PairKeys(keys, certs) {
+		if finding.Key.Key == nil {
+			fmt.Printf("  %s: %s key, not checked\n", finding.Key.Path, finding.Status)
+			continue
+		}
+
+		fmt.Printf("  %s: %s %s key", finding.Key.Path, finding.Status, finding.Key.Key.Algorithm())
+		for _, match := range finding.Matches {
+			fmt.Printf(", certifies %s in %s", match.Cert.Subject.CommonName, match.Path)
+		}
+		if finding.CA {
+			fmt.Printf(" [CA KEY]")
+		}
+		fmt.Println()
+
+		if finding.CA || finding.Status == gx509.KeyMismatched || finding.Status == gx509.KeyOrphaned {
+			flagged++
+		}
+	}
+	if flagged > 0 {
+		fmt.Printf("\n%d keys need attention\n", flagged)
+		os.Exit(1)
+	}
+}
+
+// maxScanFileSize bounds the files read while scanning; certificate files
+// and trust bundles are far smaller.
+const maxScanFileSize = 4 << 20
+
+var pemMarker = []byte("-----BEGIN ")
+
+// scanCertificates walks each path, which may be a file or a directory, and
+// calls found with every file holding PEM certificates. Files are recognized
+// by content, not by name, so extensionless trust bundles are included.
+func scanCertificates(paths []string, found func(path string, certs []*x509.Certificate)) error {
+	return scanFiles(paths, func(path string, certs []*x509.Certificate, keys []*pem.Block) {
+		if len(certs) > 0 {
+			found(path, certs)
+		}
+	})
+}
+
+// scanFiles is scanCertificates that also reports the private key PEM blocks
+// in each file, which are left for the caller to parse.
+func scanFiles(paths []string, found func(path string, certs []*x509.Certificate, keys []*pem.Block)) error {
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Printf("Skipping %s: %s", path, err)
+				return nil
+			}
+			if !info.Mode().IsRegular() || info.Size() > maxScanFileSize {
+				return nil
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Printf("Skipping %s: %s", path, err)
+				return nil
+			}
+			if !bytes.Contains(contents, pemMarker) {
+				return nil
+			}
+
+			var certs []*x509.Certificate
+			var keys []*pem.Block
+			for {
+				var block *pem.Block
+				block, contents = pem.Decode(contents)
+				if block == nil {
+					break
+				}
+				if gx509.IsPrivateKeyBlock(block) {
+					keys = append(keys, block)
+					continue
+				}
+				if block.Type != "CERTIFICATE" {
+					continue
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					log.Printf("Skipping a certificate in %s: %s", path, err)
+					continue
+				}
+				certs = append(certs, cert)
+			}
+			if len(certs) > 0 || len(keys) > 0 {
+				found(path, certs, keys)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
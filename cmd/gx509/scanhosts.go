@@ -0,0 +1,140 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runScanHosts(args []string) {
+	flags := flag.NewFlagSet("scan-hosts", flag.ExitOnError)
+	concurrency := flags.Int("concurrency", 16, "Number of hosts to connect to at once")
+	timeout := flags.Duration("timeout", 5*time.Second, "Timeout for each connection")
+	days := flags.Int("days", 30, "Flag certificates expiring within this many days")
+	atFlag := flags.String("at", "", "Evaluate expiry as of this RFC 3339 time (default now)")
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file (default the embedded one)")
+	constrained := flags.Bool("constrained", false, "Flag hosts whose issuing CA is not technically constrained")
+	expandCIDR := flags.Bool("cidr", false, "Permit CIDR ranges in the hosts files, sweeping every address in them")
+	ports := flags.String("ports", "443", "Comma-separated ports to sweep in CIDR ranges")
+	maxHosts := flags.Int("max-hosts", 4096, "Most addresses that CIDR ranges may expand to")
+	store := flags.Bool("store", false, "Store the certificates found in the warehouse")
+	warehousePath := addWarehouseFlag(flags)
+	rate := flags.Float64("rate", 50, "Most connections to start per second, or 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 scan-hosts [flags] hosts.txt...\n\n")
+		fmt.Fprintf(flags.Output(), "Connects to each host[:port] listed, one per line, and reports its\n")
+		fmt.Fprintf(flags.Output(), "certificate, then summarizes the issuers, their constraints and the expiry of\n")
+		fmt.Fprintf(flags.Output(), "every certificate found. With -cidr, lines may also be CIDR ranges to sweep.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the hosts files to scan")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	var ranges *gx509.CIDRExpansion
+	if *expandCIDR {
+		ranges = &gx509.CIDRExpansion{Ports: strings.Split(*ports, ","), Max: *maxHosts}
+	}
+	var interval time.Duration
+	if *rate > 0 {
+		interval = time.Duration(float64(time.Second) / *rate)
+	}
+
+	var addresses []string
+	for _, path := range positional {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", path, err)
+			return
+		}
+		found, err := gx509.ParseHostList(file, ranges)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		addresses = append(addresses, found...)
+	}
+
+	table, err := loadOwnerTable(*ownersPath)
+	if err != nil {
+		log.Fatalf("Could not load owner table: %s", err)
+		return
+	}
+
+	warning := time.Duration(*days) * 24 * time.Hour
+	flagged := 0
+	failed := 0
+	unreachable := 0
+	var servers []gx509.ServerChain
+	for _, server := range gx509.ScanHosts(addresses, *timeout, *concurrency, interval) {
+		var dialErr *net.OpError
+		if *expandCIDR && errors.As(server.Err, &dialErr) && dialErr.Op == "dial" {
+			// Most addresses in a sweep have no TLS service
+			unreachable++
+			continue
+		}
+		if server.Err != nil {
+			fmt.Printf("%s: %s\n", server.Address, server.Err)
+			failed++
+			continue
+		}
+		leaf := server.Certificates[0]
+		note := ""
+		switch {
+		case at.After(leaf.NotAfter):
+			note = " EXPIRED"
+			flagged++
+		case at.Add(warning).After(leaf.NotAfter):
+			note = " EXPIRING"
+			flagged++
+		}
+		fmt.Printf("%s: %s%s\n", server.Address, certificateLine(leaf), note)
+		servers = append(servers, server)
+	}
+
+	if *store {
+		if err := storeServerChains(*warehousePath, servers); err != nil {
+			log.Fatalf("Could not store certificates: %s", err)
+			return
+		}
+	}
+
+	fmt.Printf("\n")
+	flagged += printExposures(servers, gx509.SummarizeCAExposure(servers, table), *constrained)
+	expiry := gx509.SummarizeExpiry(servers, at, warning)
+	fmt.Printf("\n%d expired, %d expiring within %d days, %d valid", expiry.Expired, expiry.Expiring, *days, expiry.Valid)
+	if !expiry.Soonest.IsZero() {
+		fmt.Printf("; next expiry %s", expiry.Soonest.Format("2006-01-02"))
+	}
+	fmt.Printf("\n%d of %d hosts could not be scanned\n", failed, len(addresses))
+	if *expandCIDR {
+		fmt.Printf("%d addresses refused or did not answer connections\n", unreachable)
+	}
+
+	if flagged+failed > 0 {
+		os.Exit(1)
+	}
+}
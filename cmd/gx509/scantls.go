@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// tlsScanFlags are the flags shaping the handshakes of gx509 scan.
+type tlsScanFlags struct {
+	sni        *string
+	alpn       *string
+	minVersion *string
+	maxVersion *string
+	startTLS   *string
+	timeout    *time.Duration
+	policy     *string
+}
+
+// addTLSScanFlags registers the handshake flags of gx509 scan on flags.
+func addTLSScanFlags(flags *flag.FlagSet) *tlsScanFlags {
+	return &tlsScanFlags{
+		sni:        flags.String("sni", "", "Server name to send to TLS endpoints (default the host)"),
+		alpn:       flags.String("alpn", "", "Comma-separated application protocols to offer TLS endpoints, such as h2,http/1.1"),
+		minVersion: flags.String("tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3"),
+		maxVersion: flags.String("tls-max", "", "Highest TLS version to offer: 1.0, 1.1, 1.2 or 1.3"),
+		startTLS:   flags.String("starttls", "", "Negotiate STARTTLS with TLS endpoints in this protocol: "+strings.Join(gx509.StartTLSProtocols, ", ")),
+		timeout:    flags.Duration("timeout", 10*time.Second, "Timeout for each TLS handshake"),
+		policy:     flags.String("policy", gx509.DefaultPolicy.Name, "Judge the constraints of TLS endpoints' certificates by this policy"),
+	}
+}
+
+// isEndpoint reports whether arg is a host and port, rather than a path.
+func isEndpoint(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(arg)
+	if err != nil || len(host) == 0 {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+// knownStartTLSProtocol is whether gx509 can negotiate STARTTLS in protocol.
+func knownStartTLSProtocol(protocol string) bool {
+	for _, known := range gx509.StartTLSProtocols {
+		if known == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// scanEndpoints handshakes with each endpoint and prints what it presented,
+// returning the certificates of those that answered by address.
+func scanEndpoints(endpoints []string, handshake *tlsScanFlags) map[string][]*x509.Certificate {
+	options := gx509.TLSScanOptions{ServerName: *handshake.sni, StartTLS: *handshake.startTLS, Timeout: *handshake.timeout}
+	if len(options.StartTLS) > 0 && !knownStartTLSProtocol(options.StartTLS) {
+		log.Fatalf("Unknown -starttls protocol %s; use one of %s", options.StartTLS, strings.Join(gx509.StartTLSProtocols, ", "))
+		return nil
+	}
+	if len(*handshake.alpn) > 0 {
+		options.ALPN = strings.Split(*handshake.alpn, ",")
+	}
+	for _, version := range []struct {
+		name string
+		out  *uint16
+	}{{*handshake.minVersion, &options.MinVersion}, {*handshake.maxVersion, &options.MaxVersion}} {
+		if len(version.name) == 0 {
+			continue
+		}
+		var err error
+		if *version.out, err = gx509.ParseTLSVersion(version.name); err != nil {
+			log.Fatalf("%s", err)
+			return nil
+		}
+	}
+	policy, ok := gx509.LookupPolicy(*handshake.policy)
+	if !ok {
+		log.Fatalf("Unknown policy: %s", *handshake.policy)
+		return nil
+	}
+
+	harvested := make(map[string][]*x509.Certificate)
+	for _, endpoint := range endpoints {
+		scan, err := gx509.ScanTLS(endpoint, options)
+		if err != nil {
+			log.Printf("Could not scan %s: %s", endpoint, err)
+			continue
+		}
+		harvested[endpoint] = scan.Certificates
+
+		fmt.Printf("%s (SNI %s", endpoint, scan.ServerName)
+		if len(scan.StartTLS) > 0 {
+			fmt.Printf(", STARTTLS %s", scan.StartTLS)
+		}
+		fmt.Printf("): %s, %s", gx509.TLSVersionName(scan.Version), tls.CipherSuiteName(scan.CipherSuite))
+		if len(scan.ALPN) > 0 {
+			fmt.Printf(", ALPN %s", scan.ALPN)
+		}
+		fmt.Printf("\n")
+		for i, cert := range scan.Certificates {
+			analysis := gx509.AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+			fmt.Printf("\n#%d %s\n", i+1, certificateLine(cert))
+			fmt.Printf("Technically constrained under %s: %t\n", policy.Name, analysis.Constrained)
+			fmt.Printf("Details: %s\n", analysis.Details())
+			for _, ext := range gx509.DecodeExtensions(cert) {
+				marks := ""
+				if ext.Critical {
+					marks = " (critical)"
+				}
+				if ext.Duplicate {
+					marks += " (duplicate)"
+				}
+				fmt.Printf("%s%s:\n", ext.Name, marks)
+				for _, line := range ext.Lines {
+					fmt.Printf("    %s\n", line)
+				}
+				if ext.Err != nil {
+					log.Printf("%s#%d: %s", endpoint, i+1, ext.Err)
+				}
+			}
+		}
+		fmt.Printf("\n")
+	}
+	return harvested
+}
@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runSCT(args []string) {
+	flags := flag.NewFlagSet("sct", flag.ExitOnError)
+	logList := flags.String("logs", "", "Path to a CT log list in the v3 JSON format, to verify the SCTs against (default the embedded list)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 sct [flags] chain.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the SCTs embedded in the first certificate in chain.pem. With the issuer\n")
+		fmt.Fprintf(flags.Output(), "as the second certificate, verifies each SCT's signature against the log list\n")
+		fmt.Fprintf(flags.Output(), "given with -logs, or the one built in, and exits non-zero if any does not\n")
+		fmt.Fprintf(flags.Output(), "verify or there are no logs to verify against. Log lists are published at\n")
+		fmt.Fprintf(flags.Output(), "https://www.gstatic.com/ct/log_list/v3/all_logs_list.json.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the chain .pem file")
+		return
+	}
+	path := positional[0]
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", path, err)
+		return
+	}
+	var issuer *x509.Certificate
+	if len(certs) > 1 {
+		issuer = certs[1]
+	}
+	logs := gx509.DefaultCTLogList.Logs
+	if len(*logList) > 0 {
+		data, err := ioutil.ReadFile(*logList)
+		if err != nil {
+			log.Fatalf("Could not read log list: %s", err)
+			return
+		}
+		if logs, err = gx509.ParseCTLogList(data); err != nil {
+			log.Fatalf("%s", err)
+			return
+		}
+	}
+	if len(logs) == 0 {
+		log.Fatalf("No CT logs to verify SCTs against; give a log list with -logs")
+		return
+	}
+
+	results, err := gx509.VerifyCertificateSCTs(certs[0], issuer, logs)
+	if err != nil {
+		log.Fatalf("%s: %s", path, err)
+		return
+	}
+	fmt.Printf("%s\n", certificateLine(certs[0]))
+	if len(results) == 0 {
+		fmt.Printf("  No embedded SCTs\n")
+	}
+	verified := 0
+	for _, result := range results {
+		name := base64.StdEncoding.EncodeToString(result.SCT.LogID[:])
+		if result.Log != nil {
+			name = fmt.Sprintf("%s (%s)", result.Log.Description, result.Log.Operator)
+		}
+		fmt.Printf("  %s at %s\n", name, result.SCT.Timestamp.Format("2006-01-02 15:04:05.000 MST"))
+		if result.Err != nil {
+			fmt.Printf("    not verified: %s\n", result.Err)
+		} else {
+			fmt.Printf("    verified\n")
+			verified++
+		}
+	}
+
+	if verified < len(results) {
+		os.Exit(1)
+	}
+}
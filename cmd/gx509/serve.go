@@ -0,0 +1,113 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "Address to listen on")
+	tenantsPath := flags.String("tenants", "", "Path to a tenant configuration YAML file; without one, callers need no API key")
+	maxBody := flags.Int64("max-body", 1<<20, "Largest upload to accept, in bytes")
+	public := flags.Bool("public", false, "Harden the service for the open internet: no API keys, requests capped at 64 KiB and 10 certificates, and per-IP rate limits")
+	rate := flags.Int("rate", 30, "With -public, the requests a minute each IPv4 address or IPv6 /64 may make")
+	burst := flags.Int("burst", 10, "With -public, the requests each IPv4 address or IPv6 /64 may make at once")
+	verdictLog := flags.String("verdict-log", "", "Append a JSON line recording every analysis, its caller, input hash and policy, to this file")
+	verdictLogMaxSize := flags.Int64("verdict-log-max-size", 100, "Rotate the verdict log once it reaches this many megabytes")
+	verdictLogBackups := flags.Int("verdict-log-backups", 10, "Keep this many rotated verdict logs")
+	hashKey := flags.Bool("hash-key", false, "Read an API key from standard input and print its hash for a tenant configuration, then exit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 serve [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Serves the analysis over HTTP: POST PEM, DER or PKCS#7 certificates to\n")
+		fmt.Fprintf(flags.Output(), "/v1/analyze for their constraint analysis and lint findings as JSON. With\n")
+		fmt.Fprintf(flags.Output(), "-tenants, callers give an API key as \"Authorization: Bearer <key>\", and are\n")
+		fmt.Fprintf(flags.Output(), "judged by the policy and lints of the tenant it belongs to. The analysis never\n")
+		fmt.Fprintf(flags.Output(), "fetches anything; -public also limits what each caller may send.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *hashKey {
+		key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if key = strings.TrimSpace(key); key == "" {
+			log.Fatalf("Could not read an API key: %v", err)
+			return
+		}
+		fmt.Printf("%s\n", gx509.HashAPIKey(key))
+		return
+	}
+
+	server := &gx509.AnalysisServer{MaxRequestBody: *maxBody}
+	if *public {
+		if *tenantsPath != "" {
+			log.Fatalf("-public serves everyone as the default tenant, and cannot be used with -tenants")
+			return
+		}
+		if *rate <= 0 || *burst <= 0 {
+			log.Fatalf("-rate and -burst must be positive")
+			return
+		}
+		server = gx509.NewPublicAnalysisServer(*rate, *burst)
+		// -max-body may only tighten the public cap
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "max-body" && *maxBody < server.MaxRequestBody {
+				server.MaxRequestBody = *maxBody
+			}
+		})
+		log.Printf("Serving publicly, at most %d bytes and %d certificates a request, %d requests a minute per address",
+			server.MaxRequestBody, server.MaxCertificates, *rate)
+	} else if *tenantsPath != "" {
+		data, err := ioutil.ReadFile(*tenantsPath)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", *tenantsPath, err)
+			return
+		}
+		if server.Tenants, err = gx509.ParseTenantConfig(data); err != nil {
+			log.Fatalf("Could not parse %s: %s", *tenantsPath, err)
+			return
+		}
+		log.Printf("Serving %d tenants", len(server.Tenants.Tenants))
+	} else {
+		log.Printf("Serving without API keys, under the default policy and every lint")
+	}
+
+	if *verdictLog != "" {
+		var err error
+		if server.VerdictLog, err = gx509.OpenVerdictLog(*verdictLog, *verdictLogMaxSize<<20, *verdictLogBackups); err != nil {
+			log.Fatalf("%s", err)
+			return
+		}
+		defer server.VerdictLog.Close()
+		log.Printf("Recording verdicts in %s", *verdictLog)
+	}
+
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	if *public {
+		httpServer.ReadHeaderTimeout = 5 * time.Second
+		httpServer.ReadTimeout = 10 * time.Second
+		httpServer.IdleTimeout = 30 * time.Second
+		httpServer.MaxHeaderBytes = 8 << 10
+	}
+	log.Printf("Listening on %s", *listen)
+	log.Fatalf("%s", httpServer.ListenAndServe())
+}
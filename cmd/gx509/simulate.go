@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// stringList is a flag.Value that collects repeated or comma-separated
+// arguments.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func runSimulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var names, ips, ekus stringList
+	flags.Var(&names, "name", "dNSName for the hypothetical leaf (repeatable)")
+	flags.Var(&ips, "ip", "iPAddress for the hypothetical leaf (repeatable)")
+	flags.Var(&ekus, "eku", "Extended key usage for the hypothetical leaf (repeatable, default serverAuth)")
+	commonName := flags.String("cn", "", "Subject commonName for the hypothetical leaf")
+	notBefore := flags.String("not-before", "", "Leaf notBefore as RFC 3339 (default now)")
+	days := flags.Int("days", 90, "Leaf lifetime in days (default the profile's, or 90)")
+	profileName := flags.String("profile", "", "Start from this built-in leaf profile, which -days and -eku override")
+	kbPath := flags.String("kb", "", "Path to a knowledge base YAML file (default the fetched or embedded one)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 simulate [flags] intermediate.pem\n\nProfiles:\n")
+		for _, profile := range gx509.DefaultProfiles.Profiles {
+			fmt.Fprintf(flags.Output(), "  %-18s %s\n", profile.Name, profile.Description)
+		}
+		fmt.Fprintf(flags.Output(), "\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalf("You must specify the path to the intermediate .pem file as the last argument")
+		return
+	}
+
+	issuer, err := loadCertificate(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", flags.Arg(0), err)
+		return
+	}
+
+	start := time.Now()
+	if len(*notBefore) > 0 {
+		if start, err = time.Parse(time.RFC3339, *notBefore); err != nil {
+			log.Fatalf("Invalid -not-before: %s", err)
+			return
+		}
+	}
+	base := gx509.IssuanceProfile{Days: 90, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	if len(*profileName) > 0 {
+		var ok bool
+		if base, ok = gx509.DefaultProfiles.Lookup(*profileName); !ok {
+			log.Fatalf("Unknown profile: %s", *profileName)
+			return
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "days" {
+			base.Days = *days
+		}
+	})
+	if len(ekus) > 0 {
+		base.ExtKeyUsage = nil
+	}
+	profile := base.Leaf(start)
+	profile.CommonName, profile.DNSNames = *commonName, names
+
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			log.Fatalf("Invalid -ip: %s", ip)
+			return
+		}
+		profile.IPAddresses = append(profile.IPAddresses, parsed)
+	}
+
+	for _, name := range ekus {
+		usage, err := gx509.ParseExtKeyUsage(name)
+		if err != nil {
+			log.Fatalf("Invalid -eku: %s", err)
+			return
+		}
+		profile.ExtKeyUsage = append(profile.ExtKeyUsage, usage)
+	}
+
+	kb, err := loadKnowledgeBase(*kbPath)
+	if err != nil {
+		log.Fatalf("Could not load knowledge base: %s", err)
+		return
+	}
+
+	fmt.Printf("Simulated leaf issued by %s (knowledge base version %s)\n",
+		issuer.Subject.CommonName, kb.Version)
+	printVerdicts(kb.SimulateIssuance(issuer, profile))
+}
@@ -0,0 +1,141 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func loadSSHKeys(path string) ([]gx509.SSHEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return gx509.ParseSSHKeys(file)
+}
+
+func runSSH(args []string) {
+	flags := flag.NewFlagSet("ssh", flag.ExitOnError)
+	caFile := flags.String("ca", "", "File of trusted CA public keys, such as TrustedUserCAKeys; certificates signed by others are flagged")
+	atFlag := flags.String("at", "", "Analyze as of this date (YYYY-MM-DD) instead of now")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 ssh [flags] file...\n\n")
+		fmt.Fprintf(flags.Output(), "Analyzes the OpenSSH certificates and CA keys in each file, which may be a\n")
+		fmt.Fprintf(flags.Output(), "*-cert.pub, *.pub, authorized_keys or known_hosts file.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the files to analyze")
+		return
+	}
+	at := time.Now()
+	if len(*atFlag) > 0 {
+		var err error
+		if at, err = time.Parse("2006-01-02", *atFlag); err != nil {
+			log.Fatalf("Could not parse -at: %s", err)
+			return
+		}
+	}
+
+	var trusted []gx509.SSHKey
+	if len(*caFile) > 0 {
+		entries, err := loadSSHKeys(*caFile)
+		if err != nil {
+			log.Fatalf("Could not load %s: %s", *caFile, err)
+			return
+		}
+		for _, entry := range entries {
+			if entry.Key != nil {
+				trusted = append(trusted, *entry.Key)
+			}
+		}
+	}
+
+	flagged := 0
+	for _, path := range positional {
+		entries, err := loadSSHKeys(path)
+		if err != nil {
+			log.Fatalf("Could not load %s: %s", path, err)
+			return
+		}
+
+		for _, entry := range entries {
+			if entry.Key != nil {
+				description, weak := entry.Key.Describe()
+				role := "key"
+				if entry.CertAuthority {
+					role = "CA key"
+				}
+				fmt.Printf("%s:%d: %s %s %s %s\n", path, entry.Line, description, role, entry.Key.Fingerprint(), entry.Comment)
+				if weak {
+					fmt.Printf("  Weak key\n")
+					flagged++
+				}
+				continue
+			}
+
+			cert := entry.Cert
+			certType := "user"
+			if cert.Type == gx509.SSHHostCert {
+				certType = "host"
+			}
+			keyDescription, _ := cert.Key.Describe()
+			caDescription, _ := cert.SignatureKey.Describe()
+			validBefore := "forever"
+			if !cert.ValidBefore.IsZero() {
+				validBefore = cert.ValidBefore.Format("2006-01-02 15:04")
+			}
+
+			fmt.Printf("%s:%d: %s certificate %q, serial %d\n", path, entry.Line, certType, cert.KeyID, cert.Serial)
+			fmt.Printf("  Key: %s %s\n", keyDescription, cert.Key.Fingerprint())
+			fmt.Printf("  Signed by: %s %s (%s)\n", caDescription, cert.SignatureKey.Fingerprint(), cert.SignatureAlgorithm)
+			fmt.Printf("  Principals: %s\n", strings.Join(cert.Principals, ", "))
+			fmt.Printf("  Valid: %s to %s\n", cert.ValidAfter.Format("2006-01-02 15:04"), validBefore)
+
+			var options []string
+			for option, value := range cert.CriticalOptions {
+				if len(value) > 0 {
+					option += "=" + value
+				}
+				options = append(options, option)
+			}
+			sort.Strings(options)
+			fmt.Printf("  Critical options: %s\n", strings.Join(options, ", "))
+			fmt.Printf("  Extensions: %s\n", strings.Join(cert.Extensions, ", "))
+
+			problems := gx509.AnalyzeSSHCertificate(cert, at)
+			if len(*caFile) > 0 {
+				signedByTrusted := false
+				for _, ca := range trusted {
+					signedByTrusted = signedByTrusted || cert.SignedBy(ca)
+				}
+				if !signedByTrusted {
+					problems = append(problems, "Not signed by a CA in "+*caFile)
+				}
+			}
+			for _, problem := range problems {
+				fmt.Printf("  %s\n", problem)
+			}
+			if len(problems) > 0 {
+				flagged++
+			}
+		}
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// stepPath resolves a path from a step-ca configuration, which is relative
+// to $STEPPATH when it isn't absolute.
+func stepPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func runStepCA(args []string) {
+	flags := flag.NewFlagSet("stepca", flag.ExitOnError)
+	base := flags.String("steppath", os.Getenv("STEPPATH"), "The directory relative paths in the configuration are under; defaults to $STEPPATH")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 stepca [flags] ca.json\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether the intermediate of a step-ca authority is technically constrained,\n")
+		fmt.Fprintf(flags.Output(), "and lists the provisioners whose policies, templates or claims could issue\n")
+		fmt.Fprintf(flags.Output(), "certificates outside its constraints or browser requirements. Exits non-zero if\n")
+		fmt.Fprintf(flags.Output(), "there are any such provisioners.\n")
+		flags.PrintDefaults()
+	}
+	paths := parseInterspersed(flags, args)
+
+	if len(paths) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	data, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		log.Fatalf("Could not read %s: %s", paths[0], err)
+		return
+	}
+	config, err := gx509.ParseStepCAConfig(data)
+	if err != nil {
+		log.Fatalf("Could not parse %s: %s", paths[0], err)
+		return
+	}
+	if len(*base) == 0 {
+		*base = filepath.Dir(filepath.Dir(paths[0]))
+	}
+
+	for _, root := range config.Roots {
+		certs, err := loadCertificates(stepPath(*base, root))
+		if err != nil {
+			log.Fatalf("Could not load root: %s", err)
+			return
+		}
+		fmt.Printf("Root: %s\n", certificateLine(certs[0]))
+	}
+
+	var intermediate *x509.Certificate
+	if len(config.Intermediate) > 0 {
+		certs, err := loadCertificates(stepPath(*base, config.Intermediate))
+		if err != nil {
+			log.Fatalf("Could not load intermediate: %s", err)
+			return
+		}
+		intermediate = certs[0]
+		fmt.Printf("Intermediate: %s\n", certificateLine(intermediate))
+		if analysis := gx509.AnalyzeTechnicalConstraints(intermediate); analysis.Constrained {
+			fmt.Printf("  technically constrained\n")
+		} else {
+			fmt.Printf("  not technically constrained: %s\n", analysis.Details())
+		}
+	}
+
+	fmt.Printf("\nProvisioners:\n")
+	violating := 0
+	for _, provisioner := range config.Provisioners {
+		if len(provisioner.Template) == 0 && len(provisioner.TemplateFile) > 0 {
+			template, err := ioutil.ReadFile(stepPath(*base, provisioner.TemplateFile))
+			if err != nil {
+				log.Fatalf("Could not read template of %s: %s", provisioner.Name, err)
+				return
+			}
+			provisioner.Template = string(template)
+		}
+		problems := gx509.AuditStepCAProvisioner(provisioner, intermediate)
+		if len(problems) == 0 {
+			fmt.Printf("  %s %s: ok\n", provisioner.Type, provisioner.Name)
+			continue
+		}
+		violating++
+		fmt.Printf("  %s %s:\n", provisioner.Type, provisioner.Name)
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\n%d of %d provisioners with problems\n", violating, len(config.Provisioners))
+	if violating > 0 {
+		os.Exit(1)
+	}
+}
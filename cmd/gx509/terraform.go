@@ -0,0 +1,82 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runTerraform(args []string) {
+	flags := flag.NewFlagSet("terraform", flag.ExitOnError)
+	constrained := flags.Bool("constrained", false, "Exit non-zero if any CA that is not self-signed is not technically constrained")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 terraform [flags] file...\n\n")
+		fmt.Fprintf(flags.Output(), "Each file is a Terraform or OpenTofu state file, or the output of show -json for a\n")
+		fmt.Fprintf(flags.Output(), "state or plan. Lints the certificates of tls_self_signed_cert, tls_locally_signed_cert\n")
+		fmt.Fprintf(flags.Output(), "and acme_certificate resources, reports whether each CA is technically constrained,\n")
+		fmt.Fprintf(flags.Output(), "and exits non-zero if any lint of error severity fails.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify the state or plan files to check")
+		return
+	}
+
+	now := time.Now()
+	var count, unconstrained, errors int
+	for _, path := range positional {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", path, err)
+			return
+		}
+		certs, err := gx509.ParseTerraform(data)
+		if err != nil {
+			log.Fatalf("Could not parse %s: %s", path, err)
+			return
+		}
+
+		for _, found := range certs {
+			count++
+			fmt.Printf("%s: %s.%s\n  %s\n", path, found.Address, found.Attribute, certificateLine(found.Cert))
+			if found.Cert.IsCA {
+				analysis := gx509.AnalyzeTechnicalConstraints(found.Cert)
+				if analysis.Constrained {
+					fmt.Printf("  CA; technically constrained\n")
+				} else {
+					fmt.Printf("  CA; not technically constrained: %s\n", analysis.Details())
+					if !bytes.Equal(found.Cert.RawSubject, found.Cert.RawIssuer) {
+						unconstrained++
+					}
+				}
+			}
+
+			report := gx509.Report{Generated: now}
+			report.LintCertificate(path, found.Cert, now)
+			for _, finding := range report.Failures() {
+				fmt.Printf("  %s %s: %s\n", finding.Lint.Severity, finding.Lint.Name, finding.Message)
+				if finding.Lint.Severity == gx509.SeverityError {
+					errors++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%d certificates; %d lints of error severity failed; %d CAs that are not self-signed are not technically constrained\n",
+		count, errors, unconstrained)
+	if errors > 0 || (*constrained && unconstrained > 0) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runVault(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 vault audit [flags]")
+		return
+	}
+
+	switch args[0] {
+	case "audit":
+		runVaultAudit(args[1:])
+	default:
+		log.Fatalf("Unknown vault command: %s", args[0])
+	}
+}
+
+func runVaultAudit(args []string) {
+	flags := flag.NewFlagSet("vault audit", flag.ExitOnError)
+	mount := flags.String("mount", "pki/", "The path the PKI secrets engine is mounted at")
+	address := flags.String("address", os.Getenv("VAULT_ADDR"), "The Vault server; defaults to $VAULT_ADDR")
+	namespace := flags.String("namespace", os.Getenv("VAULT_NAMESPACE"), "The Vault Enterprise namespace; defaults to $VAULT_NAMESPACE")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 vault audit [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Reports whether each issuer of a Vault PKI secrets engine is technically\n")
+		fmt.Fprintf(flags.Output(), "constrained, lints the certificates it has issued, and lists the role settings that\n")
+		fmt.Fprintf(flags.Output(), "would issue certificates violating the issuer's constraints or browser requirements.\n")
+		fmt.Fprintf(flags.Output(), "The token is read from $VAULT_TOKEN. Exits non-zero if there are any such roles.\n")
+		flags.PrintDefaults()
+	}
+	parseInterspersed(flags, args)
+
+	if len(*address) == 0 {
+		log.Fatalf("You must specify the Vault server with -address or $VAULT_ADDR")
+		return
+	}
+	vault := gx509.NewVaultPKI(*address, os.Getenv("VAULT_TOKEN"), *mount)
+	vault.Namespace = *namespace
+
+	issuers, err := vault.Issuers()
+	if err != nil {
+		log.Fatalf("Could not read issuers: %s", err)
+		return
+	}
+	certs, err := vault.Certificates()
+	if err != nil {
+		log.Fatalf("Could not read certificates: %s", err)
+		return
+	}
+	roles, err := vault.Roles()
+	if err != nil {
+		log.Fatalf("Could not read roles: %s", err)
+		return
+	}
+
+	fmt.Printf("Issuers:\n")
+	for _, issuer := range issuers {
+		fmt.Printf("  %s %s\n    %s\n", issuer.ID, issuer.Name, certificateLine(issuer.Cert))
+		if analysis := gx509.AnalyzeTechnicalConstraints(issuer.Cert); analysis.Constrained {
+			fmt.Printf("    technically constrained\n")
+		} else {
+			fmt.Printf("    not technically constrained: %s\n", analysis.Details())
+		}
+	}
+
+	now := time.Now()
+	report := gx509.Report{Generated: now}
+	for _, cert := range certs {
+		report.LintCertificate(*mount, cert, now)
+	}
+	fmt.Printf("\nIssued certificates:\n")
+	for _, finding := range report.Failures() {
+		fmt.Printf("  %s: %s %s: %s\n", finding.Cert.SerialNumber, finding.Lint.Severity, finding.Lint.Name, finding.Message)
+	}
+	fmt.Printf("  %d certificates, %d lints failed\n", len(certs), len(report.Failures()))
+
+	fmt.Printf("\nRoles:\n")
+	violating := 0
+	for _, role := range roles {
+		var issuerCert *x509.Certificate
+		if issuer := role.Issuer(issuers); issuer != nil {
+			issuerCert = issuer.Cert
+		}
+		problems := gx509.AuditVaultRole(role, issuerCert)
+		if len(problems) == 0 {
+			fmt.Printf("  %s: ok\n", role.Name)
+			continue
+		}
+		violating++
+		fmt.Printf("  %s:\n", role.Name)
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\n%d issuers, %d certificates, %d of %d roles with problems\n", len(issuers), len(certs), violating, len(roles))
+	if violating > 0 {
+		os.Exit(1)
+	}
+}
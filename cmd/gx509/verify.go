@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	intermediatesPath := flags.String("intermediates", "", "PEM file or directory of candidate intermediates")
+	rootsPath := flags.String("roots", "system", "PEM file or directory of trusted roots, or \"system\"")
+	at := flags.String("at", "", "Verify as of this RFC 3339 time (default now)")
+	fetch := flags.Bool("fetch-aia", false, "Download missing intermediates from caIssuers URLs")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 verify [flags] leaf.pem\n\n")
+		fmt.Fprintf(flags.Output(), "Builds every chain from the first certificate in leaf.pem, through the rest\n")
+		fmt.Fprintf(flags.Output(), "and any -intermediates, to the roots, and runs RFC 5280 path validation over\n")
+		fmt.Fprintf(flags.Output(), "each. Technically constrained intermediates are marked. Exits non-zero if no\n")
+		fmt.Fprintf(flags.Output(), "chain is valid.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		log.Fatalf("You must specify the path to the leaf .pem file")
+		return
+	}
+
+	certs, err := loadCertificates(positional[0])
+	if err != nil {
+		log.Fatalf("Could not process file %s: %s", positional[0], err)
+		return
+	}
+	leaf, intermediates := certs[0], certs[1:]
+	if len(*intermediatesPath) > 0 {
+		more, err := loadCertificatesFromPath(*intermediatesPath)
+		if err != nil {
+			log.Fatalf("Could not load intermediates from %s: %s", *intermediatesPath, err)
+			return
+		}
+		intermediates = append(intermediates, more...)
+	}
+
+	if *fetch {
+		fetched, err := gx509.FetchMissingIssuers(gx509.NewAIA(aiaTimeout, aiaMaxRedirects), append([]*x509.Certificate{leaf}, intermediates...))
+		if err != nil {
+			log.Printf("Warning: %s", err)
+		}
+		intermediates = append(intermediates, fetched...)
+	}
+
+	roots, err := loadRoots(*rootsPath)
+	if err != nil {
+		log.Fatalf("Could not load roots from %s: %s", *rootsPath, err)
+		return
+	}
+
+	var input gx509.PathValidationInput
+	if len(*at) > 0 {
+		if input.Time, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %s", err)
+			return
+		}
+	}
+
+	verifications := gx509.VerifyChains(leaf, intermediates, roots, input)
+	if len(verifications) == 0 {
+		chain := gx509.PartialChain(leaf, intermediates)
+		for _, cert := range chain {
+			fmt.Printf("%s\n", certificateLine(cert))
+		}
+		last := chain[len(chain)-1]
+		fmt.Printf("No path to a trusted root; missing the issuer of %s (%s)\n", last.Subject.CommonName, last.Issuer.CommonName)
+		os.Exit(1)
+	}
+
+	valid := false
+	for i, verification := range verifications {
+		if i > 0 {
+			fmt.Printf("\n")
+		}
+		fmt.Printf("Chain %d:\n", i+1)
+		for position, cert := range verification.Chain {
+			fmt.Printf("  %s%s\n", certificateLine(cert), constrainedMarker(verification, position))
+		}
+		for _, problem := range verification.Validation.Errors {
+			fmt.Printf("  * %s\n", problem)
+		}
+		if verification.Validation.Valid {
+			fmt.Printf("  The chain is valid\n")
+			valid = true
+		} else {
+			fmt.Printf("  The chain is not valid\n")
+		}
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// constrainedMarker labels the certificate at position in verification's
+// chain if it is a technically constrained intermediate.
+func constrainedMarker(verification gx509.ChainVerification, position int) string {
+	for _, constrained := range verification.Constrained {
+		if constrained == position {
+			return " [technically constrained]"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,321 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// defaultWarehousePath is the warehouse that commands read when none is
+// given.
+func defaultWarehousePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "warehouse.db"
+	}
+	return filepath.Join(dir, "gx509", "warehouse.db")
+}
+
+// addWarehouseFlag registers -warehouse, the path to the warehouse, on
+// flags.
+func addWarehouseFlag(flags *flag.FlagSet) *string {
+	return flags.String("warehouse", defaultWarehousePath(), "Path to the certificate warehouse")
+}
+
+// storeInWarehouse adds the certificates found at each source to the
+// warehouse at path.
+func storeInWarehouse(path string, found map[string][]*x509.Certificate) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	warehouse, err := gx509.OpenWarehouse(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	added := 0
+	for source, certs := range found {
+		for _, cert := range certs {
+			if warehouse.Add(cert, source, now) {
+				added++
+			}
+		}
+	}
+	dropped := warehouse.Compact(warehouse.Retention, now)
+	if err := warehouse.Save(); err != nil {
+		return err
+	}
+	log.Printf("Stored %d new certificates in %s, dropped %d past retention, and it now has %d", added, path, dropped, warehouse.Len())
+	return nil
+}
+
+// storeServerChains is storeInWarehouse for the chains servers presented.
+func storeServerChains(path string, servers []gx509.ServerChain) error {
+	found := make(map[string][]*x509.Certificate)
+	for _, server := range servers {
+		found[server.Address] = append(found[server.Address], server.Certificates...)
+	}
+	return storeInWarehouse(path, found)
+}
+
+func runWarehouse(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gx509 warehouse list|import|retention|compact|trends [flags]")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		runWarehouseList(args[1:])
+	case "import":
+		runWarehouseImport(args[1:])
+	case "retention":
+		runWarehouseRetention(args[1:])
+	case "compact":
+		runWarehouseCompact(args[1:])
+	case "trends":
+		runWarehouseTrends(args[1:])
+	default:
+		log.Fatalf("Unknown warehouse command: %s", args[0])
+	}
+}
+
+// openWarehouse opens the warehouse at path or exits.
+func openWarehouse(path string) *gx509.Warehouse {
+	warehouse, err := gx509.OpenWarehouse(path)
+	if err != nil {
+		log.Fatalf("Could not open warehouse %s: %s", path, err)
+	}
+	return warehouse
+}
+
+func runWarehouseList(args []string) {
+	flags := flag.NewFlagSet("warehouse list", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	source := flags.String("source", "", "Only list certificates found at sources containing this")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 warehouse list [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the certificates that scans run with -store have kept in the warehouse.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	for _, entry := range openWarehouse(*path).Entries() {
+		if len(*source) > 0 && !strings.Contains(strings.Join(entry.Sources, "\n"), *source) {
+			continue
+		}
+		fmt.Printf("%s\n", certificateLine(entry.Certificate))
+		fmt.Printf("  seen %s to %s at %s\n", entry.FirstSeen.Format("2006-01-02"), entry.LastSeen.Format("2006-01-02"),
+			strings.Join(entry.Sources, ", "))
+	}
+}
+
+func runWarehouseImport(args []string) {
+	flags := flag.NewFlagSet("warehouse import", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	summary := flags.Bool("summary", false, "Summarize the issuing CAs of the imported hosts")
+	ownersPath := flags.String("owners", "", "Path to an owner table YAML file for -summary (default the embedded one)")
+	constrained := flags.Bool("constrained", false, "With -summary, exit non-zero if any issuing CA is not technically constrained")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 warehouse import [flags] zgrab2.json...\n\n")
+		fmt.Fprintf(flags.Output(), "Stores the chains recorded by zgrab2 tls or http scans in the warehouse.\n")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) == 0 {
+		log.Fatalf("You must specify zgrab2 output to import")
+		return
+	}
+	var servers []gx509.ServerChain
+	failed := 0
+	for _, input := range positional {
+		file, err := os.Open(input)
+		if err != nil {
+			log.Fatalf("Could not open %s: %s", input, err)
+			return
+		}
+		found, err := gx509.ParseZGrab2(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", input, err)
+			return
+		}
+		for _, server := range found {
+			if server.Err != nil {
+				failed++
+				continue
+			}
+			servers = append(servers, server)
+		}
+	}
+	fmt.Printf("Read %d chains, skipping %d hosts without one\n", len(servers), failed)
+
+	if err := storeServerChains(*path, servers); err != nil {
+		log.Fatalf("Could not store certificates: %s", err)
+		return
+	}
+
+	if *summary {
+		table, err := loadOwnerTable(*ownersPath)
+		if err != nil {
+			log.Fatalf("Could not load owner table: %s", err)
+			return
+		}
+		fmt.Printf("\n")
+		if printExposures(servers, gx509.SummarizeCAExposure(servers, table), *constrained) > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+// addRetentionFlags registers the flags that describe a retention policy
+// on flags, to be applied with applyRetentionFlags.
+func addRetentionFlags(flags *flag.FlagSet) *gx509.RetentionPolicy {
+	var policy gx509.RetentionPolicy
+	flags.IntVar(&policy.ExpiredDays, "expired-days", 0, "Drop certificates expired for more than this many days, or 0 to keep them")
+	flags.IntVar(&policy.UnseenDays, "unseen-days", 0, "Drop certificates not seen for more than this many days, or 0 to keep them")
+	flags.BoolVar(&policy.KeepCAs, "keep-cas", false, "Only drop end-entity certificates, keeping CA certificates")
+	return &policy
+}
+
+// applyRetentionFlags changes policy to the values of the retention flags
+// given on the command line, and reports whether there were any.
+func applyRetentionFlags(flags *flag.FlagSet, requested gx509.RetentionPolicy, policy *gx509.RetentionPolicy) bool {
+	changed := false
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "expired-days":
+			policy.ExpiredDays = requested.ExpiredDays
+		case "unseen-days":
+			policy.UnseenDays = requested.UnseenDays
+		case "keep-cas":
+			policy.KeepCAs = requested.KeepCAs
+		default:
+			return
+		}
+		changed = true
+	})
+	return changed
+}
+
+func describeRetention(policy gx509.RetentionPolicy) string {
+	var rules []string
+	if policy.ExpiredDays > 0 {
+		rules = append(rules, fmt.Sprintf("expired for over %d days", policy.ExpiredDays))
+	}
+	if policy.UnseenDays > 0 {
+		rules = append(rules, fmt.Sprintf("unseen for over %d days", policy.UnseenDays))
+	}
+	if len(rules) == 0 {
+		return "keep everything"
+	}
+	description := "drop certificates " + strings.Join(rules, " or ")
+	if policy.KeepCAs {
+		description += ", except CAs"
+	}
+	return description
+}
+
+func runWarehouseRetention(args []string) {
+	flags := flag.NewFlagSet("warehouse retention", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	requested := addRetentionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 warehouse retention [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Shows or changes the retention policy that scans apply each time they store\n")
+		fmt.Fprintf(flags.Output(), "certificates in the warehouse.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	warehouse := openWarehouse(*path)
+	if applyRetentionFlags(flags, *requested, &warehouse.Retention) {
+		if err := os.MkdirAll(filepath.Dir(*path), 0755); err != nil {
+			log.Fatalf("Could not create %s: %s", filepath.Dir(*path), err)
+			return
+		}
+		if err := warehouse.Save(); err != nil {
+			log.Fatalf("Could not save warehouse %s: %s", *path, err)
+			return
+		}
+	}
+	fmt.Printf("%s: %s\n", *path, describeRetention(warehouse.Retention))
+}
+
+func runWarehouseCompact(args []string) {
+	flags := flag.NewFlagSet("warehouse compact", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	dryRun := flags.Bool("n", false, "Only report what would be dropped")
+	requested := addRetentionFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 warehouse compact [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Drops the certificates that the retention policy, with any changes the flags\n")
+		fmt.Fprintf(flags.Output(), "make for this run, does not keep, and rewrites the warehouse.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	warehouse := openWarehouse(*path)
+	policy := warehouse.Retention
+	applyRetentionFlags(flags, *requested, &policy)
+
+	before := warehouse.Len()
+	dropped := warehouse.Compact(policy, time.Now().UTC())
+	fmt.Printf("%s: %s; dropping %d of %d certificates\n", *path, describeRetention(policy), dropped, before)
+	if *dryRun || dropped == 0 {
+		return
+	}
+	if err := warehouse.Save(); err != nil {
+		log.Fatalf("Could not save warehouse %s: %s", *path, err)
+		return
+	}
+}
+
+func runWarehouseTrends(args []string) {
+	flags := flag.NewFlagSet("warehouse trends", flag.ExitOnError)
+	path := addWarehouseFlag(flags)
+	within := flags.Int("within", 30, "Count certificates expiring within this many days of each scan")
+	svgPath := flags.String("svg", "", "Also chart the trends as SVG in this file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gx509 warehouse trends [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Writes, as a JSON series, how many unconstrained intermediates, weak keys and\n")
+		fmt.Fprintf(flags.Output(), "expiring certificates the warehouse held at the time of each scan.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	points := openWarehouse(*path).Trends(time.Duration(*within) * 24 * time.Hour)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(points); err != nil {
+		log.Fatalf("Could not write trends: %s", err)
+		return
+	}
+
+	if len(*svgPath) > 0 {
+		out, err := os.Create(*svgPath)
+		if err != nil {
+			log.Fatalf("Could not create %s: %s", *svgPath, err)
+			return
+		}
+		defer out.Close()
+		if err := gx509.WriteTrendSVG(out, points); err != nil {
+			log.Fatalf("Could not write %s: %s", *svgPath, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command libgx509 is the constraint analysis as a C shared library, so
+// tooling in other languages can reach the same verdicts. Build it with
+//
+//	go build -buildmode=c-shared -o libgx509.so ./cmd/libgx509
+//
+// which also writes libgx509.h. The library exports:
+//
+//	int AnalysisABIVersion(void);
+//	char *AnalyzeCertificate(unsigned char *der, int length);
+//	char *LintCertificate(unsigned char *der, int length);
+//	char *VerifyChain(unsigned char *leaf, int leafLength,
+//		unsigned char *intermediates, int intermediatesLength,
+//		unsigned char *roots, int rootsLength);
+//	void FreeAnalysis(char *analysis);
+//
+// Each returns a JSON object, with an "error" saying why if there is no
+// result. AnalyzeCertificate's "certificate" is the analysis as gx509 -json
+// writes it, LintCertificate's "findings" are the outcomes of the lints, and
+// VerifyChain's "chains" are those VerifyChains finds from the DER leaf
+// through the PEM or DER intermediates to the roots. The caller owns the
+// string and must release it with FreeAnalysis. The gx509 Python package in
+// python/ wraps the library; by hand, for example:
+//
+//	lib = ctypes.CDLL("./libgx509.so")
+//	lib.AnalyzeCertificate.restype = ctypes.c_void_p
+//	lib.FreeAnalysis.argtypes = [ctypes.c_void_p]
+//	p = lib.AnalyzeCertificate(der, len(der))
+//	result = json.loads(ctypes.string_at(p))
+//	lib.FreeAnalysis(p)
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/jcjones/gx509/gx509"
+)
+
+// abiVersion changes whenever an exported signature, or the shape of the
+// JSON, changes incompatibly. Functions and fields may be added without
+// changing it.
+const abiVersion = 1
+
+// An analyzeResponse is what AnalyzeCertificate returns, as JSON.
+type analyzeResponse struct {
+	Certificate *gx509.ConstraintResult `json:"certificate,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+}
+
+// analyzeDER analyzes the DER certificate der.
+func analyzeDER(der []byte) analyzeResponse {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return analyzeResponse{Error: fmt.Sprintf("Could not parse certificate: %s", err)}
+	}
+	result := gx509.NewConstraintResult("", cert, gx509.AnalyzeTechnicalConstraints(cert))
+	return analyzeResponse{Certificate: &result}
+}
+
+// A lintFinding is the outcome of one lint, as LintCertificate returns it.
+type lintFinding struct {
+	Lint     string `json:"lint"`
+	Severity string `json:"severity"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message"`
+}
+
+// A lintResponse is what LintCertificate returns, as JSON.
+type lintResponse struct {
+	Findings []lintFinding `json:"findings,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// lintDER runs the lints on the DER certificate der as of now.
+func lintDER(der []byte) lintResponse {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return lintResponse{Error: fmt.Sprintf("Could not parse certificate: %s", err)}
+	}
+	report := gx509.Report{Generated: time.Now()}
+	report.LintCertificate("", cert, report.Generated)
+	response := lintResponse{Findings: []lintFinding{}}
+	for _, finding := range report.Findings {
+		response.Findings = append(response.Findings, lintFinding{
+			Lint:     finding.Lint.Name,
+			Severity: finding.Lint.Severity.String(),
+			Passed:   finding.Passed,
+			Message:  finding.Message,
+		})
+	}
+	return response
+}
+
+// A chainCertificate identifies a certificate in a chain.
+type chainCertificate struct {
+	Fingerprint string `json:"fingerprint"`
+	Subject     string `json:"subject"`
+	// Constrained is whether the certificate is a technically constrained
+	// intermediate.
+	Constrained bool `json:"constrained"`
+}
+
+// A chainResult is a chain VerifyChain found, leaf first.
+type chainResult struct {
+	Certificates []chainCertificate `json:"certificates"`
+	Valid        bool               `json:"valid"`
+	Errors       []string           `json:"errors"`
+}
+
+// A verifyResponse is what VerifyChain returns, as JSON.
+type verifyResponse struct {
+	Chains []chainResult `json:"chains"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// verifyChain builds and validates chains from the DER leaf through the
+// certificates in intermediates, which may be empty, to those in roots.
+func verifyChain(leafDER, intermediatesData, rootsData []byte) verifyResponse {
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		return verifyResponse{Error: fmt.Sprintf("Could not parse certificate: %s", err)}
+	}
+	var intermediates []*x509.Certificate
+	if len(intermediatesData) > 0 {
+		if intermediates, err = gx509.ParseCertificatesFromBytes(intermediatesData); err != nil {
+			return verifyResponse{Error: fmt.Sprintf("Could not parse intermediates: %s", err)}
+		}
+	}
+	roots, err := gx509.ParseCertificatesFromBytes(rootsData)
+	if err != nil {
+		return verifyResponse{Error: fmt.Sprintf("Could not parse roots: %s", err)}
+	}
+
+	response := verifyResponse{Chains: []chainResult{}}
+	for _, verification := range gx509.VerifyChains(leaf, intermediates, roots, gx509.PathValidationInput{}) {
+		result := chainResult{Valid: verification.Validation.Valid, Errors: append([]string{}, verification.Validation.Errors...)}
+		for _, cert := range verification.Chain {
+			result.Certificates = append(result.Certificates, chainCertificate{
+				Fingerprint: fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+				Subject:     cert.Subject.String(),
+			})
+		}
+		for _, position := range verification.Constrained {
+			result.Certificates[position].Constrained = true
+		}
+		response.Chains = append(response.Chains, result)
+	}
+	return response
+}
+
+// goBytes copies length bytes from data, or returns nil if there are none.
+func goBytes(data *C.uchar, length C.int) []byte {
+	if data == nil || length <= 0 {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(data), length)
+}
+
+// encode returns response as a JSON C string, which the caller must free.
+func encode(response interface{}) *C.char {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return C.CString(string(encoded))
+}
+
+//export AnalysisABIVersion
+func AnalysisABIVersion() C.int {
+	return abiVersion
+}
+
+//export AnalyzeCertificate
+func AnalyzeCertificate(der *C.uchar, length C.int) *C.char {
+	return encode(analyzeDER(goBytes(der, length)))
+}
+
+//export LintCertificate
+func LintCertificate(der *C.uchar, length C.int) *C.char {
+	return encode(lintDER(goBytes(der, length)))
+}
+
+//export VerifyChain
+func VerifyChain(leaf *C.uchar, leafLength C.int, intermediates *C.uchar, intermediatesLength C.int, roots *C.uchar, rootsLength C.int) *C.char {
+	return encode(verifyChain(goBytes(leaf, leafLength), goBytes(intermediates, intermediatesLength), goBytes(roots, rootsLength)))
+}
+
+//export FreeAnalysis
+func FreeAnalysis(analysis *C.char) {
+	C.free(unsafe.Pointer(analysis))
+}
+
+// main is required of a c-shared build, but never runs.
+func main() {}
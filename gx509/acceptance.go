@@ -0,0 +1,305 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The checks reported for each client, in the order they are reported.
+const (
+	CheckChain      = "chain"
+	CheckValidity   = "validity"
+	CheckKeyUsage   = "eku"
+	CheckNames      = "names"
+	CheckAlgorithms = "algorithms"
+)
+
+// Checks lists every check in a ClientVerdict.
+var Checks = []string{CheckChain, CheckValidity, CheckKeyUsage, CheckNames, CheckAlgorithms}
+
+// A CheckOutcome is one cell of the acceptance matrix.
+type CheckOutcome struct {
+	Check   string
+	Passed  bool
+	Reasons []string
+}
+
+// A ClientVerdict is the predicted outcome of one client verifying a chain.
+type ClientVerdict struct {
+	Client   string
+	Accepted bool
+	Checks   []CheckOutcome
+}
+
+func newClientVerdict(client string) ClientVerdict {
+	verdict := ClientVerdict{Client: client, Accepted: true}
+	for _, check := range Checks {
+		verdict.Checks = append(verdict.Checks, CheckOutcome{Check: check, Passed: true})
+	}
+	return verdict
+}
+
+// Outcome returns the result of the named check.
+func (v *ClientVerdict) Outcome(check string) *CheckOutcome {
+	for i := range v.Checks {
+		if v.Checks[i].Check == check {
+			return &v.Checks[i]
+		}
+	}
+	v.Checks = append(v.Checks, CheckOutcome{Check: check, Passed: true})
+	return &v.Checks[len(v.Checks)-1]
+}
+
+// Reasons returns the reasons from every check, prefixed with the check name.
+func (v ClientVerdict) Reasons() []string {
+	var reasons []string
+	for _, outcome := range v.Checks {
+		for _, reason := range outcome.Reasons {
+			reasons = append(reasons, outcome.Check+": "+reason)
+		}
+	}
+	return reasons
+}
+
+func (v *ClientVerdict) reject(check, format string, args ...interface{}) {
+	outcome := v.Outcome(check)
+	outcome.Passed = false
+	outcome.Reasons = append(outcome.Reasons, fmt.Sprintf(format, args...))
+	v.Accepted = false
+}
+
+func (v *ClientVerdict) note(check, format string, args ...interface{}) {
+	outcome := v.Outcome(check)
+	outcome.Reasons = append(outcome.Reasons, fmt.Sprintf(format, args...))
+}
+
+// AcceptanceMatrix predicts whether each client in DefaultKnowledgeBase would
+// accept chain for TLS server authentication at the given time. chain[0] is
+// the leaf and each following certificate must be the issuer of the one
+// before it. If the last certificate is self-signed it is treated as the
+// trust anchor.
+func AcceptanceMatrix(chain []*x509.Certificate, at time.Time) []ClientVerdict {
+	return DefaultKnowledgeBase.AcceptanceMatrix(chain, at)
+}
+
+// AcceptanceMatrix is like the package-level AcceptanceMatrix, but uses the
+// clients in kb.
+func (kb *KnowledgeBase) AcceptanceMatrix(chain []*x509.Certificate, at time.Time) []ClientVerdict {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	leaf := leafProfileFromCertificate(chain[0])
+	verdicts := make([]ClientVerdict, 0, len(kb.Clients))
+	for _, client := range kb.Clients {
+		verdict := evaluateChain(client, leaf, chain[1:], at)
+		checkSignatures(&verdict, chain)
+		checkAlgorithms(&verdict, client, chain)
+		verdicts = append(verdicts, verdict)
+	}
+	return verdicts
+}
+
+func leafProfileFromCertificate(cert *x509.Certificate) LeafProfile {
+	return LeafProfile{
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		IPAddresses: cert.IPAddresses,
+		ExtKeyUsage: cert.ExtKeyUsage,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+	}
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// evaluateChain applies the behaviors of client to a leaf issued beneath
+// issuers, ordered from the leaf's issuer upwards.
+func evaluateChain(client ClientBehavior, leaf LeafProfile, issuers []*x509.Certificate, at time.Time) ClientVerdict {
+	verdict := newClientVerdict(client.Name)
+
+	if at.Before(leaf.NotBefore) || at.After(leaf.NotAfter) {
+		verdict.reject(CheckValidity, "leaf is not valid at %s", at.Format(time.RFC3339))
+	}
+	checkValidity(&verdict, client, leaf)
+	checkLeafExtKeyUsage(&verdict, client, leaf)
+
+	for _, issuer := range issuers {
+		name := issuer.Subject.CommonName
+
+		if !issuer.BasicConstraintsValid || !issuer.IsCA {
+			verdict.reject(CheckChain, "%s is not a CA", name)
+		}
+
+		if at.Before(issuer.NotBefore) || at.After(issuer.NotAfter) {
+			verdict.reject(CheckValidity, "%s is not valid at %s", name, at.Format(time.RFC3339))
+		} else if leaf.NotAfter.After(issuer.NotAfter) {
+			verdict.note(CheckValidity, "leaf outlives %s; chain fails after %s",
+				name, issuer.NotAfter.Format(time.RFC3339))
+		}
+
+		checkIssuerExtKeyUsage(&verdict, client, issuer)
+		checkNames(&verdict, client, issuer, leaf)
+	}
+
+	return verdict
+}
+
+func checkValidity(verdict *ClientVerdict, client ClientBehavior, leaf LeafProfile) {
+	maxDays, ok := client.maxLeafValidityAt(leaf.NotBefore)
+	if !ok {
+		return
+	}
+	days := int(leaf.NotAfter.Sub(leaf.NotBefore).Hours() / 24)
+	if days > maxDays {
+		verdict.reject(CheckValidity, "leaf lifetime of %d days exceeds the %d day limit", days, maxDays)
+	}
+}
+
+func checkLeafExtKeyUsage(verdict *ClientVerdict, client ClientBehavior, leaf LeafProfile) {
+	if len(leaf.ExtKeyUsage) == 0 {
+		if client.RequiresLeafServerAuthEKU {
+			verdict.reject(CheckKeyUsage, "leaf has no extendedKeyUsage; serverAuth is required")
+		}
+	} else if !hasExtKeyUsage(leaf.ExtKeyUsage, x509.ExtKeyUsageServerAuth) &&
+		!hasExtKeyUsage(leaf.ExtKeyUsage, x509.ExtKeyUsageAny) {
+		verdict.reject(CheckKeyUsage, "leaf extendedKeyUsage does not include serverAuth")
+	}
+}
+
+func checkIssuerExtKeyUsage(verdict *ClientVerdict, client ClientBehavior, issuer *x509.Certificate) {
+	if !client.EnforcesEKUChaining || len(issuer.ExtKeyUsage) == 0 {
+		return
+	}
+	if hasExtKeyUsage(issuer.ExtKeyUsage, x509.ExtKeyUsageServerAuth) ||
+		hasExtKeyUsage(issuer.ExtKeyUsage, x509.ExtKeyUsageAny) {
+		return
+	}
+	name := issuer.Subject.CommonName
+	if client.StepUpAsServerAuth &&
+		hasExtKeyUsage(issuer.ExtKeyUsage, x509.ExtKeyUsageNetscapeServerGatedCrypto) &&
+		issuer.NotBefore.Before(nsSGCCutoff) {
+		verdict.note(CheckKeyUsage, "%s id-Netscape-stepUp treated as serverAuth", name)
+		return
+	}
+	verdict.reject(CheckKeyUsage, "%s extendedKeyUsage does not permit serverAuth", name)
+}
+
+func checkNames(verdict *ClientVerdict, client ClientBehavior, issuer *x509.Certificate, leaf LeafProfile) {
+	name := issuer.Subject.CommonName
+
+	if client.RejectsLeadingDotConstraint {
+		for _, constraints := range [][]string{issuer.PermittedDNSDomains, issuer.ExcludedDNSDomains} {
+			for _, constraint := range constraints {
+				if strings.HasPrefix(constraint, ".") {
+					verdict.reject(CheckNames, "%s dNSName constraint %q has a leading dot", name, constraint)
+					return
+				}
+			}
+		}
+	}
+
+	for _, dnsName := range leaf.DNSNames {
+		if !dnsNamePermitted(issuer, dnsName, client.LeadingDotSubdomainsOnly) {
+			verdict.reject(CheckNames, "dNSName %s violates the name constraints of %s", dnsName, name)
+		}
+	}
+
+	for _, ip := range leaf.IPAddresses {
+		if !ipAddressPermitted(issuer, ip) {
+			if client.EnforcesIPConstraints {
+				verdict.reject(CheckNames, "iPAddress %s violates the name constraints of %s", ip, name)
+			} else {
+				verdict.note(CheckNames, "iPAddress %s violates the name constraints of %s, but they are not enforced", ip, name)
+			}
+		}
+	}
+
+	if len(leaf.DNSNames) > 0 || len(leaf.IPAddresses) > 0 {
+		return
+	}
+	if !client.CommonNameFallback {
+		if !verdict.hasReason(CheckNames, reasonNoSubjectAltName) {
+			verdict.reject(CheckNames, reasonNoSubjectAltName)
+		}
+		return
+	}
+	if client.ConstrainsCommonName && looksLikeHostname(leaf.CommonName) &&
+		!dnsNamePermitted(issuer, leaf.CommonName, client.LeadingDotSubdomainsOnly) {
+		verdict.reject(CheckNames, "commonName %s violates the name constraints of %s", leaf.CommonName, name)
+	} else if len(issuer.PermittedDNSDomains) > 0 && !client.ConstrainsCommonName {
+		verdict.note(CheckNames, "commonName %s is matched without applying the name constraints of %s", leaf.CommonName, name)
+	}
+}
+
+const reasonNoSubjectAltName = "leaf has no subjectAltName and commonName is ignored"
+
+func (v *ClientVerdict) hasReason(check, reason string) bool {
+	for _, existing := range v.Outcome(check).Reasons {
+		if existing == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignatures verifies that each certificate in chain was issued and
+// signed by the next one.
+func checkSignatures(verdict *ClientVerdict, chain []*x509.Certificate) {
+	for i := 0; i+1 < len(chain); i++ {
+		if !bytes.Equal(chain[i].RawIssuer, chain[i+1].RawSubject) {
+			verdict.reject(CheckChain, "%s was not issued by %s",
+				chain[i].Subject.CommonName, chain[i+1].Subject.CommonName)
+		} else if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			verdict.reject(CheckChain, "%s is not signed by %s: %s",
+				chain[i].Subject.CommonName, chain[i+1].Subject.CommonName, err)
+		}
+	}
+
+	last := chain[len(chain)-1]
+	if !isSelfSigned(last) {
+		verdict.note(CheckChain, "%s is not self-signed; its issuer must be a trusted root",
+			last.Subject.CommonName)
+	}
+}
+
+func checkAlgorithms(verdict *ClientVerdict, client ClientBehavior, chain []*x509.Certificate) {
+	for i, cert := range chain {
+		name := cert.Subject.CommonName
+
+		// The signature on a trust anchor is never checked.
+		if i != len(chain)-1 || !isSelfSigned(cert) {
+			for _, rejected := range client.RejectedSignatureAlgorithms {
+				if cert.SignatureAlgorithm == rejected {
+					verdict.reject(CheckAlgorithms, "%s is signed with %s", name, rejected)
+				}
+			}
+		}
+
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && client.MinRSAKeyBits > 0 {
+			if bits := key.N.BitLen(); bits < client.MinRSAKeyBits {
+				verdict.reject(CheckAlgorithms, "%s has a %d-bit RSA key; at least %d bits are required",
+					name, bits, client.MinRSAKeyBits)
+			}
+		}
+	}
+}
+
+func hasExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, candidate := range usages {
+		if candidate == usage {
+			return true
+		}
+	}
+	return false
+}
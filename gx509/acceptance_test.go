@@ -0,0 +1,139 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// issueAndParse signs template with the test key as if issued by parent and
+// returns a parsed version of it.
+func issueAndParse(t *testing.T, template, parent *x509.Certificate) *x509.Certificate {
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parent, &testPrivateKey.PublicKey, testPrivateKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+		return nil
+	}
+
+	return cert
+}
+
+func testChain(t *testing.T, leafNames ...string) []*x509.Certificate {
+	root := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co Root",
+		},
+		NotBefore: time.Date(2009, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2029, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+
+	intermediate := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co Issuing CA",
+		},
+		NotBefore: time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2027, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"example.com"},
+	}, root)
+
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject: pkix.Name{
+			CommonName: leafNames[0],
+		},
+		NotBefore: time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    leafNames,
+	}, intermediate)
+
+	return []*x509.Certificate{leaf, intermediate, root}
+}
+
+func checkOutcome(t *testing.T, verdict ClientVerdict, check string, expected bool) {
+	outcome := verdict.Outcome(check)
+	if outcome.Passed != expected {
+		t.Errorf("%s %s: expected passed=%v, got %v. Reasons: %v",
+			verdict.Client, check, expected, outcome.Passed, outcome.Reasons)
+	}
+}
+
+func TestAcceptanceMatrix(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	verdicts := AcceptanceMatrix(chain, at)
+
+	if len(verdicts) != len(DefaultKnowledgeBase.Clients) {
+		t.Fatalf("Expected %d verdicts, got %d", len(DefaultKnowledgeBase.Clients), len(verdicts))
+	}
+
+	for _, verdict := range verdicts {
+		checkOutcome(t, verdict, CheckChain, true)
+		checkOutcome(t, verdict, CheckValidity, true)
+		checkOutcome(t, verdict, CheckKeyUsage, true)
+		checkOutcome(t, verdict, CheckNames, true)
+		// The test key is only 512 bits
+		checkOutcome(t, verdict, CheckAlgorithms, false)
+	}
+}
+
+func TestAcceptanceMatrixNameViolation(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.org")
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, verdict := range AcceptanceMatrix(chain, at) {
+		checkOutcome(t, verdict, CheckNames, false)
+	}
+}
+
+func TestAcceptanceMatrixExpired(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2019, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, verdict := range AcceptanceMatrix(chain, at) {
+		checkOutcome(t, verdict, CheckValidity, false)
+	}
+}
+
+func TestAcceptanceMatrixBrokenChain(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	other := testChain(t, "www.example.com")
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	// Swap in an intermediate that did not sign the leaf
+	chain[1] = other[2]
+	for _, verdict := range AcceptanceMatrix(chain, at) {
+		checkOutcome(t, verdict, CheckChain, false)
+	}
+}
@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxAIAResponse is the most an AIA download may be; an issuer certificate,
+// or a PKCS#7 bundle of a few, is far smaller.
+const maxAIAResponse = 1 << 20
+
+// AIA downloads the issuers named by the caIssuers URLs in the Authority
+// Information Access extension of certificates.
+type AIA struct {
+	Client *http.Client
+}
+
+// NewAIA returns an AIA fetcher whose downloads give up after timeout and
+// follow at most maxRedirects redirects.
+func NewAIA(timeout time.Duration, maxRedirects int) *AIA {
+	return &AIA{
+		Client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("Stopped after %d redirects", maxRedirects)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// fetch downloads the certificates at url, which is DER, PEM or a PKCS#7
+// bundle.
+func (a *AIA) fetch(url string) ([]*x509.Certificate, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("Unsupported caIssuers URL %s", url)
+	}
+	resp, err := a.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAIAResponse+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxAIAResponse {
+		return nil, fmt.Errorf("%s returned more than %d bytes", url, maxAIAResponse)
+	}
+	certs, err := ParseCertificatesFromBytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", url, err)
+	}
+	return certs, nil
+}
+
+// IssuerCandidates returns the certificates at cert's caIssuers URLs that
+// issued it.
+func (a *AIA) IssuerCandidates(cert *x509.Certificate) ([]*x509.Certificate, error) {
+	var issuers []*x509.Certificate
+	for _, url := range cert.IssuingCertificateURL {
+		certs, err := a.fetch(url)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range FindIssuers(cert, certs) {
+			if !containsCertificate(issuers, candidate) {
+				issuers = append(issuers, candidate)
+			}
+		}
+	}
+	return issuers, nil
+}
+
+// FetchMissingIssuers asks source for the issuer of each certificate in
+// certs whose issuer is not also in certs, and then for the issuers of those
+// in turn, until it reaches self-signed roots, certificates it cannot find
+// the issuer of, or the longest chain it will consider. It returns the
+// issuers it found, and an error for the first certificate whose issuer
+// source failed.
+func FetchMissingIssuers(source IssuerSource, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	all := append([]*x509.Certificate{}, certs...)
+	var fetched []*x509.Certificate
+	var firstErr error
+	for _, cert := range certs {
+		for depth := 0; depth < maxChainLength; depth++ {
+			if isSelfSigned(cert) || len(FindIssuers(cert, all)) > 0 {
+				break
+			}
+			issuers, err := source.IssuerCandidates(cert)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("Could not fetch the issuer of %s: %s", cert.Subject.CommonName, err)
+				}
+				break
+			}
+			if len(issuers) == 0 {
+				break
+			}
+			all = append(all, issuers[0])
+			fetched = append(fetched, issuers[0])
+			cert = issuers[0]
+		}
+	}
+	return fetched, firstErr
+}
@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchMissingIssuers(t *testing.T) {
+	t.Parallel()
+
+	var root, intermediate *x509.Certificate
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/root.crt":
+			w.Write(root.Raw)
+		case "/old-root.crt":
+			http.Redirect(w, r, "/root.crt", http.StatusMovedPermanently)
+		case "/loop.crt":
+			http.Redirect(w, r, "/loop.crt", http.StatusFound)
+		case "/intermediate.crt":
+			w.Write(intermediate.Raw)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer repository.Close()
+
+	notAfter := time.Date(2029, time.January, 1, 0, 0, 0, 0, time.UTC)
+	root = testCA(t, "AIA Root", nil, notAfter)
+	intermediate = issueAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "AIA Intermediate"},
+		NotBefore:             root.NotBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IssuingCertificateURL: []string{repository.URL + "/old-root.crt"},
+	}, root)
+	leaf := func(serial int64, url string) *x509.Certificate {
+		return issueAndParse(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "www.example.com"},
+			NotBefore:             root.NotBefore,
+			NotAfter:              notAfter,
+			DNSNames:              []string{"www.example.com"},
+			IssuingCertificateURL: []string{repository.URL + url},
+		}, intermediate)
+	}
+
+	aia := NewAIA(5*time.Second, 1)
+	fetched, err := FetchMissingIssuers(aia, []*x509.Certificate{leaf(3, "/intermediate.crt")})
+	if err != nil {
+		t.Fatalf("Could not fetch issuers: %s", err)
+	}
+	checkChainNames(t, fetched, "AIA Intermediate", "AIA Root")
+
+	// Supplied issuers are not fetched again
+	fetched, err = FetchMissingIssuers(aia, []*x509.Certificate{leaf(4, "/intermediate.crt"), intermediate})
+	if err != nil {
+		t.Fatalf("Could not fetch issuers: %s", err)
+	}
+	checkChainNames(t, fetched, "AIA Root")
+
+	for _, url := range []string{"/missing.crt", "/loop.crt"} {
+		if fetched, err := FetchMissingIssuers(aia, []*x509.Certificate{leaf(5, url)}); err == nil || len(fetched) != 0 {
+			t.Errorf("Expected fetching %s to fail, got %d certificates", url, len(fetched))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// An Alert is something a scheduled scan found that needs attention.
+type Alert struct {
+	Job  string    `json:"job"`
+	Time time.Time `json:"time"`
+	// Source is where the scan found it: a path, an endpoint or a CT search.
+	Source string `json:"source"`
+	// Subject and Fingerprint identify the certificate, if the alert is
+	// about one.
+	Subject     string `json:"subject,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Message     string `json:"message"`
+}
+
+// CertificateAlerts returns the alerts about cert, which job found at
+// source, as of at: that it is an intermediate not technically constrained,
+// if it is new, and that it has expired or will within warning.
+func CertificateAlerts(job, source string, cert *x509.Certificate, isNew bool, at time.Time, warning time.Duration) []Alert {
+	alert := Alert{
+		Job:         job,
+		Time:        at,
+		Source:      source,
+		Subject:     cert.Subject.CommonName,
+		Fingerprint: fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+	}
+	var alerts []Alert
+	if isNew && cert.IsCA && !isSelfSigned(cert) {
+		if analysis := AnalyzeTechnicalConstraints(cert); !analysis.Constrained {
+			alert.Message = "New intermediate is not technically constrained"
+			if len(analysis.Reasons) > 0 {
+				alert.Message += ": " + analysis.Reasons[0].String()
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	switch {
+	case at.After(cert.NotAfter):
+		alert.Message = fmt.Sprintf("Expired on %s", cert.NotAfter.Format("2006-01-02"))
+		alerts = append(alerts, alert)
+	case at.Add(warning).After(cert.NotAfter):
+		alert.Message = fmt.Sprintf("Expires on %s", cert.NotAfter.Format("2006-01-02"))
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// An AlertSink delivers alerts.
+type AlertSink interface {
+	Send(alerts []Alert) error
+}
+
+// A WebhookSink POSTs alerts to a URL as a JSON array.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Send(alerts []Alert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// A FileSink appends alerts to a file as lines of JSON.
+type FileSink struct {
+	Path string
+}
+
+func (s *FileSink) Send(alerts []Alert) error {
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, alert := range alerts {
+		if err := encoder.Encode(alert); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func alertMessages(alerts []Alert) []string {
+	var messages []string
+	for _, alert := range alerts {
+		messages = append(messages, alert.Message)
+	}
+	return messages
+}
+
+func TestCertificateAlerts(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := chain[0].NotAfter.Add(-10 * 24 * time.Hour)
+	warning := 30 * 24 * time.Hour
+
+	alerts := CertificateAlerts("edge", "www.example.com:443", chain[0], true, at, warning)
+	if len(alerts) != 1 || !strings.HasPrefix(alerts[0].Message, "Expires on ") || alerts[0].Job != "edge" || alerts[0].Subject != "www.example.com" {
+		t.Errorf("Expected an expiry alert, got %+v", alerts)
+	}
+	if alerts := CertificateAlerts("edge", "www.example.com:443", chain[0], true, chain[0].NotAfter.Add(time.Hour), warning); len(alerts) != 1 || !strings.HasPrefix(alerts[0].Message, "Expired on ") {
+		t.Errorf("Expected an expired alert, got %v", alertMessages(alerts))
+	}
+	if alerts := CertificateAlerts("edge", "www.example.com:443", chain[0], true, chain[0].NotBefore, warning); len(alerts) != 0 {
+		t.Errorf("Expected no alerts, got %v", alertMessages(alerts))
+	}
+
+	intermediateAt := chain[1].NotBefore
+	expected := []string{"New intermediate is not technically constrained: " + AnalyzeTechnicalConstraints(chain[1]).Reasons[0].String()}
+	if messages := alertMessages(CertificateAlerts("pki", "/srv/pki/int.pem", chain[1], true, intermediateAt, warning)); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Expected %v, got %v", expected, messages)
+	}
+	if alerts := CertificateAlerts("pki", "/srv/pki/int.pem", chain[1], false, intermediateAt, warning); len(alerts) != 0 {
+		t.Errorf("Expected no alert for an intermediate seen before, got %v", alertMessages(alerts))
+	}
+	if alerts := CertificateAlerts("pki", "/srv/pki/root.pem", chain[2], true, chain[2].NotBefore, warning); len(alerts) != 0 {
+		t.Errorf("Expected no alert for a root, got %v", alertMessages(alerts))
+	}
+}
+
+func TestAlertSinks(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{
+		{Job: "edge", Time: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), Source: "www.example.com:443", Message: "Expires on 2020-01-10"},
+		{Job: "edge", Time: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), Source: "mail.example.com:443", Message: "Expires on 2020-01-20"},
+	}
+
+	var received []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	if err := (&WebhookSink{URL: server.URL + "/", Client: server.Client()}).Send(alerts); err != nil {
+		t.Fatalf("Could not send alerts: %s", err)
+	}
+	if !reflect.DeepEqual(received, alerts) {
+		t.Errorf("Expected %+v, got %+v", alerts, received)
+	}
+	if err := (&WebhookSink{URL: server.URL + "/missing", Client: server.Client()}).Send(alerts); err == nil {
+		t.Errorf("Expected a webhook answering 404 to fail")
+	}
+
+	dir, err := ioutil.TempDir("", "gx509-alerts")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	sink := &FileSink{Path: filepath.Join(dir, "alerts.jsonl")}
+	if err := sink.Send(alerts[:1]); err != nil {
+		t.Fatalf("Could not write alerts: %s", err)
+	}
+	if err := sink.Send(alerts[1:]); err != nil {
+		t.Fatalf("Could not write alerts: %s", err)
+	}
+	data, err := ioutil.ReadFile(sink.Path)
+	if err != nil {
+		t.Fatalf("Could not read alerts: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "mail.example.com") {
+		t.Errorf("Expected two lines of alerts, got %q", data)
+	}
+}
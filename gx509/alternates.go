@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+// A RankedChain is a viable chain along with the clients predicted to accept
+// it and the technical constraint status of its intermediates.
+type RankedChain struct {
+	Chain    []*x509.Certificate
+	Accepted []string
+	Rejected []string
+	// Constrained is true if at least one intermediate in the chain is
+	// technically constrained.
+	Constrained bool
+}
+
+// FindAlternateChains asks source for every issuer of leaf, and of those
+// issuers in turn, then builds all chains from leaf to roots using what was
+// found along with known. The chains are ranked by the number of clients in
+// kb that would accept them at the given time, then by whether they are
+// valid at that time, then by whether they are technically constrained, then
+// by length.
+func (kb *KnowledgeBase) FindAlternateChains(leaf *x509.Certificate, known, roots []*x509.Certificate,
+	source IssuerSource, at time.Time) ([]RankedChain, error) {
+	pool := append([]*x509.Certificate(nil), known...)
+
+	frontier := []*x509.Certificate{leaf}
+	for depth := 0; depth < maxChainLength && len(frontier) > 0; depth++ {
+		var next []*x509.Certificate
+		for _, cert := range frontier {
+			// Nothing is gained by looking above a trusted root
+			if containsCertificate(roots, cert) {
+				continue
+			}
+
+			candidates, err := source.IssuerCandidates(cert)
+			if err != nil {
+				return nil, err
+			}
+			for _, candidate := range candidates {
+				if containsCertificate(pool, candidate) || containsCertificate(roots, candidate) ||
+					isSelfSigned(candidate) {
+					continue
+				}
+				pool = append(pool, candidate)
+				next = append(next, candidate)
+			}
+		}
+		frontier = next
+	}
+
+	var ranked []RankedChain
+	for _, chain := range BuildChains(leaf, pool, roots) {
+		entry := RankedChain{Chain: chain}
+		for _, verdict := range kb.AcceptanceMatrix(chain, at) {
+			if verdict.Accepted {
+				entry.Accepted = append(entry.Accepted, verdict.Client)
+			} else {
+				entry.Rejected = append(entry.Rejected, verdict.Client)
+			}
+		}
+		for _, intermediate := range chain[1 : len(chain)-1] {
+			if AnalyzeTechnicalConstraints(intermediate).Constrained {
+				entry.Constrained = true
+			}
+		}
+		ranked = append(ranked, entry)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if len(ranked[i].Accepted) != len(ranked[j].Accepted) {
+			return len(ranked[i].Accepted) > len(ranked[j].Accepted)
+		}
+		validI, validJ := chainValidAt(ranked[i].Chain, at), chainValidAt(ranked[j].Chain, at)
+		if validI != validJ {
+			return validI
+		}
+		if ranked[i].Constrained != ranked[j].Constrained {
+			return ranked[i].Constrained
+		}
+		return len(ranked[i].Chain) < len(ranked[j].Chain)
+	})
+
+	return ranked, nil
+}
@@ -0,0 +1,68 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCAWithKeyID(t *testing.T, name string, keyID byte, parent *x509.Certificate, notAfter time.Time) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore: time.Date(2009, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  notAfter,
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{keyID},
+	}
+	if parent == nil {
+		return serialiseAndParse(t, template)
+	}
+	return issueAndParse(t, template, parent)
+}
+
+func TestFindAlternateChains(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	oldRoot := testCAWithKeyID(t, "Old Root", 1, nil, now.AddDate(0, 0, -1))
+	newRoot := testCAWithKeyID(t, "New Root", 2, nil, now.AddDate(10, 0, 0))
+	crossSign := testCAWithKeyID(t, "New Root", 2, oldRoot, now.AddDate(0, 0, -1))
+	intermediate := testCAWithKeyID(t, "Issuing CA", 3, newRoot, now.AddDate(5, 0, 0))
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "www.example.com",
+		},
+		NotBefore: now.AddDate(0, -1, 0),
+		NotAfter:  now.AddDate(0, 2, 0),
+		DNSNames:  []string{"www.example.com"},
+	}, intermediate)
+
+	source, server := fakeCrtSh(t, []*x509.Certificate{oldRoot, newRoot, crossSign, intermediate})
+	defer server.Close()
+
+	ranked, err := DefaultKnowledgeBase.FindAlternateChains(leaf, nil,
+		[]*x509.Certificate{oldRoot, newRoot}, source, now)
+	if err != nil {
+		t.Fatalf("Failed to find alternate chains: %s", err)
+	}
+
+	if len(ranked) != 2 {
+		t.Fatalf("Expected 2 chains, got %d", len(ranked))
+	}
+	// Every client rejects the 512-bit test key, so the chains are tied on
+	// acceptance and the one avoiding the expired cross-sign ranks first.
+	checkChainNames(t, ranked[0].Chain, "www.example.com", "Issuing CA", "New Root")
+	checkChainNames(t, ranked[1].Chain, "www.example.com", "Issuing CA", "New Root", "Old Root")
+}
@@ -0,0 +1,230 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/zip"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	apkSigningBlockMagic = "APK Sig Block 42"
+	apkSignatureV2       = 0x7109871a
+	apkSignatureV3       = 0xf05368c0
+	zipEndOfDirectory    = 0x06054b50
+	zipEndOfDirectoryLen = 22
+	// maxAPKSigningBlockSize bounds the signing block read from an APK.
+	maxAPKSigningBlockSize = 16 << 20
+)
+
+// apkDigests names the digests of the APK signature algorithms.
+var apkDigests = map[uint32]string{
+	0x0101: "SHA-256", 0x0102: "SHA-512", 0x0103: "SHA-256", 0x0104: "SHA-512",
+	0x0201: "SHA-256", 0x0202: "SHA-512", 0x0301: "SHA-256",
+	0x0421: "SHA-256", 0x0422: "SHA-256", 0x0423: "SHA-256",
+}
+
+// ExtractAPKSignatures reads the signatures on an Android APK: v1 JAR
+// signatures in META-INF, and v2 and v3 signatures in the APK Signing Block.
+func ExtractAPKSignatures(r io.ReaderAt, size int64) ([]CodeSignature, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []CodeSignature
+	for _, file := range archive.File {
+		dir, name := path.Split(file.Name)
+		switch strings.ToUpper(path.Ext(name)) {
+		case ".RSA", ".DSA", ".EC":
+		default:
+			continue
+		}
+		if dir != "META-INF/" || file.UncompressedSize64 > maxAPKSigningBlockSize {
+			continue
+		}
+		contents, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		found, err := parseCMSSignatures(contents, CodeSignatureAPKv1, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Name, err)
+		}
+		signatures = append(signatures, found...)
+	}
+
+	block, err := apkSigningBlock(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for len(block) > 0 {
+		if len(block) < 12 {
+			return nil, fmt.Errorf("Truncated APK Signing Block")
+		}
+		length := binary.LittleEndian.Uint64(block)
+		if length < 4 || length > uint64(len(block)-8) {
+			return nil, fmt.Errorf("Malformed APK Signing Block")
+		}
+		id := binary.LittleEndian.Uint32(block[8:])
+		value := block[12 : 8+length]
+		block = block[8+length:]
+
+		var format string
+		switch id {
+		case apkSignatureV2:
+			format = CodeSignatureAPKv2
+		case apkSignatureV3:
+			format = CodeSignatureAPKv3
+		default:
+			continue
+		}
+		found, err := parseAPKSigners(value, format)
+		if err != nil {
+			return nil, fmt.Errorf("%s signature: %s", format, err)
+		}
+		signatures = append(signatures, found...)
+	}
+	return signatures, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// apkSigningBlock returns the ID-value pairs of the APK Signing Block, which
+// sits just before the ZIP central directory, or nil if there is none.
+func apkSigningBlock(r io.ReaderAt, size int64) ([]byte, error) {
+	tailSize := int64(zipEndOfDirectoryLen + 0xffff)
+	if tailSize > size {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil {
+		return nil, err
+	}
+
+	end := -1
+	for i := len(tail) - zipEndOfDirectoryLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == zipEndOfDirectory {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("No ZIP end of central directory")
+	}
+	directory := int64(binary.LittleEndian.Uint32(tail[end+16:]))
+
+	// The block ends with its size and magic
+	if directory < 24 {
+		return nil, nil
+	}
+	footer := make([]byte, 24)
+	if _, err := r.ReadAt(footer, directory-24); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != apkSigningBlockMagic {
+		return nil, nil
+	}
+	blockSize := binary.LittleEndian.Uint64(footer)
+	if blockSize < 24 || blockSize > maxAPKSigningBlockSize || int64(blockSize)+8 > directory {
+		return nil, fmt.Errorf("Malformed APK Signing Block size %d", blockSize)
+	}
+
+	block := make([]byte, blockSize-24)
+	if _, err := r.ReadAt(block, directory-int64(blockSize)); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// apkLengthPrefixed splits a value with a 32-bit little-endian length prefix
+// from what follows it.
+func apkLengthPrefixed(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("Truncated length prefix")
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, nil, fmt.Errorf("Truncated value")
+	}
+	return data[4 : 4+length], data[4+length:], nil
+}
+
+// apkSequence splits a length-prefixed sequence of length-prefixed values.
+func apkSequence(data []byte) ([][]byte, []byte, error) {
+	sequence, rest, err := apkLengthPrefixed(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var values [][]byte
+	for len(sequence) > 0 {
+		var value []byte
+		if value, sequence, err = apkLengthPrefixed(sequence); err != nil {
+			return nil, nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rest, nil
+}
+
+// parseAPKSigners reads the signers of a v2 or v3 signature scheme block,
+// whose layouts differ only by the SDK versions v3 adds.
+func parseAPKSigners(value []byte, format string) ([]CodeSignature, error) {
+	signers, _, err := apkSequence(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []CodeSignature
+	for _, signer := range signers {
+		signedData, _, err := apkLengthPrefixed(signer)
+		if err != nil {
+			return nil, err
+		}
+		digests, rest, err := apkSequence(signedData)
+		if err != nil {
+			return nil, err
+		}
+		encodedCerts, _, err := apkSequence(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		signature := CodeSignature{Format: format}
+		for _, encoded := range encodedCerts {
+			cert, err := x509.ParseCertificate(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse certificate: %s", err)
+			}
+			signature.Certificates = append(signature.Certificates, cert)
+		}
+		if len(digests) > 0 && len(digests[0]) >= 4 {
+			algorithm := binary.LittleEndian.Uint32(digests[0])
+			if signature.DigestAlgorithm = apkDigests[algorithm]; len(signature.DigestAlgorithm) == 0 {
+				signature.DigestAlgorithm = fmt.Sprintf("unknown (0x%04x)", algorithm)
+			}
+		}
+		// The first certificate is the signer's
+		if len(signature.Certificates) > 0 {
+			signature.Signer = signature.Certificates[0]
+			signature.Chain = PartialChain(signature.Signer, signature.Certificates)
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
@@ -0,0 +1,138 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// lengthPrefixed concatenates values behind a 32-bit little-endian length.
+func lengthPrefixed(values ...[]byte) []byte {
+	joined := bytes.Join(values, nil)
+	prefix := make([]byte, 4, 4+len(joined))
+	binary.LittleEndian.PutUint32(prefix, uint32(len(joined)))
+	return append(prefix, joined...)
+}
+
+// testAPKSigner builds a v2 or v3 signer block for certs, signed with the
+// given algorithm.
+func testAPKSigner(algorithm uint32, certs ...*x509.Certificate) []byte {
+	id := make([]byte, 4)
+	binary.LittleEndian.PutUint32(id, algorithm)
+	var encoded [][]byte
+	for _, cert := range certs {
+		encoded = append(encoded, lengthPrefixed(cert.Raw))
+	}
+	signed := lengthPrefixed(
+		lengthPrefixed(lengthPrefixed(id, lengthPrefixed([]byte("digest")))),
+		lengthPrefixed(encoded...),
+		lengthPrefixed(),
+	)
+	return lengthPrefixed(signed, lengthPrefixed(), lengthPrefixed([]byte("key")))
+}
+
+// testAPK builds a ZIP with the given files, and an APK Signing Block
+// holding the given ID-value pairs if there are any.
+func testAPK(t *testing.T, files map[string][]byte, pairs map[uint32][]byte) []byte {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, contents := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Could not create %s: %s", name, err)
+		}
+		file.Write(contents)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not write ZIP: %s", err)
+	}
+	if len(pairs) == 0 {
+		return archive.Bytes()
+	}
+
+	end := archive.Len() - zipEndOfDirectoryLen
+	directory := int(binary.LittleEndian.Uint32(archive.Bytes()[end+16:]))
+
+	var block bytes.Buffer
+	for id, value := range pairs {
+		binary.Write(&block, binary.LittleEndian, uint64(4+len(value)))
+		binary.Write(&block, binary.LittleEndian, id)
+		block.Write(value)
+	}
+	size := uint64(block.Len() + 24)
+	signingBlock := make([]byte, 8, size+8)
+	binary.LittleEndian.PutUint64(signingBlock, size)
+	signingBlock = append(signingBlock, block.Bytes()...)
+	signingBlock = binary.LittleEndian.AppendUint64(signingBlock, size)
+	signingBlock = append(signingBlock, apkSigningBlockMagic...)
+
+	apk := append(append(append([]byte{}, archive.Bytes()[:directory]...), signingBlock...), archive.Bytes()[directory:]...)
+	// Point the end of central directory record past the block
+	end = len(apk) - zipEndOfDirectoryLen
+	binary.LittleEndian.PutUint32(apk[end+16:], uint32(directory+len(signingBlock)))
+	return apk
+}
+
+func TestExtractAPKSignatures(t *testing.T) {
+	t.Parallel()
+
+	v1 := testCA(t, "Android Debug", nil, time.Date(2050, time.January, 1, 0, 0, 0, 0, time.UTC))
+	chain := testCodeSigningChain(t)
+	apk := testAPK(t, map[string][]byte{
+		"AndroidManifest.xml":  []byte("manifest"),
+		"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\r\n"),
+		"META-INF/CERT.RSA":    testSignedData(t, v1, asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, nil, v1),
+	}, map[uint32][]byte{
+		apkSignatureV2: lengthPrefixed(testAPKSigner(0x0103, chain[0], chain[1])),
+		0x42726577:     []byte("verity padding"),
+	})
+
+	signatures, err := ExtractAPKSignatures(bytes.NewReader(apk), int64(len(apk)))
+	if err != nil {
+		t.Fatalf("Could not extract signatures: %s", err)
+	}
+	if len(signatures) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(signatures))
+	}
+
+	if signatures[0].Format != CodeSignatureAPKv1 || !signatures[0].Signer.Equal(v1) || signatures[0].DigestAlgorithm != "SHA-1" {
+		t.Errorf("Unexpected v1 signature: %+v", signatures[0])
+	}
+	v2 := signatures[1]
+	if v2.Format != CodeSignatureAPKv2 || !v2.Signer.Equal(chain[0]) || len(v2.Chain) != 2 || v2.DigestAlgorithm != "SHA-256" {
+		t.Errorf("Unexpected v2 signature: %+v", v2)
+	}
+
+	// Expiry and usages don't matter to Android
+	at := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if problems := AnalyzeCodeSigning(v2, at); !reflect.DeepEqual(problems, []string{"Weak key: RSA 512"}) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	if problems := AnalyzeCodeSigning(signatures[0], at); !reflect.DeepEqual(problems, []string{"Weak key: RSA 512", "Signed with SHA-1 digests"}) {
+		t.Errorf("Unexpected v1 problems %v", problems)
+	}
+}
+
+func TestExtractAPKSignaturesUnsigned(t *testing.T) {
+	t.Parallel()
+
+	apk := testAPK(t, map[string][]byte{"AndroidManifest.xml": []byte("manifest")}, nil)
+	signatures, err := ExtractAPKSignatures(bytes.NewReader(apk), int64(len(apk)))
+	if err != nil || len(signatures) != 0 {
+		t.Errorf("Expected no signatures, got %d and %v", len(signatures), err)
+	}
+
+	apk = testAPK(t, nil, map[uint32][]byte{apkSignatureV3: lengthPrefixed([]byte("junk"))})
+	if _, err := ExtractAPKSignatures(bytes.NewReader(apk), int64(len(apk))); err == nil {
+		t.Errorf("Expected an error for a malformed v3 signature")
+	}
+}
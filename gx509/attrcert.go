@@ -0,0 +1,529 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Attribute types of RFC 5755, section 4.4.
+var (
+	oidAttributeRole             = asn1.ObjectIdentifier{2, 5, 4, 72}
+	oidAttributeClearance        = asn1.ObjectIdentifier{2, 5, 4, 55}
+	oidAttributeAuthInfo         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 10, 1}
+	oidAttributeAccessIdentity   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 10, 2}
+	oidAttributeChargingIdentity = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 10, 3}
+	oidAttributeGroup            = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 10, 4}
+)
+
+// digestAlgorithms are the hashes an ObjectDigestInfo may be made with, by
+// OID.
+var digestAlgorithms = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// ObjectDigestInfo digestedObjectTypes.
+const (
+	digestedPublicKey     = 0
+	digestedPublicKeyCert = 1
+)
+
+type issuerSerialASN1 struct {
+	Issuer    []asn1.RawValue
+	Serial    *big.Int
+	IssuerUID asn1.BitString `asn1:"optional"`
+}
+
+type objectDigestInfoASN1 struct {
+	DigestedObjectType asn1.Enumerated
+	OtherObjectTypeID  asn1.ObjectIdentifier `asn1:"optional"`
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	ObjectDigest       asn1.BitString
+}
+
+type holderASN1 struct {
+	BaseCertificateID issuerSerialASN1     `asn1:"optional,tag:0"`
+	EntityName        []asn1.RawValue      `asn1:"optional,tag:1"`
+	ObjectDigestInfo  objectDigestInfoASN1 `asn1:"optional,tag:2"`
+}
+
+type v2FormASN1 struct {
+	IssuerName        []asn1.RawValue      `asn1:"optional"`
+	BaseCertificateID issuerSerialASN1     `asn1:"optional,tag:0"`
+	ObjectDigestInfo  objectDigestInfoASN1 `asn1:"optional,tag:1"`
+}
+
+type attributeASN1 struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type attributeCertificateInfoASN1 struct {
+	Raw          asn1.RawContent
+	Version      int
+	Holder       holderASN1
+	Issuer       asn1.RawValue
+	Signature    pkix.AlgorithmIdentifier
+	SerialNumber *big.Int
+	Validity     struct {
+		NotBefore, NotAfter time.Time `asn1:"generalized"`
+	}
+	Attributes     []attributeASN1
+	IssuerUniqueID asn1.BitString   `asn1:"optional"`
+	Extensions     []pkix.Extension `asn1:"optional"`
+}
+
+type attributeCertificateASN1 struct {
+	Info               attributeCertificateInfoASN1
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// An ACObjectDigest identifies a public key or certificate by its digest.
+type ACObjectDigest struct {
+	// Type is 0 for a public key, 1 for a public key certificate, or 2 for
+	// another object.
+	Type      int
+	Algorithm asn1.ObjectIdentifier
+	Digest    []byte
+}
+
+// An ACHolder identifies who an attribute certificate is issued to.
+type ACHolder struct {
+	// BaseCertificateIssuer and BaseCertificateSerial identify the holder's
+	// public key certificate, if set.
+	BaseCertificateIssuer []string
+	BaseCertificateSerial *big.Int
+	// EntityNames name the holder.
+	EntityNames  []string
+	ObjectDigest *ACObjectDigest
+
+	baseCertificateIssuer []asn1.RawValue
+	entityNames           []asn1.RawValue
+}
+
+// An ACAttribute is an attribute an attribute certificate asserts, such as a
+// role or group.
+type ACAttribute struct {
+	Type asn1.ObjectIdentifier
+	// Name is the attribute's name, or its OID if it is unknown.
+	Name string
+	// Values are the values as text, or hex for unknown attributes.
+	Values []string
+}
+
+// An AttributeCertificate is an RFC 5755 attribute certificate, which binds
+// attributes such as roles and group memberships to a holder, usually
+// identified by its public key certificate, and is signed by an attribute
+// authority.
+type AttributeCertificate struct {
+	Raw []byte
+	// RawInfo is the signed AttributeCertificateInfo.
+	RawInfo []byte
+	// Version is 2 for the v2 attribute certificates RFC 5755 profiles.
+	Version      int
+	SerialNumber *big.Int
+	Holder       ACHolder
+	// IssuerNames name the attribute authority. V1Form is set if they are
+	// the bare GeneralNames of a v1 attribute certificate.
+	IssuerNames        []string
+	V1Form             bool
+	NotBefore          time.Time
+	NotAfter           time.Time
+	Attributes         []ACAttribute
+	Extensions         []pkix.Extension
+	SignatureAlgorithm x509.SignatureAlgorithm
+	Signature          []byte
+
+	signatureAlgorithm asn1.ObjectIdentifier
+	issuerNames        []asn1.RawValue
+}
+
+// ParseAttributeCertificate parses a DER attribute certificate.
+func ParseAttributeCertificate(der []byte) (*AttributeCertificate, error) {
+	var raw attributeCertificateASN1
+	if err := unmarshalAll(der, &raw); err != nil {
+		return nil, fmt.Errorf("Could not decode attribute certificate: %s", err)
+	}
+	info := raw.Info
+	ac := &AttributeCertificate{
+		Raw:                der,
+		RawInfo:            info.Raw,
+		Version:            info.Version + 1,
+		SerialNumber:       info.SerialNumber,
+		NotBefore:          info.Validity.NotBefore,
+		NotAfter:           info.Validity.NotAfter,
+		Extensions:         info.Extensions,
+		SignatureAlgorithm: signatureAlgorithmOIDs[raw.SignatureAlgorithm.Algorithm.String()],
+		Signature:          raw.SignatureValue.RightAlign(),
+		signatureAlgorithm: raw.SignatureAlgorithm.Algorithm,
+	}
+
+	holder := info.Holder
+	if holder.BaseCertificateID.Serial != nil {
+		ac.Holder.baseCertificateIssuer = holder.BaseCertificateID.Issuer
+		ac.Holder.BaseCertificateIssuer = rawGeneralNamesText(holder.BaseCertificateID.Issuer)
+		ac.Holder.BaseCertificateSerial = holder.BaseCertificateID.Serial
+	}
+	ac.Holder.entityNames = holder.EntityName
+	ac.Holder.EntityNames = rawGeneralNamesText(holder.EntityName)
+	if digest := holder.ObjectDigestInfo; len(digest.DigestAlgorithm.Algorithm) > 0 {
+		ac.Holder.ObjectDigest = &ACObjectDigest{
+			Type:      int(digest.DigestedObjectType),
+			Algorithm: digest.DigestAlgorithm.Algorithm,
+			Digest:    digest.ObjectDigest.RightAlign(),
+		}
+	}
+
+	switch issuer := info.Issuer; {
+	case issuer.Class == asn1.ClassUniversal && issuer.Tag == asn1.TagSequence:
+		ac.V1Form = true
+		if err := unmarshalAll(issuer.FullBytes, &ac.issuerNames); err != nil {
+			return nil, fmt.Errorf("Could not decode issuer: %s", err)
+		}
+	case issuer.Class == asn1.ClassContextSpecific && issuer.Tag == 0:
+		var v2Form v2FormASN1
+		if _, err := asn1.UnmarshalWithParams(issuer.FullBytes, &v2Form, "tag:0"); err != nil {
+			return nil, fmt.Errorf("Could not decode issuer: %s", err)
+		}
+		ac.issuerNames = v2Form.IssuerName
+	default:
+		return nil, fmt.Errorf("Unknown issuer form with tag %d", issuer.Tag)
+	}
+	ac.IssuerNames = rawGeneralNamesText(ac.issuerNames)
+
+	for _, attribute := range info.Attributes {
+		ac.Attributes = append(ac.Attributes, decodeACAttribute(attribute))
+	}
+	return ac, nil
+}
+
+// ParseAttributeCertificates parses the attribute certificates in data, as
+// PEM ATTRIBUTE CERTIFICATE blocks or a single DER attribute certificate.
+func ParseAttributeCertificates(data []byte) ([]*AttributeCertificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN ")) {
+		ac, err := ParseAttributeCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*AttributeCertificate{ac}, nil
+	}
+	var acs []*AttributeCertificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "ATTRIBUTE CERTIFICATE" {
+			continue
+		}
+		ac, err := ParseAttributeCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		acs = append(acs, ac)
+	}
+	if len(acs) == 0 {
+		return nil, fmt.Errorf("No ATTRIBUTE CERTIFICATE blocks found")
+	}
+	return acs, nil
+}
+
+// rawGeneralNamesText formats decoded GeneralNames as openssl does.
+func rawGeneralNamesText(names []asn1.RawValue) []string {
+	var text []string
+	for _, name := range names {
+		text = append(text, generalNameText(name, false))
+	}
+	return text
+}
+
+// decodeACAttribute formats the values of the attributes RFC 5755 defines,
+// and those of any other attribute in hex.
+func decodeACAttribute(attribute attributeASN1) ACAttribute {
+	decoded := ACAttribute{Type: attribute.Type, Name: attribute.Type.String()}
+	var decode func(value asn1.RawValue) (string, error)
+	switch {
+	case attribute.Type.Equal(oidAttributeRole):
+		decoded.Name, decode = "role", decodeRoleSyntax
+	case attribute.Type.Equal(oidAttributeClearance):
+		decoded.Name, decode = "clearance", decodeClearance
+	case attribute.Type.Equal(oidAttributeAuthInfo):
+		decoded.Name, decode = "authenticationInfo", decodeSvceAuthInfo
+	case attribute.Type.Equal(oidAttributeAccessIdentity):
+		decoded.Name, decode = "accessIdentity", decodeSvceAuthInfo
+	case attribute.Type.Equal(oidAttributeChargingIdentity):
+		decoded.Name, decode = "chargingIdentity", decodeIetfAttrSyntax
+	case attribute.Type.Equal(oidAttributeGroup):
+		decoded.Name, decode = "group", decodeIetfAttrSyntax
+	}
+	for _, value := range attribute.Values {
+		text := fmt.Sprintf("%X", value.FullBytes)
+		if decode != nil {
+			var err error
+			if text, err = decode(value); err != nil {
+				text = fmt.Sprintf("<invalid: %s>", err)
+			}
+		}
+		decoded.Values = append(decoded.Values, text)
+	}
+	return decoded
+}
+
+// decodeRoleSyntax formats a role attribute's RoleSyntax, the role name and
+// the authority that defines it.
+func decodeRoleSyntax(value asn1.RawValue) (string, error) {
+	var role struct {
+		RoleAuthority []asn1.RawValue `asn1:"optional,tag:0"`
+		RoleName      asn1.RawValue   `asn1:"explicit,tag:1"`
+	}
+	if err := unmarshalAll(value.FullBytes, &role); err != nil {
+		return "", err
+	}
+	// RoleName is returned with its explicit tag
+	var name asn1.RawValue
+	if err := unmarshalAll(role.RoleName.Bytes, &name); err != nil {
+		return "", err
+	}
+	text := generalNameText(name, false)
+	if len(role.RoleAuthority) > 0 {
+		text += " (authority " + strings.Join(rawGeneralNamesText(role.RoleAuthority), ", ") + ")"
+	}
+	return text, nil
+}
+
+// decodeClearance formats a clearance attribute's security policy.
+func decodeClearance(value asn1.RawValue) (string, error) {
+	var clearance struct {
+		PolicyID           asn1.ObjectIdentifier
+		ClassList          asn1.BitString  `asn1:"optional"`
+		SecurityCategories []asn1.RawValue `asn1:"optional,set"`
+	}
+	if err := unmarshalAll(value.FullBytes, &clearance); err != nil {
+		return "", err
+	}
+	return "policy " + clearance.PolicyID.String(), nil
+}
+
+// decodeSvceAuthInfo formats the service and identity of an
+// authenticationInfo or accessIdentity attribute, but not its secret.
+func decodeSvceAuthInfo(value asn1.RawValue) (string, error) {
+	var info struct {
+		Service  asn1.RawValue
+		Ident    asn1.RawValue
+		AuthInfo []byte `asn1:"optional"`
+	}
+	if err := unmarshalAll(value.FullBytes, &info); err != nil {
+		return "", err
+	}
+	return generalNameText(info.Ident, false) + " at " + generalNameText(info.Service, false), nil
+}
+
+// decodeIetfAttrSyntax formats the values of a group or chargingIdentity
+// attribute, and the authority that defines them.
+func decodeIetfAttrSyntax(value asn1.RawValue) (string, error) {
+	var syntax struct {
+		PolicyAuthority []asn1.RawValue `asn1:"optional,tag:0"`
+		Values          []asn1.RawValue
+	}
+	if err := unmarshalAll(value.FullBytes, &syntax); err != nil {
+		return "", err
+	}
+	var values []string
+	for _, v := range syntax.Values {
+		switch v.Tag {
+		case asn1.TagOctetString:
+			values = append(values, fmt.Sprintf("%X", v.Bytes))
+		case asn1.TagOID:
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(v.FullBytes, &oid); err != nil {
+				return "", err
+			}
+			values = append(values, oid.String())
+		default:
+			values = append(values, string(v.Bytes))
+		}
+	}
+	text := strings.Join(values, ", ")
+	if len(syntax.PolicyAuthority) > 0 {
+		text += " (authority " + strings.Join(rawGeneralNamesText(syntax.PolicyAuthority), ", ") + ")"
+	}
+	return text, nil
+}
+
+// An ACLinkage is how an attribute certificate links to the public key
+// certificates of its holder and of the attribute authority that issued it.
+type ACLinkage struct {
+	// Holder is the holder's certificate, if one was found, and HolderMatch
+	// is the field of the holder it matched: baseCertificateID, entityName or
+	// objectDigestInfo.
+	Holder      *x509.Certificate
+	HolderMatch string
+	// Issuer is the attribute authority's certificate, if one named as the
+	// issuer verifies the signature.
+	Issuer *x509.Certificate
+	// Problems are where the attribute certificate or its linkage departs
+	// from RFC 5755, or is invalid at the time linked.
+	Problems []string
+}
+
+// Link finds the certificates of ac's holder and issuer among certs, and
+// reports what is wrong with them and ac at the time at.
+func (ac *AttributeCertificate) Link(certs []*x509.Certificate, at time.Time) ACLinkage {
+	var linkage ACLinkage
+	problem := func(format string, args ...interface{}) {
+		linkage.Problems = append(linkage.Problems, fmt.Sprintf(format, args...))
+	}
+
+	if ac.Version != 2 {
+		problem("Version %d, where RFC 5755 requires version 2", ac.Version)
+	}
+	if at.Before(ac.NotBefore) {
+		problem("Not valid until %s", ac.NotBefore.UTC().Format(time.RFC3339))
+	} else if at.After(ac.NotAfter) {
+		problem("Expired on %s", ac.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	// Section 4.2.2: the holder should be its certificate's issuer and serial
+	linkage.Holder, linkage.HolderMatch = ac.findHolder(certs)
+	if linkage.Holder == nil {
+		problem("No certificate matches the holder")
+	} else if at.After(linkage.Holder.NotAfter) {
+		problem("The holder's certificate expired on %s", linkage.Holder.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	// Section 4.2.3: v2Form, naming the issuer by one directoryName
+	if ac.V1Form {
+		problem("The issuer is in v1Form, which RFC 5755 forbids")
+	}
+	var issuerName []byte
+	if len(ac.issuerNames) != 1 || ac.issuerNames[0].Class != asn1.ClassContextSpecific ||
+		ac.issuerNames[0].Tag != generalNameDirectoryName || isEmptyName(ac.issuerNames[0].Bytes) {
+		problem("The issuer must be named by exactly one non-empty directoryName")
+	} else {
+		issuerName = ac.issuerNames[0].Bytes
+	}
+
+	named := 0
+	for _, cert := range certs {
+		if issuerName == nil || !bytes.Equal(cert.RawSubject, issuerName) {
+			continue
+		}
+		named++
+		if ac.SignatureAlgorithm != x509.UnknownSignatureAlgorithm &&
+			cert.CheckSignature(ac.SignatureAlgorithm, ac.RawInfo, ac.Signature) == nil {
+			linkage.Issuer = cert
+			break
+		}
+	}
+	switch {
+	case linkage.Issuer != nil:
+		// Section 4.5: AC issuers must not be CAs
+		if linkage.Issuer.BasicConstraintsValid && linkage.Issuer.IsCA {
+			problem("The attribute authority %s is a CA, which RFC 5755 forbids", describeCertificate(linkage.Issuer))
+		}
+		if linkage.Issuer.KeyUsage != 0 && linkage.Issuer.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			problem("The attribute authority's key usage does not allow digitalSignature")
+		}
+		if at.After(linkage.Issuer.NotAfter) {
+			problem("The attribute authority's certificate expired on %s", linkage.Issuer.NotAfter.UTC().Format(time.RFC3339))
+		}
+	case ac.SignatureAlgorithm == x509.UnknownSignatureAlgorithm:
+		problem("Unsupported signature algorithm %s", ac.signatureAlgorithm)
+	case named > 0:
+		problem("None of the %d certificates named as the issuer verifies the signature", named)
+	case issuerName != nil:
+		problem("No certificate matches the issuer %s", ac.IssuerNames[0])
+	}
+	return linkage
+}
+
+// findHolder returns the certificate among certs that ac's holder identifies,
+// trying baseCertificateID, then entityName, then objectDigestInfo, with the
+// field that matched.
+func (ac *AttributeCertificate) findHolder(certs []*x509.Certificate) (*x509.Certificate, string) {
+	holder := ac.Holder
+	if holder.BaseCertificateSerial != nil {
+		for _, cert := range certs {
+			if cert.SerialNumber.Cmp(holder.BaseCertificateSerial) == 0 && namesDirectoryName(holder.baseCertificateIssuer, cert.RawIssuer) {
+				return cert, "baseCertificateID"
+			}
+		}
+	}
+	for _, cert := range certs {
+		if namesDirectoryName(holder.entityNames, cert.RawSubject) {
+			return cert, "entityName"
+		}
+		for _, name := range holder.entityNames {
+			if name.Class != asn1.ClassContextSpecific {
+				continue
+			}
+			switch value := string(name.Bytes); name.Tag {
+			case 1:
+				if containsString(cert.EmailAddresses, value) {
+					return cert, "entityName"
+				}
+			case 2:
+				if containsString(cert.DNSNames, value) {
+					return cert, "entityName"
+				}
+			}
+		}
+	}
+	if digest := holder.ObjectDigest; digest != nil {
+		hash, ok := digestAlgorithms[digest.Algorithm.String()]
+		if !ok || !hash.Available() {
+			return nil, ""
+		}
+		for _, cert := range certs {
+			object := cert.Raw
+			if digest.Type == digestedPublicKey {
+				object = cert.RawSubjectPublicKeyInfo
+			} else if digest.Type != digestedPublicKeyCert {
+				break
+			}
+			h := hash.New()
+			h.Write(object)
+			if bytes.Equal(h.Sum(nil), digest.Digest) {
+				return cert, "objectDigestInfo"
+			}
+		}
+	}
+	return nil, ""
+}
+
+// namesDirectoryName reports whether names include the directoryName name.
+func namesDirectoryName(names []asn1.RawValue, name []byte) bool {
+	for _, n := range names {
+		if n.Class == asn1.ClassContextSpecific && n.Tag == generalNameDirectoryName && bytes.Equal(n.Bytes, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether values include value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyName reports whether the DER Name name has no RDNs.
+func isEmptyName(name []byte) bool {
+	var rdns pkix.RDNSequence
+	return unmarshalAll(name, &rdns) != nil || len(rdns) == 0
+}
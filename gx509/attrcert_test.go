@@ -0,0 +1,205 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// directoryName returns the GeneralName naming the DER Name name.
+func directoryName(name []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameDirectoryName, IsCompound: true, Bytes: name}
+}
+
+// testAttributeCertificate returns the DER of an attribute certificate
+// issued by aa, signed with key, asserting a role and groups for holder.
+func testAttributeCertificate(t *testing.T, holder holderASN1, aa *x509.Certificate, key *ecdsa.PrivateKey) []byte {
+	issuer, err := asn1.MarshalWithParams(v2FormASN1{IssuerName: []asn1.RawValue{directoryName(aa.RawSubject)}}, "tag:0")
+	if err != nil {
+		t.Fatalf("Could not encode issuer: %s", err)
+	}
+	roleName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameURI, Bytes: []byte("urn:acme:role:operator")})
+	if err != nil {
+		t.Fatalf("Could not encode role name: %s", err)
+	}
+	role, err := asn1.Marshal(struct{ RoleName asn1.RawValue }{
+		asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: roleName},
+	})
+	if err != nil {
+		t.Fatalf("Could not encode role: %s", err)
+	}
+	group, err := asn1.Marshal(struct{ Values []asn1.RawValue }{[]asn1.RawValue{
+		{Tag: asn1.TagUTF8String, Bytes: []byte("ops")},
+		{Tag: asn1.TagUTF8String, Bytes: []byte("pki-admins")},
+	}})
+	if err != nil {
+		t.Fatalf("Could not encode group: %s", err)
+	}
+
+	info := attributeCertificateInfoASN1{
+		Version:      1,
+		Holder:       holder,
+		Issuer:       asn1.RawValue{FullBytes: issuer},
+		Signature:    pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		SerialNumber: big.NewInt(42),
+		Attributes: []attributeASN1{
+			{Type: oidAttributeRole, Values: []asn1.RawValue{{FullBytes: role}}},
+			{Type: oidAttributeGroup, Values: []asn1.RawValue{{FullBytes: group}}},
+		},
+	}
+	info.Validity.NotBefore = time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC)
+	info.Validity.NotAfter = time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC)
+	infoDER, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatalf("Could not encode attribute certificate info: %s", err)
+	}
+	digest := sha256.Sum256(infoDER)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Could not sign: %s", err)
+	}
+	der, err := asn1.Marshal(attributeCertificateASN1{
+		Info:               attributeCertificateInfoASN1{Raw: infoDER},
+		SignatureAlgorithm: info.Signature,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		t.Fatalf("Could not encode attribute certificate: %s", err)
+	}
+	return der
+}
+
+func TestAttributeCertificate(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "operator.example.com")
+	leaf := chain[0]
+	key, _ := testECKey(t)
+	aa := certifyKey(t, "Acme Attribute Authority", &key.PublicKey)
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	holder := holderASN1{BaseCertificateID: issuerSerialASN1{
+		Issuer: []asn1.RawValue{directoryName(leaf.RawIssuer)},
+		Serial: leaf.SerialNumber,
+	}}
+	der := testAttributeCertificate(t, holder, aa, key)
+	acs, err := ParseAttributeCertificates(pem.EncodeToMemory(&pem.Block{Type: "ATTRIBUTE CERTIFICATE", Bytes: der}))
+	if err != nil {
+		t.Fatalf("Could not parse attribute certificate: %s", err)
+	}
+	if len(acs) != 1 {
+		t.Fatalf("Parsed %d attribute certificates, expected 1", len(acs))
+	}
+	ac := acs[0]
+	if ac.Version != 2 || ac.SerialNumber.Int64() != 42 || ac.V1Form || ac.SignatureAlgorithm != x509.ECDSAWithSHA256 {
+		t.Errorf("Unexpected version %d, serial %s, v1Form %t or algorithm %s", ac.Version, ac.SerialNumber, ac.V1Form, ac.SignatureAlgorithm)
+	}
+	if !ac.NotAfter.Equal(time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected notAfter %s", ac.NotAfter)
+	}
+	if len(ac.IssuerNames) != 1 || !strings.Contains(ac.IssuerNames[0], "Acme Attribute Authority") {
+		t.Errorf("Unexpected issuer %q", ac.IssuerNames)
+	}
+	if len(ac.Holder.BaseCertificateIssuer) != 1 || ac.Holder.BaseCertificateSerial.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("Unexpected holder %+v", ac.Holder)
+	}
+	expected := []ACAttribute{
+		{Type: oidAttributeRole, Name: "role", Values: []string{"URI:urn:acme:role:operator"}},
+		{Type: oidAttributeGroup, Name: "group", Values: []string{"ops, pki-admins"}},
+	}
+	if !reflect.DeepEqual(ac.Attributes, expected) {
+		t.Errorf("Unexpected attributes %+v", ac.Attributes)
+	}
+
+	linkage := ac.Link(append(chain, aa), at)
+	if linkage.Holder != leaf || linkage.HolderMatch != "baseCertificateID" {
+		t.Errorf("Holder matched %v by %q, expected the leaf by baseCertificateID", linkage.Holder, linkage.HolderMatch)
+	}
+	if linkage.Issuer != aa {
+		t.Errorf("Issuer matched %v, expected the attribute authority", linkage.Issuer)
+	}
+	if len(linkage.Problems) > 0 {
+		t.Errorf("Unexpected problems %q", linkage.Problems)
+	}
+
+	// Without the holder's certificate, and after expiry
+	linkage = ac.Link([]*x509.Certificate{aa}, time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC))
+	if linkage.Holder != nil || len(linkage.Problems) != 2 ||
+		!strings.HasPrefix(linkage.Problems[0], "Expired") || linkage.Problems[1] != "No certificate matches the holder" {
+		t.Errorf("Unexpected linkage %+v", linkage)
+	}
+
+	// An issuer named the same but with another key does not verify
+	other, _ := testECKey(t)
+	impostor := certifyKey(t, "Acme Attribute Authority", &other.PublicKey)
+	linkage = ac.Link(append(chain, impostor), at)
+	if linkage.Issuer != nil || len(linkage.Problems) != 1 || !strings.Contains(linkage.Problems[0], "verifies the signature") {
+		t.Errorf("Unexpected linkage %+v", linkage)
+	}
+
+	// An issuer that is a CA breaks section 4.5
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(7),
+		Subject:               pkix.Name{CommonName: "Acme Attribute CA"},
+		NotBefore:             time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2028, time.March, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &key.PublicKey, testPrivateKey)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %s", err)
+	}
+	aaCA, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+	ac, err = ParseAttributeCertificate(testAttributeCertificate(t, holder, aaCA, key))
+	if err != nil {
+		t.Fatalf("Could not parse attribute certificate: %s", err)
+	}
+	linkage = ac.Link(append(chain, aaCA), at)
+	if linkage.Issuer != aaCA || len(linkage.Problems) != 1 || !strings.Contains(linkage.Problems[0], "is a CA") {
+		t.Errorf("Unexpected linkage %+v", linkage)
+	}
+
+	// Holders may be named, or identified by the digest of their key
+	entity := holderASN1{EntityName: []asn1.RawValue{directoryName(leaf.RawSubject)}}
+	ac, err = ParseAttributeCertificate(testAttributeCertificate(t, entity, aa, key))
+	if err != nil {
+		t.Fatalf("Could not parse attribute certificate: %s", err)
+	}
+	if linkage = ac.Link(append(chain, aa), at); linkage.Holder != leaf || linkage.HolderMatch != "entityName" {
+		t.Errorf("Holder matched %v by %q, expected the leaf by entityName", linkage.Holder, linkage.HolderMatch)
+	}
+	keyDigest := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	digested := holderASN1{ObjectDigestInfo: objectDigestInfoASN1{
+		DigestedObjectType: digestedPublicKey,
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		ObjectDigest:       asn1.BitString{Bytes: keyDigest[:], BitLength: 8 * len(keyDigest)},
+	}}
+	ac, err = ParseAttributeCertificate(testAttributeCertificate(t, digested, aa, key))
+	if err != nil {
+		t.Fatalf("Could not parse attribute certificate: %s", err)
+	}
+	if linkage = ac.Link(append(chain, aa), at); linkage.Holder != leaf || linkage.HolderMatch != "objectDigestInfo" {
+		t.Errorf("Holder matched %v by %q, expected the leaf by objectDigestInfo", linkage.Holder, linkage.HolderMatch)
+	}
+
+	if _, err := ParseAttributeCertificates(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})); err == nil {
+		t.Errorf("Parsed a certificate as an attribute certificate")
+	}
+}
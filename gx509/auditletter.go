@@ -0,0 +1,210 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An AuditLetter holds the fields extracted from an audit statement.
+type AuditLetter struct {
+	Fingerprints map[[sha256.Size]byte]bool
+	// Dates lists every distinct date mentioned, in order, which normally
+	// includes the audit period and the statement date.
+	Dates []time.Time
+}
+
+var (
+	hexRunPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2,}(?:[:\s]+[0-9a-f]{2,})*\b`)
+
+	months      = `(?:January|February|March|April|May|June|July|August|September|October|November|December)`
+	datePattern = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b|\b` + months + `\s+\d{1,2},\s*\d{4}\b|\b\d{1,2}\s+` + months + `\s+\d{4}\b`)
+	dateLayouts = []string{"2006-01-02", "January 2, 2006", "2 January 2006"}
+)
+
+// ExtractAuditLetter extracts SHA-256 fingerprints and dates from an audit
+// statement, which may be plain text or a PDF.
+//
+// This is experimental. Text is only recovered from PDFs that use
+// uncompressed or Flate-compressed content streams with simple fonts, and
+// scanned letters yield nothing.
+func ExtractAuditLetter(data []byte) AuditLetter {
+	text := string(data)
+	if bytes.HasPrefix(data, []byte("%PDF")) {
+		text = string(pdfText(data))
+	}
+
+	letter := AuditLetter{Fingerprints: make(map[[sha256.Size]byte]bool)}
+	for _, match := range hexRunPattern.FindAllString(text, -1) {
+		for _, fingerprint := range fingerprintCandidates(match) {
+			letter.Fingerprints[fingerprint] = true
+		}
+	}
+
+	seen := make(map[time.Time]bool)
+	for _, match := range datePattern.FindAllString(text, -1) {
+		normalized := strings.Join(strings.Fields(strings.Replace(match, ",", ", ", 1)), " ")
+		for _, layout := range dateLayouts {
+			if date, err := time.Parse(layout, normalized); err == nil && !seen[date] {
+				seen[date] = true
+				letter.Dates = append(letter.Dates, date)
+				break
+			}
+		}
+	}
+	sort.Slice(letter.Dates, func(i, j int) bool { return letter.Dates[i].Before(letter.Dates[j]) })
+
+	return letter
+}
+
+// fingerprintCandidates returns the SHA-256 fingerprints that may be written
+// in run, a sequence of hex words. Fingerprints are often split over lines or
+// run into neighbouring words that happen to be hex, like "CA" or a year, so
+// every 64 digits starting at a word boundary is a candidate.
+func fingerprintCandidates(run string) [][sha256.Size]byte {
+	words := strings.Fields(strings.Replace(run, ":", " ", -1))
+	digits := strings.Join(words, "")
+
+	var candidates [][sha256.Size]byte
+	offset := 0
+	for _, word := range words {
+		if offset+2*sha256.Size <= len(digits) {
+			if fingerprint, err := ParseFingerprint(digits[offset : offset+2*sha256.Size]); err == nil {
+				candidates = append(candidates, fingerprint)
+			}
+		}
+		offset += len(word)
+	}
+	return candidates
+}
+
+// Mentions reports whether the letter lists cert's SHA-256 fingerprint.
+func (l AuditLetter) Mentions(cert *x509.Certificate) bool {
+	return l.Fingerprints[sha256.Sum256(cert.Raw)]
+}
+
+// MissingFromAuditLetters returns the certificates whose fingerprints appear
+// in none of the letters.
+func MissingFromAuditLetters(certs []*x509.Certificate, letters []AuditLetter) []*x509.Certificate {
+	var missing []*x509.Certificate
+	for _, cert := range certs {
+		found := false
+		for _, letter := range letters {
+			if letter.Mentions(cert) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, cert)
+		}
+	}
+	return missing
+}
+
+var pdfStream = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n(.*?)\r?\nendstream`)
+
+// pdfText recovers the strings shown by the text operators in each content
+// stream of a PDF, with a line break wherever the text position moves.
+func pdfText(data []byte) []byte {
+	var text bytes.Buffer
+	for _, match := range pdfStream.FindAllSubmatch(data, -1) {
+		dict, content := match[1], match[2]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			reader, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// A truncated stream still yields what was inflated
+			content, _ = ioutil.ReadAll(reader)
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		pdfContentText(&text, content)
+	}
+	return text.Bytes()
+}
+
+func pdfContentText(text *bytes.Buffer, content []byte) {
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '(':
+			i = pdfLiteralString(text, content, i+1)
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			hexString := strings.Join(strings.Fields(string(content[i+1:i+end])), "")
+			if len(hexString)%2 == 1 {
+				hexString += "0"
+			}
+			if decoded, err := hex.DecodeString(hexString); err == nil {
+				text.Write(decoded)
+			}
+			i += end
+		case c == 'T' && i+1 < len(content) && bytes.IndexByte([]byte("dD*m"), content[i+1]) >= 0,
+			c == 'E' && i+1 < len(content) && content[i+1] == 'T',
+			c == '\'' || c == '"':
+			text.WriteByte('\n')
+			i++
+		}
+	}
+}
+
+// pdfLiteralString appends the literal string starting at content[start],
+// just after its opening parenthesis, and returns the index of its closing
+// parenthesis.
+func pdfLiteralString(text *bytes.Buffer, content []byte, start int) int {
+	depth := 1
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch escaped := content[i]; escaped {
+			case 'n':
+				text.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				text.WriteByte(' ')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := 0
+					j := i
+					for ; j < len(content) && j < i+3 && content[j] >= '0' && content[j] <= '7'; j++ {
+						value = value*8 + int(content[j]-'0')
+					}
+					text.WriteByte(byte(value))
+					i = j - 1
+				} else {
+					text.WriteByte(escaped)
+				}
+			}
+		case c == '(':
+			depth++
+			text.WriteByte(c)
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+			text.WriteByte(c)
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return len(content)
+}
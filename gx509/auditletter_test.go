@@ -0,0 +1,104 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func colonFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	var pairs []string
+	for _, b := range hash {
+		pairs = append(pairs, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(pairs, ":")
+}
+
+func checkDates(t *testing.T, letter AuditLetter, expected ...time.Time) {
+	if len(letter.Dates) != len(expected) {
+		t.Errorf("Expected %d dates, got %v", len(expected), letter.Dates)
+		return
+	}
+	for i, date := range letter.Dates {
+		if !date.Equal(expected[i]) {
+			t.Errorf("Date %d: expected %s, got %s", i, expected[i], date)
+		}
+	}
+}
+
+func TestExtractAuditLetterText(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().AddDate(5, 0, 0)
+	audited := testCA(t, "Audited CA", nil, notAfter)
+	wrapped := testCA(t, "Wrapped CA", nil, notAfter)
+	missing := testCA(t, "Missing CA", nil, notAfter)
+
+	wrappedHash := fmt.Sprintf("%X", sha256.Sum256(wrapped.Raw))
+	text := fmt.Sprintf(`INDEPENDENT ASSURANCE REPORT
+For the period April 1, 2022 to 31 March 2023, management asserts...
+Report date: 2023-06-15. Also repeated: March 31,  2023.
+
+Audited CA  SHA-256: %s
+Wrapped CA  %s
+            %s
+`, colonFingerprint(audited), wrappedHash[:32], wrappedHash[32:])
+
+	letter := ExtractAuditLetter([]byte(text))
+	if !letter.Mentions(audited) {
+		t.Errorf("Expected the colon-separated fingerprint to be found")
+	}
+	if !letter.Mentions(wrapped) {
+		t.Errorf("Expected the wrapped fingerprint to be found")
+	}
+	if letter.Mentions(missing) {
+		t.Errorf("Did not expect the missing CA to be found")
+	}
+	checkDates(t, letter,
+		time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.June, 15, 0, 0, 0, 0, time.UTC))
+
+	absent := MissingFromAuditLetters([]*x509.Certificate{audited, missing, wrapped}, []AuditLetter{letter})
+	if len(absent) != 1 || absent[0] != missing {
+		t.Errorf("Expected only the missing CA to be absent, got %d", len(absent))
+	}
+}
+
+func TestExtractAuditLetterPDF(t *testing.T) {
+	t.Parallel()
+
+	audited := testCA(t, "Audited CA", nil, time.Now().AddDate(5, 0, 0))
+	hash := fmt.Sprintf("%X", sha256.Sum256(audited.Raw))
+
+	// Kerned like a typical generator, split over two lines
+	content := fmt.Sprintf("BT /F1 10 Tf 72 720 Td [(Period: 1 Ap)-20(ril 2022 \\(inclusive\\))] TJ\n"+
+		"0 -12 Td (%s) Tj T* <%x> Tj ET", hash[:40], hash[40:])
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte(content))
+	writer.Close()
+
+	var pdf bytes.Buffer
+	fmt.Fprintf(&pdf, "%%PDF-1.4\n4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	fmt.Fprintf(&pdf, "\nendstream\nendobj\n")
+	fmt.Fprintf(&pdf, "5 0 obj\n<< /Length 20 /Filter /DCTDecode >>\nstream\n(2001-01-01) Tj\nendstream\nendobj\n%%%%EOF\n")
+
+	letter := ExtractAuditLetter(pdf.Bytes())
+	if !letter.Mentions(audited) {
+		t.Errorf("Expected the fingerprint to be found in %q", pdfText(pdf.Bytes()))
+	}
+	// The image stream is skipped
+	checkDates(t, letter, time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC))
+}
@@ -0,0 +1,159 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// An AuditStatement records an auditor's opinion on a set of CA
+// certificates over an audit period.
+type AuditStatement struct {
+	Auditor       string
+	Standards     []string
+	PeriodStart   time.Time
+	PeriodEnd     time.Time
+	StatementDate time.Time
+	// Certificates holds the SHA-256 fingerprints, or the Subject + SPKI
+	// hashes, of the CA certificates in scope.
+	Certificates map[[sha256.Size]byte]bool
+}
+
+type auditStatementYAML struct {
+	Auditor       string    `yaml:"auditor"`
+	Standards     []string  `yaml:"standards"`
+	PeriodStart   time.Time `yaml:"periodStart"`
+	PeriodEnd     time.Time `yaml:"periodEnd"`
+	StatementDate time.Time `yaml:"statementDate"`
+	Certificates  []string  `yaml:"certificates"`
+}
+
+type auditStatementsYAML struct {
+	Audits []auditStatementYAML `yaml:"audits"`
+}
+
+// ParseAuditStatements decodes audit statement metadata from YAML.
+func ParseAuditStatements(data []byte) ([]AuditStatement, error) {
+	var raw auditStatementsYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+
+	var audits []AuditStatement
+	for i, entry := range raw.Audits {
+		if len(entry.Standards) == 0 {
+			return nil, fmt.Errorf("Audit %d lists no standards", i+1)
+		}
+		if entry.PeriodEnd.IsZero() || entry.PeriodEnd.Before(entry.PeriodStart) {
+			return nil, fmt.Errorf("Audit %d has an invalid period", i+1)
+		}
+
+		audit := AuditStatement{
+			Auditor:       entry.Auditor,
+			Standards:     entry.Standards,
+			PeriodStart:   entry.PeriodStart,
+			PeriodEnd:     entry.PeriodEnd,
+			StatementDate: entry.StatementDate,
+			Certificates:  make(map[[sha256.Size]byte]bool),
+		}
+		for _, hash := range entry.Certificates {
+			fingerprint, err := ParseFingerprint(hash)
+			if err != nil {
+				return nil, fmt.Errorf("Audit %d: %s", i+1, err)
+			}
+			audit.Certificates[fingerprint] = true
+		}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+// IsBRAudit reports whether one of the audit's standards covers the CA/Browser
+// Forum Baseline Requirements, such as WebTrust for CAs - SSL Baseline or
+// ETSI EN 319 411.
+func (a AuditStatement) IsBRAudit() bool {
+	for _, standard := range a.Standards {
+		lower := strings.ToLower(standard)
+		if strings.Contains(lower, "baseline") || strings.Contains(lower, "319 411") {
+			return true
+		}
+		for _, word := range strings.Fields(lower) {
+			if word == "br" || word == "brs" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Covers reports whether cert is in the audit's scope.
+func (a AuditStatement) Covers(cert *x509.Certificate) bool {
+	return a.Certificates[sha256.Sum256(cert.Raw)] || a.Certificates[SubjectSPKIHash(cert)]
+}
+
+// Audits are annual, and the statement is due within three months of the end
+// of the period, so an audit stays current for this long after its period
+// ends.
+const auditYears, auditGraceMonths = 1, 3
+
+// CurrentAt reports whether the next audit period is not yet overdue at t.
+func (a AuditStatement) CurrentAt(t time.Time) bool {
+	return !t.After(a.PeriodEnd.AddDate(auditYears, auditGraceMonths, 0))
+}
+
+// An AuditGap is an unexpired, technically unconstrained CA certificate that
+// no current BR audit covers.
+type AuditGap struct {
+	Cert   *x509.Certificate
+	Reason string
+	// LastAudit is the most recent BR audit covering Cert, if any.
+	LastAudit *AuditStatement
+}
+
+// FindAuditGaps returns the certificates that, at the given time, are
+// neither technically constrained nor covered by a current BR audit. Policy
+// requires every unconstrained intermediate to be one or the other.
+func FindAuditGaps(certs []*x509.Certificate, audits []AuditStatement, at time.Time) []AuditGap {
+	var gaps []AuditGap
+	for _, cert := range certs {
+		if at.After(cert.NotAfter) {
+			continue
+		}
+		if AnalyzeTechnicalConstraints(cert).Constrained {
+			continue
+		}
+
+		var last *AuditStatement
+		current := false
+		for i := range audits {
+			audit := &audits[i]
+			if !audit.IsBRAudit() || !audit.Covers(cert) || audit.PeriodStart.After(at) {
+				continue
+			}
+			if last == nil || audit.PeriodEnd.After(last.PeriodEnd) {
+				last = audit
+			}
+			if audit.CurrentAt(at) {
+				current = true
+			}
+		}
+		if current {
+			continue
+		}
+
+		gap := AuditGap{Cert: cert, LastAudit: last, Reason: "no BR audit covers it"}
+		if last != nil {
+			gap.Reason = fmt.Sprintf("the last BR audit period ended %s", last.PeriodEnd.Format("2006-01-02"))
+		}
+		gaps = append(gaps, gap)
+	}
+	return gaps
+}
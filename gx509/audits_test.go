@@ -0,0 +1,124 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseAuditStatements(t *testing.T) {
+	t.Parallel()
+
+	intermediate := testChain(t, "www.example.com")[1]
+	data := fmt.Sprintf(`
+audits:
+  - auditor: Example Auditors LLP
+    standards: ["WebTrust for CAs", "WebTrust for CAs - SSL Baseline with Network Security"]
+    periodStart: 2022-04-01
+    periodEnd: 2023-03-31
+    statementDate: 2023-06-15
+    certificates:
+      - %X
+`, sha256.Sum256(intermediate.Raw))
+
+	audits, err := ParseAuditStatements([]byte(data))
+	if err != nil {
+		t.Fatalf("Could not parse audits: %s", err)
+	}
+	if len(audits) != 1 {
+		t.Fatalf("Expected 1 audit, got %d", len(audits))
+	}
+	audit := audits[0]
+	if audit.Auditor != "Example Auditors LLP" || !audit.IsBRAudit() || !audit.Covers(intermediate) {
+		t.Errorf("Unexpected audit: %+v", audit)
+	}
+	if !audit.PeriodEnd.Equal(time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected period end: %s", audit.PeriodEnd)
+	}
+
+	for _, invalid := range []string{
+		"audits:\n  - periodEnd: 2023-03-31\n",
+		"audits:\n  - standards: [ETSI EN 319 411-1]\n",
+		"audits:\n  - standards: [ETSI EN 319 411-1]\n    periodEnd: 2023-03-31\n    certificates: [abcd]\n",
+		"audit: []\n",
+	} {
+		if _, err := ParseAuditStatements([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestIsBRAudit(t *testing.T) {
+	t.Parallel()
+
+	for standards, expected := range map[string]bool{
+		"WebTrust for CAs - SSL Baseline":            true,
+		"ETSI EN 319 411-1":                          true,
+		"WebTrust BR":                                true,
+		"WebTrust for CAs":                           false,
+		"WebTrust for CAs - Extended Validation SSL": false,
+		"BRAND New Standard":                         false,
+	} {
+		audit := AuditStatement{Standards: []string{standards}}
+		if audit.IsBRAudit() != expected {
+			t.Errorf("%s: expected %v", standards, expected)
+		}
+	}
+}
+
+func TestFindAuditGaps(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	audited := testCA(t, "Audited CA", nil, at.AddDate(5, 0, 0))
+	stale := testCA(t, "Stale CA", nil, at.AddDate(5, 0, 0))
+	unaudited := testCA(t, "Unaudited CA", nil, at.AddDate(5, 0, 0))
+	expired := testCA(t, "Expired CA", nil, at.AddDate(-1, 0, 0))
+	constrained := constrainedIntermediate(t, []string{"example.com"})
+
+	audits := []AuditStatement{
+		{
+			Standards:   []string{"WebTrust for CAs - SSL Baseline"},
+			PeriodStart: time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:   time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC),
+			// Matched by Subject + SPKI hash, as for a reissue
+			Certificates: map[[sha256.Size]byte]bool{SubjectSPKIHash(audited): true},
+		},
+		{
+			Standards:    []string{"WebTrust for CAs - SSL Baseline"},
+			PeriodStart:  time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:    time.Date(2022, time.March, 31, 0, 0, 0, 0, time.UTC),
+			Certificates: map[[sha256.Size]byte]bool{sha256.Sum256(stale.Raw): true},
+		},
+		{
+			// Not a BR audit, so it does not count
+			Standards:    []string{"WebTrust for CAs"},
+			PeriodStart:  time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:    time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC),
+			Certificates: map[[sha256.Size]byte]bool{sha256.Sum256(unaudited.Raw): true},
+		},
+	}
+
+	gaps := FindAuditGaps([]*x509.Certificate{audited, stale, unaudited, expired, constrained}, audits, at)
+	if len(gaps) != 2 {
+		t.Fatalf("Expected 2 gaps, got %d: %+v", len(gaps), gaps)
+	}
+	if gaps[0].Cert != stale || gaps[0].LastAudit != &audits[1] ||
+		gaps[0].Reason != "the last BR audit period ended 2022-03-31" {
+		t.Errorf("Unexpected gap for the stale CA: %+v", gaps[0])
+	}
+	if gaps[1].Cert != unaudited || gaps[1].LastAudit != nil || gaps[1].Reason != "no BR audit covers it" {
+		t.Errorf("Unexpected gap for the unaudited CA: %+v", gaps[1])
+	}
+
+	// The first audit lapses once the next statement is overdue
+	if gaps := FindAuditGaps([]*x509.Certificate{audited}, audits, time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC)); len(gaps) != 1 {
+		t.Errorf("Expected the audit to have lapsed, got %+v", gaps)
+	}
+}
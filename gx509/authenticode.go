@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	peSecurityDirectory  = 4
+	winCertTypePKCS7     = 0x0002
+	winCertificateHeader = 8
+	// maxAuthenticodeSize bounds the certificate table read from a PE file.
+	maxAuthenticodeSize = 16 << 20
+)
+
+// ExtractAuthenticode reads the Authenticode signatures embedded in a PE
+// file, including those nested inside another for dual signing. Unsigned
+// files have none.
+func ExtractAuthenticode(r io.ReaderAt) ([]CodeSignature, error) {
+	file, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var directory pe.DataDirectory
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > peSecurityDirectory {
+			directory = header.DataDirectory[peSecurityDirectory]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > peSecurityDirectory {
+			directory = header.DataDirectory[peSecurityDirectory]
+		}
+	}
+	if directory.Size == 0 {
+		return nil, nil
+	}
+	if directory.Size > maxAuthenticodeSize {
+		return nil, fmt.Errorf("Certificate table of %d bytes is too large", directory.Size)
+	}
+
+	// The security directory's address is a file offset, not an RVA
+	table := make([]byte, directory.Size)
+	if _, err := r.ReadAt(table, int64(directory.VirtualAddress)); err != nil {
+		return nil, fmt.Errorf("Could not read certificate table: %s", err)
+	}
+
+	var signatures []CodeSignature
+	for len(table) >= winCertificateHeader {
+		length := binary.LittleEndian.Uint32(table)
+		certType := binary.LittleEndian.Uint16(table[6:])
+		if length < winCertificateHeader || uint64(length) > uint64(len(table)) {
+			return nil, fmt.Errorf("Malformed certificate table entry")
+		}
+		if certType == winCertTypePKCS7 {
+			found, err := parseCMSSignatures(table[winCertificateHeader:length], CodeSignatureAuthenticode, 0)
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, found...)
+		}
+
+		// Entries are padded to eight bytes
+		next := (uint64(length) + 7) &^ 7
+		if next >= uint64(len(table)) {
+			break
+		}
+		table = table[next:]
+	}
+	return signatures, nil
+}
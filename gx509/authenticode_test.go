@@ -0,0 +1,174 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// testSignedData builds a PKCS#7 ContentInfo carrying certs, with one signer
+// identifying signer by issuer and serial number. The signature is junk.
+func testSignedData(t *testing.T, signer *x509.Certificate, digest asn1.ObjectIdentifier, attributes []pkcs7Attribute, certs ...*x509.Certificate) []byte {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	content, _ := asn1.Marshal(contentInfo{ContentType: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}})
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      asn1.RawValue{FullBytes: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: signer.RawIssuer},
+				SerialNumber: signer.SerialNumber,
+			},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: digest},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+			EncryptedDigest:           []byte("signature"),
+			UnauthenticatedAttributes: attributes,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal SignedData: %s", err)
+	}
+	info, err := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data}})
+	if err != nil {
+		t.Fatalf("Could not marshal ContentInfo: %s", err)
+	}
+	return info
+}
+
+// testPE builds a section-less PE32+ file whose certificate table holds
+// signature.
+func testPE(signature []byte) []byte {
+	var file bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	file.Write(dos)
+	file.WriteString("PE\x00\x00")
+
+	header := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	binary.Write(&file, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		SizeOfOptionalHeader: uint16(binary.Size(header)),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE,
+	})
+	offset := file.Len() + binary.Size(header)
+	length := winCertificateHeader + len(signature)
+	header.DataDirectory[peSecurityDirectory] = pe.DataDirectory{
+		VirtualAddress: uint32(offset),
+		Size:           uint32((length + 7) &^ 7),
+	}
+	binary.Write(&file, binary.LittleEndian, header)
+
+	binary.Write(&file, binary.LittleEndian, struct {
+		Length   uint32
+		Revision uint16
+		Type     uint16
+	}{uint32(length), 0x0200, winCertTypePKCS7})
+	file.Write(signature)
+	file.Write(make([]byte, (8-length%8)%8))
+	return file.Bytes()
+}
+
+func testCodeSigningChain(t *testing.T) []*x509.Certificate {
+	root := testCA(t, "Σ Acme Co Code Signing Root", nil, time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC))
+	intermediate := issueAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Σ Acme Co Code Signing CA"},
+		NotBefore:             time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2035, time.January, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, root)
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Acme Co"},
+		NotBefore:    time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, intermediate)
+	return []*x509.Certificate{leaf, intermediate, root}
+}
+
+func TestExtractAuthenticode(t *testing.T) {
+	t.Parallel()
+
+	chain := testCodeSigningChain(t)
+	tlsChain := testChain(t, "www.example.com")
+	nested := testSignedData(t, tlsChain[0], oidSHA256, nil, tlsChain[1], tlsChain[0])
+	signature := testSignedData(t, chain[0], asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, []pkcs7Attribute{
+		{Type: oidNestedSignature, Values: []asn1.RawValue{{FullBytes: nested}}},
+	}, chain[1], chain[0])
+
+	signatures, err := ExtractAuthenticode(bytes.NewReader(testPE(signature)))
+	if err != nil {
+		t.Fatalf("Could not extract signatures: %s", err)
+	}
+	if len(signatures) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(signatures))
+	}
+
+	outer := signatures[0]
+	if !outer.Signer.Equal(chain[0]) || len(outer.Chain) != 2 || !outer.Chain[1].Equal(chain[1]) ||
+		outer.DigestAlgorithm != "SHA-1" || outer.Timestamped {
+		t.Errorf("Unexpected outer signature: %+v", outer)
+	}
+	if !signatures[1].Signer.Equal(tlsChain[0]) || signatures[1].DigestAlgorithm != "SHA-256" {
+		t.Errorf("Unexpected nested signature: %+v", signatures[1])
+	}
+
+	at := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	expected := []string{"Weak key: RSA 512", "Signed with SHA-1 digests"}
+	if problems := AnalyzeCodeSigning(outer, at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	expected = []string{
+		"Signer lacks the codeSigning extended key usage",
+		"Signer expired 2018-06-01 and the signature has no timestamp",
+		"Weak key: RSA 512",
+		"Σ Acme Co Issuing CA does not permit code signing",
+	}
+	if problems := AnalyzeCodeSigning(signatures[1], at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	outer.Timestamped = true
+	if problems := AnalyzeCodeSigning(outer, at.AddDate(2, 0, 0)); !reflect.DeepEqual(problems, []string{"Weak key: RSA 512", "Signed with SHA-1 digests"}) {
+		t.Errorf("Unexpected problems for a timestamped signature %v", problems)
+	}
+}
+
+func TestExtractAuthenticodeUnsigned(t *testing.T) {
+	t.Parallel()
+
+	unsigned := testPE(nil)
+	// Clear the certificate table entry
+	binary.LittleEndian.PutUint32(unsigned[64+4+20+144+4:], 0)
+	signatures, err := ExtractAuthenticode(bytes.NewReader(unsigned))
+	if err != nil || len(signatures) != 0 {
+		t.Errorf("Expected no signatures, got %d and %v", len(signatures), err)
+	}
+
+	if _, err := ExtractAuthenticode(bytes.NewReader([]byte("not a PE file"))); err == nil {
+		t.Errorf("Expected an error for a file that is not PE")
+	}
+}
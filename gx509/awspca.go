@@ -0,0 +1,282 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// signAWSv4 adds a Signature Version 4 Authorization header to req, signing
+// its host, its other headers and body for service in region.
+func signAWSv4(req *http.Request, body []byte, accessKeyID, secretAccessKey, sessionToken, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(sessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	if len(req.Host) > 0 {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, query, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, hex.EncodeToString(key)))
+}
+
+// AWSPrivateCA reads AWS Private Certificate Authority (ACM-PCA) through its
+// JSON API.
+type AWSPrivateCA struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed for temporary credentials.
+	SessionToken string
+	// Endpoint defaults to the regional ACM-PCA endpoint.
+	Endpoint string
+	Client   *http.Client
+	// AuditEntries are the certificates IssuedCertificates examines, from
+	// audit reports.
+	AuditEntries []AWSAuditEntry
+}
+
+// NewAWSPrivateCA returns a client for ACM-PCA in region.
+func NewAWSPrivateCA(region, accessKeyID, secretAccessKey, sessionToken string) *AWSPrivateCA {
+	return &AWSPrivateCA{
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		Endpoint:        fmt.Sprintf("https://acm-pca.%s.amazonaws.com/", region),
+		Client:          &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// call invokes action with input and decodes the response into output.
+func (a *AWSPrivateCA) call(action string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", a.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "ACMPrivateCA."+action)
+	signAWSv4(req, body, a.AccessKeyID, a.SecretAccessKey, a.SessionToken, a.Region, "acm-pca", time.Now())
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(data, &failure) != nil || len(failure.Type) == 0 {
+			return fmt.Errorf("ACM-PCA returned %s for %s", resp.Status, action)
+		}
+		// Types are namespaced, as in com.amazonaws.acmpca#ResourceNotFoundException
+		failure.Type = failure.Type[strings.LastIndex(failure.Type, "#")+1:]
+		return fmt.Errorf("ACM-PCA returned %s for %s: %s", failure.Type, action, failure.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("Could not decode ACM-PCA response for %s: %s", action, err)
+	}
+	return nil
+}
+
+// Provider is "aws-pca".
+func (a *AWSPrivateCA) Provider() string {
+	return "aws-pca"
+}
+
+// CertificateAuthorities returns the account's private CAs in the region,
+// with their certificates. The Status of each is ACTIVE, DISABLED,
+// PENDING_CERTIFICATE and so on.
+func (a *AWSPrivateCA) CertificateAuthorities() ([]CloudCertificateAuthority, error) {
+	var cas []CloudCertificateAuthority
+	input := map[string]string{}
+	for {
+		var output struct {
+			CertificateAuthorities []struct {
+				Arn    string
+				Type   string
+				Status string
+			}
+			NextToken string
+		}
+		if err := a.call("ListCertificateAuthorities", input, &output); err != nil {
+			return nil, err
+		}
+		for _, entry := range output.CertificateAuthorities {
+			ca := CloudCertificateAuthority{ID: entry.Arn, Root: entry.Type == "ROOT", Status: entry.Status}
+			if entry.Status != "PENDING_CERTIFICATE" && entry.Status != "CREATING" && entry.Status != "FAILED" {
+				var certs struct {
+					Certificate      string
+					CertificateChain string
+				}
+				if err := a.call("GetCertificateAuthorityCertificate", map[string]string{"CertificateAuthorityArn": entry.Arn}, &certs); err != nil {
+					return nil, err
+				}
+				parsed, err := parseCertificatesPEM([]byte(certs.Certificate + "\n" + certs.CertificateChain))
+				if err != nil {
+					return nil, fmt.Errorf("Could not parse the certificate of %s: %s", entry.Arn, err)
+				}
+				if len(parsed) > 0 {
+					ca.Cert, ca.Chain = parsed[0], parsed[1:]
+				}
+			}
+			cas = append(cas, ca)
+		}
+		if len(output.NextToken) == 0 {
+			return cas, nil
+		}
+		input["NextToken"] = output.NextToken
+	}
+}
+
+// IssuedCertificates fetches the certificates in AuditEntries issued since
+// the given time, as ACM-PCA cannot list them itself.
+func (a *AWSPrivateCA) IssuedCertificates(since time.Time) ([]CloudCertificate, error) {
+	var certs []CloudCertificate
+	for _, entry := range a.AuditEntries {
+		if entry.IssuedAt.Before(since) {
+			continue
+		}
+		cert, err := a.Certificate(entry.CertificateAuthorityARN(), entry.CertificateARN)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, CloudCertificate{
+			ID:       entry.CertificateARN,
+			Issuer:   entry.CertificateAuthorityARN(),
+			IssuedAt: entry.IssuedAt,
+			Template: entry.TemplateARN,
+			Risks:    AWSTemplateRisks(entry.TemplateARN),
+			Cert:     cert,
+		})
+	}
+	return certs, nil
+}
+
+// Certificate returns a certificate the CA with caARN issued.
+func (a *AWSPrivateCA) Certificate(caARN, certARN string) (*x509.Certificate, error) {
+	var output struct {
+		Certificate string
+	}
+	input := map[string]string{"CertificateAuthorityArn": caARN, "CertificateArn": certARN}
+	if err := a.call("GetCertificate", input, &output); err != nil {
+		return nil, err
+	}
+	certs, err := parseCertificatesPEM([]byte(output.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", certARN, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s has no certificate", certARN)
+	}
+	return certs[0], nil
+}
+
+// An AWSAuditEntry is a certificate listed in an ACM-PCA audit report, which
+// is the only record ACM-PCA keeps of what a CA has issued.
+type AWSAuditEntry struct {
+	CertificateARN string    `json:"certificateArn"`
+	Serial         string    `json:"serial"`
+	Subject        string    `json:"subject"`
+	IssuedAt       time.Time `json:"issuedAt"`
+	TemplateARN    string    `json:"templateArn"`
+}
+
+// CertificateAuthorityARN returns the ARN of the CA that issued the
+// certificate, which prefixes its own ARN.
+func (e AWSAuditEntry) CertificateAuthorityARN() string {
+	if i := strings.Index(e.CertificateARN, "/certificate/"); i >= 0 {
+		return e.CertificateARN[:i]
+	}
+	return ""
+}
+
+// ParseAWSAuditReport decodes a JSON audit report, as written to S3 by
+// CreateCertificateAuthorityAuditReport.
+func ParseAWSAuditReport(data []byte) ([]AWSAuditEntry, error) {
+	var entries []AWSAuditEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("Could not decode audit report: %s", err)
+	}
+	return entries, nil
+}
+
+// AWSTemplateRisks describes what could go wrong with certificates issued
+// through the ACM-PCA template with templateARN.
+func AWSTemplateRisks(templateARN string) []string {
+	// ARNs look like arn:aws:acm-pca:::template/EndEntityCertificate_APIPassthrough/V1
+	name := templateARN
+	if i := strings.LastIndex(templateARN, "template/"); i >= 0 {
+		name = templateARN[i+len("template/"):]
+	}
+	var risks []string
+	if strings.Contains(name, "CACertificate") {
+		risks = append(risks, "issues CA certificates")
+	}
+	if strings.Contains(name, "CSRPassthrough") {
+		risks = append(risks, "copies extensions from the CSR, which the requester controls")
+	}
+	if strings.Contains(name, "APIPassthrough") {
+		risks = append(risks, "copies extensions from the IssueCertificate call")
+	}
+	return risks
+}
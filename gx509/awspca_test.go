@@ -0,0 +1,162 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAWSv4(t *testing.T) {
+	t.Parallel()
+
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %s", err)
+	}
+	signAWSv4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service",
+		time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if authorization := req.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("Expected %s, got %s", expected, authorization)
+	}
+}
+
+// fakeAWSPrivateCA serves ACM-PCA actions with responses for each.
+func fakeAWSPrivateCA(t *testing.T, responses map[string]func(input map[string]string) interface{}) (*AWSPrivateCA, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		respond, ok := responses[strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "ACMPrivateCA.")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.acmpca#InvalidRequestException", "message": "unknown action"})
+			return
+		}
+		var input map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Errorf("Could not decode request: %s", err)
+		}
+		json.NewEncoder(w).Encode(respond(input))
+	}))
+	client := NewAWSPrivateCA("us-west-2", "AKID", "secret", "token")
+	client.Endpoint = server.URL + "/"
+	return client, server
+}
+
+func TestAWSPrivateCA(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	const caARN = "arn:aws:acm-pca:us-west-2:111122223333:certificate-authority/abc"
+	client, server := fakeAWSPrivateCA(t, map[string]func(map[string]string) interface{}{
+		"ListCertificateAuthorities": func(input map[string]string) interface{} {
+			if input["NextToken"] == "" {
+				return map[string]interface{}{
+					"CertificateAuthorities": []map[string]string{{"Arn": caARN, "Type": "SUBORDINATE", "Status": "ACTIVE", "UsageMode": "GENERAL_PURPOSE"}},
+					"NextToken":              "page2",
+				}
+			}
+			return map[string]interface{}{
+				"CertificateAuthorities": []map[string]string{{"Arn": caARN + "-new", "Type": "ROOT", "Status": "PENDING_CERTIFICATE"}},
+			}
+		},
+		"GetCertificateAuthorityCertificate": func(input map[string]string) interface{} {
+			return map[string]string{"Certificate": certificatePEM(chain[1]), "CertificateChain": certificatePEM(chain[2])}
+		},
+		"GetCertificate": func(input map[string]string) interface{} {
+			return map[string]string{"Certificate": certificatePEM(chain[0]), "CertificateChain": certificatePEM(chain[1])}
+		},
+	})
+	defer server.Close()
+
+	cas, err := client.CertificateAuthorities()
+	if err != nil {
+		t.Fatalf("Could not list CAs: %s", err)
+	}
+	if len(cas) != 2 {
+		t.Fatalf("Expected 2 CAs, got %d", len(cas))
+	}
+	if cas[0].Cert == nil || !cas[0].Cert.Equal(chain[1]) || len(cas[0].Chain) != 1 || cas[0].Root || cas[0].Status != "ACTIVE" {
+		t.Errorf("Wrong first CA: %+v", cas[0])
+	}
+	if cas[1].Cert != nil || !cas[1].Root || cas[1].Status != "PENDING_CERTIFICATE" {
+		t.Errorf("A pending CA should have no certificate: %+v", cas[1])
+	}
+
+	cert, err := client.Certificate(caARN, caARN+"/certificate/01")
+	if err != nil {
+		t.Fatalf("Could not get certificate: %s", err)
+	}
+	if !cert.Equal(chain[0]) {
+		t.Errorf("Wrong certificate %s", cert.Subject.CommonName)
+	}
+
+	client.AuditEntries = []AWSAuditEntry{
+		{CertificateARN: caARN + "/certificate/01", IssuedAt: time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC), TemplateARN: "arn:aws:acm-pca:::template/EndEntityCertificate_APIPassthrough/V1"},
+		{CertificateARN: caARN + "/certificate/02", IssuedAt: time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	issued, err := client.IssuedCertificates(time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Could not get issued certificates: %s", err)
+	}
+	if len(issued) != 1 || issued[0].Issuer != caARN || len(issued[0].Risks) != 1 || !issued[0].Cert.Equal(chain[0]) {
+		t.Errorf("Unexpected issued certificates %+v", issued)
+	}
+
+	if err := client.call("DeleteCertificateAuthority", map[string]string{}, &struct{}{}); err == nil || !strings.Contains(err.Error(), "InvalidRequestException for DeleteCertificateAuthority: unknown action") {
+		t.Errorf("Expected the ACM-PCA error, got %v", err)
+	}
+}
+
+func TestParseAWSAuditReport(t *testing.T) {
+	t.Parallel()
+
+	entries, err := ParseAWSAuditReport([]byte(`[{
+		"awsAccountId": "111122223333",
+		"certificateArn": "arn:aws:acm-pca:us-west-2:111122223333:certificate-authority/abc/certificate/0a1b",
+		"serial": "0a:1b",
+		"subject": "CN=www.example.com",
+		"notBefore": "2023-01-01T00:00:00+0000",
+		"issuedAt": "2023-01-01T00:05:00Z",
+		"templateArn": "arn:aws:acm-pca:::template/EndEntityCertificate/V1"
+	}]`))
+	if err != nil {
+		t.Fatalf("Could not parse audit report: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if ca := entries[0].CertificateAuthorityARN(); ca != "arn:aws:acm-pca:us-west-2:111122223333:certificate-authority/abc" {
+		t.Errorf("Wrong CA ARN %s", ca)
+	}
+	if !entries[0].IssuedAt.Equal(time.Date(2023, time.January, 1, 0, 5, 0, 0, time.UTC)) {
+		t.Errorf("Wrong issue time %s", entries[0].IssuedAt)
+	}
+}
+
+func TestAWSTemplateRisks(t *testing.T) {
+	t.Parallel()
+
+	for template, expected := range map[string][]string{
+		"arn:aws:acm-pca:::template/EndEntityCertificate/V1":                                  nil,
+		"arn:aws:acm-pca:::template/EndEntityCertificate_APIPassthrough/V1":                   {"copies extensions from the IssueCertificate call"},
+		"arn:aws:acm-pca:::template/SubordinateCACertificate_PathLen0/V1":                     {"issues CA certificates"},
+		"arn:aws:acm-pca:::template/BlankSubordinateCACertificate_PathLen0_CSRPassthrough/V1": {"issues CA certificates", "copies extensions from the CSR, which the requester controls"},
+	} {
+		if risks := AWSTemplateRisks(template); !reflect.DeepEqual(risks, expected) {
+			t.Errorf("%s: expected %v, got %v", template, expected, risks)
+		}
+	}
+}
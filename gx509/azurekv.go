@@ -0,0 +1,233 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// azureKeyVaultAPIVersion is the Key Vault REST API version requested.
+const azureKeyVaultAPIVersion = "7.4"
+
+// AzureKeyVault reads the certificates of an Azure Key Vault through its REST
+// API. Key Vault is not a CA service itself, so the CA certificates in the
+// vault are taken as its authorities, and the rest as what they issued.
+type AzureKeyVault struct {
+	// VaultURL is the vault, such as https://example.vault.azure.net.
+	VaultURL string
+	// Token is an access token for https://vault.azure.net, as printed by
+	// 'az account get-access-token --resource https://vault.azure.net'.
+	Token  string
+	Client *http.Client
+
+	certificates []azureCertificate
+}
+
+// NewAzureKeyVault returns a client for the vault at vaultURL.
+func NewAzureKeyVault(vaultURL, token string) *AzureKeyVault {
+	return &AzureKeyVault{
+		VaultURL: strings.TrimSuffix(vaultURL, "/"),
+		Token:    token,
+		Client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// get decodes the resource at target, which is either a path in the vault
+// or a URL the vault returned, into output.
+func (v *AzureKeyVault) get(target string, output interface{}) error {
+	if !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "http://") {
+		target = v.VaultURL + target
+	}
+	if !strings.Contains(target, "api-version=") {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + "api-version=" + azureKeyVaultAPIVersion
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+v.Token)
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) != nil || len(failure.Error.Code) == 0 {
+			return fmt.Errorf("Key Vault returned %s for %s", resp.Status, target)
+		}
+		return fmt.Errorf("Key Vault returned %s for %s: %s", failure.Error.Code, target, failure.Error.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("Could not decode Key Vault response for %s: %s", target, err)
+	}
+	return nil
+}
+
+// An azureCertificatePolicy is the part of a Key Vault certificate policy
+// that decides what the certificate's renewals will look like.
+type azureCertificatePolicy struct {
+	KeyProperties struct {
+		Exportable bool   `json:"exportable"`
+		KeyType    string `json:"kty"`
+		KeySize    int    `json:"key_size"`
+	} `json:"key_props"`
+	X509Properties struct {
+		ValidityMonths int `json:"validity_months"`
+	} `json:"x509_props"`
+	Issuer struct {
+		Name string `json:"name"`
+	} `json:"issuer"`
+}
+
+// risks describes what the policy lets the certificate's renewals be.
+func (p azureCertificatePolicy) risks(cert *x509.Certificate) []string {
+	var risks []string
+	if p.KeyProperties.Exportable {
+		risks = append(risks, "its private key is exportable")
+	}
+	if strings.HasPrefix(p.KeyProperties.KeyType, "RSA") && p.KeyProperties.KeySize > 0 && p.KeyProperties.KeySize < 2048 {
+		risks = append(risks, fmt.Sprintf("its policy creates %d-bit RSA keys", p.KeyProperties.KeySize))
+	}
+	// 13 months is the most that fits in the lifetime browsers accept
+	if !cert.IsCA && p.X509Properties.ValidityMonths > 13 {
+		risks = append(risks, fmt.Sprintf("its policy issues for %d months, beyond the %d day limit for TLS server certificates",
+			p.X509Properties.ValidityMonths, int(maxServerLeafLifetime/(24*time.Hour))))
+	}
+	return risks
+}
+
+type azureCertificate struct {
+	ID      string
+	Created time.Time
+	Cert    *x509.Certificate
+	Policy  azureCertificatePolicy
+}
+
+// load fetches the vault's certificates the first time it is called.
+func (v *AzureKeyVault) load() ([]azureCertificate, error) {
+	if v.certificates != nil {
+		return v.certificates, nil
+	}
+	certificates := []azureCertificate{}
+	next := "/certificates"
+	for len(next) > 0 {
+		var page struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if err := v.get(next, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Value {
+			var entry struct {
+				ID         string `json:"id"`
+				CER        string `json:"cer"`
+				Attributes struct {
+					Created int64 `json:"created"`
+				} `json:"attributes"`
+				Policy azureCertificatePolicy `json:"policy"`
+			}
+			if err := v.get(item.ID, &entry); err != nil {
+				return nil, err
+			}
+			der, err := base64.StdEncoding.DecodeString(entry.CER)
+			if err != nil {
+				return nil, fmt.Errorf("Could not decode %s: %s", entry.ID, err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse %s: %s", entry.ID, err)
+			}
+			certificates = append(certificates, azureCertificate{
+				ID:      entry.ID,
+				Created: time.Unix(entry.Attributes.Created, 0).UTC(),
+				Cert:    cert,
+				Policy:  entry.Policy,
+			})
+		}
+		next = page.NextLink
+	}
+	v.certificates = certificates
+	return certificates, nil
+}
+
+// Provider is "azure-keyvault".
+func (v *AzureKeyVault) Provider() string {
+	return "azure-keyvault"
+}
+
+// CertificateAuthorities returns the CA certificates in the vault. The
+// Status of each is the issuer of its policy, such as Self.
+func (v *AzureKeyVault) CertificateAuthorities() ([]CloudCertificateAuthority, error) {
+	certificates, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	var cas []CloudCertificateAuthority
+	for _, certificate := range certificates {
+		if !certificate.Cert.IsCA {
+			continue
+		}
+		cas = append(cas, CloudCertificateAuthority{
+			ID:     certificate.ID,
+			Root:   bytes.Equal(certificate.Cert.RawIssuer, certificate.Cert.RawSubject),
+			Status: certificate.Policy.Issuer.Name,
+			Risks:  certificate.Policy.risks(certificate.Cert),
+			Cert:   certificate.Cert,
+		})
+	}
+	return cas, nil
+}
+
+// IssuedCertificates returns the other certificates in the vault created
+// since the given time. The Issuer of each is the ID of the CA in the vault
+// that issued it, if there is one.
+func (v *AzureKeyVault) IssuedCertificates(since time.Time) ([]CloudCertificate, error) {
+	certificates, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	var certs []CloudCertificate
+	for _, certificate := range certificates {
+		if certificate.Cert.IsCA || certificate.Created.Before(since) {
+			continue
+		}
+		cert := CloudCertificate{
+			ID:       certificate.ID,
+			IssuedAt: certificate.Created,
+			Template: certificate.Policy.Issuer.Name,
+			Risks:    certificate.Policy.risks(certificate.Cert),
+			Cert:     certificate.Cert,
+		}
+		for _, issuer := range certificates {
+			if issuer.Cert.IsCA && bytes.Equal(certificate.Cert.RawIssuer, issuer.Cert.RawSubject) && certificate.Cert.CheckSignatureFrom(issuer.Cert) == nil {
+				cert.Issuer = issuer.ID
+				break
+			}
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,88 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAzureKeyVault(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("api-version") != azureKeyVaultAPIVersion {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		certificate := func(name string, index int, created time.Time, policy map[string]interface{}) map[string]interface{} {
+			return map[string]interface{}{
+				"id":         server.URL + "/certificates/" + name + "/v1",
+				"cer":        base64.StdEncoding.EncodeToString(chain[index].Raw),
+				"attributes": map[string]interface{}{"created": created.Unix()},
+				"policy":     policy,
+			}
+		}
+		var response interface{}
+		switch r.URL.Path {
+		case "/certificates":
+			if r.URL.Query().Get("page") == "" {
+				response = map[string]interface{}{
+					"value":    []interface{}{map[string]string{"id": server.URL + "/certificates/root/v1"}, map[string]string{"id": server.URL + "/certificates/issuing/v1"}},
+					"nextLink": server.URL + "/certificates?api-version=" + azureKeyVaultAPIVersion + "&page=2",
+				}
+			} else {
+				response = map[string]interface{}{"value": []interface{}{map[string]string{"id": server.URL + "/certificates/www/v1"}}}
+			}
+		case "/certificates/root/v1":
+			response = certificate("root", 2, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), map[string]interface{}{"issuer": map[string]string{"name": "Self"}})
+		case "/certificates/issuing/v1":
+			response = certificate("issuing", 1, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), map[string]interface{}{"issuer": map[string]string{"name": "Unknown"}})
+		case "/certificates/www/v1":
+			response = certificate("www", 0, time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC), map[string]interface{}{
+				"key_props":  map[string]interface{}{"exportable": true, "kty": "RSA", "key_size": 1024},
+				"x509_props": map[string]interface{}{"validity_months": 24},
+				"issuer":     map[string]string{"name": "Unknown"},
+			})
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	vault := NewAzureKeyVault(server.URL+"/", "token")
+	cas, err := vault.CertificateAuthorities()
+	if err != nil {
+		t.Fatalf("Could not list CAs: %s", err)
+	}
+	if len(cas) != 2 || !cas[0].Root || cas[0].Status != "Self" || cas[1].Root || !cas[1].Cert.Equal(chain[1]) {
+		t.Fatalf("Unexpected CAs %+v", cas)
+	}
+
+	certs, err := vault.IssuedCertificates(time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Could not list certificates: %s", err)
+	}
+	if len(certs) != 1 || certs[0].Issuer != server.URL+"/certificates/issuing/v1" || !certs[0].Cert.Equal(chain[0]) {
+		t.Fatalf("Unexpected certificates %+v", certs)
+	}
+	expected := []string{
+		"its private key is exportable",
+		"its policy creates 1024-bit RSA keys",
+		"its policy issues for 24 months, beyond the 398 day limit for TLS server certificates",
+	}
+	if !reflect.DeepEqual(certs[0].Risks, expected) {
+		t.Errorf("Expected %v, got %v", expected, certs[0].Risks)
+	}
+}
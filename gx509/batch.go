@@ -0,0 +1,288 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBatchLine is the longest line RunBatch accepts, enough for a CT entry
+// with its chain.
+const maxBatchLine = 16 << 20
+
+// CT MerkleTreeLeaf entry types, from RFC 6962, section 3.4.
+const (
+	ctX509Entry    = 0
+	ctPrecertEntry = 1
+)
+
+// readUint24 splits a value with a 24-bit length prefix, as CT encodes
+// certificates, from the start of data.
+func readUint24(data []byte) ([]byte, []byte, error) {
+	if len(data) < 3 {
+		return nil, nil, fmt.Errorf("Truncated length")
+	}
+	length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+	if len(data)-3 < length {
+		return nil, nil, fmt.Errorf("Truncated value of %d bytes", length)
+	}
+	return data[3 : 3+length], data[3+length:], nil
+}
+
+// parseMerkleTreeLeaf returns the certificate a CT log entry logs: that in
+// leaf for an x509_entry, or the precertificate in extra, the entry's
+// extra_data, for a precert_entry, whose leaf holds only the TBSCertificate.
+func parseMerkleTreeLeaf(leaf, extra []byte) (*x509.Certificate, error) {
+	// version, leaf_type, timestamp and entry_type
+	if len(leaf) < 12 {
+		return nil, fmt.Errorf("MerkleTreeLeaf of %d bytes is too short", len(leaf))
+	}
+	if leaf[0] != 0 || leaf[1] != 0 {
+		return nil, fmt.Errorf("Unsupported MerkleTreeLeaf version %d or leaf type %d", leaf[0], leaf[1])
+	}
+	var der []byte
+	var err error
+	switch entryType := binary.BigEndian.Uint16(leaf[10:12]); entryType {
+	case ctX509Entry:
+		der, _, err = readUint24(leaf[12:])
+	case ctPrecertEntry:
+		if len(extra) == 0 {
+			return nil, fmt.Errorf("Precertificate entries need their extra_data")
+		}
+		der, _, err = readUint24(extra)
+	default:
+		return nil, fmt.Errorf("Unsupported MerkleTreeLeaf entry type %d", entryType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode MerkleTreeLeaf: %s", err)
+	}
+	return parseCertificate(der)
+}
+
+// parseBatchEntry parses one entry of RunBatch's input: a PEM block, a line
+// of base64 DER or CT MerkleTreeLeaf, or a line of JSON with the leaf_input
+// and extra_data of a CT get-entries entry.
+func parseBatchEntry(text string) (*x509.Certificate, error) {
+	var cert *x509.Certificate
+	var err error
+	switch {
+	case strings.HasPrefix(text, "-----BEGIN "):
+		block, _ := pem.Decode([]byte(text))
+		if block == nil {
+			return nil, fmt.Errorf("Could not decode PEM block")
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("Not a certificate: %s block", block.Type)
+		}
+		cert, err = parseCertificate(block.Bytes)
+	case strings.HasPrefix(text, "{"):
+		var entry struct {
+			LeafInput []byte `json:"leaf_input"`
+			ExtraData []byte `json:"extra_data"`
+		}
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("Could not decode CT entry: %s", err)
+		}
+		if len(entry.LeafInput) == 0 {
+			return nil, fmt.Errorf("CT entry has no leaf_input")
+		}
+		cert, err = parseMerkleTreeLeaf(entry.LeafInput, entry.ExtraData)
+	default:
+		der, decodeErr := base64.StdEncoding.DecodeString(text)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("Could not decode base64: %s", decodeErr)
+		}
+		// Certificates are SEQUENCEs; MerkleTreeLeafs start with version 0
+		if len(der) > 0 && der[0] == 0x30 {
+			cert, err = parseCertificate(der)
+		} else {
+			cert, err = parseMerkleTreeLeaf(der, nil)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse certificate: %s", err)
+	}
+	return cert, nil
+}
+
+// A batchEntry is the text of one entry of RunBatch's input.
+type batchEntry struct {
+	index int
+	line  int
+	text  string
+}
+
+// readBatchEntries splits r into entries, passing each to send until it
+// returns false. PEM blocks may span lines; every other entry is one line.
+// Blank lines and those starting with # are skipped.
+func readBatchEntries(r io.Reader, send func(batchEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxBatchLine)
+	index := 0
+	var block []string
+	blockLine := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if block != nil {
+			block = append(block, text)
+			if strings.HasPrefix(text, "-----END ") {
+				index++
+				if !send(batchEntry{index, blockLine, strings.Join(block, "\n")}) {
+					return nil
+				}
+				block = nil
+			}
+			continue
+		}
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case strings.HasPrefix(text, "-----BEGIN "):
+			block, blockLine = []string{text}, line
+		default:
+			index++
+			if !send(batchEntry{index, line, text}) {
+				return nil
+			}
+		}
+	}
+	if block != nil {
+		// Unterminated, so parseBatchEntry reports it
+		index++
+		send(batchEntry{index, blockLine, strings.Join(block, "\n")})
+	}
+	return scanner.Err()
+}
+
+// A BatchResult is the analysis of one entry of RunBatch's input, as gx509
+// batch writes it.
+type BatchResult struct {
+	// Index is the entry's position in the input and Line the line it
+	// starts on, both from 1.
+	Index int `json:"index"`
+	Line  int `json:"line"`
+	// Error is why the entry could not be analyzed, if it could not.
+	Error string `json:"error,omitempty"`
+	// Certificate is the certificate analyzed, if it could be parsed.
+	Certificate *x509.Certificate `json:"-"`
+	*AnalyzedCertificate
+}
+
+// BatchOptions configure RunBatch.
+type BatchOptions struct {
+	// Workers is how many entries are analyzed at once, or the number of
+	// CPUs if zero.
+	Workers int
+	// Tenant's rules judge each certificate, or DefaultTenant's if nil.
+	Tenant *Tenant
+	// At is when lints are run as of.
+	At time.Time
+}
+
+// A BatchSummary counts what RunBatch analyzed.
+type BatchSummary struct {
+	Certificates int
+	Errors       int
+}
+
+// RunBatch analyzes each certificate read from r, which is named name, with
+// a pool of workers, and calls emit with each result in input order. It
+// stops at the first error from emit, which it returns.
+func RunBatch(name string, r io.Reader, options BatchOptions, emit func(BatchResult) error) (BatchSummary, error) {
+	workers := options.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	tenant := options.Tenant
+	if tenant == nil {
+		tenant = DefaultTenant
+	}
+
+	entries := make(chan batchEntry)
+	results := make(chan BatchResult)
+	// Results wait here until those before them are emitted, so a slow entry
+	// holds up at most the window
+	window := make(chan struct{}, 4*workers)
+	stop := make(chan struct{})
+
+	var readErr error
+	go func() {
+		defer close(entries)
+		readErr = readBatchEntries(r, func(entry batchEntry) bool {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return false
+			}
+			select {
+			case entries <- entry:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range entries {
+				result := BatchResult{Index: entry.index, Line: entry.line}
+				if cert, err := parseBatchEntry(entry.text); err != nil {
+					result.Error = err.Error()
+				} else {
+					analyzed := tenant.Analyze([]*x509.Certificate{cert}, options.At).Certificates[0]
+					analyzed.Name = name
+					result.Certificate, result.AnalyzedCertificate = cert, &analyzed
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var summary BatchSummary
+	var emitErr error
+	pending := make(map[int]BatchResult)
+	next := 1
+	for result := range results {
+		pending[result.Index] = result
+		for ready, ok := pending[next]; ok; ready, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-window
+			if emitErr != nil {
+				continue
+			}
+			if len(ready.Error) > 0 {
+				summary.Errors++
+			} else {
+				summary.Certificates++
+			}
+			if emitErr = emit(ready); emitErr != nil {
+				close(stop)
+			}
+		}
+	}
+	if emitErr != nil {
+		return summary, emitErr
+	}
+	return summary, readErr
+}
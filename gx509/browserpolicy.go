@@ -0,0 +1,273 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// A PolicyCA is a CA certificate that browser policy trusts only for the
+// names it lists, as Chrome's CACertificatesWithConstraints does.
+type PolicyCA struct {
+	Cert              *x509.Certificate
+	PermittedDNSNames []string
+	PermittedCIDRs    []string
+}
+
+// A BrowserPolicy is the CA trust that Chrome, Edge or another Chromium
+// browser's enterprise policies set.
+type BrowserPolicy struct {
+	// Trusted are the CACertificates, trusted for TLS server authentication.
+	Trusted []*x509.Certificate
+	// Constrained are the CACertificatesWithConstraints.
+	Constrained []PolicyCA
+	// Distrusted are the CADistrustedCertificates, which are not trusted even
+	// if the platform or browser trusts them.
+	Distrusted []*x509.Certificate
+	// Hints are the CAHintCertificates, which help build paths but are not
+	// trusted.
+	Hints []*x509.Certificate
+}
+
+// Roots are the CAs the policy trusts, with or without constraints.
+func (p *BrowserPolicy) Roots() []TrustedRoot {
+	var roots []TrustedRoot
+	for _, cert := range p.Trusted {
+		roots = append(roots, TrustedRoot{Label: cert.Subject.CommonName, Cert: cert, Trust: TrustServerAuth})
+	}
+	for _, ca := range p.Constrained {
+		roots = append(roots, TrustedRoot{Label: ca.Cert.Subject.CommonName, Cert: ca.Cert, Trust: TrustServerAuth})
+	}
+	return roots
+}
+
+// browserCAPolicies are the names of the policies about CAs.
+var browserCAPolicies = []string{"CACertificates", "CACertificatesWithConstraints", "CADistrustedCertificates", "CAHintCertificates"}
+
+func isBrowserCAPolicy(name string) bool {
+	for _, policy := range browserCAPolicies {
+		if name == policy {
+			return true
+		}
+	}
+	return false
+}
+
+type policyConstrainedCA struct {
+	Certificate string `json:"certificate"`
+	Constraints struct {
+		PermittedDNSNames []string `json:"permitted_dns_names"`
+		PermittedCIDRs    []string `json:"permitted_cidrs"`
+	} `json:"constraints"`
+}
+
+// parsePolicyCertificate decodes the base64 DER certificate a policy lists.
+func parsePolicyCertificate(policy, value string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: Could not decode certificate: %s", policy, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Could not parse certificate: %s", policy, err)
+	}
+	return cert, nil
+}
+
+// add adds the certificates that the named policy lists in values, each of
+// which is a base64 certificate or, for CACertificatesWithConstraints, a
+// JSON object. Policies not about CAs are ignored.
+func (p *BrowserPolicy) add(policy string, values []string) error {
+	var list *[]*x509.Certificate
+	switch policy {
+	case "CACertificates":
+		list = &p.Trusted
+	case "CADistrustedCertificates":
+		list = &p.Distrusted
+	case "CAHintCertificates":
+		list = &p.Hints
+	case "CACertificatesWithConstraints":
+		for _, value := range values {
+			var entry policyConstrainedCA
+			if err := json.Unmarshal([]byte(value), &entry); err != nil {
+				return fmt.Errorf("%s: %s", policy, err)
+			}
+			cert, err := parsePolicyCertificate(policy, entry.Certificate)
+			if err != nil {
+				return err
+			}
+			p.Constrained = append(p.Constrained, PolicyCA{
+				Cert:              cert,
+				PermittedDNSNames: entry.Constraints.PermittedDNSNames,
+				PermittedCIDRs:    entry.Constraints.PermittedCIDRs,
+			})
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	for _, value := range values {
+		cert, err := parsePolicyCertificate(policy, value)
+		if err != nil {
+			return err
+		}
+		*list = append(*list, cert)
+	}
+	return nil
+}
+
+// ParseBrowserPolicyJSON reads a JSON policy file, as Chrome and Edge read
+// from /etc/opt/chrome/policies and /etc/opt/edge/policies on Linux, and
+// returns the CA policies it sets.
+func ParseBrowserPolicyJSON(data []byte) (*BrowserPolicy, error) {
+	var policies map[string]json.RawMessage
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("Could not decode policy: %s", err)
+	}
+
+	policy := &BrowserPolicy{}
+	for _, name := range browserCAPolicies {
+		raw, ok := policies[name]
+		if !ok {
+			continue
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("%s: Expected a list", name)
+		}
+		values := make([]string, len(entries))
+		for i, entry := range entries {
+			// Certificates are strings, and constrained CAs objects
+			if err := json.Unmarshal(entry, &values[i]); err != nil {
+				values[i] = string(entry)
+			}
+		}
+		if err := policy.add(name, values); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// decodeRegistryExport returns the text of a .reg file, which regedit writes
+// in UTF-16 with a byte order mark.
+func decodeRegistryExport(data []byte) string {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		return strings.TrimPrefix(string(data), "\ufeff")
+	}
+	units := make([]uint16, (len(data)-2)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseRegistryString decodes a quoted .reg string at the start of s, and
+// returns it with the rest of s.
+func parseRegistryString(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "\"") {
+		return "", s, false
+	}
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:], true
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return "", s, false
+}
+
+// ParseBrowserPolicyRegistry reads a regedit export of browser policies, such
+// as of HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Google\Chrome or
+// \Microsoft\Edge, and returns the CA policies it sets. A list policy is
+// either a subkey of numbered values or a value holding a JSON list. Only
+// string values under a Policies key are read.
+func ParseBrowserPolicyRegistry(data []byte) (*BrowserPolicy, error) {
+	text := decodeRegistryExport(data)
+	if !strings.HasPrefix(text, "Windows Registry Editor") && !strings.HasPrefix(text, "REGEDIT4") {
+		return nil, fmt.Errorf("Not a registry export")
+	}
+
+	// Collect each policy's values in order, keyed by policy name
+	values := make(map[string][]string)
+	var order []string
+	key := ""
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			key = line[1 : len(line)-1]
+			continue
+		}
+		name, rest, ok := parseRegistryString(line)
+		if !ok || !strings.HasPrefix(rest, "=") || !strings.Contains(strings.ToLower(key), `\policies\`) {
+			continue
+		}
+		value, _, ok := parseRegistryString(rest[1:])
+		if !ok {
+			continue
+		}
+
+		policy, list := key[strings.LastIndex(key, `\`)+1:], []string{value}
+		if isBrowserCAPolicy(name) {
+			// A value holding the whole list as JSON
+			policy = name
+			var entries []json.RawMessage
+			if err := json.Unmarshal([]byte(value), &entries); err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			list = nil
+			for _, entry := range entries {
+				var s string
+				if err := json.Unmarshal(entry, &s); err != nil {
+					s = string(entry)
+				}
+				list = append(list, s)
+			}
+		}
+		if _, ok := values[policy]; !ok {
+			order = append(order, policy)
+		}
+		values[policy] = append(values[policy], list...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	policy := &BrowserPolicy{}
+	for _, name := range order {
+		if err := policy.add(name, values[name]); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// ParseBrowserPolicy reads browser policies from either a JSON policy file
+// or a registry export.
+func ParseBrowserPolicy(data []byte) (*BrowserPolicy, error) {
+	if text := strings.TrimSpace(decodeRegistryExport(data)); strings.HasPrefix(text, "{") {
+		return ParseBrowserPolicyJSON([]byte(text))
+	}
+	return ParseBrowserPolicyRegistry(data)
+}
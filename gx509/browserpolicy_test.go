@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func testBrowserPolicyCAs(t *testing.T) (root, intermediate, other *x509.Certificate) {
+	chain := testChain(t, "www.example.com")
+	other = testCA(t, "Other Root", nil, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+	return chain[2], chain[1], other
+}
+
+func checkBrowserPolicy(t *testing.T, policy *BrowserPolicy, root, intermediate, other *x509.Certificate) {
+	if len(policy.Trusted) != 1 || !policy.Trusted[0].Equal(root) {
+		t.Errorf("Expected the root trusted, got %d certificates", len(policy.Trusted))
+	}
+	if len(policy.Constrained) != 1 || !policy.Constrained[0].Cert.Equal(intermediate) {
+		t.Fatalf("Expected the intermediate constrained, got %d certificates", len(policy.Constrained))
+	}
+	if ca := policy.Constrained[0]; !reflect.DeepEqual(ca.PermittedDNSNames, []string{"example.com"}) || !reflect.DeepEqual(ca.PermittedCIDRs, []string{"10.0.0.0/8"}) {
+		t.Errorf("Unexpected constraints %v and %v", ca.PermittedDNSNames, ca.PermittedCIDRs)
+	}
+	if len(policy.Distrusted) != 1 || !policy.Distrusted[0].Equal(other) {
+		t.Errorf("Expected the other root distrusted, got %d certificates", len(policy.Distrusted))
+	}
+	if len(policy.Hints) != 1 || !policy.Hints[0].Equal(intermediate) {
+		t.Errorf("Expected the intermediate as a hint, got %d certificates", len(policy.Hints))
+	}
+	if roots := policy.Roots(); len(roots) != 2 || roots[1].Label != "Σ Acme Co Issuing CA" || roots[1].Trust != TrustServerAuth {
+		t.Errorf("Unexpected roots %v", roots)
+	}
+}
+
+func TestParseBrowserPolicyJSON(t *testing.T) {
+	t.Parallel()
+
+	root, intermediate, other := testBrowserPolicyCAs(t)
+	encode := base64.StdEncoding.EncodeToString
+	data := fmt.Sprintf(`{
+		"HomepageLocation": "https://intranet.example.com",
+		"CACertificates": [%q],
+		"CACertificatesWithConstraints": [{"certificate": %q, "constraints": {"permitted_dns_names": ["example.com"], "permitted_cidrs": ["10.0.0.0/8"]}}],
+		"CADistrustedCertificates": [%q],
+		"CAHintCertificates": [%q]
+	}`, encode(root.Raw), encode(intermediate.Raw), encode(other.Raw), encode(intermediate.Raw))
+
+	policy, err := ParseBrowserPolicy([]byte(data))
+	if err != nil {
+		t.Fatalf("Could not parse policy: %s", err)
+	}
+	checkBrowserPolicy(t, policy, root, intermediate, other)
+}
+
+func TestParseBrowserPolicyRegistry(t *testing.T) {
+	t.Parallel()
+
+	root, intermediate, other := testBrowserPolicyCAs(t)
+	encode := base64.StdEncoding.EncodeToString
+	constrained := fmt.Sprintf(`[{\"certificate\": \"%s\", \"constraints\": {\"permitted_dns_names\": [\"example.com\"], \"permitted_cidrs\": [\"10.0.0.0/8\"]}}]`, encode(intermediate.Raw))
+	export := strings.Join([]string{
+		`Windows Registry Editor Version 5.00`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Google\Chrome]`,
+		`"HomepageLocation"="[not a list"`,
+		`"CACertificatesWithConstraints"="` + constrained + `"`,
+		`"SyncDisabled"=dword:00000001`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Google\Chrome\CACertificates]`,
+		`"1"="` + encode(root.Raw) + `"`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Microsoft\Edge\CADistrustedCertificates]`,
+		`"1"="` + encode(other.Raw) + `"`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Google\Chrome\CAHintCertificates]`,
+		`"1"="` + encode(intermediate.Raw) + `"`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Example\CACertificates]`,
+		`"1"="not a certificate"`,
+	}, "\r\n")
+
+	// regedit writes UTF-16 with a byte order mark
+	data := []byte{0xff, 0xfe}
+	for _, unit := range utf16.Encode([]rune(export)) {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+	policy, err := ParseBrowserPolicy(data)
+	if err != nil {
+		t.Fatalf("Could not parse registry export: %s", err)
+	}
+	checkBrowserPolicy(t, policy, root, intermediate, other)
+}
+
+func TestParseBrowserPolicyInvalid(t *testing.T) {
+	t.Parallel()
+
+	for data, expected := range map[string]string{
+		`{"CACertificates": "AAAA"}`:                  "Expected a list",
+		`{"CACertificates": ["not base64!"]}`:         "Could not decode certificate",
+		`{"CADistrustedCertificates": ["AAAA"]}`:      "Could not parse certificate",
+		`{"CACertificatesWithConstraints": ["AAAA"]}`: "CACertificatesWithConstraints",
+		"REGEDIT4\n[HKEY_CURRENT_USER\\Software\\Policies\\Chromium]\n\"CACertificatesWithConstraints\"=\"[\"": "CACertificatesWithConstraints",
+		"HomepageLocation=https://example.com": "Not a registry export",
+	} {
+		if _, err := ParseBrowserPolicy([]byte(data)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q for %s, got %v", expected, data, err)
+		}
+	}
+}
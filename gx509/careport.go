@@ -0,0 +1,189 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	_ "embed"
+	"encoding/asn1"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The templates CA reports are written with.
+//
+//go:embed careport.txt
+var caReportText string
+
+//go:embed careport.html
+var caReportHTML string
+
+// A CAReportEntry is the status of one CA certificate in a CAReport.
+type CAReportEntry struct {
+	RootAge
+	Label string
+	// RevocationChecked is set if a current CRL from the CA's issuer was
+	// given, and Revoked if it lists the CA.
+	RevocationChecked bool
+	Revoked           bool
+	// CRLOutOfScope are the reasons CRLs from the CA's issuer were not used,
+	// because their issuing distribution point excludes the CA.
+	CRLOutOfScope []string
+}
+
+// Findings are the problems with the CA, or none if it is fit to distribute.
+func (e CAReportEntry) Findings() []string {
+	var findings []string
+	if e.Revoked {
+		findings = append(findings, "revoked")
+	}
+	if e.Expired {
+		findings = append(findings, "expired")
+	} else if e.ExpiringSoon {
+		findings = append(findings, "expiring soon")
+	}
+	if e.WeakKey {
+		findings = append(findings, "weak key")
+	}
+	for _, problem := range e.CRLOutOfScope {
+		findings = append(findings, "CRL out of scope: "+problem)
+	}
+	return findings
+}
+
+// A CAReport summarizes the CAs about to be distributed, by group policy or
+// an MDM profile for example, for a change-management ticket.
+type CAReport struct {
+	Title     string
+	Generated time.Time
+	// Horizon is how soon an expiry counts against a CA.
+	Horizon time.Duration
+	Entries []CAReportEntry
+}
+
+// NewCAReport reports on roots as of at, checking each against the CRLs of
+// its issuer among crls. A CRL counts only if it is current, signed by a
+// certificate among roots, so CAs whose issuers are not being distributed
+// are left unchecked, and its issuing distribution point covers the CA.
+func NewCAReport(title string, roots []TrustedRoot, crls []*pkix.CertificateList, at time.Time, horizon time.Duration) *CAReport {
+	certs := make([]*x509.Certificate, len(roots))
+	labels := make(map[*x509.Certificate]string)
+	for i, root := range roots {
+		certs[i] = root.Cert
+		labels[root.Cert] = root.Label
+	}
+
+	report := &CAReport{Title: title, Generated: at, Horizon: horizon}
+	for _, age := range AgeTrustStore(certs, at, horizon) {
+		entry := CAReportEntry{RootAge: age, Label: labels[age.Cert]}
+		for _, crl := range crls {
+			if !crlCovers(crl, age.Cert, certs, at) {
+				continue
+			}
+			problems, err := CheckCRLScope(crl, age.Cert)
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			if len(problems) > 0 {
+				entry.CRLOutOfScope = append(entry.CRLOutOfScope, problems...)
+				continue
+			}
+			entry.RevocationChecked = true
+			for _, revoked := range crl.TBSCertList.RevokedCertificates {
+				if revoked.SerialNumber.Cmp(age.Cert.SerialNumber) == 0 {
+					entry.Revoked = true
+				}
+			}
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return report
+}
+
+// crlCovers reports whether crl is current as of at and was signed by the
+// issuer of cert, which must be among issuers.
+func crlCovers(crl *pkix.CertificateList, cert *x509.Certificate, issuers []*x509.Certificate, at time.Time) bool {
+	if crl.HasExpired(at) {
+		return false
+	}
+	// The parsed issuer loses its string types, so compare the encoded one
+	var tbs struct {
+		Version   int `asn1:"optional,default:0"`
+		Signature pkix.AlgorithmIdentifier
+		Issuer    asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(crl.TBSCertList.Raw, &tbs); err != nil || !bytes.Equal(tbs.Issuer.FullBytes, cert.RawIssuer) {
+		return false
+	}
+	for _, candidate := range issuers {
+		if bytes.Equal(candidate.RawSubject, cert.RawIssuer) && candidate.CheckCRLSignature(crl) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Flagged is the number of CAs with findings.
+func (r *CAReport) Flagged() int {
+	flagged := 0
+	for _, entry := range r.Entries {
+		if len(entry.Findings()) > 0 {
+			flagged++
+		}
+	}
+	return flagged
+}
+
+var caReportFuncs = map[string]interface{}{
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+	"fingerprint": func(cert *x509.Certificate) string {
+		return fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	},
+	"join": strings.Join,
+	"days": func(d time.Duration) int {
+		return int(d.Hours() / 24)
+	},
+}
+
+var (
+	caReportTextTemplate = template.Must(template.New("careport.txt").Funcs(caReportFuncs).Parse(caReportText))
+	caReportHTMLTemplate = htmltemplate.Must(htmltemplate.New("careport.html").Funcs(caReportFuncs).Parse(caReportHTML))
+)
+
+func init() {
+	RegisterRenderer("html", func(w io.Writer) Renderer { return htmlRenderer{w} })
+}
+
+// htmlRenderer writes CA status reports with WriteHTML.
+type htmlRenderer struct {
+	w io.Writer
+}
+
+func (r htmlRenderer) Render(report Report) error {
+	if report.Kind != CAStatusReport {
+		return errUnsupportedReport("html", report.Kind)
+	}
+	return report.CAs.WriteHTML(r.w)
+}
+
+// WriteText writes the report as plain text, to paste into a ticket.
+func (r *CAReport) WriteText(w io.Writer) error {
+	return caReportTextTemplate.Execute(w, r)
+}
+
+// WriteHTML writes the report as a standalone HTML page, to attach to a
+// ticket.
+func (r *CAReport) WriteHTML(w io.Writer) error {
+	return caReportHTMLTemplate.Execute(w, r)
+}
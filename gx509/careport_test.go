@@ -0,0 +1,86 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCRL(t *testing.T, issuer *x509.Certificate, serial int64, thisUpdate, nextUpdate time.Time) *pkix.CertificateList {
+	revoked := []pkix.RevokedCertificate{{SerialNumber: big.NewInt(serial), RevocationTime: thisUpdate}}
+	der, err := issuer.CreateCRL(rand.Reader, testPrivateKey, revoked, thisUpdate, nextUpdate)
+	if err != nil {
+		t.Fatalf("Could not create CRL: %s", err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatalf("Could not parse CRL: %s", err)
+	}
+	return crl
+}
+
+func TestCAReport(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	other := testCA(t, "Other Root", nil, time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC))
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	roots := []TrustedRoot{
+		{Label: "Acme Root", Cert: chain[2]},
+		{Label: "Acme Issuing CA", Cert: chain[1]},
+		{Label: "Other Root", Cert: other},
+	}
+	crls := []*pkix.CertificateList{
+		testCRL(t, chain[2], 2, at.Add(-time.Hour), at.Add(24*time.Hour)),
+		// A stale CRL says nothing about revocation now
+		testCRL(t, chain[2], 1, at.AddDate(0, -2, 0), at.AddDate(0, -1, 0)),
+	}
+
+	report := NewCAReport("CHG0001234", roots, crls, at, 9*365*24*time.Hour)
+	if len(report.Entries) != 3 || report.Flagged() != 3 {
+		t.Fatalf("Expected 3 CAs, all flagged for their weak keys, got %d and %d", len(report.Entries), report.Flagged())
+	}
+	byLabel := make(map[string]CAReportEntry)
+	for _, entry := range report.Entries {
+		byLabel[entry.Label] = entry
+	}
+	for label, expected := range map[string][]string{
+		"Acme Root":       {"weak key"},
+		"Acme Issuing CA": {"revoked", "expiring soon", "weak key"},
+		"Other Root":      {"expired", "weak key"},
+	} {
+		if findings := byLabel[label].Findings(); !reflect.DeepEqual(findings, expected) {
+			t.Errorf("Expected %s to have findings %v, got %v", label, expected, findings)
+		}
+	}
+	if !byLabel["Acme Root"].RevocationChecked || byLabel["Acme Root"].Revoked || byLabel["Other Root"].RevocationChecked {
+		t.Errorf("Expected only the CAs the root issues to be checked for revocation")
+	}
+
+	var text, html bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("Could not write text report: %s", err)
+	}
+	for _, expected := range []string{"CHG0001234\n", "3 CAs, 3 with findings", "Acme Issuing CA\n", "Revocation:   REVOKED", "Findings:     expired, weak key"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("Expected the text report to contain %q:\n%s", expected, text.String())
+		}
+	}
+	roots[0].Label = "Acme <Root>"
+	if err := NewCAReport("", roots, nil, at, 0).WriteHTML(&html); err != nil {
+		t.Fatalf("Could not write HTML report: %s", err)
+	}
+	if !strings.Contains(html.String(), "Acme &lt;Root&gt;") || !strings.Contains(html.String(), `class="flagged"`) {
+		t.Errorf("Expected an escaped, flagged HTML report:\n%s", html.String())
+	}
+}
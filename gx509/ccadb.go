@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CCADBColumns are the columns of an intermediate certificate disclosure, in
+// the order the CCADB's bulk upload template uses. The audit columns are left
+// blank for the CA to fill in.
+var CCADBColumns = []string{
+	"Certificate Subject Common Name",
+	"Certificate Subject Organization",
+	"Certificate Issuer Common Name",
+	"Certificate Issuer Organization",
+	"Certificate Serial Number",
+	"SHA-256 Fingerprint",
+	"Subject + SPKI SHA256",
+	"Valid From [GMT]",
+	"Valid To [GMT]",
+	"Public Key Algorithm",
+	"Signature Hash Algorithm",
+	"Extended Key Usage",
+	"Technically Constrained",
+	"Constraint Details",
+	"Standard Audit",
+	"Standard Audit Type",
+	"Standard Audit Statement Date",
+	"BR Audit",
+	"BR Audit Type",
+	"BR Audit Statement Date",
+	"Auditor",
+	"Management Assertions By",
+}
+
+const ccadbDateFormat = "2006.01.02"
+
+// SubjectSPKIHash returns the SHA-256 hash of the certificate's subject and
+// public key, which the CCADB uses to group reissued CA certificates.
+func SubjectSPKIHash(cert *x509.Certificate) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(cert.RawSubject)
+	h.Write(cert.RawSubjectPublicKeyInfo)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// CCADBRow formats cert as a row with a value for each of CCADBColumns.
+func CCADBRow(cert *x509.Certificate) []string {
+	key, _ := DescribeKey(cert.PublicKey)
+	analysis := AnalyzeTechnicalConstraints(cert)
+
+	ekus := make([]string, 0, len(cert.ExtKeyUsage))
+	for _, usage := range cert.ExtKeyUsage {
+		ekus = append(ekus, ExtKeyUsageName(usage))
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		ekus = append(ekus, oid.String())
+	}
+
+	technicallyConstrained := "FALSE"
+	if analysis.Constrained {
+		technicallyConstrained = "TRUE"
+	}
+
+	row := []string{
+		cert.Subject.CommonName,
+		strings.Join(cert.Subject.Organization, "; "),
+		cert.Issuer.CommonName,
+		strings.Join(cert.Issuer.Organization, "; "),
+		fmt.Sprintf("%X", cert.SerialNumber),
+		fmt.Sprintf("%X", sha256.Sum256(cert.Raw)),
+		fmt.Sprintf("%X", SubjectSPKIHash(cert)),
+		cert.NotBefore.UTC().Format(ccadbDateFormat),
+		cert.NotAfter.UTC().Format(ccadbDateFormat),
+		key,
+		cert.SignatureAlgorithm.String(),
+		strings.Join(ekus, "; "),
+		technicallyConstrained,
+		analysis.Details(),
+	}
+	// Audit fields
+	for len(row) < len(CCADBColumns) {
+		row = append(row, "")
+	}
+	return row
+}
+
+// WriteCCADBCSV writes a header and a row for each certificate in CSV.
+func WriteCCADBCSV(w io.Writer, certs []*x509.Certificate) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(CCADBColumns); err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if err := out.Write(CCADBRow(cert)); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,77 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"fmt"
+	"testing"
+)
+
+func TestWriteCCADBCSV(t *testing.T) {
+	t.Parallel()
+
+	intermediate := constrainedIntermediate(t, []string{"example.com"})
+	unconstrained := testChain(t, "www.example.com")[1]
+
+	var buf bytes.Buffer
+	if err := WriteCCADBCSV(&buf, []*x509.Certificate{intermediate, unconstrained}); err != nil {
+		t.Fatalf("Could not write CSV: %s", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Could not read CSV: %s", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d", len(records))
+	}
+
+	row := make(map[string]string)
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+
+	expected := map[string]string{
+		"Certificate Subject Common Name": "Σ Acme Co Issuing CA",
+		"Certificate Issuer Common Name":  "Σ Acme Co Issuing CA",
+		"Certificate Serial Number":       "1",
+		"SHA-256 Fingerprint":             fmt.Sprintf("%X", sha256.Sum256(intermediate.Raw)),
+		"Valid From [GMT]":                "2017.12.01",
+		"Valid To [GMT]":                  "2027.12.01",
+		"Public Key Algorithm":            "RSA 512",
+		"Extended Key Usage":              "clientAuth; serverAuth",
+		"Technically Constrained":         "TRUE",
+		"BR Audit":                        "",
+	}
+	for column, value := range expected {
+		if row[column] != value {
+			t.Errorf("%s: expected %q, got %q", column, value, row[column])
+		}
+	}
+
+	if records[2][12] != "FALSE" {
+		t.Errorf("Expected the second intermediate to be unconstrained, got %s", records[2][12])
+	}
+}
+
+func TestSubjectSPKIHash(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	expected := sha256.Sum256(append(append([]byte(nil), chain[1].RawSubject...), chain[1].RawSubjectPublicKeyInfo...))
+	if SubjectSPKIHash(chain[1]) != expected {
+		t.Errorf("Unexpected Subject + SPKI hash")
+	}
+
+	// Same subject, same key, different certificate
+	reissued := testChain(t, "other.example.com")[1]
+	if SubjectSPKIHash(reissued) != SubjectSPKIHash(chain[1]) {
+		t.Errorf("Expected reissued certificates to share a Subject + SPKI hash")
+	}
+}
@@ -0,0 +1,222 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A CCADBRecord is a CA certificate as a CCADB report, such as All
+// Certificate Records or the intermediate certificate report, describes it.
+type CCADBRecord struct {
+	// Line is the record's line in the report.
+	Line int
+
+	Name             string
+	Owner            string
+	RecordType       string
+	RevocationStatus string
+	SHA256           [sha256.Size]byte
+
+	// TechnicallyConstrained is the CCADB's determination, known only if
+	// HasConstraintStatus.
+	TechnicallyConstrained bool
+	HasConstraintStatus    bool
+
+	// The CA's audits, or AuditsSameAsParent if it relies on its issuer's.
+	AuditsSameAsParent bool
+	StandardAudit      string
+	BRAudit            string
+
+	// Certificate is the certificate itself, if the report includes PEM.
+	Certificate *x509.Certificate
+}
+
+// Revoked reports whether the CCADB records the certificate, or its issuer,
+// as revoked: a status of "Revoked" or "Parent Cert Revoked", rather than
+// "Not Revoked".
+func (r *CCADBRecord) Revoked() bool {
+	status := strings.ToLower(r.RevocationStatus)
+	return strings.Contains(status, "revoked") && !strings.HasPrefix(status, "not ")
+}
+
+// parseCCADBBool decodes the CCADB's spellings of a checkbox.
+func parseCCADBBool(value string) (b bool, ok bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return false, false, nil
+	case "true", "yes":
+		return true, true, nil
+	case "false", "no":
+		return false, true, nil
+	}
+	return false, false, fmt.Errorf("%q is neither true nor false", value)
+}
+
+// ParseCCADBReport decodes a CCADB report CSV, which must have a "SHA-256
+// Fingerprint" column. The columns for names, revocation, technical
+// constraints, audits and "PEM Info" are used where present; the audit
+// columns of WriteCCADBCSV are understood too.
+func ParseCCADBReport(r io.Reader) ([]*CCADBRecord, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CCADB report is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["SHA-256 Fingerprint"]; !ok {
+		return nil, fmt.Errorf("CCADB report has no SHA-256 Fingerprint column")
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) && len(record[i]) > 0 {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+
+	var parsed []*CCADBRecord
+	for i, record := range records[1:] {
+		line := i + 2
+		fingerprint := field(record, "SHA-256 Fingerprint")
+		if len(fingerprint) == 0 {
+			continue
+		}
+		entry := &CCADBRecord{
+			Line:             line,
+			Name:             field(record, "Certificate Name", "Certificate Subject Common Name"),
+			Owner:            field(record, "CA Owner"),
+			RecordType:       field(record, "Certificate Record Type"),
+			RevocationStatus: field(record, "Revocation Status"),
+			StandardAudit:    field(record, "Standard Audit URL", "Standard Audit"),
+			BRAudit:          field(record, "BR Audit URL", "BR Audit"),
+		}
+		if entry.SHA256, err = ParseFingerprint(fingerprint); err != nil {
+			return nil, fmt.Errorf("CCADB report line %d: %s", line, err)
+		}
+		if entry.TechnicallyConstrained, entry.HasConstraintStatus, err = parseCCADBBool(field(record, "Technically Constrained")); err != nil {
+			return nil, fmt.Errorf("CCADB report line %d: Technically Constrained %s", line, err)
+		}
+		if entry.AuditsSameAsParent, _, err = parseCCADBBool(field(record, "Audits Same as Parent?")); err != nil {
+			return nil, fmt.Errorf("CCADB report line %d: Audits Same as Parent? %s", line, err)
+		}
+
+		if data := field(record, "PEM Info", "PEM"); len(data) > 0 {
+			// The report wraps the PEM in single quotes
+			block, _ := pem.Decode([]byte(strings.Trim(data, "'")))
+			if block == nil {
+				return nil, fmt.Errorf("CCADB report line %d: PEM Info is not PEM", line)
+			}
+			if entry.Certificate, err = x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("CCADB report line %d: Could not parse certificate: %s", line, err)
+			}
+			if sha256.Sum256(entry.Certificate.Raw) != entry.SHA256 {
+				return nil, fmt.Errorf("CCADB report line %d: PEM Info does not match the SHA-256 fingerprint", line)
+			}
+		}
+		parsed = append(parsed, entry)
+	}
+	return parsed, nil
+}
+
+// The kinds of disagreement CrossCheckCCADB reports.
+const (
+	// CCADBConstraintMismatch is a certificate the CCADB and gx509 disagree
+	// is technically constrained.
+	CCADBConstraintMismatch = "constraint"
+	// CCADBAuditMismatch is a certificate gx509 finds unconstrained, for
+	// which the CCADB records no BR audit.
+	CCADBAuditMismatch = "audit"
+	// CCADBUndisclosed is an unconstrained CA certificate absent from the
+	// CCADB.
+	CCADBUndisclosed = "undisclosed"
+)
+
+// A CCADBMismatch is a disagreement between the CCADB and gx509's analysis
+// of a certificate.
+type CCADBMismatch struct {
+	Kind    string
+	Message string
+	// Record is nil for an undisclosed certificate.
+	Record *CCADBRecord
+	Cert   *x509.Certificate
+}
+
+// A CCADBCrossCheck is the outcome of CrossCheckCCADB.
+type CCADBCrossCheck struct {
+	// Checked is the number of certificates analyzed.
+	Checked int
+	// Unchecked are the records for which no certificate was available.
+	Unchecked  []*CCADBRecord
+	Mismatches []CCADBMismatch
+}
+
+// CrossCheckCCADB compares the CCADB's records with gx509's analysis of the
+// certificates under policy. Certificates come from the report's PEM and
+// from certs; the latter are also checked for disclosure. Root records are
+// skipped, and expired certificates are only checked for their constraints.
+func CrossCheckCCADB(records []*CCADBRecord, certs []*x509.Certificate, policy Policy, at time.Time) CCADBCrossCheck {
+	var check CCADBCrossCheck
+
+	byFingerprint := make(map[[sha256.Size]byte]*x509.Certificate)
+	for _, cert := range certs {
+		byFingerprint[sha256.Sum256(cert.Raw)] = cert
+	}
+	disclosed := make(map[[sha256.Size]byte]bool)
+	for _, record := range records {
+		disclosed[record.SHA256] = true
+		if strings.Contains(strings.ToLower(record.RecordType), "root") {
+			continue
+		}
+		cert := record.Certificate
+		if cert == nil {
+			cert = byFingerprint[record.SHA256]
+		}
+		if cert == nil {
+			check.Unchecked = append(check.Unchecked, record)
+			continue
+		}
+
+		check.Checked++
+		analysis := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+		if record.HasConstraintStatus && record.TechnicallyConstrained != analysis.Constrained {
+			message := fmt.Sprintf("CCADB records it as technically constrained, but under %s it is not: %s", policy.Name, analysis.Details())
+			if analysis.Constrained {
+				message = fmt.Sprintf("CCADB records it as not technically constrained, but under %s it is: %s", policy.Name, analysis.Details())
+			}
+			check.Mismatches = append(check.Mismatches, CCADBMismatch{CCADBConstraintMismatch, message, record, cert})
+		}
+		if !analysis.Constrained && !record.Revoked() && at.Before(cert.NotAfter) && !record.AuditsSameAsParent && len(record.BRAudit) == 0 {
+			check.Mismatches = append(check.Mismatches, CCADBMismatch{CCADBAuditMismatch,
+				fmt.Sprintf("Not technically constrained under %s, but CCADB records no BR audit", policy.Name), record, cert})
+		}
+	}
+
+	for _, cert := range certs {
+		if disclosed[sha256.Sum256(cert.Raw)] || !cert.IsCA || isSelfSigned(cert) || at.After(cert.NotAfter) {
+			continue
+		}
+		check.Checked++
+		if !AnalyzeTechnicalConstraintsForPolicy(cert, policy).Constrained {
+			check.Mismatches = append(check.Mismatches, CCADBMismatch{CCADBUndisclosed,
+				fmt.Sprintf("Not technically constrained under %s, but absent from the CCADB", policy.Name), nil, cert})
+		}
+	}
+	return check
+}
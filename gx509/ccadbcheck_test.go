@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrossCheckCCADB(t *testing.T) {
+	t.Parallel()
+
+	constrained := constrainedIntermediate(t, []string{"example.com"})
+	chain := testChain(t, "www.example.com")
+	intermediate, root := chain[1], chain[2]
+	undisclosed := testCA(t, "Undisclosed CA", root, time.Date(2027, time.December, 1, 0, 0, 0, 0, time.UTC))
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fingerprint := func(cert *x509.Certificate) string {
+		return fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	}
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.WriteAll([][]string{
+		{"CA Owner", "Certificate Name", "Certificate Record Type", "Revocation Status", "SHA-256 Fingerprint", "Audits Same as Parent?", "BR Audit URL", "Technically Constrained", "PEM Info"},
+		{"Acme", "Acme Issuing CA", "Intermediate Certificate", "Not Revoked", fingerprint(constrained), "FALSE", "", "FALSE",
+			"'" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: constrained.Raw})) + "'"},
+		{"Acme", "Acme Intermediate", "Intermediate Certificate", "Not Revoked", fingerprint(intermediate), "FALSE", "", "TRUE", ""},
+		{"Acme", "Acme Root", "Root Certificate", "Not Revoked", fingerprint(root), "", "", "", ""},
+		{"Acme", "Acme Elsewhere", "Intermediate Certificate", "Revoked", strings.Repeat("AB", sha256.Size), "TRUE", "", "", ""},
+	})
+
+	records, err := ParseCCADBReport(&buf)
+	if err != nil {
+		t.Fatalf("Could not parse report: %s", err)
+	}
+	if len(records) != 4 || records[0].Certificate == nil || records[0].Line != 2 || records[1].Owner != "Acme" ||
+		!records[1].HasConstraintStatus || !records[1].TechnicallyConstrained || records[2].HasConstraintStatus ||
+		!records[3].Revoked() || records[1].Revoked() || !records[3].AuditsSameAsParent {
+		t.Fatalf("Unexpected records %+v", records)
+	}
+
+	check := CrossCheckCCADB(records, []*x509.Certificate{intermediate, undisclosed, root}, DefaultPolicy, at)
+	if check.Checked != 3 || len(check.Unchecked) != 1 || check.Unchecked[0].Name != "Acme Elsewhere" {
+		t.Errorf("Expected 3 certificates checked and 1 record unchecked, got %d and %v", check.Checked, check.Unchecked)
+	}
+	var kinds []string
+	for _, mismatch := range check.Mismatches {
+		kinds = append(kinds, fmt.Sprintf("%s %s", mismatch.Kind, mismatch.Cert.Subject.CommonName))
+	}
+	expected := []string{
+		"constraint Σ Acme Co Issuing CA",
+		"constraint " + intermediate.Subject.CommonName,
+		"audit " + intermediate.Subject.CommonName,
+		"undisclosed Undisclosed CA",
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected mismatches %v, got %v", expected, kinds)
+	}
+
+	// Once expired, only the constraints are compared
+	check = CrossCheckCCADB(records, []*x509.Certificate{intermediate, undisclosed}, DefaultPolicy, time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if len(check.Mismatches) != 2 || check.Mismatches[1].Kind != CCADBConstraintMismatch {
+		t.Errorf("Expected only constraint mismatches, got %+v", check.Mismatches)
+	}
+
+	for _, data := range []string{
+		"",
+		"Certificate Name\nAcme\n",
+		"SHA-256 Fingerprint\nnot hex\n",
+		"SHA-256 Fingerprint,Technically Constrained\n" + fingerprint(root) + ",maybe\n",
+		"SHA-256 Fingerprint,PEM Info\n" + fingerprint(root) + ",not pem\n",
+		"SHA-256 Fingerprint,PEM Info\n" + fingerprint(root) + ",\"" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw})) + "\"\n",
+	} {
+		if _, err := ParseCCADBReport(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+}
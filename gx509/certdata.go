@@ -0,0 +1,265 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TrustBits are the purposes for which a root is trusted.
+type TrustBits uint
+
+const (
+	TrustServerAuth TrustBits = 1 << iota
+	TrustEmailProtection
+	TrustCodeSigning
+
+	TrustAll = TrustServerAuth | TrustEmailProtection | TrustCodeSigning
+)
+
+var trustAttributes = []struct {
+	attribute string
+	bit       TrustBits
+}{
+	{"CKA_TRUST_SERVER_AUTH", TrustServerAuth},
+	{"CKA_TRUST_EMAIL_PROTECTION", TrustEmailProtection},
+	{"CKA_TRUST_CODE_SIGNING", TrustCodeSigning},
+}
+
+func (t TrustBits) String() string {
+	var names []string
+	if t&TrustServerAuth != 0 {
+		names = append(names, "serverAuth")
+	}
+	if t&TrustEmailProtection != 0 {
+		names = append(names, "emailProtection")
+	}
+	if t&TrustCodeSigning != 0 {
+		names = append(names, "codeSigning")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseTrustBits parses a comma-separated list of the names String returns.
+func ParseTrustBits(s string) (TrustBits, error) {
+	var bits TrustBits
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "serverAuth":
+			bits |= TrustServerAuth
+		case "emailProtection":
+			bits |= TrustEmailProtection
+		case "codeSigning":
+			bits |= TrustCodeSigning
+		default:
+			return 0, fmt.Errorf("Unknown trust bit: %s", name)
+		}
+	}
+	return bits, nil
+}
+
+// A TrustedRoot is a trust anchor along with what it is trusted for.
+type TrustedRoot struct {
+	Label string
+	Cert  *x509.Certificate
+	Trust TrustBits
+}
+
+// A certdataObject is one PKCS#11 object from certdata.txt, mapping each
+// attribute to its type and value.
+type certdataObject map[string]certdataAttribute
+
+type certdataAttribute struct {
+	Type  string
+	Value []byte
+}
+
+// ParseCertdata reads NSS's certdata.txt format, returning each certificate
+// along with the trust bits for which it is a trusted delegator.
+func ParseCertdata(r io.Reader) ([]TrustedRoot, error) {
+	objects, err := parseCertdataObjects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trust := make(map[string]TrustBits)
+	for _, object := range objects {
+		if string(object["CKA_CLASS"].Value) != "CKO_NSS_TRUST" {
+			continue
+		}
+		var bits TrustBits
+		for _, entry := range trustAttributes {
+			if string(object[entry.attribute].Value) == "CKT_NSS_TRUSTED_DELEGATOR" {
+				bits |= entry.bit
+			}
+		}
+		trust[string(object["CKA_CERT_SHA1_HASH"].Value)] = bits
+	}
+
+	var roots []TrustedRoot
+	for _, object := range objects {
+		if string(object["CKA_CLASS"].Value) != "CKO_CERTIFICATE" {
+			continue
+		}
+		der := object["CKA_VALUE"].Value
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse %q: %s", object["CKA_LABEL"].Value, err)
+		}
+		hash := sha1.Sum(der)
+		roots = append(roots, TrustedRoot{
+			Label: string(object["CKA_LABEL"].Value),
+			Cert:  cert,
+			Trust: trust[string(hash[:])],
+		})
+	}
+
+	return roots, nil
+}
+
+func parseCertdataObjects(r io.Reader) ([]certdataObject, error) {
+	var objects []certdataObject
+	var current certdataObject
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if fields[0] == "BEGINDATA" {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("certdata line %d: malformed attribute", lineNumber)
+		}
+
+		if fields[0] == "CKA_CLASS" {
+			current = make(certdataObject)
+			objects = append(objects, current)
+		}
+		if current == nil {
+			// Attributes before the first object, like CVS_ID
+			continue
+		}
+
+		attribute := certdataAttribute{Type: fields[1]}
+		switch fields[1] {
+		case "MULTILINE_OCTAL":
+			var value bytes.Buffer
+			for scanner.Scan() {
+				lineNumber++
+				octal := strings.TrimSpace(scanner.Text())
+				if octal == "END" {
+					break
+				}
+				for _, digits := range strings.Split(octal, `\`)[1:] {
+					b, err := strconv.ParseUint(digits, 8, 8)
+					if err != nil {
+						return nil, fmt.Errorf("certdata line %d: %s", lineNumber, err)
+					}
+					value.WriteByte(byte(b))
+				}
+			}
+			attribute.Value = value.Bytes()
+		case "UTF8":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("certdata line %d: missing value", lineNumber)
+			}
+			unquoted, err := strconv.Unquote(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("certdata line %d: %s", lineNumber, err)
+			}
+			attribute.Value = []byte(unquoted)
+		default:
+			if len(fields) == 3 {
+				attribute.Value = []byte(fields[2])
+			}
+		}
+		current[fields[0]] = attribute
+	}
+
+	return objects, scanner.Err()
+}
+
+func writeOctal(w io.Writer, name string, value []byte) {
+	fmt.Fprintf(w, "%s MULTILINE_OCTAL\n", name)
+	for start := 0; start < len(value); start += 16 {
+		end := start + 16
+		if end > len(value) {
+			end = len(value)
+		}
+		for _, b := range value[start:end] {
+			fmt.Fprintf(w, `\%03o`, b)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "END\n")
+}
+
+// WriteCertdata writes roots in NSS's certdata.txt format.
+func WriteCertdata(w io.Writer, roots []TrustedRoot) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "BEGINDATA\n")
+
+	for _, root := range roots {
+		serial, err := asn1.Marshal(root.Cert.SerialNumber)
+		if err != nil {
+			return err
+		}
+		label := strconv.Quote(root.Label)
+
+		fmt.Fprintf(buf, "\n# Certificate %s\n", label)
+		fmt.Fprintf(buf, "CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\n")
+		fmt.Fprintf(buf, "CKA_TOKEN CK_BBOOL CK_TRUE\n")
+		fmt.Fprintf(buf, "CKA_PRIVATE CK_BBOOL CK_FALSE\n")
+		fmt.Fprintf(buf, "CKA_MODIFIABLE CK_BBOOL CK_FALSE\n")
+		fmt.Fprintf(buf, "CKA_LABEL UTF8 %s\n", label)
+		fmt.Fprintf(buf, "CKA_CERTIFICATE_TYPE CK_CERTIFICATE_TYPE CKC_X_509\n")
+		writeOctal(buf, "CKA_SUBJECT", root.Cert.RawSubject)
+		fmt.Fprintf(buf, "CKA_ID UTF8 \"0\"\n")
+		writeOctal(buf, "CKA_ISSUER", root.Cert.RawIssuer)
+		writeOctal(buf, "CKA_SERIAL_NUMBER", serial)
+		writeOctal(buf, "CKA_VALUE", root.Cert.Raw)
+
+		hash := sha1.Sum(root.Cert.Raw)
+		fmt.Fprintf(buf, "\n# Trust for %s\n", label)
+		fmt.Fprintf(buf, "CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST\n")
+		fmt.Fprintf(buf, "CKA_TOKEN CK_BBOOL CK_TRUE\n")
+		fmt.Fprintf(buf, "CKA_PRIVATE CK_BBOOL CK_FALSE\n")
+		fmt.Fprintf(buf, "CKA_MODIFIABLE CK_BBOOL CK_FALSE\n")
+		fmt.Fprintf(buf, "CKA_LABEL UTF8 %s\n", label)
+		writeOctal(buf, "CKA_CERT_SHA1_HASH", hash[:])
+		writeOctal(buf, "CKA_ISSUER", root.Cert.RawIssuer)
+		writeOctal(buf, "CKA_SERIAL_NUMBER", serial)
+		for _, entry := range trustAttributes {
+			value := "CKT_NSS_MUST_VERIFY_TRUST"
+			if root.Trust&entry.bit != 0 {
+				value = "CKT_NSS_TRUSTED_DELEGATOR"
+			}
+			fmt.Fprintf(buf, "%s CK_TRUST %s\n", entry.attribute, value)
+		}
+		fmt.Fprintf(buf, "CKA_TRUST_STEP_UP_APPROVED CK_BBOOL CK_FALSE\n")
+	}
+
+	return buf.Flush()
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertdataRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().AddDate(10, 0, 0)
+	roots := []TrustedRoot{
+		{Label: "Web Root", Cert: testCA(t, "Web Root", nil, notAfter), Trust: TrustServerAuth},
+		{Label: "Mail \"Root\"", Cert: testCA(t, "Mail Root", nil, notAfter), Trust: TrustEmailProtection | TrustCodeSigning},
+		{Label: "Distrusted Root", Cert: testCA(t, "Distrusted Root", nil, notAfter)},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCertdata(&buf, roots); err != nil {
+		t.Fatalf("Could not write certdata: %s", err)
+	}
+	if !strings.Contains(buf.String(), "CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_TRUSTED_DELEGATOR") {
+		t.Errorf("Expected a trusted delegator in:\n%s", buf.String())
+	}
+
+	parsed, err := ParseCertdata(&buf)
+	if err != nil {
+		t.Fatalf("Could not parse certdata: %s", err)
+	}
+	if len(parsed) != len(roots) {
+		t.Fatalf("Expected %d roots, got %d", len(roots), len(parsed))
+	}
+	for i, root := range parsed {
+		if root.Label != roots[i].Label {
+			t.Errorf("Expected label %q, got %q", roots[i].Label, root.Label)
+		}
+		if !root.Cert.Equal(roots[i].Cert) {
+			t.Errorf("Certificate for %s did not round trip", root.Label)
+		}
+		if root.Trust != roots[i].Trust {
+			t.Errorf("Expected %s trusted for %s, got %s", root.Label, roots[i].Trust, root.Trust)
+		}
+	}
+}
+
+func TestParseCertdataMalformed(t *testing.T) {
+	t.Parallel()
+
+	data := "CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\nCKA_VALUE MULTILINE_OCTAL\n\\060\\999\nEND\n"
+	if _, err := ParseCertdata(strings.NewReader(data)); err == nil {
+		t.Errorf("Expected an error for invalid octal")
+	}
+}
+
+func TestParseTrustBits(t *testing.T) {
+	t.Parallel()
+
+	bits, err := ParseTrustBits("serverAuth, codeSigning")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if bits != TrustServerAuth|TrustCodeSigning {
+		t.Errorf("Unexpected trust bits: %s", bits)
+	}
+	if bits.String() != "serverAuth,codeSigning" {
+		t.Errorf("Unexpected name: %s", bits)
+	}
+
+	if bits, _ := ParseTrustBits(""); bits != 0 || bits.String() != "none" {
+		t.Errorf("Expected no trust bits, got %s", bits)
+	}
+	if _, err := ParseTrustBits("anything"); err == nil {
+		t.Errorf("Expected an error for an unknown trust bit")
+	}
+}
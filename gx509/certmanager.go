@@ -0,0 +1,218 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A CertManagerIssuer is a cert-manager Issuer or ClusterIssuer.
+type CertManagerIssuer struct {
+	// Ref is how certificates refer to the issuer, as in
+	// "ClusterIssuer/internal" or "Issuer/default/internal".
+	Ref string
+	// Type is the kind of issuer: ca, selfSigned, acme, vault or venafi.
+	Type string
+	// SecretName is the secret holding the key pair of a ca issuer.
+	SecretName string
+	// Cert is the CA certificate in that secret, or nil if it was not found.
+	Cert *x509.Certificate
+}
+
+// A CertManagerCertificate is a cert-manager Certificate or
+// CertificateRequest, with what it has issued so far.
+type CertManagerCertificate struct {
+	// Name is the kind, namespace and name of the resource, as in
+	// "Certificate/default/www".
+	Name      string
+	IssuerRef string
+	IsCA      bool
+	// Certs are the chain issued: from the Certificate's secret, or the
+	// CertificateRequest's status.
+	Certs []*x509.Certificate
+}
+
+// A CertManagerInventory is the cert-manager resources in a cluster.
+type CertManagerInventory struct {
+	Issuers      []CertManagerIssuer
+	Certificates []CertManagerCertificate
+}
+
+type certManagerObject struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	// Items are the objects in a List, as kubectl get -o yaml writes.
+	Items []certManagerObject `yaml:"items"`
+
+	Spec struct {
+		// Issuers
+		CA *struct {
+			SecretName string `yaml:"secretName"`
+		} `yaml:"ca"`
+		SelfSigned *struct{} `yaml:"selfSigned"`
+		ACME       *struct{} `yaml:"acme"`
+		Vault      *struct{} `yaml:"vault"`
+		Venafi     *struct{} `yaml:"venafi"`
+
+		// Certificates and CertificateRequests
+		SecretName string `yaml:"secretName"`
+		IsCA       bool   `yaml:"isCA"`
+		IssuerRef  struct {
+			Name string `yaml:"name"`
+			Kind string `yaml:"kind"`
+		} `yaml:"issuerRef"`
+	} `yaml:"spec"`
+	Status struct {
+		Certificate string `yaml:"certificate"`
+	} `yaml:"status"`
+
+	// Secrets
+	Data map[string]string `yaml:"data"`
+}
+
+// parseCertificatesPEM returns the certificates in PEM data.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// decodeCertificatesBase64 returns the certificates in base64-encoded PEM, as
+// in secrets and CertificateRequest statuses.
+func decodeCertificatesBase64(name, value string) ([]*x509.Certificate, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Could not decode certificate: %s", name, err)
+	}
+	certs, err := parseCertificatesPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Could not parse certificate: %s", name, err)
+	}
+	return certs, nil
+}
+
+// ParseCertManager reads the Issuers, ClusterIssuers, Certificates,
+// CertificateRequests and TLS secrets in YAML data, such as the output of
+// kubectl get -o yaml or the manifests applied to a cluster, and matches each
+// to the certificates in its secret. ClusterIssuers keep their secrets in
+// clusterResourceNamespace, which is cert-manager unless configured
+// otherwise.
+func ParseCertManager(data []byte, clusterResourceNamespace string) (*CertManagerInventory, error) {
+	var objects []certManagerObject
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for document := 1; ; document++ {
+		var object certManagerObject
+		if err := decoder.Decode(&object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not decode document %d: %s", document, err)
+		}
+		objects = append(objects, object)
+		objects = append(objects, object.Items...)
+	}
+
+	secrets := make(map[string]certManagerObject)
+	for _, object := range objects {
+		if object.Kind == "Secret" {
+			secrets[object.Metadata.Namespace+"/"+object.Metadata.Name] = object
+		}
+	}
+	// secretCertificates returns the chain in the tls.crt of a secret, which
+	// has the leaf first.
+	secretCertificates := func(namespace, name string) ([]*x509.Certificate, error) {
+		secret, ok := secrets[namespace+"/"+name]
+		if !ok || len(secret.Data["tls.crt"]) == 0 {
+			return nil, nil
+		}
+		return decodeCertificatesBase64("Secret/"+namespace+"/"+name, secret.Data["tls.crt"])
+	}
+
+	inventory := &CertManagerInventory{}
+	for _, object := range objects {
+		if !strings.HasPrefix(object.APIVersion, "cert-manager.io/") {
+			continue
+		}
+		namespace := object.Metadata.Namespace
+		switch object.Kind {
+		case "Issuer", "ClusterIssuer":
+			issuer := CertManagerIssuer{Ref: object.Kind + "/" + namespace + "/" + object.Metadata.Name}
+			if object.Kind == "ClusterIssuer" {
+				issuer.Ref = object.Kind + "/" + object.Metadata.Name
+				namespace = clusterResourceNamespace
+			}
+			switch spec := object.Spec; {
+			case spec.CA != nil:
+				issuer.Type = "ca"
+				issuer.SecretName = spec.CA.SecretName
+				certs, err := secretCertificates(namespace, spec.CA.SecretName)
+				if err != nil {
+					return nil, err
+				}
+				if len(certs) > 0 {
+					issuer.Cert = certs[0]
+				}
+			case spec.SelfSigned != nil:
+				issuer.Type = "selfSigned"
+			case spec.ACME != nil:
+				issuer.Type = "acme"
+			case spec.Vault != nil:
+				issuer.Type = "vault"
+			case spec.Venafi != nil:
+				issuer.Type = "venafi"
+			}
+			inventory.Issuers = append(inventory.Issuers, issuer)
+
+		case "Certificate", "CertificateRequest":
+			certificate := CertManagerCertificate{
+				Name:      object.Kind + "/" + namespace + "/" + object.Metadata.Name,
+				IssuerRef: object.Spec.IssuerRef.Name,
+				IsCA:      object.Spec.IsCA,
+			}
+			// Issuers are namespaced unless the reference says otherwise
+			if kind := object.Spec.IssuerRef.Kind; kind == "ClusterIssuer" {
+				certificate.IssuerRef = kind + "/" + certificate.IssuerRef
+			} else {
+				certificate.IssuerRef = "Issuer/" + namespace + "/" + certificate.IssuerRef
+			}
+
+			var err error
+			if object.Kind == "Certificate" {
+				certificate.Certs, err = secretCertificates(namespace, object.Spec.SecretName)
+			} else if len(object.Status.Certificate) > 0 {
+				certificate.Certs, err = decodeCertificatesBase64(certificate.Name, object.Status.Certificate)
+			}
+			if err != nil {
+				return nil, err
+			}
+			inventory.Certificates = append(inventory.Certificates, certificate)
+		}
+	}
+	return inventory, nil
+}
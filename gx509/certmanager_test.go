@@ -0,0 +1,122 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseCertManager(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	encode := func(certs ...*x509.Certificate) string {
+		var out []byte
+		for _, cert := range certs {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+		return base64.StdEncoding.EncodeToString(out)
+	}
+
+	manifests := fmt.Sprintf(`apiVersion: cert-manager.io/v1
+kind: ClusterIssuer
+metadata:
+  name: internal
+spec:
+  ca:
+    secretName: internal-ca
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: cert-manager.io/v1
+  kind: Issuer
+  metadata:
+    name: letsencrypt
+    namespace: web
+  spec:
+    acme:
+      server: https://acme-v02.api.letsencrypt.org/directory
+- apiVersion: cert-manager.io/v1
+  kind: Certificate
+  metadata:
+    name: www
+    namespace: web
+  spec:
+    secretName: www-tls
+    dnsNames: [www.example.com]
+    issuerRef:
+      name: internal
+      kind: ClusterIssuer
+- apiVersion: cert-manager.io/v1
+  kind: CertificateRequest
+  metadata:
+    name: www-1
+    namespace: web
+  spec:
+    issuerRef:
+      name: letsencrypt
+  status:
+    certificate: %s
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/tls
+metadata:
+  name: internal-ca
+  namespace: cert-manager
+data:
+  tls.crt: %s
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/tls
+metadata:
+  name: www-tls
+  namespace: web
+data:
+  tls.crt: %s
+`, encode(chain[0]), encode(chain[1]), encode(chain[0], chain[1]))
+
+	inventory, err := ParseCertManager([]byte(manifests), "cert-manager")
+	if err != nil {
+		t.Fatalf("Could not parse manifests: %s", err)
+	}
+	if len(inventory.Issuers) != 2 || len(inventory.Certificates) != 2 {
+		t.Fatalf("Expected 2 issuers and 2 certificates, got %+v", inventory)
+	}
+
+	internal := inventory.Issuers[0]
+	if internal.Ref != "ClusterIssuer/internal" || internal.Type != "ca" || internal.Cert == nil || !internal.Cert.Equal(chain[1]) {
+		t.Errorf("Unexpected CA issuer %+v", internal)
+	}
+	if acme := inventory.Issuers[1]; acme.Ref != "Issuer/web/letsencrypt" || acme.Type != "acme" || acme.Cert != nil {
+		t.Errorf("Unexpected ACME issuer %+v", acme)
+	}
+
+	www := inventory.Certificates[0]
+	if www.Name != "Certificate/web/www" || www.IssuerRef != internal.Ref || len(www.Certs) != 2 || !www.Certs[0].Equal(chain[0]) {
+		t.Errorf("Unexpected certificate %+v", www)
+	}
+	request := inventory.Certificates[1]
+	if request.Name != "CertificateRequest/web/www-1" || request.IssuerRef != "Issuer/web/letsencrypt" || len(request.Certs) != 1 {
+		t.Errorf("Unexpected certificate request %+v", request)
+	}
+
+	// The ClusterIssuer's secret is only found in the cluster resource namespace
+	if inventory, err = ParseCertManager([]byte(manifests), "kube-system"); err != nil || inventory.Issuers[0].Cert != nil {
+		t.Errorf("Expected no CA certificate outside the cluster resource namespace, got %v", err)
+	}
+
+	bad := "apiVersion: cert-manager.io/v1\nkind: CertificateRequest\nmetadata: {name: bad, namespace: web}\nstatus: {certificate: '!!!'}\n"
+	if _, err := ParseCertManager([]byte(bad), "cert-manager"); err == nil || !strings.Contains(err.Error(), "CertificateRequest/web/bad") {
+		t.Errorf("Expected an error naming the bad request, got %v", err)
+	}
+}
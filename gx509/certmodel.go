@@ -0,0 +1,434 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// A Cert is a certificate as gx509 models it, whichever parser read it.
+// Unlike x509.Certificate it keeps what crypto/x509 drops: URI and
+// rfc822Name subtrees, subject alternative names of types it does not know,
+// and the OIDs of every algorithm and extended key usage.
+type Cert struct {
+	Raw                     []byte
+	RawTBSCertificate       []byte
+	RawSubjectPublicKeyInfo []byte
+	RawSubject              []byte
+	RawIssuer               []byte
+
+	Version            int
+	SerialNumber       *big.Int
+	SignatureAlgorithm asn1.ObjectIdentifier
+	Signature          []byte
+	Issuer             pkix.Name
+	Subject            pkix.Name
+	NotBefore          time.Time
+	NotAfter           time.Time
+
+	PublicKeyAlgorithm asn1.ObjectIdentifier
+	// PublicKey is nil if the key could not be parsed.
+	PublicKey interface{}
+
+	Extensions            []pkix.Extension
+	BasicConstraintsValid bool
+	IsCA                  bool
+	// MaxPathLen is -1 if basicConstraints has no pathLenConstraint.
+	MaxPathLen     int
+	KeyUsage       x509.KeyUsage
+	ExtKeyUsage    []asn1.ObjectIdentifier
+	SubjectKeyId   []byte
+	AuthorityKeyId []byte
+
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []string
+	// OtherNames are the subject alternative names of the other types, as
+	// GeneralNames.
+	OtherNames []asn1.RawValue
+
+	PolicyIdentifiers       []asn1.ObjectIdentifier
+	NameConstraintsCritical bool
+	Permitted               GeneralSubtrees
+	Excluded                GeneralSubtrees
+
+	// Problems are the extensions that could not be decoded. A lenient
+	// parse records them rather than failing.
+	Problems []error
+	// Deviations are where the encoding departs from RFC 5280 in ways the
+	// lenient parser tolerates, such as a negative serial number.
+	Deviations []string
+	// Certificate is what crypto/x509 parsed, or nil if the lenient parser
+	// read the certificate.
+	Certificate *x509.Certificate
+}
+
+// GeneralSubtrees are the permitted or excluded subtrees of a
+// nameConstraints extension, by name type.
+type GeneralSubtrees struct {
+	DNSDomains     []string
+	IPRanges       []net.IPNet
+	EmailAddresses []string
+	URIDomains     []string
+	// DirectoryNames are DER-encoded like a certificate's RawSubject.
+	DirectoryNames [][]byte
+	// Other are the bases of subtrees of the other types, as GeneralNames.
+	Other []asn1.RawValue
+}
+
+// A CertParser reads a DER certificate into a Cert.
+type CertParser interface {
+	ParseCert(der []byte) (*Cert, error)
+}
+
+// StdlibParser parses certificates with crypto/x509, so it rejects what
+// crypto/x509 rejects.
+type StdlibParser struct{}
+
+// ParseCert parses der with crypto/x509.
+func (StdlibParser) ParseCert(der []byte) (*Cert, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return NewCert(cert)
+}
+
+// LenientParser decodes certificates with encoding/asn1 alone. It accepts
+// keys crypto/x509 cannot parse and extensions it cannot decode, recording
+// them in Cert.Problems, so that analyzers can still look at certificates
+// crypto/x509 rejects.
+type LenientParser struct{}
+
+type certificateASN1 struct {
+	Raw                asn1.RawContent
+	TBSCertificate     tbsCertificateASN1
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateASN1 struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           struct{ NotBefore, NotAfter asn1.RawValue }
+	Subject            asn1.RawValue
+	PublicKey          struct {
+		Raw       asn1.RawContent
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	UniqueID        asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions      []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// ParseCert decodes der leniently.
+func (LenientParser) ParseCert(der []byte) (*Cert, error) {
+	var raw certificateASN1
+	if rest, err := asn1.Unmarshal(der, &raw); err != nil {
+		return nil, fmt.Errorf("Could not decode certificate: %s", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after certificate")
+	}
+	tbs := raw.TBSCertificate
+	c := &Cert{
+		Raw:                     raw.Raw,
+		RawTBSCertificate:       tbs.Raw,
+		RawSubjectPublicKeyInfo: tbs.PublicKey.Raw,
+		RawSubject:              tbs.Subject.FullBytes,
+		RawIssuer:               tbs.Issuer.FullBytes,
+		Version:                 tbs.Version + 1,
+		SerialNumber:            tbs.SerialNumber,
+		SignatureAlgorithm:      raw.SignatureAlgorithm.Algorithm,
+		Signature:               raw.SignatureValue.RightAlign(),
+		PublicKeyAlgorithm:      tbs.PublicKey.Algorithm.Algorithm,
+		Extensions:              tbs.Extensions,
+		MaxPathLen:              -1,
+	}
+	for _, name := range []struct {
+		raw  []byte
+		name *pkix.Name
+	}{{c.RawIssuer, &c.Issuer}, {c.RawSubject, &c.Subject}} {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.raw, &rdns); err != nil {
+			return nil, fmt.Errorf("Could not decode name: %s", err)
+		}
+		name.name.FillFromRDNSequence(&rdns)
+	}
+	if len(tbs.Issuer.Bytes) == 0 {
+		c.Deviations = append(c.Deviations, "The issuer is an empty name")
+	}
+	if c.SerialNumber.Sign() < 0 {
+		c.Deviations = append(c.Deviations, fmt.Sprintf("The serial number %s is negative", c.SerialNumber))
+	}
+	for _, validity := range []struct {
+		field string
+		raw   asn1.RawValue
+		time  *time.Time
+	}{{"notBefore", tbs.Validity.NotBefore, &c.NotBefore}, {"notAfter", tbs.Validity.NotAfter, &c.NotAfter}} {
+		deviation, err := parseValidityTime(validity.raw, validity.time)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode %s: %s", validity.field, err)
+		}
+		if len(deviation) > 0 {
+			c.Deviations = append(c.Deviations, fmt.Sprintf("The %s %s", validity.field, deviation))
+		}
+	}
+	// Clients disagree on which of two extensions of one OID applies, so
+	// crypto/x509 rejects them; two NameConstraints may be read as their
+	// union, their intersection, or just the first
+	duplicates, counts := duplicateExtensions(c.Extensions)
+	for _, id := range duplicates {
+		c.Deviations = append(c.Deviations, fmt.Sprintf("The extension %s appears %d times", extensionName(id), counts[id.String()]))
+	}
+	if key, err := x509.ParsePKIXPublicKey(c.RawSubjectPublicKeyInfo); err == nil {
+		c.PublicKey = key
+	} else {
+		c.Problems = append(c.Problems, fmt.Errorf("Could not parse public key: %s", err))
+	}
+	c.decodeExtensions()
+	return c, nil
+}
+
+// parseValidityTime decodes raw, a notBefore or notAfter, into t, returning
+// how it deviates from RFC 5280, section 4.1.2.5, if it does: times before
+// 2050 must be UTCTime, which crypto/x509 does not insist on.
+func parseValidityTime(raw asn1.RawValue, t *time.Time) (string, error) {
+	if raw.Class != asn1.ClassUniversal || (raw.Tag != asn1.TagUTCTime && raw.Tag != asn1.TagGeneralizedTime) {
+		return "", fmt.Errorf("Not a UTCTime or GeneralizedTime")
+	}
+	if err := unmarshalAll(raw.FullBytes, t); err != nil {
+		return "", err
+	}
+	if raw.Tag == asn1.TagGeneralizedTime && t.Year() < 2050 {
+		return fmt.Sprintf("%s is a GeneralizedTime, where RFC 5280 requires UTCTime before 2050", t.UTC().Format(time.RFC3339)), nil
+	}
+	return "", nil
+}
+
+// NewCert models a certificate crypto/x509 has parsed.
+func NewCert(cert *x509.Certificate) (*Cert, error) {
+	c, err := LenientParser{}.ParseCert(cert.Raw)
+	if err != nil {
+		return nil, err
+	}
+	c.PublicKey, c.Certificate = cert.PublicKey, cert
+	return c, nil
+}
+
+// addGeneralSubtree adds the base of a name constraint to subtrees.
+func (subtrees *GeneralSubtrees) addGeneralSubtree(subtree generalSubtree) error {
+	base := subtree.Base
+	if base.Class != asn1.ClassContextSpecific {
+		subtrees.Other = append(subtrees.Other, base)
+		return nil
+	}
+	switch base.Tag {
+	case 2:
+		subtrees.DNSDomains = append(subtrees.DNSDomains, string(base.Bytes))
+	case 7:
+		if len(base.Bytes) != 2*net.IPv4len && len(base.Bytes) != 2*net.IPv6len {
+			return fmt.Errorf("Invalid iPAddress constraint of %d bytes", len(base.Bytes))
+		}
+		half := len(base.Bytes) / 2
+		subtrees.IPRanges = append(subtrees.IPRanges, net.IPNet{IP: base.Bytes[:half], Mask: base.Bytes[half:]})
+	case generalNameURI:
+		subtrees.URIDomains = append(subtrees.URIDomains, string(base.Bytes))
+	case generalNameRFC822Name, generalNameDirectoryName:
+		return addSubtree(subtree, &subtrees.EmailAddresses, &subtrees.DirectoryNames)
+	default:
+		subtrees.Other = append(subtrees.Other, base)
+	}
+	return nil
+}
+
+// decodeExtensions fills in the fields c models from its extensions,
+// recording those that cannot be decoded in c.Problems.
+func (c *Cert) decodeExtensions() {
+	for _, ext := range c.Extensions {
+		var err error
+		switch {
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			var constraints struct {
+				IsCA       bool `asn1:"optional"`
+				MaxPathLen int  `asn1:"optional,default:-1"`
+			}
+			if err = unmarshalAll(ext.Value, &constraints); err == nil {
+				c.BasicConstraintsValid, c.IsCA, c.MaxPathLen = true, constraints.IsCA, constraints.MaxPathLen
+			}
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if err = unmarshalAll(ext.Value, &bits); err == nil {
+				for i := 0; i < 9; i++ {
+					if bits.At(i) != 0 {
+						c.KeyUsage |= 1 << uint(i)
+					}
+				}
+			}
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			err = unmarshalAll(ext.Value, &c.ExtKeyUsage)
+		case ext.Id.Equal(oidExtensionSubjectKeyID):
+			err = unmarshalAll(ext.Value, &c.SubjectKeyId)
+		case ext.Id.Equal(oidExtensionAuthorityKeyID):
+			var aki struct {
+				ID []byte `asn1:"optional,tag:0"`
+			}
+			if rest, unmarshalErr := asn1.Unmarshal(ext.Value, &aki); unmarshalErr != nil {
+				err = unmarshalErr
+			} else if len(rest) > 0 {
+				err = fmt.Errorf("Trailing data")
+			}
+			c.AuthorityKeyId = aki.ID
+		case ext.Id.Equal(oidExtensionSubjectAltName):
+			var names []asn1.RawValue
+			if err = unmarshalAll(ext.Value, &names); err != nil {
+				break
+			}
+			for _, name := range names {
+				switch {
+				case name.Class != asn1.ClassContextSpecific:
+					c.OtherNames = append(c.OtherNames, name)
+				case name.Tag == 1:
+					c.EmailAddresses = append(c.EmailAddresses, string(name.Bytes))
+				case name.Tag == 2:
+					c.DNSNames = append(c.DNSNames, string(name.Bytes))
+				case name.Tag == generalNameURI:
+					c.URIs = append(c.URIs, string(name.Bytes))
+				case name.Tag == 7 && (len(name.Bytes) == net.IPv4len || len(name.Bytes) == net.IPv6len):
+					c.IPAddresses = append(c.IPAddresses, net.IP(name.Bytes))
+				default:
+					c.OtherNames = append(c.OtherNames, name)
+				}
+			}
+		case ext.Id.Equal(oidExtensionNameConstraints):
+			var constraints nameConstraintsASN1
+			if err = unmarshalAll(ext.Value, &constraints); err != nil {
+				break
+			}
+			c.NameConstraintsCritical = ext.Critical
+			for _, subtree := range constraints.Permitted {
+				if err = c.Permitted.addGeneralSubtree(subtree); err != nil {
+					break
+				}
+			}
+			for _, subtree := range constraints.Excluded {
+				if err == nil {
+					err = c.Excluded.addGeneralSubtree(subtree)
+				}
+			}
+		case ext.Id.Equal(oidExtensionCertificatePolicies):
+			var policies []policyInformation
+			if err = unmarshalAll(ext.Value, &policies); err == nil {
+				for _, policy := range policies {
+					c.PolicyIdentifiers = append(c.PolicyIdentifiers, policy.Policy)
+				}
+			}
+		}
+		if err != nil {
+			c.Problems = append(c.Problems, fmt.Errorf("Could not decode extension %s: %s", ext.Id, err))
+		}
+	}
+}
+
+var extKeyUsageOIDs = map[string]x509.ExtKeyUsage{
+	"2.5.29.37.0":            x509.ExtKeyUsageAny,
+	"1.3.6.1.5.5.7.3.1":      x509.ExtKeyUsageServerAuth,
+	"1.3.6.1.5.5.7.3.2":      x509.ExtKeyUsageClientAuth,
+	"1.3.6.1.5.5.7.3.3":      x509.ExtKeyUsageCodeSigning,
+	"1.3.6.1.5.5.7.3.4":      x509.ExtKeyUsageEmailProtection,
+	"1.3.6.1.5.5.7.3.5":      x509.ExtKeyUsageIPSECEndSystem,
+	"1.3.6.1.5.5.7.3.6":      x509.ExtKeyUsageIPSECTunnel,
+	"1.3.6.1.5.5.7.3.7":      x509.ExtKeyUsageIPSECUser,
+	"1.3.6.1.5.5.7.3.8":      x509.ExtKeyUsageTimeStamping,
+	"1.3.6.1.5.5.7.3.9":      x509.ExtKeyUsageOCSPSigning,
+	"1.3.6.1.4.1.311.10.3.3": x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"2.16.840.1.113730.4.1":  x509.ExtKeyUsageNetscapeServerGatedCrypto,
+}
+
+var signatureAlgorithmOIDs = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.2":   x509.MD2WithRSA,
+	"1.2.840.113549.1.1.4":   x509.MD5WithRSA,
+	"1.2.840.113549.1.1.5":   x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11":  x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12":  x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13":  x509.SHA512WithRSA,
+	"1.2.840.10040.4.3":      x509.DSAWithSHA1,
+	"2.16.840.1.101.3.4.3.2": x509.DSAWithSHA256,
+	"1.2.840.10045.4.1":      x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":    x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":    x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":    x509.ECDSAWithSHA512,
+}
+
+var publicKeyAlgorithmOIDs = map[string]x509.PublicKeyAlgorithm{
+	"1.2.840.113549.1.1.1": x509.RSA,
+	"1.2.840.10040.4.1":    x509.DSA,
+	"1.2.840.10045.2.1":    x509.ECDSA,
+}
+
+// X509 returns c as an x509.Certificate, for the analyzers that take one:
+// the certificate crypto/x509 parsed, or one filled in from c if the
+// lenient parser read it. The fields crypto/x509 has no place for are lost.
+func (c *Cert) X509() *x509.Certificate {
+	if c.Certificate != nil {
+		return c.Certificate
+	}
+	cert := &x509.Certificate{
+		Raw:                         c.Raw,
+		RawTBSCertificate:           c.RawTBSCertificate,
+		RawSubjectPublicKeyInfo:     c.RawSubjectPublicKeyInfo,
+		RawSubject:                  c.RawSubject,
+		RawIssuer:                   c.RawIssuer,
+		Signature:                   c.Signature,
+		SignatureAlgorithm:          signatureAlgorithmOIDs[c.SignatureAlgorithm.String()],
+		PublicKeyAlgorithm:          publicKeyAlgorithmOIDs[c.PublicKeyAlgorithm.String()],
+		PublicKey:                   c.PublicKey,
+		Version:                     c.Version,
+		SerialNumber:                c.SerialNumber,
+		Issuer:                      c.Issuer,
+		Subject:                     c.Subject,
+		NotBefore:                   c.NotBefore,
+		NotAfter:                    c.NotAfter,
+		KeyUsage:                    c.KeyUsage,
+		Extensions:                  c.Extensions,
+		BasicConstraintsValid:       c.BasicConstraintsValid,
+		IsCA:                        c.IsCA,
+		MaxPathLen:                  c.MaxPathLen,
+		MaxPathLenZero:              c.MaxPathLen == 0,
+		SubjectKeyId:                c.SubjectKeyId,
+		AuthorityKeyId:              c.AuthorityKeyId,
+		DNSNames:                    c.DNSNames,
+		EmailAddresses:              c.EmailAddresses,
+		IPAddresses:                 c.IPAddresses,
+		PermittedDNSDomainsCritical: c.NameConstraintsCritical,
+		PermittedDNSDomains:         c.Permitted.DNSDomains,
+		ExcludedDNSDomains:          c.Excluded.DNSDomains,
+		PolicyIdentifiers:           c.PolicyIdentifiers,
+	}
+	for _, network := range c.Permitted.IPRanges {
+		cert.PermittedIPAddresses = append(cert.PermittedIPAddresses, network)
+	}
+	for _, network := range c.Excluded.IPRanges {
+		cert.ExcludedIPAddresses = append(cert.ExcludedIPAddresses, network)
+	}
+	for _, oid := range c.ExtKeyUsage {
+		if usage, ok := extKeyUsageOIDs[oid.String()]; ok {
+			cert.ExtKeyUsage = append(cert.ExtKeyUsage, usage)
+		} else {
+			cert.UnknownExtKeyUsage = append(cert.UnknownExtKeyUsage, oid)
+		}
+	}
+	return cert
+}
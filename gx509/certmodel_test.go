@@ -0,0 +1,141 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCertParsers(t *testing.T) {
+	t.Parallel()
+
+	certs, err := ParseCertificatesFromBytes([]byte(testTextCertificate))
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+	for _, parser := range []CertParser{StdlibParser{}, LenientParser{}} {
+		c, err := parser.ParseCert(certs[0].Raw)
+		if err != nil {
+			t.Fatalf("%T could not parse certificate: %s", parser, err)
+		}
+		if len(c.Problems) > 0 {
+			t.Errorf("%T found problems: %v", parser, c.Problems)
+		}
+		if c.Subject.CommonName != "Acme Test CA" || !c.IsCA || c.MaxPathLen != 0 || c.Version != 3 {
+			t.Errorf("%T parsed %s as CA %t with path length %d", parser, c.Subject.CommonName, c.IsCA, c.MaxPathLen)
+		}
+		if !reflect.DeepEqual(c.URIs, []string{"https://example.com/"}) || len(c.IPAddresses) != 1 {
+			t.Errorf("%T parsed the wrong names: %v, %v", parser, c.URIs, c.IPAddresses)
+		}
+		if len(c.Permitted.IPRanges) != 2 || !reflect.DeepEqual(c.Excluded.EmailAddresses, []string{".example.org"}) {
+			t.Errorf("%T parsed the wrong name constraints: %+v, %+v", parser, c.Permitted, c.Excluded)
+		}
+
+		cert := c.X509()
+		if !AnalyzeTechnicalConstraints(cert).Constrained {
+			t.Errorf("%T: expected a CA with dNSName and iPAddress constraints to be constrained", parser)
+		}
+		if len(cert.ExtKeyUsage) != 2 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth || cert.SignatureAlgorithm != x509.ECDSAWithSHA256 {
+			t.Errorf("%T: expected serverAuth and clientAuth signed with ECDSA, got %v and %v", parser, cert.ExtKeyUsage, cert.SignatureAlgorithm)
+		}
+	}
+}
+
+func TestLenientParser(t *testing.T) {
+	t.Parallel()
+
+	// URI constraints and registeredID names are dropped by crypto/x509,
+	// and a malformed extension makes it reject the certificate
+	uriConstraint, _ := asn1.Marshal(nameConstraintsASN1{
+		Permitted: []generalSubtree{{Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameURI, Bytes: []byte(".example.com")}}},
+	})
+	registeredID, _ := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 8, Bytes: []byte{0x2a, 0x03, 0x04}}})
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Lenient CA"},
+		NotBefore:    time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionNameConstraints, Value: uriConstraint},
+			{Id: oidExtensionSubjectAltName, Value: registeredID},
+			{Id: oidExtensionKeyUsage, Value: []byte{0x03, 0x05}},
+		},
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Lenient CA"}}, &testPrivateKey.PublicKey, testPrivateKey)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %s", err)
+	}
+
+	if _, err := (StdlibParser{}).ParseCert(der); err == nil {
+		t.Errorf("Expected crypto/x509 to reject a malformed keyUsage")
+	}
+	c, err := LenientParser{}.ParseCert(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate leniently: %s", err)
+	}
+	if len(c.Problems) != 1 || c.Certificate != nil {
+		t.Errorf("Expected one problem, with keyUsage, got %v", c.Problems)
+	}
+	if !reflect.DeepEqual(c.Permitted.URIDomains, []string{".example.com"}) || len(c.OtherNames) != 1 || c.OtherNames[0].Tag != 8 {
+		t.Errorf("Expected the URI constraint and registeredID name, got %v and %v", c.Permitted.URIDomains, c.OtherNames)
+	}
+	if cert := c.X509(); cert.Subject.CommonName != "Lenient CA" || cert.PublicKeyAlgorithm != x509.RSA || cert.SerialNumber.Int64() != 1 {
+		t.Errorf("Expected the lenient parse as an x509.Certificate, got %+v", cert)
+	}
+}
+
+// deviantCertificate re-encodes cert with a negative serial number, an empty
+// issuer and a notBefore GeneralizedTime before 2050. The signature no
+// longer verifies, which parsing does not check.
+func deviantCertificate(t *testing.T, cert *x509.Certificate) []byte {
+	var raw certificateASN1
+	if _, err := asn1.Unmarshal(cert.Raw, &raw); err != nil {
+		t.Fatalf("Could not decode certificate: %s", err)
+	}
+	notBefore, err := asn1.MarshalWithParams(time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC), "generalized")
+	if err != nil {
+		t.Fatalf("Could not encode notBefore: %s", err)
+	}
+	raw.Raw, raw.TBSCertificate.Raw, raw.TBSCertificate.PublicKey.Raw = nil, nil, nil
+	raw.TBSCertificate.SerialNumber = big.NewInt(-42)
+	raw.TBSCertificate.Issuer = asn1.RawValue{FullBytes: []byte{0x30, 0x00}}
+	raw.TBSCertificate.Validity.NotBefore = asn1.RawValue{FullBytes: notBefore}
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		t.Fatalf("Could not encode certificate: %s", err)
+	}
+	return der
+}
+
+func TestLenientParserDeviations(t *testing.T) {
+	t.Parallel()
+
+	leaf := testChain(t, "www.example.com")[0]
+	c, err := LenientParser{}.ParseCert(deviantCertificate(t, leaf))
+	if err != nil {
+		t.Fatalf("Could not parse certificate leniently: %s", err)
+	}
+	want := []string{
+		"The issuer is an empty name",
+		"The serial number -42 is negative",
+		"The notBefore 2019-03-01T00:00:00Z is a GeneralizedTime, where RFC 5280 requires UTCTime before 2050",
+	}
+	if !reflect.DeepEqual(c.Deviations, want) {
+		t.Errorf("Expected deviations %q, got %q", want, c.Deviations)
+	}
+	if !c.NotBefore.Equal(time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)) || !c.NotAfter.Equal(leaf.NotAfter) || c.SerialNumber.Int64() != -42 {
+		t.Errorf("Expected the deviant fields to be kept, got %s, %s and %s", c.NotBefore, c.NotAfter, c.SerialNumber)
+	}
+
+	if c, err := (LenientParser{}).ParseCert(leaf.Raw); err != nil || len(c.Deviations) > 0 {
+		t.Errorf("Expected no deviations in a conforming certificate, got %q, %v", c.Deviations, err)
+	}
+}
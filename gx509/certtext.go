@@ -0,0 +1,233 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/dsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+func opensslName(oid asn1.ObjectIdentifier) string {
+	return DefaultOIDRegistry.Name(oid)
+}
+
+// formatOpenSSLName formats a DER-encoded name as openssl does by default,
+// e.g. "C = US, O = Acme Co, CN = Acme CA", or, if slashes, as
+// "/C=US/O=Acme Co/CN=Acme CA".
+func formatOpenSSLName(raw []byte, slashes bool) string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(raw, &rdns); err != nil {
+		return "<invalid name>"
+	}
+	var parts []string
+	for _, rdn := range rdns {
+		var attributes []string
+		for _, attribute := range rdn {
+			value, ok := attribute.Value.(string)
+			if !ok {
+				der, _ := asn1.Marshal(attribute.Value)
+				value = fmt.Sprintf("#%X", der)
+			} else if !slashes && (strings.ContainsAny(value, `,+"\<>;`) || strings.TrimSpace(value) != value) {
+				value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+			}
+			if slashes {
+				attributes = append(attributes, opensslName(attribute.Type)+"="+value)
+			} else {
+				attributes = append(attributes, opensslName(attribute.Type)+" = "+value)
+			}
+		}
+		if slashes {
+			parts = append(parts, "/"+strings.Join(attributes, "+"))
+		} else {
+			parts = append(parts, strings.Join(attributes, " + "))
+		}
+	}
+	if slashes {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// colonHex formats b as colon-separated hex bytes.
+func colonHex(b []byte, upper bool) string {
+	format := "%02x"
+	if upper {
+		format = "%02X"
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf(format, c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// hexBlock formats b as colon-separated lowercase hex, perLine bytes to a
+// line, each line but the last ending in a colon.
+func hexBlock(b []byte, perLine int) []string {
+	var lines []string
+	for len(b) > 0 {
+		n := perLine
+		if n > len(b) {
+			n = len(b)
+		}
+		line := colonHex(b[:n], false)
+		if n < len(b) {
+			line += ":"
+		}
+		lines = append(lines, line)
+		b = b[n:]
+	}
+	return lines
+}
+
+// bigIntBytes is n as openssl prints integers in key dumps: big-endian, with
+// a leading zero byte if the top bit is set.
+func bigIntBytes(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+// printableText renders b as openssl renders extensions it does not know:
+// printable ASCII as is and everything else as dots.
+func printableText(b []byte) string {
+	text := make([]byte, len(b))
+	for i, c := range b {
+		if c < ' ' || c > '~' {
+			c = '.'
+		}
+		text[i] = c
+	}
+	return string(text)
+}
+
+// WriteCertificateText writes cert in the format of openssl x509 -text, so
+// that gx509 can stand in for openssl when inspecting certificates.
+func WriteCertificateText(w io.Writer, cert *x509.Certificate) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	block := func(indent string, lines []string) {
+		for _, line := range lines {
+			printf("%s%s\n", indent, line)
+		}
+	}
+
+	var outer struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+	}
+	asn1.Unmarshal(cert.Raw, &outer)
+	signatureAlgorithm := opensslName(outer.SignatureAlgorithm.Algorithm)
+
+	printf("Certificate:\n    Data:\n")
+	printf("        Version: %d (0x%x)\n", cert.Version, cert.Version-1)
+	if serial := cert.SerialNumber; serial.IsInt64() && serial.Int64() != -1 {
+		if serial.Sign() < 0 {
+			printf("        Serial Number: %d (-0x%x)\n", serial, new(big.Int).Neg(serial))
+		} else {
+			printf("        Serial Number: %d (0x%x)\n", serial, serial)
+		}
+	} else {
+		negative := ""
+		if serial.Sign() < 0 {
+			negative = " (Negative)"
+		}
+		printf("        Serial Number:%s\n", negative)
+		printf("            %s\n", colonHex(new(big.Int).Abs(serial).Bytes(), false))
+	}
+	printf("        Signature Algorithm: %s\n", signatureAlgorithm)
+	printf("        Issuer: %s\n", formatOpenSSLName(cert.RawIssuer, false))
+	printf("        Validity\n")
+	printf("            Not Before: %s\n", cert.NotBefore.UTC().Format("Jan _2 15:04:05 2006 GMT"))
+	printf("            Not After : %s\n", cert.NotAfter.UTC().Format("Jan _2 15:04:05 2006 GMT"))
+	printf("        Subject: %s\n", formatOpenSSLName(cert.RawSubject, false))
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki)
+	printf("        Subject Public Key Info:\n")
+	printf("            Public Key Algorithm: %s\n", opensslName(spki.Algorithm.Algorithm))
+	const keyIndent = "                    "
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		printf("                Public-Key: (%d bit)\n", key.N.BitLen())
+		printf("                Modulus:\n")
+		block(keyIndent, hexBlock(bigIntBytes(key.N), 15))
+		printf("                Exponent: %d (0x%x)\n", key.E, key.E)
+	case *dsa.PublicKey:
+		printf("                Public-Key: (%d bit)\n", key.P.BitLen())
+		for _, part := range []struct {
+			name  string
+			value *big.Int
+		}{{"pub", key.Y}, {"P", key.P}, {"Q", key.Q}, {"G", key.G}} {
+			printf("                %s:\n", part.name)
+			block(keyIndent, hexBlock(bigIntBytes(part.value), 15))
+		}
+	default:
+		switch opensslName(spki.Algorithm.Algorithm) {
+		case "id-ecPublicKey":
+			var curve asn1.ObjectIdentifier
+			asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &curve)
+			names, known := DefaultOIDRegistry.Curves[curve.String()]
+			if bits := (len(spki.PublicKey.Bytes) - 1) / 2 * 8; known {
+				if names[1] == "P-521" {
+					bits = 521
+				}
+				printf("                Public-Key: (%d bit)\n", bits)
+			}
+			printf("                pub:\n")
+			block(keyIndent, hexBlock(spki.PublicKey.Bytes, 15))
+			if known {
+				printf("                ASN1 OID: %s\n", names[0])
+				printf("                NIST CURVE: %s\n", names[1])
+			} else {
+				printf("                ASN1 OID: %s\n", curve)
+			}
+		case "ED25519", "ED448":
+			printf("                %s Public-Key:\n", opensslName(spki.Algorithm.Algorithm))
+			printf("                pub:\n")
+			block(keyIndent, hexBlock(spki.PublicKey.Bytes, 15))
+		default:
+			printf("                Unable to load Public Key\n")
+		}
+	}
+
+	if len(cert.Extensions) > 0 {
+		printf("        X509v3 extensions:\n")
+		for _, ext := range cert.Extensions {
+			decoded := DecodeExtension(ext)
+			// openssl shows what it cannot decode as text rather than hex
+			if !decoded.Known || decoded.Err != nil {
+				decoded.Lines = []string{printableText(ext.Value)}
+			}
+			critical := ""
+			if ext.Critical {
+				critical = "critical"
+			}
+			printf("            %s: %s\n", decoded.Name, critical)
+			block("                ", decoded.Lines)
+		}
+	}
+
+	printf("    Signature Algorithm: %s\n", signatureAlgorithm)
+	printf("    Signature Value:\n")
+	block("        ", hexBlock(cert.Signature, 18))
+	return err
+}
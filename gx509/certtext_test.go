@@ -0,0 +1,138 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const (
+	testTextCertificate = `-----BEGIN CERTIFICATE-----
+MIIDZjCCAwygAwIBAgINUm9uYWxkIFJlYWdhYDAKBggqhkjOPQQDAjA4MQswCQYD
+VQQGEwJVUzESMBAGA1UECgwJQWNtZSwgSW5jMRUwEwYDVQQDDAxBY21lIFRlc3Qg
+Q0EwHhcNMjYxMDE1MDIyMjI1WhcNMjcxMDE1MDIyMjI1WjA4MQswCQYDVQQGEwJV
+UzESMBAGA1UECgwJQWNtZSwgSW5jMRUwEwYDVQQDDAxBY21lIFRlc3QgQ0EwWTAT
+BgcqhkjOPQIBBggqhkjOPQMBBwNCAASwly7Udy74T8vb7xY0in9t55+wJsI7ngcM
+jycuBxzyeEiZFKvS33p1auBn4O2vtR5dmPmZvuPDadha300CzPoJo4IB+TCCAfUw
+EgYDVR0TAQH/BAgwBgEB/wIBADAOBgNVHQ8BAf8EBAMCAYYwHQYDVR0lBBYwFAYI
+KwYBBQUHAwEGCCsGAQUFBwMCMB0GA1UdDgQWBBQxXQr+LRD25IRT/A5tdZJw1keB
+nTAMBgNVHSQEBTADgAEAMA4GAyoDYwQHDAVoZWxsbzBBBgNVHREEOjA4ggtleGFt
+cGxlLmNvbYcECgAAAYENYUBleGFtcGxlLmNvbYYUaHR0cHM6Ly9leGFtcGxlLmNv
+bS8wRgYDVR0gBD8wPTAIBgZngQwBAgEwMQYJKwYBBAGGjR8BMCQwIgYIKwYBBQUH
+AgEWFmh0dHA6Ly9leGFtcGxlLmNvbS9jcHMwLgYDVR0fBCcwJTAjoCGgH4YdaHR0
+cDovL2NybC5leGFtcGxlLmNvbS9jYS5jcmwwWgYIKwYBBQUHAQEETjBMMCMGCCsG
+AQUFBzABhhdodHRwOi8vb2NzcC5leGFtcGxlLmNvbTAlBggrBgEFBQcwAoYZaHR0
+cDovL2V4YW1wbGUuY29tL2NhLmNydDBcBgNVHR4EVTBToD8wDYILZXhhbXBsZS5j
+b20wCocICgAAAP8AAAAwIocgIAENuAAAAAAAAAAAAAAAAP////8AAAAAAAAAAAAA
+AAChEDAOgQwuZXhhbXBsZS5vcmcwCgYIKoZIzj0EAwIDSAAwRQIgPA3KDEqwS4aB
+XR+8AZcjA83kbIwlLsriEyt8CCqwBvECIQCGdUP4SzNZ8RZ1lwT6U9va6Afqzl+h
+B1UkxRY/FRyQlw==
+-----END CERTIFICATE-----`
+
+	// From openssl x509 -text -noout, which leaves a space after the name
+	// of each extension that is not critical
+	testTextExpected = `Certificate:
+    Data:
+        Version: 3 (0x2)
+        Serial Number:
+            52:6f:6e:61:6c:64:20:52:65:61:67:61:60
+        Signature Algorithm: ecdsa-with-SHA256
+        Issuer: C = US, O = "Acme, Inc", CN = Acme Test CA
+        Validity
+            Not Before: Oct 15 02:22:25 2026 GMT
+            Not After : Oct 15 02:22:25 2027 GMT
+        Subject: C = US, O = "Acme, Inc", CN = Acme Test CA
+        Subject Public Key Info:
+            Public Key Algorithm: id-ecPublicKey
+                Public-Key: (256 bit)
+                pub:
+                    04:b0:97:2e:d4:77:2e:f8:4f:cb:db:ef:16:34:8a:
+                    7f:6d:e7:9f:b0:26:c2:3b:9e:07:0c:8f:27:2e:07:
+                    1c:f2:78:48:99:14:ab:d2:df:7a:75:6a:e0:67:e0:
+                    ed:af:b5:1e:5d:98:f9:99:be:e3:c3:69:d8:5a:df:
+                    4d:02:cc:fa:09
+                ASN1 OID: prime256v1
+                NIST CURVE: P-256
+        X509v3 extensions:
+            X509v3 Basic Constraints: critical
+                CA:TRUE, pathlen:0
+            X509v3 Key Usage: critical
+                Digital Signature, Certificate Sign, CRL Sign
+            X509v3 Extended Key Usage: 
+                TLS Web Server Authentication, TLS Web Client Authentication
+            X509v3 Subject Key Identifier: 
+                31:5D:0A:FE:2D:10:F6:E4:84:53:FC:0E:6D:75:92:70:D6:47:81:9D
+            X509v3 Policy Constraints: 
+                Require Explicit Policy:0
+            1.2.3.99: 
+                ..hello
+            X509v3 Subject Alternative Name: 
+                DNS:example.com, IP Address:10.0.0.1, email:a@example.com, URI:https://example.com/
+            X509v3 Certificate Policies: 
+                Policy: 2.23.140.1.2.1
+                Policy: 1.3.6.1.4.1.99999.1
+                  CPS: http://example.com/cps
+            X509v3 CRL Distribution Points: 
+                Full Name:
+                  URI:http://crl.example.com/ca.crl
+            Authority Information Access: 
+                OCSP - URI:http://ocsp.example.com
+                CA Issuers - URI:http://example.com/ca.crt
+            X509v3 Name Constraints: 
+                Permitted:
+                  DNS:example.com
+                  IP:10.0.0.0/255.0.0.0
+                  IP:2001:DB8:0:0:0:0:0:0/FFFF:FFFF:0:0:0:0:0:0
+                Excluded:
+                  email:.example.org
+    Signature Algorithm: ecdsa-with-SHA256
+    Signature Value:
+        30:45:02:20:3c:0d:ca:0c:4a:b0:4b:86:81:5d:1f:bc:01:97:
+        23:03:cd:e4:6c:8c:25:2e:ca:e2:13:2b:7c:08:2a:b0:06:f1:
+        02:21:00:86:75:43:f8:4b:33:59:f1:16:75:97:04:fa:53:db:
+        da:e8:07:ea:ce:5f:a1:07:55:24:c5:16:3f:15:1c:90:97
+`
+)
+
+func TestWriteCertificateText(t *testing.T) {
+	t.Parallel()
+
+	certs, err := ParseCertificatesFromBytes([]byte(testTextCertificate))
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+	var out bytes.Buffer
+	if err := WriteCertificateText(&out, certs[0]); err != nil {
+		t.Fatalf("Could not write certificate: %s", err)
+	}
+	expected, actual := strings.Split(testTextExpected, "\n"), strings.Split(out.String(), "\n")
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		if i >= len(expected) || i >= len(actual) || expected[i] != actual[i] {
+			t.Fatalf("Line %d differs from openssl:\n%s", i+1, out.String())
+		}
+	}
+}
+
+func TestWriteCertificateTextRSA(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	if err := WriteCertificateText(&out, testChain(t, "www.example.com")[0]); err != nil {
+		t.Fatalf("Could not write certificate: %s", err)
+	}
+	for _, expected := range []string{
+		"        Serial Number: 3 (0x3)\n",
+		"            Public Key Algorithm: rsaEncryption\n                Public-Key: (512 bit)\n                Modulus:\n                    00:",
+		"                Exponent: 65537 (0x10001)\n",
+		"            X509v3 Subject Alternative Name: \n                DNS:www.example.com\n",
+		"    Signature Algorithm: sha256WithRSAEncryption\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
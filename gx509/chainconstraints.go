@@ -0,0 +1,276 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// EffectiveNameConstraints are the name constraints the CAs of a chain impose
+// together. A name must fall within the permitted subtrees of every CA that
+// has any of its type, so those are intersected, and outside the excluded
+// subtrees of every CA, so those are combined.
+type EffectiveNameConstraints struct {
+	// The *Constrained fields are whether any CA had permitted subtrees of
+	// the type. A constrained type with no permitted subtrees left after the
+	// intersection permits nothing.
+	DNSConstrained           bool
+	IPConstrained            bool
+	EmailConstrained         bool
+	DirectoryNameConstrained bool
+
+	PermittedDNSDomains     []string
+	ExcludedDNSDomains      []string
+	PermittedIPRanges       []net.IPNet
+	ExcludedIPRanges        []net.IPNet
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	// PermittedDirectoryNames and ExcludedDirectoryNames are DER-encoded;
+	// FormatDistinguishedName formats them.
+	PermittedDirectoryNames [][]byte
+	ExcludedDirectoryNames  [][]byte
+}
+
+// dnsSubtreeWithin reports whether every name in the dNSName subtree a is in
+// the subtree b, treating a leading dot as subdomains only.
+func dnsSubtreeWithin(a, b string) bool {
+	a = strings.ToLower(strings.TrimSuffix(a, "."))
+	b = strings.ToLower(strings.TrimSuffix(b, "."))
+	aHost, bHost := strings.TrimPrefix(a, "."), strings.TrimPrefix(b, ".")
+	switch {
+	case len(bHost) == 0:
+		return true
+	case len(aHost) == 0:
+		return false
+	case strings.HasSuffix(aHost, "."+bHost):
+		return true
+	}
+	return aHost == bHost && (strings.HasPrefix(a, ".") || !strings.HasPrefix(b, "."))
+}
+
+// emailSubtreeWithin reports whether every mailbox in the rfc822Name subtree
+// a is in the subtree b.
+func emailSubtreeWithin(a, b string) bool {
+	switch {
+	case strings.Contains(a, "@"):
+		return emailConstraintMatch(a, b)
+	case strings.Contains(b, "@"):
+		return false
+	case strings.HasPrefix(a, "."):
+		return strings.HasPrefix(b, ".") && strings.HasSuffix(strings.ToLower(a), strings.ToLower(b))
+	case strings.HasPrefix(b, "."):
+		return strings.HasSuffix(strings.ToLower(a), strings.ToLower(b))
+	}
+	return strings.EqualFold(a, b)
+}
+
+// normalizeIPNet returns network with a 4-byte address and mask if it is
+// IPv4.
+func normalizeIPNet(network net.IPNet) net.IPNet {
+	if v4 := network.IP.To4(); v4 != nil {
+		mask := network.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		return net.IPNet{IP: v4, Mask: mask}
+	}
+	return network
+}
+
+// ipRangeWithin reports whether the iPAddress subtree a is inside b.
+func ipRangeWithin(a, b net.IPNet) bool {
+	a, b = normalizeIPNet(a), normalizeIPNet(b)
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes >= bOnes && ipNetContains(b, a.IP)
+}
+
+// ChainNameConstraints intersects the name constraints of the CAs in chain,
+// which starts with the leaf and ends with the trust anchor. The trust
+// anchor's constraints count, as they do for verifiers that honour them.
+func ChainNameConstraints(chain []*x509.Certificate) (EffectiveNameConstraints, error) {
+	var effective EffectiveNameConstraints
+	for i := len(chain) - 1; i > 0; i-- {
+		ca := chain[i]
+		constraints, err := ParseNameConstraints(ca)
+		if err != nil {
+			return effective, fmt.Errorf("Could not parse name constraints of %s: %s", ca.Subject.CommonName, err)
+		}
+
+		if len(ca.PermittedDNSDomains) > 0 {
+			if !effective.DNSConstrained {
+				effective.PermittedDNSDomains = append([]string{}, ca.PermittedDNSDomains...)
+			} else {
+				var intersection []string
+				for _, a := range effective.PermittedDNSDomains {
+					for _, b := range ca.PermittedDNSDomains {
+						if dnsSubtreeWithin(a, b) {
+							intersection = appendUnique(intersection, a)
+						} else if dnsSubtreeWithin(b, a) {
+							intersection = appendUnique(intersection, b)
+						}
+					}
+				}
+				effective.PermittedDNSDomains = intersection
+			}
+			effective.DNSConstrained = true
+		}
+		for _, excluded := range ca.ExcludedDNSDomains {
+			effective.ExcludedDNSDomains = appendUnique(effective.ExcludedDNSDomains, excluded)
+		}
+
+		if len(ca.PermittedIPAddresses) > 0 {
+			if !effective.IPConstrained {
+				effective.PermittedIPRanges = append([]net.IPNet{}, ca.PermittedIPAddresses...)
+			} else {
+				var intersection []net.IPNet
+				for _, a := range effective.PermittedIPRanges {
+					for _, b := range ca.PermittedIPAddresses {
+						if ipRangeWithin(a, b) {
+							intersection = appendUniqueIPNet(intersection, a)
+						} else if ipRangeWithin(b, a) {
+							intersection = appendUniqueIPNet(intersection, b)
+						}
+					}
+				}
+				effective.PermittedIPRanges = intersection
+			}
+			effective.IPConstrained = true
+		}
+		for _, excluded := range ca.ExcludedIPAddresses {
+			effective.ExcludedIPRanges = appendUniqueIPNet(effective.ExcludedIPRanges, excluded)
+		}
+
+		if len(constraints.PermittedEmailAddresses) > 0 {
+			if !effective.EmailConstrained {
+				effective.PermittedEmailAddresses = append([]string{}, constraints.PermittedEmailAddresses...)
+			} else {
+				var intersection []string
+				for _, a := range effective.PermittedEmailAddresses {
+					for _, b := range constraints.PermittedEmailAddresses {
+						if emailSubtreeWithin(a, b) {
+							intersection = appendUnique(intersection, a)
+						} else if emailSubtreeWithin(b, a) {
+							intersection = appendUnique(intersection, b)
+						}
+					}
+				}
+				effective.PermittedEmailAddresses = intersection
+			}
+			effective.EmailConstrained = true
+		}
+		for _, excluded := range constraints.ExcludedEmailAddresses {
+			effective.ExcludedEmailAddresses = appendUnique(effective.ExcludedEmailAddresses, excluded)
+		}
+
+		if len(constraints.PermittedDirectoryNames) > 0 {
+			if !effective.DirectoryNameConstrained {
+				effective.PermittedDirectoryNames = append([][]byte{}, constraints.PermittedDirectoryNames...)
+			} else {
+				var intersection [][]byte
+				for _, a := range effective.PermittedDirectoryNames {
+					for _, b := range constraints.PermittedDirectoryNames {
+						if directoryNameWithin(a, b) {
+							intersection = appendUniqueBytes(intersection, a)
+						} else if directoryNameWithin(b, a) {
+							intersection = appendUniqueBytes(intersection, b)
+						}
+					}
+				}
+				effective.PermittedDirectoryNames = intersection
+			}
+			effective.DirectoryNameConstrained = true
+		}
+		for _, excluded := range constraints.ExcludedDirectoryNames {
+			effective.ExcludedDirectoryNames = appendUniqueBytes(effective.ExcludedDirectoryNames, excluded)
+		}
+	}
+	return effective, nil
+}
+
+// Violations returns how the names of cert fall outside the constraints.
+func (c EffectiveNameConstraints) Violations(cert *x509.Certificate) []string {
+	var violations []string
+	for _, name := range cert.DNSNames {
+		permitted := !c.DNSConstrained
+		for _, constraint := range c.PermittedDNSDomains {
+			permitted = permitted || matchDNSConstraint(name, constraint, true)
+		}
+		for _, constraint := range c.ExcludedDNSDomains {
+			permitted = permitted && !matchDNSConstraint(name, constraint, true)
+		}
+		if !permitted {
+			violations = append(violations, fmt.Sprintf("dNSName %s is outside the chain's name constraints", name))
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		permitted := !c.IPConstrained
+		for _, constraint := range c.PermittedIPRanges {
+			permitted = permitted || ipNetContains(constraint, ip)
+		}
+		for _, constraint := range c.ExcludedIPRanges {
+			permitted = permitted && !ipNetContains(constraint, ip)
+		}
+		if !permitted {
+			violations = append(violations, fmt.Sprintf("iPAddress %s is outside the chain's name constraints", ip))
+		}
+	}
+	for _, mailbox := range cert.EmailAddresses {
+		permitted := !c.EmailConstrained
+		for _, constraint := range c.PermittedEmailAddresses {
+			permitted = permitted || emailConstraintMatch(mailbox, constraint)
+		}
+		for _, constraint := range c.ExcludedEmailAddresses {
+			permitted = permitted && !emailConstraintMatch(mailbox, constraint)
+		}
+		if !permitted {
+			violations = append(violations, fmt.Sprintf("rfc822Name %s is outside the chain's name constraints", mailbox))
+		}
+	}
+	if len(cert.Subject.Names) > 0 {
+		permitted := !c.DirectoryNameConstrained
+		for _, base := range c.PermittedDirectoryNames {
+			permitted = permitted || directoryNameWithin(cert.RawSubject, base)
+		}
+		for _, base := range c.ExcludedDirectoryNames {
+			permitted = permitted && !directoryNameWithin(cert.RawSubject, base)
+		}
+		if !permitted {
+			violations = append(violations, "the subject is outside the chain's directoryName constraints")
+		}
+	}
+	return violations
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func appendUniqueIPNet(networks []net.IPNet, network net.IPNet) []net.IPNet {
+	for _, existing := range networks {
+		if existing.String() == network.String() {
+			return networks
+		}
+	}
+	return append(networks, network)
+}
+
+func appendUniqueBytes(values [][]byte, value []byte) [][]byte {
+	for _, existing := range values {
+		if bytes.Equal(existing, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDNSSubtreeWithin(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"www.example.com", "example.com", true},
+		{"example.com", "example.com", true},
+		{".example.com", "example.com", true},
+		{"example.com", ".example.com", false},
+		{"example.com", "www.example.com", false},
+		{"badexample.com", "example.com", false},
+		{"example.com", "", true},
+	} {
+		if within := dnsSubtreeWithin(test.a, test.b); within != test.expected {
+			t.Errorf("Expected %q within %q to be %t", test.a, test.b, test.expected)
+		}
+	}
+}
+
+func TestChainNameConstraints(t *testing.T) {
+	t.Parallel()
+
+	ca := func(name string, serial int64, permitted []string, parent *x509.Certificate) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:              time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			PermittedDNSDomains:   permitted,
+		}
+		if parent == nil {
+			return serialiseAndParse(t, template)
+		}
+		return issueAndParse(t, template, parent)
+	}
+	root := ca("Constrained Root", 1, []string{"example.com", "example.org"}, nil)
+	// The intermediate claims a namespace its root does not allow
+	intermediate := ca("Wider Intermediate", 2, []string{"example.org", "example.net"}, root)
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "www.example.org"},
+		NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:     []string{"www.example.org", "www.example.net", "www.example.com"},
+	}, intermediate)
+
+	effective, err := ChainNameConstraints([]*x509.Certificate{leaf, intermediate, root})
+	if err != nil {
+		t.Fatalf("Could not intersect name constraints: %s", err)
+	}
+	if !effective.DNSConstrained || !reflect.DeepEqual(effective.PermittedDNSDomains, []string{"example.org"}) {
+		t.Errorf("Expected only example.org to be permitted, got %v", effective.PermittedDNSDomains)
+	}
+	if effective.IPConstrained || effective.EmailConstrained || effective.DirectoryNameConstrained {
+		t.Errorf("Expected only dNSName constraints, got %+v", effective)
+	}
+
+	expected := []string{
+		"dNSName www.example.net is outside the chain's name constraints",
+		"dNSName www.example.com is outside the chain's name constraints",
+	}
+	if violations := effective.Violations(leaf); !reflect.DeepEqual(violations, expected) {
+		t.Errorf("Expected %q, got %q", expected, violations)
+	}
+
+	// Disjoint constraints permit nothing
+	disjoint := ca("Disjoint Intermediate", 4, []string{"example.net"}, root)
+	effective, _ = ChainNameConstraints([]*x509.Certificate{leaf, disjoint, root})
+	if !effective.DNSConstrained || len(effective.PermittedDNSDomains) != 0 || len(effective.Violations(leaf)) != 3 {
+		t.Errorf("Expected no dNSName to be permitted, got %v", effective.PermittedDNSDomains)
+	}
+}
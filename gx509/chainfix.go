@@ -0,0 +1,129 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// FixChain repairs a chain file's certificates for serving at time at. The
+// result starts with the leaf and follows each certificate with its issuer.
+// Duplicates and certificates that are not part of the leaf's path are
+// dropped, as are expired certificates at the top of the chain, which are
+// typically cross-signs of a root that has since expired. Where two
+// certificates could issue the same link, a currently valid one is preferred.
+// The returned notes describe each change that was made.
+func FixChain(certs []*x509.Certificate, at time.Time) ([]*x509.Certificate, []string) {
+	var notes []string
+
+	var unique []*x509.Certificate
+	for _, cert := range certs {
+		if containsCertificate(unique, cert) {
+			notes = append(notes, fmt.Sprintf("removed duplicate %s", describeCertificate(cert)))
+			continue
+		}
+		unique = append(unique, cert)
+	}
+	if len(unique) == 0 {
+		return nil, notes
+	}
+
+	leaf := findLeaf(unique)
+	chain := []*x509.Certificate{leaf}
+	for len(chain) < maxChainLength {
+		current := chain[len(chain)-1]
+		var candidates []*x509.Certificate
+		for _, issuer := range FindIssuers(current, unique) {
+			if !containsCertificate(chain, issuer) {
+				candidates = append(candidates, issuer)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		next := candidates[0]
+		for _, candidate := range candidates {
+			if chainValidAt([]*x509.Certificate{candidate}, at) {
+				next = candidate
+				break
+			}
+		}
+		chain = append(chain, next)
+	}
+
+	var expiredTop []*x509.Certificate
+	for len(chain) > 1 {
+		top := chain[len(chain)-1]
+		if chainValidAt([]*x509.Certificate{top}, at) {
+			break
+		}
+		kind := "expired cross-sign"
+		if isSelfSigned(top) {
+			kind = "expired root"
+		}
+		notes = append(notes, fmt.Sprintf("removed %s %s", kind, describeCertificate(top)))
+		expiredTop = append(expiredTop, top)
+		chain = chain[:len(chain)-1]
+	}
+
+	var kept []*x509.Certificate
+	for _, cert := range unique {
+		switch {
+		case containsCertificate(chain, cert):
+			kept = append(kept, cert)
+		case containsCertificate(expiredTop, cert):
+		case !chainValidAt([]*x509.Certificate{cert}, at):
+			notes = append(notes, fmt.Sprintf("removed expired %s", describeCertificate(cert)))
+		default:
+			notes = append(notes, fmt.Sprintf("removed unrelated %s", describeCertificate(cert)))
+		}
+	}
+
+	for i := range kept {
+		if !kept[i].Equal(chain[i]) {
+			notes = append(notes, "reordered certificates so each is followed by its issuer")
+			break
+		}
+	}
+
+	return chain, notes
+}
+
+// findLeaf returns the certificate in certs that did not issue any of the
+// others, preferring end-entity certificates.
+func findLeaf(certs []*x509.Certificate) *x509.Certificate {
+	var candidates []*x509.Certificate
+	for _, cert := range certs {
+		issuesOther := false
+		for _, other := range certs {
+			if !other.Equal(cert) && IssuedBy(other, cert) {
+				issuesOther = true
+				break
+			}
+		}
+		if !issuesOther {
+			candidates = append(candidates, cert)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if !candidate.IsCA {
+			return candidate
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return certs[0]
+}
+
+// describeCertificate names cert for humans.
+func describeCertificate(cert *x509.Certificate) string {
+	return fmt.Sprintf("%q (issued by %q, expires %s)", cert.Subject.CommonName,
+		cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+}
@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestFixChainReorderAndDedupe(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	fixed, notes := FixChain([]*x509.Certificate{intermediate, leaf, intermediate, root}, at)
+	checkChainNames(t, fixed, "www.example.com", "Σ Acme Co Issuing CA", "Σ Acme Co Root")
+	if len(notes) != 2 {
+		t.Errorf("Expected a duplicate and a reorder note, got %v", notes)
+	}
+}
+
+func TestFixChainAlreadyCorrect(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	fixed, notes := FixChain(chain, at)
+	checkChainNames(t, fixed, "www.example.com", "Σ Acme Co Issuing CA", "Σ Acme Co Root")
+	if len(notes) != 0 {
+		t.Errorf("Expected no notes, got %v", notes)
+	}
+}
+
+func TestFixChainExpiredCrossSign(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	oldRoot := testCA(t, "Old Root", nil, now.AddDate(0, 0, -1))
+	newRoot := testCA(t, "New Root", nil, now.AddDate(10, 0, 0))
+	crossSign := testCA(t, "New Root", oldRoot, now.AddDate(0, 0, -1))
+	intermediate := testCA(t, "Issuing CA", newRoot, now.AddDate(5, 0, 0))
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "www.example.com",
+		},
+		NotBefore: now.AddDate(0, -1, 0),
+		NotAfter:  now.AddDate(0, 2, 0),
+		DNSNames:  []string{"www.example.com"},
+	}, intermediate)
+	unrelated := testCA(t, "Unrelated", nil, now.AddDate(1, 0, 0))
+
+	fixed, notes := FixChain([]*x509.Certificate{leaf, intermediate, crossSign, unrelated}, now)
+	checkChainNames(t, fixed, "www.example.com", "Issuing CA")
+	if len(notes) != 2 {
+		t.Errorf("Expected a cross-sign and an unrelated note, got %v", notes)
+	}
+}
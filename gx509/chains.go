@@ -0,0 +1,156 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+// Chains longer than this are not considered.
+const maxChainLength = 10
+
+// IssuedBy reports whether parent's subject matches child's issuer and
+// parent's key verifies child's signature.
+func IssuedBy(child, parent *x509.Certificate) bool {
+	if !bytes.Equal(child.RawIssuer, parent.RawSubject) {
+		return false
+	}
+	if len(child.AuthorityKeyId) > 0 && len(parent.SubjectKeyId) > 0 &&
+		!bytes.Equal(child.AuthorityKeyId, parent.SubjectKeyId) {
+		return false
+	}
+	return child.CheckSignatureFrom(parent) == nil
+}
+
+// FindIssuers returns the certificates in candidates that issued cert.
+func FindIssuers(cert *x509.Certificate, candidates []*x509.Certificate) []*x509.Certificate {
+	var issuers []*x509.Certificate
+	for _, candidate := range candidates {
+		if !candidate.Equal(cert) && IssuedBy(cert, candidate) {
+			issuers = append(issuers, candidate)
+		}
+	}
+	return issuers
+}
+
+// BuildChains returns every path from leaf through intermediates to one of
+// roots. Each chain starts with leaf and ends with a root. Certificates are
+// linked by name and signature only; validity periods, name constraints and
+// key usages are not checked.
+func BuildChains(leaf *x509.Certificate, intermediates, roots []*x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	buildChains([]*x509.Certificate{leaf}, intermediates, roots, &chains)
+	return chains
+}
+
+func buildChains(path, intermediates, roots []*x509.Certificate, chains *[][]*x509.Certificate) {
+	current := path[len(path)-1]
+
+	for _, root := range FindIssuers(current, roots) {
+		chain := make([]*x509.Certificate, len(path), len(path)+1)
+		copy(chain, path)
+		*chains = append(*chains, append(chain, root))
+	}
+
+	if len(path) >= maxChainLength {
+		return
+	}
+
+	for _, issuer := range FindIssuers(current, intermediates) {
+		if containsCertificate(path, issuer) {
+			continue
+		}
+		buildChains(append(path[:len(path):len(path)], issuer), intermediates, roots, chains)
+	}
+}
+
+// A ChainVerification is a chain BuildChains found and what was made of it.
+type ChainVerification struct {
+	// Chain starts with the leaf and ends with a root.
+	Chain      []*x509.Certificate
+	Validation PathValidationResult
+	// Constrained are the positions in Chain of the intermediates that are
+	// technically constrained.
+	Constrained []int
+}
+
+// VerifyChains builds every chain from leaf through intermediates to one of
+// roots, runs path validation with input over each, and notes which of its
+// intermediates are technically constrained.
+func VerifyChains(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, input PathValidationInput) []ChainVerification {
+	var verifications []ChainVerification
+	for _, chain := range BuildChains(leaf, intermediates, roots) {
+		verification := ChainVerification{Chain: chain, Validation: ValidatePath(chain, input)}
+		for i := 1; i < len(chain)-1; i++ {
+			if AnalyzeTechnicalConstraints(chain[i]).Constrained {
+				verification.Constrained = append(verification.Constrained, i)
+			}
+		}
+		verifications = append(verifications, verification)
+	}
+	return verifications
+}
+
+// PartialChain follows issuers from leaf through intermediates for as long as
+// there is exactly one way to go, returning the path it found. It is useful
+// for reporting where a chain that fails to reach a root stops.
+func PartialChain(leaf *x509.Certificate, intermediates []*x509.Certificate) []*x509.Certificate {
+	path := []*x509.Certificate{leaf}
+	for len(path) < maxChainLength {
+		var next *x509.Certificate
+		for _, issuer := range FindIssuers(path[len(path)-1], intermediates) {
+			if !containsCertificate(path, issuer) {
+				next = issuer
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		path = append(path, next)
+	}
+	return path
+}
+
+// chainValidAt is true if every certificate in chain is valid at t.
+func chainValidAt(chain []*x509.Certificate, t time.Time) bool {
+	for _, cert := range chain {
+		if t.Before(cert.NotBefore) || t.After(cert.NotAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// BestChain picks the chain to serve from chains: the shortest chain whose
+// certificates are all valid at t, or the shortest chain overall if none are.
+func BestChain(chains [][]*x509.Certificate, t time.Time) []*x509.Certificate {
+	if len(chains) == 0 {
+		return nil
+	}
+
+	ranked := make([][]*x509.Certificate, len(chains))
+	copy(ranked, chains)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		validI, validJ := chainValidAt(ranked[i], t), chainValidAt(ranked[j], t)
+		if validI != validJ {
+			return validI
+		}
+		return len(ranked[i]) < len(ranked[j])
+	})
+	return ranked[0]
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, candidate := range certs {
+		if candidate.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func testCA(t *testing.T, name string, parent *x509.Certificate, notAfter time.Time) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore: time.Date(2009, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  notAfter,
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		return serialiseAndParse(t, template)
+	}
+	return issueAndParse(t, template, parent)
+}
+
+func checkChainNames(t *testing.T, chain []*x509.Certificate, names ...string) {
+	if len(chain) != len(names) {
+		t.Errorf("Expected a chain of %d, got %d", len(names), len(chain))
+		return
+	}
+	for i, cert := range chain {
+		if cert.Subject.CommonName != names[i] {
+			t.Errorf("Chain position %d: expected %s, got %s", i, names[i], cert.Subject.CommonName)
+		}
+	}
+}
+
+func TestBuildChains(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+	unrelated := testCA(t, "Unrelated CA", root, root.NotAfter)
+
+	chains := BuildChains(leaf, []*x509.Certificate{unrelated, intermediate}, []*x509.Certificate{root})
+	if len(chains) != 1 {
+		t.Fatalf("Expected 1 chain, got %d", len(chains))
+	}
+	checkChainNames(t, chains[0], "www.example.com", "Σ Acme Co Issuing CA", "Σ Acme Co Root")
+}
+
+func TestBuildChainsMissingIntermediate(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	leaf, root := chain[0], chain[2]
+
+	if chains := BuildChains(leaf, nil, []*x509.Certificate{root}); len(chains) != 0 {
+		t.Errorf("Expected no chains, got %d", len(chains))
+	}
+
+	partial := PartialChain(leaf, nil)
+	checkChainNames(t, partial, "www.example.com")
+}
+
+func TestBuildChainsCrossSigned(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	oldRoot := testCA(t, "Old Root", nil, now.AddDate(0, 0, -1))
+	newRoot := testCA(t, "New Root", nil, now.AddDate(10, 0, 0))
+	// The new root, cross-signed by the old one
+	crossSign := testCA(t, "New Root", oldRoot, now.AddDate(0, 0, -1))
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "www.example.com",
+		},
+		NotBefore: now.AddDate(0, -1, 0),
+		NotAfter:  now.AddDate(0, 2, 0),
+		DNSNames:  []string{"www.example.com"},
+	}, newRoot)
+
+	chains := BuildChains(leaf, []*x509.Certificate{crossSign}, []*x509.Certificate{oldRoot, newRoot})
+	if len(chains) != 2 {
+		t.Fatalf("Expected 2 chains, got %d", len(chains))
+	}
+
+	best := BestChain(chains, now)
+	checkChainNames(t, best, "www.example.com", "New Root")
+}
+
+func TestVerifyChains(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+	constrained := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      intermediate.Subject,
+		NotBefore:    intermediate.NotBefore,
+		NotAfter:     intermediate.NotAfter,
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"example.com"},
+		ExcludedIPAddresses: []net.IPNet{
+			{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}},
+	}, root)
+	input := PathValidationInput{Time: time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)}
+
+	// The leaf chains through both the intermediate and its constrained
+	// reissue, which share a name and key
+	verifications := VerifyChains(leaf, []*x509.Certificate{intermediate, constrained}, []*x509.Certificate{root}, input)
+	if len(verifications) != 2 {
+		t.Fatalf("Expected 2 chains, got %d", len(verifications))
+	}
+	for i, verification := range verifications {
+		if !verification.Validation.Valid {
+			t.Errorf("Expected chain %d to validate: %v", i, verification.Validation.Errors)
+		}
+	}
+	if len(verifications[0].Constrained) != 0 {
+		t.Errorf("Expected the intermediate not to be constrained, got %v", verifications[0].Constrained)
+	}
+	if len(verifications[1].Constrained) != 1 || verifications[1].Constrained[0] != 1 {
+		t.Errorf("Expected the reissued intermediate to be constrained, got %v", verifications[1].Constrained)
+	}
+
+	input.Time = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if verifications := VerifyChains(leaf, []*x509.Certificate{intermediate}, []*x509.Certificate{root}, input); verifications[0].Validation.Valid {
+		t.Errorf("Expected the chain not to validate after it expired")
+	}
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// A ValidityLimit caps the lifetime of leaf certificates issued on or after
+// Since.
+type ValidityLimit struct {
+	Since   time.Time
+	MaxDays int
+}
+
+// ClientBehavior describes how a certificate verifier treats the parts of a
+// chain that matter for technically constrained intermediates. These are
+// approximations of each implementation's current behavior, not a
+// reimplementation of it.
+type ClientBehavior struct {
+	Name string
+
+	// CommonNameFallback is true if the client matches hostnames against the
+	// subject commonName when the leaf has no dNSName subjectAltNames.
+	CommonNameFallback bool
+	// ConstrainsCommonName is true if dNSName constraints are also applied to
+	// a hostname-like subject commonName.
+	ConstrainsCommonName bool
+	// LeadingDotSubdomainsOnly is true if a dNSName constraint of
+	// ".example.com" matches subdomains of example.com, but not example.com.
+	LeadingDotSubdomainsOnly bool
+	// RejectsLeadingDotConstraint is true if the client refuses to parse a
+	// dNSName constraint that begins with a dot.
+	RejectsLeadingDotConstraint bool
+	// EnforcesIPConstraints is true if iPAddress subtrees are applied to
+	// iPAddress subjectAltNames.
+	EnforcesIPConstraints bool
+	// EnforcesEKUChaining is true if an intermediate's extendedKeyUsage
+	// restricts the usages of the certificates below it.
+	EnforcesEKUChaining bool
+	// StepUpAsServerAuth is true if id-Netscape-stepUp in an intermediate
+	// issued before the Mozilla cutoff is treated as id-kp-serverAuth.
+	StepUpAsServerAuth bool
+	// RequiresLeafServerAuthEKU is true if a TLS server leaf without an
+	// extendedKeyUsage extension is rejected.
+	RequiresLeafServerAuthEKU bool
+	// MaxLeafValidity lists the leaf lifetime caps enforced by the client.
+	MaxLeafValidity []ValidityLimit
+	// RejectedSignatureAlgorithms are not accepted on any certificate other
+	// than the trust anchor.
+	RejectedSignatureAlgorithms []x509.SignatureAlgorithm
+	// MinRSAKeyBits is the smallest RSA modulus accepted anywhere in the
+	// chain, or zero for no limit.
+	MinRSAKeyBits int
+	// BuildsAlternatePaths is true if the client will look for another path
+	// to a trusted root when the chain as served leads to an expired or
+	// untrusted certificate.
+	BuildsAlternatePaths bool
+}
+
+// maxLeafValidityAt returns the lifetime cap in days that applies to a leaf
+// issued at notBefore, and false if there is none.
+func (c ClientBehavior) maxLeafValidityAt(notBefore time.Time) (int, bool) {
+	var limit *ValidityLimit
+	for i := range c.MaxLeafValidity {
+		candidate := &c.MaxLeafValidity[i]
+		if notBefore.Before(candidate.Since) {
+			continue
+		}
+		if limit == nil || candidate.Since.After(limit.Since) {
+			limit = candidate
+		}
+	}
+	if limit == nil {
+		return 0, false
+	}
+	return limit.MaxDays, true
+}
@@ -0,0 +1,114 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// A CloudCA is a cloud provider's managed certificate authority service,
+// such as AWS Private CA, Google Certificate Authority Service or Azure Key
+// Vault.
+type CloudCA interface {
+	// Provider names the service, as in "aws-pca".
+	Provider() string
+	// CertificateAuthorities returns the CAs the service holds.
+	CertificateAuthorities() ([]CloudCertificateAuthority, error)
+	// IssuedCertificates returns the certificates issued since the given
+	// time that the service has a record of.
+	IssuedCertificates(since time.Time) ([]CloudCertificate, error)
+}
+
+// A CloudCertificateAuthority is a CA managed by a CloudCA.
+type CloudCertificateAuthority struct {
+	// ID is the provider's name for the CA, such as its ARN.
+	ID string
+	// Root is whether the CA is self-signed.
+	Root bool
+	// Status is the provider's state for the CA, such as ACTIVE.
+	Status string
+	// Risks are the ways the CA's configuration could let it issue
+	// unexpected certificates.
+	Risks []string
+	// Cert is nil until the CA's certificate has been installed.
+	Cert  *x509.Certificate
+	Chain []*x509.Certificate
+}
+
+// A CloudCertificate is a certificate a CloudCA issued.
+type CloudCertificate struct {
+	ID string
+	// Issuer is the ID of the issuing CloudCertificateAuthority.
+	Issuer   string
+	IssuedAt time.Time
+	// Template is the template or policy the certificate was issued through,
+	// if the provider has them, and Risks are what it could put in the
+	// certificate unexpectedly.
+	Template string
+	Risks    []string
+	Cert     *x509.Certificate
+}
+
+// A CloudCAReport is the result of AuditCloudCA.
+type CloudCAReport struct {
+	Provider     string
+	Authorities  []CloudCertificateAuthority
+	Certificates []CloudCertificate
+	// Constraints is the analysis of every CA certificate that is not a root,
+	// whether an authority or issued, by ID.
+	Constraints map[string]ConstraintAnalysis
+	// Lints holds the lint findings of the issued certificates, with their
+	// IDs as paths.
+	Lints Report
+}
+
+// Unconstrained returns the IDs of the CAs that are not technically
+// constrained, in the order they were examined.
+func (r *CloudCAReport) Unconstrained() []string {
+	var ids []string
+	for _, ca := range r.Authorities {
+		if a, ok := r.Constraints[ca.ID]; ok && !a.Constrained {
+			ids = append(ids, ca.ID)
+		}
+	}
+	for _, cert := range r.Certificates {
+		if a, ok := r.Constraints[cert.ID]; ok && !a.Constrained {
+			ids = append(ids, cert.ID)
+		}
+	}
+	return ids
+}
+
+// AuditCloudCA analyses the constraints of the CAs ca holds and those it has
+// issued since the given time, and lints what it has issued as of now.
+func AuditCloudCA(ca CloudCA, since, now time.Time) (*CloudCAReport, error) {
+	report := &CloudCAReport{
+		Provider:    ca.Provider(),
+		Constraints: make(map[string]ConstraintAnalysis),
+		Lints:       Report{Generated: now},
+	}
+
+	var err error
+	if report.Authorities, err = ca.CertificateAuthorities(); err != nil {
+		return nil, err
+	}
+	for _, authority := range report.Authorities {
+		if authority.Cert != nil && !authority.Root {
+			report.Constraints[authority.ID] = AnalyzeTechnicalConstraints(authority.Cert)
+		}
+	}
+
+	if report.Certificates, err = ca.IssuedCertificates(since); err != nil {
+		return nil, err
+	}
+	for _, cert := range report.Certificates {
+		report.Lints.LintCertificate(cert.ID, cert.Cert, now)
+		if cert.Cert.IsCA {
+			report.Constraints[cert.ID] = AnalyzeTechnicalConstraints(cert.Cert)
+		}
+	}
+	return report, nil
+}
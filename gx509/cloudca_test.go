@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeCloudCA struct {
+	cas   []CloudCertificateAuthority
+	certs []CloudCertificate
+}
+
+func (f fakeCloudCA) Provider() string {
+	return "fake"
+}
+
+func (f fakeCloudCA) CertificateAuthorities() ([]CloudCertificateAuthority, error) {
+	return f.cas, nil
+}
+
+func (f fakeCloudCA) IssuedCertificates(since time.Time) ([]CloudCertificate, error) {
+	return f.certs, nil
+}
+
+func TestAuditCloudCA(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	ca := fakeCloudCA{
+		cas: []CloudCertificateAuthority{
+			{ID: "root", Root: true, Cert: chain[2]},
+			{ID: "issuing", Cert: chain[1]},
+			{ID: "pending"},
+		},
+		certs: []CloudCertificate{
+			{ID: "leaf", Issuer: "issuing", Cert: chain[0]},
+			// An issued subordinate that is not constrained at all
+			{ID: "sub", Issuer: "root", Cert: chain[2]},
+		},
+	}
+	now := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	report, err := AuditCloudCA(ca, now.Add(-30*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("Could not audit: %s", err)
+	}
+
+	if report.Provider != "fake" || len(report.Authorities) != 3 || len(report.Certificates) != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if _, ok := report.Constraints["root"]; ok {
+		t.Errorf("Roots should not be analysed")
+	}
+	if a := report.Constraints["issuing"]; len(a.Reasons) == 0 {
+		t.Errorf("Expected the issuing CA analysed")
+	}
+	if unconstrained := report.Unconstrained(); !reflect.DeepEqual(unconstrained, []string{"issuing", "sub"}) {
+		t.Errorf("Expected issuing and sub unconstrained, got %v", unconstrained)
+	}
+	if len(report.Lints.Findings) == 0 {
+		t.Errorf("Expected the issued certificates linted")
+	}
+	for _, finding := range report.Lints.Findings {
+		if finding.Path != "leaf" && finding.Path != "sub" {
+			t.Errorf("Unexpected finding path %s", finding.Path)
+		}
+	}
+}
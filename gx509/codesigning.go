@@ -0,0 +1,172 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	oidNestedSignature  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
+	oidCounterSignature = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidRFC3161Timestamp = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+	oidTimestampToken   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	signatureDigests    = map[string]string{
+		"1.2.840.113549.2.5":     "MD5",
+		"1.3.14.3.2.26":          "SHA-1",
+		"2.16.840.1.101.3.4.2.1": "SHA-256",
+		"2.16.840.1.101.3.4.2.2": "SHA-384",
+		"2.16.840.1.101.3.4.2.3": "SHA-512",
+	}
+)
+
+// Formats of CodeSignatures.
+const (
+	CodeSignatureAuthenticode = "Authenticode"
+	CodeSignatureAPKv1        = "APK v1 (JAR)"
+	CodeSignatureAPKv2        = "APK v2"
+	CodeSignatureAPKv3        = "APK v3"
+	CodeSignatureMachO        = "Mach-O"
+)
+
+// A CodeSignature is one signature on an executable or package. Signatures
+// are extracted, not verified.
+type CodeSignature struct {
+	Format string
+	// Signer is nil if the signature does not include the signer's
+	// certificate.
+	Signer *x509.Certificate
+	// Chain runs from Signer through the certificates the signature
+	// carries, as far as they go.
+	Chain []*x509.Certificate
+	// Certificates are all of those the signature carries.
+	Certificates    []*x509.Certificate
+	DigestAlgorithm string
+	// Timestamped is set if the signature has a countersignature from a
+	// timestamping authority, which keeps it valid after the signer
+	// expires.
+	Timestamped bool
+}
+
+// parseCMSSignatures reads the signatures in a PKCS#7 SignedData, including
+// nested Authenticode signatures.
+func parseCMSSignatures(der []byte, format string, depth int) ([]CodeSignature, error) {
+	if depth > 4 {
+		return nil, fmt.Errorf("Signatures are nested too deeply")
+	}
+	data, certs, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []CodeSignature
+	var nested [][]byte
+	for _, signer := range data.SignerInfos {
+		signature := CodeSignature{
+			Format:          format,
+			Signer:          signerCertificate(signer, certs),
+			Certificates:    certs,
+			DigestAlgorithm: signer.DigestAlgorithm.Algorithm.String(),
+		}
+		if name, ok := signatureDigests[signature.DigestAlgorithm]; ok {
+			signature.DigestAlgorithm = name
+		}
+		if signature.Signer != nil {
+			signature.Chain = PartialChain(signature.Signer, certs)
+		}
+
+		for _, attribute := range signer.UnauthenticatedAttributes {
+			switch {
+			case attribute.Type.Equal(oidCounterSignature), attribute.Type.Equal(oidRFC3161Timestamp),
+				attribute.Type.Equal(oidTimestampToken):
+				signature.Timestamped = true
+			case attribute.Type.Equal(oidNestedSignature):
+				for _, value := range attribute.Values {
+					nested = append(nested, value.FullBytes)
+				}
+			}
+		}
+		signatures = append(signatures, signature)
+	}
+
+	for _, inner := range nested {
+		found, err := parseCMSSignatures(inner, format, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("Nested signature: %s", err)
+		}
+		signatures = append(signatures, found...)
+	}
+	return signatures, nil
+}
+
+// The Code Signing Baseline Requirements have required 3072-bit RSA keys
+// for certificates issued since 1 June 2021.
+var codeSigningRSA3072Cutoff = policyDates.cutoffs["codeSigningRSA3072"]
+
+// allowsExtKeyUsage reports whether cert's extended key usages, if it has
+// any, include usage.
+func allowsExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return true
+	}
+	for _, candidate := range cert.ExtKeyUsage {
+		if candidate == usage || candidate == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeCodeSigning lists, at the given time, the problems with the chain
+// and algorithms of a code signature. Android ignores the usages, validity
+// and issuers of APK signing certificates, which are normally self-signed, so
+// only their keys and digests are checked.
+func AnalyzeCodeSigning(signature CodeSignature, at time.Time) []string {
+	if signature.Signer == nil {
+		return []string{"Signer certificate is not included"}
+	}
+	signer := signature.Signer
+	apk := strings.HasPrefix(signature.Format, "APK")
+
+	var problems []string
+	if !apk {
+		if len(signer.ExtKeyUsage) == 0 || !allowsExtKeyUsage(signer, x509.ExtKeyUsageCodeSigning) {
+			problems = append(problems, "Signer lacks the codeSigning extended key usage")
+		}
+		switch {
+		case at.Before(signer.NotBefore):
+			problems = append(problems, "Signer is not yet valid")
+		case at.After(signer.NotAfter) && !signature.Timestamped:
+			problems = append(problems, "Signer expired "+signer.NotAfter.Format("2006-01-02")+" and the signature has no timestamp")
+		}
+	}
+
+	if description, weak := DescribeKey(signer.PublicKey); weak {
+		problems = append(problems, "Weak key: "+description)
+	} else if key, ok := signer.PublicKey.(*rsa.PublicKey); ok && !apk && key.N.BitLen() < 3072 && !signer.NotBefore.Before(codeSigningRSA3072Cutoff) {
+		problems = append(problems, fmt.Sprintf("RSA %d key; code signing certificates issued since June 2021 need 3072 bits", key.N.BitLen()))
+	}
+	if signature.DigestAlgorithm == "MD5" || signature.DigestAlgorithm == "SHA-1" {
+		problems = append(problems, "Signed with "+signature.DigestAlgorithm+" digests")
+	}
+
+	if apk {
+		return problems
+	}
+	for _, ca := range signature.Chain[1:] {
+		if !allowsExtKeyUsage(ca, x509.ExtKeyUsageCodeSigning) {
+			problems = append(problems, ca.Subject.CommonName+" does not permit code signing")
+		}
+		if at.After(ca.NotAfter) && !signature.Timestamped {
+			problems = append(problems, ca.Subject.CommonName+" expired "+ca.NotAfter.Format("2006-01-02"))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"strings"
+	"time"
+)
+
+// A Policy is a set of rules deciding whether a CA certificate is
+// technically constrained. The presets' dates come from policydates.yaml.
+type Policy struct {
+	Name string
+	// Effective is when the policy came into force.
+	Effective time.Time
+
+	// StepUpIsServerAuth is whether id-Netscape-stepUp lets a CA issue for
+	// TLS servers, as serverAuth does. If StepUpCutoff is set, it only does
+	// for certificates issued before then.
+	StepUpIsServerAuth bool
+	StepUpCutoff       time.Time
+
+	// RequireIPConstraints is whether CAs that can issue for TLS servers need
+	// iPAddress constraints as well as dNSName ones.
+	RequireIPConstraints bool
+
+	// RequireEmailConstraints is whether CAs with emailProtection need
+	// permitted rfc822Name subtrees; otherwise they are constrained like any
+	// other CA that cannot issue for TLS servers.
+	RequireEmailConstraints bool
+	// RequireDirectoryNameConstraints is whether they also need permitted
+	// directoryName subtrees.
+	RequireDirectoryNameConstraints bool
+}
+
+// stepUpIsServerAuth is whether the policy treats id-Netscape-stepUp as
+// serverAuth in a certificate issued at notBefore.
+func (p Policy) stepUpIsServerAuth(notBefore time.Time) bool {
+	return p.StepUpIsServerAuth && (p.StepUpCutoff.IsZero() || notBefore.Before(p.StepUpCutoff))
+}
+
+var (
+	// MozillaPolicy22 treats id-Netscape-stepUp as serverAuth and needs
+	// only dNSName constraints.
+	MozillaPolicy22 = Policy{
+		Name:               "mozilla-2.2",
+		Effective:          policyDates.effective["mozilla-2.2"],
+		StepUpIsServerAuth: true,
+	}
+	// MozillaPolicy25 stops treating id-Netscape-stepUp as serverAuth for
+	// certificates issued after nsSGCCutoff, needs iPAddress constraints, and
+	// constrains S/MIME CAs by rfc822Name.
+	MozillaPolicy25 = Policy{
+		Name:                    "mozilla-2.5",
+		Effective:               policyDates.effective["mozilla-2.5"],
+		StepUpIsServerAuth:      true,
+		StepUpCutoff:            nsSGCCutoff,
+		RequireIPConstraints:    true,
+		RequireEmailConstraints: true,
+	}
+	// MozillaPolicy27 also needs directoryName constraints on S/MIME CAs.
+	MozillaPolicy27 = Policy{
+		Name:                            "mozilla-2.7",
+		Effective:                       policyDates.effective["mozilla-2.7"],
+		StepUpIsServerAuth:              true,
+		StepUpCutoff:                    nsSGCCutoff,
+		RequireIPConstraints:            true,
+		RequireEmailConstraints:         true,
+		RequireDirectoryNameConstraints: true,
+	}
+	// CABRBaseline is the CA/Browser Forum Baseline Requirements, which only
+	// cover TLS: id-Netscape-stepUp is not serverAuth and email is not
+	// considered.
+	CABRBaseline = Policy{
+		Name:                 "cabr-baseline",
+		Effective:            policyDates.effective["cabr-baseline"],
+		RequireIPConstraints: true,
+	}
+)
+
+// DefaultPolicy is the policy AnalyzeTechnicalConstraints applies.
+var DefaultPolicy = MozillaPolicy27
+
+// MozillaPolicies are the Mozilla Root Store Policy presets, oldest first.
+var MozillaPolicies = []Policy{MozillaPolicy22, MozillaPolicy25, MozillaPolicy27}
+
+// MozillaPolicyAt returns the Mozilla policy in force at t, such as a
+// certificate's NotBefore, or the oldest one for earlier times.
+func MozillaPolicyAt(t time.Time) Policy {
+	policy := MozillaPolicies[0]
+	for _, candidate := range MozillaPolicies {
+		if !t.Before(candidate.Effective) {
+			policy = candidate
+		}
+	}
+	return policy
+}
+
+// LookupPolicy returns the preset with the given name, such as
+// "mozilla-2.7", for which "v2.7" is short.
+func LookupPolicy(name string) (Policy, bool) {
+	if strings.HasPrefix(name, "v") {
+		name = "mozilla-" + strings.TrimPrefix(name, "v")
+	}
+	for _, policy := range MozillaPolicies {
+		if policy.Name == name {
+			return policy, true
+		}
+	}
+	if name == CABRBaseline.Name {
+		return CABRBaseline, true
+	}
+	return Policy{}, false
+}
@@ -0,0 +1,123 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// A ConstraintResult is the analysis of one certificate flattened for JSON, as
+// gx509 -json writes it and the WebAssembly build returns it.
+type ConstraintResult struct {
+	// Certificate is the certificate analyzed.
+	Certificate *x509.Certificate `json:"-"`
+
+	Name                string    `json:"name"`
+	Fingerprint         string    `json:"fingerprint"`
+	Subject             string    `json:"subject"`
+	SubjectCN           string    `json:"subject_cn"`
+	Issuer              string    `json:"issuer"`
+	IssuerCN            string    `json:"issuer_cn"`
+	SerialNumber        string    `json:"serial_number"`
+	NotBefore           time.Time `json:"not_before"`
+	NotAfter            time.Time `json:"not_after"`
+	IsCA                bool      `json:"is_ca"`
+	ExtKeyUsage         []string  `json:"ext_key_usage"`
+	CertificatePolicies []string  `json:"certificate_policies"`
+
+	PermittedDNSDomains  []string `json:"permitted_dns_domains"`
+	ExcludedDNSDomains   []string `json:"excluded_dns_domains"`
+	PermittedIPAddresses []string `json:"permitted_ip_addresses"`
+	ExcludedIPAddresses  []string `json:"excluded_ip_addresses"`
+
+	Policy        string   `json:"policy"`
+	PolicyVersion string   `json:"policy_version"`
+	Constrained   bool     `json:"constrained"`
+	Reasons       []string `json:"reasons"`
+	Details       string   `json:"details"`
+
+	HasExtKeyUsage             bool `json:"has_ext_key_usage"`
+	HasAnyExtKeyUsage          bool `json:"has_any_ext_key_usage"`
+	HasServerAuth              bool `json:"has_server_auth"`
+	HasStepUp                  bool `json:"has_step_up"`
+	HasEmailProtection         bool `json:"has_email_protection"`
+	HasDNSNameConstraint       bool `json:"has_dns_name_constraint"`
+	HasPermittedIPAddresses    bool `json:"has_permitted_ip_addresses"`
+	ExcludesAllIPv4            bool `json:"excludes_all_ipv4"`
+	ExcludesAllIPv6            bool `json:"excludes_all_ipv6"`
+	HasEmailConstraint         bool `json:"has_email_constraint"`
+	HasDirectoryNameConstraint bool `json:"has_directory_name_constraint"`
+
+	// Deviations are where the certificate's encoding departs from RFC 5280,
+	// as EncodingDeviations finds them.
+	Deviations []string `json:"deviations,omitempty"`
+
+	// OneCRL is set by callers that checked the certificate against OneCRL.
+	OneCRL *OneCRLResult `json:"onecrl,omitempty"`
+}
+
+// NewConstraintResult flattens a, the analysis of cert, which was read from
+// the file name.
+func NewConstraintResult(name string, cert *x509.Certificate, a ConstraintAnalysis) ConstraintResult {
+	result := ConstraintResult{
+		Certificate:  cert,
+		Name:         name,
+		Fingerprint:  fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+		Subject:      cert.Subject.String(),
+		SubjectCN:    cert.Subject.CommonName,
+		Issuer:       cert.Issuer.String(),
+		IssuerCN:     cert.Issuer.CommonName,
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		IsCA:         cert.IsCA,
+		Deviations:   EncodingDeviations(cert),
+
+		// Lists are empty rather than null, for the sake of jq
+		ExtKeyUsage:          []string{},
+		CertificatePolicies:  []string{},
+		PermittedDNSDomains:  append([]string{}, cert.PermittedDNSDomains...),
+		ExcludedDNSDomains:   append([]string{}, cert.ExcludedDNSDomains...),
+		PermittedIPAddresses: []string{},
+		ExcludedIPAddresses:  []string{},
+		Reasons:              []string{},
+
+		Policy:        a.Policy.Name,
+		PolicyVersion: a.PolicyVersion.String(),
+		Constrained:   a.Constrained,
+		Details:       a.Details(),
+
+		HasExtKeyUsage:             a.HasExtKeyUsage,
+		HasAnyExtKeyUsage:          a.HasAnyExtKeyUsage,
+		HasServerAuth:              a.HasServerAuth,
+		HasStepUp:                  a.HasStepUp,
+		HasEmailProtection:         a.HasEmailProtection,
+		HasDNSNameConstraint:       a.HasDNSNameConstraint,
+		HasPermittedIPAddresses:    a.HasPermittedIPAddresses,
+		ExcludesAllIPv4:            a.ExcludesAllIPv4,
+		ExcludesAllIPv6:            a.ExcludesAllIPv6,
+		HasEmailConstraint:         a.HasEmailConstraint,
+		HasDirectoryNameConstraint: a.HasDirectoryNameConstraint,
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		result.ExtKeyUsage = append(result.ExtKeyUsage, ExtKeyUsageName(usage))
+	}
+	for _, policy := range cert.PolicyIdentifiers {
+		result.CertificatePolicies = append(result.CertificatePolicies, policy.String())
+	}
+	for _, cidr := range cert.PermittedIPAddresses {
+		result.PermittedIPAddresses = append(result.PermittedIPAddresses, cidr.String())
+	}
+	for _, cidr := range cert.ExcludedIPAddresses {
+		result.ExcludedIPAddresses = append(result.ExcludedIPAddresses, cidr.String())
+	}
+	for _, reason := range a.Reasons {
+		result.Reasons = append(result.Reasons, reason.String())
+	}
+	return result
+}
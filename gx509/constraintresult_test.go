@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewConstraintResult(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	result := NewConstraintResult("chain.pem", chain[1], AnalyzeTechnicalConstraints(chain[1]))
+	if !result.IsCA || result.SubjectCN != chain[1].Subject.CommonName || result.Policy != DefaultPolicy.Name {
+		t.Errorf("Expected the intermediate's analysis under the default policy, got %+v", result)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Could not encode result: %s", err)
+	}
+	if strings.Contains(string(encoded), "null") {
+		t.Errorf("Expected empty lists rather than null, got %s", encoded)
+	}
+}
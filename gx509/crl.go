@@ -0,0 +1,510 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// maxCRLSize is the most a CRL download may be. The largest public CRLs are
+// a few hundred megabytes, which ScanCRL reads from disk a piece at a time.
+const maxCRLSize = 1 << 30
+
+// maxCRLElement is the most any part of a CRL but its list of entries may be.
+const maxCRLElement = 1 << 20
+
+// A RevocationReason is the CRLReason of a CRL entry, as RFC 5280 section
+// 5.3.1 defines it.
+type RevocationReason int
+
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonRemoveFromCRL        RevocationReason = 8
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+	ReasonAACompromise         RevocationReason = 10
+)
+
+var revocationReasonNames = map[RevocationReason]string{
+	ReasonUnspecified:          "unspecified",
+	ReasonKeyCompromise:        "keyCompromise",
+	ReasonCACompromise:         "cACompromise",
+	ReasonAffiliationChanged:   "affiliationChanged",
+	ReasonSuperseded:           "superseded",
+	ReasonCessationOfOperation: "cessationOfOperation",
+	ReasonCertificateHold:      "certificateHold",
+	ReasonRemoveFromCRL:        "removeFromCRL",
+	ReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	ReasonAACompromise:         "aACompromise",
+}
+
+func (r RevocationReason) String() string {
+	if name, ok := revocationReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason %d", int(r))
+}
+
+// A Revocation is an entry of a CRL.
+type Revocation struct {
+	SerialNumber *big.Int
+	RevokedAt    time.Time
+	// Reason is the entry's reasonCode, and HasReason whether it had one;
+	// an entry without one is revoked for an unspecified reason.
+	Reason    RevocationReason
+	HasReason bool
+}
+
+// NewRevocation decodes the CRL entry entry.
+func NewRevocation(entry pkix.RevokedCertificate) (Revocation, error) {
+	revocation := Revocation{SerialNumber: entry.SerialNumber, RevokedAt: entry.RevocationTime}
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidExtensionReasonCode) {
+			continue
+		}
+		var reason asn1.Enumerated
+		if err := unmarshalAll(ext.Value, &reason); err != nil {
+			return revocation, fmt.Errorf("Could not parse reason code of serial %x: %s", entry.SerialNumber, err)
+		}
+		revocation.Reason, revocation.HasReason = RevocationReason(reason), true
+	}
+	return revocation, nil
+}
+
+// LookupRevocation returns the entry for serial in crl, or nil if serial is
+// not revoked.
+func LookupRevocation(crl *pkix.CertificateList, serial *big.Int) (*Revocation, error) {
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			revocation, err := NewRevocation(entry)
+			if err != nil {
+				return nil, err
+			}
+			return &revocation, nil
+		}
+	}
+	return nil, nil
+}
+
+// A CRLHeader is everything in a CRL but its entries.
+type CRLHeader struct {
+	RawIssuer  []byte
+	Issuer     pkix.Name
+	ThisUpdate time.Time
+	// NextUpdate is zero if the CRL has none.
+	NextUpdate time.Time
+	Extensions []pkix.Extension
+	// Entries is how many certificates the CRL revokes.
+	Entries int
+	// Verified is whether the signature was checked against an issuer.
+	Verified bool
+}
+
+// derStream reads DER elements from a stream a header at a time, so a CRL
+// need not fit in memory. While hash is set, every byte read is written to
+// it.
+type derStream struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	read int64
+}
+
+func (d *derStream) full(b []byte) error {
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	d.read += int64(len(b))
+	if d.hash != nil {
+		d.hash.Write(b)
+	}
+	return nil
+}
+
+// header reads the tag and length of an element, returning them and the
+// header's bytes.
+func (d *derStream) header() (byte, int64, []byte, error) {
+	raw := make([]byte, 2)
+	if err := d.full(raw); err != nil {
+		return 0, 0, nil, err
+	}
+	if raw[0]&0x1f == 0x1f {
+		return 0, 0, nil, fmt.Errorf("Unsupported high tag number")
+	}
+	if raw[1] < 0x80 {
+		return raw[0], int64(raw[1]), raw, nil
+	}
+	count := int(raw[1] & 0x7f)
+	if count == 0 || count > 8 {
+		return 0, 0, nil, fmt.Errorf("Unsupported length encoding")
+	}
+	lengthBytes := make([]byte, count)
+	if err := d.full(lengthBytes); err != nil {
+		return 0, 0, nil, err
+	}
+	var length int64
+	for _, b := range lengthBytes {
+		length = length<<8 | int64(b)
+	}
+	if length < 0 {
+		return 0, 0, nil, fmt.Errorf("Invalid length")
+	}
+	return raw[0], length, append(raw, lengthBytes...), nil
+}
+
+// body reads the contents of the element whose header is raw, returning the
+// whole element.
+func (d *derStream) body(raw []byte, length int64) ([]byte, error) {
+	if length > maxCRLElement {
+		return nil, fmt.Errorf("Element of %d bytes is too large", length)
+	}
+	element := make([]byte, len(raw)+int(length))
+	copy(element, raw)
+	return element, d.full(element[len(raw):])
+}
+
+// element reads a whole element.
+func (d *derStream) element() (byte, []byte, error) {
+	tag, length, raw, err := d.header()
+	if err != nil {
+		return 0, nil, err
+	}
+	element, err := d.body(raw, length)
+	return tag, element, err
+}
+
+// pemBody yields the characters of a PEM block's body, skipping whitespace
+// and stopping at its end line.
+type pemBody struct {
+	r *bufio.Reader
+}
+
+func (p pemBody) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch c {
+		case '-':
+			return n, io.EOF
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		b[n] = c
+		n++
+	}
+	return n, nil
+}
+
+// crlReader returns a reader of the DER CRL in r, which is DER or PEM.
+func crlReader(r io.Reader) (*bufio.Reader, error) {
+	buffered := bufio.NewReader(r)
+	start, err := buffered.Peek(5)
+	if err != nil || string(start) != "-----" {
+		return buffered, nil
+	}
+	line, err := buffered.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("Could not read PEM header: %s", err)
+	}
+	if !strings.Contains(line, "CRL") {
+		return nil, fmt.Errorf("Unexpected PEM block %s", strings.TrimSpace(line))
+	}
+	return bufio.NewReader(base64.NewDecoder(base64.StdEncoding, pemBody{buffered})), nil
+}
+
+// signatureHash returns the hash algorithm signatures of type algorithm are
+// made over.
+func signatureHash(algorithm x509.SignatureAlgorithm) crypto.Hash {
+	switch algorithm {
+	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
+		return crypto.SHA1
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		return crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		return crypto.SHA384
+	}
+	return crypto.SHA512
+}
+
+// verifyDigest checks that signature, made with algorithm, is key's over
+// the data that hashed to digest.
+func verifyDigest(key crypto.PublicKey, algorithm x509.SignatureAlgorithm, digest, signature []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, signatureHash(algorithm), digest, signature) != nil {
+			return fmt.Errorf("Invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct{ R, S *big.Int }
+		if err := unmarshalAll(signature, &ecdsaSignature); err != nil {
+			return fmt.Errorf("Could not decode signature: %s", err)
+		}
+		if !ecdsa.Verify(key, digest, ecdsaSignature.R, ecdsaSignature.S) {
+			return fmt.Errorf("Invalid signature")
+		}
+	default:
+		return fmt.Errorf("Unsupported issuer key %T", key)
+	}
+	return nil
+}
+
+// ScanCRL reads the DER or PEM CRL in r a piece at a time, calling fn with
+// each entry, so CRLs too large to hold in memory can be searched. If issuer
+// is set, the CRL must be issued and signed by it. An error from fn stops
+// the scan and is returned.
+func ScanCRL(r io.Reader, issuer *x509.Certificate, fn func(Revocation) error) (*CRLHeader, error) {
+	reader, err := crlReader(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &derStream{r: reader}
+	if tag, _, _, err := d.header(); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL: %s", err)
+	} else if tag != 0x30 {
+		return nil, fmt.Errorf("Could not parse CRL: not a SEQUENCE")
+	}
+	tag, tbsLength, tbsHeader, err := d.header()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse CRL: %s", err)
+	} else if tag != 0x30 {
+		return nil, fmt.Errorf("Could not parse TBSCertList: not a SEQUENCE")
+	}
+	tbsEnd := d.read + tbsLength
+
+	// The signature algorithm inside the TBSCertList picks the hash, which
+	// then covers everything read so far and the rest of the TBSCertList.
+	tag, element, err := d.element()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse TBSCertList: %s", err)
+	}
+	signed := append(append([]byte{}, tbsHeader...), element...)
+	if tag == 0x02 {
+		if tag, element, err = d.element(); err != nil {
+			return nil, fmt.Errorf("Could not parse TBSCertList: %s", err)
+		}
+		signed = append(signed, element...)
+	}
+	var innerAlgorithm pkix.AlgorithmIdentifier
+	if err := unmarshalAll(element, &innerAlgorithm); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL signature algorithm: %s", err)
+	}
+	algorithm, supported := ocspSignatureAlgorithms[innerAlgorithm.Algorithm.String()]
+	if issuer != nil {
+		if !supported {
+			return nil, fmt.Errorf("Unsupported CRL signature algorithm %s", innerAlgorithm.Algorithm)
+		}
+		d.hash = signatureHash(algorithm).New()
+		d.hash.Write(signed)
+	}
+
+	header := &CRLHeader{}
+	if _, header.RawIssuer, err = d.element(); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL issuer: %s", err)
+	}
+	var issuerName pkix.RDNSequence
+	if err := unmarshalAll(header.RawIssuer, &issuerName); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL issuer: %s", err)
+	}
+	header.Issuer.FillFromRDNSequence(&issuerName)
+	if issuer != nil && !bytes.Equal(header.RawIssuer, issuer.RawSubject) {
+		return nil, fmt.Errorf("CRL was not issued by %s", issuer.Subject.CommonName)
+	}
+	if _, element, err = d.element(); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL thisUpdate: %s", err)
+	}
+	if err := unmarshalAll(element, &header.ThisUpdate); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL thisUpdate: %s", err)
+	}
+
+	for d.read < tbsEnd {
+		tag, length, raw, err := d.header()
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse TBSCertList: %s", err)
+		}
+		switch tag {
+		case 0x17, 0x18:
+			if element, err = d.body(raw, length); err != nil {
+				return nil, fmt.Errorf("Could not parse CRL nextUpdate: %s", err)
+			}
+			if err := unmarshalAll(element, &header.NextUpdate); err != nil {
+				return nil, fmt.Errorf("Could not parse CRL nextUpdate: %s", err)
+			}
+		case 0x30:
+			for end := d.read + length; d.read < end; {
+				if _, element, err = d.element(); err != nil {
+					return nil, fmt.Errorf("Could not parse CRL entry %d: %s", header.Entries, err)
+				}
+				var entry pkix.RevokedCertificate
+				if err := unmarshalAll(element, &entry); err != nil {
+					return nil, fmt.Errorf("Could not parse CRL entry %d: %s", header.Entries, err)
+				}
+				revocation, err := NewRevocation(entry)
+				if err != nil {
+					return nil, err
+				}
+				header.Entries++
+				if err := fn(revocation); err != nil {
+					return header, err
+				}
+			}
+		case 0xa0:
+			if element, err = d.body(raw, length); err != nil {
+				return nil, fmt.Errorf("Could not parse CRL extensions: %s", err)
+			}
+			if rest, err := asn1.UnmarshalWithParams(element, &header.Extensions, "explicit,tag:0"); err != nil {
+				return nil, fmt.Errorf("Could not parse CRL extensions: %s", err)
+			} else if len(rest) > 0 {
+				return nil, fmt.Errorf("Trailing data after CRL extensions")
+			}
+		default:
+			return nil, fmt.Errorf("Unexpected element with tag %#x in TBSCertList", tag)
+		}
+	}
+	if d.read != tbsEnd {
+		return nil, fmt.Errorf("TBSCertList overruns its length")
+	}
+
+	var digest []byte
+	if d.hash != nil {
+		digest, d.hash = d.hash.Sum(nil), nil
+	}
+	var outerAlgorithm pkix.AlgorithmIdentifier
+	if _, element, err = d.element(); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL signature algorithm: %s", err)
+	}
+	if err := unmarshalAll(element, &outerAlgorithm); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL signature algorithm: %s", err)
+	}
+	if !outerAlgorithm.Algorithm.Equal(innerAlgorithm.Algorithm) {
+		return nil, fmt.Errorf("CRL signature algorithms %s and %s differ", innerAlgorithm.Algorithm, outerAlgorithm.Algorithm)
+	}
+	var signature asn1.BitString
+	if _, element, err = d.element(); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL signature: %s", err)
+	}
+	if err := unmarshalAll(element, &signature); err != nil {
+		return nil, fmt.Errorf("Could not parse CRL signature: %s", err)
+	}
+	if issuer != nil {
+		if err := verifyDigest(issuer.PublicKey, algorithm, digest, signature.RightAlign()); err != nil {
+			return nil, fmt.Errorf("CRL is not signed by %s: %s", issuer.Subject.CommonName, err)
+		}
+		header.Verified = true
+	}
+	return header, nil
+}
+
+// FindRevocation scans the CRL in r, as ScanCRL does, for the entry for
+// serial, returning nil if serial is not revoked.
+func FindRevocation(r io.Reader, issuer *x509.Certificate, serial *big.Int) (*CRLHeader, *Revocation, error) {
+	var found *Revocation
+	header, err := ScanCRL(r, issuer, func(revocation Revocation) error {
+		if revocation.SerialNumber.Cmp(serial) == 0 {
+			found = &revocation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, found, nil
+}
+
+// FetchCRL downloads the CRL at url to a temporary file, returning its path
+// for the caller to scan and remove.
+func FetchCRL(client *http.Client, url string) (string, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("Unsupported CRL URL %s", url)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	file, err := ioutil.TempFile("", "gx509-crl-")
+	if err != nil {
+		return "", fmt.Errorf("Could not create temporary file: %s", err)
+	}
+	written, err := io.Copy(file, io.LimitReader(resp.Body, maxCRLSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > maxCRLSize {
+		err = fmt.Errorf("%s returned more than %d bytes", url, maxCRLSize)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// A CRLStatus is what the CRL at one of a certificate's distribution points
+// says of it.
+type CRLStatus struct {
+	URL    string
+	Header *CRLHeader
+	// Revocation is the certificate's entry, or nil if it is not revoked.
+	Revocation *Revocation
+	// Err is why the CRL could not be checked, or nil if it was.
+	Err error
+}
+
+// CheckCRLs downloads the CRL at each of cert's CRL distribution points,
+// checks issuer signed it, and looks cert up in it.
+func CheckCRLs(client *http.Client, cert, issuer *x509.Certificate) []CRLStatus {
+	var statuses []CRLStatus
+	for _, url := range cert.CRLDistributionPoints {
+		status := CRLStatus{URL: url}
+		path, err := FetchCRL(client, url)
+		if err != nil {
+			status.Err = err
+			statuses = append(statuses, status)
+			continue
+		}
+		file, err := os.Open(path)
+		if err == nil {
+			status.Header, status.Revocation, err = FindRevocation(file, issuer, cert.SerialNumber)
+			file.Close()
+		}
+		os.Remove(path)
+		status.Err = err
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reasonCode(t *testing.T, reason RevocationReason) []pkix.Extension {
+	value, err := asn1.Marshal(asn1.Enumerated(reason))
+	if err != nil {
+		t.Fatalf("Could not marshal reason code: %s", err)
+	}
+	return []pkix.Extension{{Id: oidExtensionReasonCode, Value: value}}
+}
+
+func TestScanCRL(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	revoked := []pkix.RevokedCertificate{
+		{SerialNumber: big.NewInt(7), RevocationTime: at.Add(-2 * time.Hour), Extensions: reasonCode(t, ReasonKeyCompromise)},
+		{SerialNumber: big.NewInt(9), RevocationTime: at.Add(-time.Hour)},
+	}
+	// Enough entries that the list needs a multi-byte length
+	for i := int64(100); i < 200; i++ {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(i), RevocationTime: at.Add(-time.Hour)})
+	}
+	der, err := chain[1].CreateCRL(rand.Reader, testPrivateKey, revoked, at, at.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Could not create CRL: %s", err)
+	}
+
+	for name, encoded := range map[string][]byte{
+		"DER": der,
+		"PEM": pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}),
+	} {
+		header, revocation, err := FindRevocation(bytes.NewReader(encoded), chain[1], big.NewInt(7))
+		if err != nil {
+			t.Fatalf("%s: Could not scan CRL: %s", name, err)
+		}
+		if !header.Verified || header.Entries != len(revoked) || !header.ThisUpdate.Equal(at) || !header.NextUpdate.Equal(at.Add(24*time.Hour)) {
+			t.Errorf("%s: Unexpected header %+v", name, header)
+		}
+		if header.Issuer.CommonName != chain[1].Subject.CommonName {
+			t.Errorf("%s: Expected issuer %s, got %s", name, chain[1].Subject.CommonName, header.Issuer.CommonName)
+		}
+		if revocation == nil || revocation.Reason != ReasonKeyCompromise || !revocation.HasReason || !revocation.RevokedAt.Equal(at.Add(-2*time.Hour)) {
+			t.Errorf("%s: Expected serial 7 revoked for keyCompromise, got %+v", name, revocation)
+		}
+	}
+
+	if _, revocation, err := FindRevocation(bytes.NewReader(der), nil, big.NewInt(9)); err != nil || revocation == nil || revocation.HasReason {
+		t.Errorf("Expected serial 9 revoked without a reason, got %+v (%v)", revocation, err)
+	}
+	if _, revocation, err := FindRevocation(bytes.NewReader(der), nil, big.NewInt(8)); err != nil || revocation != nil {
+		t.Errorf("Expected serial 8 not revoked, got %+v (%v)", revocation, err)
+	}
+
+	tampered := append([]byte{}, der...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, err := FindRevocation(bytes.NewReader(tampered), chain[1], big.NewInt(7)); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("Expected a tampered CRL to fail verification, got %v", err)
+	}
+	if _, _, err := FindRevocation(bytes.NewReader(der), chain[2], big.NewInt(7)); err == nil {
+		t.Errorf("Expected a CRL from another issuer to be rejected")
+	}
+	if _, _, err := FindRevocation(bytes.NewReader(der[:len(der)/2]), nil, big.NewInt(7)); err == nil {
+		t.Errorf("Expected a truncated CRL to be rejected")
+	}
+
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatalf("Could not parse CRL: %s", err)
+	}
+	if revocation, err := LookupRevocation(crl, big.NewInt(7)); err != nil || revocation == nil || revocation.Reason.String() != "keyCompromise" {
+		t.Errorf("Expected LookupRevocation to find serial 7, got %+v (%v)", revocation, err)
+	}
+}
+
+func TestCheckCRLs(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	now := time.Now()
+	revoked := []pkix.RevokedCertificate{{SerialNumber: chain[0].SerialNumber, RevocationTime: now, Extensions: reasonCode(t, ReasonSuperseded)}}
+	der, err := chain[1].CreateCRL(rand.Reader, testPrivateKey, revoked, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Could not create CRL: %s", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/int.crl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(der)
+	}))
+	defer server.Close()
+
+	leaf := *chain[0]
+	leaf.CRLDistributionPoints = []string{server.URL + "/int.crl", server.URL + "/missing.crl", "ldap://crl.example.com/"}
+	statuses := CheckCRLs(server.Client(), &leaf, chain[1])
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 statuses, got %d", len(statuses))
+	}
+	if statuses[0].Err != nil || statuses[0].Revocation == nil || statuses[0].Revocation.Reason != ReasonSuperseded {
+		t.Errorf("Expected the leaf revoked as superseded, got %+v", statuses[0])
+	}
+	if statuses[1].Err == nil || statuses[2].Err == nil {
+		t.Errorf("Expected errors for a missing CRL and an LDAP URL, got %v and %v", statuses[1].Err, statuses[2].Err)
+	}
+}
@@ -0,0 +1,124 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+var oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+
+// The GeneralName tag of a uniformResourceIdentifier.
+const generalNameURI = 6
+
+type distributionPointName struct {
+	FullName     []asn1.RawValue  `asn1:"optional,tag:0"`
+	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
+}
+
+type issuingDistributionPointASN1 struct {
+	DistributionPoint          distributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts      bool                  `asn1:"optional,tag:1"`
+	OnlyContainsCACerts        bool                  `asn1:"optional,tag:2"`
+	OnlySomeReasons            asn1.BitString        `asn1:"optional,tag:3"`
+	IndirectCRL                bool                  `asn1:"optional,tag:4"`
+	OnlyContainsAttributeCerts bool                  `asn1:"optional,tag:5"`
+}
+
+// An IssuingDistributionPoint is the issuingDistributionPoint extension of a
+// CRL, which narrows the certificates the CRL speaks for.
+type IssuingDistributionPoint struct {
+	// HasDistributionPoint is whether the CRL names its distribution point,
+	// and URIs are the URIs in its full name.
+	HasDistributionPoint bool
+	URIs                 []string
+	// The CRL covers only end-entity, CA or attribute certificates if the
+	// matching field is set.
+	OnlyContainsUserCerts      bool
+	OnlyContainsCACerts        bool
+	OnlyContainsAttributeCerts bool
+	// OnlySomeReasons is whether the CRL lists revocations for some reasons
+	// only, and IndirectCRL whether it lists certificates of other issuers.
+	OnlySomeReasons bool
+	IndirectCRL     bool
+}
+
+// ParseIssuingDistributionPoint decodes the issuingDistributionPoint
+// extension of crl, returning nil if it has none.
+func ParseIssuingDistributionPoint(crl *pkix.CertificateList) (*IssuingDistributionPoint, error) {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if !ext.Id.Equal(oidExtensionIssuingDistributionPoint) {
+			continue
+		}
+		var value issuingDistributionPointASN1
+		if rest, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+			return nil, fmt.Errorf("Could not parse issuing distribution point: %s", err)
+		} else if len(rest) > 0 {
+			return nil, fmt.Errorf("Trailing data after issuing distribution point")
+		}
+		idp := &IssuingDistributionPoint{
+			HasDistributionPoint:       len(value.DistributionPoint.FullName) > 0 || len(value.DistributionPoint.RelativeName) > 0,
+			OnlyContainsUserCerts:      value.OnlyContainsUserCerts,
+			OnlyContainsCACerts:        value.OnlyContainsCACerts,
+			OnlyContainsAttributeCerts: value.OnlyContainsAttributeCerts,
+			OnlySomeReasons:            value.OnlySomeReasons.BitLength > 0,
+			IndirectCRL:                value.IndirectCRL,
+		}
+		for _, name := range value.DistributionPoint.FullName {
+			if name.Class == asn1.ClassContextSpecific && name.Tag == generalNameURI {
+				idp.URIs = append(idp.URIs, string(name.Bytes))
+			}
+		}
+		return idp, nil
+	}
+	return nil, nil
+}
+
+// CheckCRLScope returns the reasons crl cannot say whether cert is revoked
+// according to its issuing distribution point, as RFC 5280 section 6.3.3
+// checks, or none if it covers cert. A CRL without the extension covers
+// every certificate of its issuer.
+func CheckCRLScope(crl *pkix.CertificateList, cert *x509.Certificate) ([]string, error) {
+	idp, err := ParseIssuingDistributionPoint(crl)
+	if err != nil || idp == nil {
+		return nil, err
+	}
+
+	var problems []string
+	if idp.OnlyContainsCACerts && !cert.IsCA {
+		problems = append(problems, "the CRL only covers CA certificates")
+	}
+	if idp.OnlyContainsUserCerts && cert.IsCA {
+		problems = append(problems, "the CRL only covers end-entity certificates")
+	}
+	if idp.OnlyContainsAttributeCerts {
+		problems = append(problems, "the CRL only covers attribute certificates")
+	}
+	if idp.OnlySomeReasons {
+		problems = append(problems, "the CRL only covers some revocation reasons")
+	}
+	if idp.IndirectCRL {
+		problems = append(problems, "the CRL is indirect, which is not supported")
+	}
+	if idp.HasDistributionPoint {
+		matched := false
+		for _, uri := range idp.URIs {
+			for _, certURI := range cert.CRLDistributionPoints {
+				matched = matched || uri == certURI
+			}
+		}
+		if len(cert.CRLDistributionPoints) == 0 {
+			problems = append(problems, "the CRL is partitioned, but the certificate names no CRL distribution point")
+		} else if !matched {
+			problems = append(problems, fmt.Sprintf("the CRL's distribution point [%s] is not among the certificate's [%s]",
+				strings.Join(idp.URIs, ", "), strings.Join(cert.CRLDistributionPoints, ", ")))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,109 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withIDP adds an issuingDistributionPoint extension to the parsed crl. The
+// signature covers the raw TBSCertList, so it still verifies.
+func withIDP(t *testing.T, crl *pkix.CertificateList, idp issuingDistributionPointASN1) *pkix.CertificateList {
+	value, err := asn1.Marshal(idp)
+	if err != nil {
+		t.Fatalf("Could not marshal issuing distribution point: %s", err)
+	}
+	scoped := *crl
+	scoped.TBSCertList.Extensions = append([]pkix.Extension{{Id: oidExtensionIssuingDistributionPoint, Critical: true, Value: value}}, crl.TBSCertList.Extensions...)
+	return &scoped
+}
+
+func uriName(uri string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameURI, Bytes: []byte(uri)}
+}
+
+func TestCheckCRLScope(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	crl := testCRL(t, chain[1], 3, at.Add(-time.Hour), at.Add(24*time.Hour))
+
+	if problems, err := CheckCRLScope(crl, chain[0]); err != nil || problems != nil {
+		t.Errorf("Expected a CRL without an IDP to cover everything, got %v (%v)", problems, err)
+	}
+
+	caOnly := withIDP(t, crl, issuingDistributionPointASN1{
+		DistributionPoint:   distributionPointName{FullName: []asn1.RawValue{uriName("http://crl.example.com/ca.crl")}},
+		OnlyContainsCACerts: true,
+	})
+	idp, err := ParseIssuingDistributionPoint(caOnly)
+	if err != nil {
+		t.Fatalf("Could not parse issuing distribution point: %s", err)
+	}
+	expected := &IssuingDistributionPoint{HasDistributionPoint: true, URIs: []string{"http://crl.example.com/ca.crl"}, OnlyContainsCACerts: true}
+	if !reflect.DeepEqual(idp, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, idp)
+	}
+
+	leaf := *chain[0]
+	leaf.CRLDistributionPoints = []string{"http://crl.example.com/1.crl"}
+	problems, err := CheckCRLScope(caOnly, &leaf)
+	expectedProblems := []string{
+		"the CRL only covers CA certificates",
+		"the CRL's distribution point [http://crl.example.com/ca.crl] is not among the certificate's [http://crl.example.com/1.crl]",
+	}
+	if err != nil || !reflect.DeepEqual(problems, expectedProblems) {
+		t.Errorf("Expected %v, got %v (%v)", expectedProblems, problems, err)
+	}
+
+	leaf.CRLDistributionPoints = nil
+	userOnly := withIDP(t, crl, issuingDistributionPointASN1{
+		DistributionPoint:     distributionPointName{FullName: []asn1.RawValue{uriName("http://crl.example.com/1.crl")}},
+		OnlyContainsUserCerts: true,
+	})
+	if problems, err := CheckCRLScope(userOnly, &leaf); err != nil || !reflect.DeepEqual(problems, []string{"the CRL is partitioned, but the certificate names no CRL distribution point"}) {
+		t.Errorf("Expected a missing distribution point, got %v (%v)", problems, err)
+	}
+	leaf.CRLDistributionPoints = []string{"http://crl.example.com/1.crl"}
+	if problems, err := CheckCRLScope(userOnly, &leaf); err != nil || problems != nil {
+		t.Errorf("Expected the matching partition to cover the leaf, got %v (%v)", problems, err)
+	}
+	if problems, err := CheckCRLScope(userOnly, chain[1]); err != nil || len(problems) == 0 || problems[0] != "the CRL only covers end-entity certificates" {
+		t.Errorf("Expected the CA outside a user-only CRL, got %v (%v)", problems, err)
+	}
+
+	broken := *crl
+	broken.TBSCertList.Extensions = []pkix.Extension{{Id: oidExtensionIssuingDistributionPoint, Value: []byte{0x30, 0x03}}}
+	if _, err := CheckCRLScope(&broken, chain[0]); err == nil {
+		t.Errorf("Expected an error for a truncated extension")
+	}
+}
+
+func TestCAReportCRLScope(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	crl := withIDP(t, testCRL(t, chain[2], 2, at.Add(-time.Hour), at.Add(24*time.Hour)), issuingDistributionPointASN1{OnlyContainsUserCerts: true})
+	roots := []TrustedRoot{{Label: "Acme Root", Cert: chain[2]}, {Label: "Acme Issuing CA", Cert: chain[1]}}
+
+	report := NewCAReport("", roots, []*pkix.CertificateList{crl}, at, 0)
+	for _, entry := range report.Entries {
+		if entry.Label != "Acme Issuing CA" {
+			continue
+		}
+		if entry.RevocationChecked || entry.Revoked {
+			t.Errorf("Expected the out-of-scope CRL to be ignored")
+		}
+		if !reflect.DeepEqual(entry.CRLOutOfScope, []string{"the CRL only covers end-entity certificates"}) {
+			t.Errorf("Unexpected scope findings %v", entry.CRLOutOfScope)
+		}
+	}
+}
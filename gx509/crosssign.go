@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// A PathVerdict is the predicted outcome of one client building a path from
+// a served chain.
+type PathVerdict struct {
+	Client   string
+	Accepted bool
+	// Path is the chain the client is expected to end up with, including the
+	// root if one was found.
+	Path   []*x509.Certificate
+	Reason string
+}
+
+// CrossSignAnalysis describes how clients cope with a served chain whose
+// path to a trusted root involves cross-signed certificates.
+type CrossSignAnalysis struct {
+	// Chains holds every path from the leaf to a trusted root that can be
+	// built from the served certificates and the trust store.
+	Chains [][]*x509.Certificate
+	// ServedPath is the path a client gets by following the served
+	// certificates in order as far as they go.
+	ServedPath []*x509.Certificate
+	// Recommended is the chain to serve instead, without its root, or nil if
+	// no chain is valid at the time of analysis.
+	Recommended []*x509.Certificate
+	Verdicts    []PathVerdict
+}
+
+// AnalyzeCrossSigns predicts, for each client in DefaultKnowledgeBase, whether
+// the served chain verifies at the given time against roots.
+func AnalyzeCrossSigns(served, roots []*x509.Certificate, at time.Time) CrossSignAnalysis {
+	return DefaultKnowledgeBase.AnalyzeCrossSigns(served, roots, at)
+}
+
+// AnalyzeCrossSigns is like the package-level AnalyzeCrossSigns, but uses the
+// clients in kb.
+func (kb *KnowledgeBase) AnalyzeCrossSigns(served, roots []*x509.Certificate, at time.Time) CrossSignAnalysis {
+	var analysis CrossSignAnalysis
+	if len(served) == 0 {
+		return analysis
+	}
+
+	leaf, intermediates := served[0], served[1:]
+	analysis.Chains = BuildChains(leaf, intermediates, roots)
+	analysis.ServedPath = servedPath(leaf, intermediates, roots)
+
+	var valid []*x509.Certificate
+	for _, chain := range analysis.Chains {
+		if chainValidAt(chain, at) && (valid == nil || len(chain) < len(valid)) {
+			valid = chain
+		}
+	}
+	if valid != nil {
+		analysis.Recommended = valid[:len(valid)-1]
+	}
+
+	servedOK := len(analysis.ServedPath) > 0 && chainValidAt(analysis.ServedPath, at)
+	for _, client := range kb.Clients {
+		verdict := PathVerdict{Client: client.Name}
+		switch {
+		case servedOK:
+			verdict.Accepted = true
+			verdict.Path = analysis.ServedPath
+			verdict.Reason = "the served chain reaches a valid root"
+		case client.BuildsAlternatePaths && valid != nil:
+			verdict.Accepted = true
+			verdict.Path = valid
+			verdict.Reason = fmt.Sprintf("builds an alternate path to %s", valid[len(valid)-1].Subject.CommonName)
+		case len(analysis.ServedPath) == 0:
+			verdict.Reason = "the served chain does not reach a trusted root"
+		default:
+			verdict.Path = analysis.ServedPath
+			verdict.Reason = fmt.Sprintf("follows the served chain to %s", firstInvalid(analysis.ServedPath, at))
+		}
+		analysis.Verdicts = append(analysis.Verdicts, verdict)
+	}
+
+	return analysis
+}
+
+// servedPath follows the served intermediates from leaf for as long as they
+// go, preferring them over the trust store like a client that does not build
+// paths, and then looks for a root. It returns nil if no root issued the last
+// certificate on the path.
+func servedPath(leaf *x509.Certificate, intermediates, roots []*x509.Certificate) []*x509.Certificate {
+	path := PartialChain(leaf, intermediates)
+
+	// A trust anchor that was served along with the chain still has to be
+	// in the trust store.
+	for len(path) > 1 && isSelfSigned(path[len(path)-1]) {
+		if containsCertificate(roots, path[len(path)-1]) {
+			return path
+		}
+		path = path[:len(path)-1]
+	}
+
+	issuers := FindIssuers(path[len(path)-1], roots)
+	if len(issuers) == 0 {
+		return nil
+	}
+	return append(path, issuers[0])
+}
+
+// firstInvalid describes the first certificate in chain that is not valid at
+// t.
+func firstInvalid(chain []*x509.Certificate, t time.Time) string {
+	for _, cert := range chain {
+		if t.Before(cert.NotBefore) {
+			return fmt.Sprintf("%s, which is not yet valid", cert.Subject.CommonName)
+		}
+		if t.After(cert.NotAfter) {
+			return fmt.Sprintf("%s, which expired %s", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+		}
+	}
+	return "the end"
+}
@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func pathVerdictFor(t *testing.T, verdicts []PathVerdict, client string) PathVerdict {
+	for _, verdict := range verdicts {
+		if verdict.Client == client {
+			return verdict
+		}
+	}
+	t.Fatalf("No verdict for %s", client)
+	return PathVerdict{}
+}
+
+func TestAnalyzeExpiredCrossSign(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	oldRoot := testCA(t, "Old Root", nil, now.AddDate(0, 0, -1))
+	newRoot := testCA(t, "New Root", nil, now.AddDate(10, 0, 0))
+	crossSign := testCA(t, "New Root", oldRoot, now.AddDate(0, 0, -1))
+	intermediate := testCA(t, "Issuing CA", newRoot, now.AddDate(5, 0, 0))
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "www.example.com",
+		},
+		NotBefore: now.AddDate(0, -1, 0),
+		NotAfter:  now.AddDate(0, 2, 0),
+		DNSNames:  []string{"www.example.com"},
+	}, intermediate)
+
+	served := []*x509.Certificate{leaf, intermediate, crossSign}
+	analysis := AnalyzeCrossSigns(served, []*x509.Certificate{oldRoot, newRoot}, now)
+
+	if len(analysis.Chains) != 2 {
+		t.Errorf("Expected 2 chains, got %d", len(analysis.Chains))
+	}
+	checkChainNames(t, analysis.ServedPath, "www.example.com", "Issuing CA", "New Root", "Old Root")
+	checkChainNames(t, analysis.Recommended, "www.example.com", "Issuing CA")
+
+	if verdict := pathVerdictFor(t, analysis.Verdicts, "Firefox"); !verdict.Accepted {
+		t.Errorf("Expected Firefox to build an alternate path: %s", verdict.Reason)
+	}
+	if verdict := pathVerdictFor(t, analysis.Verdicts, "OpenSSL 1.0.2"); verdict.Accepted {
+		t.Errorf("Expected OpenSSL 1.0.2 to follow the expired cross-sign: %s", verdict.Reason)
+	}
+
+	// Serving the recommended chain works everywhere
+	analysis = AnalyzeCrossSigns(analysis.Recommended, []*x509.Certificate{oldRoot, newRoot}, now)
+	for _, verdict := range analysis.Verdicts {
+		if !verdict.Accepted {
+			t.Errorf("%s rejected the recommended chain: %s", verdict.Client, verdict.Reason)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An IssuerSource finds certificates that may have issued a certificate.
+type IssuerSource interface {
+	IssuerCandidates(cert *x509.Certificate) ([]*x509.Certificate, error)
+}
+
+// CrtSh searches the crt.sh certificate search service.
+type CrtSh struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewCrtSh returns a client for https://crt.sh.
+func NewCrtSh() *CrtSh {
+	return &CrtSh{
+		BaseURL: "https://crt.sh/",
+		Client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type crtShEntry struct {
+	ID             int64  `json:"id"`
+	EntryTimestamp string `json:"entry_timestamp"`
+}
+
+// crtShTimestampFormat is how crt.sh gives times, in UTC.
+const crtShTimestampFormat = "2006-01-02T15:04:05.999999999"
+
+// maxCrtShSerialMatches bounds the certificates LookupSerial downloads.
+const maxCrtShSerialMatches = 20
+
+func (c *CrtSh) get(params url.Values) ([]byte, error) {
+	resp, err := c.Client.Get(c.BaseURL + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crt.sh returned %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Search returns the crt.sh IDs of the certificates matching params, which
+// are crt.sh query parameters such as "ski" or "sha256".
+func (c *CrtSh) Search(params url.Values) ([]int64, error) {
+	entries, err := c.search(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids, nil
+}
+
+func (c *CrtSh) search(params url.Values) ([]crtShEntry, error) {
+	params.Set("output", "json")
+	body, err := c.get(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []crtShEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("Could not decode crt.sh response: %s", err)
+	}
+	return entries, nil
+}
+
+// Certificate downloads the certificate with the given crt.sh ID.
+func (c *CrtSh) Certificate(id int64) (*x509.Certificate, error) {
+	body, err := c.get(url.Values{"d": {strconv.FormatInt(id, 10)}})
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("crt.sh ID %d is not a PEM certificate", id)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// IssuerCandidates returns every certificate logged with a subject key
+// identifier matching cert's authority key identifier, which includes
+// cross-signs and reissues of its issuer.
+func (c *CrtSh) IssuerCandidates(cert *x509.Certificate) ([]*x509.Certificate, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return nil, nil
+	}
+
+	ids, err := c.Search(url.Values{"ski": {fmt.Sprintf("%x", cert.AuthorityKeyId)}})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*x509.Certificate
+	for _, id := range ids {
+		candidate, err := c.Certificate(id)
+		if err != nil {
+			return nil, err
+		}
+		if IssuedBy(cert, candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, nil
+}
+
+// A CrtShCertificate is a certificate found on crt.sh, with the context of
+// its issuance.
+type CrtShCertificate struct {
+	ID          int64
+	Certificate *x509.Certificate
+	// LoggedAt is when crt.sh first saw the certificate in a CT log, if it
+	// said.
+	LoggedAt time.Time
+	// Issuers are the logged certificates that could have issued it.
+	Issuers []*x509.Certificate
+}
+
+// lookup downloads the certificate of entry and its issuers.
+func (c *CrtSh) lookup(entry crtShEntry, cert *x509.Certificate) (*CrtShCertificate, error) {
+	found := &CrtShCertificate{ID: entry.ID, Certificate: cert}
+	if loggedAt, err := time.Parse(crtShTimestampFormat, entry.EntryTimestamp); err == nil {
+		found.LoggedAt = loggedAt
+	}
+	var err error
+	if found.Issuers, err = c.IssuerCandidates(cert); err != nil {
+		return nil, fmt.Errorf("Could not find the issuers of crt.sh ID %d: %s", entry.ID, err)
+	}
+	return found, nil
+}
+
+// LookupSHA256 finds the certificate with the given SHA-256 fingerprint.
+func (c *CrtSh) LookupSHA256(fingerprint [sha256.Size]byte) (*CrtShCertificate, error) {
+	entries, err := c.search(url.Values{"sha256": {fmt.Sprintf("%x", fingerprint)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("crt.sh has no certificate with SHA-256 fingerprint %x", fingerprint)
+	}
+	cert, err := c.Certificate(entries[0].ID)
+	if err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(cert.Raw) != fingerprint {
+		return nil, fmt.Errorf("crt.sh ID %d does not have SHA-256 fingerprint %x", entries[0].ID, fingerprint)
+	}
+	return c.lookup(entries[0], cert)
+}
+
+// LookupSerial finds the certificates with the given serial number whose
+// issuer's name contains issuer, ignoring case. A precertificate is only
+// returned if its certificate has not been logged.
+func (c *CrtSh) LookupSerial(serial *big.Int, issuer string) ([]*CrtShCertificate, error) {
+	entries, err := c.search(url.Values{"serial": {fmt.Sprintf("%x", serial)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > maxCrtShSerialMatches {
+		return nil, fmt.Errorf("crt.sh has %d certificates with serial number %x; give a fingerprint instead", len(entries), serial)
+	}
+
+	type candidate struct {
+		entry crtShEntry
+		cert  *x509.Certificate
+	}
+	issuer = strings.ToLower(issuer)
+	var matches []*CrtShCertificate
+	var precertificates []candidate
+	logged := make(map[string]bool)
+	for _, entry := range entries {
+		cert, err := c.Certificate(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		name, _ := FormatDistinguishedName(cert.RawIssuer)
+		if cert.SerialNumber.Cmp(serial) != 0 ||
+			!strings.Contains(strings.ToLower(name), issuer) && !strings.Contains(strings.ToLower(cert.Issuer.CommonName), issuer) {
+			continue
+		}
+		if IsPrecertificate(cert) {
+			precertificates = append(precertificates, candidate{entry, cert})
+			continue
+		}
+		logged[string(cert.RawIssuer)] = true
+		found, err := c.lookup(entry, cert)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found)
+	}
+	for _, precertificate := range precertificates {
+		if logged[string(precertificate.cert.RawIssuer)] {
+			continue
+		}
+		found, err := c.lookup(precertificate.entry, precertificate.cert)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("crt.sh has no certificate with serial number %x issued by %q", serial, issuer)
+	}
+	return matches, nil
+}
@@ -0,0 +1,127 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeCrtSh serves certs by crt.sh ID (their index plus one) and answers ski,
+// sha256 and serial searches.
+func fakeCrtSh(t *testing.T, certs []*x509.Certificate) (*CrtSh, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if id := query.Get("d"); len(id) > 0 {
+			index, err := strconv.Atoi(id)
+			if err != nil || index < 1 || index > len(certs) {
+				http.NotFound(w, r)
+				return
+			}
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: certs[index-1].Raw})
+			return
+		}
+
+		if query.Get("output") != "json" {
+			t.Errorf("Expected JSON output, got %q", query.Get("output"))
+		}
+		fmt.Fprintf(w, "[")
+		separator := ""
+		for i, cert := range certs {
+			if len(query.Get("ski")) > 0 && fmt.Sprintf("%x", cert.SubjectKeyId) == query.Get("ski") ||
+				fmt.Sprintf("%x", sha256.Sum256(cert.Raw)) == query.Get("sha256") ||
+				fmt.Sprintf("%x", cert.SerialNumber) == query.Get("serial") {
+				fmt.Fprintf(w, `%s{"id": %d, "issuer_name": "ignored", "entry_timestamp": "2019-03-22T16:19:24.413"}`, separator, i+1)
+				separator = ","
+			}
+		}
+		fmt.Fprintf(w, "]")
+	}))
+
+	client := NewCrtSh()
+	client.BaseURL = server.URL + "/"
+	return client, server
+}
+
+func TestCrtShCertificate(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	client, server := fakeCrtSh(t, chain)
+	defer server.Close()
+
+	cert, err := client.Certificate(2)
+	if err != nil {
+		t.Fatalf("Failed to fetch certificate: %s", err)
+	}
+	if !cert.Equal(chain[1]) {
+		t.Errorf("Fetched the wrong certificate: %s", cert.Subject.CommonName)
+	}
+
+	if _, err := client.Certificate(42); err == nil {
+		t.Errorf("Expected an error fetching a missing certificate")
+	}
+}
+
+func TestCrtShLookup(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	root := testCAWithKeyID(t, "Lookup Root", 1, nil, notAfter)
+	intermediate := testCAWithKeyID(t, "Lookup Intermediate", 2, root, notAfter)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(20),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}
+	precertTemplate := *template
+	precertTemplate.ExtraExtensions = []pkix.Extension{{Id: oidExtensionCTPoison, Critical: true, Value: []byte{0x05, 0x00}}}
+	precert := issueAndParse(t, &precertTemplate, intermediate)
+	final := issueAndParse(t, template, intermediate)
+
+	client, server := fakeCrtSh(t, []*x509.Certificate{root, intermediate, precert})
+	defer server.Close()
+
+	found, err := client.LookupSHA256(sha256.Sum256(intermediate.Raw))
+	if err != nil {
+		t.Fatalf("Could not look up by fingerprint: %s", err)
+	}
+	if found.ID != 2 || !found.Certificate.Equal(intermediate) || len(found.Issuers) != 1 || !found.Issuers[0].Equal(root) ||
+		!found.LoggedAt.Equal(time.Date(2019, time.March, 22, 16, 19, 24, 413000000, time.UTC)) {
+		t.Errorf("Unexpected lookup %+v", found)
+	}
+	if _, err := client.LookupSHA256(sha256.Sum256(final.Raw)); err == nil {
+		t.Errorf("Expected an error looking up an unlogged certificate")
+	}
+
+	// Only the precertificate is logged
+	matches, err := client.LookupSerial(big.NewInt(20), "lookup INTERMEDIATE")
+	if err != nil {
+		t.Fatalf("Could not look up by serial number: %s", err)
+	}
+	if len(matches) != 1 || !matches[0].Certificate.Equal(precert) || len(matches[0].Issuers) != 1 {
+		t.Errorf("Expected the precertificate, got %+v", matches)
+	}
+	if _, err := client.LookupSerial(big.NewInt(20), "Other CA"); err == nil {
+		t.Errorf("Expected an error looking up another issuer's serial number")
+	}
+
+	// Once the certificate is logged, it is preferred
+	client, server = fakeCrtSh(t, []*x509.Certificate{root, intermediate, precert, final})
+	defer server.Close()
+	if matches, err = client.LookupSerial(big.NewInt(20), "Lookup Intermediate"); err != nil || len(matches) != 1 || !matches[0].Certificate.Equal(final) {
+		t.Errorf("Expected the final certificate, got %+v, %v", matches, err)
+	}
+}
@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterRenderer("csv", func(w io.Writer) Renderer { return csvRenderer{w} })
+}
+
+// csvRenderer writes analyses and query results as CSV, with a header row.
+type csvRenderer struct {
+	w io.Writer
+}
+
+func (r csvRenderer) Render(report Report) error {
+	writer := csv.NewWriter(r.w)
+	switch report.Kind {
+	case AnalysisReport:
+		writer.Write([]string{"name", "fingerprint", "subject_cn", "issuer_cn", "not_before", "not_after", "is_ca", "policy", "constrained", "reasons"})
+		for _, result := range report.Results {
+			writer.Write([]string{
+				result.Name, result.Fingerprint, result.SubjectCN, result.IssuerCN,
+				result.NotBefore.Format(time.RFC3339), result.NotAfter.Format(time.RFC3339),
+				fmt.Sprintf("%t", result.IsCA), result.Policy, fmt.Sprintf("%t", result.Constrained),
+				strings.Join(result.Reasons, " "),
+			})
+		}
+	case QueryReport:
+		header := []string{"fingerprint", "subject_cn", "issuer_cn", "not_before", "not_after", "first_seen", "last_seen", "sources"}
+		if report.StoredVerdicts {
+			header = append(header, "policy", "constrained", "reasons")
+		}
+		writer.Write(header)
+		for _, result := range report.Selected {
+			selected := newJSONSelected(result, report.StoredVerdicts)
+			record := []string{
+				selected.Fingerprint, selected.Subject, selected.Issuer,
+				selected.NotBefore.Format(time.RFC3339), selected.NotAfter.Format(time.RFC3339),
+				selected.FirstSeen.Format(time.RFC3339), selected.LastSeen.Format(time.RFC3339),
+				strings.Join(selected.Sources, " "),
+			}
+			if report.StoredVerdicts {
+				record = append(record, selected.Policy, fmt.Sprintf("%t", *selected.Constrained), strings.Join(selected.Reasons, " "))
+			}
+			writer.Write(record)
+		}
+	default:
+		return errUnsupportedReport("csv", report.Kind)
+	}
+	writer.Flush()
+	return writer.Error()
+}
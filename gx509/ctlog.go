@@ -0,0 +1,350 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCTBatchSize is how many entries a CTTailer asks a log for at once.
+// Logs may return fewer.
+const defaultCTBatchSize = 256
+
+// A CTLogClient downloads from an RFC 6962 Certificate Transparency log.
+type CTLogClient struct {
+	// URL is the log's base, such as https://ct.example.com/2025h1/, under
+	// which ct/v1/get-entries is found.
+	URL    string
+	Client *http.Client
+}
+
+// NewCTLogClient returns a client for the log at url, such as a CTLog's URL.
+func NewCTLogClient(url string) *CTLogClient {
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+	return &CTLogClient{URL: url, Client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+func (c *CTLogClient) get(method string, params url.Values, v interface{}) error {
+	endpoint := c.URL + "ct/v1/" + method
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	resp, err := c.Client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", method, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Could not decode %s response: %s", method, err)
+	}
+	return nil
+}
+
+// TreeSize returns the size of the log's latest signed tree head. The
+// signature is not verified.
+func (c *CTLogClient) TreeSize() (uint64, error) {
+	var sth struct {
+		TreeSize uint64 `json:"tree_size"`
+	}
+	if err := c.get("get-sth", nil, &sth); err != nil {
+		return 0, err
+	}
+	return sth.TreeSize, nil
+}
+
+// A CTEntry is an entry of a CT log.
+type CTEntry struct {
+	Index uint64
+	// Timestamp is when the log promised to incorporate the entry.
+	Timestamp time.Time
+	// Certificate is the certificate or precertificate logged, or nil if it
+	// could not be parsed, in which case Err says why.
+	Certificate    *x509.Certificate
+	Precertificate bool
+	Err            error
+}
+
+// GetEntries returns the entries from start to end inclusive, though the
+// log may return fewer than asked for.
+func (c *CTLogClient) GetEntries(start, end uint64) ([]*CTEntry, error) {
+	var response struct {
+		Entries []struct {
+			LeafInput []byte `json:"leaf_input"`
+			ExtraData []byte `json:"extra_data"`
+		} `json:"entries"`
+	}
+	params := url.Values{"start": {strconv.FormatUint(start, 10)}, "end": {strconv.FormatUint(end, 10)}}
+	if err := c.get("get-entries", params, &response); err != nil {
+		return nil, err
+	}
+	if uint64(len(response.Entries)) > end-start+1 {
+		return nil, fmt.Errorf("Log returned %d entries, more than the %d asked for", len(response.Entries), end-start+1)
+	}
+
+	entries := make([]*CTEntry, 0, len(response.Entries))
+	for i, raw := range response.Entries {
+		entry := &CTEntry{Index: start + uint64(i)}
+		if len(raw.LeafInput) >= 12 {
+			entry.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(raw.LeafInput[2:10]))*int64(time.Millisecond)).UTC()
+			entry.Precertificate = binary.BigEndian.Uint16(raw.LeafInput[10:12]) == ctPrecertEntry
+		}
+		entry.Certificate, entry.Err = parseMerkleTreeLeaf(raw.LeafInput, raw.ExtraData)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// A CTAnalysis is a check a CTTailer runs on each entry.
+type CTAnalysis struct {
+	// Name identifies the analysis on the command line, and never changes.
+	Name        string
+	Description string
+
+	// run returns a message for each finding on entry, judging constraints
+	// by policy and lints as of at.
+	run func(entry *CTEntry, policy Policy, at time.Time) []string
+}
+
+// CTAnalyses are the analyses a CTTailer can run.
+var CTAnalyses = []*CTAnalysis{
+	{
+		Name:        "unconstrained-ca",
+		Description: "Flag intermediate CA certificates that are not technically constrained.",
+		run: func(entry *CTEntry, policy Policy, at time.Time) []string {
+			cert := entry.Certificate
+			if cert == nil || !cert.IsCA || isSelfSigned(cert) {
+				return nil
+			}
+			analysis := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+			if analysis.Constrained {
+				return nil
+			}
+			message := fmt.Sprintf("New intermediate is not technically constrained under %s", policy.Name)
+			if len(analysis.Reasons) > 0 {
+				message += ": " + analysis.Reasons[0].String()
+			}
+			return []string{message}
+		},
+	},
+	{
+		Name:        "lints",
+		Description: "Flag certificates that fail a lint of error severity.",
+		run: func(entry *CTEntry, policy Policy, at time.Time) []string {
+			if entry.Certificate == nil {
+				return nil
+			}
+			var messages []string
+			for _, lint := range Lints {
+				if lint.Severity != SeverityError {
+					continue
+				}
+				if passed, message, ok := lint.run(entry.Certificate, at); ok && !passed {
+					messages = append(messages, fmt.Sprintf("Fails lint %s: %s", lint.Name, message))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		Name:        "deviations",
+		Description: "Flag certificates whose encoding departs from RFC 5280, such as with a negative serial number.",
+		run: func(entry *CTEntry, policy Policy, at time.Time) []string {
+			if entry.Certificate == nil {
+				return nil
+			}
+			return EncodingDeviations(entry.Certificate)
+		},
+	},
+	{
+		Name:        "unparseable",
+		Description: "Flag entries whose certificate cannot be parsed.",
+		run: func(entry *CTEntry, policy Policy, at time.Time) []string {
+			if entry.Err == nil {
+				return nil
+			}
+			return []string{fmt.Sprintf("Could not parse entry: %s", entry.Err)}
+		},
+	},
+}
+
+// LookupCTAnalysis returns the analysis named name, or nil if there is none.
+func LookupCTAnalysis(name string) *CTAnalysis {
+	for _, analysis := range CTAnalyses {
+		if analysis.Name == name {
+			return analysis
+		}
+	}
+	return nil
+}
+
+// ctState is what a CTTailer saves between runs.
+type ctState struct {
+	Log  string `json:"log"`
+	Next uint64 `json:"next"`
+}
+
+// LoadCTState returns the index of the next entry to download from the log
+// at logURL, as saved in the state file path, or ok false if there is none.
+func LoadCTState(path, logURL string) (next uint64, ok bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	var state ctState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, false, fmt.Errorf("Could not decode %s: %s", path, err)
+	}
+	if state.Log != logURL {
+		return 0, false, fmt.Errorf("%s holds the state of %s, not %s", path, state.Log, logURL)
+	}
+	return state.Next, true, nil
+}
+
+// SaveCTState saves next as the index of the next entry to download from the
+// log at logURL in the state file path.
+func SaveCTState(path, logURL string, next uint64) error {
+	data, err := json.Marshal(ctState{Log: logURL, Next: next})
+	if err != nil {
+		return err
+	}
+
+	// Write beside the file and rename, so a failed write leaves it intact
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// A CTTailer incrementally downloads a log's entries from a saved index and
+// analyzes each.
+type CTTailer struct {
+	Log *CTLogClient
+	// StatePath is the file the index of the next entry is saved in, after
+	// every batch, so tailing resumes where it stopped.
+	StatePath string
+	// BatchSize is how many entries to ask for at once, or 256 if zero.
+	BatchSize uint64
+	// Policy judges technical constraints, and Analyses are run on each
+	// entry.
+	Policy   Policy
+	Analyses []*CTAnalysis
+	// Job names the tailer in its alerts.
+	Job string
+}
+
+// A CTPoll is what a CTTailer's Poll did.
+type CTPoll struct {
+	// Start is the first index downloaded and Next the one after the last.
+	Start    uint64
+	Next     uint64
+	TreeSize uint64
+	Alerts   int
+	// Unparseable counts the entries whose certificate could not be parsed.
+	Unparseable int
+}
+
+// Analyze runs the tailer's analyses on entry, returning an alert for each
+// finding.
+func (t *CTTailer) Analyze(entry *CTEntry, at time.Time) []Alert {
+	alert := Alert{Job: t.Job, Time: at, Source: fmt.Sprintf("%s#%d", t.Log.URL, entry.Index)}
+	if entry.Certificate != nil {
+		alert.Subject = entry.Certificate.Subject.CommonName
+		alert.Fingerprint = fmt.Sprintf("%x", sha256.Sum256(entry.Certificate.Raw))
+	}
+	var alerts []Alert
+	for _, analysis := range t.Analyses {
+		for _, message := range analysis.run(entry, t.Policy, at) {
+			alert.Message = message
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// Poll downloads the entries after the saved index, which must have been
+// saved, up to the log's tree size or max entries if max is not zero, and
+// calls found with each and its alerts, in order. The index is saved after
+// each batch, so an error leaves it after the last batch found saw.
+func (t *CTTailer) Poll(max uint64, at time.Time, found func(entry *CTEntry, alerts []Alert)) (CTPoll, error) {
+	next, ok, err := LoadCTState(t.StatePath, t.Log.URL)
+	if err != nil {
+		return CTPoll{}, err
+	}
+	if !ok {
+		return CTPoll{}, fmt.Errorf("No index is saved in %s", t.StatePath)
+	}
+	poll := CTPoll{Start: next, Next: next}
+	if poll.TreeSize, err = t.Log.TreeSize(); err != nil {
+		return poll, err
+	}
+	batchSize := t.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultCTBatchSize
+	}
+
+	end := poll.TreeSize
+	if max > 0 && poll.Start+max < end {
+		end = poll.Start + max
+	}
+	for poll.Next < end {
+		last := poll.Next + batchSize - 1
+		if last >= end {
+			last = end - 1
+		}
+		entries, err := t.Log.GetEntries(poll.Next, last)
+		if err != nil {
+			return poll, err
+		}
+		if len(entries) == 0 {
+			return poll, fmt.Errorf("Log returned no entries from %d", poll.Next)
+		}
+		for _, entry := range entries {
+			if entry.Err != nil {
+				poll.Unparseable++
+			}
+			alerts := t.Analyze(entry, at)
+			poll.Alerts += len(alerts)
+			found(entry, alerts)
+		}
+		poll.Next += uint64(len(entries))
+		if err := SaveCTState(t.StatePath, t.Log.URL, poll.Next); err != nil {
+			return poll, err
+		}
+	}
+	return poll, nil
+}
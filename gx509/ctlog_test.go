@@ -0,0 +1,135 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCTLog serves entries as an RFC 6962 log that returns at most two
+// entries a request.
+func fakeCTLog(t *testing.T, entries []map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/log/ct/v1/get-sth":
+			json.NewEncoder(w).Encode(map[string]interface{}{"tree_size": len(entries)})
+		case "/log/ct/v1/get-entries":
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			end, _ := strconv.Atoi(r.URL.Query().Get("end"))
+			if end >= len(entries) || start > end {
+				http.Error(w, "bad range", http.StatusBadRequest)
+				return
+			}
+			if end > start+1 {
+				end = start + 1
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries[start : end+1]})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCTTailer(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	unconstrained := testCA(t, "Unconstrained CA", chain[2], time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+	leafInput := merkleTreeLeaf(ctX509Entry, chain[0].Raw)
+	// 2020-01-01T00:00:00Z in milliseconds
+	copy(leafInput[2:10], []byte{0, 0, 0x01, 0x6f, 0x5e, 0x66, 0xe8, 0x00})
+	entries := []map[string][]byte{
+		{"leaf_input": leafInput},
+		{"leaf_input": merkleTreeLeaf(ctX509Entry, unconstrained.Raw)},
+		{"leaf_input": merkleTreeLeaf(ctPrecertEntry, chain[0].RawTBSCertificate), "extra_data": append(uint24Prefixed(chain[0].Raw), uint24Prefixed(nil)...)},
+		{"leaf_input": merkleTreeLeaf(ctX509Entry, []byte{0x30, 0x00})},
+		{"leaf_input": merkleTreeLeaf(ctX509Entry, chain[1].Raw)},
+	}
+	server := fakeCTLog(t, entries)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ctlog")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state.json")
+
+	log := NewCTLogClient(server.URL + "/log")
+	if size, err := log.TreeSize(); err != nil || size != 5 {
+		t.Fatalf("Expected a tree of 5 entries, got %d, %v", size, err)
+	}
+	tailer := &CTTailer{
+		Log:       log,
+		StatePath: statePath,
+		BatchSize: 3,
+		// testChain's intermediate is only constrained by dNSName
+		Policy:   MozillaPolicy22,
+		Analyses: []*CTAnalysis{LookupCTAnalysis("unconstrained-ca"), LookupCTAnalysis("unparseable")},
+		Job:      "argon",
+	}
+	if _, err := tailer.Poll(0, time.Now(), func(*CTEntry, []Alert) {}); err == nil {
+		t.Errorf("Expected an error polling without a saved index")
+	}
+
+	if err := SaveCTState(statePath, log.URL, 0); err != nil {
+		t.Fatalf("Could not save state: %s", err)
+	}
+	var found []*CTEntry
+	var alerts []Alert
+	collect := func(entry *CTEntry, entryAlerts []Alert) {
+		found = append(found, entry)
+		alerts = append(alerts, entryAlerts...)
+	}
+	at := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	poll, err := tailer.Poll(3, at, collect)
+	if err != nil {
+		t.Fatalf("Could not poll: %s", err)
+	}
+	if poll != (CTPoll{Start: 0, Next: 3, TreeSize: 5, Alerts: 1}) || len(found) != 3 {
+		t.Fatalf("Unexpected poll %+v of %d entries", poll, len(found))
+	}
+	if !found[0].Timestamp.Equal(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)) || found[0].Precertificate || !found[2].Precertificate {
+		t.Errorf("Unexpected entries %+v, %+v", found[0], found[2])
+	}
+	if alerts[0].Job != "argon" || alerts[0].Source != log.URL+"#1" || alerts[0].Subject != "Unconstrained CA" ||
+		!strings.HasPrefix(alerts[0].Message, "New intermediate is not technically constrained under mozilla-2.2") {
+		t.Errorf("Unexpected alert %+v", alerts[0])
+	}
+
+	// Resumes from the saved index
+	if next, ok, err := LoadCTState(statePath, log.URL); err != nil || !ok || next != 3 {
+		t.Errorf("Expected index 3 to be saved, got %d, %t, %v", next, ok, err)
+	}
+	found, alerts = nil, nil
+	if poll, err = tailer.Poll(0, at, collect); err != nil {
+		t.Fatalf("Could not poll: %s", err)
+	}
+	if poll != (CTPoll{Start: 3, Next: 5, TreeSize: 5, Alerts: 1, Unparseable: 1}) || found[0].Index != 3 || found[0].Err == nil {
+		t.Errorf("Unexpected poll %+v", poll)
+	}
+	if len(alerts) != 1 || !strings.HasPrefix(alerts[0].Message, "Could not parse entry") || alerts[0].Source != log.URL+"#3" {
+		t.Errorf("Unexpected alerts %+v", alerts)
+	}
+	if poll, err = tailer.Poll(0, at, collect); err != nil || poll.Next != 5 || len(found) != 2 {
+		t.Errorf("Expected nothing new, got %+v, %v", poll, err)
+	}
+
+	if _, _, err := LoadCTState(statePath, "https://other.example/"); err == nil {
+		t.Errorf("Expected an error loading another log's state")
+	}
+	if LookupCTAnalysis("nope") != nil {
+		t.Errorf("Expected no analysis named nope")
+	}
+}
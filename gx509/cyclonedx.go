@@ -0,0 +1,212 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// An InventoryItem is a certificate found in a scan, with every place it was
+// found.
+type InventoryItem struct {
+	Cert      *x509.Certificate
+	Locations []string
+}
+
+// AddToInventory appends cert to items, or adds location to its existing
+// entry.
+func AddToInventory(items []InventoryItem, cert *x509.Certificate, location string) []InventoryItem {
+	for i := range items {
+		if items[i].Cert.Equal(cert) {
+			items[i].Locations = append(items[i].Locations, location)
+			return items
+		}
+	}
+	return append(items, InventoryItem{Cert: cert, Locations: []string{location}})
+}
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string   `json:"timestamp"`
+	Tools     cdxTools `json:"tools"`
+}
+
+type cdxTools struct {
+	Components []cdxTool `json:"components"`
+}
+
+type cdxTool struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type             string              `json:"type"`
+	BOMRef           string              `json:"bom-ref"`
+	Name             string              `json:"name"`
+	Hashes           []cdxHash           `json:"hashes"`
+	CryptoProperties cdxCryptoProperties `json:"cryptoProperties"`
+	Properties       []cdxProperty       `json:"properties,omitempty"`
+	Evidence         *cdxEvidence        `json:"evidence,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxCryptoProperties struct {
+	AssetType             string                   `json:"assetType"`
+	CertificateProperties cdxCertificateProperties `json:"certificateProperties"`
+}
+
+type cdxCertificateProperties struct {
+	SubjectName       string `json:"subjectName"`
+	IssuerName        string `json:"issuerName"`
+	NotValidBefore    string `json:"notValidBefore"`
+	NotValidAfter     string `json:"notValidAfter"`
+	CertificateFormat string `json:"certificateFormat"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxEvidence struct {
+	Occurrences []cdxOccurrence `json:"occurrences"`
+}
+
+type cdxOccurrence struct {
+	Location string `json:"location"`
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func init() {
+	RegisterRenderer("cyclonedx", func(w io.Writer) Renderer { return cycloneDXRenderer{w} })
+}
+
+// cycloneDXRenderer writes inventories with WriteCycloneDX.
+type cycloneDXRenderer struct {
+	w io.Writer
+}
+
+func (r cycloneDXRenderer) Render(report Report) error {
+	if report.Kind != InventoryReport {
+		return errUnsupportedReport("cyclonedx", report.Kind)
+	}
+	return WriteCycloneDX(r.w, report.Inventory, report.Generated)
+}
+
+// WriteCycloneDX writes items as a CycloneDX 1.6 JSON BOM with a
+// cryptographic asset component for each certificate, generated at the given
+// time.
+func WriteCycloneDX(w io.Writer, items []InventoryItem, at time.Time) error {
+	uuid, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.6",
+		SerialNumber: "urn:uuid:" + uuid,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: at.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxTool{{Type: "application", Name: "gx509"}}},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for _, item := range items {
+		cert := item.Cert
+		subject, err := FormatDistinguishedName(cert.RawSubject)
+		if err != nil {
+			return fmt.Errorf("Could not format subject of %s: %s", cert.Subject.CommonName, err)
+		}
+		issuer, err := FormatDistinguishedName(cert.RawIssuer)
+		if err != nil {
+			return fmt.Errorf("Could not format issuer of %s: %s", cert.Subject.CommonName, err)
+		}
+
+		fingerprint := fmt.Sprintf("%x", sha256.Sum256(cert.Raw))
+		name := cert.Subject.CommonName
+		if len(name) == 0 {
+			name = subject
+		}
+		key, weak := DescribeKey(cert.PublicKey)
+		constrained := AnalyzeTechnicalConstraints(cert).Constrained
+
+		component := cdxComponent{
+			Type:   "cryptographic-asset",
+			BOMRef: "sha256:" + fingerprint,
+			Name:   name,
+			Hashes: []cdxHash{
+				{Alg: "SHA-1", Content: fmt.Sprintf("%x", sha1.Sum(cert.Raw))},
+				{Alg: "SHA-256", Content: fingerprint},
+			},
+			CryptoProperties: cdxCryptoProperties{
+				AssetType: "certificate",
+				CertificateProperties: cdxCertificateProperties{
+					SubjectName:       subject,
+					IssuerName:        issuer,
+					NotValidBefore:    cert.NotBefore.UTC().Format(time.RFC3339),
+					NotValidAfter:     cert.NotAfter.UTC().Format(time.RFC3339),
+					CertificateFormat: "X.509",
+				},
+			},
+			Properties: []cdxProperty{
+				{Name: "gx509:serialNumber", Value: fmt.Sprintf("%X", cert.SerialNumber)},
+				{Name: "gx509:isCA", Value: strconv.FormatBool(cert.IsCA)},
+				{Name: "gx509:publicKey", Value: key},
+				{Name: "gx509:weakKey", Value: strconv.FormatBool(weak)},
+				{Name: "gx509:signatureAlgorithm", Value: cert.SignatureAlgorithm.String()},
+				{Name: "gx509:expired", Value: strconv.FormatBool(at.After(cert.NotAfter))},
+			},
+		}
+		if cert.IsCA {
+			component.Properties = append(component.Properties,
+				cdxProperty{Name: "gx509:technicallyConstrained", Value: strconv.FormatBool(constrained)})
+		}
+		if len(item.Locations) > 0 {
+			component.Evidence = &cdxEvidence{}
+			for _, location := range item.Locations {
+				component.Evidence.Occurrences = append(component.Evidence.Occurrences, cdxOccurrence{Location: location})
+			}
+		}
+		bom.Components = append(bom.Components, component)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bom)
+}
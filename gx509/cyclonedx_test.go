@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCycloneDX(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	var items []InventoryItem
+	items = AddToInventory(items, chain[0], "/etc/ssl/server.pem")
+	items = AddToInventory(items, chain[1], "/etc/ssl/server.pem")
+	items = AddToInventory(items, chain[1], "/etc/ssl/chain.pem")
+	if len(items) != 2 || len(items[1].Locations) != 2 {
+		t.Fatalf("Expected the intermediate to be recorded once with two locations: %+v", items)
+	}
+
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := WriteCycloneDX(&buf, items, at); err != nil {
+		t.Fatalf("Could not write BOM: %s", err)
+	}
+
+	var bom cdxBOM
+	if err := json.Unmarshal(buf.Bytes(), &bom); err != nil {
+		t.Fatalf("Could not decode BOM: %s", err)
+	}
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.6" || !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Errorf("Unexpected BOM header: %+v", bom)
+	}
+	if bom.Metadata.Timestamp != "2020-01-01T00:00:00Z" {
+		t.Errorf("Unexpected timestamp: %s", bom.Metadata.Timestamp)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("Expected 2 components, got %d", len(bom.Components))
+	}
+
+	leaf := bom.Components[0]
+	if leaf.Type != "cryptographic-asset" || leaf.CryptoProperties.AssetType != "certificate" {
+		t.Errorf("Unexpected component type: %+v", leaf)
+	}
+	if leaf.BOMRef != fmt.Sprintf("sha256:%x", sha256.Sum256(chain[0].Raw)) || leaf.Hashes[1].Alg != "SHA-256" {
+		t.Errorf("Unexpected hashes: %s %+v", leaf.BOMRef, leaf.Hashes)
+	}
+	properties := leaf.CryptoProperties.CertificateProperties
+	if properties.SubjectName != "CN=www.example.com" || properties.IssuerName != "CN=Σ Acme Co Issuing CA" {
+		t.Errorf("Unexpected names: %+v", properties)
+	}
+	if properties.NotValidAfter != "2018-06-01T00:00:00Z" {
+		t.Errorf("Unexpected validity: %+v", properties)
+	}
+
+	expired := false
+	for _, property := range leaf.Properties {
+		if property.Name == "gx509:expired" && property.Value == "true" {
+			expired = true
+		}
+		if property.Name == "gx509:technicallyConstrained" {
+			t.Errorf("Did not expect constraint status for a leaf")
+		}
+	}
+	if !expired {
+		t.Errorf("Expected the leaf to be marked expired: %+v", leaf.Properties)
+	}
+
+	if occurrences := bom.Components[1].Evidence.Occurrences; len(occurrences) != 2 || occurrences[1].Location != "/etc/ssl/chain.pem" {
+		t.Errorf("Unexpected occurrences: %+v", occurrences)
+	}
+}
@@ -0,0 +1,211 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A DaemonJob is a recurring scan the daemon runs. Exactly one of
+// Directories, Endpoints and CTDomains is set.
+type DaemonJob struct {
+	Name     string
+	Schedule *Schedule
+	// Directories are files and directories to scan, recursively, for PEM
+	// certificates.
+	Directories []string
+	// Endpoints are TLS servers, as host:port, whose chains to fetch.
+	Endpoints []string
+	// CTDomains are domains to search Certificate Transparency, through
+	// crt.sh, for certificates of.
+	CTDomains []string
+	// Timeout bounds each connection or download of the job.
+	Timeout time.Duration
+}
+
+// A DaemonConfig is what the daemon runs: its jobs, the warehouse it keeps
+// what they find in, and where it sends alerts.
+type DaemonConfig struct {
+	Warehouse string
+	// ExpiryWarning is how long before a certificate expires to alert.
+	ExpiryWarning time.Duration
+	Alerts        []AlertSink
+	Jobs          []DaemonJob
+
+	// VerdictLog, if set, is the path of a log of the verdict on every
+	// certificate the jobs find, rotated at VerdictLogMaxSize bytes with
+	// VerdictLogBackups old files kept.
+	VerdictLog        string
+	VerdictLogMaxSize int64
+	VerdictLogBackups int
+}
+
+// ConfigHash identifies the policy the daemon judges certificates by, for a
+// VerdictRecord.
+func (c *DaemonConfig) ConfigHash() string {
+	return ConfigHash(struct {
+		Policy        Policy
+		ExpiryWarning time.Duration
+	}{DefaultPolicy, c.ExpiryWarning})
+}
+
+type daemonJobYAML struct {
+	Name        string   `yaml:"name"`
+	Schedule    string   `yaml:"schedule"`
+	Directories []string `yaml:"directories,omitempty"`
+	Endpoints   []string `yaml:"endpoints,omitempty"`
+	CT          []string `yaml:"ct,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+}
+
+type alertSinkYAML struct {
+	Webhook string `yaml:"webhook,omitempty"`
+	File    string `yaml:"file,omitempty"`
+}
+
+type verdictLogYAML struct {
+	Path      string `yaml:"path"`
+	MaxSizeMB int64  `yaml:"maxSizeMB,omitempty"`
+	Backups   *int   `yaml:"backups,omitempty"`
+}
+
+type daemonConfigYAML struct {
+	Warehouse         string          `yaml:"warehouse"`
+	ExpiryWarningDays int             `yaml:"expiryWarningDays"`
+	Alerts            []alertSinkYAML `yaml:"alerts"`
+	VerdictLog        *verdictLogYAML `yaml:"verdictLog,omitempty"`
+	Jobs              []daemonJobYAML `yaml:"jobs"`
+}
+
+// defaultJobTimeout bounds the connections and downloads of jobs that do not
+// set a timeout.
+const defaultJobTimeout = 10 * time.Second
+
+// Verdict logs that do not say otherwise rotate at 100 MB and keep 10 old
+// files.
+const (
+	defaultVerdictLogMaxSizeMB = 100
+	defaultVerdictLogBackups   = 10
+)
+
+// ParseDaemonConfig decodes a YAML daemon configuration such as
+//
+//	warehouse: /var/lib/gx509/warehouse.db
+//	expiryWarningDays: 30
+//	alerts:
+//	  - webhook: https://alerts.example.com/gx509
+//	  - file: /var/log/gx509/alerts.jsonl
+//	verdictLog:
+//	  path: /var/log/gx509/verdicts.jsonl
+//	  maxSizeMB: 100
+//	  backups: 10
+//	jobs:
+//	  - name: pki-share
+//	    schedule: "0 * * * *"
+//	    directories: [/srv/pki]
+//	  - name: edge
+//	    schedule: "@every 15m"
+//	    endpoints: [www.example.com:443]
+//	  - name: ct
+//	    schedule: "@daily"
+//	    ct: [example.com]
+//
+// The warehouse is required, to keep what the jobs find, and
+// expiryWarningDays defaults to 30. The verdict log is optional; it rotates
+// at 100 MB and keeps 10 old files unless told otherwise.
+func ParseDaemonConfig(data []byte) (*DaemonConfig, error) {
+	var raw daemonConfigYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Warehouse == "" {
+		return nil, fmt.Errorf("Daemon configuration has no warehouse")
+	}
+	if raw.ExpiryWarningDays < 0 {
+		return nil, fmt.Errorf("Daemon configuration has negative expiryWarningDays")
+	}
+	if raw.ExpiryWarningDays == 0 {
+		raw.ExpiryWarningDays = 30
+	}
+	config := &DaemonConfig{
+		Warehouse:     raw.Warehouse,
+		ExpiryWarning: time.Duration(raw.ExpiryWarningDays) * 24 * time.Hour,
+	}
+
+	for i, sink := range raw.Alerts {
+		switch {
+		case sink.Webhook != "" && sink.File == "":
+			config.Alerts = append(config.Alerts, &WebhookSink{URL: sink.Webhook, Client: &http.Client{Timeout: defaultJobTimeout}})
+		case sink.File != "" && sink.Webhook == "":
+			config.Alerts = append(config.Alerts, &FileSink{Path: sink.File})
+		default:
+			return nil, fmt.Errorf("Alert sink %d must have exactly one of webhook and file", i)
+		}
+	}
+
+	if raw.VerdictLog != nil {
+		if raw.VerdictLog.Path == "" {
+			return nil, fmt.Errorf("Verdict log has no path")
+		}
+		if raw.VerdictLog.MaxSizeMB < 0 || (raw.VerdictLog.Backups != nil && *raw.VerdictLog.Backups < 0) {
+			return nil, fmt.Errorf("Verdict log has a negative maxSizeMB or backups")
+		}
+		config.VerdictLog = raw.VerdictLog.Path
+		config.VerdictLogMaxSize = defaultVerdictLogMaxSizeMB << 20
+		if raw.VerdictLog.MaxSizeMB > 0 {
+			config.VerdictLogMaxSize = raw.VerdictLog.MaxSizeMB << 20
+		}
+		config.VerdictLogBackups = defaultVerdictLogBackups
+		if raw.VerdictLog.Backups != nil {
+			config.VerdictLogBackups = *raw.VerdictLog.Backups
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, rawJob := range raw.Jobs {
+		if rawJob.Name == "" {
+			return nil, fmt.Errorf("Job %d has no name", i)
+		}
+		if names[rawJob.Name] {
+			return nil, fmt.Errorf("Job %s is defined twice", rawJob.Name)
+		}
+		names[rawJob.Name] = true
+
+		job := DaemonJob{
+			Name:        rawJob.Name,
+			Directories: rawJob.Directories,
+			Endpoints:   rawJob.Endpoints,
+			CTDomains:   rawJob.CT,
+			Timeout:     defaultJobTimeout,
+		}
+		var err error
+		if job.Schedule, err = ParseSchedule(rawJob.Schedule); err != nil {
+			return nil, fmt.Errorf("Job %s: %s", job.Name, err)
+		}
+		if rawJob.Timeout != "" {
+			if job.Timeout, err = time.ParseDuration(rawJob.Timeout); err != nil || job.Timeout <= 0 {
+				return nil, fmt.Errorf("Job %s has invalid timeout %s", job.Name, rawJob.Timeout)
+			}
+		}
+		kinds := 0
+		for _, targets := range [][]string{job.Directories, job.Endpoints, job.CTDomains} {
+			if len(targets) > 0 {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("Job %s must have exactly one of directories, endpoints and ct", job.Name)
+		}
+		config.Jobs = append(config.Jobs, job)
+	}
+	if len(config.Jobs) == 0 {
+		return nil, fmt.Errorf("Daemon configuration has no jobs")
+	}
+	return config, nil
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDaemonConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParseDaemonConfig([]byte(`
+warehouse: /var/lib/gx509/warehouse.json
+alerts:
+  - webhook: https://alerts.example.com/gx509
+  - file: /var/log/gx509/alerts.jsonl
+verdictLog:
+  path: /var/log/gx509/verdicts.jsonl
+  backups: 0
+jobs:
+  - name: pki-share
+    schedule: "0 * * * *"
+    directories: [/srv/pki]
+  - name: edge
+    schedule: "@every 15m"
+    endpoints: [www.example.com:443]
+    timeout: 3s
+  - name: ct
+    schedule: "@daily"
+    ct: [example.com]
+`))
+	if err != nil {
+		t.Fatalf("Could not parse daemon configuration: %s", err)
+	}
+	if config.Warehouse != "/var/lib/gx509/warehouse.json" || config.ExpiryWarning != 30*24*time.Hour {
+		t.Errorf("Unexpected configuration %+v", config)
+	}
+	if config.VerdictLog != "/var/log/gx509/verdicts.jsonl" || config.VerdictLogMaxSize != 100<<20 || config.VerdictLogBackups != 0 {
+		t.Errorf("Unexpected verdict log %s, %d, %d", config.VerdictLog, config.VerdictLogMaxSize, config.VerdictLogBackups)
+	}
+	if webhook, ok := config.Alerts[0].(*WebhookSink); !ok || webhook.URL != "https://alerts.example.com/gx509" {
+		t.Errorf("Expected a webhook sink, got %#v", config.Alerts[0])
+	}
+	if file, ok := config.Alerts[1].(*FileSink); !ok || file.Path != "/var/log/gx509/alerts.jsonl" {
+		t.Errorf("Expected a file sink, got %#v", config.Alerts[1])
+	}
+	if len(config.Jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(config.Jobs))
+	}
+	if job := config.Jobs[0]; !reflect.DeepEqual(job.Directories, []string{"/srv/pki"}) || job.Timeout != defaultJobTimeout || job.Schedule.Spec != "0 * * * *" {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if job := config.Jobs[1]; !reflect.DeepEqual(job.Endpoints, []string{"www.example.com:443"}) || job.Timeout != 3*time.Second {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if job := config.Jobs[2]; !reflect.DeepEqual(job.CTDomains, []string{"example.com"}) {
+		t.Errorf("Unexpected job %+v", job)
+	}
+
+	for _, data := range []string{
+		"jobs:\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+		"warehouse: w.json\n",
+		"warehouse: w.json\njobs:\n  - {name: a, schedule: '@daily'}\n",
+		"warehouse: w.json\njobs:\n  - {name: a, schedule: '@daily', directories: [/], ct: [example.com]}\n",
+		"warehouse: w.json\njobs:\n  - {name: a, schedule: 'daily', directories: [/]}\n",
+		"warehouse: w.json\njobs:\n  - {name: a, schedule: '@daily', directories: [/]}\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+		"warehouse: w.json\nalerts:\n  - {}\njobs:\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+		"warehouse: w.json\njobs:\n  - {name: a, schedule: '@daily', directories: [/], timeout: soon}\n",
+		"warehouse: w.json\nverdictLog: {maxSizeMB: 10}\njobs:\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+		"warehouse: w.json\nverdictLog: {path: v.jsonl, backups: -1}\njobs:\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+		"warehouse: w.json\njob:\n  - {name: a, schedule: '@daily', directories: [/]}\n",
+	} {
+		if _, err := ParseDaemonConfig([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// A DataSet is data built into this package, so that a binary using it
+// needs no files at run time.
+type DataSet struct {
+	Name        string
+	Description string
+	Version     string
+	// File is the embedded file the data set is read from, or empty if it
+	// is compiled from Go, and Contents is that file.
+	File     string
+	Contents []byte
+}
+
+// contentVersion versions data without a version of its own by its digest.
+func contentVersion(contents []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(contents))[:19]
+}
+
+// DataSets returns the data built into this package.
+func DataSets() []DataSet {
+	var policies []string
+	for _, policy := range append(MozillaPolicies, CABRBaseline) {
+		policies = append(policies, fmt.Sprintf("%s from %s", policy.Name, policy.Effective.Format("2006-01-02")))
+	}
+	// An empty log list or OneCRL is a placeholder, not a snapshot of a
+	// day's list
+	ctLogsVersion := "empty"
+	if len(DefaultCTLogList.Logs) > 0 {
+		ctLogsVersion = fmt.Sprintf("%s (%s)", DefaultCTLogList.Version, DefaultCTLogList.Timestamp.Format("2006-01-02"))
+	}
+	oneCRLVersion := "empty"
+	if len(DefaultOneCRL.Entries) > 0 {
+		oneCRLVersion = DefaultOneCRL.Timestamp.Format("2006-01-02")
+	}
+	var profileNames []string
+	for _, profile := range DefaultProfiles.Profiles {
+		profileNames = append(profileNames, profile.Name)
+	}
+	return []DataSet{
+		{
+			Name:        "clients",
+			Description: "Verifier behaviors for the acceptance matrix and issuance simulator",
+			Version:     DefaultKnowledgeBase.Version,
+			File:        "clients.yaml",
+			Contents:    embeddedKnowledgeBase,
+		},
+		{
+			Name:        "owners",
+			Description: "CA owners and the certificates that identify them",
+			Version:     DefaultOwnerTable.Version,
+			File:        "owners.yaml",
+			Contents:    embeddedOwnerTable,
+		},
+		{
+			Name:        "oids",
+			Description: "Names of attribute types, algorithms and curves",
+			Version:     DefaultOIDRegistry.Version,
+			File:        "oids.yaml",
+			Contents:    embeddedOIDRegistry,
+		},
+		{
+			Name:        "ctlogs",
+			Description: fmt.Sprintf("CT log list gx509 sct verifies SCTs against without -logs: %d logs", len(DefaultCTLogList.Logs)),
+			Version:     ctLogsVersion,
+			File:        "ctlogs.json",
+			Contents:    embeddedCTLogList,
+		},
+		{
+			Name:        "onecrl",
+			Description: fmt.Sprintf("OneCRL snapshot gx509.IsInOneCRL checks: %d entries", len(DefaultOneCRL.Entries)),
+			Version:     oneCRLVersion,
+			File:        "onecrl.json",
+			Contents:    embeddedOneCRL,
+		},
+		{
+			Name:        "profiles",
+			Description: "Leaf profiles gx509 simulate -profile starts from: " + strings.Join(profileNames, ", "),
+			Version:     DefaultProfiles.Version,
+			File:        "profiles.yaml",
+			Contents:    embeddedProfiles,
+		},
+		{
+			Name:        "careport-text",
+			Description: "Template of the plain text CA report",
+			Version:     contentVersion([]byte(caReportText)),
+			File:        "careport.txt",
+			Contents:    []byte(caReportText),
+		},
+		{
+			Name:        "careport-html",
+			Description: "Template of the HTML CA report",
+			Version:     contentVersion([]byte(caReportHTML)),
+			File:        "careport.html",
+			Contents:    []byte(caReportHTML),
+		},
+		{
+			Name:        "policies",
+			Description: "When each technical constraint policy took effect, with other cutoffs and TLS lifetime limits: " + strings.Join(policies, ", "),
+			Version:     policyDates.version,
+			File:        "policydates.yaml",
+			Contents:    embeddedPolicyDates,
+		},
+	}
+}
+
+// LookupDataSet returns the data set with the given name.
+func LookupDataSet(name string) (DataSet, bool) {
+	for _, data := range DataSets() {
+		if data.Name == name {
+			return data, true
+		}
+	}
+	return DataSet{}, false
+}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/asn1"
+	"testing"
+)
+
+func TestDataSets(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range DataSets() {
+		if len(data.Version) == 0 || len(data.Description) == 0 {
+			t.Errorf("Expected %s to have a version and description", data.Name)
+		}
+		if len(data.File) > 0 && len(data.Contents) == 0 {
+			t.Errorf("Expected %s to embed %s", data.Name, data.File)
+		}
+	}
+	if data, ok := LookupDataSet("oids"); !ok || data.Version != DefaultOIDRegistry.Version {
+		t.Errorf("Expected to find the OID registry, got %+v", data)
+	}
+	if data, ok := LookupDataSet("ctlogs"); !ok || (len(DefaultCTLogList.Logs) == 0) != (data.Version == "empty") {
+		t.Errorf("Expected to find the CT log list, got %+v", data)
+	}
+	if data, ok := LookupDataSet("onecrl"); !ok || (len(DefaultOneCRL.Entries) == 0) != (data.Version == "empty") {
+		t.Errorf("Expected to find the OneCRL snapshot, got %+v", data)
+	}
+	if data, ok := LookupDataSet("profiles"); !ok || data.Version != DefaultProfiles.Version {
+		t.Errorf("Expected to find the profiles, got %+v", data)
+	}
+	if _, ok := LookupDataSet("nonexistent"); ok {
+		t.Errorf("Expected no data set called nonexistent")
+	}
+}
+
+func TestParseOIDRegistry(t *testing.T) {
+	t.Parallel()
+
+	if name := DefaultOIDRegistry.Name(asn1.ObjectIdentifier{2, 5, 4, 3}); name != "CN" {
+		t.Errorf("Expected CN, got %s", name)
+	}
+	if name := DefaultOIDRegistry.Name(asn1.ObjectIdentifier{1, 2, 3}); name != "1.2.3" {
+		t.Errorf("Expected an unknown OID in dotted form, got %s", name)
+	}
+	for _, data := range []string{
+		"names: {2.5.4.3: CN}\n",
+		"version: \"1\"\nnames: {cn: CN}\n",
+		"version: \"1\"\ncurves: {1.3.132.0.34: [secp384r1]}\n",
+	} {
+		if _, err := ParseOIDRegistry([]byte(data)); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
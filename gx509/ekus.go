@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+var extKeyUsageNames = []struct {
+	name  string
+	usage x509.ExtKeyUsage
+}{
+	{"any", x509.ExtKeyUsageAny},
+	{"serverAuth", x509.ExtKeyUsageServerAuth},
+	{"clientAuth", x509.ExtKeyUsageClientAuth},
+	{"codeSigning", x509.ExtKeyUsageCodeSigning},
+	{"emailProtection", x509.ExtKeyUsageEmailProtection},
+	{"ipsecEndSystem", x509.ExtKeyUsageIPSECEndSystem},
+	{"ipsecTunnel", x509.ExtKeyUsageIPSECTunnel},
+	{"ipsecUser", x509.ExtKeyUsageIPSECUser},
+	{"timeStamping", x509.ExtKeyUsageTimeStamping},
+	{"OCSPSigning", x509.ExtKeyUsageOCSPSigning},
+	{"msServerGatedCrypto", x509.ExtKeyUsageMicrosoftServerGatedCrypto},
+	{"nsServerGatedCrypto", x509.ExtKeyUsageNetscapeServerGatedCrypto},
+}
+
+// ParseExtKeyUsage returns the extended key usage with the given OpenSSL-style
+// short name (e.g. "serverAuth"). Matching is case-insensitive.
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	for _, entry := range extKeyUsageNames {
+		if strings.EqualFold(entry.name, name) {
+			return entry.usage, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown extended key usage: %s", name)
+}
+
+// ExtKeyUsageName returns the short name of an extended key usage.
+func ExtKeyUsageName(usage x509.ExtKeyUsage) string {
+	for _, entry := range extKeyUsageNames {
+		if entry.usage == usage {
+			return entry.name
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", int(usage))
+}
@@ -0,0 +1,166 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash"
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	pbkdf2PRFs = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+
+	pbes2Ciphers = map[string]struct {
+		keySize int
+		block   func(key []byte) (cipher.Block, error)
+	}{
+		"2.16.840.1.101.3.4.1.2":  {16, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.22": {24, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.42": {32, aes.NewCipher},
+		"1.2.840.113549.3.7":      {24, des.NewTripleDESCipher},
+	}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// DecryptPrivateKeyBlock decrypts a PKCS#8 ENCRYPTED PRIVATE KEY block, or a
+// legacy OpenSSL block with Proc-Type and DEK-Info headers, returning the
+// unencrypted block for ParsePrivateKeyBlock. A wrong password is normally
+// reported as x509.IncorrectPasswordError.
+//
+// PKCS#8 keys must use PBES2 with PBKDF2 and AES or triple DES, which is what
+// OpenSSL and most other tools write.
+func DecryptPrivateKeyBlock(block *pem.Block, password []byte) (*pem.Block, error) {
+	if x509.IsEncryptedPEMBlock(block) {
+		der, err := x509.DecryptPEMBlock(block, password)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: block.Type, Bytes: der}, nil
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("Private key is not encrypted")
+	}
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, fmt.Errorf("Could not parse encrypted private key: %s", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("Unsupported private key encryption %s; only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	plaintext, err := decryptPBES2(info.Algorithm.Parameters.FullBytes, info.EncryptedData, password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := asn1.Unmarshal(plaintext, &pkcs8{}); err != nil {
+		return nil, x509.IncorrectPasswordError
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: plaintext}, nil
+}
+
+// decryptPBES2 decrypts ciphertext with PBES2 and the given parameters, as
+// PKCS#8 and PKCS#12 use it.
+func decryptPBES2(parameters, ciphertext, password []byte) ([]byte, error) {
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(parameters, &params); err != nil {
+		return nil, fmt.Errorf("Could not parse PBES2 parameters: %s", err)
+	}
+	if params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		return nil, fmt.Errorf("Unsupported key derivation function scrypt")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("Unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	scheme, ok := pbes2Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported PBES2 cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("Could not parse cipher parameters: %s", err)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("Could not parse PBKDF2 parameters: %s", err)
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		if prf, ok = pbkdf2PRFs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("Unsupported PBKDF2 function %s", kdf.PRF.Algorithm)
+		}
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != scheme.keySize {
+		return nil, fmt.Errorf("PBKDF2 key length %d does not suit the cipher", kdf.KeyLength)
+	}
+
+	key, err := pbkdf2.Key(prf, string(password), kdf.Salt, kdf.IterationCount, scheme.keySize)
+	if err != nil {
+		return nil, err
+	}
+	blockCipher, err := scheme.block(key)
+	if err != nil {
+		return nil, err
+	}
+	return decryptCBC(blockCipher, iv, ciphertext)
+}
+
+// decryptCBC decrypts and unpads ciphertext. As DecryptPEMBlock does, bad
+// padding is taken to mean a bad password.
+func decryptCBC(blockCipher cipher.Block, iv, ciphertext []byte) ([]byte, error) {
+	if len(iv) != blockCipher.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%blockCipher.BlockSize() != 0 {
+		return nil, fmt.Errorf("Encrypted data is malformed")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(blockCipher, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > blockCipher.BlockSize() {
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -0,0 +1,223 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// An Outcome is how a check in an Evidence tree came out.
+type Outcome int
+
+const (
+	// OutcomePassed means the check found what a constrained certificate
+	// needs.
+	OutcomePassed Outcome = iota
+	// OutcomeFailed means it did not.
+	OutcomeFailed
+	// OutcomeSkipped means the check does not apply, because the policy
+	// does not need it or an earlier check settled the verdict.
+	OutcomeSkipped
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomePassed:
+		return "passed"
+	case OutcomeFailed:
+		return "failed"
+	case OutcomeSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// MarshalText encodes the outcome by name, for JSON.
+func (o Outcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// An EvidenceInput is a property of the certificate or policy that a check
+// looked at.
+type EvidenceInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// An Evidence node is one check behind a verdict: what was checked, the
+// inputs it looked at and its outcome, with a sentence saying why. The root
+// node is the verdict itself, and its Children are the checks it rests on,
+// so GUIs can render the tree as an expandable explanation.
+type Evidence struct {
+	Check    string          `json:"check"`
+	Inputs   []EvidenceInput `json:"inputs,omitempty"`
+	Outcome  Outcome         `json:"outcome"`
+	Detail   string          `json:"detail"`
+	Children []*Evidence     `json:"children,omitempty"`
+}
+
+func (e *Evidence) input(name, format string, args ...interface{}) {
+	e.Inputs = append(e.Inputs, EvidenceInput{Name: name, Value: fmt.Sprintf(format, args...)})
+}
+
+// String renders the tree as indented text, one check to a line with its
+// inputs beneath.
+func (e *Evidence) String() string {
+	var b strings.Builder
+	var write func(node *Evidence, depth int)
+	write = func(node *Evidence, depth int) {
+		indent := strings.Repeat("  ", depth)
+		fmt.Fprintf(&b, "%s[%s] %s: %s\n", indent, node.Outcome, node.Check, node.Detail)
+		for _, input := range node.Inputs {
+			fmt.Fprintf(&b, "%s    %s = %s\n", indent, input.Name, input.Value)
+		}
+		for _, child := range node.Children {
+			write(child, depth+1)
+		}
+	}
+	write(e, 0)
+	return b.String()
+}
+
+// listInput formats values for an EvidenceInput, or "none".
+func listInput(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+// ExplainTechnicalConstraints is AnalyzeTechnicalConstraintsForPolicy as a
+// tree of Evidence, in the order the checks are made. Its root passes if
+// cert is technically constrained.
+func ExplainTechnicalConstraints(cert *x509.Certificate, policy Policy) *Evidence {
+	a := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+	root := &Evidence{Check: fmt.Sprintf("Technically constrained under %s", policy.Name), Outcome: OutcomeFailed}
+	root.input("subject", "%s", cert.Subject)
+	root.input("policy", "%s", policy.Name)
+	root.input("policy version", "%s", a.PolicyVersion)
+	root.Detail = a.Details()
+	if a.Constrained {
+		root.Outcome = OutcomePassed
+	}
+	// Once a check settles the verdict, the rest are skipped
+	settled := false
+	add := func(node *Evidence) {
+		if settled {
+			node.Outcome, node.Detail = OutcomeSkipped, "Not reached"
+		}
+		root.Children = append(root.Children, node)
+	}
+
+	var usages []string
+	for _, usage := range cert.ExtKeyUsage {
+		usages = append(usages, ExtKeyUsageName(usage))
+	}
+	node := &Evidence{Check: "extendedKeyUsage present", Outcome: OutcomePassed, Detail: "The purposes the CA can issue for are limited"}
+	if !a.HasExtKeyUsage {
+		node.Outcome, node.Detail = OutcomeFailed, "Without extendedKeyUsage the CA can issue for any purpose"
+	}
+	node.input("extendedKeyUsage", "%s", listInput(usages))
+	add(node)
+	settled = !a.HasExtKeyUsage
+
+	node = &Evidence{Check: "no anyExtendedKeyUsage", Outcome: OutcomePassed, Detail: "anyExtendedKeyUsage is absent"}
+	if a.HasAnyExtKeyUsage {
+		node.Outcome, node.Detail = OutcomeFailed, "anyExtendedKeyUsage lets the CA issue for any purpose"
+	}
+	node.input("anyExtendedKeyUsage", "%t", a.HasAnyExtKeyUsage)
+	add(node)
+	settled = settled || a.HasAnyExtKeyUsage
+
+	serverAuth, email := a.serverAuthCapable(), a.emailCapable()
+	node = &Evidence{Check: "Cannot issue for TLS servers or email", Outcome: OutcomePassed, Detail: "Constrained by purpose alone"}
+	if serverAuth || email {
+		var purposes []string
+		if serverAuth {
+			purposes = append(purposes, "TLS servers")
+		}
+		if email {
+			purposes = append(purposes, "email")
+		}
+		node.Outcome = OutcomeFailed
+		node.Detail = fmt.Sprintf("Can issue for %s, so names must be constrained", strings.Join(purposes, " and "))
+	}
+	node.input("serverAuth", "%t", a.HasServerAuth)
+	node.input("id-Netscape-stepUp", "%t", a.HasStepUp)
+	node.input("stepUp counts as serverAuth", "%t", a.PolicyVersion == PolicyStepUp)
+	node.input("emailProtection", "%t", a.HasEmailProtection)
+	node.input("policy constrains email", "%t", policy.RequireEmailConstraints)
+	add(node)
+	settled = settled || !(serverAuth || email)
+
+	node = &Evidence{Check: "dNSName constraints", Outcome: OutcomeSkipped, Detail: "Cannot issue for TLS servers"}
+	if serverAuth {
+		node.Outcome, node.Detail = OutcomePassed, "dNSName subtrees limit the server names"
+		if !a.HasDNSNameConstraint {
+			node.Outcome, node.Detail = OutcomeFailed, "No dNSName subtrees, so the CA can issue for any server name"
+		}
+	}
+	node.input("permitted dNSName", "%s", listInput(cert.PermittedDNSDomains))
+	node.input("excluded dNSName", "%s", listInput(cert.ExcludedDNSDomains))
+	add(node)
+
+	var permittedIPs, excludedIPs []string
+	for _, cidr := range cert.PermittedIPAddresses {
+		permittedIPs = append(permittedIPs, cidr.String())
+	}
+	for _, cidr := range cert.ExcludedIPAddresses {
+		excludedIPs = append(excludedIPs, cidr.String())
+	}
+	node = &Evidence{Check: "iPAddress constraints", Outcome: OutcomeSkipped, Detail: "Cannot issue for TLS servers"}
+	if serverAuth && !policy.RequireIPConstraints {
+		node.Detail = fmt.Sprintf("%s does not require iPAddress constraints", policy.Name)
+	} else if serverAuth {
+		node.Outcome, node.Detail = OutcomePassed, "iPAddress subtrees limit the server addresses"
+		if !a.HasPermittedIPAddresses && !(a.ExcludesAllIPv4 && a.ExcludesAllIPv6) {
+			node.Outcome = OutcomeFailed
+			node.Detail = "No permitted iPAddress subtrees, nor excluded ones covering all of IPv4 and IPv6"
+		}
+	}
+	node.input("permitted iPAddress", "%s", listInput(permittedIPs))
+	node.input("excluded iPAddress", "%s", listInput(excludedIPs))
+	node.input("excludes all IPv4", "%t", a.ExcludesAllIPv4)
+	node.input("excludes all IPv6", "%t", a.ExcludesAllIPv6)
+	add(node)
+
+	// Constraints that cannot be decoded constrain nothing, as in the
+	// analysis
+	constraints, _ := ParseNameConstraints(cert)
+	var directoryNames []string
+	for _, name := range constraints.PermittedDirectoryNames {
+		if formatted, err := FormatDistinguishedName(name); err == nil {
+			directoryNames = append(directoryNames, formatted)
+		}
+	}
+	node = &Evidence{Check: "rfc822Name constraints", Outcome: OutcomeSkipped, Detail: "Cannot issue for email under this policy"}
+	if email {
+		node.Outcome, node.Detail = OutcomePassed, "Permitted rfc822Name subtrees limit the mailboxes"
+		if !a.HasEmailConstraint {
+			node.Outcome, node.Detail = OutcomeFailed, "No permitted rfc822Name subtrees, so the CA can issue for any mailbox"
+		}
+	}
+	node.input("permitted rfc822Name", "%s", listInput(constraints.PermittedEmailAddresses))
+	add(node)
+
+	node = &Evidence{Check: "directoryName constraints", Outcome: OutcomeSkipped, Detail: "Cannot issue for email under this policy"}
+	if email && !policy.RequireDirectoryNameConstraints {
+		node.Detail = fmt.Sprintf("%s does not require directoryName constraints", policy.Name)
+	} else if email {
+		node.Outcome, node.Detail = OutcomePassed, "Permitted directoryName subtrees limit the subject names"
+		if !a.HasDirectoryNameConstraint {
+			node.Outcome, node.Detail = OutcomeFailed, "No permitted directoryName subtrees, so the CA can issue for any subject"
+		}
+	}
+	node.input("permitted directoryName", "%s", listInput(directoryNames))
+	add(node)
+
+	return root
+}
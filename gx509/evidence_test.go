@@ -0,0 +1,86 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func outcomes(e *Evidence) []Outcome {
+	var result []Outcome
+	for _, child := range e.Children {
+		result = append(result, child.Outcome)
+	}
+	return result
+}
+
+func TestExplainTechnicalConstraints(t *testing.T) {
+	t.Parallel()
+
+	// The issuing CA has serverAuth and dNSName constraints but no
+	// iPAddress ones
+	intermediate := testChain(t, "www.example.com")[1]
+	e := ExplainTechnicalConstraints(intermediate, MozillaPolicy27)
+	expected := []Outcome{OutcomePassed, OutcomePassed, OutcomeFailed, OutcomePassed, OutcomeFailed, OutcomeSkipped, OutcomeSkipped}
+	if e.Outcome != OutcomeFailed || !reflect.DeepEqual(outcomes(e), expected) {
+		t.Errorf("Expected %v under mozilla-2.7, got %s", expected, e)
+	}
+	if input := e.Children[3].Inputs[0]; input.Name != "permitted dNSName" || input.Value != "example.com" {
+		t.Errorf("Unexpected dNSName input %+v", input)
+	}
+
+	e = ExplainTechnicalConstraints(intermediate, MozillaPolicy22)
+	expected = []Outcome{OutcomePassed, OutcomePassed, OutcomeFailed, OutcomePassed, OutcomeSkipped, OutcomeSkipped, OutcomeSkipped}
+	if e.Outcome != OutcomePassed || !reflect.DeepEqual(outcomes(e), expected) {
+		t.Errorf("Expected %v under mozilla-2.2, got %s", expected, e)
+	}
+	if detail := e.Children[4].Detail; detail != "mozilla-2.2 does not require iPAddress constraints" {
+		t.Errorf("Unexpected iPAddress detail %q", detail)
+	}
+
+	// Without extendedKeyUsage nothing else is reached
+	root := testChain(t, "www.example.com")[2]
+	e = ExplainTechnicalConstraints(root, DefaultPolicy)
+	if e.Outcome != OutcomeFailed || e.Children[0].Outcome != OutcomeFailed {
+		t.Errorf("Expected the root to fail on extendedKeyUsage, got %s", e)
+	}
+	for _, child := range e.Children[1:] {
+		if child.Outcome != OutcomeSkipped || child.Detail != "Not reached" {
+			t.Errorf("Expected %s not to be reached, got %s", child.Check, child.Outcome)
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil || !strings.Contains(string(data), `"outcome":"failed"`) {
+		t.Errorf("Unexpected JSON %s (%v)", data, err)
+	}
+}
+
+func TestExplainAgreesWithAnalysis(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	for _, usages := range [][]x509.ExtKeyUsage{
+		nil,
+		{x509.ExtKeyUsageAny, x509.ExtKeyUsageServerAuth},
+		{x509.ExtKeyUsageClientAuth},
+		{x509.ExtKeyUsageEmailProtection},
+		{x509.ExtKeyUsageServerAuth},
+	} {
+		template := *chain[1]
+		template.ExtKeyUsage = usages
+		cert := issueAndParse(t, &template, chain[2])
+		for _, policy := range append(MozillaPolicies, CABRBaseline) {
+			a := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+			if e := ExplainTechnicalConstraints(cert, policy); (e.Outcome == OutcomePassed) != a.Constrained || e.Detail != a.Details() {
+				t.Errorf("%v under %s: explanation disagrees with %+v:\n%s", usages, policy.Name, a, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,720 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	oidExtensionSubjectKeyID          = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage              = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName        = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionIssuerAltName         = asn1.ObjectIdentifier{2, 5, 29, 18}
+	oidExtensionBasicConstraints      = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionAuthorityKeyID        = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionExtendedKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	oidExtensionQCStatements          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+	oidExtensionCTPoison              = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidExtensionNetscapeCertType      = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1}
+	oidExtensionNetscapeComment       = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 13}
+	oidExtensionMSTemplateName        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2}
+	oidExtensionMSTemplate            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 7}
+)
+
+// asn1String decodes the string types used in policy qualifiers.
+func asn1String(value asn1.RawValue) string {
+	if value.Tag == asn1.TagBMPString {
+		var units []uint16
+		for i := 0; i+1 < len(value.Bytes); i += 2 {
+			units = append(units, uint16(value.Bytes[i])<<8|uint16(value.Bytes[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(value.Bytes)
+}
+
+// ipText formats an IP address as openssl does, with IPv6 addresses written
+// out in full.
+func ipText(ip []byte) string {
+	if len(ip) != net.IPv6len {
+		return net.IP(ip).String()
+	}
+	groups := make([]string, 8)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("%X", uint16(ip[2*i])<<8|uint16(ip[2*i+1]))
+	}
+	return strings.Join(groups, ":")
+}
+
+var oidUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+
+// generalNameText formats a GeneralName as openssl does. In name constraints
+// IP addresses are ranges and directory names are not slash-separated.
+func generalNameText(name asn1.RawValue, constraint bool) string {
+	if name.Class != asn1.ClassContextSpecific {
+		return "<invalid>"
+	}
+	switch name.Tag {
+	case 0:
+		var other struct {
+			ID    asn1.ObjectIdentifier
+			Value asn1.RawValue `asn1:"explicit,tag:0"`
+		}
+		if _, err := asn1.UnmarshalWithParams(name.FullBytes, &other, "tag:0"); err == nil && other.ID.Equal(oidUPN) {
+			var upn string
+			if _, err := asn1.Unmarshal(other.Value.FullBytes, &upn); err == nil {
+				return "othername:UPN:" + upn
+			}
+		}
+		return "othername:<unsupported>"
+	case 1:
+		return "email:" + string(name.Bytes)
+	case 2:
+		return "DNS:" + string(name.Bytes)
+	case 3:
+		return "X400Name:<unsupported>"
+	case generalNameDirectoryName:
+		return "DirName:" + formatOpenSSLName(name.Bytes, !constraint)
+	case 5:
+		return "EdiPartyName:<unsupported>"
+	case generalNameURI:
+		return "URI:" + string(name.Bytes)
+	case 7:
+		if constraint && (len(name.Bytes) == 2*net.IPv4len || len(name.Bytes) == 2*net.IPv6len) {
+			half := len(name.Bytes) / 2
+			return "IP:" + ipText(name.Bytes[:half]) + "/" + ipText(name.Bytes[half:])
+		}
+		return "IP Address:" + ipText(name.Bytes)
+	case 8:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(append([]byte{asn1.TagOID, byte(len(name.Bytes))}, name.Bytes...), &oid); err == nil {
+			return "Registered ID:" + oid.String()
+		}
+	}
+	return "<invalid>"
+}
+
+// generalNamesText formats the GeneralNames in a SEQUENCE.
+func generalNamesText(der []byte) ([]string, error) {
+	var names []asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &names); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after names")
+	}
+	var texts []string
+	for _, name := range names {
+		texts = append(texts, generalNameText(name, false))
+	}
+	return texts, nil
+}
+
+var keyUsageNames = []string{
+	"Digital Signature", "Non Repudiation", "Key Encipherment", "Data Encipherment",
+	"Key Agreement", "Certificate Sign", "CRL Sign", "Encipher Only", "Decipher Only",
+}
+
+var extKeyUsageTextNames = map[string]string{
+	"1.3.6.1.5.5.7.3.1":      "TLS Web Server Authentication",
+	"1.3.6.1.5.5.7.3.2":      "TLS Web Client Authentication",
+	"1.3.6.1.5.5.7.3.3":      "Code Signing",
+	"1.3.6.1.5.5.7.3.4":      "E-mail Protection",
+	"1.3.6.1.5.5.7.3.5":      "IPSec End System",
+	"1.3.6.1.5.5.7.3.6":      "IPSec Tunnel",
+	"1.3.6.1.5.5.7.3.7":      "IPSec User",
+	"1.3.6.1.5.5.7.3.8":      "Time Stamping",
+	"1.3.6.1.5.5.7.3.9":      "OCSP Signing",
+	"2.5.29.37.0":            "Any Extended Key Usage",
+	"1.3.6.1.4.1.311.2.1.21": "Microsoft Individual Code Signing",
+	"1.3.6.1.4.1.311.2.1.22": "Microsoft Commercial Code Signing",
+	"1.3.6.1.4.1.311.10.3.3": "Microsoft Server Gated Crypto",
+	"1.3.6.1.4.1.311.10.3.4": "Microsoft Encrypted File System",
+	"1.3.6.1.4.1.311.20.2.2": "Microsoft Smartcard Login",
+	"2.16.840.1.113730.4.1":  "Netscape Server Gated Crypto",
+}
+
+var crlReasonNames = []string{
+	"Unused", "Key Compromise", "CA Compromise", "Affiliation Changed",
+	"Superseded", "Cessation Of Operation", "Certificate Hold", "Privilege Withdrawn",
+	"AA Compromise",
+}
+
+type crlDistributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+	Reasons           asn1.BitString        `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue         `asn1:"optional,tag:2"`
+}
+
+type policyQualifierInfo struct {
+	ID        asn1.ObjectIdentifier
+	Qualifier asn1.RawValue
+}
+
+var (
+	oidCPSQualifier        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidUserNoticeQualifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// An ExtensionDecoder names an extension, as openssl does where openssl knows
+// it, and decodes its value into lines of text.
+type ExtensionDecoder struct {
+	Name   string
+	Decode func(value []byte) ([]string, error)
+}
+
+// unmarshalAll is asn1.Unmarshal, refusing trailing data.
+func unmarshalAll(der []byte, value interface{}) error {
+	if rest, err := asn1.Unmarshal(der, value); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return fmt.Errorf("Trailing data")
+	}
+	return nil
+}
+
+// ExtensionDecoders are the extensions gx509 can decode, by dotted OID.
+var ExtensionDecoders = map[string]ExtensionDecoder{
+	oidExtensionSubjectKeyID.String(): {"X509v3 Subject Key Identifier", func(value []byte) ([]string, error) {
+		var id []byte
+		if err := unmarshalAll(value, &id); err != nil {
+			return nil, err
+		}
+		return []string{colonHex(id, true)}, nil
+	}},
+	oidExtensionAuthorityKeyID.String(): {"X509v3 Authority Key Identifier", func(value []byte) ([]string, error) {
+		var aki struct {
+			ID     []byte        `asn1:"optional,tag:0"`
+			Issuer asn1.RawValue `asn1:"optional,tag:1"`
+			Serial *big.Int      `asn1:"optional,tag:2"`
+		}
+		if err := unmarshalAll(value, &aki); err != nil {
+			return nil, err
+		}
+		var lines []string
+		if len(aki.ID) > 0 {
+			lines = append(lines, colonHex(aki.ID, true))
+		}
+		if len(aki.Issuer.Bytes) > 0 {
+			names, err := generalNamesText(append([]byte{0x30}, aki.Issuer.FullBytes[1:]...))
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, names...)
+		}
+		if aki.Serial != nil {
+			lines = append(lines, "serial:"+colonHex(aki.Serial.Bytes(), true))
+		}
+		return lines, nil
+	}},
+	oidExtensionBasicConstraints.String(): {"X509v3 Basic Constraints", func(value []byte) ([]string, error) {
+		var bc struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+		if err := unmarshalAll(value, &bc); err != nil {
+			return nil, err
+		}
+		text := "CA:FALSE"
+		if bc.IsCA {
+			text = "CA:TRUE"
+		}
+		if bc.MaxPathLen >= 0 {
+			text += fmt.Sprintf(", pathlen:%d", bc.MaxPathLen)
+		}
+		return []string{text}, nil
+	}},
+	oidExtensionKeyUsage.String(): {"X509v3 Key Usage", func(value []byte) ([]string, error) {
+		var bits asn1.BitString
+		if err := unmarshalAll(value, &bits); err != nil {
+			return nil, err
+		}
+		var usages []string
+		for i, name := range keyUsageNames {
+			if bits.At(i) != 0 {
+				usages = append(usages, name)
+			}
+		}
+		return []string{strings.Join(usages, ", ")}, nil
+	}},
+	oidExtensionExtendedKeyUsage.String(): {"X509v3 Extended Key Usage", func(value []byte) ([]string, error) {
+		var oids []asn1.ObjectIdentifier
+		if err := unmarshalAll(value, &oids); err != nil {
+			return nil, err
+		}
+		var usages []string
+		for _, oid := range oids {
+			if name, ok := extKeyUsageTextNames[oid.String()]; ok {
+				usages = append(usages, name)
+			} else {
+				usages = append(usages, oid.String())
+			}
+		}
+		return []string{strings.Join(usages, ", ")}, nil
+	}},
+	oidExtensionSubjectAltName.String(): {"X509v3 Subject Alternative Name", func(value []byte) ([]string, error) {
+		names, err := generalNamesText(value)
+		return []string{strings.Join(names, ", ")}, err
+	}},
+	oidExtensionIssuerAltName.String(): {"X509v3 Issuer Alternative Name", func(value []byte) ([]string, error) {
+		names, err := generalNamesText(value)
+		return []string{strings.Join(names, ", ")}, err
+	}},
+	oidExtensionCertificatePolicies.String(): {"X509v3 Certificate Policies", func(value []byte) ([]string, error) {
+		var policies []policyInformation
+		if err := unmarshalAll(value, &policies); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, policy := range policies {
+			if policy.Policy.Equal(OIDAnyPolicy) {
+				lines = append(lines, "Policy: X509v3 Any Policy")
+			} else {
+				lines = append(lines, "Policy: "+policy.Policy.String())
+			}
+			if len(policy.Qualifiers.FullBytes) == 0 {
+				continue
+			}
+			var qualifiers []policyQualifierInfo
+			if err := unmarshalAll(policy.Qualifiers.FullBytes, &qualifiers); err != nil {
+				return nil, err
+			}
+			for _, qualifier := range qualifiers {
+				switch {
+				case qualifier.ID.Equal(oidCPSQualifier):
+					lines = append(lines, "  CPS: "+string(qualifier.Qualifier.Bytes))
+				case qualifier.ID.Equal(oidUserNoticeQualifier):
+					lines = append(lines, "  User Notice:")
+					rest := qualifier.Qualifier.Bytes
+					for len(rest) > 0 {
+						var field asn1.RawValue
+						var err error
+						if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+							return nil, err
+						}
+						if field.Tag != asn1.TagSequence {
+							lines = append(lines, "    Explicit Text: "+asn1String(field))
+							continue
+						}
+						var ref struct {
+							Organization asn1.RawValue
+							Numbers      []int
+						}
+						if err := unmarshalAll(field.FullBytes, &ref); err != nil {
+							return nil, err
+						}
+						var numbers []string
+						for _, number := range ref.Numbers {
+							numbers = append(numbers, fmt.Sprint(number))
+						}
+						lines = append(lines, "    Organization: "+asn1String(ref.Organization))
+						if len(numbers) == 1 {
+							lines = append(lines, "    Number: "+numbers[0])
+						} else {
+							lines = append(lines, "    Numbers: "+strings.Join(numbers, ", "))
+						}
+					}
+				default:
+					lines = append(lines, "  Unknown Qualifier: "+qualifier.ID.String())
+				}
+			}
+		}
+		return lines, nil
+	}},
+	oidExtensionCRLDistributionPoints.String(): {"X509v3 CRL Distribution Points", func(value []byte) ([]string, error) {
+		var points []crlDistributionPoint
+		if err := unmarshalAll(value, &points); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for i, point := range points {
+			if i > 0 {
+				lines = append(lines, "")
+			}
+			if len(point.DistributionPoint.FullName) > 0 {
+				lines = append(lines, "Full Name:")
+				for _, name := range point.DistributionPoint.FullName {
+					lines = append(lines, "  "+generalNameText(name, false))
+				}
+			}
+			if len(point.DistributionPoint.RelativeName) > 0 {
+				der, _ := asn1.Marshal(point.DistributionPoint.RelativeName)
+				lines = append(lines, "Relative Name:", "  "+formatOpenSSLName(der, false))
+			}
+			if point.Reasons.BitLength > 0 {
+				var reasons []string
+				for bit, name := range crlReasonNames {
+					if point.Reasons.At(bit) != 0 {
+						reasons = append(reasons, name)
+					}
+				}
+				lines = append(lines, "Reasons: "+strings.Join(reasons, ", "))
+			}
+			if len(point.CRLIssuer.Bytes) > 0 {
+				names, err := generalNamesText(append([]byte{0x30}, point.CRLIssuer.FullBytes[1:]...))
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, "CRL Issuer:")
+				for _, name := range names {
+					lines = append(lines, "  "+name)
+				}
+			}
+		}
+		return lines, nil
+	}},
+	oidExtensionAuthorityInfoAccess.String(): {"Authority Information Access", func(value []byte) ([]string, error) {
+		var descriptions []struct {
+			Method   asn1.ObjectIdentifier
+			Location asn1.RawValue
+		}
+		if err := unmarshalAll(value, &descriptions); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, description := range descriptions {
+			method := description.Method.String()
+			switch method {
+			case "1.3.6.1.5.5.7.48.1":
+				method = "OCSP"
+			case "1.3.6.1.5.5.7.48.2":
+				method = "CA Issuers"
+			}
+			lines = append(lines, method+" - "+generalNameText(description.Location, false))
+		}
+		return lines, nil
+	}},
+	oidExtensionNameConstraints.String(): {"X509v3 Name Constraints", func(value []byte) ([]string, error) {
+		var constraints nameConstraintsASN1
+		if err := unmarshalAll(value, &constraints); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, group := range []struct {
+			heading  string
+			subtrees []generalSubtree
+		}{{"Permitted:", constraints.Permitted}, {"Excluded:", constraints.Excluded}} {
+			if len(group.subtrees) == 0 {
+				continue
+			}
+			lines = append(lines, group.heading)
+			for _, subtree := range group.subtrees {
+				lines = append(lines, "  "+generalNameText(subtree.Base, true))
+			}
+		}
+		return lines, nil
+	}},
+	oidExtensionPolicyConstraints.String(): {"X509v3 Policy Constraints", func(value []byte) ([]string, error) {
+		constraints, err := ParsePolicyConstraints(&x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionPolicyConstraints, Value: value}}})
+		return []string{constraints.String()}, err
+	}},
+	oidExtensionPolicyMappings.String(): {"X509v3 Policy Mappings", func(value []byte) ([]string, error) {
+		constraints, err := ParsePolicyConstraints(&x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionPolicyMappings, Value: value}}})
+		return []string{constraints.String()}, err
+	}},
+	oidExtensionInhibitAnyPolicy.String(): {"X509v3 Inhibit Any Policy", func(value []byte) ([]string, error) {
+		var skip int
+		err := unmarshalAll(value, &skip)
+		return []string{fmt.Sprint(skip)}, err
+	}},
+	oidExtensionSCTList.String():      {"CT Precertificate SCTs", decodeSCTList},
+	oidExtensionCTPoison.String():     {"CT Precertificate Poison", decodeNull},
+	oidExtensionQCStatements.String(): {"qcStatements", decodeQCStatements},
+	oidExtensionNetscapeComment.String(): {"Netscape Comment", func(value []byte) ([]string, error) {
+		var comment asn1.RawValue
+		err := unmarshalAll(value, &comment)
+		return []string{asn1String(comment)}, err
+	}},
+	oidExtensionNetscapeCertType.String(): {"Netscape Cert Type", func(value []byte) ([]string, error) {
+		var bits asn1.BitString
+		if err := unmarshalAll(value, &bits); err != nil {
+			return nil, err
+		}
+		var types []string
+		for i, name := range netscapeCertTypeNames {
+			if bits.At(i) != 0 {
+				types = append(types, name)
+			}
+		}
+		return []string{strings.Join(types, ", ")}, nil
+	}},
+	oidExtensionMSTemplateName.String(): {"Microsoft Certificate Template Name", func(value []byte) ([]string, error) {
+		var name asn1.RawValue
+		err := unmarshalAll(value, &name)
+		return []string{asn1String(name)}, err
+	}},
+	oidExtensionMSTemplate.String(): {"Microsoft Certificate Template", func(value []byte) ([]string, error) {
+		var template struct {
+			ID    asn1.ObjectIdentifier
+			Major int
+			Minor int `asn1:"optional"`
+		}
+		if err := unmarshalAll(value, &template); err != nil {
+			return nil, err
+		}
+		return []string{
+			"Template: " + template.ID.String(),
+			fmt.Sprintf("Major Version: %d", template.Major),
+			fmt.Sprintf("Minor Version: %d", template.Minor),
+		}, nil
+	}},
+}
+
+var netscapeCertTypeNames = []string{
+	"SSL Client", "SSL Server", "S/MIME", "Object Signing",
+	"Unused", "SSL CA", "S/MIME CA", "Object Signing CA",
+}
+
+func decodeNull(value []byte) ([]string, error) {
+	var null asn1.RawValue
+	if err := unmarshalAll(value, &null); err != nil {
+		return nil, err
+	} else if null.Tag != asn1.TagNull || len(null.Bytes) > 0 {
+		return nil, fmt.Errorf("Not NULL")
+	}
+	return []string{"NULL"}, nil
+}
+
+var sctHashNames = []string{"none", "md5", "sha1", "sha224", "sha256", "sha384", "sha512"}
+
+// sctSignatureName names the algorithm of an SCT's signature as openssl
+// does.
+func sctSignatureName(hash, signature byte) string {
+	if int(hash) < len(sctHashNames) {
+		name := sctHashNames[hash]
+		switch signature {
+		case 1:
+			return name + "WithRSAEncryption"
+		case 3:
+			return "ecdsa-with-" + strings.ToUpper(name)
+		}
+	}
+	return fmt.Sprintf("hash %d, signature %d", hash, signature)
+}
+
+// decodeSCTList decodes the SCTs in an SCT list extension as openssl does.
+func decodeSCTList(value []byte) ([]string, error) {
+	scts, err := ParseSCTList(value)
+	if err != nil {
+		return nil, err
+	}
+	const continuation = "                "
+	hexLines := func(label string, b []byte) []string {
+		var lines []string
+		for i, line := range hexBlock(b, 16) {
+			if i == 0 {
+				lines = append(lines, label+strings.ToUpper(line))
+			} else {
+				lines = append(lines, continuation+strings.ToUpper(line))
+			}
+		}
+		return lines
+	}
+
+	var lines []string
+	for _, sct := range scts {
+		lines = append(lines, "Signed Certificate Timestamp:")
+		lines = append(lines, fmt.Sprintf("    Version   : v%d (0x%x)", sct.Version+1, sct.Version))
+		lines = append(lines, hexLines("    Log ID    : ", sct.LogID[:])...)
+		lines = append(lines, "    Timestamp : "+sct.Timestamp.Format("Jan _2 15:04:05.000 2006 GMT"))
+		if len(sct.Extensions) == 0 {
+			lines = append(lines, "    Extensions: none")
+		} else {
+			lines = append(lines, hexLines("    Extensions: ", sct.Extensions)...)
+		}
+		lines = append(lines, "    Signature : "+sctSignatureName(sct.HashAlgorithm, sct.SignatureAlgorithm))
+		lines = append(lines, hexLines(continuation, sct.Signature)...)
+	}
+	return lines, nil
+}
+
+var qcTypeNames = map[string]string{
+	"0.4.0.1862.1.6.1": "esign",
+	"0.4.0.1862.1.6.2": "eseal",
+	"0.4.0.1862.1.6.3": "web",
+}
+
+// decodeQCStatements decodes the statements of ETSI EN 319 412-5 and RFC
+// 3739 in a qcStatements extension, one to a line.
+func decodeQCStatements(value []byte) ([]string, error) {
+	var statements []struct {
+		ID   asn1.ObjectIdentifier
+		Info asn1.RawValue `asn1:"optional"`
+	}
+	if err := unmarshalAll(value, &statements); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, statement := range statements {
+		switch statement.ID.String() {
+		case "0.4.0.1862.1.1":
+			lines = append(lines, "QcCompliance")
+		case "0.4.0.1862.1.2":
+			var limit struct {
+				Currency asn1.RawValue
+				Amount   int
+				Exponent int
+			}
+			if err := unmarshalAll(statement.Info.FullBytes, &limit); err != nil {
+				return nil, err
+			}
+			currency := string(limit.Currency.Bytes)
+			if limit.Currency.Tag == asn1.TagInteger {
+				currency = new(big.Int).SetBytes(limit.Currency.Bytes).String()
+			}
+			lines = append(lines, fmt.Sprintf("QcLimitValue: %d * 10^%d %s", limit.Amount, limit.Exponent, currency))
+		case "0.4.0.1862.1.3":
+			var years int
+			if err := unmarshalAll(statement.Info.FullBytes, &years); err != nil {
+				return nil, err
+			}
+			lines = append(lines, fmt.Sprintf("QcRetentionPeriod: %d years", years))
+		case "0.4.0.1862.1.4":
+			lines = append(lines, "QcSSCD")
+		case "0.4.0.1862.1.5":
+			var locations []struct {
+				URL      string
+				Language string
+			}
+			if err := unmarshalAll(statement.Info.FullBytes, &locations); err != nil {
+				return nil, err
+			}
+			for _, location := range locations {
+				lines = append(lines, fmt.Sprintf("QcPDS: %s (%s)", location.URL, location.Language))
+			}
+		case "0.4.0.1862.1.6":
+			var types []asn1.ObjectIdentifier
+			if err := unmarshalAll(statement.Info.FullBytes, &types); err != nil {
+				return nil, err
+			}
+			var names []string
+			for _, oid := range types {
+				if name, ok := qcTypeNames[oid.String()]; ok {
+					names = append(names, name)
+				} else {
+					names = append(names, oid.String())
+				}
+			}
+			lines = append(lines, "QcType: "+strings.Join(names, ", "))
+		case "1.3.6.1.5.5.7.11.1":
+			lines = append(lines, "QcSyntaxV1")
+		case "1.3.6.1.5.5.7.11.2":
+			lines = append(lines, "QcSyntaxV2")
+		case "0.4.0.19495.2":
+			lines = append(lines, "PSD2")
+		default:
+			lines = append(lines, statement.ID.String())
+		}
+	}
+	return lines, nil
+}
+
+// A DecodedExtension is an extension as text.
+type DecodedExtension struct {
+	Id       asn1.ObjectIdentifier
+	Name     string
+	Critical bool
+	// Known is whether there is a decoder for the extension. If not, or if
+	// Err is set, Lines are a hex dump of its value.
+	Known bool
+	// Duplicate is whether another extension of the certificate has the same
+	// OID, which RFC 5280 forbids.
+	Duplicate bool
+	Lines     []string
+	Err       error
+}
+
+// extensionName names the extension id, by its decoder's name if it has one.
+func extensionName(id asn1.ObjectIdentifier) string {
+	if decoder, ok := ExtensionDecoders[id.String()]; ok {
+		return decoder.Name
+	}
+	return id.String()
+}
+
+// duplicateExtensions returns the OIDs that appear more than once among
+// extensions, in order of first appearance, with how often each does.
+func duplicateExtensions(extensions []pkix.Extension) ([]asn1.ObjectIdentifier, map[string]int) {
+	counts := make(map[string]int)
+	var duplicates []asn1.ObjectIdentifier
+	for _, ext := range extensions {
+		if counts[ext.Id.String()]++; counts[ext.Id.String()] == 2 {
+			duplicates = append(duplicates, ext.Id)
+		}
+	}
+	return duplicates, counts
+}
+
+// ExtensionOrder names cert's extensions in the order they are encoded.
+func ExtensionOrder(cert *x509.Certificate) []string {
+	names := make([]string, len(cert.Extensions))
+	for i, ext := range cert.Extensions {
+		names[i] = extensionName(ext.Id)
+	}
+	return names
+}
+
+// DecodeExtension decodes ext with its decoder in ExtensionDecoders, falling
+// back to a hex dump if it has none or it cannot be decoded.
+func DecodeExtension(ext pkix.Extension) DecodedExtension {
+	decoded := DecodedExtension{Id: ext.Id, Name: ext.Id.String(), Critical: ext.Critical}
+	if decoder, ok := ExtensionDecoders[ext.Id.String()]; ok {
+		decoded.Name, decoded.Known = decoder.Name, true
+		if decoded.Lines, decoded.Err = decoder.Decode(ext.Value); decoded.Err == nil {
+			return decoded
+		}
+		decoded.Err = fmt.Errorf("Could not decode %s: %s", decoder.Name, decoded.Err)
+	}
+	decoded.Lines = HexDump(ext.Value)
+	return decoded
+}
+
+// DecodeExtensions decodes every extension in cert, in order.
+func DecodeExtensions(cert *x509.Certificate) []DecodedExtension {
+	_, counts := duplicateExtensions(cert.Extensions)
+	decoded := make([]DecodedExtension, len(cert.Extensions))
+	for i, ext := range cert.Extensions {
+		decoded[i] = DecodeExtension(ext)
+		decoded[i].Duplicate = counts[ext.Id.String()] > 1
+	}
+	return decoded
+}
+
+// HexDump formats b in the layout of openssl's BIO_dump, sixteen bytes to a
+// line with their offset and the printable characters among them.
+func HexDump(b []byte) []string {
+	var lines []string
+	for offset := 0; offset < len(b); offset += 16 {
+		chunk := b[offset:]
+		if len(chunk) > 16 {
+			chunk = chunk[:16]
+		}
+		var line strings.Builder
+		fmt.Fprintf(&line, "%04x - ", offset)
+		for i := 0; i < 16; i++ {
+			if i >= len(chunk) {
+				line.WriteString("   ")
+				continue
+			}
+			separator := ' '
+			if i == 7 && len(chunk) > 8 {
+				separator = '-'
+			}
+			fmt.Fprintf(&line, "%02x%c", chunk[i], separator)
+		}
+		line.WriteString("  " + printableText(chunk))
+		lines = append(lines, line.String())
+	}
+	return lines
+}
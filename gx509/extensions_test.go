@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testSCTList is an SCT list extension holding one SCT with a made-up log
+// and signature.
+func testSCTList(t *testing.T) []byte {
+	withLength := func(b []byte) []byte {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(b)))
+		return append(length, b...)
+	}
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, 1520000000123)
+
+	sct := append([]byte{0}, bytes.Repeat([]byte{0xab}, 32)...)
+	sct = append(sct, timestamp...)
+	sct = append(sct, 0, 0, 4, 3, 0, 4, 0x30, 0x02, 0x05, 0x00)
+	value, err := asn1.Marshal(withLength(withLength(sct)))
+	if err != nil {
+		t.Fatalf("Could not marshal SCT list: %s", err)
+	}
+	return value
+}
+
+func TestDecodeExtension(t *testing.T) {
+	t.Parallel()
+
+	mustMarshal := func(value interface{}) []byte {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatalf("Could not marshal %v: %s", value, err)
+		}
+		return der
+	}
+	type qcStatement struct {
+		ID   asn1.ObjectIdentifier
+		Info asn1.RawValue `asn1:"optional"`
+	}
+	qcType := mustMarshal([]asn1.ObjectIdentifier{{0, 4, 0, 1862, 1, 6, 3}})
+	qcPDS := mustMarshal([]struct {
+		URL      string `asn1:"ia5"`
+		Language string `asn1:"printable"`
+	}{{"https://example.com/pds", "en"}})
+
+	for _, test := range []struct {
+		ext      pkix.Extension
+		name     string
+		expected []string
+	}{
+		{pkix.Extension{Id: oidExtensionSCTList, Value: testSCTList(t)}, "CT Precertificate SCTs", []string{
+			"Signed Certificate Timestamp:",
+			"    Version   : v1 (0x0)",
+			"    Log ID    : AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:",
+			"                AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB:AB",
+			"    Timestamp : Mar  2 14:13:20.123 2018 GMT",
+			"    Extensions: none",
+			"    Signature : ecdsa-with-SHA256",
+			"                30:02:05:00",
+		}},
+		{pkix.Extension{Id: oidExtensionCTPoison, Value: []byte{0x05, 0x00}}, "CT Precertificate Poison", []string{"NULL"}},
+		{pkix.Extension{Id: oidExtensionQCStatements, Value: mustMarshal([]qcStatement{
+			{ID: asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}},
+			{ID: asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}, Info: asn1.RawValue{FullBytes: qcType}},
+			{ID: asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 5}, Info: asn1.RawValue{FullBytes: qcPDS}},
+		})}, "qcStatements", []string{"QcCompliance", "QcType: web", "QcPDS: https://example.com/pds (en)"}},
+		{pkix.Extension{Id: oidExtensionNetscapeCertType, Value: []byte{0x03, 0x02, 0x02, 0x64}}, "Netscape Cert Type", []string{"SSL Server, S/MIME, SSL CA"}},
+		{pkix.Extension{Id: oidExtensionMSTemplate, Value: mustMarshal(struct {
+			ID           asn1.ObjectIdentifier
+			Major, Minor int
+		}{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8, 1}, 100, 4})}, "Microsoft Certificate Template", []string{
+			"Template: 1.3.6.1.4.1.311.21.8.1",
+			"Major Version: 100",
+			"Minor Version: 4",
+		}},
+		{pkix.Extension{Id: oidExtensionMSTemplateName, Value: []byte{0x1e, 0x04, 0x00, 0x57, 0x00, 0x53}}, "Microsoft Certificate Template Name", []string{"WS"}},
+		{pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 99}, Value: []byte("\x0c\x13seventeen bytes!!!!")}, "1.2.3.99", []string{
+			"0000 - 0c 13 73 65 76 65 6e 74-65 65 6e 20 62 79 74 65   ..seventeen byte",
+			"0010 - 73 21 21 21 21                                    s!!!!",
+		}},
+	} {
+		decoded := DecodeExtension(test.ext)
+		if decoded.Err != nil {
+			t.Errorf("Could not decode %s: %s", test.name, decoded.Err)
+		}
+		if decoded.Name != test.name || !reflect.DeepEqual(decoded.Lines, test.expected) {
+			t.Errorf("Expected %s as %q, got %s as %q", test.name, test.expected, decoded.Name, decoded.Lines)
+		}
+	}
+
+	// Extensions that cannot be decoded fall back to a hex dump
+	decoded := DecodeExtension(pkix.Extension{Id: oidExtensionSCTList, Value: []byte{0x04, 0x01, 0x00}})
+	if decoded.Err == nil || !decoded.Known || !reflect.DeepEqual(decoded.Lines, []string{"0000 - 04 01 00                                          ..."}) {
+		t.Errorf("Expected a hex dump and an error for a truncated SCT list, got %q (%v)", decoded.Lines, decoded.Err)
+	}
+}
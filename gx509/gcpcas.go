@@ -0,0 +1,308 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GoogleCAS reads the CA pools of a location in Google Certificate Authority
+// Service through its REST API.
+type GoogleCAS struct {
+	Project  string
+	Location string
+	// Token is an OAuth 2.0 access token, as printed by
+	// 'gcloud auth print-access-token'.
+	Token string
+	// Endpoint defaults to the public v1 API.
+	Endpoint string
+	Client   *http.Client
+
+	templates map[string]gcpIssuancePolicy
+}
+
+// NewGoogleCAS returns a client for the CA pools of project in location.
+func NewGoogleCAS(project, location, token string) *GoogleCAS {
+	return &GoogleCAS{
+		Project:  project,
+		Location: location,
+		Token:    token,
+		Endpoint: "https://privateca.googleapis.com/v1/",
+		Client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// get decodes the resource at path, relative to the endpoint, into output.
+func (g *GoogleCAS) get(path string, query url.Values, output interface{}) error {
+	target := strings.TrimSuffix(g.Endpoint, "/") + "/" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.Token)
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) != nil || len(failure.Error.Status) == 0 {
+			return fmt.Errorf("Certificate Authority Service returned %s for %s", resp.Status, path)
+		}
+		return fmt.Errorf("Certificate Authority Service returned %s for %s: %s", failure.Error.Status, path, failure.Error.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("Could not decode Certificate Authority Service response for %s: %s", path, err)
+	}
+	return nil
+}
+
+// list returns every page of the collection at path, which the responses
+// hold in field.
+func (g *GoogleCAS) list(path, field string, query url.Values) ([]json.RawMessage, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	var items []json.RawMessage
+	for {
+		var page map[string]json.RawMessage
+		if err := g.get(path, query, &page); err != nil {
+			return nil, err
+		}
+		if data, ok := page[field]; ok {
+			var pageItems []json.RawMessage
+			if err := json.Unmarshal(data, &pageItems); err != nil {
+				return nil, fmt.Errorf("Could not decode %s of %s: %s", field, path, err)
+			}
+			items = append(items, pageItems...)
+		}
+		var token string
+		if data, ok := page["nextPageToken"]; ok {
+			json.Unmarshal(data, &token)
+		}
+		if len(token) == 0 {
+			return items, nil
+		}
+		query.Set("pageToken", token)
+	}
+}
+
+// A gcpIssuancePolicy is the part of a CA pool's issuance policy, or a
+// certificate template, that decides what requesters can put in
+// certificates.
+type gcpIssuancePolicy struct {
+	IdentityConstraints *struct {
+		CELExpression *struct {
+			Expression string `json:"expression"`
+		} `json:"celExpression"`
+		AllowSubjectAltNamesPassthrough bool `json:"allowSubjectAltNamesPassthrough"`
+	} `json:"identityConstraints"`
+	PassthroughExtensions *struct {
+		KnownExtensions      []string `json:"knownExtensions"`
+		AdditionalExtensions []struct {
+			ObjectIDPath []int `json:"objectIdPath"`
+		} `json:"additionalExtensions"`
+	} `json:"passthroughExtensions"`
+	// Pools have baselineValues and templates predefinedValues
+	BaselineValues   *gcpX509Parameters `json:"baselineValues"`
+	PredefinedValues *gcpX509Parameters `json:"predefinedValues"`
+}
+
+type gcpX509Parameters struct {
+	CAOptions *struct {
+		IsCA bool `json:"isCa"`
+	} `json:"caOptions"`
+}
+
+// risks describes what the policy lets requesters put in certificates.
+func (p gcpIssuancePolicy) risks() []string {
+	var risks []string
+	for _, values := range []*gcpX509Parameters{p.BaselineValues, p.PredefinedValues} {
+		if values != nil && values.CAOptions != nil && values.CAOptions.IsCA {
+			risks = append(risks, "issues CA certificates")
+		}
+	}
+	if constraints := p.IdentityConstraints; constraints != nil && constraints.CELExpression == nil {
+		if constraints.AllowSubjectAltNamesPassthrough {
+			risks = append(risks, "copies subject alternative names from requests without a CEL expression restricting them")
+		}
+	}
+	if extensions := p.PassthroughExtensions; extensions != nil {
+		passed := append([]string(nil), extensions.KnownExtensions...)
+		for _, extension := range extensions.AdditionalExtensions {
+			var arcs []string
+			for _, arc := range extension.ObjectIDPath {
+				arcs = append(arcs, fmt.Sprint(arc))
+			}
+			passed = append(passed, strings.Join(arcs, "."))
+		}
+		if len(passed) > 0 {
+			risks = append(risks, "copies extensions from requests: "+strings.Join(passed, ", "))
+		}
+	}
+	return risks
+}
+
+// Provider is "gcp-cas".
+func (g *GoogleCAS) Provider() string {
+	return "gcp-cas"
+}
+
+// pools returns the names of the location's CA pools, with the risks of
+// their issuance policies.
+func (g *GoogleCAS) pools() ([]string, map[string][]string, error) {
+	items, err := g.list(fmt.Sprintf("projects/%s/locations/%s/caPools", g.Project, g.Location), "caPools", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	risks := make(map[string][]string)
+	for _, item := range items {
+		var pool struct {
+			Name           string             `json:"name"`
+			IssuancePolicy *gcpIssuancePolicy `json:"issuancePolicy"`
+		}
+		if err := json.Unmarshal(item, &pool); err != nil {
+			return nil, nil, fmt.Errorf("Could not decode CA pool: %s", err)
+		}
+		names = append(names, pool.Name)
+		if pool.IssuancePolicy == nil {
+			risks[pool.Name] = []string{"its pool has no issuance policy, so it issues whatever is requested"}
+		} else {
+			risks[pool.Name] = pool.IssuancePolicy.risks()
+		}
+	}
+	return names, risks, nil
+}
+
+// CertificateAuthorities returns the CAs in the location's pools, with the
+// risks of their pool's issuance policy. The Status of each is ENABLED,
+// DISABLED, STAGED and so on.
+func (g *GoogleCAS) CertificateAuthorities() ([]CloudCertificateAuthority, error) {
+	pools, poolRisks, err := g.pools()
+	if err != nil {
+		return nil, err
+	}
+	var cas []CloudCertificateAuthority
+	for _, pool := range pools {
+		items, err := g.list(pool+"/certificateAuthorities", "certificateAuthorities", nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var entry struct {
+				Name              string   `json:"name"`
+				Type              string   `json:"type"`
+				State             string   `json:"state"`
+				PEMCACertificates []string `json:"pemCaCertificates"`
+			}
+			if err := json.Unmarshal(item, &entry); err != nil {
+				return nil, fmt.Errorf("Could not decode certificate authority: %s", err)
+			}
+			ca := CloudCertificateAuthority{
+				ID:     entry.Name,
+				Root:   entry.Type == "SELF_SIGNED",
+				Status: entry.State,
+				Risks:  poolRisks[pool],
+			}
+			certs, err := parseCertificatesPEM([]byte(strings.Join(entry.PEMCACertificates, "\n")))
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse the certificate of %s: %s", entry.Name, err)
+			}
+			if len(certs) > 0 {
+				ca.Cert, ca.Chain = certs[0], certs[1:]
+			}
+			cas = append(cas, ca)
+		}
+	}
+	return cas, nil
+}
+
+// template returns the certificate template with name, fetching it the
+// first time.
+func (g *GoogleCAS) template(name string) (gcpIssuancePolicy, error) {
+	if policy, ok := g.templates[name]; ok {
+		return policy, nil
+	}
+	var policy gcpIssuancePolicy
+	if err := g.get(name, nil, &policy); err != nil {
+		return policy, err
+	}
+	if g.templates == nil {
+		g.templates = make(map[string]gcpIssuancePolicy)
+	}
+	g.templates[name] = policy
+	return policy, nil
+}
+
+// IssuedCertificates returns the certificates the location's pools issued
+// since the given time, with the risks of the templates they used.
+func (g *GoogleCAS) IssuedCertificates(since time.Time) ([]CloudCertificate, error) {
+	pools, _, err := g.pools()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"filter": {fmt.Sprintf("create_time >= %q", since.UTC().Format(time.RFC3339))}}
+	var certs []CloudCertificate
+	for _, pool := range pools {
+		items, err := g.list(pool+"/certificates", "certificates", query)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var entry struct {
+				Name                       string    `json:"name"`
+				PEMCertificate             string    `json:"pemCertificate"`
+				CertificateTemplate        string    `json:"certificateTemplate"`
+				IssuerCertificateAuthority string    `json:"issuerCertificateAuthority"`
+				CreateTime                 time.Time `json:"createTime"`
+			}
+			if err := json.Unmarshal(item, &entry); err != nil {
+				return nil, fmt.Errorf("Could not decode certificate: %s", err)
+			}
+			if entry.CreateTime.Before(since) {
+				continue
+			}
+			parsed, err := parseCertificatesPEM([]byte(entry.PEMCertificate))
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse %s: %s", entry.Name, err)
+			}
+			if len(parsed) == 0 {
+				return nil, fmt.Errorf("%s has no certificate", entry.Name)
+			}
+			cert := CloudCertificate{
+				ID:       entry.Name,
+				Issuer:   entry.IssuerCertificateAuthority,
+				IssuedAt: entry.CreateTime,
+				Template: entry.CertificateTemplate,
+				Cert:     parsed[0],
+			}
+			if len(entry.CertificateTemplate) > 0 {
+				template, err := g.template(entry.CertificateTemplate)
+				if err != nil {
+					return nil, err
+				}
+				cert.Risks = template.risks()
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoogleCAS(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	const pool = "projects/p/locations/l/caPools/web"
+	responses := map[string]interface{}{
+		"/projects/p/locations/l/caPools": map[string]interface{}{
+			"caPools": []interface{}{map[string]interface{}{
+				"name": pool,
+				"issuancePolicy": map[string]interface{}{
+					"identityConstraints":   map[string]interface{}{"allowSubjectPassthrough": true, "allowSubjectAltNamesPassthrough": true},
+					"passthroughExtensions": map[string]interface{}{"additionalExtensions": []interface{}{map[string]interface{}{"objectIdPath": []int{1, 2, 3}}}},
+				},
+			}},
+		},
+		"/" + pool + "/certificateAuthorities": map[string]interface{}{
+			"certificateAuthorities": []interface{}{map[string]interface{}{
+				"name":              pool + "/certificateAuthorities/issuing",
+				"type":              "SUBORDINATE",
+				"state":             "ENABLED",
+				"pemCaCertificates": []string{certificatePEM(chain[1]), certificatePEM(chain[2])},
+			}},
+		},
+		"/" + pool + "/certificates": map[string]interface{}{
+			"certificates": []interface{}{
+				map[string]interface{}{
+					"name":                       pool + "/certificates/leaf",
+					"pemCertificate":             certificatePEM(chain[0]),
+					"certificateTemplate":        "projects/p/locations/l/certificateTemplates/sub",
+					"issuerCertificateAuthority": pool + "/certificateAuthorities/issuing",
+					"createTime":                 "2018-03-01T00:00:00Z",
+				},
+				map[string]interface{}{
+					"name":           pool + "/certificates/old",
+					"pemCertificate": certificatePEM(chain[0]),
+					"createTime":     "2017-03-01T00:00:00Z",
+				},
+			},
+		},
+		"/projects/p/locations/l/certificateTemplates/sub": map[string]interface{}{
+			"predefinedValues": map[string]interface{}{"caOptions": map[string]interface{}{"isCa": true}},
+		},
+	}
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"status": "UNAUTHENTICATED", "message": "no token"}})
+			return
+		}
+		if filter := r.URL.Query().Get("filter"); len(filter) > 0 {
+			filters = append(filters, filter)
+		}
+		response, ok := responses[strings.TrimPrefix(r.URL.Path, "/v1")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"status": "NOT_FOUND", "message": r.URL.Path}})
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client := NewGoogleCAS("p", "l", "ya29.token")
+	client.Endpoint = server.URL + "/v1/"
+
+	cas, err := client.CertificateAuthorities()
+	if err != nil {
+		t.Fatalf("Could not list CAs: %s", err)
+	}
+	expectedRisks := []string{
+		"copies subject alternative names from requests without a CEL expression restricting them",
+		"copies extensions from requests: 1.2.3",
+	}
+	if len(cas) != 1 || cas[0].Root || cas[0].Status != "ENABLED" || !cas[0].Cert.Equal(chain[1]) || len(cas[0].Chain) != 1 {
+		t.Fatalf("Unexpected CAs %+v", cas)
+	}
+	if !reflect.DeepEqual(cas[0].Risks, expectedRisks) {
+		t.Errorf("Expected risks %v, got %v", expectedRisks, cas[0].Risks)
+	}
+
+	certs, err := client.IssuedCertificates(time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Could not list certificates: %s", err)
+	}
+	if len(certs) != 1 || certs[0].Issuer != pool+"/certificateAuthorities/issuing" || !certs[0].Cert.Equal(chain[0]) {
+		t.Fatalf("Unexpected certificates %+v", certs)
+	}
+	if !reflect.DeepEqual(certs[0].Risks, []string{"issues CA certificates"}) {
+		t.Errorf("Unexpected template risks %v", certs[0].Risks)
+	}
+	if !reflect.DeepEqual(filters, []string{`create_time >= "2018-01-01T00:00:00Z"`}) {
+		t.Errorf("Unexpected filters %v", filters)
+	}
+
+	client.Token = "wrong"
+	if _, err := client.CertificateAuthorities(); err == nil || !strings.Contains(err.Error(), "UNAUTHENTICATED") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+}
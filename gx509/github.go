@@ -0,0 +1,45 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterRenderer("github", func(w io.Writer) Renderer { return githubRenderer{w} })
+}
+
+// githubEscapeData escapes the message of a GitHub Actions workflow command.
+var githubEscapeData = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// githubEscapeProperty escapes a property value of a workflow command, which
+// is ended by commas and colons as well.
+var githubEscapeProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// githubRenderer writes a GitHub Actions workflow command for each failure,
+// so that it is shown as an annotation on the file the certificate was read
+// from.
+type githubRenderer struct {
+	w io.Writer
+}
+
+func (r githubRenderer) Render(report Report) error {
+	if report.Kind != LintReport {
+		return errUnsupportedReport("github", report.Kind)
+	}
+	for _, finding := range report.Failures() {
+		if _, err := fmt.Fprintf(r.w, "::%s file=%s,title=%s::%s\n", finding.Lint.Severity,
+			githubEscapeProperty.Replace(filepath.ToSlash(finding.Path)),
+			githubEscapeProperty.Replace(finding.Lint.Name+": "+finding.Cert.Subject.CommonName),
+			githubEscapeData.Replace(finding.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
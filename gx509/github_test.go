@@ -0,0 +1,31 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGitHubRenderer(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	renderer, _ := NewRenderer("github", &out)
+	if err := renderer.Render(testReport(t)); err != nil {
+		t.Fatalf("Could not render: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected an annotation for each of 5 failures, got:\n%s", out.String())
+	}
+	if lines[0] != "::error file=certs/leaf.pem,title=expired%3A www.example.com::Expired on 2018-06-01" {
+		t.Errorf("Unexpected annotation %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[3], "::warning file=certs/chain.pem,title=technically-constrained%3A ") {
+		t.Errorf("Expected the constraint failure as a warning, got %q", lines[3])
+	}
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"sync"
+	"time"
+)
+
+// ScanHosts fetches the chains of the TLS servers at addresses, with at most
+// concurrency connections open at once and, if interval is set, at least
+// interval between starting each. It returns them in the same order.
+func ScanHosts(addresses []string, timeout time.Duration, concurrency int, interval time.Duration) []ServerChain {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]ServerChain, len(addresses))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				certs, err := FetchServerChain(addresses[i], timeout)
+				results[i] = ServerChain{Address: addresses[i], Certificates: certs, Err: err}
+			}
+		}()
+	}
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+	for i := range addresses {
+		if ticker != nil && i > 0 {
+			<-ticker.C
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// An ExpirySummary counts servers by how soon their certificates expire.
+type ExpirySummary struct {
+	Expired int
+	// Expiring counts those expiring within the warning period.
+	Expiring int
+	Valid    int
+	// Soonest is the earliest expiry of a certificate not yet expired.
+	Soonest time.Time
+}
+
+// SummarizeExpiry counts, as of at, the servers whose certificates have
+// expired or will within warning.
+func SummarizeExpiry(servers []ServerChain, at time.Time, warning time.Duration) ExpirySummary {
+	var summary ExpirySummary
+	for _, server := range servers {
+		if len(server.Certificates) == 0 {
+			continue
+		}
+		notAfter := server.Certificates[0].NotAfter
+		switch {
+		case at.After(notAfter):
+			summary.Expired++
+			continue
+		case at.Add(warning).After(notAfter):
+			summary.Expiring++
+		default:
+			summary.Valid++
+		}
+		if summary.Soonest.IsZero() || notAfter.Before(summary.Soonest) {
+			summary.Soonest = notAfter
+		}
+	}
+	return summary
+}
@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestScanHosts(t *testing.T) {
+	t.Parallel()
+
+	key, _ := testECKey(t)
+	leaf := certifyKey(t, "localhost", &key.PublicKey)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// Nothing listens on a port just closed
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	closed.Close()
+
+	addresses := []string{listener.Addr().String(), closed.Addr().String(), listener.Addr().String()}
+	results := ScanHosts(addresses, 5*time.Second, 2, time.Millisecond)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Address != addresses[i] {
+			t.Errorf("Result %d is for %s, expected %s", i, result.Address, addresses[i])
+		}
+	}
+	if results[0].Err != nil || len(results[0].Certificates) != 1 || !results[0].Certificates[0].Equal(leaf) {
+		t.Errorf("Unexpected result for the listening server: %+v", results[0])
+	}
+	if results[1].Err == nil || len(results[1].Certificates) != 0 {
+		t.Errorf("Expected an error for the closed port, got %+v", results[1])
+	}
+}
+
+func TestSummarizeExpiry(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2018, time.May, 20, 0, 0, 0, 0, time.UTC)
+	servers := []ServerChain{
+		{Address: "a:443", Certificates: chain},
+		{Address: "b:443", Certificates: chain[1:]},
+		{Address: "c:443", Err: net.UnknownNetworkError("down")},
+	}
+
+	summary := SummarizeExpiry(servers, at, 30*24*time.Hour)
+	if summary.Expired != 0 || summary.Expiring != 1 || summary.Valid != 1 || !summary.Soonest.Equal(chain[0].NotAfter) {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	summary = SummarizeExpiry(servers, at.AddDate(1, 0, 0), 30*24*time.Hour)
+	if summary.Expired != 1 || summary.Valid != 1 || !summary.Soonest.Equal(chain[1].NotAfter) {
+		t.Errorf("Unexpected summary a year later %+v", summary)
+	}
+}
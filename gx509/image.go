@@ -0,0 +1,222 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxImageFileSize bounds the files read from image layers; certificate
+// files and trust bundles are far smaller.
+const maxImageFileSize = 4 << 20
+
+// ImageFiles maps the path of each file in an image's filesystem to the
+// certificates it holds.
+type ImageFiles map[string][]*x509.Certificate
+
+// ApplyLayer updates files with the contents of a layer tarball, which may be
+// gzip-compressed. Files the layer replaces or deletes with whiteouts are
+// dropped, so applying every layer in order leaves what the image ships.
+func (files ImageFiles) ApplyLayer(layer io.Reader) error {
+	buffered := bufio.NewReader(layer)
+	reader := io.Reader(buffered)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + header.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			files.remove(dir, false)
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			files.remove(path.Join(dir, strings.TrimPrefix(base, ".wh.")), true)
+			continue
+		}
+
+		// Anything at this path in a lower layer is replaced
+		files.remove(name, true)
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if header.Size > maxImageFileSize {
+			continue
+		}
+
+		contents, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		if certs := pemCertificates(contents); len(certs) > 0 {
+			files[name] = certs
+		}
+	}
+}
+
+// remove drops name, if itself is set, and everything beneath it.
+func (files ImageFiles) remove(name string, itself bool) {
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	for file := range files {
+		if (itself && file == name) || strings.HasPrefix(file, prefix) {
+			delete(files, file)
+		}
+	}
+}
+
+// pemCertificates parses every certificate PEM block in contents, ignoring any
+// that fail to parse.
+func pemCertificates(contents []byte) []*x509.Certificate {
+	if !bytes.Contains(contents, []byte("-----BEGIN CERTIFICATE-----")) {
+		return nil
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// ImageArchive is a tarball written by `docker save`, which can be read in
+// any order.
+type ImageArchive interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+type archiveManifest struct {
+	RepoTags []string
+	Layers   []string
+}
+
+// ArchiveFiles reads the certificates shipped in the first image of a
+// `docker save` tarball.
+func ArchiveFiles(archive ImageArchive) (ImageFiles, error) {
+	entries := make(map[string]*io.SectionReader)
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		entries[path.Clean(header.Name)] = io.NewSectionReader(archive, offset, header.Size)
+	}
+
+	manifestEntry, ok := entries["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("Archive has no manifest.json; is it from docker save?")
+	}
+	var manifests []archiveManifest
+	if err := json.NewDecoder(manifestEntry).Decode(&manifests); err != nil {
+		return nil, fmt.Errorf("Could not decode manifest.json: %s", err)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("Archive holds no images")
+	}
+
+	files := make(ImageFiles)
+	for _, layer := range manifests[0].Layers {
+		entry, ok := entries[path.Clean(layer)]
+		if !ok {
+			return nil, fmt.Errorf("Archive is missing layer %s", layer)
+		}
+		if err := files.ApplyLayer(entry); err != nil {
+			return nil, fmt.Errorf("Could not read layer %s: %s", layer, err)
+		}
+	}
+	return files, nil
+}
+
+// An ImageFinding is a certificate shipped in an image that deserves
+// attention.
+type ImageFinding struct {
+	Path    string
+	Cert    *x509.Certificate
+	Problem string
+}
+
+// Problems reported in ImageFindings.
+const (
+	ImageUnconstrainedCA    = "unconstrained CA"
+	ImageExpiredAnchor      = "expired trust anchor"
+	ImageExpiredCertificate = "expired certificate"
+)
+
+// AnalyzeImageFiles reports, at the given time, every CA certificate shipped
+// in files that is not technically constrained, and every expired
+// certificate, ordered by path.
+func AnalyzeImageFiles(files ImageFiles, at time.Time) []ImageFinding {
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+
+	var findings []ImageFinding
+	for _, file := range paths {
+		for _, cert := range files[file] {
+			if at.After(cert.NotAfter) {
+				problem := ImageExpiredCertificate
+				if isSelfSigned(cert) {
+					problem = ImageExpiredAnchor
+				}
+				findings = append(findings, ImageFinding{Path: file, Cert: cert, Problem: problem})
+				continue
+			}
+			if !cert.IsCA {
+				continue
+			}
+			if !AnalyzeTechnicalConstraints(cert).Constrained {
+				findings = append(findings, ImageFinding{Path: file, Cert: cert, Problem: ImageUnconstrainedCA})
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func pemBundle(certs ...*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+// testTarball builds a tarball of files, in order; a nil value is a
+// directory.
+func testTarball(t *testing.T, compress bool, files ...interface{}) []byte {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	writer := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		writer = tar.NewWriter(gz)
+	}
+
+	for i := 0; i < len(files); i += 2 {
+		name := files[i].(string)
+		header := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeDir}
+		var contents []byte
+		if files[i+1] != nil {
+			contents = files[i+1].([]byte)
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(contents))
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("Could not write tar header: %s", err)
+		}
+		writer.Write(contents)
+	}
+	writer.Close()
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestApplyLayer(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	leaf, intermediate, root := chain[0], chain[1], chain[2]
+
+	files := make(ImageFiles)
+	base := testTarball(t, true,
+		"etc/ssl/certs/", nil,
+		"etc/ssl/certs/ca-certificates.crt", pemBundle(root, intermediate),
+		"etc/ssl/certs/old.pem", pemBundle(root),
+		"opt/app/tls/", nil,
+		"opt/app/tls/server.pem", pemBundle(leaf),
+		"opt/app/README", []byte("not a certificate"),
+	)
+	if err := files.ApplyLayer(bytes.NewReader(base)); err != nil {
+		t.Fatalf("Could not apply base layer: %s", err)
+	}
+	if len(files) != 3 || len(files["/etc/ssl/certs/ca-certificates.crt"]) != 2 {
+		t.Fatalf("Unexpected files after the base layer: %v", files)
+	}
+
+	update := testTarball(t, false,
+		"etc/ssl/certs/.wh.old.pem", []byte{},
+		"etc/ssl/certs/ca-certificates.crt", pemBundle(root),
+		"opt/app/tls/.wh..wh..opq", []byte{},
+	)
+	if err := files.ApplyLayer(bytes.NewReader(update)); err != nil {
+		t.Fatalf("Could not apply update layer: %s", err)
+	}
+	if len(files) != 1 || len(files["/etc/ssl/certs/ca-certificates.crt"]) != 1 {
+		t.Errorf("Expected only the replaced bundle to remain: %v", files)
+	}
+}
+
+func TestArchiveFiles(t *testing.T) {
+	t.Parallel()
+
+	root := testChain(t, "www.example.com")[2]
+	layer := testTarball(t, true, "etc/ssl/cert.pem", pemBundle(root))
+	archive := testTarball(t, false,
+		"abc123/layer.tar", layer,
+		"manifest.json", []byte(`[{"Config":"config.json","RepoTags":["app:1"],"Layers":["abc123/layer.tar"]}]`),
+	)
+
+	files, err := ArchiveFiles(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Could not read archive: %s", err)
+	}
+	if certs := files["/etc/ssl/cert.pem"]; len(certs) != 1 || !certs[0].Equal(root) {
+		t.Errorf("Expected the root to be found: %v", files)
+	}
+
+	missing := testTarball(t, false, "manifest.json", []byte(`[{"Layers":["gone/layer.tar"]}]`))
+	if _, err := ArchiveFiles(bytes.NewReader(missing)); err == nil {
+		t.Errorf("Expected an error for a missing layer")
+	}
+	if _, err := ArchiveFiles(bytes.NewReader(layer[:0])); err == nil {
+		t.Errorf("Expected an error for an archive without a manifest")
+	}
+}
+
+func TestAnalyzeImageFiles(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	expiredRoot := testCA(t, "Expired Root", nil, at.AddDate(-1, 0, 0))
+	chain := testChain(t, "www.example.com")
+	constrained := constrainedIntermediate(t, []string{"example.com"})
+
+	findings := AnalyzeImageFiles(ImageFiles{
+		"/b/bundle.pem": {chain[2], constrained},
+		"/a/old.pem":    {expiredRoot, chain[0]},
+	}, at)
+
+	expected := []struct {
+		path, name, problem string
+	}{
+		{"/a/old.pem", "Expired Root", ImageExpiredAnchor},
+		{"/a/old.pem", "www.example.com", ImageExpiredCertificate},
+		{"/b/bundle.pem", "Σ Acme Co Root", ImageUnconstrainedCA},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %+v", len(expected), findings)
+	}
+	for i, finding := range findings {
+		if finding.Path != expected[i].path || finding.Cert.Subject.CommonName != expected[i].name ||
+			finding.Problem != expected[i].problem {
+			t.Errorf("Finding %d: expected %v, got %s %s %s", i, expected[i],
+				finding.Path, finding.Cert.Subject.CommonName, finding.Problem)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type policyConfigYAML struct {
+	Name          string   `yaml:"name,omitempty"`
+	Policy        string   `yaml:"policy,omitempty"`
+	Lints         []string `yaml:"lints,omitempty"`
+	DisabledLints []string `yaml:"disabledLints,omitempty"`
+}
+
+// ParsePolicyConfig decodes a YAML policy configuration, the rules of a
+// tenant without its keys, such as
+//
+//	name: proposed
+//	policy: mozilla-2.7
+//	disabledLints: [weak-signature]
+//
+// The policy and lints are as in ParseTenantConfig. The name defaults to
+// that of the policy.
+func ParsePolicyConfig(data []byte) (*Tenant, error) {
+	var raw policyConfigYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	tenant, err := newTenant(raw.Name, raw.Policy, raw.Lints, raw.DisabledLints)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Name == "" {
+		tenant.Name = tenant.policyName()
+	}
+	return tenant, nil
+}
+
+// policyName names the policy the tenant judges by.
+func (t *Tenant) policyName() string {
+	if t.ByIssuance {
+		return "issuance"
+	}
+	return t.Policy.Name
+}
+
+// LookupPolicyConfig returns the configuration judging by the preset policy
+// name, or "issuance", with every lint.
+func LookupPolicyConfig(name string) (*Tenant, bool) {
+	tenant, err := newTenant("", name, nil, nil)
+	if err != nil {
+		return nil, false
+	}
+	tenant.Name = tenant.policyName()
+	return tenant, true
+}
+
+// A LintChange is a lint whose outcome a policy change reversed: it failed
+// under one configuration, and passed or was not run under the other.
+type LintChange struct {
+	Lint string
+	// Before and After are its results, or nil where it was not run.
+	Before *LintResult
+	After  *LintResult
+}
+
+// lintFailed is whether result is that of a failing lint.
+func lintFailed(result *LintResult) bool {
+	return result != nil && !result.Passed
+}
+
+// NowFails is whether the lint fails only under the new configuration.
+func (c LintChange) NowFails() bool {
+	return lintFailed(c.After)
+}
+
+// A CertificateImpact is a certificate whose verdict a policy change
+// reversed.
+type CertificateImpact struct {
+	// Path is the file the certificate was read from.
+	Path string
+	Cert *x509.Certificate
+	// Before and After are its analyses under each configuration.
+	Before AnalyzedCertificate
+	After  AnalyzedCertificate
+	// Lints are the lints whose outcome changed.
+	Lints []LintChange
+}
+
+// ConstraintChanged is whether the certificate is technically constrained
+// under one configuration but not the other.
+func (c CertificateImpact) ConstraintChanged() bool {
+	return c.Before.Constrained != c.After.Constrained
+}
+
+// A PolicyImpact compares two configurations over a corpus, for root
+// programs weighing a policy change.
+type PolicyImpact struct {
+	Before *Tenant
+	After  *Tenant
+	// At is when lints are run as of.
+	At time.Time
+
+	Certificates int
+	Changes      []CertificateImpact
+}
+
+// NewPolicyImpact returns an empty comparison of before and after, with lints
+// run as of at.
+func NewPolicyImpact(before, after *Tenant, at time.Time) *PolicyImpact {
+	return &PolicyImpact{Before: before, After: after, At: at}
+}
+
+// lintResults indexes the findings of analyzed by lint.
+func lintResults(analyzed AnalyzedCertificate) map[string]*LintResult {
+	results := make(map[string]*LintResult)
+	for i := range analyzed.Findings {
+		results[analyzed.Findings[i].Lint] = &analyzed.Findings[i]
+	}
+	return results
+}
+
+// Add judges cert, read from path, under both configurations and records it
+// if its verdict changes.
+func (p *PolicyImpact) Add(path string, cert *x509.Certificate) {
+	p.Certificates++
+	impact := CertificateImpact{
+		Path:   path,
+		Cert:   cert,
+		Before: p.Before.Analyze([]*x509.Certificate{cert}, p.At).Certificates[0],
+		After:  p.After.Analyze([]*x509.Certificate{cert}, p.At).Certificates[0],
+	}
+	impact.Before.Name = path
+	impact.After.Name = path
+
+	before, after := lintResults(impact.Before), lintResults(impact.After)
+	for _, lint := range Lints {
+		if lintFailed(before[lint.Name]) != lintFailed(after[lint.Name]) {
+			impact.Lints = append(impact.Lints, LintChange{Lint: lint.Name, Before: before[lint.Name], After: after[lint.Name]})
+		}
+	}
+	if impact.ConstraintChanged() || len(impact.Lints) > 0 {
+		p.Changes = append(p.Changes, impact)
+	}
+}
+
+// An ImpactSummary counts the verdicts a policy change reverses.
+type ImpactSummary struct {
+	// NowConstrained and NowUnconstrained count certificates whose constraint
+	// verdict flips each way.
+	NowConstrained   int
+	NowUnconstrained int
+	// NowFailing and NowPassing count lint outcomes that flip each way.
+	NowFailing int
+	NowPassing int
+}
+
+// Summary counts the changes.
+func (p *PolicyImpact) Summary() ImpactSummary {
+	var summary ImpactSummary
+	for _, change := range p.Changes {
+		if change.ConstraintChanged() {
+			if change.After.Constrained {
+				summary.NowConstrained++
+			} else {
+				summary.NowUnconstrained++
+			}
+		}
+		for _, lint := range change.Lints {
+			if lint.NowFails() {
+				summary.NowFailing++
+			} else {
+				summary.NowPassing++
+			}
+		}
+	}
+	return summary
+}
@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestParsePolicyConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParsePolicyConfig([]byte("policy: v2.5\ndisabledLints: [expired]\n"))
+	if err != nil {
+		t.Fatalf("Could not parse: %s", err)
+	}
+	if config.Name != "mozilla-2.5" || config.Policy.Name != "mozilla-2.5" || len(config.Lints) != len(Lints)-1 {
+		t.Errorf("Unexpected configuration %+v", config)
+	}
+	if config, err = ParsePolicyConfig([]byte("name: current\npolicy: issuance\n")); err != nil || config.Name != "current" || !config.ByIssuance {
+		t.Errorf("Expected a configuration by issuance, got %+v, %v", config, err)
+	}
+	for _, data := range []string{"policy: mozilla-9\n", "lints: [nope]\n", "keys: [abc]\n"} {
+		if _, err := ParsePolicyConfig([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+
+	if config, ok := LookupPolicyConfig("cabr-baseline"); !ok || config.Name != "cabr-baseline" || len(config.Lints) != len(Lints) {
+		t.Errorf("Expected the cabr-baseline preset with every lint")
+	}
+	if _, ok := LookupPolicyConfig("policy.yaml"); ok {
+		t.Errorf("Expected no preset named policy.yaml")
+	}
+}
+
+func TestPolicyImpact(t *testing.T) {
+	t.Parallel()
+
+	// Constrained by dNSName alone, which stopped sufficing in 2.5
+	dnsOnly := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "DNS Only CA"},
+		NotBefore:             time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"example.com"},
+	})
+	expired := testCA(t, "Expired CA", nil, time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC))
+	unaffected := testCA(t, "Unaffected CA", nil, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	before, err := ParsePolicyConfig([]byte("policy: mozilla-2.2\ndisabledLints: [expired]\n"))
+	if err != nil {
+		t.Fatalf("Could not parse: %s", err)
+	}
+	after, _ := LookupPolicyConfig("mozilla-2.5")
+	impact := NewPolicyImpact(before, after, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	impact.Add("dns.pem", dnsOnly)
+	impact.Add("expired.pem", expired)
+	impact.Add("unaffected.pem", unaffected)
+
+	if impact.Certificates != 3 || len(impact.Changes) != 2 {
+		t.Fatalf("Expected 2 of 3 certificates to change, got %d of %d", len(impact.Changes), impact.Certificates)
+	}
+	flipped := impact.Changes[0]
+	if flipped.Path != "dns.pem" || !flipped.ConstraintChanged() || !flipped.Before.Constrained || flipped.After.Constrained ||
+		flipped.After.Policy != "mozilla-2.5" || len(flipped.Lints) != 0 {
+		t.Errorf("Expected dns.pem to become unconstrained, got %+v", flipped)
+	}
+	failing := impact.Changes[1]
+	if failing.Path != "expired.pem" || failing.ConstraintChanged() || len(failing.Lints) != 1 ||
+		failing.Lints[0].Lint != "expired" || failing.Lints[0].Before != nil || !failing.Lints[0].NowFails() {
+		t.Errorf("Expected expired.pem to newly fail the expired lint, got %+v", failing)
+	}
+	if summary := impact.Summary(); summary != (ImpactSummary{NowUnconstrained: 1, NowFailing: 1}) {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	// The reverse change reverses every verdict
+	reverse := NewPolicyImpact(after, before, impact.At)
+	reverse.Add("dns.pem", dnsOnly)
+	reverse.Add("expired.pem", expired)
+	if summary := reverse.Summary(); summary != (ImpactSummary{NowConstrained: 1, NowPassing: 1}) {
+		t.Errorf("Unexpected reverse summary %+v", summary)
+	}
+}
@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic              = 0xFEEDFEED
+	jksVersion            = 2
+	jksTrustedCertificate = 2
+)
+
+// WriteJKS writes roots as trusted certificate entries in a Java KeyStore,
+// sealed with password. Each entry's alias is its label, lowercased as Java
+// does, and made unique if necessary.
+func WriteJKS(w io.Writer, roots []TrustedRoot, password string, created time.Time) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(jksMagic))
+	binary.Write(&buf, binary.BigEndian, uint32(jksVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(roots)))
+
+	timestamp := uint64(created.UnixNano() / int64(time.Millisecond))
+	aliases := make(map[string]bool)
+	for _, root := range roots {
+		alias := strings.ToLower(root.Label)
+		if alias == "" {
+			alias = strings.ToLower(root.Cert.Subject.CommonName)
+		}
+		for base, i := alias, 2; aliases[alias]; i++ {
+			alias = fmt.Sprintf("%s %d", base, i)
+		}
+		aliases[alias] = true
+
+		binary.Write(&buf, binary.BigEndian, uint32(jksTrustedCertificate))
+		if err := writeJKSString(&buf, alias); err != nil {
+			return err
+		}
+		binary.Write(&buf, binary.BigEndian, timestamp)
+		writeJKSString(&buf, "X.509")
+		binary.Write(&buf, binary.BigEndian, uint32(len(root.Cert.Raw)))
+		buf.Write(root.Cert.Raw)
+	}
+
+	digest := jksDigest(password, buf.Bytes())
+	buf.Write(digest[:])
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeJKSString writes s as Java's DataOutput.writeUTF does. The modified
+// UTF-8 encoding only differs from UTF-8 for NUL and supplementary
+// characters, which do not belong in an alias.
+func writeJKSString(buf *bytes.Buffer, s string) error {
+	if len(s) > 0xFFFF {
+		return fmt.Errorf("Alias %q is too long for a Java KeyStore", s)
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+	return nil
+}
+
+// jksDigest computes a KeyStore's integrity check, which is the SHA-1 of the
+// password as UTF-16, a fixed salt, and the preceding contents.
+func jksDigest(password string, contents []byte) [sha1.Size]byte {
+	var input bytes.Buffer
+	for _, unit := range utf16.Encode([]rune(password)) {
+		binary.Write(&input, binary.BigEndian, unit)
+	}
+	input.WriteString("Mighty Aphrodite")
+	input.Write(contents)
+	return sha1.Sum(input.Bytes())
+}
@@ -0,0 +1,88 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestWriteJKS(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().AddDate(10, 0, 0)
+	root := testCA(t, "Test Root", nil, notAfter)
+	other := testCA(t, "Other Root", nil, notAfter)
+	roots := []TrustedRoot{
+		{Label: "Test Root", Cert: root},
+		{Label: "TEST ROOT", Cert: other},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJKS(&buf, roots, "changeit", time.Unix(1500000000, 0)); err != nil {
+		t.Fatalf("Could not write keystore: %s", err)
+	}
+	store := buf.Bytes()
+
+	var header struct{ Magic, Version, Count uint32 }
+	reader := bytes.NewReader(store)
+	binary.Read(reader, binary.BigEndian, &header)
+	if header.Magic != jksMagic || header.Version != jksVersion || header.Count != 2 {
+		t.Fatalf("Unexpected header: %+v", header)
+	}
+
+	var aliases []string
+	for i := 0; i < int(header.Count); i++ {
+		var tag uint32
+		binary.Read(reader, binary.BigEndian, &tag)
+		if tag != jksTrustedCertificate {
+			t.Fatalf("Expected a trusted certificate entry, got tag %d", tag)
+		}
+		aliases = append(aliases, readJKSString(t, reader))
+
+		var timestamp uint64
+		binary.Read(reader, binary.BigEndian, &timestamp)
+		if timestamp != 1500000000000 {
+			t.Errorf("Unexpected timestamp: %d", timestamp)
+		}
+		if certType := readJKSString(t, reader); certType != "X.509" {
+			t.Errorf("Unexpected certificate type: %s", certType)
+		}
+
+		var length uint32
+		binary.Read(reader, binary.BigEndian, &length)
+		der := make([]byte, length)
+		reader.Read(der)
+		if !bytes.Equal(der, roots[i].Cert.Raw) {
+			t.Errorf("Entry %d does not hold %s", i, roots[i].Label)
+		}
+	}
+
+	if aliases[0] != "test root" || aliases[1] != "test root 2" {
+		t.Errorf("Expected unique lowercase aliases, got %q", aliases)
+	}
+
+	if reader.Len() != sha1.Size {
+		t.Fatalf("Expected only the digest to remain, got %d bytes", reader.Len())
+	}
+	body := store[:len(store)-sha1.Size]
+	digest := jksDigest("changeit", body)
+	if !bytes.Equal(digest[:], store[len(store)-sha1.Size:]) {
+		t.Errorf("Integrity check does not match")
+	}
+}
+
+func readJKSString(t *testing.T, reader *bytes.Reader) string {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		t.Fatalf("Could not read string length: %s", err)
+	}
+	s := make([]byte, length)
+	reader.Read(s)
+	return string(s)
+}
@@ -0,0 +1,160 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+func init() {
+	RegisterRenderer("json", func(w io.Writer) Renderer { return jsonRenderer{w} })
+}
+
+// A jsonFinding is a lint finding as the json format writes it.
+type jsonFinding struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"`
+	Subject     string `json:"subject_cn"`
+	Lint        string `json:"lint"`
+	Severity    string `json:"severity"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message"`
+}
+
+// A jsonSelected is a certificate a query selected, as the json and csv
+// formats write it.
+type jsonSelected struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject_cn"`
+	Issuer      string    `json:"issuer_cn"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Sources     []string  `json:"sources"`
+	// Policy, Constrained and Reasons are the stored verdict, if there is
+	// one.
+	Policy      string   `json:"policy,omitempty"`
+	Constrained *bool    `json:"constrained,omitempty"`
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+func newJSONSelected(result *StoredResult, verdict bool) jsonSelected {
+	selected := jsonSelected{
+		Fingerprint: fmt.Sprintf("%x", result.Fingerprint()),
+		Subject:     result.Certificate.Subject.CommonName,
+		Issuer:      result.Certificate.Issuer.CommonName,
+		NotBefore:   result.Certificate.NotBefore,
+		NotAfter:    result.Certificate.NotAfter,
+		FirstSeen:   result.FirstSeen,
+		LastSeen:    result.LastSeen,
+		Sources:     result.Sources,
+	}
+	if verdict {
+		constrained := result.Constrained
+		selected.Policy, selected.Constrained, selected.Reasons = result.Policy, &constrained, result.Reasons
+	}
+	return selected
+}
+
+// A jsonCA is a CA in a CA status report as the json format writes it.
+type jsonCA struct {
+	Label         string    `json:"label"`
+	Fingerprint   string    `json:"fingerprint"`
+	Subject       string    `json:"subject"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	Key           string    `json:"key"`
+	Constrained   bool      `json:"constrained"`
+	Findings      []string  `json:"findings"`
+}
+
+// A jsonInventoryItem is a distinct certificate in an inventory as the json
+// format writes it.
+type jsonInventoryItem struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	Locations   []string  `json:"locations"`
+}
+
+// jsonRenderer writes analyses as a line of JSON each, as gx509 -json always
+// has, and other reports as a single indented document.
+type jsonRenderer struct {
+	w io.Writer
+}
+
+func (r jsonRenderer) Render(report Report) error {
+	encoder := json.NewEncoder(r.w)
+	if report.Kind == AnalysisReport {
+		for _, result := range report.Results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	encoder.SetIndent("", "  ")
+	switch report.Kind {
+	case LintReport:
+		findings := []jsonFinding{}
+		for _, finding := range report.Findings {
+			findings = append(findings, jsonFinding{
+				Path:        finding.Path,
+				Fingerprint: fmt.Sprintf("%x", sha256.Sum256(finding.Cert.Raw)),
+				Subject:     finding.Cert.Subject.CommonName,
+				Lint:        finding.Lint.Name,
+				Severity:    finding.Lint.Severity.String(),
+				Passed:      finding.Passed,
+				Message:     finding.Message,
+			})
+		}
+		return encoder.Encode(findings)
+	case QueryReport:
+		selected := []jsonSelected{}
+		for _, result := range report.Selected {
+			selected = append(selected, newJSONSelected(result, report.StoredVerdicts))
+		}
+		return encoder.Encode(selected)
+	case CAStatusReport:
+		cas := []jsonCA{}
+		for _, entry := range report.CAs.Entries {
+			cas = append(cas, jsonCA{
+				Label:         entry.Label,
+				Fingerprint:   fmt.Sprintf("%x", sha256.Sum256(entry.Cert.Raw)),
+				Subject:       entry.Cert.Subject.String(),
+				NotAfter:      entry.Cert.NotAfter,
+				DaysRemaining: entry.DaysRemaining,
+				Key:           entry.Key,
+				Constrained:   entry.Constrained,
+				Findings:      entry.Findings(),
+			})
+		}
+		return encoder.Encode(struct {
+			Title     string    `json:"title"`
+			Generated time.Time `json:"generated"`
+			CAs       []jsonCA  `json:"cas"`
+		}{report.CAs.Title, report.CAs.Generated, cas})
+	case InventoryReport:
+		items := []jsonInventoryItem{}
+		for _, item := range report.Inventory {
+			items = append(items, jsonInventoryItem{
+				Fingerprint: fmt.Sprintf("%x", sha256.Sum256(item.Cert.Raw)),
+				Subject:     item.Cert.Subject.String(),
+				Issuer:      item.Cert.Issuer.String(),
+				NotAfter:    item.Cert.NotAfter,
+				Locations:   item.Locations,
+			})
+		}
+		return encoder.Encode(items)
+	}
+	return errUnsupportedReport("json", report.Kind)
+}
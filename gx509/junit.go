@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterRenderer("junit", func(w io.Writer) Renderer { return junitRenderer{w} })
+}
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitClassName names the certificate read from path for JUnit. Jenkins
+// splits class names into packages at each dot, so the dots in file names
+// and hostnames are replaced, leaving the name the same from run to run so
+// that the history of each test case is kept.
+func junitClassName(path string, commonName string) string {
+	name := path
+	if len(commonName) > 0 {
+		name += " " + commonName
+	}
+	return strings.Replace(name, ".", "_", -1)
+}
+
+// junitRenderer writes a JUnit XML test suite for each certificate, with a
+// test case for each lint run on it, failing if the lint did.
+type junitRenderer struct {
+	w io.Writer
+}
+
+func (r junitRenderer) Render(report Report) error {
+	if report.Kind != LintReport {
+		return errUnsupportedReport("junit", report.Kind)
+	}
+	suites := junitTestSuites{Name: "gx509", Tests: len(report.Findings)}
+	index := make(map[string]int)
+	for _, finding := range report.Findings {
+		key := finding.Path + "\x00" + string(finding.Cert.Raw)
+		i, ok := index[key]
+		if !ok {
+			i = len(suites.TestSuites)
+			index[key] = i
+			suites.TestSuites = append(suites.TestSuites, junitTestSuite{
+				Name:      junitClassName(finding.Path, finding.Cert.Subject.CommonName),
+				Timestamp: report.Generated.UTC().Format(time.RFC3339),
+				Properties: []junitProperty{
+					{Name: "path", Value: finding.Path},
+					{Name: "subject", Value: finding.Cert.Subject.String()},
+					{Name: "sha256", Value: fmt.Sprintf("%X", sha256.Sum256(finding.Cert.Raw))},
+				},
+			})
+		}
+		suite := &suites.TestSuites[i]
+
+		testCase := junitTestCase{ClassName: suite.Name, Name: finding.Lint.Name}
+		if !finding.Passed {
+			testCase.Failure = &junitFailure{Message: finding.Message, Type: finding.Lint.Severity.String(), Text: finding.Lint.Description}
+			suite.Failures++
+			suites.Failures++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(r.w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(r.w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.w, "\n")
+	return err
+}
@@ -0,0 +1,48 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestJUnitRenderer(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	renderer, _ := NewRenderer("junit", &out)
+	if err := renderer.Render(testReport(t)); err != nil {
+		t.Fatalf("Could not render: %s", err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("Could not parse JUnit XML: %s\n%s", err, out.String())
+	}
+	if suites.Tests != 19 || suites.Failures != 5 || len(suites.TestSuites) != 3 {
+		t.Fatalf("Unexpected %d tests, %d failures in %d suites", suites.Tests, suites.Failures, len(suites.TestSuites))
+	}
+
+	leaf := suites.TestSuites[0]
+	if leaf.Name != "certs/leaf_pem www_example_com" || leaf.Tests != 7 || leaf.Failures != 2 || leaf.Timestamp != "2018-07-01T00:00:00Z" {
+		t.Errorf("Unexpected leaf suite %s with %d tests, %d failures, at %s", leaf.Name, leaf.Tests, leaf.Failures, leaf.Timestamp)
+	}
+	if len(leaf.Properties) != 3 || leaf.Properties[0].Value != "certs/leaf.pem" {
+		t.Errorf("Unexpected leaf properties %+v", leaf.Properties)
+	}
+	first := leaf.TestCases[0]
+	if first.ClassName != leaf.Name || first.Name != "expired" || first.Failure == nil || first.Failure.Message != "Expired on 2018-06-01" {
+		t.Errorf("Unexpected first test case %+v", first)
+	}
+	if leaf.TestCases[2].Failure != nil {
+		t.Errorf("Expected the leaf's signature to pass")
+	}
+
+	if intermediate := suites.TestSuites[1]; len(intermediate.TestCases) != 7 || intermediate.TestCases[3].Failure.Type != "warning" {
+		t.Errorf("Expected the intermediate's constraints to fail as a warning, got %+v", intermediate.TestCases)
+	}
+}
@@ -0,0 +1,179 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A JWTKey is a key advertised with an x5c certificate chain, either in the
+// header of a JWT or in a JWKS.
+type JWTKey struct {
+	KeyID     string
+	Algorithm string
+	// Use is "sig" or "enc", and only present in JWKS.
+	Use string
+	// Chain is the x5c chain, which starts with the certificate for the
+	// key itself.
+	Chain []*x509.Certificate
+	// Thumbprint is the x5t#S256 header, if any.
+	Thumbprint []byte
+}
+
+type jwk struct {
+	KeyID          string   `json:"kid"`
+	Algorithm      string   `json:"alg"`
+	Use            string   `json:"use"`
+	X5C            []string `json:"x5c"`
+	ThumbprintS256 string   `json:"x5t#S256"`
+}
+
+func (k jwk) parse() (JWTKey, error) {
+	key := JWTKey{KeyID: k.KeyID, Algorithm: k.Algorithm, Use: k.Use}
+	for i, encoded := range k.X5C {
+		// x5c is standard base64, unlike the rest of a JWT
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return key, fmt.Errorf("Could not decode x5c[%d]: %s", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return key, fmt.Errorf("Could not parse x5c[%d]: %s", i, err)
+		}
+		key.Chain = append(key.Chain, cert)
+	}
+	if len(k.ThumbprintS256) > 0 {
+		thumbprint, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.ThumbprintS256, "="))
+		if err != nil {
+			return key, fmt.Errorf("Could not decode x5t#S256: %s", err)
+		}
+		key.Thumbprint = thumbprint
+	}
+	return key, nil
+}
+
+// ParseJWTHeader reads the key described by the protected header of a
+// compact-serialized JWS or JWE. The token itself is not verified.
+func ParseJWTHeader(token string) (JWTKey, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 && len(parts) != 5 {
+		return JWTKey{}, fmt.Errorf("Not a compact JWT: found %d parts", len(parts))
+	}
+	header, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return JWTKey{}, fmt.Errorf("Could not decode JWT header: %s", err)
+	}
+
+	var k jwk
+	if err := json.Unmarshal(header, &k); err != nil {
+		return JWTKey{}, fmt.Errorf("Could not decode JWT header: %s", err)
+	}
+	return k.parse()
+}
+
+// ParseJWKS reads the keys in a JSON Web Key Set that have x5c chains.
+func ParseJWKS(data []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("Could not decode JWKS: %s", err)
+	}
+
+	var keys []JWTKey
+	for i, k := range set.Keys {
+		if len(k.X5C) == 0 {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("Key %d (%s): %s", i, k.KeyID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// jwtKeyTypes maps JWS algorithms to the key descriptions, from DescribeKey
+// and DescribePublicKeyInfo, they need. RSA algorithms take any size.
+var jwtKeyTypes = map[string]string{
+	"RS256": "RSA", "RS384": "RSA", "RS512": "RSA",
+	"PS256": "RSA", "PS384": "RSA", "PS512": "RSA",
+	"ES256": "ECDSA P-256", "ES384": "ECDSA P-384", "ES512": "ECDSA P-521",
+	"EdDSA": "Ed25519",
+}
+
+// AnalyzeJWTKey lists, at the given time, the reasons the certificate for a
+// signing key is unsuitable: its validity, key strength and usages, the
+// match between its key and the algorithm, the x5t#S256 thumbprint, and the
+// order of the x5c chain.
+func AnalyzeJWTKey(key JWTKey, at time.Time) []string {
+	if len(key.Chain) == 0 {
+		return []string{"No x5c certificate chain"}
+	}
+	cert := key.Chain[0]
+
+	var problems []string
+	switch {
+	case at.Before(cert.NotBefore):
+		problems = append(problems, "Signing certificate is not yet valid")
+	case at.After(cert.NotAfter):
+		problems = append(problems, "Signing certificate expired "+cert.NotAfter.Format("2006-01-02"))
+	}
+
+	description := DescribePublicKeyInfo(cert.RawSubjectPublicKeyInfo)
+	if _, weak := DescribeKey(cert.PublicKey); weak {
+		problems = append(problems, "Weak key: "+description)
+	}
+	if key.Algorithm == "none" {
+		problems = append(problems, "Algorithm is none")
+	} else if required, ok := jwtKeyTypes[key.Algorithm]; ok && !strings.HasPrefix(description, required) {
+		problems = append(problems, fmt.Sprintf("Algorithm %s needs %s, not %s", key.Algorithm, required, description))
+	}
+	if key.Use == "enc" {
+		problems = append(problems, "Key is for encryption, not signatures")
+	}
+
+	if cert.IsCA {
+		problems = append(problems, "Signing certificate is a CA certificate")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		problems = append(problems, "Key usage does not include digitalSignature")
+	}
+	if len(cert.ExtKeyUsage) > 0 || len(cert.UnknownExtKeyUsage) > 0 {
+		anyUsage := false
+		var usages []string
+		for _, usage := range cert.ExtKeyUsage {
+			anyUsage = anyUsage || usage == x509.ExtKeyUsageAny
+			usages = append(usages, ExtKeyUsageName(usage))
+		}
+		for _, usage := range cert.UnknownExtKeyUsage {
+			usages = append(usages, usage.String())
+		}
+		if !anyUsage {
+			problems = append(problems, fmt.Sprintf("Extended key usage limits the certificate to %s", strings.Join(usages, ", ")))
+		}
+	}
+
+	if len(key.Thumbprint) > 0 {
+		digest := sha256.Sum256(cert.Raw)
+		if !bytes.Equal(key.Thumbprint, digest[:]) {
+			problems = append(problems, "x5t#S256 does not match the signing certificate")
+		}
+	}
+	for i := 1; i < len(key.Chain); i++ {
+		if !IssuedBy(key.Chain[i-1], key.Chain[i]) {
+			problems = append(problems, fmt.Sprintf("x5c[%d] did not issue x5c[%d]", i, i-1))
+		}
+	}
+	return problems
+}
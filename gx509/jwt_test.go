@@ -0,0 +1,115 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testX5C(certs ...*x509.Certificate) []string {
+	var x5c []string
+	for _, cert := range certs {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return x5c
+}
+
+func testJWT(t *testing.T, header map[string]interface{}) string {
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("Could not encode header: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded) + ".e30.c2lnbmF0dXJl"
+}
+
+func TestParseJWTHeader(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	thumbprint := sha256.Sum256(chain[0].Raw)
+	key, err := ParseJWTHeader(testJWT(t, map[string]interface{}{
+		"alg":      "RS256",
+		"kid":      "signing-1",
+		"x5c":      testX5C(chain[0], chain[1]),
+		"x5t#S256": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}))
+	if err != nil {
+		t.Fatalf("Could not parse JWT: %s", err)
+	}
+	if key.KeyID != "signing-1" || key.Algorithm != "RS256" || len(key.Chain) != 2 || !key.Chain[1].Equal(chain[1]) {
+		t.Errorf("Unexpected key: %+v", key)
+	}
+
+	at := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	expected := []string{
+		"Weak key: RSA 512",
+		"Extended key usage limits the certificate to serverAuth",
+	}
+	if problems := AnalyzeJWTKey(key, at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	key.Chain[0], key.Chain[1] = key.Chain[1], key.Chain[0]
+	expected = []string{
+		"Weak key: RSA 512",
+		"Signing certificate is a CA certificate",
+		"Extended key usage limits the certificate to serverAuth",
+		"x5t#S256 does not match the signing certificate",
+		"x5c[1] did not issue x5c[0]",
+	}
+	if problems := AnalyzeJWTKey(key, at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	for _, token := range []string{"not a token", "!!!.e30.sig", testJWT(t, map[string]interface{}{"x5c": []string{"AAAA"}})} {
+		if _, err := ParseJWTHeader(token); err == nil {
+			t.Errorf("Expected an error parsing %q", token)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	t.Parallel()
+
+	ecKey, _ := testECKey(t)
+	cert := certifyKey(t, "tokens.example.com", &ecKey.PublicKey)
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{"kid": "bare", "kty": "RSA", "n": "AQAB", "e": "AQAB"},
+			{"kid": "ec", "kty": "EC", "alg": "ES256", "use": "sig", "x5c": testX5C(cert)},
+			{"kid": "wrong", "kty": "EC", "alg": "RS256", "use": "enc", "x5c": testX5C(cert)},
+		},
+	})
+
+	keys, err := ParseJWKS(jwks)
+	if err != nil {
+		t.Fatalf("Could not parse JWKS: %s", err)
+	}
+	if len(keys) != 2 || keys[0].KeyID != "ec" || keys[1].KeyID != "wrong" {
+		t.Fatalf("Unexpected keys %+v", keys)
+	}
+
+	at := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if problems := AnalyzeJWTKey(keys[0], at); !reflect.DeepEqual(problems, []string{"Signing certificate expired 2028-03-01"}) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	at = time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	expected := []string{
+		"Algorithm RS256 needs RSA, not ECDSA P-256",
+		"Key is for encryption, not signatures",
+	}
+	if problems := AnalyzeJWTKey(keys[1], at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	if problems := AnalyzeJWTKey(JWTKey{}, at); len(problems) != 1 {
+		t.Errorf("Expected a problem for a key without a chain")
+	}
+}
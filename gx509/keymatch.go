@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+)
+
+// ParseKeyBlock returns the DER SubjectPublicKeyInfo of a private or public
+// key PEM block, and whether the block held a private key. Public keys may be
+// PKIX or PKCS#1 RSA.
+func ParseKeyBlock(block *pem.Block) (public []byte, private bool, err error) {
+	if IsPrivateKeyBlock(block) {
+		key, err := ParsePrivateKeyBlock(block)
+		if err != nil {
+			return nil, true, err
+		}
+		return key.Public, true, nil
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = NormalizePublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		var key pkcs1PublicKey
+		if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+			return nil, false, err
+		}
+		public, err = marshalPublicKey(&rsa.PublicKey{N: key.N, E: key.E})
+	default:
+		return nil, false, fmt.Errorf("Unknown key type: %s", block.Type)
+	}
+	return public, false, err
+}
+
+type pkcs1PublicKey struct {
+	N *big.Int
+	E int
+}
+
+// NormalizePublicKey re-encodes a DER SubjectPublicKeyInfo the way
+// x509.MarshalPKIXPublicKey would, so that keys with superfluous or missing
+// parameters compare equal.
+func NormalizePublicKey(spki []byte) ([]byte, error) {
+	var info subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(spki, &info); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after public key")
+	}
+	if info.Algorithm.Algorithm.Equal(oidEd25519) {
+		if len(info.PublicKey.Bytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid Ed25519 public key length %d", len(info.PublicKey.Bytes))
+		}
+		return marshalPublicKey(ed25519.PublicKey(info.PublicKey.Bytes))
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, err
+	}
+	return marshalPublicKey(pub)
+}
+
+// DescribePublicKeyInfo names the type and size of the key in a DER
+// SubjectPublicKeyInfo, as DescribeKey does.
+func DescribePublicKeyInfo(spki []byte) string {
+	var info subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(spki, &info); err == nil && info.Algorithm.Algorithm.Equal(oidEd25519) {
+		return "Ed25519"
+	}
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return "unknown"
+	}
+	description, _ := DescribeKey(pub)
+	return description
+}
+
+// PublicKeysMatch reports whether two DER SubjectPublicKeyInfos hold the same
+// key, however each is encoded.
+func PublicKeysMatch(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	normalA, err := NormalizePublicKey(a)
+	if err != nil {
+		return false
+	}
+	normalB, err := NormalizePublicKey(b)
+	return err == nil && bytes.Equal(normalA, normalB)
+}
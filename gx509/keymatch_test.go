@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+)
+
+func TestParseKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	cert := testChain(t, "www.example.com")[0]
+
+	public, private, err := ParseKeyBlock(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testPrivateKey)})
+	if err != nil || !private || !PublicKeysMatch(public, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Expected the private key to match: %v", err)
+	}
+
+	public, private, err = ParseKeyBlock(&pem.Block{Type: "PUBLIC KEY", Bytes: cert.RawSubjectPublicKeyInfo})
+	if err != nil || private || !PublicKeysMatch(public, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Expected the public key to match: %v", err)
+	}
+
+	pkcs1, _ := asn1.Marshal(pkcs1PublicKey{N: testPrivateKey.N, E: testPrivateKey.E})
+	public, private, err = ParseKeyBlock(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkcs1})
+	if err != nil || private || !PublicKeysMatch(public, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Expected the PKCS#1 public key to match: %v", err)
+	}
+
+	if _, _, err := ParseKeyBlock(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err == nil {
+		t.Errorf("Expected an error for a certificate")
+	}
+}
+
+func TestPublicKeysMatch(t *testing.T) {
+	t.Parallel()
+
+	cert := testChain(t, "www.example.com")[0]
+
+	// The same RSA key, without the customary NULL parameters
+	var info subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &info); err != nil {
+		t.Fatalf("Could not parse public key: %s", err)
+	}
+	bare, _ := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: info.Algorithm.Algorithm},
+		PublicKey: info.PublicKey,
+	})
+	if !PublicKeysMatch(bare, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Expected keys to match despite their encodings")
+	}
+
+	ecKey, _ := testECKey(t)
+	ecPublic, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if PublicKeysMatch(ecPublic, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Did not expect different keys to match")
+	}
+	if PublicKeysMatch([]byte("garbage"), cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Did not expect garbage to match")
+	}
+
+	edPublic, _ := marshalPublicKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public())
+	for spki, expected := range map[string]string{
+		string(cert.RawSubjectPublicKeyInfo): "RSA 512",
+		string(ecPublic):                     "ECDSA P-256",
+		string(edPublic):                     "Ed25519",
+		"garbage":                            "unknown",
+	} {
+		if description := DescribePublicKeyInfo([]byte(spki)); description != expected {
+			t.Errorf("Expected %s, got %s", expected, description)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+)
+
+// Keys smaller than these are considered weak.
+const (
+	MinRSAKeyBits   = 2048
+	MinECDSAKeyBits = 256
+)
+
+// DescribeKey names the algorithm and size of a public key, e.g. "RSA 2048",
+// and reports whether it is weak by current CA/Browser Forum standards.
+func DescribeKey(pub interface{}) (description string, weak bool) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		bits := key.N.BitLen()
+		return fmt.Sprintf("RSA %d", bits), bits < MinRSAKeyBits
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name), bits < MinECDSAKeyBits
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA %d", key.P.BitLen()), true
+	default:
+		return fmt.Sprintf("%T", pub), false
+	}
+}
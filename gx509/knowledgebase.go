@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The knowledge base shipped with this package.
+//
+//go:embed clients.yaml
+var embeddedKnowledgeBase []byte
+
+// A KnowledgeBase is a versioned set of client behaviors, normally loaded from
+// YAML so that behavior changes in verifiers do not require code changes.
+type KnowledgeBase struct {
+	Version string
+	Clients []ClientBehavior
+}
+
+// DefaultKnowledgeBase is the knowledge base embedded in this package.
+var DefaultKnowledgeBase = mustParseKnowledgeBase(embeddedKnowledgeBase)
+
+// EmbeddedKnowledgeBase returns the YAML source of DefaultKnowledgeBase.
+func EmbeddedKnowledgeBase() []byte {
+	return append([]byte(nil), embeddedKnowledgeBase...)
+}
+
+type validityLimitYAML struct {
+	Since   time.Time `yaml:"since"`
+	MaxDays int       `yaml:"maxDays"`
+}
+
+type clientBehaviorYAML struct {
+	Name                        string              `yaml:"name"`
+	CommonNameFallback          bool                `yaml:"commonNameFallback"`
+	ConstrainsCommonName        bool                `yaml:"constrainsCommonName"`
+	LeadingDotSubdomainsOnly    bool                `yaml:"leadingDotSubdomainsOnly"`
+	RejectsLeadingDotConstraint bool                `yaml:"rejectsLeadingDotConstraint"`
+	EnforcesIPConstraints       bool                `yaml:"enforcesIPConstraints"`
+	EnforcesEKUChaining         bool                `yaml:"enforcesEKUChaining"`
+	StepUpAsServerAuth          bool                `yaml:"stepUpAsServerAuth"`
+	RequiresLeafServerAuthEKU   bool                `yaml:"requiresLeafServerAuthEKU"`
+	MaxLeafValidity             []validityLimitYAML `yaml:"maxLeafValidity"`
+	RejectedSignatureAlgorithms []string            `yaml:"rejectedSignatureAlgorithms"`
+	MinRSAKeyBits               int                 `yaml:"minRSAKeyBits"`
+	BuildsAlternatePaths        bool                `yaml:"buildsAlternatePaths"`
+}
+
+type knowledgeBaseYAML struct {
+	Version string               `yaml:"version"`
+	Clients []clientBehaviorYAML `yaml:"clients"`
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given name,
+// as printed by x509.SignatureAlgorithm.String (e.g. "SHA1-RSA").
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for algo := x509.MD2WithRSA; algo < 64; algo++ {
+		if algo.String() == name {
+			return algo, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unknown signature algorithm: %s", name)
+}
+
+// ParseKnowledgeBase decodes a YAML knowledge base.
+func ParseKnowledgeBase(data []byte) (*KnowledgeBase, error) {
+	var raw knowledgeBaseYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+
+	if len(raw.Version) == 0 {
+		return nil, fmt.Errorf("Knowledge base has no version")
+	}
+	if len(raw.Clients) == 0 {
+		return nil, fmt.Errorf("Knowledge base %s has no clients", raw.Version)
+	}
+
+	kb := &KnowledgeBase{Version: raw.Version}
+	for _, entry := range raw.Clients {
+		if len(entry.Name) == 0 {
+			return nil, fmt.Errorf("Knowledge base %s has a client without a name", raw.Version)
+		}
+
+		client := ClientBehavior{
+			Name:                        entry.Name,
+			CommonNameFallback:          entry.CommonNameFallback,
+			ConstrainsCommonName:        entry.ConstrainsCommonName,
+			LeadingDotSubdomainsOnly:    entry.LeadingDotSubdomainsOnly,
+			RejectsLeadingDotConstraint: entry.RejectsLeadingDotConstraint,
+			EnforcesIPConstraints:       entry.EnforcesIPConstraints,
+			EnforcesEKUChaining:         entry.EnforcesEKUChaining,
+			StepUpAsServerAuth:          entry.StepUpAsServerAuth,
+			RequiresLeafServerAuthEKU:   entry.RequiresLeafServerAuthEKU,
+			MinRSAKeyBits:               entry.MinRSAKeyBits,
+			BuildsAlternatePaths:        entry.BuildsAlternatePaths,
+		}
+		for _, limit := range entry.MaxLeafValidity {
+			client.MaxLeafValidity = append(client.MaxLeafValidity,
+				ValidityLimit{Since: limit.Since, MaxDays: limit.MaxDays})
+		}
+		for _, name := range entry.RejectedSignatureAlgorithms {
+			algo, err := ParseSignatureAlgorithm(name)
+			if err != nil {
+				return nil, fmt.Errorf("Client %s: %s", entry.Name, err)
+			}
+			client.RejectedSignatureAlgorithms = append(client.RejectedSignatureAlgorithms, algo)
+		}
+
+		kb.Clients = append(kb.Clients, client)
+	}
+
+	return kb, nil
+}
+
+func mustParseKnowledgeBase(data []byte) *KnowledgeBase {
+	kb, err := ParseKnowledgeBase(data)
+	if err != nil {
+		panic("Failed to parse embedded knowledge base: " + err.Error())
+	}
+	return kb
+}
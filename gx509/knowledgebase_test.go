@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedKnowledgeBase(t *testing.T) {
+	t.Parallel()
+
+	if len(DefaultKnowledgeBase.Version) == 0 {
+		t.Errorf("Embedded knowledge base has no version")
+	}
+
+	var safari *ClientBehavior
+	for i, client := range DefaultKnowledgeBase.Clients {
+		if client.Name == "Safari" {
+			safari = &DefaultKnowledgeBase.Clients[i]
+		}
+	}
+	if safari == nil {
+		t.Fatalf("Embedded knowledge base has no Safari entry")
+	}
+
+	days, ok := safari.maxLeafValidityAt(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if !ok || days != 825 {
+		t.Errorf("Expected an 825 day limit, got %d (%v)", days, ok)
+	}
+	days, ok = safari.maxLeafValidityAt(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if !ok || days != 398 {
+		t.Errorf("Expected a 398 day limit, got %d (%v)", days, ok)
+	}
+	if _, ok = safari.maxLeafValidityAt(time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("Expected no limit before 2019")
+	}
+}
+
+func TestParseKnowledgeBase(t *testing.T) {
+	t.Parallel()
+
+	kb, err := ParseKnowledgeBase([]byte(`
+version: "test"
+clients:
+  - name: Strict
+    enforcesEKUChaining: true
+    rejectedSignatureAlgorithms: [SHA1-RSA]
+    minRSAKeyBits: 4096
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse knowledge base: %s", err)
+	}
+
+	if kb.Version != "test" || len(kb.Clients) != 1 {
+		t.Fatalf("Unexpected knowledge base: %+v", kb)
+	}
+	client := kb.Clients[0]
+	if !client.EnforcesEKUChaining || client.MinRSAKeyBits != 4096 {
+		t.Errorf("Unexpected client: %+v", client)
+	}
+	if len(client.RejectedSignatureAlgorithms) != 1 ||
+		client.RejectedSignatureAlgorithms[0] != x509.SHA1WithRSA {
+		t.Errorf("Unexpected signature algorithms: %v", client.RejectedSignatureAlgorithms)
+	}
+}
+
+func TestParseKnowledgeBaseErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		`clients: [{name: A}]`,
+		`version: "1"`,
+		`{version: "1", clients: [{name: A, rejectedSignatureAlgorithms: [ROT13]}]}`,
+		`{version: "1", clients: [{name: A, unknownField: true}]}`,
+	} {
+		if _, err := ParseKnowledgeBase([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+}
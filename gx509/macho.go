@@ -0,0 +1,155 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	machoCodeSignature   = 0x1d
+	codeSignatureMagic   = 0xfade0cc0
+	cmsSignatureMagic    = 0xfade0b01
+	codeSignatureCMSSlot = 0x10000
+	// maxIPABinarySize bounds the executables read from an IPA.
+	maxIPABinarySize = 512 << 20
+)
+
+// ExtractMachOSignatures reads the CMS signatures from a code-signed Mach-O
+// file, which may be universal. Ad hoc signatures carry no certificates, so
+// binaries with them have none.
+func ExtractMachOSignatures(r io.ReaderAt) ([]CodeSignature, error) {
+	if fat, err := macho.NewFatFile(r); err == nil {
+		defer fat.Close()
+		var signatures []CodeSignature
+		for _, arch := range fat.Arches {
+			found, err := machoSignatures(r, int64(arch.Offset), arch.File)
+			if err != nil {
+				return nil, fmt.Errorf("%s slice: %s", arch.Cpu, err)
+			}
+			signatures = append(signatures, found...)
+		}
+		return signatures, nil
+	}
+
+	file, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return machoSignatures(r, 0, file)
+}
+
+// machoSignatures reads the signatures of file, which starts at base in r.
+func machoSignatures(r io.ReaderAt, base int64, file *macho.File) ([]CodeSignature, error) {
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 || file.ByteOrder.Uint32(raw) != machoCodeSignature {
+			continue
+		}
+		offset := file.ByteOrder.Uint32(raw[8:])
+		size := file.ByteOrder.Uint32(raw[12:])
+		if size > maxAuthenticodeSize {
+			return nil, fmt.Errorf("Code signature of %d bytes is too large", size)
+		}
+
+		// The code signature itself is always big-endian
+		superBlob := make([]byte, size)
+		if _, err := r.ReadAt(superBlob, base+int64(offset)); err != nil {
+			return nil, fmt.Errorf("Could not read code signature: %s", err)
+		}
+		if len(superBlob) < 12 || binary.BigEndian.Uint32(superBlob) != codeSignatureMagic {
+			return nil, fmt.Errorf("Malformed code signature")
+		}
+		count := binary.BigEndian.Uint32(superBlob[8:])
+		for i := uint32(0); i < count; i++ {
+			entry := 12 + 8*int(i)
+			if entry+8 > len(superBlob) {
+				return nil, fmt.Errorf("Truncated code signature index")
+			}
+			if binary.BigEndian.Uint32(superBlob[entry:]) != codeSignatureCMSSlot {
+				continue
+			}
+
+			blob := int(binary.BigEndian.Uint32(superBlob[entry+4:]))
+			if blob+8 > len(superBlob) || binary.BigEndian.Uint32(superBlob[blob:]) != cmsSignatureMagic {
+				return nil, fmt.Errorf("Malformed CMS signature blob")
+			}
+			length := int(binary.BigEndian.Uint32(superBlob[blob+4:]))
+			if length < 8 || blob+length > len(superBlob) {
+				return nil, fmt.Errorf("Malformed CMS signature blob")
+			}
+			if length == 8 {
+				// Ad hoc
+				return nil, nil
+			}
+			return parseCMSSignatures(superBlob[blob+8:blob+length], CodeSignatureMachO, 0)
+		}
+	}
+	return nil, nil
+}
+
+// isMachO reports whether header starts a Mach-O or universal file.
+func isMachO(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat:
+		return true
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	return false
+}
+
+// ExtractIPASignatures reads the signatures of every Mach-O file in an iOS
+// app archive, keyed by path within the archive.
+func ExtractIPASignatures(r io.ReaderAt, size int64) (map[string][]CodeSignature, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make(map[string][]CodeSignature)
+	for _, file := range archive.File {
+		if !strings.HasPrefix(file.Name, "Payload/") || file.FileInfo().IsDir() ||
+			file.UncompressedSize64 < 4 || file.UncompressedSize64 > maxIPABinarySize {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		header := make([]byte, 4)
+		_, err = io.ReadFull(reader, header)
+		reader.Close()
+		if err != nil || !isMachO(header) {
+			continue
+		}
+
+		contents, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		found, err := ExtractMachOSignatures(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Name, err)
+		}
+		if len(found) > 0 {
+			signatures[file.Name] = found
+		}
+	}
+	return signatures, nil
+}
@@ -0,0 +1,103 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"testing"
+)
+
+// testMachO builds a 64-bit Mach-O file, without segments, whose code
+// signature holds cms as its CMS blob.
+func testMachO(cms []byte) []byte {
+	const headerSize, commandSize = 32, 16
+	blob := make([]byte, 8, 8+len(cms))
+	binary.BigEndian.PutUint32(blob, cmsSignatureMagic)
+	binary.BigEndian.PutUint32(blob[4:], uint32(8+len(cms)))
+	blob = append(blob, cms...)
+
+	superBlob := make([]byte, 20, 20+len(blob))
+	binary.BigEndian.PutUint32(superBlob, codeSignatureMagic)
+	binary.BigEndian.PutUint32(superBlob[4:], uint32(20+len(blob)))
+	binary.BigEndian.PutUint32(superBlob[8:], 1)
+	binary.BigEndian.PutUint32(superBlob[12:], codeSignatureCMSSlot)
+	binary.BigEndian.PutUint32(superBlob[16:], 20)
+	superBlob = append(superBlob, blob...)
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.LittleEndian, macho.FileHeader{
+		Magic:  macho.Magic64,
+		Cpu:    macho.CpuArm64,
+		Type:   macho.TypeExec,
+		Ncmd:   1,
+		Cmdsz:  commandSize,
+		Flags:  0,
+		SubCpu: 0,
+	})
+	file.Write(make([]byte, 4))
+	binary.Write(&file, binary.LittleEndian, []uint32{
+		machoCodeSignature, commandSize, headerSize + commandSize, uint32(len(superBlob)),
+	})
+	file.Write(superBlob)
+	return file.Bytes()
+}
+
+func TestExtractMachOSignatures(t *testing.T) {
+	t.Parallel()
+
+	chain := testCodeSigningChain(t)
+	binary := testMachO(testSignedData(t, chain[0], oidSHA256, nil, chain[0], chain[1]))
+	signatures, err := ExtractMachOSignatures(bytes.NewReader(binary))
+	if err != nil {
+		t.Fatalf("Could not extract signatures: %s", err)
+	}
+	if len(signatures) != 1 {
+		t.Fatalf("Expected 1 signature, got %d", len(signatures))
+	}
+	if signatures[0].Format != CodeSignatureMachO || !signatures[0].Signer.Equal(chain[0]) || len(signatures[0].Chain) != 2 {
+		t.Errorf("Unexpected signature: %+v", signatures[0])
+	}
+
+	adHoc, err := ExtractMachOSignatures(bytes.NewReader(testMachO(nil)))
+	if err != nil || len(adHoc) != 0 {
+		t.Errorf("Expected no signatures for an ad hoc signature, got %d and %v", len(adHoc), err)
+	}
+	if _, err := ExtractMachOSignatures(bytes.NewReader([]byte("not a Mach-O file"))); err == nil {
+		t.Errorf("Expected an error for a file that is not Mach-O")
+	}
+}
+
+func TestExtractIPASignatures(t *testing.T) {
+	t.Parallel()
+
+	chain := testCodeSigningChain(t)
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, contents := range map[string][]byte{
+		"Payload/Acme.app/Acme":                  testMachO(testSignedData(t, chain[0], oidSHA256, nil, chain[0], chain[1])),
+		"Payload/Acme.app/Info.plist":            []byte("<plist/>"),
+		"Payload/Acme.app/Frameworks/Ad.dylib":   testMachO(nil),
+		"Payload/Acme.app/_CodeSignature/Sealed": []byte("resources"),
+		"iTunesMetadata.plist":                   []byte("<plist/>"),
+		"Symbols/Acme":                           testMachO(testSignedData(t, chain[0], oidSHA256, nil, chain[0])),
+	} {
+		file, _ := writer.Create(name)
+		file.Write(contents)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not write IPA: %s", err)
+	}
+
+	signatures, err := ExtractIPASignatures(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("Could not extract signatures: %s", err)
+	}
+	if len(signatures) != 1 || len(signatures["Payload/Acme.app/Acme"]) != 1 {
+		t.Errorf("Expected one signed executable, got %v", signatures)
+	}
+}
@@ -0,0 +1,255 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var oidExtensionNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+// NameConstraints are the subtrees of a certificate's nameConstraints
+// extension that crypto/x509 does not parse.
+type NameConstraints struct {
+	// PermittedEmailAddresses and ExcludedEmailAddresses are the rfc822Name
+	// subtrees: a mailbox, a host for all mailboxes at it, or a domain
+	// starting with a dot for all mailboxes at its subdomains.
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	// PermittedDirectoryNames and ExcludedDirectoryNames are the
+	// directoryName subtrees, DER-encoded like a certificate's RawSubject;
+	// FormatDistinguishedName formats them.
+	PermittedDirectoryNames [][]byte
+	ExcludedDirectoryNames  [][]byte
+}
+
+// generalSubtree is a GeneralSubtree, with its base left for the caller to
+// decode as a GeneralName.
+type generalSubtree struct {
+	Base    asn1.RawValue
+	Minimum int `asn1:"optional,tag:0"`
+	Maximum int `asn1:"optional,tag:1"`
+}
+
+type nameConstraintsASN1 struct {
+	Permitted []generalSubtree `asn1:"optional,tag:0"`
+	Excluded  []generalSubtree `asn1:"optional,tag:1"`
+}
+
+// The tags of the GeneralName choices in generalSubtree.Base.
+const (
+	generalNameRFC822Name    = 1
+	generalNameDirectoryName = 4
+)
+
+// addSubtree adds the subtree's base to emails or directoryNames, if it is
+// one of those.
+func addSubtree(subtree generalSubtree, emails *[]string, directoryNames *[][]byte) error {
+	if subtree.Base.Class != asn1.ClassContextSpecific {
+		return nil
+	}
+	switch subtree.Base.Tag {
+	case generalNameRFC822Name:
+		*emails = append(*emails, string(subtree.Base.Bytes))
+	case generalNameDirectoryName:
+		// directoryName is explicitly tagged, so holds a complete Name
+		var name asn1.RawValue
+		if rest, err := asn1.Unmarshal(subtree.Base.Bytes, &name); err != nil {
+			return fmt.Errorf("Could not decode directoryName constraint: %s", err)
+		} else if len(rest) != 0 || name.Tag != asn1.TagSequence {
+			return fmt.Errorf("Invalid directoryName constraint")
+		}
+		*directoryNames = append(*directoryNames, name.FullBytes)
+	}
+	return nil
+}
+
+// ParseNameConstraints decodes the nameConstraints extension of cert. A
+// certificate without the extension has no constraints.
+func ParseNameConstraints(cert *x509.Certificate) (NameConstraints, error) {
+	var constraints NameConstraints
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(oidExtensionNameConstraints) {
+			continue
+		}
+
+		var raw nameConstraintsASN1
+		if rest, err := asn1.Unmarshal(extension.Value, &raw); err != nil {
+			return constraints, fmt.Errorf("Could not decode name constraints: %s", err)
+		} else if len(rest) != 0 {
+			return constraints, fmt.Errorf("Trailing data after name constraints")
+		}
+		for _, subtree := range raw.Permitted {
+			if err := addSubtree(subtree, &constraints.PermittedEmailAddresses, &constraints.PermittedDirectoryNames); err != nil {
+				return constraints, err
+			}
+		}
+		for _, subtree := range raw.Excluded {
+			if err := addSubtree(subtree, &constraints.ExcludedEmailAddresses, &constraints.ExcludedDirectoryNames); err != nil {
+				return constraints, err
+			}
+		}
+	}
+	return constraints, nil
+}
+
+// matchDNSConstraint reports whether name falls within the dNSName subtree
+// constraint. RFC 5280 says "example.com" covers the host and all of its
+// subdomains; a leading dot is not defined for dNSName, but most verifiers
+// treat ".example.com" as covering subdomains only. When
+// leadingDotSubdomainsOnly is false the leading dot is simply ignored.
+func matchDNSConstraint(name, constraint string, leadingDotSubdomainsOnly bool) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	constraint = strings.ToLower(strings.TrimSuffix(constraint, "."))
+
+	// An empty constraint matches every name.
+	if len(constraint) == 0 {
+		return true
+	}
+
+	if strings.HasPrefix(constraint, ".") {
+		if leadingDotSubdomainsOnly {
+			return strings.HasSuffix(name, constraint)
+		}
+		constraint = constraint[1:]
+	}
+
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// ipNetContains is like net.IPNet.Contains, but tolerates IPv4 networks that
+// were encoded with 16-byte addresses or masks. IPv4 addresses, in either
+// form, only match IPv4 networks, and IPv6 addresses IPv6 ones.
+func ipNetContains(network net.IPNet, ip net.IP) bool {
+	netIP := network.IP
+	mask := network.Mask
+	if v4 := netIP.To4(); v4 != nil {
+		netIP = v4
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if len(ip) != len(netIP) || len(mask) != len(ip) {
+		return false
+	}
+	for i := range ip {
+		if ip[i]&mask[i] != netIP[i]&mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dnsNamePermitted reports whether name is inside the permitted dNSName
+// subtrees of cert (if there are any) and outside all of its excluded ones.
+func dnsNamePermitted(cert *x509.Certificate, name string, leadingDotSubdomainsOnly bool) bool {
+	for _, excluded := range cert.ExcludedDNSDomains {
+		if matchDNSConstraint(name, excluded, leadingDotSubdomainsOnly) {
+			return false
+		}
+	}
+
+	if len(cert.PermittedDNSDomains) == 0 {
+		return true
+	}
+	for _, permitted := range cert.PermittedDNSDomains {
+		if matchDNSConstraint(name, permitted, leadingDotSubdomainsOnly) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAddressPermitted reports whether ip is inside the permitted iPAddress
+// subtrees of cert (if there are any) and outside all of its excluded ones.
+func ipAddressPermitted(cert *x509.Certificate, ip net.IP) bool {
+	for _, excluded := range cert.ExcludedIPAddresses {
+		if ipNetContains(excluded, ip) {
+			return false
+		}
+	}
+
+	if len(cert.PermittedIPAddresses) == 0 {
+		return true
+	}
+	for _, permitted := range cert.PermittedIPAddresses {
+		if ipNetContains(permitted, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDNSName is whether name is a syntactically valid DNS name, which may
+// have a wildcard as its leftmost label.
+func validDNSName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for i, label := range strings.Split(name, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			switch {
+			case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			case r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PermitsDNSName reports whether cert's dNSName constraints allow a
+// certificate for name beneath it. A constraint covers its host and every
+// subdomain, as RFC 5280 says, or only the subdomains if it has a leading
+// dot, as verifiers treat it. Wildcard names are matched as written, so
+// "*.example.com" is permitted under "example.com" even if some of its
+// subdomains are excluded.
+func PermitsDNSName(cert *x509.Certificate, name string) (bool, error) {
+	if !validDNSName(name) {
+		return false, fmt.Errorf("Invalid DNS name: %q", name)
+	}
+	return dnsNamePermitted(cert, name, true), nil
+}
+
+// PermitsIPAddress reports whether cert's iPAddress constraints allow a
+// certificate for ip beneath it.
+func PermitsIPAddress(cert *x509.Certificate, ip net.IP) (bool, error) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return false, fmt.Errorf("Invalid IP address: %v", ip)
+	}
+	return ipAddressPermitted(cert, ip), nil
+}
+
+// looksLikeHostname is true if s could plausibly be a DNS name, which is the
+// heuristic verifiers use before applying name constraints to a commonName.
+func looksLikeHostname(s string) bool {
+	if len(s) == 0 || !strings.Contains(s, ".") || net.ParseIP(s) != nil {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '.', r == '*', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+var attributeTypeNames = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{asn1.ObjectIdentifier{2, 5, 4, 3}, "CN"},
+	{asn1.ObjectIdentifier{2, 5, 4, 5}, "SERIALNUMBER"},
+	{asn1.ObjectIdentifier{2, 5, 4, 6}, "C"},
+	{asn1.ObjectIdentifier{2, 5, 4, 7}, "L"},
+	{asn1.ObjectIdentifier{2, 5, 4, 8}, "ST"},
+	{asn1.ObjectIdentifier{2, 5, 4, 9}, "STREET"},
+	{asn1.ObjectIdentifier{2, 5, 4, 10}, "O"},
+	{asn1.ObjectIdentifier{2, 5, 4, 11}, "OU"},
+	{asn1.ObjectIdentifier{2, 5, 4, 17}, "POSTALCODE"},
+	{asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}, "DC"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, "emailAddress"},
+}
+
+func attributeTypeName(oid asn1.ObjectIdentifier) string {
+	for _, entry := range attributeTypeNames {
+		if entry.oid.Equal(oid) {
+			return entry.name
+		}
+	}
+	return oid.String()
+}
+
+// escapeAttributeValue escapes a string as RFC 4514 section 2.4 requires.
+func escapeAttributeValue(value string) string {
+	var escaped strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`"+,;<>\`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r == 0:
+			escaped.WriteString(`\00`)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// FormatDistinguishedName formats a DER-encoded name, such as a certificate's
+// RawSubject or RawIssuer, as an RFC 4514 string, e.g. "CN=Example,O=Acme".
+// Attributes that are not strings are written as hex-encoded DER.
+func FormatDistinguishedName(raw []byte) (string, error) {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(raw, &rdns); err != nil {
+		return "", err
+	} else if len(rest) > 0 {
+		return "", fmt.Errorf("Trailing data after name")
+	}
+
+	parts := make([]string, 0, len(rdns))
+	// The most specific attribute comes first in the string form
+	for i := len(rdns) - 1; i >= 0; i-- {
+		attributes := make([]string, 0, len(rdns[i]))
+		for _, attribute := range rdns[i] {
+			var value string
+			if s, ok := attribute.Value.(string); ok {
+				value = escapeAttributeValue(s)
+			} else {
+				der, err := asn1.Marshal(attribute.Value)
+				if err != nil {
+					return "", err
+				}
+				value = fmt.Sprintf("#%x", der)
+			}
+			attributes = append(attributes, attributeTypeName(attribute.Type)+"="+value)
+		}
+		parts = append(parts, strings.Join(attributes, "+"))
+	}
+	return strings.Join(parts, ","), nil
+}
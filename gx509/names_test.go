@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestFormatDistinguishedName(t *testing.T) {
+	t.Parallel()
+
+	name := pkix.RDNSequence{
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 6}, Value: "US"}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "Example, Inc."}},
+		{
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 11}, Value: "Web"},
+			{Type: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: 7},
+		},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: " #1 CA "}},
+	}
+	raw, err := asn1.Marshal(name)
+	if err != nil {
+		t.Fatalf("Could not marshal name: %s", err)
+	}
+
+	formatted, err := FormatDistinguishedName(raw)
+	if err != nil {
+		t.Fatalf("Could not format name: %s", err)
+	}
+	// DER sorts the attributes of a multi-valued RDN
+	expected := `CN=\ #1 CA\ ,1.2.3.4=#020107+OU=Web,O=Example\, Inc.,C=US`
+	if formatted != expected {
+		t.Errorf("Expected %s, got %s", expected, formatted)
+	}
+
+	if _, err := FormatDistinguishedName([]byte{0x30, 0x05}); err == nil {
+		t.Errorf("Expected an error for a truncated name")
+	}
+}
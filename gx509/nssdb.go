@@ -0,0 +1,175 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// The PKCS#11 attributes and values read from NSS databases, which store
+// each attribute in a column named after its type in hex.
+const (
+	ckaClass                = 0x0
+	ckaLabel                = 0x3
+	ckaValue                = 0x11
+	ckaIssuer               = 0x81
+	ckaSerialNumber         = 0x82
+	ckaID                   = 0x102
+	ckaTrustServerAuth      = 0xce536358
+	ckaTrustCodeSigning     = 0xce53635a
+	ckaTrustEmailProtection = 0xce53635b
+
+	ckoCertificate = 0x1
+	ckoNSSTrust    = 0xce534353
+
+	cktNSSTrusted          = 0xce534351
+	cktNSSTrustedDelegator = 0xce534352
+	cktNSSNotTrusted       = 0xce53435a
+)
+
+// nssExplicitNull is how NSS stores an attribute with an empty value.
+var nssExplicitNull = []byte{0xa5, 0x00, 0x5a}
+
+var nssTrustAttributes = []struct {
+	attribute uint32
+	bit       TrustBits
+}{
+	{ckaTrustServerAuth, TrustServerAuth},
+	{ckaTrustEmailProtection, TrustEmailProtection},
+	{ckaTrustCodeSigning, TrustCodeSigning},
+}
+
+// An NSSCertificate is a certificate in an NSS database, such as a Firefox or
+// Thunderbird profile's, along with the trust the user has given it. The
+// built-in roots are not in the database, so every certificate in it was
+// added by the user or an application.
+type NSSCertificate struct {
+	Label string
+	Cert  *x509.Certificate
+	// Trusted are the purposes it is a trusted CA for.
+	Trusted TrustBits
+	// TrustedPeer are the purposes it is trusted for as an end entity, such
+	// as a server certificate exception.
+	TrustedPeer TrustBits
+	// Distrusted are the purposes it is explicitly not trusted for, which
+	// overrides the trust of a built-in root.
+	Distrusted TrustBits
+	// HasPrivateKey is set if the key database holds its private key.
+	HasPrivateKey bool
+}
+
+// Root is the certificate as a trust anchor for the purposes it is trusted
+// for as a CA.
+func (c NSSCertificate) Root() TrustedRoot {
+	return TrustedRoot{Label: c.Label, Cert: c.Cert, Trust: c.Trusted}
+}
+
+// IsSQLite reports whether data is an SQLite database, as NSS's cert9.db and
+// key4.db are.
+func IsSQLite(data []byte) bool {
+	return bytes.HasPrefix(data, sqliteMagic)
+}
+
+// An nssObject is a row of an NSS database table.
+type nssObject map[string]interface{}
+
+func (o nssObject) attribute(attribute uint32) []byte {
+	value, _ := o[fmt.Sprintf("a%x", attribute)].([]byte)
+	if bytes.Equal(value, nssExplicitNull) {
+		return []byte{}
+	}
+	return value
+}
+
+// ulong returns an attribute NSS stores as a 32-bit big-endian integer.
+func (o nssObject) ulong(attribute uint32) (uint32, bool) {
+	value := o.attribute(attribute)
+	if len(value) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(value), true
+}
+
+func readNSSObjects(data []byte, table string) ([]nssObject, error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.table(table)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]nssObject, len(rows))
+	for i, row := range rows {
+		objects[i] = row
+	}
+	return objects, nil
+}
+
+// ParseNSSDatabase reads the certificates and trust settings in an NSS
+// cert9.db. If key4 is given, the key4.db beside it, certificates with a
+// private key in it are marked. Neither database needs a password, since
+// only the public parts are read.
+func ParseNSSDatabase(cert9, key4 []byte) ([]NSSCertificate, error) {
+	objects, err := readNSSObjects(cert9, "nssPublic")
+	if err != nil {
+		return nil, fmt.Errorf("Could not read cert9.db: %s", err)
+	}
+	keyIDs := make(map[string]bool)
+	if key4 != nil {
+		keys, err := readNSSObjects(key4, "nssPrivate")
+		if err != nil {
+			return nil, fmt.Errorf("Could not read key4.db: %s", err)
+		}
+		for _, key := range keys {
+			if id := key.attribute(ckaID); len(id) > 0 {
+				keyIDs[string(id)] = true
+			}
+		}
+	}
+
+	// Trust objects name their certificate by issuer and serial number
+	trust := make(map[string]nssObject)
+	for _, object := range objects {
+		if class, _ := object.ulong(ckaClass); class == ckoNSSTrust {
+			trust[string(object.attribute(ckaIssuer))+string(object.attribute(ckaSerialNumber))] = object
+		}
+	}
+
+	var certs []NSSCertificate
+	for _, object := range objects {
+		if class, ok := object.ulong(ckaClass); !ok || class != ckoCertificate {
+			continue
+		}
+		label := strings.TrimRight(string(object.attribute(ckaLabel)), "\x00")
+		cert, err := x509.ParseCertificate(object.attribute(ckaValue))
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse %q: %s", label, err)
+		}
+
+		entry := NSSCertificate{Label: label, Cert: cert}
+		if id := object.attribute(ckaID); len(id) > 0 {
+			entry.HasPrivateKey = keyIDs[string(id)]
+		}
+		if settings, ok := trust[string(object.attribute(ckaIssuer))+string(object.attribute(ckaSerialNumber))]; ok {
+			for _, purpose := range nssTrustAttributes {
+				switch value, _ := settings.ulong(purpose.attribute); value {
+				case cktNSSTrustedDelegator:
+					entry.Trusted |= purpose.bit
+				case cktNSSTrusted:
+					entry.TrustedPeer |= purpose.bit
+				case cktNSSNotTrusted:
+					entry.Distrusted |= purpose.bit
+				}
+			}
+		}
+		certs = append(certs, entry)
+	}
+	return certs, nil
+}
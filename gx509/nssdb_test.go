@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func nssULong(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func TestParseNSSDatabase(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	const columns = "id PRIMARY KEY UNIQUE ON CONFLICT ABORT, a0, a3, a11, a81, a82, a102, ace536358, ace53635a, ace53635b"
+	certificate := func(id int64, label string, der []byte, keyID []byte) []interface{} {
+		return []interface{}{id, nssULong(ckoCertificate), []byte(label), der, []byte("issuer " + label), []byte("serial"), keyID}
+	}
+	trust := func(id int64, label string, serverAuth, codeSigning, emailProtection uint32) []interface{} {
+		return []interface{}{id, nssULong(ckoNSSTrust), nil, nil, []byte("issuer " + label), []byte("serial"), nil,
+			nssULong(serverAuth), nssULong(codeSigning), nssULong(emailProtection)}
+	}
+	cert9 := testSQLite(t, 4096, testSQLiteTable{
+		name: "nssPublic",
+		sql:  "CREATE TABLE nssPublic (" + columns + ")",
+		rows: [][]interface{}{
+			certificate(1, "Acme Root", chain[2].Raw, nssExplicitNull),
+			trust(2, "Acme Root", cktNSSTrustedDelegator, cktNSSTrustedDelegator, cktNSSNotTrusted),
+			certificate(3, "Acme Issuing CA", chain[1].Raw, nssExplicitNull),
+			certificate(4, "www.example.com", chain[0].Raw, []byte("key")),
+			trust(5, "www.example.com", cktNSSTrusted, 0, 0),
+		},
+	})
+	key4 := testSQLite(t, 4096, testSQLiteTable{
+		name: "nssPrivate",
+		sql:  "CREATE TABLE nssPrivate (id PRIMARY KEY UNIQUE ON CONFLICT ABORT, a0, a102)",
+		rows: [][]interface{}{{int64(1), nssULong(3), []byte("key")}},
+	})
+	if !IsSQLite(cert9) || IsSQLite(chain[0].Raw) {
+		t.Errorf("Expected only the database to be detected as SQLite")
+	}
+
+	certs, err := ParseNSSDatabase(cert9, key4)
+	if err != nil {
+		t.Fatalf("Could not read database: %s", err)
+	}
+	if len(certs) != 3 {
+		t.Fatalf("Expected 3 certificates, got %d", len(certs))
+	}
+	root, intermediate, leaf := certs[0], certs[1], certs[2]
+	if root.Label != "Acme Root" || !root.Cert.Equal(chain[2]) || root.Trusted != TrustServerAuth|TrustCodeSigning || root.Distrusted != TrustEmailProtection {
+		t.Errorf("Unexpected root %s trusted for %s and distrusted for %s", root.Label, root.Trusted, root.Distrusted)
+	}
+	if r := root.Root(); r.Trust != root.Trusted || r.Label != root.Label {
+		t.Errorf("Unexpected trust anchor %+v", r)
+	}
+	if intermediate.Trusted != 0 || intermediate.TrustedPeer != 0 || intermediate.Distrusted != 0 || intermediate.HasPrivateKey {
+		t.Errorf("Expected no trust settings for the intermediate, got %+v", intermediate)
+	}
+	if leaf.TrustedPeer != TrustServerAuth || leaf.Trusted != 0 || !leaf.HasPrivateKey {
+		t.Errorf("Expected the leaf to be a trusted peer with a key, got %+v", leaf)
+	}
+
+	if certs, err := ParseNSSDatabase(cert9, nil); err != nil || certs[2].HasPrivateKey {
+		t.Errorf("Expected no private keys without key4.db, got %v", err)
+	}
+	if _, err := ParseNSSDatabase(key4, nil); err == nil || !strings.Contains(err.Error(), "No table named nssPublic") {
+		t.Errorf("Expected key4.db not to be read as cert9.db, got %v", err)
+	}
+}
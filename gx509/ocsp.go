@@ -0,0 +1,373 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	// oidOCSPNoCheck marks a delegated responder whose own status relying
+	// parties need not check.
+	oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+)
+
+// ocspSignatureAlgorithms are the signature algorithms OCSP responses are
+// checked with, by OID.
+var ocspSignatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+}
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequestEntry struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspRequestEntry
+	Extensions  []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+	Extensions     []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// ocspCertIDFor identifies cert, issued by issuer, with SHA-1 hashes as
+// responders universally accept.
+func ocspCertIDFor(cert, issuer *x509.Certificate) (ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return ocspCertID{}, fmt.Errorf("Could not parse issuer public key: %s", err)
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+		IssuerNameHash: nameHash[:],
+		IssuerKeyHash:  keyHash[:],
+		SerialNumber:   cert.SerialNumber,
+	}, nil
+}
+
+// CreateOCSPRequest returns a DER OCSP request for the status of cert, which
+// issuer issued, carrying nonce in a nonce extension unless it is empty.
+func CreateOCSPRequest(cert, issuer *x509.Certificate, nonce []byte) ([]byte, error) {
+	id, err := ocspCertIDFor(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	request := ocspRequest{TBSRequest: ocspTBSRequest{RequestList: []ocspRequestEntry{{Cert: id}}}}
+	if len(nonce) > 0 {
+		value, err := asn1.Marshal(nonce)
+		if err != nil {
+			return nil, err
+		}
+		request.TBSRequest.Extensions = []pkix.Extension{{Id: oidOCSPNonce, Value: value}}
+	}
+	return asn1.Marshal(request)
+}
+
+// An OCSPResponse is a responder's answer about one certificate.
+type OCSPResponse struct {
+	// Status is "good", "revoked" or "unknown".
+	Status     string
+	RevokedAt  time.Time
+	ProducedAt time.Time
+	ThisUpdate time.Time
+	// NextUpdate is zero if the responder did not say when it will have
+	// newer information.
+	NextUpdate time.Time
+	// Nonce is the value of the response's nonce extension, or nil if it
+	// has none.
+	Nonce []byte
+	// Signer is the certificate that signed the response: the issuer or a
+	// responder it delegated to, in which case Delegated is set.
+	Signer    *x509.Certificate
+	Delegated bool
+}
+
+// ParseOCSPResponse parses the DER OCSP response about cert and checks it
+// was signed by issuer or a responder issuer delegated to.
+func ParseOCSPResponse(der []byte, cert, issuer *x509.Certificate) (*OCSPResponse, error) {
+	var outer ocspResponseASN1
+	if _, err := asn1.Unmarshal(der, &outer); err != nil {
+		return nil, fmt.Errorf("Could not parse OCSP response: %s", err)
+	}
+	if outer.Status != 0 {
+		return nil, fmt.Errorf("OCSP responder returned error status %d", outer.Status)
+	}
+	if !outer.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, fmt.Errorf("OCSP response is %s, not a basic response", outer.Response.ResponseType)
+	}
+
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(outer.Response.Response, &basic); err != nil {
+		return nil, fmt.Errorf("Could not parse basic OCSP response: %s", err)
+	}
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return nil, fmt.Errorf("Could not parse OCSP response data: %s", err)
+	}
+
+	algorithm, ok := ocspSignatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported OCSP signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+	response := &OCSPResponse{ProducedAt: data.ProducedAt}
+	signature := basic.Signature.RightAlign()
+	if issuer.CheckSignature(algorithm, basic.TBSResponseData.FullBytes, signature) == nil {
+		response.Signer = issuer
+	}
+	for _, raw := range basic.Certificates {
+		if response.Signer != nil {
+			break
+		}
+		responder, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse OCSP responder certificate: %s", err)
+		}
+		delegated := false
+		for _, usage := range responder.ExtKeyUsage {
+			delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+		}
+		if delegated && responder.CheckSignatureFrom(issuer) == nil &&
+			responder.CheckSignature(algorithm, basic.TBSResponseData.FullBytes, signature) == nil {
+			response.Signer = responder
+			response.Delegated = true
+		}
+	}
+	if response.Signer == nil {
+		return nil, fmt.Errorf("OCSP response is not signed by %s or a responder it delegated to", issuer.Subject.CommonName)
+	}
+
+	id, err := ocspCertIDFor(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	var single *ocspSingleResponse
+	for i, candidate := range data.Responses {
+		if candidate.CertID.SerialNumber.Cmp(id.SerialNumber) == 0 &&
+			(!candidate.CertID.HashAlgorithm.Algorithm.Equal(oidSHA1) ||
+				bytes.Equal(candidate.CertID.IssuerNameHash, id.IssuerNameHash) && bytes.Equal(candidate.CertID.IssuerKeyHash, id.IssuerKeyHash)) {
+			single = &data.Responses[i]
+		}
+	}
+	if single == nil {
+		return nil, fmt.Errorf("OCSP response does not cover serial %x", cert.SerialNumber)
+	}
+
+	switch {
+	case bool(single.Good):
+		response.Status = "good"
+	case bool(single.Unknown):
+		response.Status = "unknown"
+	default:
+		response.Status = "revoked"
+		response.RevokedAt = single.Revoked.RevocationTime
+	}
+	response.ThisUpdate = single.ThisUpdate
+	response.NextUpdate = single.NextUpdate
+
+	for _, ext := range data.Extensions {
+		if !ext.Id.Equal(oidOCSPNonce) {
+			continue
+		}
+		// RFC 8954 wraps the nonce in an OCTET STRING, but some responders
+		// echo it bare
+		var nonce []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &nonce); err == nil && len(rest) == 0 {
+			response.Nonce = nonce
+		} else {
+			response.Nonce = ext.Value
+		}
+	}
+	return response, nil
+}
+
+// The longest OCSP validity windows the Baseline Requirements allow, for
+// responses about subscriber certificates and about subordinate CAs.
+const (
+	maxSubscriberOCSPWindow = 10 * 24 * time.Hour
+	maxCAOCSPWindow         = 366 * 24 * time.Hour
+)
+
+// An OCSPCheck is what querying a certificate's OCSP responder found.
+type OCSPCheck struct {
+	Cert     *x509.Certificate
+	URL      string
+	Response *OCSPResponse
+	// NonceSent is the nonce the request carried, if any, and NonceHonored
+	// whether the response echoed it.
+	NonceSent    []byte
+	NonceHonored bool
+	// Findings are the problems with the response.
+	Findings []string
+}
+
+// Window is how long the response claims to be valid for, or zero if it
+// has no nextUpdate.
+func (c *OCSPCheck) Window() time.Duration {
+	if c.Response == nil || c.Response.NextUpdate.IsZero() {
+		return 0
+	}
+	return c.Response.NextUpdate.Sub(c.Response.ThisUpdate)
+}
+
+// CheckOCSP asks the first OCSP responder cert names about its status as of
+// at, sending a random nonce if sendNonce is set, and reports whether the
+// response honours the nonce and has a validity window the Baseline
+// Requirements allow. A responder that ignores nonces leaves relying parties
+// open to replayed responses for the whole window.
+func CheckOCSP(client *http.Client, cert, issuer *x509.Certificate, sendNonce bool, at time.Time) (*OCSPCheck, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, fmt.Errorf("%s names no OCSP responder", cert.Subject.CommonName)
+	}
+	check := &OCSPCheck{Cert: cert, URL: cert.OCSPServer[0]}
+	if sendNonce {
+		check.NonceSent = make([]byte, 16)
+		if _, err := rand.Read(check.NonceSent); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := CreateOCSPRequest(cert, issuer, check.NonceSent)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(check.URL, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("Could not query %s: %s", check.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", check.URL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read response from %s: %s", check.URL, err)
+	}
+	if check.Response, err = ParseOCSPResponse(body, cert, issuer); err != nil {
+		return nil, err
+	}
+
+	response := check.Response
+	if sendNonce {
+		switch {
+		case response.Nonce == nil:
+			check.Findings = append(check.Findings, "the responder ignored the nonce, so its responses can be replayed until they expire")
+		case !bytes.Equal(response.Nonce, check.NonceSent):
+			check.Findings = append(check.Findings, "the responder returned a different nonce, so the response may be a replay")
+		default:
+			check.NonceHonored = true
+		}
+	}
+	if response.ThisUpdate.After(at) {
+		check.Findings = append(check.Findings, fmt.Sprintf("thisUpdate %s is in the future", response.ThisUpdate.Format(time.RFC3339)))
+	}
+	if response.NextUpdate.IsZero() {
+		check.Findings = append(check.Findings, "the response has no nextUpdate")
+	} else if response.NextUpdate.Before(at) {
+		check.Findings = append(check.Findings, fmt.Sprintf("the response expired at %s", response.NextUpdate.Format(time.RFC3339)))
+	}
+	if response.Delegated {
+		check.Findings = append(check.Findings, delegatedResponderFindings(response.Signer, at)...)
+	}
+	limit := maxSubscriberOCSPWindow
+	if cert.IsCA {
+		limit = maxCAOCSPWindow
+	}
+	if window := check.Window(); window > limit {
+		check.Findings = append(check.Findings, fmt.Sprintf("the response is valid for %s, more than the %d days allowed", window, int(limit/(24*time.Hour))))
+	}
+	return check, nil
+}
+
+// delegatedResponderFindings are the problems with a delegated responder's
+// certificate, as of at.
+func delegatedResponderFindings(responder *x509.Certificate, at time.Time) []string {
+	var findings []string
+	if at.Before(responder.NotBefore) || at.After(responder.NotAfter) {
+		findings = append(findings, fmt.Sprintf("the responder certificate %s is only valid from %s to %s",
+			responder.Subject.CommonName, responder.NotBefore.Format(time.RFC3339), responder.NotAfter.Format(time.RFC3339)))
+	}
+	noCheck := false
+	for _, ext := range responder.Extensions {
+		noCheck = noCheck || ext.Id.Equal(oidOCSPNoCheck)
+	}
+	if !noCheck {
+		findings = append(findings, fmt.Sprintf("the responder certificate %s lacks id-pkix-ocsp-nocheck, which the Baseline Requirements require", responder.Subject.CommonName))
+	}
+	return findings
+}
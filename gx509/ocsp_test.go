@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ocspResponder answers requests for certificates issuer issued as good,
+// valid for window from thisUpdate, echoing nonces through echo.
+func ocspResponder(t *testing.T, issuer *x509.Certificate, thisUpdate time.Time, window time.Duration, echo func([]byte) []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request ocspRequest
+		if _, err := asn1.Unmarshal(body, &request); err != nil {
+			t.Errorf("Could not parse OCSP request: %s", err)
+			return
+		}
+		data := ocspResponseData{
+			RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: issuer.RawSubject},
+			ProducedAt:     thisUpdate.UTC(),
+			Responses: []ocspSingleResponse{{
+				CertID:     request.TBSRequest.RequestList[0].Cert,
+				Good:       true,
+				ThisUpdate: thisUpdate.UTC(),
+				NextUpdate: thisUpdate.Add(window).UTC(),
+			}},
+		}
+		for _, ext := range request.TBSRequest.Extensions {
+			if ext.Id.Equal(oidOCSPNonce) {
+				if value := echo(ext.Value); value != nil {
+					data.Extensions = append(data.Extensions, pkix.Extension{Id: oidOCSPNonce, Value: value})
+				}
+			}
+		}
+		tbs, err := asn1.Marshal(data)
+		if err != nil {
+			t.Errorf("Could not marshal OCSP response data: %s", err)
+			return
+		}
+		digest := sha256.Sum256(tbs)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, testPrivateKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Errorf("Could not sign OCSP response: %s", err)
+			return
+		}
+		basic, _ := asn1.Marshal(ocspBasicResponse{
+			TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+			Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+		})
+		response, _ := asn1.Marshal(ocspResponseASN1{Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(response)
+	}))
+}
+
+func TestCheckOCSP(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := chain[0].NotBefore.Add(24 * time.Hour)
+
+	for _, test := range []struct {
+		name     string
+		window   time.Duration
+		echo     func([]byte) []byte
+		honored  bool
+		findings []string
+	}{
+		{"honoured", 4 * 24 * time.Hour, func(v []byte) []byte { return v }, true, nil},
+		{"ignored", 7 * 24 * time.Hour, func([]byte) []byte { return nil }, false,
+			[]string{"the responder ignored the nonce, so its responses can be replayed until they expire"}},
+		{"replayed", 30 * 24 * time.Hour, func([]byte) []byte { return []byte{0x04, 0x01, 0x00} }, false,
+			[]string{"the responder returned a different nonce, so the response may be a replay", "the response is valid for 720h0m0s, more than the 10 days allowed"}},
+	} {
+		server := ocspResponder(t, chain[1], at.Add(-time.Hour), test.window, test.echo)
+		leaf := *chain[0]
+		leaf.OCSPServer = []string{server.URL}
+		check, err := CheckOCSP(server.Client(), &leaf, chain[1], true, at)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: Could not check OCSP: %s", test.name, err)
+		}
+		if check.Response.Status != "good" || check.Response.Signer != chain[1] || check.Window() != test.window {
+			t.Errorf("%s: Unexpected response %+v", test.name, check.Response)
+		}
+		if check.NonceHonored != test.honored || !reflect.DeepEqual(check.Findings, test.findings) {
+			t.Errorf("%s: Expected honoured %t and findings %v, got %t and %v", test.name, test.honored, test.findings, check.NonceHonored, check.Findings)
+		}
+	}
+
+	// A CA may have responses valid for up to a year
+	server := ocspResponder(t, chain[2], at.Add(-time.Hour), 300*24*time.Hour, func(v []byte) []byte { return v })
+	defer server.Close()
+	intermediate := *chain[1]
+	intermediate.OCSPServer = []string{server.URL}
+	if check, err := CheckOCSP(server.Client(), &intermediate, chain[2], false, at); err != nil || check.Findings != nil || check.NonceSent != nil {
+		t.Errorf("Expected no findings for the intermediate, got %+v (%v)", check, err)
+	}
+
+	if _, err := CheckOCSP(http.DefaultClient, chain[2], chain[2], false, at); err == nil {
+		t.Errorf("Expected an error for a certificate without a responder")
+	}
+}
+
+func TestDelegatedResponderFindings(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := chain[0].NotBefore.Add(24 * time.Hour)
+	responder := func(extensions []pkix.Extension) *x509.Certificate {
+		return issueAndParse(t, &x509.Certificate{
+			SerialNumber:    big.NewInt(30),
+			Subject:         pkix.Name{CommonName: "Acme OCSP Responder"},
+			NotBefore:       at.Add(-time.Hour),
+			NotAfter:        at.Add(30 * 24 * time.Hour),
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+			ExtraExtensions: extensions,
+		}, chain[1])
+	}
+
+	noCheck := responder([]pkix.Extension{{Id: oidOCSPNoCheck, Value: []byte{0x05, 0x00}}})
+	if findings := delegatedResponderFindings(noCheck, at); len(findings) != 0 {
+		t.Errorf("Expected no findings, got %v", findings)
+	}
+	if findings := delegatedResponderFindings(noCheck, at.AddDate(0, 2, 0)); len(findings) != 1 || !strings.Contains(findings[0], "only valid from") {
+		t.Errorf("Expected an expired responder certificate, got %v", findings)
+	}
+	if findings := delegatedResponderFindings(responder(nil), at); len(findings) != 1 || !strings.Contains(findings[0], "id-pkix-ocsp-nocheck") {
+		t.Errorf("Expected a missing id-pkix-ocsp-nocheck, got %v", findings)
+	}
+}
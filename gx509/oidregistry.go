@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	_ "embed"
+	"encoding/asn1"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The OID registry shipped with this package.
+//
+//go:embed oids.yaml
+var embeddedOIDRegistry []byte
+
+// An OIDRegistry names object identifiers, by their dotted form.
+type OIDRegistry struct {
+	Version string
+	// Names are the short names openssl gives OIDs.
+	Names map[string]string
+	// Curves are the openssl and NIST names of named curves.
+	Curves map[string][2]string
+}
+
+// DefaultOIDRegistry is the OID registry embedded in this package.
+var DefaultOIDRegistry = mustParseOIDRegistry(embeddedOIDRegistry)
+
+type oidRegistryYAML struct {
+	Version string              `yaml:"version"`
+	Names   map[string]string   `yaml:"names"`
+	Curves  map[string][]string `yaml:"curves"`
+}
+
+// validOID reports whether s is a dotted OID, such as "2.5.4.3".
+func validOID(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseOIDRegistry decodes a YAML OID registry.
+func ParseOIDRegistry(data []byte) (*OIDRegistry, error) {
+	var raw oidRegistryYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Version) == 0 {
+		return nil, fmt.Errorf("OID registry has no version")
+	}
+
+	registry := &OIDRegistry{Version: raw.Version, Names: raw.Names, Curves: make(map[string][2]string)}
+	for oid := range raw.Names {
+		if !validOID(oid) {
+			return nil, fmt.Errorf("OID registry %s names an invalid OID %q", raw.Version, oid)
+		}
+	}
+	for oid, names := range raw.Curves {
+		if !validOID(oid) || len(names) != 2 {
+			return nil, fmt.Errorf("OID registry %s has an invalid curve %q", raw.Version, oid)
+		}
+		registry.Curves[oid] = [2]string{names[0], names[1]}
+	}
+	return registry, nil
+}
+
+func mustParseOIDRegistry(data []byte) *OIDRegistry {
+	registry, err := ParseOIDRegistry(data)
+	if err != nil {
+		panic("Failed to parse embedded OID registry: " + err.Error())
+	}
+	return registry
+}
+
+// Name returns the short name of oid, or its dotted form if it has none.
+func (r *OIDRegistry) Name(oid asn1.ObjectIdentifier) string {
+	if name, ok := r.Names[oid.String()]; ok {
+		return name
+	}
+	return oid.String()
+}
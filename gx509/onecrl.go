@@ -0,0 +1,232 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// OneCRLURL is the Remote Settings collection Firefox reads OneCRL, Mozilla's
+// list of revoked intermediates, from.
+const OneCRLURL = "https://firefox.settings.services.mozilla.com/v1/buckets/security-state/collections/onecrl/records"
+
+// The OneCRL snapshot shipped with this package.
+//
+//go:embed onecrl.json
+var embeddedOneCRL []byte
+
+// maxOneCRLResponse is the most a OneCRL download may be; the collection is
+// a few hundred kilobytes.
+const maxOneCRLResponse = 16 << 20
+
+// A OneCRLEntry revokes certificates by issuer and serial number, or by
+// subject and public key.
+type OneCRLEntry struct {
+	// IssuerName and Subject are DER-encoded names, and SerialNumber the
+	// contents of the DER serial number.
+	IssuerName   []byte
+	SerialNumber []byte
+	Subject      []byte
+	// PubKeyHash is the SHA-256 hash of the subject public key info.
+	PubKeyHash []byte
+
+	// Bug is the Bugzilla bug that asked for the revocation, Why the reason
+	// given and Created the date it was added.
+	Bug     string
+	Why     string
+	Created string
+}
+
+// OneCRL is the list of revoked intermediates Firefox checks.
+type OneCRL struct {
+	Entries []*OneCRLEntry
+	// Timestamp is when the collection last changed, if it says.
+	Timestamp time.Time
+
+	byIssuerSerial map[string]*OneCRLEntry
+	bySubjectKey   map[string]*OneCRLEntry
+}
+
+type oneCRLRecord struct {
+	IssuerName   string `json:"issuerName"`
+	SerialNumber string `json:"serialNumber"`
+	Subject      string `json:"subject"`
+	PubKeyHash   string `json:"pubKeyHash"`
+	Enabled      *bool  `json:"enabled"`
+	LastModified int64  `json:"last_modified"`
+	Details      struct {
+		Bug     string `json:"bug"`
+		Why     string `json:"why"`
+		Created string `json:"created"`
+	} `json:"details"`
+}
+
+// ParseOneCRL decodes OneCRL as Remote Settings serves it: the records of the
+// collection, under "data", or a changeset of them, under "changes".
+// Disabled records are skipped.
+func ParseOneCRL(data []byte) (*OneCRL, error) {
+	var collection struct {
+		Data      []oneCRLRecord `json:"data"`
+		Changes   []oneCRLRecord `json:"changes"`
+		Timestamp int64          `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("Could not decode OneCRL: %s", err)
+	}
+
+	onecrl := &OneCRL{byIssuerSerial: make(map[string]*OneCRLEntry), bySubjectKey: make(map[string]*OneCRLEntry)}
+	// Timestamps are in milliseconds
+	latest := collection.Timestamp
+	for i, record := range append(collection.Data, collection.Changes...) {
+		if record.LastModified > latest {
+			latest = record.LastModified
+		}
+		if record.Enabled != nil && !*record.Enabled {
+			continue
+		}
+		entry := &OneCRLEntry{Bug: record.Details.Bug, Why: record.Details.Why, Created: record.Details.Created}
+		for _, field := range []struct {
+			value string
+			out   *[]byte
+		}{
+			{record.IssuerName, &entry.IssuerName},
+			{record.SerialNumber, &entry.SerialNumber},
+			{record.Subject, &entry.Subject},
+			{record.PubKeyHash, &entry.PubKeyHash},
+		} {
+			var err error
+			if *field.out, err = base64.StdEncoding.DecodeString(field.value); err != nil {
+				return nil, fmt.Errorf("Could not decode OneCRL record %d: %s", i, err)
+			}
+		}
+
+		switch {
+		case len(entry.IssuerName) > 0 && len(entry.SerialNumber) > 0:
+			onecrl.byIssuerSerial[string(entry.IssuerName)+"\x00"+string(entry.SerialNumber)] = entry
+		case len(entry.Subject) > 0 && len(entry.PubKeyHash) == sha256.Size:
+			onecrl.bySubjectKey[string(entry.Subject)+"\x00"+string(entry.PubKeyHash)] = entry
+		default:
+			return nil, fmt.Errorf("OneCRL record %d has neither an issuer and serial nor a subject and key hash", i)
+		}
+		onecrl.Entries = append(onecrl.Entries, entry)
+	}
+	if latest > 0 {
+		onecrl.Timestamp = time.Unix(0, latest*int64(time.Millisecond)).UTC()
+	}
+	return onecrl, nil
+}
+
+func mustParseOneCRL(data []byte) *OneCRL {
+	onecrl, err := ParseOneCRL(data)
+	if err != nil {
+		panic("Failed to parse embedded OneCRL: " + err.Error())
+	}
+	return onecrl
+}
+
+// FetchOneCRL downloads OneCRL from url, such as OneCRLURL.
+func FetchOneCRL(client *http.Client, url string) (*OneCRL, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOneCRLResponse+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxOneCRLResponse {
+		return nil, fmt.Errorf("%s returned more than %d bytes", url, maxOneCRLResponse)
+	}
+	return ParseOneCRL(body)
+}
+
+// Lookup returns the entry revoking cert, or nil if OneCRL does not.
+func (o *OneCRL) Lookup(cert *x509.Certificate) *OneCRLEntry {
+	// OneCRL holds the contents of the DER INTEGER, after its tag and length
+	var raw asn1.RawValue
+	if serial, err := asn1.Marshal(cert.SerialNumber); err == nil {
+		if _, err := asn1.Unmarshal(serial, &raw); err == nil {
+			if entry, ok := o.byIssuerSerial[string(cert.RawIssuer)+"\x00"+string(raw.Bytes)]; ok {
+				return entry
+			}
+		}
+	}
+	keyHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return o.bySubjectKey[string(cert.RawSubject)+"\x00"+string(keyHash[:])]
+}
+
+// DefaultOneCRL is the OneCRL snapshot embedded in this package, which
+// IsInOneCRL checks. Programs that need the current list can replace it with
+// the result of FetchOneCRL.
+var DefaultOneCRL = mustParseOneCRL(embeddedOneCRL)
+
+// ErrEmptyOneCRL is returned by IsInOneCRL when DefaultOneCRL has no entries,
+// as the snapshot shipped with this package does until it is refreshed, and
+// so cannot say whether anything is revoked.
+var ErrEmptyOneCRL = errors.New("OneCRL has no entries; replace DefaultOneCRL with the result of FetchOneCRL")
+
+// IsInOneCRL reports whether DefaultOneCRL revokes cert, or ErrEmptyOneCRL if
+// it is empty.
+func IsInOneCRL(cert *x509.Certificate) (bool, error) {
+	if len(DefaultOneCRL.Entries) == 0 {
+		return false, ErrEmptyOneCRL
+	}
+	return DefaultOneCRL.IsInOneCRL(cert), nil
+}
+
+// IsInOneCRL reports whether OneCRL revokes cert.
+func (o *OneCRL) IsInOneCRL(cert *x509.Certificate) bool {
+	return o.Lookup(cert) != nil
+}
+
+// A OneCRLResult is whether OneCRL revokes a certificate, and why.
+type OneCRLResult struct {
+	Revoked bool   `json:"revoked"`
+	Bug     string `json:"bug,omitempty"`
+	Why     string `json:"why,omitempty"`
+	Created string `json:"created,omitempty"`
+}
+
+func (r *OneCRLResult) String() string {
+	if !r.Revoked {
+		return "not revoked"
+	}
+	text := "revoked"
+	if len(r.Bug) > 0 {
+		text += " in bug " + r.Bug
+	}
+	if len(r.Created) > 0 {
+		text += " on " + r.Created
+	}
+	if len(r.Why) > 0 {
+		text += ": " + r.Why
+	}
+	return text
+}
+
+// NewOneCRLResult returns whether onecrl revokes cert.
+func NewOneCRLResult(onecrl *OneCRL, cert *x509.Certificate) *OneCRLResult {
+	entry := onecrl.Lookup(cert)
+	if entry == nil {
+		return &OneCRLResult{}
+	}
+	return &OneCRLResult{Revoked: true, Bug: entry.Bug, Why: entry.Why, Created: entry.Created}
+}
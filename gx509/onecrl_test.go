@@ -0,0 +1,109 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOneCRL(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	intermediate, root := chain[1], chain[2]
+
+	var serial asn1.RawValue
+	der, _ := asn1.Marshal(intermediate.SerialNumber)
+	if _, err := asn1.Unmarshal(der, &serial); err != nil {
+		t.Fatalf("Could not unmarshal serial number: %s", err)
+	}
+	keyHash := sha256.Sum256(root.RawSubjectPublicKeyInfo)
+	b64 := base64.StdEncoding.EncodeToString
+
+	data := fmt.Sprintf(`{"data": [
+		{"issuerName": %q, "serialNumber": %q, "details": {"bug": "1234", "why": "key compromise", "created": "2020-01-02"}, "enabled": true},
+		{"issuerName": %q, "serialNumber": "AQ==", "enabled": false}
+	]}`, b64(intermediate.RawIssuer), b64(serial.Bytes), b64(chain[0].RawIssuer))
+	onecrl, err := ParseOneCRL([]byte(data))
+	if err != nil {
+		t.Fatalf("Could not parse OneCRL: %s", err)
+	}
+	if len(onecrl.Entries) != 1 {
+		t.Errorf("Expected the disabled record to be skipped, got %d entries", len(onecrl.Entries))
+	}
+	if !onecrl.IsInOneCRL(intermediate) || onecrl.IsInOneCRL(chain[0]) || onecrl.IsInOneCRL(root) {
+		t.Errorf("Expected only the intermediate to be revoked")
+	}
+	if result := NewOneCRLResult(onecrl, intermediate); !result.Revoked || result.Bug != "1234" || result.Why != "key compromise" || result.Created != "2020-01-02" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result := NewOneCRLResult(onecrl, root); result.Revoked || result.Bug != "" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	changes := fmt.Sprintf(`{"changes": [{"subject": %q, "pubKeyHash": %q, "last_modified": 1600000000000}], "timestamp": 1500000000000}`,
+		b64(root.RawSubject), b64(keyHash[:]))
+	if onecrl, err = ParseOneCRL([]byte(changes)); err != nil {
+		t.Fatalf("Could not parse OneCRL changes: %s", err)
+	}
+	if !onecrl.IsInOneCRL(root) || onecrl.IsInOneCRL(intermediate) {
+		t.Errorf("Expected only the root to be revoked by subject and key")
+	}
+	if !onecrl.Timestamp.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("Expected the latest record's timestamp, got %s", onecrl.Timestamp)
+	}
+
+	// IsInOneCRL checks the embedded snapshot, and refuses to answer while it
+	// is empty
+	revoked, err := IsInOneCRL(intermediate)
+	if len(DefaultOneCRL.Entries) == 0 && err != ErrEmptyOneCRL {
+		t.Errorf("Expected an error for an empty OneCRL, got %v", err)
+	}
+	if len(DefaultOneCRL.Entries) > 0 && (err != nil || revoked != DefaultOneCRL.IsInOneCRL(intermediate)) {
+		t.Errorf("Expected IsInOneCRL to check DefaultOneCRL, got %t and %v", revoked, err)
+	}
+
+	for _, data := range []string{
+		`not json`,
+		`{"data": [{"issuerName": "not base64!", "serialNumber": "AQ=="}]}`,
+		`{"data": [{"issuerName": "AQ=="}]}`,
+		`{"data": [{"subject": "AQ==", "pubKeyHash": "AQ=="}]}`,
+	} {
+		if _, err := ParseOneCRL([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %s", data)
+		}
+	}
+}
+
+func TestFetchOneCRL(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/records" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data": [{"issuerName": "AQ==", "serialNumber": "AQ=="}]}`)
+	}))
+	defer server.Close()
+
+	onecrl, err := FetchOneCRL(server.Client(), server.URL+"/records")
+	if err != nil {
+		t.Fatalf("Could not fetch OneCRL: %s", err)
+	}
+	if len(onecrl.Entries) != 1 {
+		t.Errorf("Expected 1 entry, got %d", len(onecrl.Entries))
+	}
+	if _, err := FetchOneCRL(server.Client(), server.URL+"/missing"); err == nil {
+		t.Errorf("Expected an error fetching a missing collection")
+	}
+}
@@ -0,0 +1,170 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"sort"
+	"strings"
+)
+
+// legalSuffixes are dropped from the end of organization names, so that
+// "Example, Inc." and "Example Incorporated" group together.
+var legalSuffixes = map[string]bool{
+	"inc": true, "incorporated": true, "llc": true, "ltd": true, "limited": true,
+	"corp": true, "corporation": true, "co": true, "company": true, "plc": true,
+	"gmbh": true, "ag": true, "sa": true, "spa": true, "srl": true, "sas": true,
+	"bv": true, "nv": true, "nv-sa": true, "ab": true, "as": true, "oy": true,
+}
+
+// organizationAliases map the keys of names known to belong to the same CA
+// owner, including brands acquired by another, to the owner's name.
+var organizationAliases = map[string]string{
+	"lets encrypt":                     "Internet Security Research Group",
+	"internet security research group": "Internet Security Research Group",
+	"digicert":                         "DigiCert",
+	"geotrust":                         "DigiCert",
+	"thawte":                           "DigiCert",
+	"rapidssl":                         "DigiCert",
+	"symantec":                         "DigiCert",
+	"verisign":                         "DigiCert",
+	"sectigo":                          "Sectigo",
+	"comodo ca":                        "Sectigo",
+	"comodo":                           "Sectigo",
+	"usertrust network":                "Sectigo",
+	"globalsign":                       "GlobalSign",
+	"google trust services":            "Google Trust Services",
+	"entrust":                          "Entrust",
+	"amazon":                           "Amazon",
+	"godaddycom":                       "GoDaddy",
+	"starfield technologies":           "GoDaddy",
+}
+
+// countryAliases correct country codes that are commonly used but are not
+// ISO 3166.
+var countryAliases = map[string]string{"UK": "GB"}
+
+// cleanName trims s and collapses runs of whitespace.
+func cleanName(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// OrganizationKey returns a grouping key for an organization name: case
+// folded, without punctuation or a leading "The", and without legal
+// suffixes.
+func OrganizationKey(name string) string {
+	stripped := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ',', '\'', '"', '’', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+
+	words := strings.Fields(stripped)
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	for len(words) > 1 && legalSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// CanonicalOrganization returns the name of the owner known to use name, or
+// name itself, cleaned up, if it is not known.
+func CanonicalOrganization(name string) string {
+	if owner, ok := organizationAliases[OrganizationKey(name)]; ok {
+		return owner
+	}
+	return cleanName(name)
+}
+
+// An OrganizationIdentity is the normalized organization of a certificate
+// subject or issuer.
+type OrganizationIdentity struct {
+	// Name is the canonical organization name, and Key the form used to
+	// compare it.
+	Name  string
+	Key   string
+	Units []string
+	// Country is an upper case ISO 3166 code.
+	Country string
+}
+
+// NormalizeOrganization normalizes the O, OU and C attributes of name.
+// Where a name has several organizations, the first is used.
+func NormalizeOrganization(name pkix.Name) OrganizationIdentity {
+	var identity OrganizationIdentity
+	if len(name.Organization) > 0 {
+		identity.Name = CanonicalOrganization(name.Organization[0])
+		identity.Key = OrganizationKey(identity.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, unit := range name.OrganizationalUnit {
+		unit = cleanName(unit)
+		if key := strings.ToLower(unit); len(unit) > 0 && !seen[key] {
+			seen[key] = true
+			identity.Units = append(identity.Units, unit)
+		}
+	}
+	sort.Strings(identity.Units)
+
+	if len(name.Country) > 0 {
+		identity.Country = strings.ToUpper(strings.TrimSpace(name.Country[0]))
+		if alias, ok := countryAliases[identity.Country]; ok {
+			identity.Country = alias
+		}
+	}
+	return identity
+}
+
+// An OrganizationGroup is the set of certificates issued by one organization.
+type OrganizationGroup struct {
+	Name         string
+	Certificates []*x509.Certificate
+}
+
+// GroupByIssuerOrganization groups certs by the normalized organization of
+// their issuers, most certificates first. Certificates whose issuers name no
+// organization are grouped by issuer common name.
+func GroupByIssuerOrganization(certs []*x509.Certificate) []OrganizationGroup {
+	return groupCertificates(certs, issuerOrganizationKey)
+}
+
+// issuerOrganizationKey returns the grouping key and display name of cert's
+// issuer organization.
+func issuerOrganizationKey(cert *x509.Certificate) (string, string) {
+	identity := NormalizeOrganization(cert.Issuer)
+	if len(identity.Key) == 0 {
+		name := cleanName(cert.Issuer.CommonName)
+		return "cn:" + strings.ToLower(name), name
+	}
+	return identity.Key, identity.Name
+}
+
+// groupCertificates groups certs by the key that group returns along with
+// the group's name, most certificates first.
+func groupCertificates(certs []*x509.Certificate, group func(*x509.Certificate) (string, string)) []OrganizationGroup {
+	index := make(map[string]int)
+	var groups []OrganizationGroup
+	for _, cert := range certs {
+		key, name := group(cert)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, OrganizationGroup{Name: name})
+		}
+		groups[i].Certificates = append(groups[i].Certificates, cert)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Certificates) > len(groups[j].Certificates)
+	})
+	return groups
+}
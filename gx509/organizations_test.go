@@ -0,0 +1,112 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOrganizationKey(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]string{
+		"DigiCert Inc":            "digicert",
+		"  DigiCert,   Inc. ":     "digicert",
+		"The USERTRUST Network":   "usertrust network",
+		"GlobalSign nv-sa":        "globalsign",
+		"Let's Encrypt":           "lets encrypt",
+		"Example Holdings Co Ltd": "example holdings",
+		"Limited":                 "limited",
+		"The":                     "the",
+	} {
+		if key := OrganizationKey(name); key != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, key)
+		}
+	}
+}
+
+func TestCanonicalOrganization(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]string{
+		"COMODO CA Limited":     "Sectigo",
+		"GeoTrust Inc.":         "DigiCert",
+		"GoDaddy.com, Inc.":     "GoDaddy",
+		"Let's Encrypt":         "Internet Security Research Group",
+		" Example   Trust GmbH": "Example Trust GmbH",
+	} {
+		if canonical := CanonicalOrganization(name); canonical != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, canonical)
+		}
+	}
+}
+
+func TestNormalizeOrganization(t *testing.T) {
+	t.Parallel()
+
+	identity := NormalizeOrganization(pkix.Name{
+		Organization:       []string{"DigiCert, Inc."},
+		OrganizationalUnit: []string{"www.digicert.com ", "Domain Validated", "WWW.DIGICERT.COM", ""},
+		Country:            []string{" uk"},
+	})
+	if identity.Name != "DigiCert" || identity.Key != "digicert" {
+		t.Errorf("Unexpected organization: %+v", identity)
+	}
+	if len(identity.Units) != 2 || identity.Units[0] != "Domain Validated" || identity.Units[1] != "www.digicert.com" {
+		t.Errorf("Unexpected units: %q", identity.Units)
+	}
+	if identity.Country != "GB" {
+		t.Errorf("Expected the country to be GB, got %q", identity.Country)
+	}
+}
+
+func TestGroupByIssuerOrganization(t *testing.T) {
+	t.Parallel()
+
+	issue := func(organization []string, commonName string) *x509.Certificate {
+		parent := serialiseAndParse(t, &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: commonName, Organization: organization},
+			NotBefore:    time.Date(2009, time.December, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:     time.Date(2029, time.December, 1, 0, 0, 0, 0, time.UTC),
+
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		})
+		return issueAndParse(t, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:     time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+		}, parent)
+	}
+
+	groups := GroupByIssuerOrganization([]*x509.Certificate{
+		issue(nil, "Private CA"),
+		issue([]string{"COMODO CA Limited"}, "COMODO RSA"),
+		issue([]string{"Sectigo Limited"}, "Sectigo RSA"),
+		issue([]string{"The USERTRUST Network"}, "USERTrust RSA"),
+		issue([]string{"Example Ltd"}, "Example CA"),
+		issue([]string{"Example Limited"}, "Example CA 2"),
+	})
+
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d: %+v", len(groups), groups)
+	}
+	expected := []struct {
+		name  string
+		count int
+	}{{"Sectigo", 3}, {"Example Ltd", 2}, {"Private CA", 1}}
+	for i, group := range groups {
+		if group.Name != expected[i].name || len(group.Certificates) != expected[i].count {
+			t.Errorf("Group %d: expected %s with %d, got %s with %d", i,
+				expected[i].name, expected[i].count, group.Name, len(group.Certificates))
+		}
+	}
+}
@@ -0,0 +1,238 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The owner table shipped with this package.
+//
+//go:embed owners.yaml
+var embeddedOwnerTable []byte
+
+// A CAOwner is an organization responsible for CA certificates, named as in
+// the CCADB.
+type CAOwner struct {
+	Name string
+	// Organizations are the subject organizations its CA certificates use.
+	Organizations []string
+	// SubjectSPKI holds the Subject + SPKI SHA-256 hashes of its CA
+	// certificates.
+	SubjectSPKI [][sha256.Size]byte
+}
+
+// An OwnerTable maps CA certificates and issuer names to their owners.
+type OwnerTable struct {
+	Version string
+	Owners  []CAOwner
+
+	bySubjectSPKI  map[[sha256.Size]byte]string
+	byOrganization map[string]string
+}
+
+// DefaultOwnerTable is the owner table embedded in this package.
+var DefaultOwnerTable = mustParseOwnerTable(embeddedOwnerTable)
+
+type caOwnerYAML struct {
+	Name          string   `yaml:"name"`
+	Organizations []string `yaml:"organizations,flow,omitempty"`
+	SubjectSPKI   []string `yaml:"subjectSPKI,omitempty"`
+}
+
+type ownerTableYAML struct {
+	Version string        `yaml:"version"`
+	Owners  []caOwnerYAML `yaml:"owners"`
+}
+
+// NewOwnerTable indexes owners for lookups.
+func NewOwnerTable(version string, owners []CAOwner) *OwnerTable {
+	table := &OwnerTable{
+		Version:        version,
+		Owners:         owners,
+		bySubjectSPKI:  make(map[[sha256.Size]byte]string),
+		byOrganization: make(map[string]string),
+	}
+	for _, owner := range owners {
+		table.byOrganization[OrganizationKey(owner.Name)] = owner.Name
+		for _, organization := range owner.Organizations {
+			table.byOrganization[OrganizationKey(organization)] = owner.Name
+		}
+		for _, hash := range owner.SubjectSPKI {
+			table.bySubjectSPKI[hash] = owner.Name
+		}
+	}
+	return table
+}
+
+// ParseOwnerTable decodes a YAML owner table.
+func ParseOwnerTable(data []byte) (*OwnerTable, error) {
+	var raw ownerTableYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Version) == 0 {
+		return nil, fmt.Errorf("Owner table has no version")
+	}
+
+	var owners []CAOwner
+	for _, entry := range raw.Owners {
+		if len(entry.Name) == 0 {
+			return nil, fmt.Errorf("Owner table %s has an owner without a name", raw.Version)
+		}
+		owner := CAOwner{Name: entry.Name, Organizations: entry.Organizations}
+		for _, hash := range entry.SubjectSPKI {
+			decoded, err := ParseFingerprint(hash)
+			if err != nil {
+				return nil, fmt.Errorf("Owner %s: %s", entry.Name, err)
+			}
+			owner.SubjectSPKI = append(owner.SubjectSPKI, decoded)
+		}
+		owners = append(owners, owner)
+	}
+
+	return NewOwnerTable(raw.Version, owners), nil
+}
+
+func mustParseOwnerTable(data []byte) *OwnerTable {
+	table, err := ParseOwnerTable(data)
+	if err != nil {
+		panic("Failed to parse embedded owner table: " + err.Error())
+	}
+	return table
+}
+
+// MarshalYAML encodes the table in the form ParseOwnerTable reads.
+func (t *OwnerTable) MarshalYAML() (interface{}, error) {
+	raw := ownerTableYAML{Version: t.Version}
+	for _, owner := range t.Owners {
+		entry := caOwnerYAML{Name: owner.Name, Organizations: owner.Organizations}
+		for _, hash := range owner.SubjectSPKI {
+			entry.SubjectSPKI = append(entry.SubjectSPKI, fmt.Sprintf("%X", hash))
+		}
+		raw.Owners = append(raw.Owners, entry)
+	}
+	return raw, nil
+}
+
+// Owner returns the owner of a CA certificate, found by its Subject + SPKI
+// hash or else by its subject organization.
+func (t *OwnerTable) Owner(cert *x509.Certificate) (string, bool) {
+	if owner, ok := t.bySubjectSPKI[SubjectSPKIHash(cert)]; ok {
+		return owner, true
+	}
+	return t.ownerOfOrganization(cert.Subject.Organization)
+}
+
+// IssuerOwner returns the owner of the CA that issued cert, found by the
+// issuer's organization.
+func (t *OwnerTable) IssuerOwner(cert *x509.Certificate) (string, bool) {
+	return t.ownerOfOrganization(cert.Issuer.Organization)
+}
+
+func (t *OwnerTable) ownerOfOrganization(organizations []string) (string, bool) {
+	for _, organization := range organizations {
+		if owner, ok := t.byOrganization[OrganizationKey(organization)]; ok {
+			return owner, true
+		}
+		if owner, ok := t.byOrganization[OrganizationKey(CanonicalOrganization(organization))]; ok {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// GroupByIssuerOwner is like GroupByIssuerOrganization, but groups by owner
+// name where the table knows the issuer's owner.
+func (t *OwnerTable) GroupByIssuerOwner(certs []*x509.Certificate) []OrganizationGroup {
+	return groupCertificates(certs, func(cert *x509.Certificate) (string, string) {
+		if owner, ok := t.IssuerOwner(cert); ok {
+			return "owner:" + owner, owner
+		}
+		return issuerOrganizationKey(cert)
+	})
+}
+
+// ImportCCADBOwners builds an owner table from a CCADB certificate records
+// CSV, which must have "CA Owner" and "Subject + SPKI SHA256" columns. A
+// "Certificate Subject Organization" column, if present, is also used.
+func ImportCCADBOwners(r io.Reader, version string) (*OwnerTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CCADB report is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	ownerColumn, ok := columns["CA Owner"]
+	if !ok {
+		return nil, fmt.Errorf("CCADB report has no CA Owner column")
+	}
+	hashColumn, ok := columns["Subject + SPKI SHA256"]
+	if !ok {
+		return nil, fmt.Errorf("CCADB report has no Subject + SPKI SHA256 column")
+	}
+	organizationColumn, hasOrganizations := columns["Certificate Subject Organization"]
+
+	type ownerEntry struct {
+		organizations map[string]bool
+		hashes        map[[sha256.Size]byte]bool
+	}
+	entries := make(map[string]*ownerEntry)
+	for line, record := range records[1:] {
+		if ownerColumn >= len(record) || hashColumn >= len(record) || len(record[ownerColumn]) == 0 {
+			continue
+		}
+		name := record[ownerColumn]
+		entry, ok := entries[name]
+		if !ok {
+			entry = &ownerEntry{make(map[string]bool), make(map[[sha256.Size]byte]bool)}
+			entries[name] = entry
+		}
+
+		if len(record[hashColumn]) > 0 {
+			hash, err := ParseFingerprint(record[hashColumn])
+			if err != nil {
+				return nil, fmt.Errorf("CCADB report line %d: %s", line+2, err)
+			}
+			entry.hashes[hash] = true
+		}
+		if hasOrganizations && organizationColumn < len(record) && len(record[organizationColumn]) > 0 {
+			entry.organizations[record[organizationColumn]] = true
+		}
+	}
+
+	var owners []CAOwner
+	for name, entry := range entries {
+		owner := CAOwner{Name: name}
+		for organization := range entry.organizations {
+			owner.Organizations = append(owner.Organizations, organization)
+		}
+		sort.Strings(owner.Organizations)
+		for hash := range entry.hashes {
+			owner.SubjectSPKI = append(owner.SubjectSPKI, hash)
+		}
+		sort.Slice(owner.SubjectSPKI, func(i, j int) bool {
+			return string(owner.SubjectSPKI[i][:]) < string(owner.SubjectSPKI[j][:])
+		})
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Name < owners[j].Name })
+
+	return NewOwnerTable(version, owners), nil
+}
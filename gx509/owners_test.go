@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestEmbeddedOwnerTable(t *testing.T) {
+	t.Parallel()
+
+	if len(DefaultOwnerTable.Owners) == 0 {
+		t.Fatalf("Expected the embedded table to have owners")
+	}
+
+	// Every organization must identify exactly one owner
+	claimed := make(map[string]string)
+	for _, owner := range DefaultOwnerTable.Owners {
+		for _, organization := range owner.Organizations {
+			key := OrganizationKey(organization)
+			if other, ok := claimed[key]; ok && other != owner.Name {
+				t.Errorf("%q is claimed by both %s and %s", organization, other, owner.Name)
+			}
+			claimed[key] = owner.Name
+		}
+	}
+}
+
+func testOwnedCA(t *testing.T, organization string) *x509.Certificate {
+	return serialiseAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: organization + " Root", Organization: []string{organization}},
+		NotBefore:    time.Date(2009, time.December, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2029, time.December, 1, 0, 0, 0, 0, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+}
+
+func TestOwnerTableLookups(t *testing.T) {
+	t.Parallel()
+
+	root := testOwnedCA(t, "Example Trust")
+	table := NewOwnerTable("test", []CAOwner{
+		{Name: "Example Owner", SubjectSPKI: [][sha256.Size]byte{SubjectSPKIHash(root)}},
+		{Name: "Sectigo", Organizations: []string{"Sectigo Limited"}},
+	})
+
+	if owner, ok := table.Owner(root); !ok || owner != "Example Owner" {
+		t.Errorf("Expected the root to be found by Subject + SPKI hash, got %q", owner)
+	}
+	// Only known by organization, through the alias for COMODO
+	if owner, ok := table.Owner(testOwnedCA(t, "COMODO CA Limited")); !ok || owner != "Sectigo" {
+		t.Errorf("Expected COMODO to belong to Sectigo, got %q", owner)
+	}
+	if _, ok := table.Owner(testOwnedCA(t, "Unknown Org")); ok {
+		t.Errorf("Did not expect an owner for an unknown organization")
+	}
+
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}, testOwnedCA(t, "The USERTRUST Network"))
+	if owner, ok := table.IssuerOwner(leaf); !ok || owner != "Sectigo" {
+		t.Errorf("Expected the leaf's issuer to belong to Sectigo, got %q", owner)
+	}
+
+	groups := table.GroupByIssuerOwner([]*x509.Certificate{leaf, root})
+	if len(groups) != 2 || groups[0].Name != "Sectigo" || groups[1].Name != "Example Trust" {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+}
+
+func TestOwnerTableYAMLRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	hash := sha256.Sum256([]byte("ca"))
+	table := NewOwnerTable("1", []CAOwner{
+		{Name: "Example, LLC", Organizations: []string{"Example, LLC"}, SubjectSPKI: [][sha256.Size]byte{hash}},
+	})
+
+	data, err := yaml.Marshal(table)
+	if err != nil {
+		t.Fatalf("Could not marshal: %s", err)
+	}
+	parsed, err := ParseOwnerTable(data)
+	if err != nil {
+		t.Fatalf("Could not parse %s: %s", data, err)
+	}
+	if parsed.Version != "1" || len(parsed.Owners) != 1 || parsed.Owners[0].Name != "Example, LLC" ||
+		len(parsed.Owners[0].Organizations) != 1 || parsed.Owners[0].SubjectSPKI[0] != hash {
+		t.Errorf("Table did not round trip: %+v", parsed.Owners)
+	}
+
+	if _, err := ParseOwnerTable([]byte("owners: []\n")); err == nil {
+		t.Errorf("Expected an error for a table without a version")
+	}
+	if _, err := ParseOwnerTable([]byte("version: x\nowners:\n  - name: A\n    subjectSPKI: [zz]\n")); err == nil {
+		t.Errorf("Expected an error for an invalid hash")
+	}
+}
+
+func TestImportCCADBOwners(t *testing.T) {
+	t.Parallel()
+
+	first, second := sha256.Sum256([]byte("first")), sha256.Sum256([]byte("second"))
+	report := fmt.Sprintf(`"CA Owner","Certificate Name","Subject + SPKI SHA256","Certificate Subject Organization"
+"Example Owner","Example Root","%X","Example Trust"
+"Example Owner","Example Issuing CA","%X","Example Trust"
+"","Orphan","%X",""
+"Other Owner","Other Root","",""
+`, first, second, first)
+
+	table, err := ImportCCADBOwners(strings.NewReader(report), "imported")
+	if err != nil {
+		t.Fatalf("Could not import: %s", err)
+	}
+	if len(table.Owners) != 2 || table.Owners[0].Name != "Example Owner" || table.Owners[1].Name != "Other Owner" {
+		t.Fatalf("Unexpected owners: %+v", table.Owners)
+	}
+	owner := table.Owners[0]
+	if len(owner.SubjectSPKI) != 2 || len(owner.Organizations) != 1 || owner.Organizations[0] != "Example Trust" {
+		t.Errorf("Unexpected owner: %+v", owner)
+	}
+	if table.bySubjectSPKI[second] != "Example Owner" {
+		t.Errorf("Expected the hash to be indexed")
+	}
+
+	if _, err := ImportCCADBOwners(strings.NewReader("\"CA Owner\"\n\"A\"\n"), "x"); err == nil {
+		t.Errorf("Expected an error without a Subject + SPKI column")
+	}
+}
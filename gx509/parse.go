@@ -0,0 +1,90 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// ParseCertificatesFromBytes returns the certificates in data, which is
+// either PEM, whose CERTIFICATE and PKCS7 blocks are read and other blocks
+// skipped, one or more concatenated DER certificates, or a DER PKCS#7
+// bundle such as a .p7b file.
+func ParseCertificatesFromBytes(data []byte) ([]*x509.Certificate, error) {
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		var certs []*x509.Certificate
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				cert, err := parseCertificate(block.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("Could not parse PEM certificate: %s", err)
+				}
+				certs = append(certs, cert)
+			case "PKCS7":
+				bundle, err := ParsePKCS7Certificates(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, bundle...)
+			}
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("No CERTIFICATE or PKCS7 blocks found")
+		}
+		return certs, nil
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("No certificates found")
+	}
+	certs, err := x509.ParseCertificates(data)
+	if err != nil {
+		if bundle, pkcs7Err := ParsePKCS7Certificates(data); pkcs7Err == nil {
+			return bundle, nil
+		}
+		if cert, lenientErr := parseCertificate(data); lenientErr == nil {
+			return []*x509.Certificate{cert}, nil
+		}
+		return nil, fmt.Errorf("Could not parse DER certificate: %s", err)
+	}
+	return certs, nil
+}
+
+// parseCertificate parses der with crypto/x509 or, if crypto/x509 rejects
+// it for one of the deviations the lenient parser tolerates, leniently.
+// Certificates crypto/x509 rejects for any other reason are not accepted,
+// including those with an extension the lenient parser cannot decode, which
+// X509 would silently leave out.
+func parseCertificate(der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err == nil {
+		return cert, nil
+	}
+	if c, lenientErr := (LenientParser{}).ParseCert(der); lenientErr == nil && len(c.Deviations) > 0 && len(c.Problems) == 0 {
+		return c.X509(), nil
+	}
+	return nil, err
+}
+
+// EncodingDeviations returns where cert's encoding departs from RFC 5280 in
+// ways gx509 tolerates rather than rejecting or silently normalizing: a
+// GeneralizedTime before 2050, a negative serial number, an empty issuer, or
+// an extension that appears more than once.
+func EncodingDeviations(cert *x509.Certificate) []string {
+	c, err := LenientParser{}.ParseCert(cert.Raw)
+	if err != nil {
+		return nil
+	}
+	return c.Deviations
+}
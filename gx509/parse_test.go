@@ -0,0 +1,163 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCertificatesFromBytes(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+
+	var pemData bytes.Buffer
+	pem.Encode(&pemData, &pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{0x30, 0x00}})
+	for _, cert := range chain {
+		pem.Encode(&pemData, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	var derData []byte
+	for _, cert := range chain {
+		derData = append(derData, cert.Raw...)
+	}
+
+	p7b := testSignedData(t, chain[0], oidSHA256, nil, chain...)
+	var p7bPEM bytes.Buffer
+	pem.Encode(&p7bPEM, &pem.Block{Type: "PKCS7", Bytes: p7b})
+
+	for name, data := range map[string][]byte{"PEM": pemData.Bytes(), "DER": derData, "PKCS7 DER": p7b, "PKCS7 PEM": p7bPEM.Bytes()} {
+		certs, err := ParseCertificatesFromBytes(data)
+		if err != nil {
+			t.Fatalf("%s: Could not parse: %s", name, err)
+		}
+		if len(certs) != len(chain) {
+			t.Fatalf("%s: Expected %d certificates, got %d", name, len(chain), len(certs))
+		}
+		for i := range chain {
+			if !certs[i].Equal(chain[i]) {
+				t.Errorf("%s: Certificate %d differs", name, i)
+			}
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":         nil,
+		"key only":      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{0x30, 0x00}}),
+		"truncated DER": chain[0].Raw[:len(chain[0].Raw)-1],
+		"text":          []byte("not a certificate\n"),
+		"empty PKCS7":   testSignedData(t, chain[0], oidSHA256, nil),
+	} {
+		if certs, err := ParseCertificatesFromBytes(data); err == nil {
+			t.Errorf("%s: Expected an error, got %d certificates", name, len(certs))
+		}
+	}
+}
+
+func TestParseDeviantCertificate(t *testing.T) {
+	t.Parallel()
+
+	der := deviantCertificate(t, testChain(t, "www.example.com")[0])
+	for name, data := range map[string][]byte{"DER": der, "PEM": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})} {
+		// crypto/x509 may reject the negative serial number, in which case
+		// the certificate is parsed leniently
+		certs, err := ParseCertificatesFromBytes(data)
+		if err != nil {
+			t.Fatalf("%s: Could not parse: %s", name, err)
+		}
+		if len(certs) != 1 || certs[0].SerialNumber.Int64() != -42 || certs[0].Subject.CommonName != "www.example.com" {
+			t.Errorf("%s: Unexpected certificates %v", name, certs)
+		}
+		if deviations := EncodingDeviations(certs[0]); len(deviations) != 3 {
+			t.Errorf("%s: Expected 3 deviations, got %q", name, deviations)
+		}
+		if result := NewConstraintResult(name, certs[0], AnalyzeTechnicalConstraints(certs[0])); len(result.Deviations) != 3 {
+			t.Errorf("%s: Expected the result to carry the deviations, got %q", name, result.Deviations)
+		}
+	}
+}
+
+func TestParseDeviantCertificateWithProblems(t *testing.T) {
+	t.Parallel()
+
+	// A negative serial number, which is tolerated, and an extended key
+	// usage that cannot be decoded, which is not
+	var raw certificateASN1
+	if _, err := asn1.Unmarshal(deviantCertificate(t, testChain(t, "www.example.com")[0]), &raw); err != nil {
+		t.Fatalf("Could not decode certificate: %s", err)
+	}
+	raw.Raw, raw.TBSCertificate.Raw, raw.TBSCertificate.PublicKey.Raw = nil, nil, nil
+	for i, ext := range raw.TBSCertificate.Extensions {
+		if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			raw.TBSCertificate.Extensions[i].Value = []byte{0x30, 0x03, 0x06, 0x01}
+		}
+	}
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		t.Fatalf("Could not encode certificate: %s", err)
+	}
+
+	if c, err := (LenientParser{}).ParseCert(der); err != nil || len(c.Deviations) == 0 || len(c.Problems) == 0 {
+		t.Fatalf("Expected deviations and problems, got %v", err)
+	}
+	if certs, err := ParseCertificatesFromBytes(der); err == nil {
+		t.Errorf("Expected a parse error, got %d certificates", len(certs))
+	}
+}
+
+func TestParseDuplicateExtensions(t *testing.T) {
+	t.Parallel()
+
+	// A second NameConstraints permitting everything under .com
+	intermediate := testChain(t, "www.example.com")[1]
+	var raw certificateASN1
+	if _, err := asn1.Unmarshal(intermediate.Raw, &raw); err != nil {
+		t.Fatalf("Could not decode certificate: %s", err)
+	}
+	value, err := asn1.Marshal(nameConstraintsASN1{Permitted: []generalSubtree{{Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("com")}}}})
+	if err != nil {
+		t.Fatalf("Could not encode name constraints: %s", err)
+	}
+	raw.Raw, raw.TBSCertificate.Raw, raw.TBSCertificate.PublicKey.Raw = nil, nil, nil
+	raw.TBSCertificate.Extensions = append(raw.TBSCertificate.Extensions, pkix.Extension{Id: oidExtensionNameConstraints, Critical: true, Value: value})
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		t.Fatalf("Could not encode certificate: %s", err)
+	}
+
+	certs, err := ParseCertificatesFromBytes(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err != nil {
+		t.Fatalf("Could not parse: %s", err)
+	}
+	cert := certs[0]
+	if deviations := EncodingDeviations(cert); !reflect.DeepEqual(deviations, []string{"The extension X509v3 Name Constraints appears 2 times"}) {
+		t.Errorf("Unexpected deviations %q", deviations)
+	}
+	order := ExtensionOrder(cert)
+	if len(order) != len(intermediate.Extensions)+1 || order[len(order)-1] != "X509v3 Name Constraints" {
+		t.Errorf("Unexpected extension order %q", order)
+	}
+	for _, ext := range DecodeExtensions(cert) {
+		if ext.Duplicate != ext.Id.Equal(oidExtensionNameConstraints) {
+			t.Errorf("Expected only the name constraints marked as duplicates, got %s marked %t", ext.Name, ext.Duplicate)
+		}
+	}
+	for _, lint := range Lints {
+		if lint.Name != "duplicate-extensions" {
+			continue
+		}
+		if passed, message, ok := lint.run(cert, time.Now()); !ok || passed || message != "Duplicate extensions: X509v3 Name Constraints (2 times)" {
+			t.Errorf("Expected the duplicate-extensions lint to fail, got %t, %q", passed, message)
+		}
+		if passed, _, _ := lint.run(intermediate, time.Now()); !passed {
+			t.Errorf("Expected the duplicate-extensions lint to pass without duplicates")
+		}
+	}
+}
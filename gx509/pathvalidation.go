@@ -0,0 +1,576 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+
+// PathValidationInput holds the inputs of RFC 5280 section 6.1.1 beyond the
+// path itself.
+type PathValidationInput struct {
+	// Time is when the path is validated; the zero time means now.
+	Time time.Time
+	// InitialPolicySet is the user-initial-policy-set; empty means
+	// anyPolicy.
+	InitialPolicySet []asn1.ObjectIdentifier
+	// InitialPolicyMappingInhibit, InitialExplicitPolicy and
+	// InitialAnyPolicyInhibit are the initial-policy-mapping-inhibit,
+	// initial-explicit-policy and initial-any-policy-inhibit inputs.
+	InitialPolicyMappingInhibit bool
+	InitialExplicitPolicy       bool
+	InitialAnyPolicyInhibit     bool
+}
+
+// A PolicyNode is a node of the valid_policy_tree.
+type PolicyNode struct {
+	ValidPolicy asn1.ObjectIdentifier
+	// Qualifiers is the DER of the policyQualifiers the policy was asserted
+	// with, if any.
+	Qualifiers        []byte
+	Critical          bool
+	ExpectedPolicySet []asn1.ObjectIdentifier
+	Children          []*PolicyNode
+
+	parent *PolicyNode
+}
+
+// addChild adds a node for policy beneath n, expecting the same policy.
+func (n *PolicyNode) addChild(policy asn1.ObjectIdentifier, qualifiers []byte, critical bool) *PolicyNode {
+	child := &PolicyNode{
+		ValidPolicy:       policy,
+		Qualifiers:        qualifiers,
+		Critical:          critical,
+		ExpectedPolicySet: []asn1.ObjectIdentifier{policy},
+		parent:            n,
+	}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// remove detaches n from its parent.
+func (n *PolicyNode) remove() {
+	siblings := n.parent.Children
+	for i, sibling := range siblings {
+		if sibling == n {
+			n.parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			return
+		}
+	}
+}
+
+// atDepth returns the nodes depth levels beneath n.
+func (n *PolicyNode) atDepth(depth int) []*PolicyNode {
+	if depth == 0 {
+		return []*PolicyNode{n}
+	}
+	var nodes []*PolicyNode
+	for _, child := range n.Children {
+		nodes = append(nodes, child.atDepth(depth-1)...)
+	}
+	return nodes
+}
+
+// String draws the tree beneath n, one node per line.
+func (n *PolicyNode) String() string {
+	var b bytes.Buffer
+	var draw func(node *PolicyNode, indent string)
+	draw = func(node *PolicyNode, indent string) {
+		var expected []string
+		for _, policy := range node.ExpectedPolicySet {
+			expected = append(expected, policy.String())
+		}
+		fmt.Fprintf(&b, "%s%s expects {%s}", indent, policyName(node.ValidPolicy), strings.Join(expected, ", "))
+		if node.Critical {
+			fmt.Fprintf(&b, " critical")
+		}
+		fmt.Fprintf(&b, "\n")
+		for _, child := range node.Children {
+			draw(child, indent+"  ")
+		}
+	}
+	draw(n, "")
+	return b.String()
+}
+
+func policyName(policy asn1.ObjectIdentifier) string {
+	if policy.Equal(OIDAnyPolicy) {
+		return "anyPolicy"
+	}
+	return policy.String()
+}
+
+func containsPolicy(policies []asn1.ObjectIdentifier, policy asn1.ObjectIdentifier) bool {
+	for _, candidate := range policies {
+		if candidate.Equal(policy) {
+			return true
+		}
+	}
+	return false
+}
+
+// prunePolicyTree deletes the nodes above depth with no children, and
+// returns the tree, or nil if nothing is left.
+func prunePolicyTree(root *PolicyNode, depth int) *PolicyNode {
+	for level := depth - 1; level >= 0; level-- {
+		for _, node := range root.atDepth(level) {
+			if len(node.Children) > 0 {
+				continue
+			}
+			if node == root {
+				return nil
+			}
+			node.remove()
+		}
+	}
+	return root
+}
+
+// A policyInformation is one entry of a certificatePolicies extension.
+type policyInformation struct {
+	Policy     asn1.ObjectIdentifier
+	Qualifiers asn1.RawValue `asn1:"optional"`
+}
+
+// certificatePolicies decodes the certificatePolicies extension of cert,
+// keeping the qualifiers crypto/x509 drops. present is false without one.
+func certificatePolicies(cert *x509.Certificate) (policies []policyInformation, critical, present bool, err error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionCertificatePolicies) {
+			continue
+		}
+		if rest, err := asn1.Unmarshal(ext.Value, &policies); err != nil {
+			return nil, false, false, fmt.Errorf("Could not parse certificate policies: %s", err)
+		} else if len(rest) > 0 {
+			return nil, false, false, fmt.Errorf("Trailing data after certificate policies")
+		}
+		return policies, ext.Critical, true, nil
+	}
+	return nil, false, false, nil
+}
+
+// A PathValidationResult is the outcome of ValidatePath.
+type PathValidationResult struct {
+	// Valid is whether the path passed every check.
+	Valid bool
+	// Errors are the checks that failed, in processing order from the trust
+	// anchor. Processing carries on past failures so all are reported.
+	Errors []string
+	// PolicyTree is the valid_policy_tree after the user-initial-policy-set
+	// has been applied, or nil if it is NULL.
+	PolicyTree *PolicyNode
+	// AuthoritiesConstrainedPolicies are the policies the CAs in the path
+	// allow, before the user-initial-policy-set has been applied, and
+	// UserConstrainedPolicies those left after. Either may hold anyPolicy.
+	AuthoritiesConstrainedPolicies []asn1.ObjectIdentifier
+	UserConstrainedPolicies        []asn1.ObjectIdentifier
+	// ExplicitPolicy is the final value of explicit_policy; zero means a
+	// policy was required.
+	ExplicitPolicy int
+}
+
+// leafPolicies returns the valid policies of the nodes at depth in tree.
+func leafPolicies(tree *PolicyNode, depth int) []asn1.ObjectIdentifier {
+	if tree == nil {
+		return nil
+	}
+	var policies []asn1.ObjectIdentifier
+	for _, node := range tree.atDepth(depth) {
+		if !containsPolicy(policies, node.ValidPolicy) {
+			policies = append(policies, node.ValidPolicy)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].String() < policies[j].String() })
+	return policies
+}
+
+// handledCriticalExtensions are the extensions ValidatePath processes that
+// crypto/x509 may leave in UnhandledCriticalExtensions.
+var handledCriticalExtensions = []asn1.ObjectIdentifier{
+	oidExtensionCertificatePolicies,
+	oidExtensionPolicyMappings,
+	oidExtensionPolicyConstraints,
+	oidExtensionInhibitAnyPolicy,
+	oidExtensionNameConstraints,
+}
+
+// emailConstraintMatch reports whether mailbox falls within an rfc822Name
+// constraint: a whole mailbox, a host, or a domain with a leading dot for
+// the hosts beneath it.
+func emailConstraintMatch(mailbox, constraint string) bool {
+	at := strings.LastIndex(mailbox, "@")
+	if at < 0 {
+		return false
+	}
+	host := strings.ToLower(mailbox[at+1:])
+	switch {
+	case strings.Contains(constraint, "@"):
+		return mailbox[:at] == constraint[:strings.LastIndex(constraint, "@")] &&
+			host == strings.ToLower(constraint[strings.LastIndex(constraint, "@")+1:])
+	case strings.HasPrefix(constraint, "."):
+		return strings.HasSuffix(host, strings.ToLower(constraint))
+	default:
+		return host == strings.ToLower(constraint)
+	}
+}
+
+// directoryNameWithin reports whether the DER name falls within the subtree
+// with base DER: whether base's RDNs begin it.
+func directoryNameWithin(name, base []byte) bool {
+	var nameRDNs, baseRDNs pkix.RDNSequence
+	if _, err := asn1.Unmarshal(name, &nameRDNs); err != nil {
+		return false
+	}
+	if _, err := asn1.Unmarshal(base, &baseRDNs); err != nil {
+		return false
+	}
+	if len(baseRDNs) > len(nameRDNs) {
+		return false
+	}
+	return reflect.DeepEqual(nameRDNs[:len(baseRDNs)], baseRDNs)
+}
+
+// checkNameConstraints returns how the names of cert fall outside the name
+// constraints of ca.
+func checkNameConstraints(cert, ca *x509.Certificate) ([]string, error) {
+	var problems []string
+	for _, name := range cert.DNSNames {
+		if !dnsNamePermitted(ca, name, true) {
+			problems = append(problems, fmt.Sprintf("dNSName %s is outside the constraints of %s", name, ca.Subject.CommonName))
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if !ipAddressPermitted(ca, ip) {
+			problems = append(problems, fmt.Sprintf("iPAddress %s is outside the constraints of %s", ip, ca.Subject.CommonName))
+		}
+	}
+
+	constraints, err := ParseNameConstraints(ca)
+	if err != nil {
+		return nil, err
+	}
+	for _, mailbox := range cert.EmailAddresses {
+		permitted := len(constraints.PermittedEmailAddresses) == 0
+		for _, constraint := range constraints.PermittedEmailAddresses {
+			permitted = permitted || emailConstraintMatch(mailbox, constraint)
+		}
+		for _, constraint := range constraints.ExcludedEmailAddresses {
+			permitted = permitted && !emailConstraintMatch(mailbox, constraint)
+		}
+		if !permitted {
+			problems = append(problems, fmt.Sprintf("rfc822Name %s is outside the constraints of %s", mailbox, ca.Subject.CommonName))
+		}
+	}
+	if len(cert.Subject.Names) > 0 {
+		permitted := len(constraints.PermittedDirectoryNames) == 0
+		for _, base := range constraints.PermittedDirectoryNames {
+			permitted = permitted || directoryNameWithin(cert.RawSubject, base)
+		}
+		for _, base := range constraints.ExcludedDirectoryNames {
+			permitted = permitted && !directoryNameWithin(cert.RawSubject, base)
+		}
+		if !permitted {
+			problems = append(problems, fmt.Sprintf("the subject is outside the directoryName constraints of %s", ca.Subject.CommonName))
+		}
+	}
+	return problems, nil
+}
+
+// ValidatePath runs the basic path validation of RFC 5280 section 6.1 on
+// chain, which starts with the leaf and ends with the trust anchor, keeping
+// the valid_policy_tree that crypto/x509 does not expose. The trust anchor
+// contributes its name and key only. Revocation is not checked, and names in
+// the subject other than the whole DN are not matched against constraints.
+func ValidatePath(chain []*x509.Certificate, input PathValidationInput) PathValidationResult {
+	var result PathValidationResult
+	if len(chain) < 2 {
+		result.Errors = append(result.Errors, "The path needs a certificate and a trust anchor")
+		return result
+	}
+	at := input.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	fail := func(cert *x509.Certificate, format string, args ...interface{}) {
+		result.Errors = append(result.Errors, cert.Subject.CommonName+": "+fmt.Sprintf(format, args...))
+	}
+
+	// 6.1.2 Initialization
+	n := len(chain) - 1
+	tree := &PolicyNode{ValidPolicy: OIDAnyPolicy, ExpectedPolicySet: []asn1.ObjectIdentifier{OIDAnyPolicy}}
+	explicitPolicy, inhibitAnyPolicy, policyMapping := n+1, n+1, n+1
+	if input.InitialExplicitPolicy {
+		explicitPolicy = 0
+	}
+	if input.InitialAnyPolicyInhibit {
+		inhibitAnyPolicy = 0
+	}
+	if input.InitialPolicyMappingInhibit {
+		policyMapping = 0
+	}
+	maxPathLength := n
+	var constraining []*x509.Certificate
+
+	// Certificate i of RFC 5280 is chain[n-i]
+	for i := 1; i <= n; i++ {
+		cert, issuer := chain[n-i], chain[n-i+1]
+		last := i == n
+		selfIssued := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+
+		// 6.1.3 (a) Basic certificate information
+		if err := issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+			fail(cert, "signature does not verify: %s", err)
+		}
+		if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+			fail(cert, "not valid at %s", at.Format(time.RFC3339))
+		}
+		if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+			fail(cert, "issuer does not match the subject of %s", issuer.Subject.CommonName)
+		}
+
+		// (b) and (c) Name constraints
+		if !selfIssued || last {
+			for _, ca := range constraining {
+				problems, err := checkNameConstraints(cert, ca)
+				if err != nil {
+					fail(ca, "%s", err)
+				}
+				for _, problem := range problems {
+					fail(cert, "%s", problem)
+				}
+			}
+		}
+
+		// (d) and (e) Certificate policies
+		policies, critical, present, err := certificatePolicies(cert)
+		if err != nil {
+			fail(cert, "%s", err)
+		}
+		if !present {
+			tree = nil
+		} else if tree != nil {
+			parents := tree.atDepth(i - 1)
+			var anyPolicyQualifiers []byte
+			hasAnyPolicy := false
+			for _, info := range policies {
+				if info.Policy.Equal(OIDAnyPolicy) {
+					hasAnyPolicy = true
+					anyPolicyQualifiers = info.Qualifiers.FullBytes
+					continue
+				}
+				matched := false
+				for _, parent := range parents {
+					if containsPolicy(parent.ExpectedPolicySet, info.Policy) {
+						parent.addChild(info.Policy, info.Qualifiers.FullBytes, critical)
+						matched = true
+					}
+				}
+				if !matched {
+					for _, parent := range parents {
+						if parent.ValidPolicy.Equal(OIDAnyPolicy) {
+							parent.addChild(info.Policy, info.Qualifiers.FullBytes, critical)
+						}
+					}
+				}
+			}
+			if hasAnyPolicy && (inhibitAnyPolicy > 0 || (!last && selfIssued)) {
+				for _, parent := range parents {
+					for _, expected := range parent.ExpectedPolicySet {
+						exists := false
+						for _, child := range parent.Children {
+							exists = exists || child.ValidPolicy.Equal(expected)
+						}
+						if !exists {
+							parent.addChild(expected, anyPolicyQualifiers, critical)
+						}
+					}
+				}
+			}
+			tree = prunePolicyTree(tree, i)
+		}
+
+		// (f)
+		if explicitPolicy == 0 && tree == nil {
+			fail(cert, "an explicit policy is required, but no policy is valid")
+		}
+
+		constraints, err := ParsePolicyConstraints(cert)
+		if err != nil {
+			fail(cert, "%s", err)
+		}
+
+		if last {
+			break
+		}
+
+		// 6.1.4 (a) and (b) Policy mappings
+		for _, mapping := range constraints.Mappings {
+			if mapping.IssuerDomainPolicy.Equal(OIDAnyPolicy) || mapping.SubjectDomainPolicy.Equal(OIDAnyPolicy) {
+				fail(cert, "maps anyPolicy")
+			}
+		}
+		if tree != nil && len(constraints.Mappings) > 0 {
+			mapped := make(map[string][]asn1.ObjectIdentifier)
+			var issuerPolicies []asn1.ObjectIdentifier
+			for _, mapping := range constraints.Mappings {
+				key := mapping.IssuerDomainPolicy.String()
+				if _, ok := mapped[key]; !ok {
+					issuerPolicies = append(issuerPolicies, mapping.IssuerDomainPolicy)
+				}
+				mapped[key] = append(mapped[key], mapping.SubjectDomainPolicy)
+			}
+			for _, policy := range issuerPolicies {
+				nodes := tree.atDepth(i)
+				found := false
+				for _, node := range nodes {
+					if !node.ValidPolicy.Equal(policy) {
+						continue
+					}
+					found = true
+					if policyMapping > 0 {
+						node.ExpectedPolicySet = mapped[policy.String()]
+					} else {
+						node.remove()
+					}
+				}
+				if found || policyMapping == 0 {
+					continue
+				}
+				for _, node := range nodes {
+					if node.ValidPolicy.Equal(OIDAnyPolicy) {
+						child := node.parent.addChild(policy, node.Qualifiers, node.Critical)
+						child.ExpectedPolicySet = mapped[policy.String()]
+						break
+					}
+				}
+			}
+			if policyMapping == 0 {
+				tree = prunePolicyTree(tree, i)
+			}
+		}
+
+		// (g) Name constraints
+		constraining = append(constraining, cert)
+
+		// (h), (i) and (j) Policy constraints
+		if !selfIssued {
+			if explicitPolicy > 0 {
+				explicitPolicy--
+			}
+			if policyMapping > 0 {
+				policyMapping--
+			}
+			if inhibitAnyPolicy > 0 {
+				inhibitAnyPolicy--
+			}
+		}
+		if r := constraints.RequireExplicitPolicy; r >= 0 && r < explicitPolicy {
+			explicitPolicy = r
+		}
+		if r := constraints.InhibitPolicyMapping; r >= 0 && r < policyMapping {
+			policyMapping = r
+		}
+		if r := constraints.InhibitAnyPolicy; r >= 0 && r < inhibitAnyPolicy {
+			inhibitAnyPolicy = r
+		}
+
+		// (k), (l) and (m) Basic constraints
+		if !cert.BasicConstraintsValid || !cert.IsCA {
+			fail(cert, "is not a CA")
+		}
+		if !selfIssued {
+			if maxPathLength > 0 {
+				maxPathLength--
+			} else {
+				fail(cert, "exceeds the path length constraint")
+			}
+		}
+		if cert.BasicConstraintsValid && (cert.MaxPathLen > 0 || (cert.MaxPathLen == 0 && cert.MaxPathLenZero)) && cert.MaxPathLen < maxPathLength {
+			maxPathLength = cert.MaxPathLen
+		}
+
+		// (n) Key usage
+		if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			fail(cert, "key usage does not allow certificate signing")
+		}
+
+		// (o) Critical extensions
+		checkCriticalExtensions(cert, fail)
+	}
+
+	// 6.1.5 Wrap-up
+	leaf := chain[0]
+	if explicitPolicy > 0 {
+		explicitPolicy--
+	}
+	if constraints, err := ParsePolicyConstraints(leaf); err == nil && constraints.RequireExplicitPolicy == 0 {
+		explicitPolicy = 0
+	}
+	checkCriticalExtensions(leaf, fail)
+
+	// (g) Intersect with the user-initial-policy-set
+	result.AuthoritiesConstrainedPolicies = leafPolicies(tree, n)
+	if tree != nil && len(input.InitialPolicySet) > 0 && !containsPolicy(input.InitialPolicySet, OIDAnyPolicy) {
+		var anyPolicyLeaf *PolicyNode
+		var validNodes []*PolicyNode
+		for depth := 1; depth <= n; depth++ {
+			for _, node := range tree.atDepth(depth) {
+				if node.parent.ValidPolicy.Equal(OIDAnyPolicy) {
+					validNodes = append(validNodes, node)
+				}
+				if depth == n && node.ValidPolicy.Equal(OIDAnyPolicy) {
+					anyPolicyLeaf = node
+				}
+			}
+		}
+		for _, node := range validNodes {
+			if !node.ValidPolicy.Equal(OIDAnyPolicy) && !containsPolicy(input.InitialPolicySet, node.ValidPolicy) {
+				node.remove()
+			}
+		}
+		if anyPolicyLeaf != nil {
+			for _, policy := range input.InitialPolicySet {
+				exists := false
+				for _, node := range validNodes {
+					exists = exists || node.ValidPolicy.Equal(policy)
+				}
+				if !exists {
+					anyPolicyLeaf.parent.addChild(policy, anyPolicyLeaf.Qualifiers, anyPolicyLeaf.Critical)
+				}
+			}
+			anyPolicyLeaf.remove()
+		}
+		tree = prunePolicyTree(tree, n)
+	}
+	result.PolicyTree = tree
+	result.UserConstrainedPolicies = leafPolicies(tree, n)
+	result.ExplicitPolicy = explicitPolicy
+
+	if explicitPolicy == 0 && tree == nil {
+		fail(leaf, "an explicit policy is required, but no policy in the user-initial-policy-set is valid")
+	}
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// checkCriticalExtensions fails cert for critical extensions that neither
+// crypto/x509 nor ValidatePath processes.
+func checkCriticalExtensions(cert *x509.Certificate, fail func(*x509.Certificate, string, ...interface{})) {
+	for _, id := range cert.UnhandledCriticalExtensions {
+		if !containsPolicy(handledCriticalExtensions, id) {
+			fail(cert, "has the unrecognised critical extension %s", id)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pathValidationTime = time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func TestValidatePathPolicyTree(t *testing.T) {
+	t.Parallel()
+
+	// policy 2 is mapped to 3, and the leaf's anyPolicy is inhibited
+	chain := policyChain(t, []asn1.ObjectIdentifier{testPolicy1, testPolicy2}, policyExtensions(t), testPolicy1, testPolicy3, OIDAnyPolicy)
+	result := ValidatePath(chain, PathValidationInput{Time: pathValidationTime})
+	if !result.Valid {
+		t.Fatalf("Expected a valid path, got %v", result.Errors)
+	}
+	expected := []asn1.ObjectIdentifier{testPolicy1, testPolicy3}
+	if !reflect.DeepEqual(result.UserConstrainedPolicies, expected) {
+		t.Errorf("Expected policies %v, got %v", expected, result.UserConstrainedPolicies)
+	}
+	if result.ExplicitPolicy != 0 {
+		t.Errorf("Expected an explicit policy to be required, got %d", result.ExplicitPolicy)
+	}
+	tree := "anyPolicy expects {2.5.29.32.0}\n" +
+		"  1.3.6.1.4.1.99999.1 expects {1.3.6.1.4.1.99999.1}\n" +
+		"    1.3.6.1.4.1.99999.1 expects {1.3.6.1.4.1.99999.1}\n" +
+		"  1.3.6.1.4.1.99999.2 expects {1.3.6.1.4.1.99999.3}\n" +
+		"    1.3.6.1.4.1.99999.3 expects {1.3.6.1.4.1.99999.3}\n"
+	if s := result.PolicyTree.String(); s != tree {
+		t.Errorf("Expected the tree\n%s\ngot\n%s", tree, s)
+	}
+
+	// Restricting the user-initial-policy-set to policy 2 keeps its branch
+	result = ValidatePath(chain, PathValidationInput{Time: pathValidationTime, InitialPolicySet: []asn1.ObjectIdentifier{testPolicy2}})
+	if !result.Valid || !reflect.DeepEqual(result.UserConstrainedPolicies, []asn1.ObjectIdentifier{testPolicy3}) {
+		t.Errorf("Expected policy 3 from the mapped branch, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.AuthoritiesConstrainedPolicies, []asn1.ObjectIdentifier{testPolicy1, testPolicy3}) {
+		t.Errorf("Expected the authorities to allow policies 1 and 3, got %v", result.AuthoritiesConstrainedPolicies)
+	}
+
+	// With mapping inhibited from the start, policy 2 is dropped
+	result = ValidatePath(chain, PathValidationInput{Time: pathValidationTime, InitialPolicyMappingInhibit: true})
+	if !result.Valid || !reflect.DeepEqual(result.UserConstrainedPolicies, []asn1.ObjectIdentifier{testPolicy1}) {
+		t.Errorf("Expected only policy 1, got %+v", result)
+	}
+
+	// A policy the path does not allow fails once policy is required
+	result = ValidatePath(chain, PathValidationInput{Time: pathValidationTime, InitialPolicySet: []asn1.ObjectIdentifier{{1, 2, 3}}})
+	if result.Valid || result.PolicyTree != nil {
+		t.Errorf("Expected no valid policy, got %+v", result)
+	}
+}
+
+func TestValidatePathInitialExplicitPolicy(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	at := chain[0].NotBefore.Add(time.Hour)
+	if result := ValidatePath(chain, PathValidationInput{Time: at}); !result.Valid || result.PolicyTree != nil {
+		t.Errorf("Expected a valid path without policies, got %+v", result)
+	}
+	result := ValidatePath(chain, PathValidationInput{Time: at, InitialExplicitPolicy: true})
+	if result.Valid || len(result.Errors) == 0 || !strings.Contains(result.Errors[0], "explicit policy is required") {
+		t.Errorf("Expected an explicit policy failure, got %+v", result)
+	}
+
+	chain = policyChain(t, []asn1.ObjectIdentifier{OIDAnyPolicy}, nil, OIDAnyPolicy)
+	if result := ValidatePath(chain, PathValidationInput{Time: pathValidationTime, InitialExplicitPolicy: true}); !result.Valid {
+		t.Errorf("Expected anyPolicy to satisfy an explicit policy, got %v", result.Errors)
+	}
+	if result := ValidatePath(chain, PathValidationInput{Time: pathValidationTime, InitialExplicitPolicy: true, InitialAnyPolicyInhibit: true}); result.Valid {
+		t.Errorf("Expected inhibited anyPolicy to leave no policy")
+	}
+}
+
+func TestValidatePathBasicChecks(t *testing.T) {
+	t.Parallel()
+
+	chain := policyChain(t, nil, nil)
+	if result := ValidatePath(chain, PathValidationInput{Time: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)}); result.Valid {
+		t.Errorf("Expected an expired leaf to fail")
+	} else if expected := "www.example.com: not valid at 2020-01-01T00:00:00Z"; !reflect.DeepEqual(result.Errors, []string{expected}) {
+		t.Errorf("Expected %q, got %v", expected, result.Errors)
+	}
+
+	// The leaf is no CA, so nothing beneath it is valid
+	extra := issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "beneath.example.com"},
+		NotBefore:    time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}, chain[0])
+	result := ValidatePath(append([]*x509.Certificate{extra}, chain...), PathValidationInput{Time: pathValidationTime})
+	if result.Valid || !reflect.DeepEqual(result.Errors, []string{"www.example.com: is not a CA"}) {
+		t.Errorf("Expected the leaf to be rejected as an issuer, got %v", result.Errors)
+	}
+
+	// Out of order, the signature and names do not match
+	result = ValidatePath([]*x509.Certificate{chain[1], chain[0], chain[2]}, PathValidationInput{Time: pathValidationTime})
+	if result.Valid || len(result.Errors) < 2 {
+		t.Errorf("Expected a misordered path to fail, got %v", result.Errors)
+	}
+
+	if result := ValidatePath(chain[:1], PathValidationInput{}); result.Valid {
+		t.Errorf("Expected a path without an anchor to fail")
+	}
+}
+
+func TestValidatePathNameConstraints(t *testing.T) {
+	t.Parallel()
+
+	constraints, err := asn1.Marshal(nameConstraintsASN1{
+		Permitted: []generalSubtree{
+			{Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("example.com")}},
+			{Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameRFC822Name, Bytes: []byte(".example.com")}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal name constraints: %s", err)
+	}
+	chain := policyChain(t, nil, []pkix.Extension{{Id: oidExtensionNameConstraints, Critical: true, Value: constraints}})
+	if result := ValidatePath(chain, PathValidationInput{Time: pathValidationTime}); !result.Valid {
+		t.Errorf("Expected www.example.com within the constraints, got %v", result.Errors)
+	}
+
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(5),
+		Subject:        pkix.Name{CommonName: "www.example.org"},
+		NotBefore:      time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:       time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:       []string{"www.example.org"},
+		EmailAddresses: []string{"admin@mail.example.com", "admin@example.com"},
+	}, chain[1])
+	result := ValidatePath([]*x509.Certificate{leaf, chain[1], chain[2]}, PathValidationInput{Time: pathValidationTime})
+	expected := []string{
+		"www.example.org: dNSName www.example.org is outside the constraints of Policy Intermediate",
+		"www.example.org: rfc822Name admin@example.com is outside the constraints of Policy Intermediate",
+	}
+	if result.Valid || !reflect.DeepEqual(result.Errors, expected) {
+		t.Errorf("Expected %v, got %v", expected, result.Errors)
+	}
+}
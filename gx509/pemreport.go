@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+func init() {
+	RegisterRenderer("pem", func(w io.Writer) Renderer { return pemRenderer{w} })
+	RegisterRenderer("openssl", func(w io.Writer) Renderer { return opensslRenderer{w} })
+}
+
+// pemRenderer writes the certificates of analyses, query results and
+// inventories as PEM.
+type pemRenderer struct {
+	w io.Writer
+}
+
+func (r pemRenderer) Render(report Report) error {
+	if report.Kind != AnalysisReport && report.Kind != QueryReport && report.Kind != InventoryReport {
+		return errUnsupportedReport("pem", report.Kind)
+	}
+	for _, cert := range reportCertificates(report) {
+		if err := pem.Encode(r.w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opensslRenderer writes the certificates of analyses, query results and
+// inventories in full, as openssl x509 -text does, with whether OneCRL
+// revokes each analyzed certificate if that was checked.
+type opensslRenderer struct {
+	w io.Writer
+}
+
+func (r opensslRenderer) Render(report Report) error {
+	if report.Kind != AnalysisReport && report.Kind != QueryReport && report.Kind != InventoryReport {
+		return errUnsupportedReport("openssl", report.Kind)
+	}
+	for i, cert := range reportCertificates(report) {
+		if err := WriteCertificateText(r.w, cert); err != nil {
+			return err
+		}
+		if report.Kind == AnalysisReport && report.Results[i].OneCRL != nil {
+			if _, err := fmt.Fprintf(r.w, "OneCRL: %s\n", report.Results[i].OneCRL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
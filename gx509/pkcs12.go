@@ -0,0 +1,303 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+)
+
+var (
+	oidDataContent          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContent = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	oidPBEWithSHAAnd3KeyTripleDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd2KeyTripleDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 4}
+
+	pkcs12MACHashes = map[string]func() hash.Hash{
+		"1.3.14.3.2.26":          sha1.New,
+		"2.16.840.1.101.3.4.2.1": sha256.New,
+		"2.16.840.1.101.3.4.2.2": sha512.New384,
+		"2.16.840.1.101.3.4.2.3": sha512.New,
+	}
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  pkcs12MacData `asn1:"optional"`
+}
+
+type pkcs12MacData struct {
+	Mac struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Digest    []byte
+	}
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pkcs12EncryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0,optional"`
+	}
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue    `asn1:"tag:0,explicit"`
+	Attributes []pkcs7Attribute `asn1:"set,optional"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// bmpPassword encodes password as PKCS#12 key derivation wants it: a
+// null-terminated big-endian UTF-16 string.
+func bmpPassword(password string) []byte {
+	var encoded []byte
+	for _, unit := range utf16.Encode([]rune(password)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return append(encoded, 0, 0)
+}
+
+// pkcs12KDF derives size bytes of key material for purpose id (1 for keys,
+// 2 for IVs and 3 for MAC keys) as RFC 7292 appendix B describes.
+func pkcs12KDF(h func() hash.Hash, id byte, password, salt []byte, iterations, size int) []byte {
+	u, v := h().Size(), h().BlockSize()
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		filled := make([]byte, v*((len(b)+v-1)/v))
+		for i := range filled {
+			filled[i] = b[i%len(b)]
+		}
+		return filled
+	}
+	diversifier := bytes.Repeat([]byte{id}, v)
+	input := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		digest := h()
+		digest.Write(diversifier)
+		digest.Write(input)
+		a := digest.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			digest = h()
+			digest.Write(a)
+			a = digest.Sum(nil)
+		}
+		out = append(out, a...)
+
+		// Add B + 1 to each v-byte block of the input
+		b := make([]byte, v)
+		for i := range b {
+			b[i] = a[i%u]
+		}
+		for block := 0; block < len(input); block += v {
+			carry := 1
+			for i := v - 1; i >= 0; i-- {
+				sum := int(input[block+i]) + int(b[i]) + carry
+				input[block+i] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// decryptPKCS12 decrypts ciphertext with algorithm, which is PBES2 or one of
+// the PKCS#12 triple DES schemes.
+func decryptPKCS12(algorithm pkix.AlgorithmIdentifier, ciphertext []byte, password string) ([]byte, error) {
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		return decryptPBES2(algorithm.Parameters.FullBytes, ciphertext, []byte(password))
+	}
+	if !algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDES) && !algorithm.Algorithm.Equal(oidPBEWithSHAAnd2KeyTripleDES) {
+		return nil, fmt.Errorf("Unsupported PKCS#12 encryption %s; re-export the file with AES", algorithm.Algorithm)
+	}
+
+	var params pkcs12PBEParams
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("Could not parse PKCS#12 PBE parameters: %s", err)
+	}
+	bmp := bmpPassword(password)
+	var key []byte
+	if algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDES) {
+		key = pkcs12KDF(sha1.New, 1, bmp, params.Salt, params.Iterations, 24)
+	} else {
+		key = pkcs12KDF(sha1.New, 1, bmp, params.Salt, params.Iterations, 16)
+		key = append(key, key[:8]...)
+	}
+	iv := pkcs12KDF(sha1.New, 2, bmp, params.Salt, params.Iterations, des.BlockSize)
+	blockCipher, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return decryptCBC(blockCipher, iv, ciphertext)
+}
+
+// PKCS12Contents are the certificates in a PKCS#12 file.
+type PKCS12Contents struct {
+	// Leaf is the certificate for the file's private key, or, without one,
+	// the first certificate that is not a CA. It may be nil.
+	Leaf *x509.Certificate
+	// CAs are the other certificates, in the order the file holds them.
+	CAs []*x509.Certificate
+	// HasPrivateKey is whether the file holds a private key.
+	HasPrivateKey bool
+}
+
+// ParsePKCS12 reads the certificates in a DER PKCS#12 (.p12 or .pfx) file,
+// checking its MAC with password. A wrong password is reported as
+// x509.IncorrectPasswordError. Private keys are not decrypted.
+//
+// Encrypted contents must use PBES2, as OpenSSL 3 writes by default, or
+// triple DES; the 40-bit RC2 of older files is not supported.
+func ParsePKCS12(data []byte, password string) (*PKCS12Contents, error) {
+	var pfx pfxPDU
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("Could not parse PKCS#12: %s", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Trailing data after PKCS#12")
+	}
+	if pfx.Version != 3 {
+		return nil, fmt.Errorf("Unsupported PKCS#12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContent) {
+		return nil, fmt.Errorf("Unsupported PKCS#12 content %s; only password integrity is supported", pfx.AuthSafe.ContentType)
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, fmt.Errorf("Could not parse PKCS#12 content: %s", err)
+	}
+
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		h, ok := pkcs12MACHashes[pfx.MacData.Mac.Algorithm.Algorithm.String()]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported PKCS#12 MAC algorithm %s", pfx.MacData.Mac.Algorithm.Algorithm)
+		}
+		key := pkcs12KDF(h, 3, bmpPassword(password), pfx.MacData.MacSalt, pfx.MacData.Iterations, h().Size())
+		mac := hmac.New(h, key)
+		mac.Write(authSafe)
+		if !hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+
+	var infos []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &infos); err != nil {
+		return nil, fmt.Errorf("Could not parse PKCS#12 safes: %s", err)
+	}
+	var bags []safeBag
+	for _, info := range infos {
+		var contents []byte
+		switch {
+		case info.ContentType.Equal(oidDataContent):
+			if _, err := asn1.Unmarshal(info.Content.Bytes, &contents); err != nil {
+				return nil, fmt.Errorf("Could not parse PKCS#12 safe: %s", err)
+			}
+		case info.ContentType.Equal(oidEncryptedDataContent):
+			var encrypted pkcs12EncryptedData
+			if _, err := asn1.Unmarshal(info.Content.Bytes, &encrypted); err != nil {
+				return nil, fmt.Errorf("Could not parse PKCS#12 encrypted safe: %s", err)
+			}
+			var err error
+			content := encrypted.EncryptedContentInfo
+			if contents, err = decryptPKCS12(content.ContentEncryptionAlgorithm, content.EncryptedContent, password); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported PKCS#12 safe %s", info.ContentType)
+		}
+		var safe []safeBag
+		if _, err := asn1.Unmarshal(contents, &safe); err != nil {
+			return nil, fmt.Errorf("Could not parse PKCS#12 bags: %s", err)
+		}
+		bags = append(bags, safe...)
+	}
+
+	result := &PKCS12Contents{}
+	keyIDs := make(map[string]bool)
+	for _, bag := range bags {
+		if bag.ID.Equal(oidKeyBag) || bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+			result.HasPrivateKey = true
+			keyIDs[localKeyID(bag)] = true
+		}
+	}
+	var certs []*x509.Certificate
+	for _, bag := range bags {
+		if !bag.ID.Equal(oidCertBag) {
+			continue
+		}
+		var value certBag
+		if _, err := asn1.Unmarshal(bag.Value.Bytes, &value); err != nil {
+			return nil, fmt.Errorf("Could not parse PKCS#12 certificate bag: %s", err)
+		}
+		if !value.ID.Equal(oidX509Certificate) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(value.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse PKCS#12 certificate: %s", err)
+		}
+		if id := localKeyID(bag); result.Leaf == nil && len(id) > 0 && keyIDs[id] {
+			result.Leaf = cert
+			continue
+		}
+		certs = append(certs, cert)
+	}
+
+	for _, cert := range certs {
+		if result.Leaf == nil && !cert.IsCA {
+			result.Leaf = cert
+			continue
+		}
+		result.CAs = append(result.CAs, cert)
+	}
+	return result, nil
+}
+
+// localKeyID returns the localKeyId attribute of bag, which ties
+// certificates to their keys, or "" if it has none.
+func localKeyID(bag safeBag) string {
+	for _, attribute := range bag.Attributes {
+		if attribute.Type.Equal(oidLocalKeyID) && len(attribute.Values) > 0 {
+			var id []byte
+			if _, err := asn1.Unmarshal(attribute.Values[0].FullBytes, &id); err == nil {
+				return string(id)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Written by `openssl pkcs12 -export -passout pass:hunter2` for a leaf and
+// key with their CA, with OpenSSL 3's defaults of PBES2, AES-256 and a
+// SHA-256 MAC, then with "-certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES
+// -macalg sha1".
+const (
+	testPKCS12AES = `
+MIIF3AIBAzCCBZIGCSqGSIb3DQEHAaCCBYMEggV/MIIFezCCBDIGCSqGSIb3DQEH
+BqCCBCMwggQfAgEAMIIEGAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqG
+SIb3DQEFDDAcBAhUG21kgm4uIAICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQME
+ASoEEIM/HL2yt7RJoClX4ckZ8h6AggOw+XlKvlAAEL8tDVcTeBwkOcj4E8hLlh20
+BCvDU7dA3KDwu1A+Tonq559iZeOQSRKGm9tesi4SMtFZ4vtxX8yf89vdngzoFv1G
+9jEfLaLd5JZOsqbTDlqu59U/d3LxevHyPRE7eEs+cglOV6l3xFQKfV7Iq4WP68VV
+j4EvlOID8PKHGbB8CPxvvoKOmA1d1tSN7HE8e9D7Dz5Yok5fOsFa2GZz61wzsHPT
+VSZ0t+sbQafllD4ZGTwga6ylP/7pA4ta/jhPRg2qhD8a01Qh91F5zuwuwfm0H92u
+hgnyAjBfirR7F/F44tACGnHpdHAorNQswltF0Dgd3tDZu5ZQwCdB2AS5tu8cP1Dd
+OvHoFUa+Xr1katWBVOYPk4YFCrFBmaUU99J6hilYLI6TkZ6DnzaSSRvfBToXX51d
+5PKMVrqKsGpaVhKju/mjXsv4t4AMaeQBzyjHWbdbYP+ou9QYuIXgztslsxTf9xQp
+FwAvSD+gmJTCsWe4EciXmGzPKYgPfUGTChs8QnZ0mNzT5kOUXJKfKDMBcRBsTSAb
+x887HAHpAcAbT0LjVukpBe8g5X5Wg9vZDGpJ2VLfTNb5iN+AqGEfao7YWR4o94Mh
+BysJidx8srN5E4xnMLH0db9BoO/G+i0AvE72oGghun9394Pc+YYJC/4r+NX+JE0b
+PVpHlvxAvEBMEYdO+6PpDTR3M3J6zSuFuN0IvzW0pAyqBmdXzG088dHUtakwYsDI
+eTGRboi7Ud2toMmWg09PyChcdIWu7Nrh6nTTRD9hKJlkV8qFmZ/hyz/qgixo1hS/
+KQ+o4yPL5hMHk2ku1mDTPTUP8EbJiNE6mUur6xybawJovVVVTWb+wOHFvw7yjiiw
+N0EfDmTMzrpCXzcylWoD2CMuatdPhHACmtQM+ZATFj4uNTyrLkQEPaoPULnaLWE1
+GGcK+yT7NRwdoXyiuJVm1GkKXCxeiSeRWwUPgtvcgIxLiI3HMmznJHeJv3KIpq0h
+qKxQ7nutwjrylMK85wO/GITjVFd5SyzAuASVkPelsNaDdKJgTzmyvp+ST6+tQJZT
+zNTizawDCRdfo+w8nd24wZl6+7VwliFk8OnK4WC4aDTeJAG1Ah2rkdN1zOAJZxeL
+rC99YkEW54O8RJaOl0yPbRCnZWiRegFmMmUZWcQ6bQQwuJgvK3s36eY40of4IcCO
+kn9YEEuOGrRllC+f3/ooaZLYenFpI29Dmj0+wJVMSdV2a2fhWvEWKfJNcnmXO4wG
+XhBEiLc+tX8wggFBBgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0B
+DAoBAqCB7zCB7DBXBgkqhkiG9w0BBQ0wSjApBgkqhkiG9w0BBQwwHAQIvNbb+jVT
+DyYCAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUDBAEqBBA3YshiPGqwSX93FNJp
+ngXZBIGQ2Str85oO7wr0CVMGErTl20iLNO5FjVOZE17yTs+sjaJxe1Q3IbNeo+QS
+Bk0nAvPW2yBtUMdQyy9/cfKjNhrNR/sKG/mu0C76GzoBZMINR35yGfWOejujQdqz
+bOvv59zkEm17HksKNaqoJjW3XWjOjZNVoL5J0niqs/sd8a9H5sxhYVMDrt9e2P1I
+LmUhMvEvMSUwIwYJKoZIhvcNAQkVMRYEFEF4JXQV74DIvuqSO0ZrFK6Nhl3EMEEw
+MTANBglghkgBZQMEAgEFAAQgx3qPy+mlCVjZC3Lxt+DmztPEPKDba+tG69HiDhpN
+ZWYECGBJ2UTqXsi+AgIIAA==`
+	testPKCS12DES = `
+MIIFSgIBAzCCBRAGCSqGSIb3DQEHAaCCBQEEggT9MIIE+TCCA+8GCSqGSIb3DQEH
+BqCCA+AwggPcAgEAMIID1QYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIGZE8
+8/mz4zsCAggAgIIDqPxirDlQkgVPlQ5uvWIJZdvevAyB9MAXITcUBRml6Aw2gnxu
+osSrU6I1Iu+UfHPnhI1XPWE73OVgau9auU/ktoLv0jzME6OWswtPqEzCXVxITI31
+0skZ3sFmx5fIt5aAIiYVtlhONOrUvSxVE4A0p4EpqZNeZpoiLndma01k3JrduGCn
+4Kdj6PKmOnMrRv4OmIdya6Y31ulIMtqmffFT6puTs27NK7yu2hB/Elib287wStTJ
+8vUrzzSMO1q8yGSe1uuz9l65KZMGNsnNTJ1oqGKpAdkVH1o8MEOO9HuY7DD7EVOd
+TydNViJT57NBv1tDz10QmP1ZbUyiv0J/O0q3a9Ysmf95xthlbKRZ348bdCDRFyIc
+g7V9seK3G9U0rbTjl7TeLhnnMikOYOnW4eUh2HM3W9Kb0S/cPgTReaeBGGj3lGg2
+D4XUNl4JWKBg1F/pyDMxHhjxBeyD1oUZGwa7M07hponyM+tiKpaJfpF0CouY93AO
+lcqz/2cepOg5II/WVMG1Zc9TAx5aURBVm2bFBGzDxbe32SIaaGk/itCnHXsXhCxf
+iG7u3dFYi6IQ2Hh373RXt2gItwfIHD2qL3j9HX1j5PgOX0OdpePXLARrxQpj9nnG
+67H2MiUvNK64ECjR/XSxTG5iVrRAQRNQvgGkDSuovrN4cYR+tF3ICkcNvu86b7zs
+VmtzSAkA857eqyE6sqqqUw7kE4QsdwTPbWUH9wBwsjfSh7WAN6Tg08b2RdM+Qn/R
+xtxWiAQ8gRzCAIZ+AEysbgwgqH+s/iJq26y130NBrQMyBwAQVdA3Ltz0cm2914yK
+gf03QGmuj4s/5b8LMQN0JsiFkfuAu/EnM4Heqx6M889H0bgwY/syg2T6xzlAVbS4
+iQAjDYhGX6iSXGVixJmU9DuJ7E5H0OCFGCXOyP7+e0R6tgqArOrF05K8I3GVWNJI
+MKYz/ZrC+GD2hGLDH9R3N0YQ5imlJxqoiO5kcHQ/jP1p6v/AHitvitM1kMnwym15
+opgZ1gucLShZPf/ORjsWGsABtxSFVGu/foTeztBt+pxxWOMmB7DlGZAs7xP3uaH7
+iTmtEJXDQCZCK2Eu2FgrbkztYkL+kDJ5DrOH+BweI/OmRwKyhLcL3iJ8xMyvz4PF
++N4WvEG9Aa6cfSD8tN1ioYvnYvpAHjE/zEuQpBcknivu+ZG9fKsRnhIwZV6CyWir
+njb13FvAY7wQZcmcmYqxoTIAlIT73q3fpZbFn9DxIDMvNgyfqjCCAQIGCSqGSIb3
+DQEHAaCB9ASB8TCB7jCB6wYLKoZIhvcNAQwKAQKggbQwgbEwHAYKKoZIhvcNAQwB
+AzAOBAhvBL9fhWSiUwICCAAEgZBdD3ls+f7gV3BGSylx/8dTSyxDih8vjLQGNddN
+bxJmZcJL/+P9PaUw2QLg2q3icZeQiTiPpZadh7KcMMRRIx/JQcd0T6svp8HVh+Su
+J6FxQXqZhOfswxooMsc0vpeDIc2H5K6e2Tbf9chV8rYa+FLb3Uw/yxKrgHOv24l2
+l3WBW4oDmr+3EnFf8nnNwDI9gHExJTAjBgkqhkiG9w0BCRUxFgQUQXgldBXvgMi+
+6pI7RmsUro2GXcQwMTAhMAkGBSsOAwIaBQAEFLDcLNCmd+pDJcgCfQWB5uLO1wYX
+BAhrZiAVJo2FMAICCAA=`
+)
+
+func decodeTestPKCS12(t *testing.T, encoded string) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(encoded, "\n", "", -1))
+	if err != nil {
+		t.Fatalf("Could not decode test PKCS#12: %s", err)
+	}
+	return data
+}
+
+func TestParsePKCS12(t *testing.T) {
+	t.Parallel()
+
+	for _, encoded := range []string{testPKCS12AES, testPKCS12DES} {
+		data := decodeTestPKCS12(t, encoded)
+		if _, err := ParsePKCS12(data, "hunter3"); err != x509.IncorrectPasswordError {
+			t.Errorf("Expected IncorrectPasswordError, got %v", err)
+		}
+
+		contents, err := ParsePKCS12(data, "hunter2")
+		if err != nil {
+			t.Fatalf("Could not parse PKCS#12: %s", err)
+		}
+		if !contents.HasPrivateKey || contents.Leaf == nil || contents.Leaf.Subject.CommonName != "p12.example.com" {
+			t.Fatalf("Expected the leaf p12.example.com with its key, got %+v", contents)
+		}
+		if len(contents.CAs) != 1 || contents.CAs[0].Subject.CommonName != "P12 Test CA" || !contents.CAs[0].IsCA {
+			t.Fatalf("Expected the CA P12 Test CA, got %+v", contents.CAs)
+		}
+		if err := contents.Leaf.CheckSignatureFrom(contents.CAs[0]); err != nil {
+			t.Errorf("Expected the CA to have issued the leaf: %s", err)
+		}
+		if analysis := AnalyzeTechnicalConstraints(contents.CAs[0]); analysis.Constrained {
+			t.Errorf("Expected the CA without EKUs to be unconstrained")
+		}
+	}
+
+	if _, err := ParsePKCS12([]byte("not a PKCS#12 file"), ""); err == nil {
+		t.Errorf("Expected an error for a file that is not PKCS#12")
+	}
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	t.Parallel()
+
+	// From the PKCS#12 test vectors for key derivation with SHA-1
+	salt, _ := hex.DecodeString("0A58CF64530D823F")
+	key := pkcs12KDF(sha1.New, 1, bmpPassword("smeg"), salt, 1, 24)
+	if expected := "8aaae6297b6cb04642ab5b077851284eb7128f1a2a7fbca3"; hex.EncodeToString(key) != expected {
+		t.Errorf("Expected key %s, got %x", expected, key)
+	}
+	iv := pkcs12KDF(sha1.New, 2, bmpPassword("smeg"), salt, 1, 8)
+	if expected := "79993dfe048d3b76"; hex.EncodeToString(iv) != expected {
+		t.Errorf("Expected IV %s, got %x", expected, iv)
+	}
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes []pkcs7Attribute `asn1:"optional,tag:1"`
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// parseSignedData parses a DER ContentInfo holding PKCS#7 SignedData,
+// returning it and the certificates it carries.
+func parseSignedData(der []byte) (*signedData, []*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, nil, fmt.Errorf("Could not parse PKCS#7: %s", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("PKCS#7 content is %s, not SignedData", info.ContentType)
+	}
+
+	var data signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		return nil, nil, fmt.Errorf("Could not parse PKCS#7 SignedData: %s", err)
+	}
+	var certs []*x509.Certificate
+	if len(data.Certificates.Bytes) > 0 {
+		var err error
+		if certs, err = x509.ParseCertificates(data.Certificates.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("Could not parse PKCS#7 certificates: %s", err)
+		}
+	}
+	return &data, certs, nil
+}
+
+// ParsePKCS7Certificates returns the certificates in a DER PKCS#7
+// SignedData, such as a certificate-only .p7b bundle. Signers, if any, are
+// ignored.
+func ParsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	_, certs, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("PKCS#7 bundle holds no certificates")
+	}
+	return certs, nil
+}
+
+// signerCertificate finds the certificate a signer identifies, if it is
+// among certs.
+func signerCertificate(signer signerInfo, certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 &&
+			string(cert.RawIssuer) == string(signer.IssuerAndSerialNumber.Issuer.FullBytes) {
+			return cert
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	oidExtensionPolicyMappings    = asn1.ObjectIdentifier{2, 5, 29, 33}
+	oidExtensionPolicyConstraints = asn1.ObjectIdentifier{2, 5, 29, 36}
+	oidExtensionInhibitAnyPolicy  = asn1.ObjectIdentifier{2, 5, 29, 54}
+
+	// OIDAnyPolicy is the anyPolicy certificate policy, which stands for
+	// every policy.
+	OIDAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+)
+
+// A PolicyMapping says that IssuerDomainPolicy in the issuer's domain is
+// SubjectDomainPolicy in the subject's.
+type PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+// PolicyConstraints are the policyConstraints, policyMappings and
+// inhibitAnyPolicy extensions of a CA certificate, which crypto/x509 does not
+// parse. The skip counts are -1 when absent.
+type PolicyConstraints struct {
+	// RequireExplicitPolicy is how many more certificates may follow before
+	// every one must assert an acceptable policy.
+	RequireExplicitPolicy int
+	// InhibitPolicyMapping is how many more may follow before policy mapping
+	// is no longer allowed.
+	InhibitPolicyMapping int
+	// InhibitAnyPolicy is how many more may follow before anyPolicy no
+	// longer matches other policies.
+	InhibitAnyPolicy int
+	Mappings         []PolicyMapping
+}
+
+// ParsePolicyConstraints decodes the policy constraining extensions of cert.
+func ParsePolicyConstraints(cert *x509.Certificate) (PolicyConstraints, error) {
+	constraints := PolicyConstraints{RequireExplicitPolicy: -1, InhibitPolicyMapping: -1, InhibitAnyPolicy: -1}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionPolicyConstraints):
+			var value struct {
+				RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+				InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+			}
+			if rest, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				return constraints, fmt.Errorf("Could not parse policy constraints: %s", err)
+			} else if len(rest) > 0 {
+				return constraints, fmt.Errorf("Trailing data after policy constraints")
+			}
+			constraints.RequireExplicitPolicy = value.RequireExplicitPolicy
+			constraints.InhibitPolicyMapping = value.InhibitPolicyMapping
+		case ext.Id.Equal(oidExtensionPolicyMappings):
+			if rest, err := asn1.Unmarshal(ext.Value, &constraints.Mappings); err != nil {
+				return constraints, fmt.Errorf("Could not parse policy mappings: %s", err)
+			} else if len(rest) > 0 {
+				return constraints, fmt.Errorf("Trailing data after policy mappings")
+			}
+		case ext.Id.Equal(oidExtensionInhibitAnyPolicy):
+			if rest, err := asn1.Unmarshal(ext.Value, &constraints.InhibitAnyPolicy); err != nil {
+				return constraints, fmt.Errorf("Could not parse inhibitAnyPolicy: %s", err)
+			} else if len(rest) > 0 {
+				return constraints, fmt.Errorf("Trailing data after inhibitAnyPolicy")
+			}
+		}
+	}
+	return constraints, nil
+}
+
+// String describes the constraints in the manner of openssl x509 -text.
+func (c PolicyConstraints) String() string {
+	var parts []string
+	if c.RequireExplicitPolicy >= 0 {
+		parts = append(parts, fmt.Sprintf("Require Explicit Policy:%d", c.RequireExplicitPolicy))
+	}
+	if c.InhibitPolicyMapping >= 0 {
+		parts = append(parts, fmt.Sprintf("Inhibit Policy Mapping:%d", c.InhibitPolicyMapping))
+	}
+	if c.InhibitAnyPolicy >= 0 {
+		parts = append(parts, fmt.Sprintf("Inhibit Any Policy:%d", c.InhibitAnyPolicy))
+	}
+	for _, mapping := range c.Mappings {
+		parts = append(parts, fmt.Sprintf("%s:%s", mapping.IssuerDomainPolicy, mapping.SubjectDomainPolicy))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// A ChainPolicy is the outcome of processing certificate policies along a
+// chain as RFC 5280 section 6.1 does, with the valid policy tree reduced to
+// the set of policies at its leaves.
+type ChainPolicy struct {
+	// Policies are the policies the chain is valid for, or nil if none are.
+	// They may include OIDAnyPolicy.
+	Policies []asn1.ObjectIdentifier
+	// ExplicitPolicyRequired is whether a policyConstraints extension in the
+	// chain requires the leaf to carry an acceptable policy.
+	ExplicitPolicyRequired bool
+	// AnyPolicyInhibited and MappingInhibited are whether inhibitAnyPolicy
+	// and inhibitPolicyMapping took effect before the leaf.
+	AnyPolicyInhibited bool
+	MappingInhibited   bool
+	// Valid is false if policy is required and no policy is valid.
+	Valid bool
+	// Notes describe what constrained the policies, in chain order from the
+	// root.
+	Notes []string
+}
+
+// ProcessChainPolicies works out the policies chain, which starts with the
+// leaf and ends with the trust anchor, is valid for. The anchor's own
+// extensions are not considered.
+func ProcessChainPolicies(chain []*x509.Certificate) (ChainPolicy, error) {
+	var result ChainPolicy
+	n := len(chain) - 1
+	explicitPolicy, inhibitAnyPolicy, policyMapping := n+1, n+1, n+1
+	valid := map[string]asn1.ObjectIdentifier{OIDAnyPolicy.String(): OIDAnyPolicy}
+
+	for i := n - 1; i >= 0; i-- {
+		cert := chain[i]
+		last := i == 0
+		selfIssued := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+		constraints, err := ParsePolicyConstraints(cert)
+		if err != nil {
+			return result, fmt.Errorf("%s: %s", cert.Subject.CommonName, err)
+		}
+
+		if valid != nil {
+			asserted := make(map[string]asn1.ObjectIdentifier)
+			hasAnyPolicy := false
+			for _, policy := range cert.PolicyIdentifiers {
+				if policy.Equal(OIDAnyPolicy) {
+					hasAnyPolicy = true
+					continue
+				}
+				if _, ok := valid[policy.String()]; ok {
+					asserted[policy.String()] = policy
+				} else if _, ok := valid[OIDAnyPolicy.String()]; ok {
+					asserted[policy.String()] = policy
+				}
+			}
+			if hasAnyPolicy && (inhibitAnyPolicy > 0 || (!last && selfIssued)) {
+				for key, policy := range valid {
+					asserted[key] = policy
+				}
+			} else if hasAnyPolicy {
+				result.Notes = append(result.Notes, fmt.Sprintf("%s: anyPolicy is inhibited and ignored", cert.Subject.CommonName))
+			}
+			if len(asserted) == 0 {
+				valid = nil
+				result.Notes = append(result.Notes, fmt.Sprintf("%s: asserts no valid policy, leaving none", cert.Subject.CommonName))
+			} else {
+				valid = asserted
+			}
+		}
+
+		if !last {
+			if len(constraints.Mappings) > 0 && valid != nil {
+				for _, mapping := range constraints.Mappings {
+					// Under anyPolicy, any issuer domain policy can be mapped
+					key := mapping.IssuerDomainPolicy.String()
+					_, mapped := valid[key]
+					_, underAnyPolicy := valid[OIDAnyPolicy.String()]
+					if !mapped && !underAnyPolicy {
+						continue
+					}
+					delete(valid, key)
+					if policyMapping > 0 {
+						valid[mapping.SubjectDomainPolicy.String()] = mapping.SubjectDomainPolicy
+						result.Notes = append(result.Notes, fmt.Sprintf("%s: maps %s to %s", cert.Subject.CommonName, mapping.IssuerDomainPolicy, mapping.SubjectDomainPolicy))
+					} else {
+						result.Notes = append(result.Notes, fmt.Sprintf("%s: mapping of %s is inhibited, dropping it", cert.Subject.CommonName, mapping.IssuerDomainPolicy))
+					}
+				}
+				if len(valid) == 0 {
+					valid = nil
+				}
+			}
+
+			if !selfIssued {
+				if explicitPolicy > 0 {
+					explicitPolicy--
+				}
+				if policyMapping > 0 {
+					policyMapping--
+				}
+				if inhibitAnyPolicy > 0 {
+					inhibitAnyPolicy--
+				}
+			}
+			if r := constraints.RequireExplicitPolicy; r >= 0 && r < explicitPolicy {
+				explicitPolicy = r
+				result.Notes = append(result.Notes, fmt.Sprintf("%s: requires an explicit policy after %d more certificates", cert.Subject.CommonName, r))
+			}
+			if r := constraints.InhibitPolicyMapping; r >= 0 && r < policyMapping {
+				policyMapping = r
+				result.Notes = append(result.Notes, fmt.Sprintf("%s: inhibits policy mapping after %d more certificates", cert.Subject.CommonName, r))
+			}
+			if r := constraints.InhibitAnyPolicy; r >= 0 && r < inhibitAnyPolicy {
+				inhibitAnyPolicy = r
+				result.Notes = append(result.Notes, fmt.Sprintf("%s: inhibits anyPolicy after %d more certificates", cert.Subject.CommonName, r))
+			}
+		} else {
+			if explicitPolicy > 0 {
+				explicitPolicy--
+			}
+			if constraints.RequireExplicitPolicy == 0 {
+				explicitPolicy = 0
+			}
+		}
+	}
+
+	for _, policy := range valid {
+		result.Policies = append(result.Policies, policy)
+	}
+	sort.Slice(result.Policies, func(i, j int) bool {
+		return result.Policies[i].String() < result.Policies[j].String()
+	})
+	result.ExplicitPolicyRequired = explicitPolicy == 0
+	result.AnyPolicyInhibited = inhibitAnyPolicy == 0
+	result.MappingInhibited = policyMapping == 0
+	result.Valid = !result.ExplicitPolicyRequired || len(result.Policies) > 0
+	return result, nil
+}
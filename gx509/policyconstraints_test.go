@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	testPolicy1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	testPolicy2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+	testPolicy3 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 3}
+)
+
+// policyChain issues an intermediate with policies and extra extensions
+// from a root, and a leaf asserting leafPolicies from it.
+func policyChain(t *testing.T, policies []asn1.ObjectIdentifier, extensions []pkix.Extension, leafPolicies ...asn1.ObjectIdentifier) []*x509.Certificate {
+	root := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Policy Root"},
+		NotBefore:             time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	intermediate := issueAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Policy Intermediate"},
+		NotBefore:             time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PolicyIdentifiers:     policies,
+		ExtraExtensions:       extensions,
+	}, root)
+	leaf := issueAndParse(t, &x509.Certificate{
+		SerialNumber:      big.NewInt(3),
+		Subject:           pkix.Name{CommonName: "www.example.com"},
+		NotBefore:         time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:          time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:          []string{"www.example.com"},
+		PolicyIdentifiers: leafPolicies,
+	}, intermediate)
+	return []*x509.Certificate{leaf, intermediate, root}
+}
+
+func policyExtensions(t *testing.T) []pkix.Extension {
+	mappings, err := asn1.Marshal([]PolicyMapping{{IssuerDomainPolicy: testPolicy2, SubjectDomainPolicy: testPolicy3}})
+	if err != nil {
+		t.Fatalf("Could not marshal mappings: %s", err)
+	}
+	return []pkix.Extension{
+		// requireExplicitPolicy 0, inhibitPolicyMapping 1
+		{Id: oidExtensionPolicyConstraints, Value: []byte{0x30, 0x06, 0x80, 0x01, 0x00, 0x81, 0x01, 0x01}},
+		{Id: oidExtensionPolicyMappings, Value: mappings},
+		{Id: oidExtensionInhibitAnyPolicy, Value: []byte{0x02, 0x01, 0x00}},
+	}
+}
+
+func TestParsePolicyConstraints(t *testing.T) {
+	t.Parallel()
+
+	chain := policyChain(t, []asn1.ObjectIdentifier{testPolicy1, testPolicy2}, policyExtensions(t))
+	constraints, err := ParsePolicyConstraints(chain[1])
+	if err != nil {
+		t.Fatalf("Could not parse policy constraints: %s", err)
+	}
+	expected := PolicyConstraints{
+		RequireExplicitPolicy: 0,
+		InhibitPolicyMapping:  1,
+		InhibitAnyPolicy:      0,
+		Mappings:              []PolicyMapping{{testPolicy2, testPolicy3}},
+	}
+	if !reflect.DeepEqual(constraints, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, constraints)
+	}
+	if s := constraints.String(); s != "Require Explicit Policy:0, Inhibit Policy Mapping:1, Inhibit Any Policy:0, 1.3.6.1.4.1.99999.2:1.3.6.1.4.1.99999.3" {
+		t.Errorf("Unexpected description %s", s)
+	}
+
+	constraints, err = ParsePolicyConstraints(chain[0])
+	if err != nil || constraints.RequireExplicitPolicy != -1 || constraints.InhibitPolicyMapping != -1 || constraints.InhibitAnyPolicy != -1 || constraints.String() != "" {
+		t.Errorf("Expected no constraints, got %+v (%v)", constraints, err)
+	}
+
+	broken := &x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionInhibitAnyPolicy, Value: []byte{0x02, 0x05}}}}
+	if _, err := ParsePolicyConstraints(broken); err == nil {
+		t.Errorf("Expected an error for a truncated extension")
+	}
+}
+
+func TestProcessChainPolicies(t *testing.T) {
+	t.Parallel()
+
+	// policy 2 is mapped to 3, and the leaf's anyPolicy is inhibited
+	chain := policyChain(t, []asn1.ObjectIdentifier{testPolicy1, testPolicy2}, policyExtensions(t), testPolicy1, testPolicy3, OIDAnyPolicy)
+	result, err := ProcessChainPolicies(chain)
+	if err != nil {
+		t.Fatalf("Could not process policies: %s", err)
+	}
+	if !reflect.DeepEqual(result.Policies, []asn1.ObjectIdentifier{testPolicy1, testPolicy3}) {
+		t.Errorf("Expected policies 1 and 3, got %v", result.Policies)
+	}
+	if !result.Valid || !result.ExplicitPolicyRequired || !result.AnyPolicyInhibited || result.MappingInhibited {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	expectedNotes := []string{
+		"Policy Intermediate: maps 1.3.6.1.4.1.99999.2 to 1.3.6.1.4.1.99999.3",
+		"Policy Intermediate: requires an explicit policy after 0 more certificates",
+		"Policy Intermediate: inhibits policy mapping after 1 more certificates",
+		"Policy Intermediate: inhibits anyPolicy after 0 more certificates",
+		"www.example.com: anyPolicy is inhibited and ignored",
+	}
+	if !reflect.DeepEqual(result.Notes, expectedNotes) {
+		t.Errorf("Expected notes %v, got %v", expectedNotes, result.Notes)
+	}
+
+	// A leaf outside the intermediate's policies fails once policy is required
+	chain = policyChain(t, []asn1.ObjectIdentifier{testPolicy1, testPolicy2}, policyExtensions(t), testPolicy2)
+	if result, err := ProcessChainPolicies(chain); err != nil || result.Valid || result.Policies != nil {
+		t.Errorf("Expected the chain invalid for policy, got %+v (%v)", result, err)
+	}
+
+	// Without policies or constraints, nothing is required
+	if result, err := ProcessChainPolicies(testChain(t, "www.example.com")); err != nil || !result.Valid || result.ExplicitPolicyRequired || result.Policies != nil {
+		t.Errorf("Expected an unconstrained chain, got %+v (%v)", result, err)
+	}
+
+	// anyPolicy all the way down is valid for anyPolicy
+	chain = policyChain(t, []asn1.ObjectIdentifier{OIDAnyPolicy}, nil, OIDAnyPolicy)
+	if result, err := ProcessChainPolicies(chain); err != nil || !reflect.DeepEqual(result.Policies, []asn1.ObjectIdentifier{OIDAnyPolicy}) {
+		t.Errorf("Expected anyPolicy, got %+v (%v)", result, err)
+	}
+}
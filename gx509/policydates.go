@@ -0,0 +1,114 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The policy dates shipped with this package.
+//
+//go:embed policydates.yaml
+var embeddedPolicyDates []byte
+
+// A policyDateTable holds the dates the policies and lints in this package
+// turn on.
+type policyDateTable struct {
+	version   string
+	effective map[string]time.Time
+	cutoffs   map[string]time.Time
+	// brValidityLimits are latest first.
+	brValidityLimits []brValidityLimit
+}
+
+// policyDates are the dates embedded in this package.
+var policyDates = mustParsePolicyDates(embeddedPolicyDates)
+
+// The policies and cutoffs the package cannot do without.
+var (
+	requiredPolicyDates = []string{"mozilla-2.2", "mozilla-2.5", "mozilla-2.7", "cabr-baseline"}
+	requiredCutoffs     = []string{"nsSGC", "codeSigningRSA3072"}
+)
+
+type policyDateTableYAML struct {
+	Version          string            `yaml:"version"`
+	Effective        map[string]string `yaml:"effective"`
+	Cutoffs          map[string]string `yaml:"cutoffs"`
+	BRValidityLimits []struct {
+		From      string `yaml:"from"`
+		Months    int    `yaml:"months"`
+		Days      int    `yaml:"days"`
+		Inclusive bool   `yaml:"inclusive"`
+		Rule      string `yaml:"rule"`
+	} `yaml:"brValidityLimits"`
+}
+
+// parsePolicyDates decodes a YAML policy date table.
+func parsePolicyDates(data []byte) (*policyDateTable, error) {
+	var raw policyDateTableYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Version) == 0 {
+		return nil, fmt.Errorf("Policy date table has no version")
+	}
+
+	table := &policyDateTable{version: raw.Version, effective: make(map[string]time.Time), cutoffs: make(map[string]time.Time)}
+	for _, section := range []struct {
+		raw      map[string]string
+		out      map[string]time.Time
+		required []string
+	}{
+		{raw.Effective, table.effective, requiredPolicyDates},
+		{raw.Cutoffs, table.cutoffs, requiredCutoffs},
+	} {
+		for name, date := range section.raw {
+			t, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid date for %s: %s", name, err)
+			}
+			section.out[name] = t
+		}
+		for _, name := range section.required {
+			if _, ok := section.out[name]; !ok {
+				return nil, fmt.Errorf("Policy date table %s has no date for %s", raw.Version, name)
+			}
+		}
+	}
+
+	for _, entry := range raw.BRValidityLimits {
+		from, err := time.Parse("2006-01-02", entry.From)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid date for %s: %s", entry.Rule, err)
+		}
+		if (entry.Months > 0) == (entry.Days > 0) || len(entry.Rule) == 0 {
+			return nil, fmt.Errorf("Validity limit from %s needs a rule and either months or days", entry.From)
+		}
+		table.brValidityLimits = append(table.brValidityLimits, brValidityLimit{
+			from:      from,
+			months:    entry.Months,
+			days:      entry.Days,
+			inclusive: entry.Inclusive,
+			rule:      entry.Rule,
+		})
+	}
+	sort.SliceStable(table.brValidityLimits, func(i, j int) bool {
+		return table.brValidityLimits[i].from.After(table.brValidityLimits[j].from)
+	})
+	return table, nil
+}
+
+func mustParsePolicyDates(data []byte) *policyDateTable {
+	table, err := parsePolicyDates(data)
+	if err != nil {
+		panic("Failed to parse embedded policy dates: " + err.Error())
+	}
+	return table
+}
@@ -0,0 +1,46 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicyDates(t *testing.T) {
+	t.Parallel()
+
+	if !MozillaPolicy27.Effective.Equal(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected mozilla-2.7 effective date %s", MozillaPolicy27.Effective)
+	}
+	if !nsSGCCutoff.Equal(time.Date(2016, time.August, 23, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected id-Netscape-stepUp cutoff %s", nsSGCCutoff)
+	}
+	if len(brValidityLimits) != 3 || brValidityLimits[0].days != 398 || !brValidityLimits[0].inclusive || brValidityLimits[2].months != 39 {
+		t.Errorf("Unexpected validity limits %+v", brValidityLimits)
+	}
+
+	dates := "effective: {mozilla-2.2: \"2013-07-26\", mozilla-2.5: \"2017-06-30\", mozilla-2.7: \"2020-01-01\", cabr-baseline: \"2012-07-01\"}\n" +
+		"cutoffs: {nsSGC: \"2016-08-23\", codeSigningRSA3072: \"2021-06-01\"}\n"
+	table, err := parsePolicyDates([]byte("version: \"1\"\n" + dates +
+		"brValidityLimits: [{from: \"2015-04-01\", months: 39, rule: a}, {from: \"2020-09-01\", days: 398, rule: b}]\n"))
+	if err != nil {
+		t.Fatalf("Could not parse policy dates: %s", err)
+	}
+	if table.brValidityLimits[0].rule != "b" {
+		t.Errorf("Expected the latest limit first, got %+v", table.brValidityLimits)
+	}
+	for _, data := range []string{
+		dates,
+		"version: \"1\"\ncutoffs: {nsSGC: \"2016-08-23\", codeSigningRSA3072: \"2021-06-01\"}\n",
+		"version: \"1\"\n" + dates + "brValidityLimits: [{from: \"2015-04-01\", rule: a}]\n",
+		"version: \"1\"\n" + dates + "brValidityLimits: [{from: \"1 April 2015\", days: 1, rule: a}]\n",
+		"version: \"1\"\n" + dates + "other: true\n",
+	} {
+		if _, err := parsePolicyDates([]byte(data)); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
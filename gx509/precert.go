@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+var oidExtKeyUsagePrecertificateSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}
+
+// IsPrecertificate is whether cert is a Certificate Transparency
+// precertificate: one with the critical poison extension of RFC 6962
+// section 3.1, which no relying party will accept, issued only to be logged.
+func IsPrecertificate(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionCTPoison) && ext.Critical {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrecertificateSigningCert is whether cert is a CA certificate that may
+// only sign precertificates on behalf of its issuer.
+func IsPrecertificateSigningCert(cert *x509.Certificate) bool {
+	for _, usage := range cert.UnknownExtKeyUsage {
+		if usage.Equal(oidExtKeyUsagePrecertificateSigning) {
+			return true
+		}
+	}
+	return false
+}
+
+// ComparableTBS is the TBSCertificate of cert without the poison and SCT
+// list extensions, which is the same for a precertificate and the final
+// certificate issued from it, and what the logs signed. A precertificate
+// signed by a dedicated precertificate signing CA names that CA as issuer,
+// and so differs from the final certificate in its issuer and authority key
+// identifier too.
+func ComparableTBS(cert *x509.Certificate) ([]byte, error) {
+	var tbs asn1.RawValue
+	if err := unmarshalAll(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, err
+	}
+	var fields []byte
+	for rest := tbs.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, err
+		}
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			fields = append(fields, field.FullBytes...)
+			continue
+		}
+
+		// The extensions are explicitly tagged [3]
+		var extensions asn1.RawValue
+		if err := unmarshalAll(field.Bytes, &extensions); err != nil {
+			return nil, err
+		}
+		var kept []byte
+		for extRest := extensions.Bytes; len(extRest) > 0; {
+			var raw asn1.RawValue
+			var ext pkix.Extension
+			if extRest, err = asn1.Unmarshal(extRest, &raw); err != nil {
+				return nil, err
+			}
+			if err := unmarshalAll(raw.FullBytes, &ext); err != nil {
+				return nil, err
+			}
+			if !ext.Id.Equal(oidExtensionSCTList) && !ext.Id.Equal(oidExtensionCTPoison) {
+				kept = append(kept, raw.FullBytes...)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		sequence, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: kept})
+		if err != nil {
+			return nil, err
+		}
+		tagged, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: sequence})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, tagged...)
+	}
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+}
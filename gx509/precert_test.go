@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestComparableTBS(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(20),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	issue := func(serial int64, extension pkix.Extension) *x509.Certificate {
+		withExtension := *template
+		withExtension.SerialNumber = big.NewInt(serial)
+		withExtension.ExtraExtensions = []pkix.Extension{extension}
+		return issueAndParse(t, &withExtension, chain[1])
+	}
+	precert := issue(20, pkix.Extension{Id: oidExtensionCTPoison, Critical: true, Value: []byte{0x05, 0x00}})
+	final := issue(20, pkix.Extension{Id: oidExtensionSCTList, Value: []byte{0x04, 0x02, 0x00, 0x00}})
+	other := issue(21, pkix.Extension{Id: oidExtensionSCTList, Value: []byte{0x04, 0x02, 0x00, 0x00}})
+
+	if !IsPrecertificate(precert) || IsPrecertificate(final) || IsPrecertificate(chain[0]) {
+		t.Errorf("Expected only the poisoned certificate to be a precertificate")
+	}
+	precertTBS, err := ComparableTBS(precert)
+	if err != nil {
+		t.Fatalf("Could not rebuild TBS: %s", err)
+	}
+	finalTBS, _ := ComparableTBS(final)
+	otherTBS, _ := ComparableTBS(other)
+	if !bytes.Equal(precertTBS, finalTBS) {
+		t.Errorf("Expected the precertificate and final certificate to have the same TBS")
+	}
+	if bytes.Equal(precertTBS, otherTBS) {
+		t.Errorf("Expected a certificate with another serial number to differ")
+	}
+	if tbs, _ := ComparableTBS(chain[0]); !bytes.Equal(tbs, chain[0].RawTBSCertificate) {
+		t.Errorf("Expected the TBS of a certificate without either extension to be unchanged")
+	}
+}
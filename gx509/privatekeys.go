@@ -0,0 +1,229 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ErrEncryptedPrivateKey is returned for private keys that need a password.
+var ErrEncryptedPrivateKey = errors.New("private key is encrypted")
+
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// A PrivateKey is a parsed private key along with the DER
+// SubjectPublicKeyInfo of its public half, which is compared against
+// certificates so that keys match regardless of how they were encoded.
+type PrivateKey struct {
+	Key crypto.PrivateKey
+	// Public is the DER SubjectPublicKeyInfo of the public key.
+	Public []byte
+}
+
+// IsPrivateKeyBlock reports whether block holds a private key.
+func IsPrivateKeyBlock(block *pem.Block) bool {
+	switch block.Type {
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		return true
+	}
+	return false
+}
+
+// ParsePrivateKeyBlock parses a PKCS#1, SEC 1 or PKCS#8 private key PEM block
+// holding an RSA, ECDSA or Ed25519 key. Encrypted keys return
+// ErrEncryptedPrivateKey.
+func ParsePrivateKeyBlock(block *pem.Block) (*PrivateKey, error) {
+	if block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block) {
+		return nil, ErrEncryptedPrivateKey
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = parsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("Unknown private key type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newPrivateKey(key)
+}
+
+type pkcs8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// parsePKCS8PrivateKey adds Ed25519, from RFC 8410, to the key types
+// x509.ParsePKCS8PrivateKey knows.
+func parsePKCS8PrivateKey(der []byte) (crypto.PrivateKey, error) {
+	var info pkcs8
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidEd25519) {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+
+	var seed []byte
+	if _, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil {
+		return nil, fmt.Errorf("Invalid Ed25519 private key: %s", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Invalid Ed25519 private key length %d", len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func newPrivateKey(key crypto.PrivateKey) (*PrivateKey, error) {
+	public, err := marshalPublicKey(publicKeyOf(key))
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{Key: key, Public: public}, nil
+}
+
+func publicKeyOf(key crypto.PrivateKey) crypto.PublicKey {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
+	}
+	return nil
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// marshalPublicKey is x509.MarshalPKIXPublicKey with Ed25519 support.
+func marshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		return asn1.Marshal(subjectPublicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PublicKey: asn1.BitString{Bytes: key, BitLength: 8 * len(key)},
+		})
+	}
+	return x509.MarshalPKIXPublicKey(pub)
+}
+
+// Algorithm names the key's type and size, as DescribeKey does.
+func (k *PrivateKey) Algorithm() string {
+	if _, ok := k.Key.(ed25519.PrivateKey); ok {
+		return "Ed25519"
+	}
+	description, _ := DescribeKey(publicKeyOf(k.Key))
+	return description
+}
+
+// Matches reports whether cert certifies the key's public half.
+func (k *PrivateKey) Matches(cert *x509.Certificate) bool {
+	return PublicKeysMatch(k.Public, cert.RawSubjectPublicKeyInfo)
+}
+
+// A LocatedCertificate is a certificate found in a scan.
+type LocatedCertificate struct {
+	Path string
+	Cert *x509.Certificate
+}
+
+// A LocatedKey is a private key found in a scan. Key is nil if the key is
+// encrypted.
+type LocatedKey struct {
+	Path string
+	Key  *PrivateKey
+}
+
+// Statuses of keys found in a scan.
+const (
+	// KeyMatched keys have a matching certificate in the same directory.
+	KeyMatched = "matched"
+	// KeyMismatched keys sit next to certificates, none of which match.
+	KeyMismatched = "mismatched"
+	// KeyOrphaned keys have no certificate in their directory, nor a
+	// matching one anywhere else.
+	KeyOrphaned = "orphaned"
+	// KeyEncrypted keys could not be checked.
+	KeyEncrypted = "encrypted"
+)
+
+// A KeyFinding describes how a key found in a scan relates to the
+// certificates found with it.
+type KeyFinding struct {
+	Key    LocatedKey
+	Status string
+	// Matches are all of the certificates found that certify the key,
+	// wherever they are.
+	Matches []LocatedCertificate
+	// CA is true if any match is a CA certificate, whose private key
+	// should rarely be on a filesystem.
+	CA bool
+}
+
+// PairKeys checks each key against the certificates found in the same scan.
+func PairKeys(keys []LocatedKey, certs []LocatedCertificate) []KeyFinding {
+	directories := make(map[string]bool)
+	for _, cert := range certs {
+		directories[filepath.Dir(cert.Path)] = true
+	}
+
+	findings := make([]KeyFinding, 0, len(keys))
+	for _, key := range keys {
+		finding := KeyFinding{Key: key, Status: KeyEncrypted}
+		if key.Key == nil {
+			findings = append(findings, finding)
+			continue
+		}
+
+		dir := filepath.Dir(key.Path)
+		colocated := false
+		for _, cert := range certs {
+			if !key.Key.Matches(cert.Cert) {
+				continue
+			}
+			finding.Matches = append(finding.Matches, cert)
+			finding.CA = finding.CA || cert.Cert.IsCA
+			if filepath.Dir(cert.Path) == dir {
+				colocated = true
+			}
+		}
+
+		switch {
+		case colocated:
+			finding.Status = KeyMatched
+		case directories[dir]:
+			finding.Status = KeyMismatched
+		case len(finding.Matches) > 0:
+			// The certificate is elsewhere, which is common for
+			// /etc/ssl/private and /etc/ssl/certs
+			finding.Status = KeyMatched
+		default:
+			finding.Status = KeyOrphaned
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
@@ -0,0 +1,154 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// certifyKey issues a leaf certifying pub, signed with the test key.
+func certifyKey(t *testing.T, name string, pub interface{}) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2028, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, testPrivateKey)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+	return cert
+}
+
+func testECKey(t *testing.T) (*ecdsa.PrivateKey, *pem.Block) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal key: %s", err)
+	}
+	return key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+}
+
+func TestParsePrivateKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := ParsePrivateKeyBlock(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testPrivateKey)})
+	if err != nil {
+		t.Fatalf("Could not parse RSA key: %s", err)
+	}
+	if rsaKey.Algorithm() != "RSA 512" || !rsaKey.Matches(testChain(t, "www.example.com")[0]) {
+		t.Errorf("Expected the RSA key to match the test chain")
+	}
+
+	ecKey, block := testECKey(t)
+	parsed, err := ParsePrivateKeyBlock(block)
+	if err != nil {
+		t.Fatalf("Could not parse EC key: %s", err)
+	}
+	if parsed.Algorithm() != "ECDSA P-256" || !parsed.Matches(certifyKey(t, "ec", &ecKey.PublicKey)) {
+		t.Errorf("Expected the EC key to match its certificate")
+	}
+	if parsed.Matches(testChain(t, "www.example.com")[0]) {
+		t.Errorf("Did not expect the EC key to match an RSA certificate")
+	}
+
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte("secret"), x509.PEMCipherAES128)
+	if err != nil {
+		t.Fatalf("Could not encrypt key: %s", err)
+	}
+	if _, err := ParsePrivateKeyBlock(encrypted); err != ErrEncryptedPrivateKey {
+		t.Errorf("Expected ErrEncryptedPrivateKey, got %v", err)
+	}
+	if _, err := ParsePrivateKeyBlock(&pem.Block{Type: "ENCRYPTED PRIVATE KEY"}); err != ErrEncryptedPrivateKey {
+		t.Errorf("Expected ErrEncryptedPrivateKey, got %v", err)
+	}
+	if _, err := ParsePrivateKeyBlock(&pem.Block{Type: "DSA PRIVATE KEY"}); err == nil {
+		t.Errorf("Expected an error for an unsupported key type")
+	}
+}
+
+func TestParseEd25519PrivateKey(t *testing.T) {
+	t.Parallel()
+
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 1
+	wrapped, _ := asn1.Marshal(seed)
+	der, err := asn1.Marshal(pkcs8{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, PrivateKey: wrapped})
+	if err != nil {
+		t.Fatalf("Could not marshal key: %s", err)
+	}
+
+	key, err := ParsePrivateKeyBlock(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err != nil {
+		t.Fatalf("Could not parse Ed25519 key: %s", err)
+	}
+	if key.Algorithm() != "Ed25519" {
+		t.Errorf("Unexpected algorithm: %s", key.Algorithm())
+	}
+
+	// The RFC 8410 SubjectPublicKeyInfo prefix, then the public key
+	public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	expected := "302a300506032b6570032100" + hex.EncodeToString(public)
+	if hex.EncodeToString(key.Public) != expected {
+		t.Errorf("Unexpected public key info: %x", key.Public)
+	}
+	if !key.Matches(&x509.Certificate{RawSubjectPublicKeyInfo: key.Public}) {
+		t.Errorf("Expected the key to match a certificate with its public key")
+	}
+}
+
+func TestPairKeys(t *testing.T) {
+	t.Parallel()
+
+	ecKey, block := testECKey(t)
+	key, _ := ParsePrivateKeyBlock(block)
+	other, otherBlock := testECKey(t)
+	otherKey, _ := ParsePrivateKeyBlock(otherBlock)
+	_, orphanBlock := testECKey(t)
+	orphan, _ := ParsePrivateKeyBlock(orphanBlock)
+
+	cert := certifyKey(t, "server", &ecKey.PublicKey)
+	otherCert := certifyKey(t, "elsewhere", &other.PublicKey)
+	certs := []LocatedCertificate{
+		{Path: "/srv/tls/server.crt", Cert: cert},
+		{Path: "/etc/ssl/certs/elsewhere.pem", Cert: otherCert},
+	}
+
+	findings := PairKeys([]LocatedKey{
+		{Path: "/srv/tls/server.key", Key: key},
+		{Path: "/srv/tls/old.key", Key: orphan},
+		{Path: "/etc/ssl/private/elsewhere.key", Key: otherKey},
+		{Path: "/home/user/lost.key", Key: orphan},
+		{Path: "/srv/tls/locked.key"},
+	}, certs)
+
+	for i, expected := range []string{KeyMatched, KeyMismatched, KeyMatched, KeyOrphaned, KeyEncrypted} {
+		if findings[i].Status != expected {
+			t.Errorf("%s: expected %s, got %s", findings[i].Key.Path, expected, findings[i].Status)
+		}
+	}
+	if len(findings[0].Matches) != 1 || findings[0].Matches[0].Cert != cert || findings[0].CA {
+		t.Errorf("Unexpected matches: %+v", findings[0])
+	}
+}
@@ -0,0 +1,174 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxResponseTime is the slowest the Baseline Requirements (section 4.10.2)
+// let CRL and OCSP services answer under normal operating conditions.
+const maxResponseTime = 10 * time.Second
+
+// An Endpoint is an OCSP responder, CRL distribution point or AIA CA
+// issuers URL that a certificate names.
+type Endpoint struct {
+	// Kind is "ocsp", "crl" or "aia".
+	Kind string
+	URL  string
+	// Cert names the endpoint, and Issuer issued Cert; OCSP requests are
+	// about Cert.
+	Cert   *x509.Certificate
+	Issuer *x509.Certificate
+}
+
+// HierarchyEndpoints returns the endpoints the certificates in chain name,
+// each URL once. chain starts with the leaf and ends with the root; the root
+// names no endpoints worth probing, as nothing can revoke it.
+func HierarchyEndpoints(chain []*x509.Certificate) []Endpoint {
+	var endpoints []Endpoint
+	seen := make(map[string]bool)
+	add := func(kind, url string, cert, issuer *x509.Certificate) {
+		if seen[kind+" "+url] {
+			return
+		}
+		seen[kind+" "+url] = true
+		endpoints = append(endpoints, Endpoint{Kind: kind, URL: url, Cert: cert, Issuer: issuer})
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, url := range cert.OCSPServer {
+			add("ocsp", url, cert, issuer)
+		}
+		for _, url := range cert.CRLDistributionPoints {
+			add("crl", url, cert, issuer)
+		}
+		for _, url := range cert.IssuingCertificateURL {
+			add("aia", url, cert, issuer)
+		}
+	}
+	return endpoints
+}
+
+// probe makes one request of endpoint, returning an error unless it answers
+// with what it should: a signed OCSP response, a CRL or a certificate.
+func (e Endpoint) probe(client *http.Client) error {
+	var resp *http.Response
+	var err error
+	if e.Kind == "ocsp" {
+		var request []byte
+		if request, err = CreateOCSPRequest(e.Cert, e.Issuer, nil); err != nil {
+			return err
+		}
+		resp, err = client.Post(e.URL, "application/ocsp-request", bytes.NewReader(request))
+	} else {
+		resp, err = client.Get(e.URL)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch e.Kind {
+	case "ocsp":
+		_, err = ParseOCSPResponse(body, e.Cert, e.Issuer)
+	case "crl":
+		_, err = x509.ParseCRL(body)
+	default:
+		_, err = ParseCertificatesFromBytes(body)
+	}
+	return err
+}
+
+// A ProbeResult is how an endpoint fared over repeated probes.
+type ProbeResult struct {
+	Endpoint
+	Probes int
+	// Latencies are the response times of the successful probes.
+	Latencies []time.Duration
+	// Errors are why the other probes failed.
+	Errors []string
+}
+
+// Availability is the fraction of probes that succeeded.
+func (r ProbeResult) Availability() float64 {
+	if r.Probes == 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / float64(r.Probes)
+}
+
+// Percentile returns the response time that fraction p of successful probes
+// were no slower than, or zero if none succeeded.
+func (r ProbeResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.Latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Findings are how the endpoint fell short of the availability and response
+// times the Baseline Requirements expect of a CA's services.
+func (r ProbeResult) Findings() []string {
+	var findings []string
+	if failed := r.Probes - len(r.Latencies); failed > 0 {
+		findings = append(findings, fmt.Sprintf("%d of %d probes failed (%.1f%% available)", failed, r.Probes, 100*r.Availability()))
+	}
+	slow := 0
+	for _, latency := range r.Latencies {
+		if latency > maxResponseTime {
+			slow++
+		}
+	}
+	if slow > 0 && r.Kind != "aia" {
+		findings = append(findings, fmt.Sprintf("%d of %d responses took longer than %s", slow, len(r.Latencies), maxResponseTime))
+	}
+	return findings
+}
+
+// ProbeEndpoints probes each endpoint rounds times, waiting interval between
+// rounds, and returns the results in the same order.
+func ProbeEndpoints(client *http.Client, endpoints []Endpoint, rounds int, interval time.Duration) []ProbeResult {
+	results := make([]ProbeResult, len(endpoints))
+	for i, endpoint := range endpoints {
+		results[i].Endpoint = endpoint
+	}
+	for round := 0; round < rounds; round++ {
+		if round > 0 {
+			time.Sleep(interval)
+		}
+		for i := range results {
+			start := time.Now()
+			err := results[i].probe(client)
+			results[i].Probes++
+			if err != nil {
+				results[i].Errors = append(results[i].Errors, err.Error())
+			} else {
+				results[i].Latencies = append(results[i].Latencies, time.Since(start))
+			}
+		}
+	}
+	return results
+}
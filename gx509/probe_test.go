@@ -0,0 +1,105 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeEndpoints(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	now := time.Now()
+	ocsp := ocspResponder(t, chain[1], now.Add(-time.Hour), 4*24*time.Hour, func(v []byte) []byte { return v })
+	defer ocsp.Close()
+
+	crl, err := chain[1].CreateCRL(rand.Reader, testPrivateKey, []pkix.RevokedCertificate{}, now, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Could not create CRL: %s", err)
+	}
+	var mu sync.Mutex
+	requests := 0
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ca.crl":
+			w.Write(crl)
+		case "/ca.crt":
+			// Every other request fails
+			mu.Lock()
+			requests++
+			odd := requests%2 == 1
+			mu.Unlock()
+			if odd {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(chain[1].Raw)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer repository.Close()
+
+	leaf := *chain[0]
+	leaf.OCSPServer = []string{ocsp.URL}
+	leaf.CRLDistributionPoints = []string{repository.URL + "/ca.crl", repository.URL + "/ca.crl"}
+	leaf.IssuingCertificateURL = []string{repository.URL + "/ca.crt"}
+	intermediate := *chain[1]
+	intermediate.IssuingCertificateURL = []string{repository.URL + "/missing.crt"}
+
+	endpoints := HierarchyEndpoints([]*x509.Certificate{&leaf, &intermediate, chain[2]})
+	var kinds []string
+	for _, endpoint := range endpoints {
+		kinds = append(kinds, endpoint.Kind)
+	}
+	if expected := []string{"ocsp", "crl", "aia", "aia"}; !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("Expected endpoints %v, got %v", expected, kinds)
+	}
+
+	results := ProbeEndpoints(http.DefaultClient, endpoints, 4, time.Millisecond)
+	for i, expected := range []float64{1, 1, 0.5, 0} {
+		if results[i].Probes != 4 || results[i].Availability() != expected {
+			t.Errorf("Expected %s to be %.2f available over 4 probes, got %+v", results[i].URL, expected, results[i])
+		}
+	}
+	if results[0].Findings() != nil || results[0].Percentile(0.95) <= 0 {
+		t.Errorf("Unexpected OCSP results %+v", results[0])
+	}
+	if findings := results[2].Findings(); !reflect.DeepEqual(findings, []string{"2 of 4 probes failed (50.0% available)"}) {
+		t.Errorf("Unexpected AIA findings %v", findings)
+	}
+	if results[3].Percentile(0.5) != 0 || results[3].Errors[0] != "HTTP 404 Not Found" {
+		t.Errorf("Unexpected results for a missing certificate %+v", results[3])
+	}
+}
+
+func TestProbeResultFindings(t *testing.T) {
+	t.Parallel()
+
+	result := ProbeResult{
+		Endpoint:  Endpoint{Kind: "crl"},
+		Probes:    4,
+		Latencies: []time.Duration{12 * time.Second, time.Second, 2 * time.Second, 3 * time.Second},
+	}
+	if result.Percentile(0.5) != 2*time.Second || result.Percentile(0.95) != 12*time.Second {
+		t.Errorf("Unexpected percentiles %s and %s", result.Percentile(0.5), result.Percentile(0.95))
+	}
+	if findings := result.Findings(); !reflect.DeepEqual(findings, []string{"1 of 4 responses took longer than 10s"}) {
+		t.Errorf("Unexpected findings %v", findings)
+	}
+	result.Kind = "aia"
+	if findings := result.Findings(); findings != nil {
+		t.Errorf("Expected no response time findings for AIA, got %v", findings)
+	}
+}
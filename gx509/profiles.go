@@ -0,0 +1,103 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The leaf profiles shipped with this package.
+//
+//go:embed profiles.yaml
+var embeddedProfiles []byte
+
+// An IssuanceProfile is a named kind of leaf certificate, such as a TLS
+// server certificate, that gx509 simulate can start from.
+type IssuanceProfile struct {
+	Name        string
+	Description string
+	// Days is the leaf's lifetime.
+	Days        int
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// A ProfileSet is a versioned set of issuance profiles.
+type ProfileSet struct {
+	Version  string
+	Profiles []IssuanceProfile
+}
+
+// DefaultProfiles are the profiles embedded in this package.
+var DefaultProfiles = mustParseProfiles(embeddedProfiles)
+
+type profileSetYAML struct {
+	Version  string `yaml:"version"`
+	Profiles []struct {
+		Name        string   `yaml:"name"`
+		Description string   `yaml:"description"`
+		Days        int      `yaml:"days"`
+		ExtKeyUsage []string `yaml:"extKeyUsage"`
+	} `yaml:"profiles"`
+}
+
+// ParseProfiles decodes a YAML profile set.
+func ParseProfiles(data []byte) (*ProfileSet, error) {
+	var raw profileSetYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Version) == 0 {
+		return nil, fmt.Errorf("Profile set has no version")
+	}
+
+	set := &ProfileSet{Version: raw.Version}
+	for _, entry := range raw.Profiles {
+		if len(entry.Name) == 0 || entry.Days <= 0 {
+			return nil, fmt.Errorf("Profile set %s has a profile without a name or lifetime", raw.Version)
+		}
+		profile := IssuanceProfile{Name: entry.Name, Description: entry.Description, Days: entry.Days}
+		for _, name := range entry.ExtKeyUsage {
+			usage, err := ParseExtKeyUsage(name)
+			if err != nil {
+				return nil, fmt.Errorf("Profile %s: %s", entry.Name, err)
+			}
+			profile.ExtKeyUsage = append(profile.ExtKeyUsage, usage)
+		}
+		set.Profiles = append(set.Profiles, profile)
+	}
+	return set, nil
+}
+
+func mustParseProfiles(data []byte) *ProfileSet {
+	set, err := ParseProfiles(data)
+	if err != nil {
+		panic("Failed to parse embedded profiles: " + err.Error())
+	}
+	return set
+}
+
+// Lookup returns the profile with the given name.
+func (s *ProfileSet) Lookup(name string) (IssuanceProfile, bool) {
+	for _, profile := range s.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return IssuanceProfile{}, false
+}
+
+// Leaf returns a leaf of the profile valid from notBefore, with no names.
+func (p IssuanceProfile) Leaf(notBefore time.Time) LeafProfile {
+	return LeafProfile{
+		ExtKeyUsage: append([]x509.ExtKeyUsage(nil), p.ExtKeyUsage...),
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.Add(time.Duration(p.Days) * 24 * time.Hour),
+	}
+}
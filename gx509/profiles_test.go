@@ -0,0 +1,39 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles(t *testing.T) {
+	t.Parallel()
+
+	profile, ok := DefaultProfiles.Lookup("tls-server")
+	if !ok {
+		t.Fatalf("Expected a tls-server profile")
+	}
+	notBefore := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leaf := profile.Leaf(notBefore)
+	if !leaf.NotAfter.Equal(notBefore.AddDate(0, 0, 90)) || !reflect.DeepEqual(leaf.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("Unexpected leaf %+v", leaf)
+	}
+	if _, ok := DefaultProfiles.Lookup("nonexistent"); ok {
+		t.Errorf("Expected no profile called nonexistent")
+	}
+	for _, data := range []string{
+		"profiles: [{name: a, days: 1}]\n",
+		"version: \"1\"\nprofiles: [{name: a}]\n",
+		"version: \"1\"\nprofiles: [{name: a, days: 1, extKeyUsage: [bogus]}]\n",
+		"version: \"1\"\nprofiles: [{name: a, days: 1, lifetime: 2}]\n",
+	} {
+		if _, err := ParseProfiles([]byte(data)); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type queryKind int
+
+const (
+	queryString queryKind = iota
+	queryNumber
+	queryBool
+	queryTime
+)
+
+func (k queryKind) String() string {
+	return [...]string{"string", "number", "boolean", "time"}[k]
+}
+
+// A queryField is a property of a warehouse entry that queries can test.
+// Fields with several values, such as dns_names, match if any value does.
+type queryField struct {
+	kind   queryKind
+	values func(e *WarehouseEntry) []interface{}
+}
+
+func stringField(value func(e *WarehouseEntry) string) queryField {
+	return queryField{queryString, func(e *WarehouseEntry) []interface{} { return []interface{}{value(e)} }}
+}
+
+func stringsField(values func(e *WarehouseEntry) []string) queryField {
+	return queryField{queryString, func(e *WarehouseEntry) []interface{} {
+		var all []interface{}
+		for _, value := range values(e) {
+			all = append(all, value)
+		}
+		return all
+	}}
+}
+
+func timeField(value func(e *WarehouseEntry) time.Time) queryField {
+	return queryField{queryTime, func(e *WarehouseEntry) []interface{} { return []interface{}{value(e)} }}
+}
+
+func boolField(value func(e *WarehouseEntry) bool) queryField {
+	return queryField{queryBool, func(e *WarehouseEntry) []interface{} { return []interface{}{value(e)} }}
+}
+
+// firstOf returns the first of values, or "" if there are none.
+func firstOf(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+var queryFields = map[string]queryField{
+	"subject_cn":  stringField(func(e *WarehouseEntry) string { return e.Certificate.Subject.CommonName }),
+	"subject_o":   stringField(func(e *WarehouseEntry) string { return firstOf(e.Certificate.Subject.Organization) }),
+	"issuer_cn":   stringField(func(e *WarehouseEntry) string { return e.Certificate.Issuer.CommonName }),
+	"issuer_o":    stringField(func(e *WarehouseEntry) string { return firstOf(e.Certificate.Issuer.Organization) }),
+	"serial":      stringField(func(e *WarehouseEntry) string { return fmt.Sprintf("%x", e.Certificate.SerialNumber) }),
+	"fingerprint": stringField(func(e *WarehouseEntry) string { return fmt.Sprintf("%x", e.Fingerprint()) }),
+	"key":         stringField(func(e *WarehouseEntry) string { return DescribePublicKeyInfo(e.Certificate.RawSubjectPublicKeyInfo) }),
+	"signature_algorithm": stringField(func(e *WarehouseEntry) string {
+		return e.Certificate.SignatureAlgorithm.String()
+	}),
+	"dns_names":   stringsField(func(e *WarehouseEntry) []string { return e.Certificate.DNSNames }),
+	"source":      stringsField(func(e *WarehouseEntry) []string { return e.Sources }),
+	"not_before":  timeField(func(e *WarehouseEntry) time.Time { return e.Certificate.NotBefore }),
+	"not_after":   timeField(func(e *WarehouseEntry) time.Time { return e.Certificate.NotAfter }),
+	"first_seen":  timeField(func(e *WarehouseEntry) time.Time { return e.FirstSeen }),
+	"last_seen":   timeField(func(e *WarehouseEntry) time.Time { return e.LastSeen }),
+	"is_ca":       boolField(func(e *WarehouseEntry) bool { return e.Certificate.IsCA }),
+	"self_signed": boolField(func(e *WarehouseEntry) bool { return isSelfSigned(e.Certificate) }),
+	"weak_key": boolField(func(e *WarehouseEntry) bool {
+		_, weak := DescribeKey(e.Certificate.PublicKey)
+		return weak
+	}),
+	"constrained": boolField(func(e *WarehouseEntry) bool {
+		if e.verdict != nil {
+			return *e.verdict
+		}
+		return AnalyzeTechnicalConstraints(e.Certificate).Constrained
+	}),
+	"source_count": {queryNumber, func(e *WarehouseEntry) []interface{} { return []interface{}{int64(len(e.Sources))} }},
+}
+
+// QueryFields lists the names of the fields queries can test.
+func QueryFields() []string {
+	var names []string
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Query selects warehouse entries with a SQL-like condition, such as
+// "issuer_cn LIKE '%Acme%' AND constrained = false AND not_after > now()".
+type Query struct {
+	root queryNode
+}
+
+type queryNode interface {
+	match(e *WarehouseEntry) bool
+}
+
+type queryAnd struct{ left, right queryNode }
+type queryOr struct{ left, right queryNode }
+type queryNot struct{ node queryNode }
+
+type queryComparison struct {
+	field queryField
+	op    string
+	value interface{}
+	like  *regexp.Regexp
+}
+
+func (q queryAnd) match(e *WarehouseEntry) bool { return q.left.match(e) && q.right.match(e) }
+func (q queryOr) match(e *WarehouseEntry) bool  { return q.left.match(e) || q.right.match(e) }
+func (q queryNot) match(e *WarehouseEntry) bool { return !q.node.match(e) }
+
+func (q queryComparison) match(e *WarehouseEntry) bool {
+	for _, value := range q.field.values(e) {
+		if q.compare(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q queryComparison) compare(value interface{}) bool {
+	if q.like != nil {
+		return q.like.MatchString(value.(string)) == (q.op == "LIKE")
+	}
+
+	var order int
+	switch v := value.(type) {
+	case string:
+		order = strings.Compare(strings.ToLower(v), strings.ToLower(q.value.(string)))
+	case int64:
+		order = compareInts(v, q.value.(int64))
+	case time.Time:
+		order = v.Compare(q.value.(time.Time))
+	case bool:
+		if v != q.value.(bool) {
+			order = 1
+		}
+	}
+	switch q.op {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Match reports whether e satisfies the query.
+func (q *Query) Match(e *WarehouseEntry) bool {
+	return q.root.match(e)
+}
+
+// Select returns the entries that satisfy the query, in order.
+func (q *Query) Select(entries []*WarehouseEntry) []*WarehouseEntry {
+	var selected []*WarehouseEntry
+	for _, entry := range entries {
+		if q.Match(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+type queryToken struct {
+	text string
+	// quoted is set for string literals, whose text is unescaped.
+	quoted bool
+	pos    int
+}
+
+func tokenizeQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			var literal strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, fmt.Errorf("Unterminated string at position %d", start+1)
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				literal.WriteRune(runes[i])
+			}
+			i++
+			tokens = append(tokens, queryToken{text: literal.String(), quoted: true, pos: start + 1})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, queryToken{text: string(runes[start:i]), pos: start + 1})
+		case strings.ContainsRune("!<>", r) && i+1 < len(runes) && (runes[i+1] == '=' || r == '<' && runes[i+1] == '>'):
+			op := string(runes[i : i+2])
+			if op == "<>" {
+				op = "!="
+			}
+			tokens = append(tokens, queryToken{text: op, pos: i + 1})
+			i += 2
+		case strings.ContainsRune("=<>()+-", r):
+			tokens = append(tokens, queryToken{text: string(r), pos: i + 1})
+			i++
+		default:
+			return nil, fmt.Errorf("Unexpected %q at position %d", r, i+1)
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	now    time.Time
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if len(p.tokens) == 0 {
+		return queryToken{}, false
+	}
+	return p.tokens[0], true
+}
+
+// keyword reports whether the next token is the keyword word, consuming it
+// if so.
+func (p *queryParser) keyword(word string) bool {
+	if token, ok := p.peek(); ok && !token.quoted && strings.EqualFold(token.text, word) {
+		p.tokens = p.tokens[1:]
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) next(expected string) (queryToken, error) {
+	token, ok := p.peek()
+	if !ok {
+		return token, fmt.Errorf("Expected %s at the end of the query", expected)
+	}
+	p.tokens = p.tokens[1:]
+	return token, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = queryOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = queryAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.keyword("NOT") {
+		node, err := p.parseNot()
+		return queryNot{node}, err
+	}
+	if token, ok := p.peek(); ok && token.text == "(" && !token.quoted {
+		p.tokens = p.tokens[1:]
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, err := p.next(")"); err != nil {
+			return nil, err
+		} else if token.text != ")" || token.quoted {
+			return nil, fmt.Errorf("Expected ) at position %d", token.pos)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	token, err := p.next("a field")
+	if err != nil {
+		return nil, err
+	}
+	field, ok := queryFields[strings.ToLower(token.text)]
+	if !ok || token.quoted {
+		return nil, fmt.Errorf("Unknown field %q at position %d", token.text, token.pos)
+	}
+	name := strings.ToLower(token.text)
+
+	comparison := queryComparison{field: field}
+	switch {
+	case p.keyword("LIKE"):
+		comparison.op = "LIKE"
+	case p.keyword("NOT"):
+		if !p.keyword("LIKE") {
+			return nil, fmt.Errorf("Expected LIKE after %s NOT", name)
+		}
+		comparison.op = "NOT LIKE"
+	default:
+		if token, err = p.next("a comparison"); err != nil {
+			return nil, err
+		}
+		switch token.text {
+		case "=", "!=", "<", "<=", ">", ">=":
+			comparison.op = token.text
+		default:
+			return nil, fmt.Errorf("Expected a comparison at position %d", token.pos)
+		}
+	}
+
+	like := strings.HasSuffix(comparison.op, "LIKE")
+	if like && field.kind != queryString {
+		return nil, fmt.Errorf("%s is a %s, which LIKE cannot match", name, field.kind)
+	}
+	if comparison.value, err = p.parseValue(field.kind); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if like {
+		comparison.like = likePattern(comparison.value.(string))
+	}
+	return comparison, nil
+}
+
+// parseValue parses a literal of the given kind. Times are 'YYYY-MM-DD'
+// dates, RFC 3339 strings, or now() optionally plus or minus a number of
+// days, as in now() + 30 days.
+func (p *queryParser) parseValue(kind queryKind) (interface{}, error) {
+	token, err := p.next("a value")
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case queryString:
+		if !token.quoted {
+			return nil, fmt.Errorf("Expected a quoted string at position %d", token.pos)
+		}
+		return token.text, nil
+	case queryNumber:
+		number, err := strconv.ParseInt(token.text, 10, 64)
+		if err != nil || token.quoted {
+			return nil, fmt.Errorf("Expected a number at position %d", token.pos)
+		}
+		return number, nil
+	case queryBool:
+		switch {
+		case !token.quoted && strings.EqualFold(token.text, "true"):
+			return true, nil
+		case !token.quoted && strings.EqualFold(token.text, "false"):
+			return false, nil
+		}
+		return nil, fmt.Errorf("Expected true or false at position %d", token.pos)
+	}
+
+	if token.quoted {
+		for _, layout := range []string{"2006-01-02", time.RFC3339} {
+			if t, err := time.Parse(layout, token.text); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("Expected a date at position %d", token.pos)
+	}
+	if !strings.EqualFold(token.text, "now") {
+		return nil, fmt.Errorf("Expected a date or now() at position %d", token.pos)
+	}
+	for _, expected := range []string{"(", ")"} {
+		if token, err := p.next(expected); err != nil {
+			return nil, err
+		} else if token.text != expected || token.quoted {
+			return nil, fmt.Errorf("Expected %s at position %d", expected, token.pos)
+		}
+	}
+
+	now := p.now
+	if sign, ok := p.peek(); ok && !sign.quoted && (sign.text == "+" || sign.text == "-") {
+		p.tokens = p.tokens[1:]
+		token, err := p.next("a number of days")
+		if err != nil {
+			return nil, err
+		}
+		days, err := strconv.Atoi(token.text)
+		if err != nil || token.quoted {
+			return nil, fmt.Errorf("Expected a number of days at position %d", token.pos)
+		}
+		if !p.keyword("days") && !p.keyword("day") {
+			return nil, fmt.Errorf("Expected days after %d", days)
+		}
+		if sign.text == "-" {
+			days = -days
+		}
+		now = now.AddDate(0, 0, days)
+	}
+	return now, nil
+}
+
+// likePattern converts a SQL LIKE pattern, where % matches any run of
+// characters and _ any one, to a case-insensitive regular expression.
+func likePattern(pattern string) *regexp.Regexp {
+	var expression strings.Builder
+	expression.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expression.WriteString(".*")
+		case '_':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String())
+}
+
+// ParseQuery parses a query, taking now() to be now. Conditions compare a
+// field to a literal with =, !=, <>, <, <=, >, >= or LIKE, and combine with
+// AND, OR, NOT and parentheses.
+func ParseQuery(text string, now time.Time) (*Query, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Empty query")
+	}
+
+	parser := &queryParser{tokens: tokens, now: now}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := parser.peek(); ok {
+		return nil, fmt.Errorf("Unexpected %q at position %d", token.text, token.pos)
+	}
+	return &Query{root: root}, nil
+}
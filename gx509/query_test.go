@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testWarehouseEntries(t *testing.T) []*WarehouseEntry {
+	chain := testChain(t, "www.example.com", "api.example.com")
+	seen := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	var entries []*WarehouseEntry
+	for i, cert := range chain {
+		entries = append(entries, &WarehouseEntry{
+			Certificate: cert,
+			Raw:         cert.Raw,
+			FirstSeen:   seen,
+			LastSeen:    seen.AddDate(0, 0, i),
+			Sources:     []string{"www.example.com:443"},
+		})
+	}
+	return entries
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	entries := testWarehouseEntries(t)
+	now := time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC)
+	for query, expected := range map[string]int{
+		"issuer_cn LIKE '%acme%' AND constrained = false AND not_after > now() + 45 days": 2,
+		"issuer_cn like 'Σ Acme Co Root'":                                                 2,
+		"subject_cn NOT LIKE '%CA' AND NOT is_ca = true":                                  1,
+		"dns_names = 'API.example.com'":                                                   1,
+		"is_ca = true AND (subject_cn LIKE '%Root' OR last_seen >= '2018-04-02')":         2,
+		"not_after < now() + 60 days":                                                     1,
+		"not_after < now() - 1 day":                                                       0,
+		"self_signed = true OR source_count > 1":                                          1,
+		"subject_cn = 'it''s'":                                                            0,
+		"not_before <> '2018-03-01T00:00:00Z'":                                            2,
+		"weak_key = true":                                                                 3,
+	} {
+		parsed, err := ParseQuery(query, now)
+		if err != nil {
+			t.Errorf("Could not parse %q: %s", query, err)
+			continue
+		}
+		if selected := parsed.Select(entries); len(selected) != expected {
+			t.Errorf("%q selected %d entries, expected %d", query, len(selected), expected)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	for query, expected := range map[string]string{
+		"":                            "Empty query",
+		"owner = 'Acme'":              "Unknown field",
+		"subject_cn = Acme":           "quoted string",
+		"is_ca = 'yes'":               "true or false",
+		"not_after > 'soon'":          "Expected a date",
+		"not_after LIKE '2018%'":      "LIKE cannot match",
+		"subject_cn = 'Acme":          "Unterminated string",
+		"(is_ca = true":               "Expected )",
+		"is_ca = true is_ca = false":  "Unexpected",
+		"not_after > now() + 3 weeks": "Expected days",
+		"source_count ~ 1":            "Unexpected",
+	} {
+		if _, err := ParseQuery(query, time.Now()); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q for %q, got %v", expected, query, err)
+		}
+	}
+}
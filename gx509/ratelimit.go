@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxRateLimitedClients bounds the clients an IPRateLimiter remembers; past
+// it, the least recently seen client is forgotten.
+const maxRateLimitedClients = 100000
+
+// An IPRateLimiter limits each client to a number of requests per minute,
+// allowing bursts of up to Burst requests. Clients are IPv4 addresses or,
+// since a single IPv6 host is usually given a whole /64, IPv6 /64 networks.
+type IPRateLimiter struct {
+	PerMinute int
+	Burst     int
+
+	mu         sync.Mutex
+	maxClients int
+	// buckets holds the elements of recent, whose values are the clients'
+	// buckets, most recently seen first.
+	buckets map[string]*list.Element
+	recent  *list.List
+}
+
+type tokenBucket struct {
+	client string
+	tokens float64
+	last   time.Time
+}
+
+// NewIPRateLimiter returns a limiter allowing each client perMinute requests
+// a minute, in bursts of up to burst.
+func NewIPRateLimiter(perMinute, burst int) *IPRateLimiter {
+	return &IPRateLimiter{
+		PerMinute:  perMinute,
+		Burst:      burst,
+		maxClients: maxRateLimitedClients,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// rateLimitedClient returns the client ip belongs to: the address itself
+// for IPv4, its /64 for IPv6, or ip as it is if it does not parse.
+func rateLimitedClient(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// refill tops up bucket for the time since it was last used.
+func (l *IPRateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.last).Minutes() * float64(l.PerMinute)
+	if bucket.tokens > float64(l.Burst) {
+		bucket.tokens = float64(l.Burst)
+	}
+	bucket.last = now
+}
+
+// Allow reports whether ip may make a request at now and, if so, counts it.
+// If not, it also returns how long until ip may try again.
+func (l *IPRateLimiter) Allow(ip string, now time.Time) (bool, time.Duration) {
+	client := rateLimitedClient(ip)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var bucket *tokenBucket
+	if element, ok := l.buckets[client]; ok {
+		l.recent.MoveToFront(element)
+		bucket = element.Value.(*tokenBucket)
+	} else {
+		if l.recent.Len() >= l.maxClients {
+			oldest := l.recent.Back()
+			delete(l.buckets, oldest.Value.(*tokenBucket).client)
+			l.recent.Remove(oldest)
+		}
+		bucket = &tokenBucket{client: client, tokens: float64(l.Burst), last: now}
+		l.buckets[client] = l.recent.PushFront(bucket)
+	}
+	l.refill(bucket, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	if l.PerMinute <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - bucket.tokens) / float64(l.PerMinute) * float64(time.Minute))
+}
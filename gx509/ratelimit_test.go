@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewIPRateLimiter(6, 2)
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("192.0.2.1", now); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := limiter.Allow("192.0.2.1", now)
+	if ok || wait != 10*time.Second {
+		t.Errorf("Expected to wait 10s after the burst, got %v and %s", ok, wait)
+	}
+	if ok, _ := limiter.Allow("192.0.2.2", now); !ok {
+		t.Errorf("Expected another address to have its own limit")
+	}
+	if ok, _ := limiter.Allow("192.0.2.1", now.Add(10*time.Second)); !ok {
+		t.Errorf("Expected a request to be allowed once a token refilled")
+	}
+	if ok, _ := limiter.Allow("192.0.2.1", now.Add(15*time.Second)); ok {
+		t.Errorf("Expected the refilled token to be spent")
+	}
+
+	// IPv6 clients are limited by /64
+	for i, ip := range []string{"2001:db8:1:2::1", "2001:db8:1:2:ffff::2"} {
+		if ok, _ := limiter.Allow(ip, now); !ok {
+			t.Fatalf("Expected request %d from the /64 to be allowed", i+1)
+		}
+	}
+	if ok, _ := limiter.Allow("2001:db8:1:2::3", now); ok {
+		t.Errorf("Expected another address in the same /64 to share its limit")
+	}
+	if ok, _ := limiter.Allow("2001:db8:1:3::1", now); !ok {
+		t.Errorf("Expected another /64 to have its own limit")
+	}
+
+	// Past the bound, the least recently seen client is forgotten
+	limiter = NewIPRateLimiter(6, 1)
+	limiter.maxClients = 2
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.1", "192.0.2.3"} {
+		limiter.Allow(ip, now)
+	}
+	if len(limiter.buckets) != 2 || limiter.recent.Len() != 2 {
+		t.Errorf("Expected 2 clients remembered, got %d", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["192.0.2.2"]; ok {
+		t.Errorf("Expected the least recently seen client to be forgotten")
+	}
+	if ok, _ := limiter.Allow("192.0.2.1", now); ok {
+		t.Errorf("Expected a recently seen client to keep its limit")
+	}
+}
@@ -0,0 +1,317 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// An ImageReference names an image in a registry, as in
+// "registry.example.com/team/app:1.2" or "debian@sha256:...".
+type ImageReference struct {
+	Registry   string
+	Repository string
+	// Reference is a tag or a digest.
+	Reference string
+}
+
+const (
+	dockerHubName     = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// ParseImageReference parses an image reference the way docker does:
+// references without a registry are on Docker Hub, single-component Docker
+// Hub repositories are in "library", and the default tag is "latest".
+func ParseImageReference(s string) (ImageReference, error) {
+	ref := ImageReference{Registry: dockerHubRegistry}
+	remainder := s
+
+	if i := strings.IndexByte(remainder, '/'); i >= 0 {
+		first := remainder[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry = first
+			remainder = remainder[i+1:]
+		}
+	}
+	if ref.Registry == dockerHubName {
+		ref.Registry = dockerHubRegistry
+	}
+
+	if i := strings.IndexByte(remainder, '@'); i >= 0 {
+		ref.Reference = remainder[i+1:]
+		remainder = remainder[:i]
+	} else if i := strings.LastIndexByte(remainder, ':'); i >= 0 {
+		ref.Reference = remainder[i+1:]
+		remainder = remainder[:i]
+	} else {
+		ref.Reference = "latest"
+	}
+
+	ref.Repository = remainder
+	if len(ref.Repository) == 0 || len(ref.Reference) == 0 || ref.Repository != strings.ToLower(ref.Repository) {
+		return ImageReference{}, fmt.Errorf("Invalid image reference: %s", s)
+	}
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	return ref, nil
+}
+
+func (r ImageReference) String() string {
+	separator := ":"
+	if strings.Contains(r.Reference, ":") {
+		separator = "@"
+	}
+	return r.Registry + "/" + r.Repository + separator + r.Reference
+}
+
+// Registry pulls images from OCI distribution registries, authenticating
+// anonymously.
+type Registry struct {
+	Client *http.Client
+	// Scheme is "https" unless testing.
+	Scheme string
+	// Platform selects an image from a multi-platform index, as
+	// "os/architecture" or "os/architecture/variant".
+	Platform string
+
+	tokens map[string]string
+}
+
+// NewRegistry returns a client that pulls linux/amd64 images over HTTPS.
+func NewRegistry() *Registry {
+	return &Registry{
+		Client:   &http.Client{Timeout: 10 * time.Minute},
+		Scheme:   "https",
+		Platform: "linux/amd64",
+	}
+}
+
+const (
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	maxManifestSize         = 4 << 20
+	maxManifestIndirection  = 2
+)
+
+type registryDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+type registryManifest struct {
+	MediaType string               `json:"mediaType"`
+	Manifests []registryDescriptor `json:"manifests"`
+	Layers    []registryDescriptor `json:"layers"`
+}
+
+var bearerParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// get requests path from ref's registry, fetching an anonymous bearer token
+// if the registry asks for one.
+func (r *Registry) get(ref ImageReference, path string, accept []string) (*http.Response, error) {
+	target := r.Scheme + "://" + ref.Registry + "/v2/" + ref.Repository + path
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		if token, ok := r.tokens[ref.Registry+"/"+ref.Repository]; ok {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r.Client.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := r.authenticate(ref, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = do(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return resp, nil
+}
+
+// authenticate fetches an anonymous pull token as the challenge directs.
+func (r *Registry) authenticate(ref ImageReference, challenge string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return fmt.Errorf("%s requires credentials", ref.Registry)
+	}
+	params := make(map[string]string)
+	for _, match := range bearerParameter.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return fmt.Errorf("%s sent a challenge without a realm", ref.Registry)
+	}
+
+	query := url.Values{"scope": {"repository:" + ref.Repository + ":pull"}}
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	resp, err := r.Client.Get(realm + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s refused an anonymous token: %s", realm, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("Could not decode token from %s: %s", realm, err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+
+	if r.tokens == nil {
+		r.tokens = make(map[string]string)
+	}
+	r.tokens[ref.Registry+"/"+ref.Repository] = token.Token
+	return nil
+}
+
+// layers resolves ref to the layer digests of a single-platform image.
+func (r *Registry) layers(ref ImageReference) ([]string, error) {
+	reference := ref.Reference
+	for i := 0; i <= maxManifestIndirection; i++ {
+		resp, err := r.get(ref, "/manifests/"+reference, []string{
+			mediaTypeOCIIndex, mediaTypeOCIManifest, mediaTypeDockerList, mediaTypeDockerManifest})
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		var manifest registryManifest
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return nil, fmt.Errorf("Could not decode manifest for %s: %s", ref, err)
+		}
+		if len(manifest.MediaType) == 0 {
+			manifest.MediaType = resp.Header.Get("Content-Type")
+		}
+
+		switch manifest.MediaType {
+		case mediaTypeOCIIndex, mediaTypeDockerList:
+			next, err := r.selectPlatform(manifest.Manifests)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", ref, err)
+			}
+			reference = next
+		case mediaTypeOCIManifest, mediaTypeDockerManifest:
+			var digests []string
+			for _, layer := range manifest.Layers {
+				digests = append(digests, layer.Digest)
+			}
+			return digests, nil
+		default:
+			return nil, fmt.Errorf("Unsupported manifest type %q for %s", manifest.MediaType, ref)
+		}
+	}
+	return nil, fmt.Errorf("Too many levels of image indexes for %s", ref)
+}
+
+func (r *Registry) selectPlatform(manifests []registryDescriptor) (string, error) {
+	for _, manifest := range manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		platform := manifest.Platform.OS + "/" + manifest.Platform.Architecture
+		if platform == r.Platform || platform+"/"+manifest.Platform.Variant == r.Platform {
+			return manifest.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("No image for platform %s", r.Platform)
+}
+
+// digestVerifier checks that what it reads hashes to the expected digest once
+// it reaches the end.
+type digestVerifier struct {
+	reader   io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (v *digestVerifier) Read(p []byte) (int, error) {
+	n, err := v.reader.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := fmt.Sprintf("sha256:%x", v.hash.Sum(nil)); actual != v.expected {
+			return n, fmt.Errorf("Layer digest mismatch: expected %s, got %s", v.expected, actual)
+		}
+	}
+	return n, err
+}
+
+// ImageFiles pulls ref and reads the certificates its filesystem ships.
+func (r *Registry) ImageFiles(ref ImageReference) (ImageFiles, error) {
+	digests, err := r.layers(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(ImageFiles)
+	for _, digest := range digests {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return nil, fmt.Errorf("Unsupported layer digest %s", digest)
+		}
+		resp, err := r.get(ref, "/blobs/"+digest, nil)
+		if err != nil {
+			return nil, err
+		}
+		verifier := &digestVerifier{reader: resp.Body, hash: sha256.New(), expected: digest}
+		err = files.ApplyLayer(verifier)
+		if err == nil {
+			// Read past the end of the tarball so the digest is checked
+			_, err = io.Copy(ioutil.Discard, verifier)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read layer %s: %s", digest, err)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	t.Parallel()
+
+	for input, expected := range map[string]ImageReference{
+		"debian":                        {"registry-1.docker.io", "library/debian", "latest"},
+		"docker.io/library/debian:12":   {"registry-1.docker.io", "library/debian", "12"},
+		"grafana/grafana:10.0":          {"registry-1.docker.io", "grafana/grafana", "10.0"},
+		"ghcr.io/org/app@sha256:abcdef": {"ghcr.io", "org/app", "sha256:abcdef"},
+		"localhost:5000/app":            {"localhost:5000", "app", "latest"},
+		"localhost/app:dev":             {"localhost", "app", "dev"},
+	} {
+		ref, err := ParseImageReference(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", input, err)
+		} else if ref != expected {
+			t.Errorf("%s: expected %+v, got %+v", input, expected, ref)
+		}
+	}
+
+	for _, invalid := range []string{"", "ghcr.io/", "App", "app:"} {
+		if _, err := ParseImageReference(invalid); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
+
+	ref, _ := ParseImageReference("ghcr.io/org/app@sha256:abcdef")
+	if ref.String() != "ghcr.io/org/app@sha256:abcdef" {
+		t.Errorf("Unexpected string form: %s", ref)
+	}
+}
+
+func TestRegistryImageFiles(t *testing.T) {
+	t.Parallel()
+
+	root := testChain(t, "www.example.com")[2]
+	layer := testTarball(t, true, "etc/ssl/cert.pem", pemBundle(root))
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	corrupt := append([]byte(nil), layer...)
+
+	const token = "anonymous-token"
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:team/app:pull" || r.URL.Query().Get("service") != "test" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"token":%q}`, token)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/1.0":
+			w.Header().Set("Content-Type", mediaTypeOCIIndex)
+			fmt.Fprintf(w, `{"schemaVersion":2,"manifests":[
+				{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},
+				{"digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`)
+		case "/v2/team/app/manifests/sha256:amd":
+			w.Header().Set("Content-Type", mediaTypeDockerManifest)
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"digest":%q}]}`, layerDigest)
+		case "/v2/team/app/manifests/corrupt":
+			fmt.Fprintf(w, `{"mediaType":%q,"layers":[{"digest":"sha256:%x"}]}`,
+				mediaTypeOCIManifest, sha256.Sum256([]byte("something else")))
+		case "/v2/team/app/blobs/" + layerDigest:
+			w.Write(layer)
+		case fmt.Sprintf("/v2/team/app/blobs/sha256:%x", sha256.Sum256([]byte("something else"))):
+			w.Write(corrupt)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	registry := NewRegistry()
+	registry.Scheme = "http"
+	ref := ImageReference{Registry: strings.TrimPrefix(server.URL, "http://"), Repository: "team/app", Reference: "1.0"}
+
+	files, err := registry.ImageFiles(ref)
+	if err != nil {
+		t.Fatalf("Could not pull image: %s", err)
+	}
+	if certs := files["/etc/ssl/cert.pem"]; len(certs) != 1 || !certs[0].Equal(root) {
+		t.Errorf("Expected the root to be found: %v", files)
+	}
+
+	ref.Reference = "corrupt"
+	if _, err := registry.ImageFiles(ref); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("Expected a digest mismatch, got %v", err)
+	}
+
+	registry.Platform = "windows/amd64"
+	ref.Reference = "1.0"
+	if _, err := registry.ImageFiles(ref); err == nil {
+		t.Errorf("Expected an error for a missing platform")
+	}
+}
@@ -0,0 +1,166 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Renderer writes reports in one output format.
+type Renderer interface {
+	Render(Report) error
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = make(map[string]func(io.Writer) Renderer)
+)
+
+// RegisterRenderer makes an output format available by name, with newRenderer
+// returning a Renderer that writes to w. Packages adding formats call it from
+// an init function. It panics if the format is already registered.
+func RegisterRenderer(format string, newRenderer func(w io.Writer) Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	if _, ok := renderers[format]; ok {
+		panic("gx509: RegisterRenderer called twice for format " + format)
+	}
+	renderers[format] = newRenderer
+}
+
+// NewRenderer returns a Renderer for the registered format that writes to w.
+func NewRenderer(format string, w io.Writer) (Renderer, error) {
+	renderersMu.RLock()
+	newRenderer, ok := renderers[format]
+	renderersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown format: %s", format)
+	}
+	return newRenderer(w), nil
+}
+
+// RendererFormats returns the registered formats, sorted.
+func RendererFormats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// errUnsupportedReport is the error of a Renderer for format asked to write a
+// kind of report it does not support.
+func errUnsupportedReport(format string, kind ReportKind) error {
+	return fmt.Errorf("The %s format cannot write %s reports", format, kind)
+}
+
+// reportCertificates are the certificates in report, in order, for formats
+// that write certificates rather than findings.
+func reportCertificates(report Report) []*x509.Certificate {
+	var certs []*x509.Certificate
+	switch report.Kind {
+	case AnalysisReport:
+		for _, result := range report.Results {
+			certs = append(certs, result.Certificate)
+		}
+	case QueryReport:
+		for _, result := range report.Selected {
+			certs = append(certs, result.Certificate)
+		}
+	case InventoryReport:
+		for _, item := range report.Inventory {
+			certs = append(certs, item.Cert)
+		}
+	}
+	return certs
+}
+
+// certificateSummary is a certificate's fingerprint, subject, issuer and
+// expiry on one line.
+func certificateSummary(cert *x509.Certificate) string {
+	return fmt.Sprintf("%x %s (issuer %s, expires %s)", sha256.Sum256(cert.Raw),
+		cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+}
+
+func init() {
+	RegisterRenderer("text", func(w io.Writer) Renderer { return textRenderer{w} })
+}
+
+// textRenderer writes every kind of report as plain text: for lints, a line
+// for each failure then a summary.
+type textRenderer struct {
+	w io.Writer
+}
+
+func (r textRenderer) Render(report Report) error {
+	switch report.Kind {
+	case LintReport:
+		return r.renderLints(report)
+	case AnalysisReport:
+		constrained := 0
+		for _, result := range report.Results {
+			if result.Constrained {
+				constrained++
+			}
+			if _, err := fmt.Fprintf(r.w, "%s: %s: constrained under %s: %t, %s\n", result.Name, result.SubjectCN,
+				result.Policy, result.Constrained, result.Details); err != nil {
+				return err
+			}
+			if result.OneCRL != nil {
+				if _, err := fmt.Fprintf(r.w, "  OneCRL: %s\n", result.OneCRL); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := fmt.Fprintf(r.w, "%d certificates: %d technically constrained, %d not\n", len(report.Results), constrained, len(report.Results)-constrained)
+		return err
+	case QueryReport:
+		for _, result := range report.Selected {
+			line := certificateSummary(result.Certificate)
+			if report.StoredVerdicts {
+				line += fmt.Sprintf(": constrained under %s: %t", result.Policy, result.Constrained)
+			}
+			if _, err := fmt.Fprintf(r.w, "%s\n", line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CAStatusReport:
+		return report.CAs.WriteText(r.w)
+	case InventoryReport:
+		for _, item := range report.Inventory {
+			if _, err := fmt.Fprintf(r.w, "%s: %s\n", certificateSummary(item.Cert), strings.Join(item.Locations, ", ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errUnsupportedReport("text", report.Kind)
+}
+
+func (r textRenderer) renderLints(report Report) error {
+	certs := make(map[string]bool)
+	for _, finding := range report.Findings {
+		certs[finding.Path+"\x00"+string(finding.Cert.Raw)] = true
+	}
+	failures := report.Failures()
+	for _, finding := range failures {
+		if _, err := fmt.Fprintf(r.w, "%s: %s: %s %s: %s\n", finding.Path, finding.Cert.Subject.CommonName,
+			finding.Lint.Severity, finding.Lint.Name, finding.Message); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(r.w, "%d certificates linted, %d of %d lints failed\n", len(certs), len(failures), len(report.Findings))
+	return err
+}
@@ -0,0 +1,117 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingRenderer struct {
+	count *int
+}
+
+func (r countingRenderer) Render(report Report) error {
+	*r.count = len(report.Findings)
+	return nil
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	t.Parallel()
+
+	count := 0
+	RegisterRenderer("test-counting", func(w io.Writer) Renderer { return countingRenderer{&count} })
+	renderer, err := NewRenderer("test-counting", nil)
+	if err != nil {
+		t.Fatalf("Could not create renderer: %s", err)
+	}
+	if err := renderer.Render(testReport(t)); err != nil || count != 19 {
+		t.Errorf("Expected the registered renderer to see 19 findings, got %d and %v", count, err)
+	}
+
+	formats := RendererFormats()
+	if !sort.StringsAreSorted(formats) || !strings.Contains(strings.Join(formats, " "), "test-counting text") {
+		t.Errorf("Expected the formats sorted, got %s", formats)
+	}
+	if _, err := NewRenderer("missing", nil); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a format twice to panic")
+		}
+	}()
+	RegisterRenderer("text", nil)
+}
+
+func TestTextRenderer(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	renderer, _ := NewRenderer("text", &out)
+	if err := renderer.Render(testReport(t)); err != nil {
+		t.Fatalf("Could not render: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 || lines[0] != "certs/leaf.pem: www.example.com: error expired: Expired on 2018-06-01" {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+	if lines[5] != "3 certificates linted, 5 of 19 lints failed" {
+		t.Errorf("Unexpected summary %q", lines[5])
+	}
+}
+
+func testAnalysisReport(t *testing.T) Report {
+	chain := testChain(t, "www.example.com")
+	report := Report{Kind: AnalysisReport, Generated: time.Date(2018, time.July, 1, 0, 0, 0, 0, time.UTC)}
+	for i, cert := range chain[:2] {
+		name := fmt.Sprintf("chain.pem#%d", i+1)
+		report.Results = append(report.Results, NewConstraintResult(name, cert, AnalyzeTechnicalConstraints(cert)))
+	}
+	return report
+}
+
+func TestRenderAnalysisReport(t *testing.T) {
+	t.Parallel()
+
+	report := testAnalysisReport(t)
+	for format, lines := range map[string]int{"text": 3, "json": 2, "csv": 3} {
+		var out bytes.Buffer
+		renderer, _ := NewRenderer(format, &out)
+		if err := renderer.Render(report); err != nil {
+			t.Fatalf("Could not render %s: %s", format, err)
+		}
+		if n := len(strings.Split(strings.TrimSpace(out.String()), "\n")); n != lines {
+			t.Errorf("Expected %d lines of %s, got:\n%s", lines, format, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	renderer, _ := NewRenderer("pem", &out)
+	if err := renderer.Render(report); err != nil || strings.Count(out.String(), "BEGIN CERTIFICATE") != 2 {
+		t.Errorf("Expected two PEM certificates, got %v:\n%s", err, out.String())
+	}
+}
+
+func TestRenderUnsupportedReport(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{"junit", "sarif", "github", "cyclonedx", "html"} {
+		renderer, _ := NewRenderer(format, io.Discard)
+		if err := renderer.Render(testAnalysisReport(t)); err == nil {
+			t.Errorf("Expected %s to refuse an analysis report", format)
+		}
+	}
+	renderer, _ := NewRenderer("csv", io.Discard)
+	if err := renderer.Render(testReport(t)); err == nil {
+		t.Errorf("Expected csv to refuse a lint report")
+	}
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxVerdictRecord is the longest line ReadVerdictLog accepts.
+const maxVerdictRecord = 16 << 20
+
+// ReadVerdictLog decodes the records of a VerdictLog.
+func ReadVerdictLog(r io.Reader) ([]VerdictRecord, error) {
+	var records []VerdictRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxVerdictRecord)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record VerdictRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("Could not decode verdict log line %d: %s", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// A VerdictChange is a verdict that replaying under another policy reversed.
+type VerdictChange struct {
+	Record VerdictRecord
+	Cert   *x509.Certificate
+	// Before is the logged verdict and After the replayed one.
+	Before Verdict
+	After  Verdict
+	// Details explains the replayed analysis.
+	Details string
+}
+
+// A Replay is the outcome of ReplayVerdicts.
+type Replay struct {
+	Records  int
+	Verdicts int
+	// Missing are the fingerprints of certificates that could not be
+	// resolved, so were not replayed.
+	Missing []string
+	Changes []VerdictChange
+}
+
+// ReplayVerdicts re-evaluates the logged verdicts under policy, resolving
+// each certificate by its fingerprint with lookup, and returns those whose
+// constraint verdict changed. Each missing certificate is reported once.
+func ReplayVerdicts(records []VerdictRecord, lookup func([sha256.Size]byte) *x509.Certificate, policy Policy) Replay {
+	replay := Replay{Records: len(records)}
+	missing := make(map[string]bool)
+	for _, record := range records {
+		for _, before := range record.Verdicts {
+			fingerprint, err := ParseFingerprint(before.Fingerprint)
+			var cert *x509.Certificate
+			if err == nil {
+				cert = lookup(fingerprint)
+			}
+			if cert == nil {
+				if !missing[before.Fingerprint] {
+					missing[before.Fingerprint] = true
+					replay.Missing = append(replay.Missing, before.Fingerprint)
+				}
+				continue
+			}
+
+			replay.Verdicts++
+			analysis := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+			if analysis.Constrained == before.Constrained {
+				continue
+			}
+			after := before
+			after.Policy = policy.Name
+			after.Constrained = analysis.Constrained
+			replay.Changes = append(replay.Changes, VerdictChange{
+				Record:  record,
+				Cert:    cert,
+				Before:  before,
+				After:   after,
+				Details: analysis.Details(),
+			})
+		}
+	}
+	return replay
+}
@@ -0,0 +1,83 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayVerdicts(t *testing.T) {
+	t.Parallel()
+
+	// Constrained by dNSName alone, which stopped sufficing in 2.5
+	dnsOnly := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "DNS Only CA"},
+		NotBefore:             time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"example.com"},
+	})
+	unconstrained := testCA(t, "Unconstrained CA", nil, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	gone := testChain(t, "www.example.net")[0]
+
+	resolvable := map[[sha256.Size]byte]*x509.Certificate{
+		sha256.Sum256(dnsOnly.Raw):       dnsOnly,
+		sha256.Sum256(unconstrained.Raw): unconstrained,
+	}
+	lookup := func(fingerprint [sha256.Size]byte) *x509.Certificate {
+		return resolvable[fingerprint]
+	}
+
+	log := fmt.Sprintf("%s\n\n%s\n", mustMarshalRecord(t, VerdictRecord{
+		Caller:   "web-pki",
+		Verdicts: []Verdict{NewVerdict(dnsOnly, MozillaPolicy22), NewVerdict(unconstrained, MozillaPolicy22)},
+	}), mustMarshalRecord(t, VerdictRecord{
+		Caller:   "edge",
+		Verdicts: []Verdict{NewVerdict(gone, MozillaPolicy22), NewVerdict(gone, MozillaPolicy22), {Fingerprint: "not hex"}},
+	}))
+	records, err := ReadVerdictLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Could not read verdict log: %s", err)
+	}
+
+	replay := ReplayVerdicts(records, lookup, MozillaPolicy25)
+	if replay.Records != 2 || replay.Verdicts != 2 || len(replay.Missing) != 2 {
+		t.Errorf("Expected 2 records, 2 verdicts replayed and 2 missing, got %d, %d and %v", replay.Records, replay.Verdicts, replay.Missing)
+	}
+	if len(replay.Changes) != 1 {
+		t.Fatalf("Expected 1 change, got %+v", replay.Changes)
+	}
+	change := replay.Changes[0]
+	if change.Record.Caller != "web-pki" || !change.Cert.Equal(dnsOnly) || !change.Before.Constrained || change.Before.Policy != "mozilla-2.2" ||
+		change.After.Constrained || change.After.Policy != "mozilla-2.5" || len(change.Details) == 0 {
+		t.Errorf("Unexpected change %+v", change)
+	}
+
+	if replay := ReplayVerdicts(records, lookup, MozillaPolicy22); len(replay.Changes) != 0 {
+		t.Errorf("Expected no changes under the same policy, got %+v", replay.Changes)
+	}
+	if _, err := ReadVerdictLog(strings.NewReader("{}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func mustMarshalRecord(t *testing.T, record VerdictRecord) string {
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Could not encode record: %s", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,385 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Severity is how serious the failure of a Lint is.
+type Severity int
+
+const (
+	SeverityNotice Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityNotice:
+		return "notice"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Lint is one of the tests run on each certificate by LintCertificate.
+type Lint struct {
+	// Name identifies the lint in reports, and never changes.
+	Name        string
+	Description string
+	Severity    Severity
+
+	// run returns whether cert passes the lint as of at, with a message
+	// saying why, or ok false if the lint does not apply to cert.
+	run func(cert *x509.Certificate, at time.Time) (passed bool, message string, ok bool)
+}
+
+// weakSignatureAlgorithms are those whose hashes allow collisions.
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// Lints are the lints LintCertificate runs, in order.
+var Lints = []*Lint{
+	{
+		Name:        "expired",
+		Description: "The certificate is within its validity period.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			if at.After(cert.NotAfter) {
+				return false, fmt.Sprintf("Expired on %s", cert.NotAfter.Format("2006-01-02")), true
+			}
+			if at.Before(cert.NotBefore) {
+				return false, fmt.Sprintf("Not valid until %s", cert.NotBefore.Format("2006-01-02")), true
+			}
+			return true, fmt.Sprintf("Valid until %s", cert.NotAfter.Format("2006-01-02")), true
+		},
+	},
+	{
+		Name:        "weak-key",
+		Description: "The certificate's public key is strong enough to resist factoring or discrete logarithms.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			description, weak := DescribeKey(cert.PublicKey)
+			if weak {
+				return false, fmt.Sprintf("The %s key is too weak", description), true
+			}
+			return true, description, true
+		},
+	},
+	{
+		Name:        "weak-signature",
+		Description: "The certificate is not signed with a hash that allows collisions, such as MD5 or SHA-1.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			// The signature on a trust anchor is never checked
+			if isSelfSigned(cert) {
+				return false, "", false
+			}
+			if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+				return false, fmt.Sprintf("Signed with %s", cert.SignatureAlgorithm), true
+			}
+			return true, fmt.Sprintf("Signed with %s", cert.SignatureAlgorithm), true
+		},
+	},
+	{
+		Name:        "technically-constrained",
+		Description: "The intermediate CA is technically constrained, so it cannot issue for arbitrary names.",
+		Severity:    SeverityWarning,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			if !cert.IsCA || isSelfSigned(cert) {
+				return false, "", false
+			}
+			if analysis := AnalyzeTechnicalConstraints(cert); !analysis.Constrained {
+				return false, fmt.Sprintf("Not technically constrained: %s", analysis.Details()), true
+			}
+			return true, "Technically constrained", true
+		},
+	},
+	{
+		Name:        "validity-time-type",
+		Description: "The validity times are UTCTime through 2049 and GeneralizedTime from 2050, as RFC 5280 requires.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			times, err := validityTimes(cert)
+			if err != nil {
+				return false, "", false
+			}
+			for _, validity := range times {
+				// UTCTime cannot encode 2050 or later, so only GeneralizedTime can be wrong
+				if validity.raw.Tag == asn1.TagGeneralizedTime && validity.time.Year() < 2050 {
+					return false, fmt.Sprintf("The %s %s is a GeneralizedTime, not a UTCTime", validity.field, validity.time.Format(time.RFC3339)), true
+				}
+			}
+			return true, "The validity times are of the right type for their years", true
+		},
+	},
+	{
+		Name:        "validity-time-format",
+		Description: "The validity times include seconds and end in Z, as RFC 5280 requires.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			times, err := validityTimes(cert)
+			if err != nil {
+				return false, "", false
+			}
+			for _, validity := range times {
+				// YYMMDDHHMMSSZ or YYYYMMDDHHMMSSZ, without fractions or offsets
+				digits := 12
+				if validity.raw.Tag == asn1.TagGeneralizedTime {
+					digits = 14
+				}
+				if !isTimeDigitsZ(validity.raw.Bytes, digits) {
+					return false, fmt.Sprintf("The %s %q lacks seconds or is not in Z", validity.field, validity.raw.Bytes), true
+				}
+			}
+			return true, "The validity times include seconds and end in Z", true
+		},
+	},
+	{
+		Name:        "duplicate-extensions",
+		Description: "No extension appears twice, which RFC 5280 forbids and clients resolve differently.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			duplicates, counts := duplicateExtensions(cert.Extensions)
+			if len(duplicates) > 0 {
+				var names []string
+				for _, id := range duplicates {
+					names = append(names, fmt.Sprintf("%s (%d times)", extensionName(id), counts[id.String()]))
+				}
+				return false, "Duplicate extensions: " + strings.Join(names, ", "), true
+			}
+			return true, fmt.Sprintf("Each of the %d extensions appears once", len(cert.Extensions)), true
+		},
+	},
+	{
+		Name:        "br-validity-period",
+		Description: "The TLS server certificate's validity period is within the Baseline Requirements' limit when it was issued.",
+		Severity:    SeverityError,
+		run: func(cert *x509.Certificate, at time.Time) (bool, string, bool) {
+			if cert.IsCA || !isTLSServerCertificate(cert) {
+				return false, "", false
+			}
+			limit := brValidityLimitAt(cert.NotBefore)
+			if limit == nil {
+				return false, "", false
+			}
+			lifetime, overage := limit.check(cert)
+			days := int(lifetime / (24 * time.Hour))
+			if overage > 0 {
+				return false, fmt.Sprintf("Valid for %d days, %s over the %s", days, durationText(overage), limit), true
+			}
+			return true, fmt.Sprintf("Valid for %d days, within the %s", days, limit), true
+		},
+	},
+}
+
+// A brValidityLimit is the longest validity period the CA/Browser Forum's
+// Baseline Requirements allow for TLS server certificates issued from a
+// date, in months or days.
+type brValidityLimit struct {
+	from   time.Time
+	months int
+	days   int
+	// inclusive limits count notAfter's second as part of the period, as
+	// the Baseline Requirements have since ballot SC31.
+	inclusive bool
+	rule      string
+}
+
+// brValidityLimits are the Baseline Requirements' limits, latest first, from
+// policydates.yaml.
+var brValidityLimits = policyDates.brValidityLimits
+
+// brValidityLimitAt returns the limit for certificates issued at notBefore,
+// or nil if none of brValidityLimits applied yet.
+func brValidityLimitAt(notBefore time.Time) *brValidityLimit {
+	for i := range brValidityLimits {
+		if !notBefore.Before(brValidityLimits[i].from) {
+			return &brValidityLimits[i]
+		}
+	}
+	return nil
+}
+
+// check returns cert's validity period and how far it exceeds the limit, if
+// it does.
+func (l *brValidityLimit) check(cert *x509.Certificate) (lifetime, overage time.Duration) {
+	end := cert.NotAfter
+	if l.inclusive {
+		end = end.Add(time.Second)
+	}
+	return end.Sub(cert.NotBefore), end.Sub(cert.NotBefore.AddDate(0, l.months, l.days))
+}
+
+func (l *brValidityLimit) String() string {
+	limit := fmt.Sprintf("%d day", l.days)
+	if l.months > 0 {
+		limit = fmt.Sprintf("%d month", l.months)
+	}
+	return fmt.Sprintf("%s limit for certificates issued from %s (%s)", limit, l.from.Format("2006-01-02"), l.rule)
+}
+
+// durationText formats d in whole days and the remainder.
+func durationText(d time.Duration) string {
+	days, rest := d/(24*time.Hour), d%(24*time.Hour)
+	var text string
+	switch {
+	case days == 1:
+		text = "1 day"
+	case days > 1:
+		text = fmt.Sprintf("%d days", days)
+	default:
+		return rest.String()
+	}
+	if rest > 0 {
+		text += " and " + rest.String()
+	}
+	return text
+}
+
+// isTLSServerCertificate is whether cert can authenticate TLS servers: its
+// extended key usage allows serverAuth, or it has none and names hosts.
+func isTLSServerCertificate(cert *x509.Certificate) bool {
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// A validityTime is a notBefore or notAfter as encoded in a certificate.
+type validityTime struct {
+	field string
+	raw   asn1.RawValue
+	time  time.Time
+}
+
+// validityTimes decodes the notBefore and notAfter of cert as they are
+// encoded, which crypto/x509 does not keep.
+func validityTimes(cert *x509.Certificate) ([]validityTime, error) {
+	var tbs tbsCertificateASN1
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, err
+	}
+	times := []validityTime{{field: "notBefore", raw: tbs.Validity.NotBefore}, {field: "notAfter", raw: tbs.Validity.NotAfter}}
+	for i := range times {
+		if _, err := parseValidityTime(times[i].raw, &times[i].time); err != nil {
+			return nil, err
+		}
+	}
+	return times, nil
+}
+
+// isTimeDigitsZ is whether value is digits decimal digits followed by Z.
+func isTimeDigitsZ(value []byte, digits int) bool {
+	if len(value) != digits+1 || value[digits] != 'Z' {
+		return false
+	}
+	for _, b := range value[:digits] {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// A Finding is the outcome of one lint on one certificate.
+type Finding struct {
+	Lint *Lint
+	// Path is the file the certificate was read from.
+	Path    string
+	Cert    *x509.Certificate
+	Passed  bool
+	Message string
+}
+
+// A ReportKind is what a Report holds, by the command that produces it.
+type ReportKind int
+
+const (
+	// LintReport holds Findings, from gx509 lint.
+	LintReport ReportKind = iota
+	// AnalysisReport holds Results, from gx509 itself.
+	AnalysisReport
+	// QueryReport holds Selected, from gx509 query.
+	QueryReport
+	// CAStatusReport holds CAs, from gx509 roots report.
+	CAStatusReport
+	// InventoryReport holds Inventory, from gx509 inventory.
+	InventoryReport
+)
+
+func (k ReportKind) String() string {
+	switch k {
+	case LintReport:
+		return "lint"
+	case AnalysisReport:
+		return "analysis"
+	case QueryReport:
+		return "query"
+	case CAStatusReport:
+		return "CA status"
+	case InventoryReport:
+		return "inventory"
+	}
+	return fmt.Sprintf("ReportKind(%d)", int(k))
+}
+
+// A Report holds what a gx509 command found, for a Renderer to write out.
+// Kind says which of its parts are filled in; a Renderer writes the kinds it
+// supports and returns an error for the others.
+type Report struct {
+	Kind      ReportKind
+	Generated time.Time
+	Findings  []Finding
+	// Results are constraint analyses, in the order they were reached.
+	Results []ConstraintResult
+	// Selected are the certificates a query selected. With StoredVerdicts
+	// they come from a result store, with their verdicts; otherwise from a
+	// warehouse, with none.
+	Selected       []*StoredResult
+	StoredVerdicts bool
+	CAs            *CAReport
+	Inventory      []InventoryItem
+}
+
+// LintCertificate runs every lint that applies to cert, read from path, as
+// of at and adds the findings to the report.
+func (r *Report) LintCertificate(path string, cert *x509.Certificate, at time.Time) {
+	for _, lint := range Lints {
+		if passed, message, ok := lint.run(cert, at); ok {
+			r.Findings = append(r.Findings, Finding{Lint: lint, Path: path, Cert: cert, Passed: passed, Message: message})
+		}
+	}
+}
+
+// Failures are the findings of failed lints.
+func (r *Report) Failures() []Finding {
+	var failures []Finding
+	for _, finding := range r.Findings {
+		if !finding.Passed {
+			failures = append(failures, finding)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,179 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testReport(t *testing.T) Report {
+	chain := testChain(t, "www.example.com")
+	report := Report{Generated: time.Date(2018, time.July, 1, 0, 0, 0, 0, time.UTC)}
+	report.LintCertificate("certs/leaf.pem", chain[0], report.Generated)
+	report.LintCertificate("certs/chain.pem", chain[1], report.Generated)
+	report.LintCertificate("certs/chain.pem", chain[2], report.Generated)
+	return report
+}
+
+func TestLintCertificate(t *testing.T) {
+	t.Parallel()
+
+	report := testReport(t)
+	var lints []string
+	for _, finding := range report.Findings {
+		lints = append(lints, finding.Lint.Name)
+	}
+	// Only the intermediate is checked for constraints, only the leaf for
+	// its validity period, and the root's signature is not checked at all
+	expected := []string{
+		"expired", "weak-key", "weak-signature", "validity-time-type", "validity-time-format", "duplicate-extensions", "br-validity-period",
+		"expired", "weak-key", "weak-signature", "technically-constrained", "validity-time-type", "validity-time-format", "duplicate-extensions",
+		"expired", "weak-key", "validity-time-type", "validity-time-format", "duplicate-extensions",
+	}
+	if !reflect.DeepEqual(lints, expected) {
+		t.Errorf("Expected lints %v, got %v", expected, lints)
+	}
+
+	var failed []string
+	for _, finding := range report.Failures() {
+		failed = append(failed, finding.Cert.Subject.CommonName+" "+finding.Lint.Name)
+	}
+	expected = []string{"www.example.com expired", "www.example.com weak-key", "Σ Acme Co Issuing CA weak-key",
+		"Σ Acme Co Issuing CA technically-constrained", "Σ Acme Co Root weak-key"}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("Expected failures %v, got %v", expected, failed)
+	}
+	if message := report.Failures()[0].Message; message != "Expired on 2018-06-01" {
+		t.Errorf("Unexpected message %q", message)
+	}
+}
+
+// withValidity returns cert with its validity encoded as notBefore and
+// notAfter, of the given tags.
+func withValidity(t *testing.T, cert *x509.Certificate, notBeforeTag int, notBefore string, notAfterTag int, notAfter string) *x509.Certificate {
+	var raw certificateASN1
+	if _, err := asn1.Unmarshal(cert.Raw, &raw); err != nil {
+		t.Fatalf("Could not decode certificate: %s", err)
+	}
+	raw.Raw, raw.TBSCertificate.Raw, raw.TBSCertificate.PublicKey.Raw = nil, nil, nil
+	raw.TBSCertificate.Validity.NotBefore = asn1.RawValue{Tag: notBeforeTag, Bytes: []byte(notBefore)}
+	raw.TBSCertificate.Validity.NotAfter = asn1.RawValue{Tag: notAfterTag, Bytes: []byte(notAfter)}
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		t.Fatalf("Could not encode certificate: %s", err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate with validity %s to %s: %s", notBefore, notAfter, err)
+	}
+	return parsed
+}
+
+func TestValidityTimeLints(t *testing.T) {
+	t.Parallel()
+
+	leaf := testChain(t, "www.example.com")[0]
+	at := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		cert          *x509.Certificate
+		typeMessage   string
+		formatMessage string
+	}{
+		{leaf, "", ""},
+		{
+			withValidity(t, leaf, asn1.TagUTCTime, "190101000000Z", asn1.TagGeneralizedTime, "20510101000000Z"),
+			"", "",
+		},
+		{
+			withValidity(t, leaf, asn1.TagGeneralizedTime, "20190101000000Z", asn1.TagUTCTime, "210101000000Z"),
+			"The notBefore 2019-01-01T00:00:00Z is a GeneralizedTime, not a UTCTime", "",
+		},
+		{
+			withValidity(t, leaf, asn1.TagUTCTime, "1901010000Z", asn1.TagUTCTime, "210101000000Z"),
+			"", `The notBefore "1901010000Z" lacks seconds or is not in Z`,
+		},
+		{
+			withValidity(t, leaf, asn1.TagUTCTime, "190101000000Z", asn1.TagGeneralizedTime, "20510101000000+0100"),
+			"", `The notAfter "20510101000000+0100" lacks seconds or is not in Z`,
+		},
+	} {
+		for _, lint := range Lints {
+			var want string
+			switch lint.Name {
+			case "validity-time-type":
+				want = test.typeMessage
+			case "validity-time-format":
+				want = test.formatMessage
+			default:
+				continue
+			}
+			passed, message, ok := lint.run(test.cert, at)
+			if !ok || passed != (want == "") || (!passed && message != want) {
+				t.Errorf("Expected %s on %s to give %q, got %t, %q", lint.Name, test.cert.NotBefore, want, passed, message)
+			}
+		}
+	}
+}
+
+func TestBRValidityPeriodLint(t *testing.T) {
+	t.Parallel()
+
+	var lint *Lint
+	for _, l := range Lints {
+		if l.Name == "br-validity-period" {
+			lint = l
+		}
+	}
+	issuer := testChain(t, "www.example.com")[1]
+	leaf := func(notBefore, notAfter time.Time, usage x509.ExtKeyUsage) *x509.Certificate {
+		return issueAndParse(t, &x509.Certificate{
+			SerialNumber: big.NewInt(notBefore.Unix()),
+			Subject:      pkix.Name{CommonName: "www.example.com"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"www.example.com"},
+		}, issuer)
+	}
+	serverAuth := x509.ExtKeyUsageServerAuth
+	nb2016 := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	nb2019 := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	nb2021 := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		cert    *x509.Certificate
+		ok      bool
+		passed  bool
+		message string
+	}{
+		{leaf(nb2016, nb2016.AddDate(0, 40, 0), serverAuth), true, false,
+			"Valid for 1216 days, 30 days over the 39 month limit for certificates issued from 2015-04-01 (Baseline Requirements 1.0)"},
+		{leaf(nb2019, nb2019.AddDate(0, 0, 825), serverAuth), true, true,
+			"Valid for 825 days, within the 825 day limit for certificates issued from 2018-03-01 (ballot 193)"},
+		{leaf(nb2019, nb2019.AddDate(0, 0, 826), serverAuth), true, false,
+			"Valid for 826 days, 1 day over the 825 day limit for certificates issued from 2018-03-01 (ballot 193)"},
+		// Since ballot SC31 the period includes the last second
+		{leaf(nb2021, nb2021.AddDate(0, 0, 398).Add(-time.Second), serverAuth), true, true,
+			"Valid for 398 days, within the 398 day limit for certificates issued from 2020-09-01 (ballot SC31)"},
+		{leaf(nb2021, nb2021.AddDate(0, 0, 398), serverAuth), true, false,
+			"Valid for 398 days, 1s over the 398 day limit for certificates issued from 2020-09-01 (ballot SC31)"},
+		// Before the first limit, and not for TLS servers
+		{leaf(time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC), nb2019, serverAuth), false, false, ""},
+		{leaf(nb2021, nb2021.AddDate(2, 0, 0), x509.ExtKeyUsageClientAuth), false, false, ""},
+		{issuer, false, false, ""},
+	} {
+		passed, message, ok := lint.run(test.cert, at)
+		if ok != test.ok || passed != test.passed || message != test.message {
+			t.Errorf("Expected %s to %s to give %t, %t, %q, got %t, %t, %q", test.cert.NotBefore, test.cert.NotAfter,
+				test.ok, test.passed, test.message, ok, passed, message)
+		}
+	}
+}
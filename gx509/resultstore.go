@@ -0,0 +1,180 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resultsTableSQL declares the table a ResultStore keeps its results in. The
+// times are RFC 3339, and reasons and sources are space-separated.
+const resultsTableSQL = `CREATE TABLE results (fingerprint TEXT, subject TEXT, issuer TEXT, ` +
+	`not_before TEXT, not_after TEXT, is_ca INTEGER, policy TEXT, constrained INTEGER, reasons TEXT, ` +
+	`first_seen TEXT, last_seen TEXT, sources TEXT, der BLOB)`
+
+// A StoredResult is the latest verdict on a certificate in a ResultStore,
+// with when and where it was seen.
+type StoredResult struct {
+	WarehouseEntry
+	// Policy is the policy the certificate was last judged by.
+	Policy      string
+	Constrained bool
+	Reasons     []string
+}
+
+// A ResultStore keeps the verdicts gx509 batch and ct-tail reach in an
+// SQLite database, one row per certificate, deduplicated by fingerprint, so
+// they can be queried with gx509 query or any SQLite client. Like a
+// Warehouse, it is read whole and held in memory, and Save rewrites the whole
+// file, streaming it to disk, and replaces it atomically.
+type ResultStore struct {
+	path    string
+	results map[[sha256.Size]byte]*StoredResult
+}
+
+// OpenResultStore reads the result store at path, which is empty if the
+// file does not exist yet.
+func OpenResultStore(path string) (*ResultStore, error) {
+	s := &ResultStore{path: path, results: make(map[[sha256.Size]byte]*StoredResult)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.table("results")
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		result, err := storedResultFromRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read result %d: %s", i+1, err)
+		}
+		s.results[result.Fingerprint()] = result
+	}
+	return s, nil
+}
+
+// storedResultFromRow decodes a row of the results table.
+func storedResultFromRow(row map[string]interface{}) (*StoredResult, error) {
+	entry, err := warehouseEntryFromRow(row)
+	if err != nil {
+		return nil, err
+	}
+	policy, _ := row["policy"].(string)
+	reasons, _ := row["reasons"].(string)
+	constrained, _ := row["constrained"].(int64)
+	result := &StoredResult{WarehouseEntry: *entry, Policy: policy, Constrained: constrained != 0, Reasons: strings.Fields(reasons)}
+	result.verdict = &result.Constrained
+	return result, nil
+}
+
+// Add records verdict, the analysis of cert, as seen at source at the time
+// at, and returns true if cert is new to the store. The latest verdict on a
+// certificate replaces earlier ones.
+func (s *ResultStore) Add(cert *x509.Certificate, verdict ConstraintResult, source string, at time.Time) bool {
+	fingerprint := sha256.Sum256(cert.Raw)
+	result, ok := s.results[fingerprint]
+	if !ok {
+		result = &StoredResult{WarehouseEntry: WarehouseEntry{Certificate: cert, Raw: cert.Raw, FirstSeen: at, LastSeen: at}}
+		result.verdict = &result.Constrained
+		s.results[fingerprint] = result
+	}
+	if at.Before(result.FirstSeen) {
+		result.FirstSeen = at
+	}
+	if !at.Before(result.LastSeen) {
+		result.LastSeen = at
+		result.Policy, result.Constrained, result.Reasons = verdict.Policy, verdict.Constrained, verdict.Reasons
+	}
+
+	i := sort.SearchStrings(result.Sources, source)
+	if len(source) > 0 && (i == len(result.Sources) || result.Sources[i] != source) {
+		result.Sources = append(result.Sources, "")
+		copy(result.Sources[i+1:], result.Sources[i:])
+		result.Sources[i] = source
+	}
+	return !ok
+}
+
+// Len is the number of certificates in the store.
+func (s *ResultStore) Len() int {
+	return len(s.results)
+}
+
+// Results returns the results in the store, in the order their certificates
+// were first seen.
+func (s *ResultStore) Results() []*StoredResult {
+	results := make([]*StoredResult, 0, len(s.results))
+	for _, result := range s.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].FirstSeen.Equal(results[j].FirstSeen) {
+			return results[i].FirstSeen.Before(results[j].FirstSeen)
+		}
+		a, b := results[i].Fingerprint(), results[j].Fingerprint()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return results
+}
+
+// Select returns the results that meet query, which judges constraints by
+// their stored verdicts, in the order of Results.
+func (s *ResultStore) Select(query *Query) []*StoredResult {
+	var selected []*StoredResult
+	for _, result := range s.Results() {
+		if query.Match(&result.WarehouseEntry) {
+			selected = append(selected, result)
+		}
+	}
+	return selected
+}
+
+// Save writes the store back to its file. The database is written page by
+// page as its rows are encoded, rather than built in memory first, and rows
+// too large for a page go on overflow pages.
+func (s *ResultStore) Save() error {
+	table := sqliteTable{name: "results", sql: resultsTableSQL, rows: func(emit func([]interface{}) error) error {
+		for _, result := range s.Results() {
+			cert := result.Certificate
+			err := emit([]interface{}{
+				fmt.Sprintf("%x", result.Fingerprint()),
+				cert.Subject.String(),
+				cert.Issuer.String(),
+				cert.NotBefore.UTC().Format(time.RFC3339),
+				cert.NotAfter.UTC().Format(time.RFC3339),
+				cert.IsCA,
+				result.Policy,
+				result.Constrained,
+				strings.Join(result.Reasons, " "),
+				result.FirstSeen.UTC().Format(time.RFC3339),
+				result.LastSeen.UTC().Format(time.RFC3339),
+				strings.Join(result.Sources, " "),
+				result.Raw,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+	return writeSQLiteFile(s.path, []sqliteTable{table})
+}
@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResultStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "results.db")
+	store, err := OpenResultStore(path)
+	if err != nil || store.Len() != 0 {
+		t.Fatalf("Expected an empty store for a new file, got %d and %v", store.Len(), err)
+	}
+
+	chain := testChain(t, "www.example.com")
+	first := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	later := first.Add(24 * time.Hour)
+	verdict := func(i int, policy Policy) ConstraintResult {
+		return NewConstraintResult("", chain[i], AnalyzeTechnicalConstraintsForPolicy(chain[i], policy))
+	}
+	if !store.Add(chain[1], verdict(1, MozillaPolicy22), "ct.example.com#7", first) || !store.Add(chain[0], verdict(0, DefaultPolicy), "leaves.txt", later) {
+		t.Errorf("Expected new certificates to be added")
+	}
+	// The later verdict wins, and the certificate is not stored twice
+	if store.Add(chain[1], verdict(1, DefaultPolicy), "leaves.txt", later) || store.Add(chain[1], verdict(1, MozillaPolicy22), "old.txt", first.Add(-time.Hour)) {
+		t.Errorf("Expected a certificate seen before not to be new")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Could not save store: %s", err)
+	}
+
+	reopened, err := OpenResultStore(path)
+	if err != nil {
+		t.Fatalf("Could not reopen store: %s", err)
+	}
+	results := reopened.Results()
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	intermediate := results[0]
+	if !intermediate.Certificate.Equal(chain[1]) || !intermediate.FirstSeen.Equal(first.Add(-time.Hour)) || !intermediate.LastSeen.Equal(later) {
+		t.Errorf("Unexpected intermediate result %+v", intermediate)
+	}
+	if intermediate.Policy != DefaultPolicy.Name || intermediate.Constrained || !reflect.DeepEqual(intermediate.Reasons, verdict(1, DefaultPolicy).Reasons) {
+		t.Errorf("Expected the latest verdict, got %s %t %v", intermediate.Policy, intermediate.Constrained, intermediate.Reasons)
+	}
+	if !reflect.DeepEqual(intermediate.Sources, []string{"ct.example.com#7", "leaves.txt", "old.txt"}) {
+		t.Errorf("Unexpected sources %v", intermediate.Sources)
+	}
+
+	// Queries judge constraints by the stored verdict
+	query, err := ParseQuery("is_ca = true AND constrained = false", later)
+	if err != nil {
+		t.Fatalf("Could not parse query: %s", err)
+	}
+	if selected := reopened.Select(query); len(selected) != 1 || !selected[0].Certificate.Equal(chain[1]) {
+		t.Errorf("Expected to select the intermediate, got %d results", len(selected))
+	}
+	reopened.Add(chain[1], verdict(1, MozillaPolicy22), "", later.Add(time.Hour))
+	if selected := reopened.Select(query); len(selected) != 0 {
+		t.Errorf("Expected the intermediate constrained under its new verdict")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenResultStore(path); err == nil {
+		t.Errorf("Expected an error opening a file that is not a database")
+	}
+}
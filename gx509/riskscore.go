@@ -0,0 +1,220 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+var oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// A RiskFactor is one of the findings that add to a certificate's risk
+// score.
+type RiskFactor struct {
+	// Name identifies the factor in risk models and reports, and never
+	// changes.
+	Name        string
+	Description string
+
+	// applies returns whether the factor applies to cert under model, with
+	// a message saying why.
+	applies func(cert *x509.Certificate, model *RiskModel) (bool, string)
+}
+
+// RiskFactors are the factors a RiskModel weighs, in order.
+var RiskFactors = []*RiskFactor{
+	{
+		Name:        "unconstrained-ca",
+		Description: "An intermediate CA that is not technically constrained, so it can issue for any name.",
+		applies: func(cert *x509.Certificate, model *RiskModel) (bool, string) {
+			if !cert.IsCA || isSelfSigned(cert) {
+				return false, ""
+			}
+			analysis := AnalyzeTechnicalConstraints(cert)
+			return !analysis.Constrained, analysis.Details()
+		},
+	},
+	{
+		Name:        "weak-key",
+		Description: "A public key small enough to factor or break.",
+		applies: func(cert *x509.Certificate, model *RiskModel) (bool, string) {
+			description, weak := DescribeKey(cert.PublicKey)
+			return weak, fmt.Sprintf("The %s key is too weak", description)
+		},
+	},
+	{
+		Name:        "weak-signature",
+		Description: "A signature over a hash that allows collisions, such as SHA-1.",
+		applies: func(cert *x509.Certificate, model *RiskModel) (bool, string) {
+			// The signature on a trust anchor is never checked
+			if isSelfSigned(cert) {
+				return false, ""
+			}
+			return weakSignatureAlgorithms[cert.SignatureAlgorithm], fmt.Sprintf("Signed with %s", cert.SignatureAlgorithm)
+		},
+	},
+	{
+		Name:        "long-validity",
+		Description: "A subscriber certificate valid for longer than the model allows.",
+		applies: func(cert *x509.Certificate, model *RiskModel) (bool, string) {
+			if cert.IsCA {
+				return false, ""
+			}
+			days := int(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)
+			return days > model.MaxValidityDays, fmt.Sprintf("Valid for %d days, more than %d", days, model.MaxValidityDays)
+		},
+	},
+	{
+		Name:        "no-ct",
+		Description: "A TLS server certificate without embedded Certificate Transparency SCTs.",
+		applies: func(cert *x509.Certificate, model *RiskModel) (bool, string) {
+			if cert.IsCA || (len(cert.ExtKeyUsage) > 0 && !hasExtKeyUsage(cert.ExtKeyUsage, x509.ExtKeyUsageServerAuth)) {
+				return false, ""
+			}
+			for _, ext := range cert.Extensions {
+				if ext.Id.Equal(oidExtensionSCTList) {
+					return false, ""
+				}
+			}
+			return true, "No embedded SCTs"
+		},
+	},
+}
+
+// A RiskModel weighs risk factors into a score from 0 to 100.
+type RiskModel struct {
+	// Weights are the points each factor, by name, adds to a score.
+	Weights map[string]int
+	// MaxValidityDays is the longest a subscriber certificate may be valid
+	// for without the long-validity factor applying.
+	MaxValidityDays int
+}
+
+// DefaultRiskModel weighs an unconstrained CA heaviest, as it puts every
+// name at risk, and holds subscriber certificates to the Baseline
+// Requirements' 398 days.
+var DefaultRiskModel = &RiskModel{
+	Weights: map[string]int{
+		"unconstrained-ca": 40,
+		"weak-key":         30,
+		"weak-signature":   25,
+		"long-validity":    10,
+		"no-ct":            15,
+	},
+	MaxValidityDays: 398,
+}
+
+type riskModelYAML struct {
+	Weights         map[string]int `yaml:"weights"`
+	MaxValidityDays int            `yaml:"maxValidityDays"`
+}
+
+// ParseRiskModel decodes a YAML risk model. Factors it does not weigh add
+// nothing, and maxValidityDays defaults to DefaultRiskModel's.
+func ParseRiskModel(data []byte) (*RiskModel, error) {
+	var raw riskModelYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	for name, weight := range raw.Weights {
+		if lookupRiskFactor(name) == nil {
+			return nil, fmt.Errorf("Risk model weighs unknown factor %s", name)
+		}
+		if weight < 0 || weight > 100 {
+			return nil, fmt.Errorf("Risk model weighs %s %d, outside 0 to 100", name, weight)
+		}
+	}
+	model := &RiskModel{Weights: raw.Weights, MaxValidityDays: raw.MaxValidityDays}
+	if model.MaxValidityDays == 0 {
+		model.MaxValidityDays = DefaultRiskModel.MaxValidityDays
+	}
+	return model, nil
+}
+
+func lookupRiskFactor(name string) *RiskFactor {
+	for _, factor := range RiskFactors {
+		if factor.Name == name {
+			return factor
+		}
+	}
+	return nil
+}
+
+// An AppliedRiskFactor is a factor that applies to a certificate.
+type AppliedRiskFactor struct {
+	Factor  *RiskFactor
+	Message string
+	Weight  int
+}
+
+// A RiskScore is a certificate's score and the factors that make it up.
+type RiskScore struct {
+	Cert    *x509.Certificate
+	Score   int
+	Factors []AppliedRiskFactor
+}
+
+// Score weighs the factors that apply to cert. Scores are capped at 100.
+func (m *RiskModel) Score(cert *x509.Certificate) RiskScore {
+	score := RiskScore{Cert: cert}
+	for _, factor := range RiskFactors {
+		if applies, message := factor.applies(cert, m); applies {
+			weight := m.Weights[factor.Name]
+			score.Factors = append(score.Factors, AppliedRiskFactor{Factor: factor, Message: message, Weight: weight})
+			score.Score += weight
+		}
+	}
+	if score.Score > 100 {
+		score.Score = 100
+	}
+	return score
+}
+
+// A HierarchyRisk scores a chain of certificates as a whole.
+type HierarchyRisk struct {
+	// Score counts each factor that applies anywhere in the hierarchy once,
+	// however many certificates it applies to, capped at 100.
+	Score        int
+	Certificates []RiskScore
+}
+
+// ScoreHierarchy scores each certificate in chain, and the chain as a
+// whole.
+func (m *RiskModel) ScoreHierarchy(chain []*x509.Certificate) HierarchyRisk {
+	var risk HierarchyRisk
+	counted := make(map[string]bool)
+	for _, cert := range chain {
+		score := m.Score(cert)
+		for _, applied := range score.Factors {
+			if !counted[applied.Factor.Name] {
+				counted[applied.Factor.Name] = true
+				risk.Score += applied.Weight
+			}
+		}
+		risk.Certificates = append(risk.Certificates, score)
+	}
+	if risk.Score > 100 {
+		risk.Score = 100
+	}
+	return risk
+}
+
+// RiskLevel buckets a score for summaries: "low" below 25, "medium" below
+// 50, "high" below 75 and "critical" from there.
+func RiskLevel(score int) string {
+	switch {
+	case score < 25:
+		return "low"
+	case score < 50:
+		return "medium"
+	case score < 75:
+		return "high"
+	}
+	return "critical"
+}
@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func factorNames(score RiskScore) []string {
+	var names []string
+	for _, applied := range score.Factors {
+		names = append(names, applied.Factor.Name)
+	}
+	return names
+}
+
+func TestScoreHierarchy(t *testing.T) {
+	t.Parallel()
+
+	// The test key is 512 bits, so every certificate has a weak key, and
+	// the issuing CA has no iPAddress constraints
+	chain := testChain(t, "www.example.com")
+	risk := DefaultRiskModel.ScoreHierarchy(chain)
+	for i, expected := range []struct {
+		score   int
+		factors []string
+	}{
+		{45, []string{"weak-key", "no-ct"}},
+		{70, []string{"unconstrained-ca", "weak-key"}},
+		{30, []string{"weak-key"}},
+	} {
+		score := risk.Certificates[i]
+		if score.Score != expected.score || !reflect.DeepEqual(factorNames(score), expected.factors) {
+			t.Errorf("Certificate %d: expected %d for %v, got %d for %v", i, expected.score, expected.factors, score.Score, factorNames(score))
+		}
+	}
+	if risk.Score != 85 || RiskLevel(risk.Score) != "critical" {
+		t.Errorf("Expected the hierarchy to score 85, got %d", risk.Score)
+	}
+
+	model, err := ParseRiskModel([]byte("weights:\n  long-validity: 20\n  no-ct: 5\nmaxValidityDays: 90\n"))
+	if err != nil {
+		t.Fatalf("Could not parse risk model: %s", err)
+	}
+	if score := model.Score(chain[0]); score.Score != 25 || !reflect.DeepEqual(factorNames(score), []string{"weak-key", "long-validity", "no-ct"}) {
+		t.Errorf("Expected the leaf to score 25 for its 92 days and no SCTs, got %d for %v", score.Score, factorNames(score))
+	}
+	if risk := model.ScoreHierarchy(chain); risk.Score != 25 || RiskLevel(risk.Score) != "medium" {
+		t.Errorf("Expected the hierarchy to score 25, got %d", risk.Score)
+	}
+
+	withSCTs := issueAndParse(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(4),
+		Subject:         pkix.Name{CommonName: "www.example.com"},
+		NotBefore:       time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:        time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC),
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions: []pkix.Extension{{Id: oidExtensionSCTList, Value: []byte{0x04, 0x00}}},
+	}, chain[1])
+	if score := model.Score(withSCTs); score.Score != 0 {
+		t.Errorf("Expected a short-lived certificate with SCTs to score 0, got %v", factorNames(score))
+	}
+}
+
+func TestParseRiskModel(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		"weights:\n  expired: 10\n",
+		"weights:\n  weak-key: 150\n",
+		"weight:\n  weak-key: 10\n",
+	} {
+		if _, err := ParseRiskModel([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+
+	model, err := ParseRiskModel([]byte("weights:\n  weak-key: 10\n"))
+	if err != nil || model.MaxValidityDays != DefaultRiskModel.MaxValidityDays {
+		t.Errorf("Expected the default maximum validity, got %+v (%v)", model, err)
+	}
+}
@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// A RootFilter selects the roots to include in a custom trust store.
+type RootFilter struct {
+	// Trust lists the purposes a root must be trusted for; zero matches any
+	// root.
+	Trust TrustBits
+	// ExcludeWeakKeys drops roots whose keys DescribeKey considers weak.
+	ExcludeWeakKeys bool
+	// Allowlist, if not empty, holds the SHA-256 fingerprints of the only
+	// roots to include.
+	Allowlist map[[sha256.Size]byte]bool
+}
+
+// ParseFingerprint decodes a hex SHA-256 fingerprint, which may be separated
+// by colons or spaces as most tools print them.
+func ParseFingerprint(s string) ([sha256.Size]byte, error) {
+	var fingerprint [sha256.Size]byte
+	cleaned := strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(s))
+	decoded, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return fingerprint, fmt.Errorf("Could not decode fingerprint %q: %s", s, err)
+	}
+	if len(decoded) != sha256.Size {
+		return fingerprint, fmt.Errorf("Fingerprint %q is not a SHA-256 hash", s)
+	}
+	copy(fingerprint[:], decoded)
+	return fingerprint, nil
+}
+
+// Include reports whether root passes the filter, and if not, why.
+func (f RootFilter) Include(root TrustedRoot) (bool, string) {
+	if root.Trust&f.Trust != f.Trust {
+		return false, fmt.Sprintf("not trusted for %s", f.Trust&^root.Trust)
+	}
+	if f.ExcludeWeakKeys {
+		if key, weak := DescribeKey(root.Cert.PublicKey); weak {
+			return false, fmt.Sprintf("weak %s key", key)
+		}
+	}
+	if len(f.Allowlist) > 0 && !f.Allowlist[sha256.Sum256(root.Cert.Raw)] {
+		return false, "not in the allowlist"
+	}
+	return true, ""
+}
+
+// FilterRoots returns the roots that pass the filter, in order.
+func FilterRoots(roots []TrustedRoot, f RootFilter) []TrustedRoot {
+	var included []TrustedRoot
+	for _, root := range roots {
+		if ok, _ := f.Include(root); ok {
+			included = append(included, root)
+		}
+	}
+	return included
+}
@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterRoots(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().AddDate(10, 0, 0)
+	web := TrustedRoot{Label: "Web", Cert: testCA(t, "Web", nil, notAfter), Trust: TrustServerAuth}
+	mail := TrustedRoot{Label: "Mail", Cert: testCA(t, "Mail", nil, notAfter), Trust: TrustEmailProtection}
+	roots := []TrustedRoot{web, mail}
+
+	if included := FilterRoots(roots, RootFilter{}); len(included) != 2 {
+		t.Errorf("Expected an empty filter to include everything, got %d", len(included))
+	}
+
+	included := FilterRoots(roots, RootFilter{Trust: TrustServerAuth})
+	if len(included) != 1 || included[0].Label != "Web" {
+		t.Errorf("Expected only the web root, got %v", included)
+	}
+	if ok, reason := (RootFilter{Trust: TrustServerAuth}).Include(mail); ok || reason != "not trusted for serverAuth" {
+		t.Errorf("Unexpected reason: %s", reason)
+	}
+
+	// The test key is too small to pass
+	if ok, reason := (RootFilter{ExcludeWeakKeys: true}).Include(web); ok || reason != "weak RSA 512 key" {
+		t.Errorf("Expected a weak key exclusion, got %v %s", ok, reason)
+	}
+
+	allowlist := map[[sha256.Size]byte]bool{sha256.Sum256(mail.Cert.Raw): true}
+	included = FilterRoots(roots, RootFilter{Allowlist: allowlist})
+	if len(included) != 1 || included[0].Label != "Mail" {
+		t.Errorf("Expected only the allowlisted root, got %v", included)
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	t.Parallel()
+
+	hash := sha256.Sum256([]byte("root"))
+	plain := fmt.Sprintf("%x", hash)
+
+	var pairs []string
+	for i := 0; i < len(plain); i += 2 {
+		pairs = append(pairs, strings.ToUpper(plain[i:i+2]))
+	}
+
+	for _, input := range []string{plain, strings.Join(pairs, ":"), " " + strings.Join(pairs, " ") + " "} {
+		fingerprint, err := ParseFingerprint(input)
+		if err != nil {
+			t.Errorf("Could not parse %q: %s", input, err)
+		} else if fingerprint != hash {
+			t.Errorf("Parsed %q incorrectly", input)
+		}
+	}
+
+	if _, err := ParseFingerprint("abcd"); err == nil {
+		t.Errorf("Expected an error for a short fingerprint")
+	}
+	if _, err := ParseFingerprint("zz"); err == nil {
+		t.Errorf("Expected an error for invalid hex")
+	}
+}
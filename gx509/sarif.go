@@ -0,0 +1,136 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+func init() {
+	RegisterRenderer("sarif", func(w io.Writer) Renderer { return sarifRenderer{w} })
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifLevel is the SARIF level for failures of lints of severity s.
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+// sarifRenderer writes a SARIF 2.1.0 log with a rule for each lint and a
+// result for each failure, located in the file the certificate was read
+// from.
+type sarifRenderer struct {
+	w io.Writer
+}
+
+func (r sarifRenderer) Render(report Report) error {
+	if report.Kind != LintReport {
+		return errUnsupportedReport("sarif", report.Kind)
+	}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gx509",
+			InformationURI: "https://github.com/jcjones/gx509",
+		}},
+		Results: []sarifResult{},
+	}
+	ruleIndex := make(map[*Lint]int)
+	for i, lint := range Lints {
+		ruleIndex[lint] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   lint.Name,
+			ShortDescription:     sarifMessage{lint.Description},
+			DefaultConfiguration: sarifConfiguration{sarifLevel(lint.Severity)},
+		})
+	}
+
+	for _, finding := range report.Failures() {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    finding.Lint.Name,
+			RuleIndex: ruleIndex[finding.Lint],
+			Level:     sarifLevel(finding.Lint.Severity),
+			Message:   sarifMessage{fmt.Sprintf("%s: %s", finding.Cert.Subject.CommonName, finding.Message)},
+			Locations: []sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{filepath.ToSlash(finding.Path)}}}},
+			// Code scanning matches results across runs by fingerprint, so
+			// a certificate keeps its alerts if the file moves
+			PartialFingerprints: map[string]string{
+				"certificateSha256/v1": fmt.Sprintf("%X", sha256.Sum256(finding.Cert.Raw)),
+			},
+		})
+	}
+
+	encoder := json.NewEncoder(r.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
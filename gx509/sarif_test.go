@@ -0,0 +1,45 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSARIFRenderer(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	renderer, _ := NewRenderer("sarif", &out)
+	if err := renderer.Render(testReport(t)); err != nil {
+		t.Fatalf("Could not render: %s", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Could not parse SARIF: %s\n%s", err, out.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF version %s with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(Lints) || len(run.Results) != 5 {
+		t.Fatalf("Expected %d rules and 5 results, got %d and %d", len(Lints), len(run.Tool.Driver.Rules), len(run.Results))
+	}
+
+	first := run.Results[0]
+	if first.RuleID != "expired" || first.Level != "error" || first.Message.Text != "www.example.com: Expired on 2018-06-01" {
+		t.Errorf("Unexpected first result %+v", first)
+	}
+	if first.Locations[0].PhysicalLocation.ArtifactLocation.URI != "certs/leaf.pem" || len(first.PartialFingerprints["certificateSha256/v1"]) != 64 {
+		t.Errorf("Unexpected location or fingerprints for %+v", first)
+	}
+	constrained := run.Results[3]
+	if constrained.Level != "warning" || run.Tool.Driver.Rules[constrained.RuleIndex].ID != "technically-constrained" {
+		t.Errorf("Unexpected constraint result %+v", constrained)
+	}
+}
@@ -0,0 +1,230 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Schedule is when a recurring job runs: a cron specification of minute,
+// hour, day of month, month and day of week, or a fixed interval.
+type Schedule struct {
+	Spec string
+
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday are whether those fields were "*". As in cron,
+	// a time matches if either restricted field matches.
+	anyDay, anyWeekday bool
+	every              time.Duration
+}
+
+// scheduleDescriptors are the cron shorthands ParseSchedule accepts.
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseScheduleField returns the bits set by field, a comma-separated list
+// of "*", values and ranges, each with an optional "/step", between min and
+// max.
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("Invalid step in %s", part)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("Invalid value %s", bounds[0])
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("Invalid value %s", bounds[1])
+				}
+			} else if step > 1 {
+				high = max
+			}
+			if low < min || high > max || low > high {
+				return 0, fmt.Errorf("%s is outside %d-%d", part, min, max)
+			}
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// ParseSchedule decodes spec, which is five cron fields, a descriptor such as
+// "@daily", or "@every" and a duration such as "@every 15m".
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{Spec: spec}
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %s: %s", spec, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("Invalid schedule %s: the interval must be at least a second", spec)
+		}
+		s.every = every
+		return s, nil
+	}
+	if expanded, ok := scheduleDescriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid schedule %s: expected 5 fields, got %d", s.Spec, len(fields))
+	}
+	var err error
+	for i, target := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.days, 1, 31},
+		{&s.months, 1, 12},
+		{&s.weekdays, 0, 7},
+	} {
+		if *target.bits, err = parseScheduleField(fields[i], target.min, target.max); err != nil {
+			return nil, fmt.Errorf("Invalid schedule %s: %s", s.Spec, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	s.anyDay, s.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// Next returns the first time after after that the schedule falls due, in
+// after's location, or the zero time if it never does.
+func (s *Schedule) Next(after time.Time) time.Time {
+	if s.every > 0 {
+		return after.Add(s.every)
+	}
+
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, loc).Add(time.Minute)
+	// Every schedule that can fall due does so within a leap cycle
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// A ScheduledJob is work to run whenever its schedule falls due.
+type ScheduledJob struct {
+	Name     string
+	Schedule *Schedule
+	Run      func(at time.Time)
+}
+
+// RunScheduler runs each job, in a goroutine of its own, whenever its
+// schedule falls due, until stop is closed, and then waits for the jobs
+// still running. A job still running when it falls due again is not started
+// a second time; it next runs when it falls due after finishing.
+func RunScheduler(jobs []ScheduledJob, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	now := time.Now()
+	next := make([]time.Time, len(jobs))
+	running := make([]chan struct{}, len(jobs))
+	for i, job := range jobs {
+		next[i] = job.Schedule.Next(now)
+	}
+	for {
+		var soonest time.Time
+		for _, at := range next {
+			if !at.IsZero() && (soonest.IsZero() || at.Before(soonest)) {
+				soonest = at
+			}
+		}
+		if soonest.IsZero() {
+			<-stop
+			return
+		}
+
+		timer := time.NewTimer(time.Until(soonest))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now = time.Now()
+		for i, job := range jobs {
+			if next[i].IsZero() || next[i].After(now) {
+				continue
+			}
+			at := next[i]
+			next[i] = job.Schedule.Next(now)
+			if running[i] != nil {
+				select {
+				case <-running[i]:
+				default:
+					continue
+				}
+			}
+			done := make(chan struct{})
+			running[i] = done
+			wg.Add(1)
+			go func(job ScheduledJob) {
+				defer wg.Done()
+				defer close(done)
+				job.Run(at)
+			}(job)
+		}
+	}
+}
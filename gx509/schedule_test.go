@@ -0,0 +1,86 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	// A Wednesday
+	from := time.Date(2020, time.January, 1, 10, 7, 30, 0, time.UTC)
+	for _, test := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.January, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.January, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2020, time.January, 1, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2020, time.January, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1,5", time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week
+		{"0 0 15 * 5", time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2020, time.January, 1, 11, 37, 30, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("Could not parse %q: %s", test.spec, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(test.expected) {
+			t.Errorf("Expected %q to fall due at %s, got %s", test.spec, test.expected, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 5-1 * * *", "*/0 * * * *", "@every 1ms", "@fortnightly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected an error parsing %q", spec)
+		}
+	}
+}
+
+func TestRunScheduler(t *testing.T) {
+	t.Parallel()
+
+	schedule, err := ParseSchedule("@every 1s")
+	if err != nil {
+		t.Fatalf("Could not parse schedule: %s", err)
+	}
+	var runs int32
+	stop := make(chan struct{})
+	release := make(chan struct{})
+	jobs := []ScheduledJob{{Name: "slow", Schedule: schedule, Run: func(at time.Time) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+	}}}
+	done := make(chan struct{})
+	go func() {
+		RunScheduler(jobs, stop)
+		close(done)
+	}()
+
+	// The job falls due again while still running, and is not started twice
+	time.Sleep(2500 * time.Millisecond)
+	close(stop)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("Expected the job to run once, got %d", n)
+	}
+	select {
+	case <-done:
+		t.Errorf("Expected the scheduler to wait for the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+}
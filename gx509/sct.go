@@ -0,0 +1,267 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// tlsVector splits a vector with a two-byte length, as in RFC 6962, off b.
+func tlsVector(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 || len(b)-2 < int(binary.BigEndian.Uint16(b)) {
+		return nil, nil, fmt.Errorf("Truncated vector")
+	}
+	length := 2 + int(binary.BigEndian.Uint16(b))
+	return b[2:length], b[length:], nil
+}
+
+// An SCT is a signed certificate timestamp, a log's promise to include a
+// certificate, as RFC 6962 defines it.
+type SCT struct {
+	Version   uint8
+	LogID     [sha256.Size]byte
+	Timestamp time.Time
+	// Extensions are the raw CtExtensions, empty in RFC 6962.
+	Extensions []byte
+	// HashAlgorithm and SignatureAlgorithm are the TLS HashAlgorithm and
+	// SignatureAlgorithm of the signature.
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// ParseSCTList decodes the SignedCertificateTimestampList in the value of
+// an SCT list extension.
+func ParseSCTList(value []byte) ([]SCT, error) {
+	var list []byte
+	if err := unmarshalAll(value, &list); err != nil {
+		return nil, err
+	}
+	rest, trailing, err := tlsVector(list)
+	if err != nil {
+		return nil, err
+	} else if len(trailing) > 0 {
+		return nil, fmt.Errorf("Trailing data after SCT list")
+	}
+
+	var scts []SCT
+	for len(rest) > 0 {
+		var raw []byte
+		if raw, rest, err = tlsVector(rest); err != nil {
+			return nil, err
+		}
+		if len(raw) < 1+sha256.Size+8 {
+			return nil, fmt.Errorf("Truncated SCT")
+		}
+		sct := SCT{Version: raw[0]}
+		copy(sct.LogID[:], raw[1:33])
+		sct.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(raw[33:41]))*int64(time.Millisecond)).UTC()
+		var remainder []byte
+		if sct.Extensions, remainder, err = tlsVector(raw[41:]); err != nil {
+			return nil, err
+		} else if len(remainder) < 2 {
+			return nil, fmt.Errorf("Truncated SCT")
+		}
+		sct.HashAlgorithm, sct.SignatureAlgorithm = remainder[0], remainder[1]
+		if sct.Signature, remainder, err = tlsVector(remainder[2:]); err != nil {
+			return nil, err
+		} else if len(remainder) > 0 {
+			return nil, fmt.Errorf("Trailing data after SCT")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// CertificateSCTs returns the SCTs embedded in cert, or none if it has no
+// SCT list extension.
+func CertificateSCTs(cert *x509.Certificate) ([]SCT, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionSCTList) {
+			scts, err := ParseSCTList(ext.Value)
+			if err != nil {
+				return nil, fmt.Errorf("Could not decode SCT list: %s", err)
+			}
+			return scts, nil
+		}
+	}
+	return nil, nil
+}
+
+// A CTLog is a Certificate Transparency log, as listed in a log list.
+type CTLog struct {
+	Description string
+	Operator    string
+	URL         string
+	ID          [sha256.Size]byte
+	Key         crypto.PublicKey
+}
+
+// CTLogs are the logs a verifier knows, by ID.
+type CTLogs map[[sha256.Size]byte]*CTLog
+
+// The CT log list shipped with this package, for verifying SCTs without
+// network access. It is a snapshot of
+// https://www.gstatic.com/ct/log_list/v3/all_logs_list.json, replaced with
+// the published list before each release.
+//
+//go:embed ctlogs.json
+var embeddedCTLogList []byte
+
+// A CTLogList is a log list with the version and time it was published.
+type CTLogList struct {
+	Version   string
+	Timestamp time.Time
+	Logs      CTLogs
+}
+
+// DefaultCTLogList is the log list embedded in this package.
+var DefaultCTLogList = mustParseCTLogList(embeddedCTLogList)
+
+func mustParseCTLogList(data []byte) *CTLogList {
+	list, err := ParseCTLogListVersion(data)
+	if err != nil {
+		panic("Failed to parse embedded CT log list: " + err.Error())
+	}
+	return list
+}
+
+// ParseCTLogList reads a log list in the JSON format Chrome and Apple
+// publish (version 3), such as
+// https://www.gstatic.com/ct/log_list/v3/all_logs_list.json.
+func ParseCTLogList(data []byte) (CTLogs, error) {
+	list, err := ParseCTLogListVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	return list.Logs, nil
+}
+
+// ParseCTLogListVersion reads a log list as ParseCTLogList does, along with
+// its version and log_list_timestamp, which are empty if it has none.
+func ParseCTLogListVersion(data []byte) (*CTLogList, error) {
+	var list struct {
+		Version   string    `json:"version"`
+		Timestamp time.Time `json:"log_list_timestamp"`
+		Operators []struct {
+			Name string `json:"name"`
+			Logs []struct {
+				Description string `json:"description"`
+				Key         string `json:"key"`
+				URL         string `json:"url"`
+			} `json:"logs"`
+		} `json:"operators"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("Could not decode log list: %s", err)
+	}
+	logs := make(CTLogs)
+	for _, operator := range list.Operators {
+		for _, entry := range operator.Logs {
+			der, err := base64.StdEncoding.DecodeString(entry.Key)
+			if err != nil {
+				return nil, fmt.Errorf("Could not decode key of %s: %s", entry.Description, err)
+			}
+			key, err := x509.ParsePKIXPublicKey(der)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse key of %s: %s", entry.Description, err)
+			}
+			log := &CTLog{Description: entry.Description, Operator: operator.Name, URL: entry.URL, ID: sha256.Sum256(der), Key: key}
+			logs[log.ID] = log
+		}
+	}
+	return &CTLogList{Version: list.Version, Timestamp: list.Timestamp, Logs: logs}, nil
+}
+
+// VerifySCT checks that log signed sct for cert, a certificate issued by
+// issuer with the SCT embedded, as RFC 6962 section 3.2 describes.
+func VerifySCT(sct SCT, cert, issuer *x509.Certificate, log *CTLog) error {
+	if sct.Version != 0 {
+		return fmt.Errorf("Unsupported SCT version %d", sct.Version)
+	}
+	if sct.LogID != log.ID {
+		return fmt.Errorf("SCT is from another log")
+	}
+	tbs, err := ComparableTBS(cert)
+	if err != nil {
+		return fmt.Errorf("Could not rebuild precertificate: %s", err)
+	}
+
+	var signed bytes.Buffer
+	signed.Write([]byte{0, 0}) // v1, certificate_timestamp
+	binary.Write(&signed, binary.BigEndian, uint64(sct.Timestamp.UnixNano()/int64(time.Millisecond)))
+	signed.Write([]byte{0, 1}) // precert_entry
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	signed.Write(issuerKeyHash[:])
+	signed.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	signed.Write(tbs)
+	binary.Write(&signed, binary.BigEndian, uint16(len(sct.Extensions)))
+	signed.Write(sct.Extensions)
+
+	if sct.HashAlgorithm != 4 {
+		return fmt.Errorf("Unsupported hash algorithm %d", sct.HashAlgorithm)
+	}
+	digest := sha256.Sum256(signed.Bytes())
+	switch key := log.Key.(type) {
+	case *ecdsa.PublicKey:
+		var signature struct{ R, S *big.Int }
+		if err := unmarshalAll(sct.Signature, &signature); err != nil {
+			return fmt.Errorf("Could not decode signature: %s", err)
+		}
+		if sct.SignatureAlgorithm != 3 || !ecdsa.Verify(key, digest[:], signature.R, signature.S) {
+			return fmt.Errorf("Invalid signature")
+		}
+	case *rsa.PublicKey:
+		if sct.SignatureAlgorithm != 1 || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sct.Signature) != nil {
+			return fmt.Errorf("Invalid signature")
+		}
+	default:
+		return fmt.Errorf("Unsupported log key %T", log.Key)
+	}
+	return nil
+}
+
+// An SCTResult is an embedded SCT and what verifying it found.
+type SCTResult struct {
+	SCT SCT
+	// Log is nil if the SCT is from a log the verifier does not know.
+	Log *CTLog
+	// Err is why the SCT could not be verified, or nil if it was.
+	Err error
+}
+
+// VerifyCertificateSCTs verifies each SCT embedded in cert against the log
+// it names in logs. Without issuer, or the log, an SCT cannot be verified.
+func VerifyCertificateSCTs(cert, issuer *x509.Certificate, logs CTLogs) ([]SCTResult, error) {
+	scts, err := CertificateSCTs(cert)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SCTResult, len(scts))
+	for i, sct := range scts {
+		results[i] = SCTResult{SCT: sct, Log: logs[sct.LogID]}
+		switch {
+		case results[i].Log == nil:
+			results[i].Err = fmt.Errorf("Unknown log %s", base64.StdEncoding.EncodeToString(sct.LogID[:]))
+		case issuer == nil:
+			results[i].Err = fmt.Errorf("No issuer to verify against")
+		default:
+			results[i].Err = VerifySCT(sct, cert, issuer, results[i].Log)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// tlsVectorOf prefixes b with its length, in length bytes.
+func tlsVectorOf(b []byte, length int) []byte {
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, uint64(len(b)))
+	return append(prefix[8-length:], b...)
+}
+
+// embedSCT issues template under issuer twice, as a precertificate would be
+// and then with an SCT for it from logKey embedded.
+func embedSCT(t *testing.T, template, issuer *x509.Certificate, logKey *ecdsa.PrivateKey, at time.Time) *x509.Certificate {
+	precert := issueAndParse(t, template, issuer)
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, uint64(at.UnixNano()/int64(time.Millisecond)))
+
+	var signed bytes.Buffer
+	signed.Write([]byte{0, 0})
+	signed.Write(timestamp)
+	signed.Write([]byte{0, 1})
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	signed.Write(issuerKeyHash[:])
+	signed.Write(tlsVectorOf(precert.RawTBSCertificate, 3))
+	signed.Write([]byte{0, 0})
+	digest := sha256.Sum256(signed.Bytes())
+	r, s, err := ecdsa.Sign(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatalf("Could not sign SCT: %s", err)
+	}
+	signature, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+
+	logKeyDER, _ := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	logID := sha256.Sum256(logKeyDER)
+	sct := append([]byte{0}, logID[:]...)
+	sct = append(sct, timestamp...)
+	sct = append(sct, 0, 0, 4, 3)
+	sct = append(sct, tlsVectorOf(signature, 2)...)
+	value, _ := asn1.Marshal(tlsVectorOf(tlsVectorOf(sct, 2), 2))
+
+	withSCT := *template
+	withSCT.ExtraExtensions = append(withSCT.ExtraExtensions, pkix.Extension{Id: oidExtensionSCTList, Value: value})
+	return issueAndParse(t, &withSCT, issuer)
+}
+
+func TestVerifyCertificateSCTs(t *testing.T) {
+	t.Parallel()
+
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate log key: %s", err)
+	}
+	logKeyDER, _ := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	logs, err := ParseCTLogList([]byte(fmt.Sprintf(`{"operators": [{"name": "Example", "logs": [
+		{"description": "Example Log", "key": %q, "url": "https://ct.example.com/"}
+	]}]}`, base64.StdEncoding.EncodeToString(logKeyDER))))
+	if err != nil {
+		t.Fatalf("Could not parse log list: %s", err)
+	}
+
+	chain := testChain(t, "www.example.com")
+	at := time.Date(2018, time.March, 1, 12, 0, 0, 0, time.UTC)
+	cert := embedSCT(t, &x509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    at,
+		NotAfter:     at.AddDate(0, 3, 0),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, chain[1], logKey, at)
+
+	results, err := VerifyCertificateSCTs(cert, chain[1], logs)
+	if err != nil {
+		t.Fatalf("Could not verify SCTs: %s", err)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].Log == nil || results[0].Log.Description != "Example Log" {
+		t.Fatalf("Expected one verified SCT from Example Log, got %+v", results)
+	}
+	if !results[0].SCT.Timestamp.Equal(at) {
+		t.Errorf("Expected the SCT to be from %s, got %s", at, results[0].SCT.Timestamp)
+	}
+
+	// The issuer's key is part of what the log signed
+	if results, _ := VerifyCertificateSCTs(cert, &x509.Certificate{RawSubjectPublicKeyInfo: logKeyDER}, logs); results[0].Err == nil {
+		t.Errorf("Expected the SCT not to verify against another issuer")
+	}
+	list, err := ParseCTLogListVersion([]byte(`{"version": "41.7", "log_list_timestamp": "2026-10-01T12:00:00Z", "operators": []}`))
+	if err != nil || list.Version != "41.7" || !list.Timestamp.Equal(time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)) || len(list.Logs) != 0 {
+		t.Errorf("Unexpected log list %+v, %v", list, err)
+	}
+	if DefaultCTLogList == nil || len(DefaultCTLogList.Version) == 0 {
+		t.Errorf("Expected the embedded log list to have a version")
+	}
+
+	if results, _ := VerifyCertificateSCTs(cert, chain[1], CTLogs{}); results[0].Err == nil || results[0].Log != nil {
+		t.Errorf("Expected an SCT from an unknown log not to verify")
+	}
+	if scts, err := CertificateSCTs(chain[0]); err != nil || len(scts) != 0 {
+		t.Errorf("Expected no SCTs in the test leaf, got %v (%v)", scts, err)
+	}
+}
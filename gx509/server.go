@@ -0,0 +1,202 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultMaxRequestBody is the largest upload an AnalysisServer accepts
+// unless told otherwise; a chain in PEM is a few kilobytes.
+const defaultMaxRequestBody = 1 << 20
+
+// A public AnalysisServer accepts a chain's worth of PEM, and a chain's worth
+// of certificates, per request.
+const (
+	publicMaxRequestBody  = 64 << 10
+	publicMaxCertificates = 10
+)
+
+// A LintResult is the outcome of one lint, as the analysis service returns
+// it.
+type LintResult struct {
+	Lint     string `json:"lint"`
+	Severity string `json:"severity"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message"`
+}
+
+// An AnalyzedCertificate is a certificate's constraint analysis and lint
+// findings, as the analysis service returns them.
+type AnalyzedCertificate struct {
+	ConstraintResult
+	Findings []LintResult `json:"findings"`
+}
+
+// An AnalysisResponse is the analysis service's answer to a request.
+type AnalysisResponse struct {
+	Tenant       string                `json:"tenant"`
+	Certificates []AnalyzedCertificate `json:"certificates"`
+}
+
+// Verdicts returns the verdicts of the response, for a VerdictLog.
+func (r AnalysisResponse) Verdicts() []Verdict {
+	verdicts := []Verdict{}
+	for _, cert := range r.Certificates {
+		verdict := Verdict{Fingerprint: cert.Fingerprint, Subject: cert.SubjectCN, Policy: cert.Policy, Constrained: cert.Constrained}
+		for _, finding := range cert.Findings {
+			if !finding.Passed {
+				verdict.FailedLints = append(verdict.FailedLints, finding.Lint)
+			}
+		}
+		verdicts = append(verdicts, verdict)
+	}
+	return verdicts
+}
+
+// An AnalysisServer is an HTTP service that analyzes and lints the
+// certificates POSTed to /v1/analyze as PEM, DER or PKCS#7, under the rules
+// of the caller's tenant.
+type AnalysisServer struct {
+	// Tenants identifies callers by the API key in their Authorization
+	// header, "Bearer <key>". Without tenants every caller is served as
+	// DefaultTenant.
+	Tenants *TenantConfig
+	// MaxRequestBody is the largest upload accepted, or
+	// defaultMaxRequestBody if zero.
+	MaxRequestBody int64
+	// MaxCertificates is the most certificates analyzed per request, or
+	// unlimited if zero.
+	MaxCertificates int
+	// RateLimiter, if set, limits the analysis requests of each client IPv4
+	// address or IPv6 /64.
+	RateLimiter *IPRateLimiter
+	// VerdictLog, if set, records every analysis before it is returned; a
+	// request whose verdicts cannot be recorded fails.
+	VerdictLog *VerdictLog
+}
+
+// NewPublicAnalysisServer returns an AnalysisServer hardened for a public
+// "check your intermediate" endpoint: anyone is served as DefaultTenant, but
+// requests are capped at 64 KiB and 10 certificates, and each IPv4 address or
+// IPv6 /64 may make perMinute requests a minute in bursts of up to burst. The
+// analysis never fetches anything, so callers cannot make the server connect
+// out.
+func NewPublicAnalysisServer(perMinute, burst int) *AnalysisServer {
+	return &AnalysisServer{
+		MaxRequestBody:  publicMaxRequestBody,
+		MaxCertificates: publicMaxCertificates,
+		RateLimiter:     NewIPRateLimiter(perMinute, burst),
+	}
+}
+
+// writeError writes a JSON error with status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// tenant returns the tenant r is made for, or nil if it is not authorized.
+func (s *AnalysisServer) tenant(r *http.Request) *Tenant {
+	if s.Tenants == nil {
+		return DefaultTenant
+	}
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil
+	}
+	return s.Tenants.Authenticate(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+func (s *AnalysisServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		fmt.Fprintf(w, "ok\n")
+		return
+	case "/v1/analyze":
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Certificates must be POSTed")
+		return
+	}
+	if s.RateLimiter != nil {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if ok, wait := s.RateLimiter.Allow(ip, time.Now()); !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+	}
+	tenant := s.tenant(r)
+	if tenant == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gx509"`)
+		writeError(w, http.StatusUnauthorized, "A valid API key is required")
+		return
+	}
+
+	limit := s.MaxRequestBody
+	if limit == 0 {
+		limit = defaultMaxRequestBody
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Could not read request: %s", err))
+		return
+	}
+	if int64(len(body)) > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Requests may be at most %d bytes", limit))
+		return
+	}
+	certs, err := ParseCertificatesFromBytes(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Could not parse certificates: %s", err))
+		return
+	}
+	if len(certs) == 0 {
+		writeError(w, http.StatusBadRequest, "No certificates found")
+		return
+	}
+	if s.MaxCertificates > 0 && len(certs) > s.MaxCertificates {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Requests may hold at most %d certificates", s.MaxCertificates))
+		return
+	}
+
+	at := time.Now()
+	response := tenant.Analyze(certs, at)
+	if s.VerdictLog != nil {
+		err := s.VerdictLog.Write(VerdictRecord{
+			Time:       at.UTC(),
+			Caller:     tenant.Name,
+			Address:    r.RemoteAddr,
+			InputHash:  fmt.Sprintf("%x", sha256.Sum256(body)),
+			PolicyHash: tenant.ConfigHash(),
+			Verdicts:   response.Verdicts(),
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Could not record the verdicts")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,117 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalysisServer(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParseTenantConfig([]byte("tenants:\n  - {name: web-pki, keys: [" + HashAPIKey("web-1") + "], policy: cabr-baseline}\n"))
+	if err != nil {
+		t.Fatalf("Could not parse tenant configuration: %s", err)
+	}
+	chain := testChain(t, "www.example.com")
+	var body []byte
+	for _, cert := range chain[:2] {
+		body = append(body, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	post := func(server *AnalysisServer, method, path, key string, body []byte) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if key != "" {
+			request.Header.Set("Authorization", "Bearer "+key)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	server := &AnalysisServer{Tenants: config, MaxRequestBody: 64 << 10}
+	recorder := post(server, "POST", "/v1/analyze", "web-1", body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var response AnalysisResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Could not decode response: %s", err)
+	}
+	if response.Tenant != "web-pki" || len(response.Certificates) != 2 || response.Certificates[1].Policy != "cabr-baseline" ||
+		response.Certificates[0].SubjectCN != "www.example.com" || len(response.Certificates[0].Findings) == 0 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	for _, test := range []struct {
+		method, path, key string
+		body              []byte
+		status            int
+	}{
+		{"POST", "/v1/analyze", "", body, http.StatusUnauthorized},
+		{"POST", "/v1/analyze", "web-2", body, http.StatusUnauthorized},
+		{"GET", "/v1/analyze", "web-1", nil, http.StatusMethodNotAllowed},
+		{"POST", "/v1/other", "web-1", body, http.StatusNotFound},
+		{"POST", "/v1/analyze", "web-1", []byte("not a certificate"), http.StatusBadRequest},
+		{"POST", "/v1/analyze", "web-1", make([]byte, 65<<10), http.StatusRequestEntityTooLarge},
+		{"GET", "/healthz", "", nil, http.StatusOK},
+	} {
+		if recorder := post(server, test.method, test.path, test.key, test.body); recorder.Code != test.status {
+			t.Errorf("Expected %s %s to answer %d, got %d: %s", test.method, test.path, test.status, recorder.Code, recorder.Body)
+		}
+	}
+
+	// Without tenants, anyone is served under the defaults
+	if recorder := post(&AnalysisServer{}, "POST", "/v1/analyze", "", body); recorder.Code != http.StatusOK || !bytes.Contains(recorder.Body.Bytes(), []byte(`"tenant":"default"`)) {
+		t.Errorf("Expected the default tenant, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	verdicts, err := OpenVerdictLog(filepath.Join(dir, "verdicts.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatalf("Could not open verdict log: %s", err)
+	}
+	server.VerdictLog = verdicts
+	post(server, "POST", "/v1/analyze", "web-1", body)
+	post(server, "POST", "/v1/analyze", "web-2", body)
+	verdicts.Close()
+	records := readVerdictLog(t, filepath.Join(dir, "verdicts.jsonl"))
+	if len(records) != 1 || records[0].Caller != "web-pki" || records[0].InputHash != fmt.Sprintf("%x", sha256.Sum256(body)) ||
+		records[0].PolicyHash != config.Authenticate("web-1").ConfigHash() || len(records[0].Verdicts) != 2 || len(records[0].Verdicts[0].FailedLints) == 0 {
+		t.Errorf("Expected the authorized request to be logged, got %+v", records)
+	}
+	if recorder := post(server, "POST", "/v1/analyze", "web-1", body); recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected verdicts that cannot be logged to fail the request, got %d", recorder.Code)
+	}
+
+	public := NewPublicAnalysisServer(1, 2)
+	if recorder := post(public, "POST", "/v1/analyze", "", bytes.Repeat(body, 6)); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 12 certificates to be refused, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := post(public, "POST", "/v1/analyze", "", body); recorder.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	recorder = post(public, "POST", "/v1/analyze", "", body)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected the third request to be rate limited, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := post(public, "GET", "/healthz", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected health checks not to be rate limited, got %d", recorder.Code)
+	}
+}
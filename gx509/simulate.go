@@ -0,0 +1,40 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"net"
+	"time"
+)
+
+// A LeafProfile describes a hypothetical TLS server certificate that an
+// intermediate might issue.
+type LeafProfile struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	ExtKeyUsage []x509.ExtKeyUsage
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// SimulateIssuance predicts whether each client in DefaultKnowledgeBase would
+// accept a leaf matching profile when issued by issuer, as of the leaf's
+// notBefore. No certificate is actually signed, so signatures and algorithms
+// are not considered.
+func SimulateIssuance(issuer *x509.Certificate, leaf LeafProfile) []ClientVerdict {
+	return DefaultKnowledgeBase.SimulateIssuance(issuer, leaf)
+}
+
+// SimulateIssuance is like the package-level SimulateIssuance, but uses the
+// clients in kb.
+func (kb *KnowledgeBase) SimulateIssuance(issuer *x509.Certificate, leaf LeafProfile) []ClientVerdict {
+	verdicts := make([]ClientVerdict, 0, len(kb.Clients))
+	for _, client := range kb.Clients {
+		verdicts = append(verdicts, evaluateChain(client, leaf, []*x509.Certificate{issuer}, leaf.NotBefore))
+	}
+	return verdicts
+}
@@ -0,0 +1,187 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func constrainedIntermediate(t *testing.T, dnsDomains []string) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co Issuing CA",
+		},
+		NotBefore: time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2027, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		PermittedIPAddresses: []net.IPNet{
+			{IP: net.ParseIP("192.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}},
+		PermittedDNSDomains: dnsDomains,
+	}
+
+	return serialiseAndParse(t, template)
+}
+
+func verdictFor(t *testing.T, verdicts []ClientVerdict, client string) ClientVerdict {
+	for _, verdict := range verdicts {
+		if verdict.Client == client {
+			return verdict
+		}
+	}
+	t.Fatalf("No verdict for %s", client)
+	return ClientVerdict{}
+}
+
+func checkAccepted(t *testing.T, verdicts []ClientVerdict, client string, expected bool) {
+	verdict := verdictFor(t, verdicts, client)
+	if verdict.Accepted != expected {
+		t.Errorf("%s: expected accepted=%v, got %v. Reasons: %v",
+			client, expected, verdict.Accepted, verdict.Reasons())
+	}
+}
+
+func testLeaf(names ...string) LeafProfile {
+	notBefore := time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC)
+	return LeafProfile{
+		DNSNames:    names,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.AddDate(0, 3, 0),
+	}
+}
+
+func TestSimulateInsideConstraints(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+	verdicts := SimulateIssuance(issuer, testLeaf("www.example.com"))
+
+	for _, client := range DefaultKnowledgeBase.Clients {
+		checkAccepted(t, verdicts, client.Name, true)
+	}
+}
+
+func TestSimulateOutsideConstraints(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+	verdicts := SimulateIssuance(issuer, testLeaf("www.example.org"))
+
+	for _, client := range DefaultKnowledgeBase.Clients {
+		checkAccepted(t, verdicts, client.Name, false)
+	}
+}
+
+func TestSimulateLeadingDotConstraint(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{".example.com"})
+	verdicts := SimulateIssuance(issuer, testLeaf("example.com"))
+
+	// The bare domain is not a subdomain of the constraint
+	checkAccepted(t, verdicts, "Firefox", false)
+	checkAccepted(t, verdicts, "Go", false)
+	// Java fails to parse the constraint at all
+	checkAccepted(t, verdicts, "Java", false)
+
+	verdicts = SimulateIssuance(issuer, testLeaf("www.example.com"))
+	checkAccepted(t, verdicts, "Firefox", true)
+	checkAccepted(t, verdicts, "Java", false)
+}
+
+func TestSimulateIPConstraints(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+
+	leaf := testLeaf()
+	leaf.IPAddresses = []net.IP{net.ParseIP("192.0.2.10")}
+	checkAccepted(t, SimulateIssuance(issuer, leaf), "Chrome", true)
+
+	leaf.IPAddresses = []net.IP{net.ParseIP("198.51.100.10")}
+	checkAccepted(t, SimulateIssuance(issuer, leaf), "Chrome", false)
+}
+
+func TestSimulateCommonNameOnly(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+
+	leaf := testLeaf()
+	leaf.CommonName = "www.example.org"
+	verdicts := SimulateIssuance(issuer, leaf)
+
+	// Browsers ignore the commonName entirely
+	checkAccepted(t, verdicts, "Chrome", false)
+	// OpenSSL falls back to the commonName and constrains it
+	checkAccepted(t, verdicts, "OpenSSL", false)
+	// Java falls back to the commonName without constraining it
+	checkAccepted(t, verdicts, "Java", true)
+}
+
+func TestSimulateLeafLifetime(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+
+	leaf := testLeaf("www.example.com")
+	leaf.NotBefore = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leaf.NotAfter = leaf.NotBefore.AddDate(2, 0, 0)
+	verdicts := SimulateIssuance(issuer, leaf)
+
+	checkAccepted(t, verdicts, "Safari", false)
+	checkAccepted(t, verdicts, "Chrome", false)
+	checkAccepted(t, verdicts, "Go", true)
+}
+
+func TestSimulateClientAuthLeaf(t *testing.T) {
+	t.Parallel()
+
+	issuer := constrainedIntermediate(t, []string{"example.com"})
+
+	leaf := testLeaf("www.example.com")
+	leaf.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	for _, verdict := range SimulateIssuance(issuer, leaf) {
+		if verdict.Accepted {
+			t.Errorf("%s accepted a leaf without serverAuth", verdict.Client)
+		}
+	}
+}
+
+func TestMatchDNSConstraint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, constraint string
+		subdomainsOnly   bool
+		expected         bool
+	}{
+		{"example.com", "example.com", true, true},
+		{"www.example.com", "example.com", true, true},
+		{"wwwexample.com", "example.com", true, false},
+		{"example.com", ".example.com", true, false},
+		{"example.com", ".example.com", false, true},
+		{"WWW.Example.COM.", "example.com", true, true},
+		{"anything.test", "", true, true},
+	}
+
+	for _, test := range tests {
+		result := matchDNSConstraint(test.name, test.constraint, test.subdomainsOnly)
+		if result != test.expected {
+			t.Errorf("matchDNSConstraint(%q, %q, %v): expected %v, got %v",
+				test.name, test.constraint, test.subdomainsOnly, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,722 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// An sqliteDatabase reads tables from an SQLite 3 database file. It supports
+// only what reading NSS databases needs: walking table b-trees, including
+// rows spilling onto overflow pages, with columns taken from simple CREATE
+// TABLE statements. Changes still in a write-ahead log are not seen.
+type sqliteDatabase struct {
+	data []byte
+	// pageSize and usable are the size of each page, and of the part of it
+	// not reserved for extensions.
+	pageSize, usable int
+}
+
+func openSQLite(data []byte) (*sqliteDatabase, error) {
+	if len(data) < 100 || !bytes.HasPrefix(data, sqliteMagic) {
+		return nil, fmt.Errorf("Not an SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("Invalid page size %d", pageSize)
+	}
+	return &sqliteDatabase{data: data, pageSize: pageSize, usable: pageSize - int(data[20])}, nil
+}
+
+func (db *sqliteDatabase) page(number uint32) ([]byte, error) {
+	start := (uint64(number) - 1) * uint64(db.pageSize)
+	if number == 0 || start+uint64(db.pageSize) > uint64(len(db.data)) {
+		return nil, fmt.Errorf("Page %d is out of range", number)
+	}
+	return db.data[start : start+uint64(db.pageSize)], nil
+}
+
+// sqliteVarint decodes the variable-length integer at the start of b and
+// returns it with its length, which is 0 if b is truncated.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 9; i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// rows calls fn with the values of every row in the table b-tree rooted at
+// page root, in rowid order.
+func (db *sqliteDatabase) rows(root uint32, fn func([]interface{})) error {
+	return db.walk(root, fn, 0)
+}
+
+func (db *sqliteDatabase) walk(number uint32, fn func([]interface{}), depth int) error {
+	// Real b-trees are a handful of levels deep, so this only stops cycles
+	if depth > 32 {
+		return fmt.Errorf("B-tree at page %d is too deep", number)
+	}
+	page, err := db.page(number)
+	if err != nil {
+		return err
+	}
+	header := page
+	if number == 1 {
+		header = page[100:]
+	}
+
+	var pointers []byte
+	switch header[0] {
+	case 0x0d:
+		pointers = header[8:]
+	case 0x05:
+		pointers = header[12:]
+	default:
+		return fmt.Errorf("Page %d is not part of a table", number)
+	}
+	count := int(binary.BigEndian.Uint16(header[3:]))
+	if len(pointers) < 2*count {
+		return fmt.Errorf("Page %d has too many cells", number)
+	}
+
+	for i := 0; i < count; i++ {
+		offset := int(binary.BigEndian.Uint16(pointers[2*i:]))
+		if offset+4 > db.usable {
+			return fmt.Errorf("Cell %d of page %d is out of range", i, number)
+		}
+		cell := page[offset:db.usable]
+		if header[0] == 0x05 {
+			if err := db.walk(binary.BigEndian.Uint32(cell), fn, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		payload, err := db.payload(cell)
+		if err != nil {
+			return fmt.Errorf("Cell %d of page %d: %s", i, number, err)
+		}
+		values, err := parseSQLiteRecord(payload)
+		if err != nil {
+			return fmt.Errorf("Cell %d of page %d: %s", i, number, err)
+		}
+		fn(values)
+	}
+	if header[0] == 0x05 {
+		return db.walk(binary.BigEndian.Uint32(header[8:]), fn, depth+1)
+	}
+	return nil
+}
+
+// payload returns the record in a table leaf cell, following it onto
+// overflow pages if it does not fit in the cell.
+func (db *sqliteDatabase) payload(cell []byte) ([]byte, error) {
+	size, n := sqliteVarint(cell)
+	if n == 0 {
+		return nil, fmt.Errorf("Truncated cell")
+	}
+	_, m := sqliteVarint(cell[n:])
+	if m == 0 {
+		return nil, fmt.Errorf("Truncated cell")
+	}
+	cell = cell[n+m:]
+	if size > uint64(len(db.data)) {
+		return nil, fmt.Errorf("Record of %d bytes is larger than the database", size)
+	}
+
+	// The amount kept in the cell itself is given by the file format
+	local, most := int(size), db.usable-35
+	if local > most {
+		least := (db.usable-12)*32/255 - 23
+		local = least + (int(size)-least)%(db.usable-4)
+		if local > most {
+			local = least
+		}
+	}
+	if local == int(size) {
+		if len(cell) < local {
+			return nil, fmt.Errorf("Truncated record")
+		}
+		return cell[:local], nil
+	}
+	if len(cell) < local+4 {
+		return nil, fmt.Errorf("Truncated record")
+	}
+
+	payload := append(make([]byte, 0, size), cell[:local]...)
+	next := binary.BigEndian.Uint32(cell[local:])
+	for len(payload) < int(size) {
+		page, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		chunk := page[4:db.usable]
+		if remaining := int(size) - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	return payload, nil
+}
+
+// parseSQLiteRecord decodes a record into int64, float64, []byte, string and
+// nil values.
+func parseSQLiteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize < uint64(n) || headerSize > uint64(len(payload)) {
+		return nil, fmt.Errorf("Invalid record header")
+	}
+	header, body := payload[n:headerSize], payload[headerSize:]
+
+	var values []interface{}
+	for len(header) > 0 {
+		serial, m := sqliteVarint(header)
+		if m == 0 {
+			return nil, fmt.Errorf("Invalid record header")
+		}
+		header = header[m:]
+
+		var length uint64
+		switch {
+		case serial >= 12:
+			length = (serial - 12) / 2
+		case serial >= 1 && serial <= 4:
+			length = serial
+		case serial == 5:
+			length = 6
+		case serial == 6 || serial == 7:
+			length = 8
+		case serial == 10 || serial == 11:
+			return nil, fmt.Errorf("Reserved column type %d", serial)
+		}
+		if length > uint64(len(body)) {
+			return nil, fmt.Errorf("Truncated record")
+		}
+		value := body[:length]
+		body = body[length:]
+
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial <= 6:
+			// Sign-extend from the first byte
+			v := int64(int8(value[0]))
+			for _, b := range value[1:] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serial == 8 || serial == 9:
+			values = append(values, int64(serial-8))
+		case serial%2 == 0:
+			values = append(values, value)
+		default:
+			values = append(values, string(value))
+		}
+	}
+	return values, nil
+}
+
+// sqliteColumns returns the names of the columns a CREATE TABLE statement
+// declares. Table constraints, and parentheses in column definitions, are
+// not understood.
+func sqliteColumns(sql string) []string {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var columns []string
+	for _, definition := range strings.Split(sql[start+1:end], ",") {
+		if fields := strings.Fields(definition); len(fields) > 0 {
+			columns = append(columns, strings.Trim(fields[0], "\"`[]"))
+		}
+	}
+	return columns
+}
+
+// table returns the rows of the named table, each mapping column names to
+// values.
+func (db *sqliteDatabase) table(name string) ([]map[string]interface{}, error) {
+	var root int64
+	var columns []string
+	err := db.rows(1, func(values []interface{}) {
+		// Schema rows are type, name, tbl_name, rootpage and sql
+		if len(values) < 5 || values[0] != "table" || values[1] != name {
+			return
+		}
+		root, _ = values[3].(int64)
+		sql, _ := values[4].(string)
+		columns = sqliteColumns(sql)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read schema: %s", err)
+	}
+	if root <= 0 || root > math.MaxUint32 {
+		return nil, fmt.Errorf("No table named %s", name)
+	}
+
+	var rows []map[string]interface{}
+	err = db.rows(uint32(root), func(values []interface{}) {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		rows = append(rows, row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %s", name, err)
+	}
+	return rows, nil
+}
+
+// sqliteWritePageSize is the page size of the databases writeSQLite writes,
+// the largest there is, so that most rows fit on their leaf page. Larger
+// rows spill onto overflow pages.
+const sqliteWritePageSize = 65536
+
+// The types of b-tree page writeSQLite writes.
+const (
+	sqliteInteriorIndexPage = 0x02
+	sqliteInteriorTablePage = 0x05
+	sqliteLeafIndexPage     = 0x0a
+	sqliteLeafTablePage     = 0x0d
+)
+
+// sqliteMaxIndexRecord is the largest index record that fits in its cell, as
+// writeSQLite writes no overflow pages for indexes.
+const sqliteMaxIndexRecord = (sqliteWritePageSize-12)*64/255 - 23
+
+// An sqliteTable is a table for writeSQLite: its CREATE TABLE statement and
+// a function that passes each of its rows, whose values are int64, bool,
+// string, []byte or nil, to emit in turn, so they need not all be held at
+// once.
+type sqliteTable struct {
+	name string
+	sql  string
+	rows func(emit func(row []interface{}) error) error
+	// primaryKey is whether the first column, a string, is the table's
+	// PRIMARY KEY, as sql must then declare. Rows must be emitted in
+	// ascending order of it, and writeSQLite writes the index SQLite keeps
+	// for it.
+	primaryKey bool
+}
+
+// sqliteRows returns rows for an sqliteTable.
+func sqliteRows(rows [][]interface{}) func(emit func([]interface{}) error) error {
+	return func(emit func([]interface{}) error) error {
+		for _, row := range rows {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// appendSQLiteVarint appends v to b as an SQLite variable-length integer.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v >= 1<<56 {
+		// The ninth byte holds eight bits rather than seven
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
+
+// sqliteRecord encodes values as a record, as parseSQLiteRecord decodes.
+func sqliteRecord(values []interface{}) ([]byte, error) {
+	var serials, body []byte
+	for _, value := range values {
+		if b, ok := value.(bool); ok {
+			value = int64(0)
+			if b {
+				value = int64(1)
+			}
+		}
+		switch v := value.(type) {
+		case nil:
+			serials = append(serials, 0)
+		case int64:
+			// Serial types 8 and 9 are the constants 0 and 1; 1, 2, 4 and 6
+			// are integers of 1, 2, 4 and 8 bytes
+			serial, length := byte(6), 8
+			switch {
+			case v == 0 || v == 1:
+				serial, length = byte(8+v), 0
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				serial, length = 1, 1
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				serial, length = 2, 2
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				serial, length = 4, 4
+			}
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(v))
+			serials, body = append(serials, serial), append(body, buf[8-length:]...)
+		case string:
+			serials = appendSQLiteVarint(serials, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			serials = appendSQLiteVarint(serials, uint64(len(v))*2+12)
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("Cannot store %T in SQLite", value)
+		}
+	}
+	// The header's size counts the varint giving it
+	size := len(serials) + 1
+	for len(appendSQLiteVarint(nil, uint64(size)))+len(serials) != size {
+		size++
+	}
+	record := appendSQLiteVarint(nil, uint64(size))
+	record = append(record, serials...)
+	return append(record, body...), nil
+}
+
+// leafCell encodes a table leaf cell holding row as rowid, writing the part
+// of a large record that does not fit on the leaf page to overflow pages.
+func (w *sqliteWriter) leafCell(rowid int64, row []interface{}) ([]byte, error) {
+	record, err := sqliteRecord(row)
+	if err != nil {
+		return nil, err
+	}
+	cell := appendSQLiteVarint(nil, uint64(len(record)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+
+	// The split SQLite expects, as sqliteDatabase.payload reads it
+	const (
+		maxLocal = sqliteWritePageSize - 35
+		minLocal = (sqliteWritePageSize-12)*32/255 - 23
+	)
+	if len(record) <= maxLocal {
+		return append(cell, record...), nil
+	}
+	local := minLocal + (len(record)-minLocal)%(sqliteWritePageSize-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	cell = append(cell, record[:local]...)
+
+	// Overflow pages are written in sequence, each starting with the number
+	// of the next, or zero on the last
+	first := w.next
+	for rest := record[local:]; len(rest) > 0; {
+		page := make([]byte, sqliteWritePageSize)
+		rest = rest[copy(page[4:], rest):]
+		if len(rest) > 0 {
+			binary.BigEndian.PutUint32(page, w.next+1)
+		}
+		w.add(page)
+	}
+	pointer := make([]byte, 4)
+	binary.BigEndian.PutUint32(pointer, first)
+	return append(cell, pointer...), nil
+}
+
+// sqliteBTreePage lays out a b-tree page of the given type whose header
+// starts at offset, which is 100 on page 1 and 0 on others, with the cells
+// and, for an interior page, the right-most pointer.
+func sqliteBTreePage(pageType byte, offset int, cells [][]byte, rightmost uint32) []byte {
+	page := make([]byte, sqliteWritePageSize)
+	header := page[offset:]
+	header[0] = pageType
+	pointers := header[8:]
+	if pageType == sqliteInteriorTablePage || pageType == sqliteInteriorIndexPage {
+		binary.BigEndian.PutUint32(header[8:], rightmost)
+		pointers = header[12:]
+	}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(cells)))
+	content := len(page)
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(pointers[2*i:], uint16(content))
+	}
+	// An offset of 65536, on an empty page, is written as zero
+	binary.BigEndian.PutUint16(header[5:], uint16(content))
+	return page
+}
+
+// sqliteFits is whether cells fit on a page after a header of the given
+// size.
+func sqliteFits(header int, cells [][]byte) bool {
+	size := header
+	for _, cell := range cells {
+		size += 2 + len(cell)
+	}
+	return size <= sqliteWritePageSize
+}
+
+// An sqliteChild is a page of a b-tree being written, with the largest
+// rowid under it.
+type sqliteChild struct {
+	page   uint32
+	maxKey int64
+}
+
+// An sqliteWriter writes the pages of a database as they are laid out, from
+// page 2; page 1, which holds the schema, is written last. The first error
+// writing stops it, and is kept in err.
+type sqliteWriter struct {
+	out  io.WriteSeeker
+	next uint32
+	err  error
+}
+
+// add writes page and returns its number.
+func (w *sqliteWriter) add(page []byte) uint32 {
+	if w.err == nil {
+		_, w.err = w.out.Write(page)
+	}
+	w.next++
+	return w.next - 1
+}
+
+// table writes the rows of rows as a table b-tree, with rowids from 1, and
+// returns its root page. Only the leaf pages' numbers are kept as it goes.
+func (w *sqliteWriter) table(rows func(emit func([]interface{}) error) error) (uint32, error) {
+	var children []sqliteChild
+	var cells [][]byte
+	var rowid int64
+	err := rows(func(row []interface{}) error {
+		rowid++
+		cell, err := w.leafCell(rowid, row)
+		if err != nil {
+			return err
+		}
+		if !sqliteFits(8, append(cells, cell)) {
+			children = append(children, sqliteChild{w.add(sqliteBTreePage(sqliteLeafTablePage, 0, cells, 0)), rowid - 1})
+			cells = nil
+		}
+		cells = append(cells, cell)
+		return w.err
+	})
+	if err != nil {
+		return 0, err
+	}
+	children = append(children, sqliteChild{w.add(sqliteBTreePage(sqliteLeafTablePage, 0, cells, 0)), rowid})
+
+	// Interior pages point to their last child with the right-most pointer,
+	// and to the others with cells keyed by the largest rowid under them. A
+	// cell and its pointer take at most 15 bytes, and spreading the children
+	// evenly gives every page at least two
+	const fanout = (sqliteWritePageSize - 12) / 15
+	for len(children) > 1 {
+		groups := (len(children) + fanout - 1) / fanout
+		var parents []sqliteChild
+		for i := 0; i < groups; i++ {
+			group := children[len(children)*i/groups : len(children)*(i+1)/groups]
+			var cells [][]byte
+			for _, child := range group[:len(group)-1] {
+				cell := make([]byte, 4, 13)
+				binary.BigEndian.PutUint32(cell, child.page)
+				cells = append(cells, appendSQLiteVarint(cell, uint64(child.maxKey)))
+			}
+			last := group[len(group)-1]
+			parents = append(parents, sqliteChild{w.add(sqliteBTreePage(sqliteInteriorTablePage, 0, cells, last.page)), last.maxKey})
+		}
+		children = parents
+	}
+	return children[0].page, w.err
+}
+
+// index writes an index b-tree of keys, the primary keys of a table's rows
+// in order, each with its rowid, from 1, and returns its root page. Unlike a
+// table b-tree, each entry is on only one page: those between two pages go
+// up to their parent.
+func (w *sqliteWriter) index(keys []string) (uint32, error) {
+	var entries [][]byte
+	largest := 0
+	for i, key := range keys {
+		record, err := sqliteRecord([]interface{}{key, int64(i + 1)})
+		if err != nil {
+			return 0, err
+		}
+		if len(record) > sqliteMaxIndexRecord {
+			return 0, fmt.Errorf("Key %d is too large to index", i+1)
+		}
+		entry := append(appendSQLiteVarint(nil, uint64(len(record))), record...)
+		if len(entry) > largest {
+			largest = len(entry)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Entries are spread evenly over as few leaves as hold them and the
+	// entries between the leaves, which leaves every leaf at least one
+	perLeaf := (sqliteWritePageSize - 8) / (largest + 2)
+	leaves := (len(entries) + 1 + perLeaf) / (perLeaf + 1)
+	inLeaves := len(entries) - (leaves - 1)
+	var children []uint32
+	var separators [][]byte
+	for i, next := 0, 0; i < leaves; i++ {
+		end := next + inLeaves*(i+1)/leaves - inLeaves*i/leaves
+		children = append(children, w.add(sqliteBTreePage(sqliteLeafIndexPage, 0, entries[next:end], 0)))
+		if next = end; i < leaves-1 {
+			separators = append(separators, entries[next])
+			next++
+		}
+	}
+
+	// Interior cells point to the child before their entry, and the
+	// right-most pointer to the last child. Spreading the children evenly
+	// gives every page at least two
+	perInterior := (sqliteWritePageSize-12)/(largest+6) + 1
+	for len(children) > 1 {
+		groups := (len(children) + perInterior - 1) / perInterior
+		var parents []uint32
+		var promoted [][]byte
+		for i := 0; i < groups; i++ {
+			start, end := len(children)*i/groups, len(children)*(i+1)/groups
+			var cells [][]byte
+			for j := start; j < end-1; j++ {
+				cell := make([]byte, 4, 4+len(separators[j]))
+				binary.BigEndian.PutUint32(cell, children[j])
+				cells = append(cells, append(cell, separators[j]...))
+			}
+			parents = append(parents, w.add(sqliteBTreePage(sqliteInteriorIndexPage, 0, cells, children[end-1])))
+			if i < groups-1 {
+				promoted = append(promoted, separators[end-1])
+			}
+		}
+		children, separators = parents, promoted
+	}
+	return children[0], w.err
+}
+
+// writeSQLite writes tables to out as an SQLite 3 database file, which SQLite
+// and openSQLite can both read. Pages are written as each fills, so out
+// holds a partial database if it fails.
+func writeSQLite(out io.WriteSeeker, tables []sqliteTable) error {
+	if _, err := out.Seek(sqliteWritePageSize, io.SeekStart); err != nil {
+		return err
+	}
+	w := &sqliteWriter{out: out, next: 2}
+	var schema [][]byte
+	addSchema := func(row []interface{}) error {
+		cell, err := w.leafCell(int64(len(schema)+1), row)
+		schema = append(schema, cell)
+		return err
+	}
+	for _, table := range tables {
+		rows := table.rows
+		if rows == nil {
+			rows = sqliteRows(nil)
+		}
+		var keys []string
+		if table.primaryKey {
+			unkeyed := rows
+			rows = func(emit func([]interface{}) error) error {
+				return unkeyed(func(row []interface{}) error {
+					key, ok := row[0].(string)
+					if !ok || (len(keys) > 0 && key <= keys[len(keys)-1]) {
+						return fmt.Errorf("Row %d is not in ascending order of its key", len(keys)+1)
+					}
+					keys = append(keys, key)
+					return emit(row)
+				})
+			}
+		}
+		root, err := w.table(rows)
+		if err != nil {
+			return fmt.Errorf("Could not write %s: %s", table.name, err)
+		}
+		if err := addSchema([]interface{}{"table", table.name, table.name, int64(root), table.sql}); err != nil {
+			return err
+		}
+		if !table.primaryKey {
+			continue
+		}
+		// SQLite names the index for a primary key itself, and gives it no
+		// CREATE INDEX statement
+		if root, err = w.index(keys); err != nil {
+			return fmt.Errorf("Could not index %s: %s", table.name, err)
+		}
+		index := fmt.Sprintf("sqlite_autoindex_%s_1", table.name)
+		if err := addSchema([]interface{}{"index", index, table.name, int64(root), nil}); err != nil {
+			return err
+		}
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if !sqliteFits(100+8, schema) {
+		return fmt.Errorf("Schema is too large")
+	}
+
+	first := sqliteBTreePage(sqliteLeafTablePage, 100, schema, 0)
+	header := first[:100]
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:], 1) // The page size, 65536
+	header[18], header[19] = 1, 1              // A rollback journal
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], 1) // The change counter
+	binary.BigEndian.PutUint32(header[28:], w.next-1)
+	binary.BigEndian.PutUint32(header[40:], 1) // The schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // The schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // The change counter it is valid for
+	binary.BigEndian.PutUint32(header[96:], 3031001)
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := out.Write(first)
+	return err
+}
+
+// writeSQLiteFile writes tables to an SQLite database at path, replacing any
+// file there atomically, so a failed write leaves it intact.
+func writeSQLiteFile(path string, tables []sqliteTable) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if err := writeSQLite(temp, tables); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
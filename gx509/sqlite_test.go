@@ -0,0 +1,274 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sqliteVarintBytes(v uint64) []byte {
+	out := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		out = append([]byte{byte(v&0x7f) | 0x80}, out...)
+	}
+	return out
+}
+
+func sqliteRecordBytes(values []interface{}) []byte {
+	var header, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			header = append(header, 0)
+		case int64:
+			header = append(header, 6)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		case []byte:
+			header = append(header, sqliteVarintBytes(uint64(12+2*len(v)))...)
+			body = append(body, v...)
+		case string:
+			header = append(header, sqliteVarintBytes(uint64(13+2*len(v)))...)
+			body = append(body, v...)
+		}
+	}
+	size := len(header) + 1
+	if size >= 0x80 {
+		size++
+	}
+	return append(append(sqliteVarintBytes(uint64(size)), header...), body...)
+}
+
+type testSQLiteTable struct {
+	name, sql string
+	rows      [][]interface{}
+}
+
+// testSQLite writes an SQLite database holding each table in a single leaf
+// page, with records too big for it spilling onto overflow pages.
+func testSQLite(t *testing.T, pageSize int, tables ...testSQLiteTable) []byte {
+	pages := make([][]byte, len(tables)+1)
+	fill := func(number int, rows [][]interface{}) {
+		page := make([]byte, pageSize)
+		header := page
+		if number == 1 {
+			header = page[100:]
+		}
+		header[0] = 0x0d
+		binary.BigEndian.PutUint16(header[3:], uint16(len(rows)))
+
+		end := pageSize
+		for i, row := range rows {
+			payload := sqliteRecordBytes(row)
+			cell := append(sqliteVarintBytes(uint64(len(payload))), sqliteVarintBytes(uint64(i+1))...)
+			local, most := len(payload), pageSize-35
+			if local > most {
+				least := (pageSize-12)*32/255 - 23
+				if local = least + (len(payload)-least)%(pageSize-4); local > most {
+					local = least
+				}
+			}
+			cell = append(cell, payload[:local]...)
+			if local < len(payload) {
+				cell = binary.BigEndian.AppendUint32(cell, uint32(len(pages)+1))
+				for rest := payload[local:]; len(rest) > 0; {
+					overflow := make([]byte, pageSize)
+					rest = rest[copy(overflow[4:], rest):]
+					if len(rest) > 0 {
+						binary.BigEndian.PutUint32(overflow, uint32(len(pages)+2))
+					}
+					pages = append(pages, overflow)
+				}
+			}
+
+			end -= len(cell)
+			if end < len(page)-len(header)+8+2*len(rows) {
+				t.Fatalf("Rows do not fit in page %d", number)
+			}
+			copy(page[end:], cell)
+			binary.BigEndian.PutUint16(header[8+2*i:], uint16(end))
+		}
+		binary.BigEndian.PutUint16(header[5:], uint16(end))
+		pages[number-1] = page
+	}
+
+	var schema [][]interface{}
+	for i, table := range tables {
+		schema = append(schema, []interface{}{"table", table.name, table.name, int64(i + 2), table.sql})
+		fill(i+2, table.rows)
+	}
+	fill(1, schema)
+	copy(pages[0], sqliteMagic)
+	binary.BigEndian.PutUint16(pages[0][16:], uint16(pageSize))
+	return bytes.Join(pages, nil)
+}
+
+func TestSQLiteTable(t *testing.T) {
+	t.Parallel()
+
+	large := bytes.Repeat([]byte("gx509"), 400)
+	data := testSQLite(t, 512, testSQLiteTable{
+		name: "other",
+		sql:  "CREATE TABLE other (x)",
+	}, testSQLiteTable{
+		name: "values",
+		sql:  "CREATE TABLE \"values\" (id INTEGER PRIMARY KEY, number, text TEXT, blob BLOB)",
+		rows: [][]interface{}{
+			{nil, int64(-2), "two", large},
+			{nil, int64(1 << 40)},
+		},
+	})
+	db, err := openSQLite(data)
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	rows, err := db.table("values")
+	if err != nil {
+		t.Fatalf("Could not read table: %s", err)
+	}
+	expected := []map[string]interface{}{
+		{"id": nil, "number": int64(-2), "text": "two", "blob": large},
+		{"id": nil, "number": int64(1 << 40)},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+
+	if _, err := db.table("missing"); err == nil || !strings.Contains(err.Error(), "No table named") {
+		t.Errorf("Expected no table named missing, got %v", err)
+	}
+	if _, err := openSQLite([]byte("-----BEGIN CERTIFICATE-----")); err == nil {
+		t.Errorf("Expected an error for a file that is not a database")
+	}
+	truncated, _ := openSQLite(data[:4*512])
+	if _, err := truncated.table("values"); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Expected overflow pages out of range, got %v", err)
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	t.Parallel()
+
+	// Enough rows to fill several leaves under an interior page
+	blob := bytes.Repeat([]byte("gx509"), 200)
+	var rows [][]interface{}
+	for i := 0; i < 500; i++ {
+		rows = append(rows, []interface{}{int64(i) * 1000003, i%2 == 0, "row", blob, nil})
+	}
+	data := writeTestSQLite(t, []sqliteTable{
+		{name: "empty", sql: "CREATE TABLE empty (x)"},
+		{name: "rows", sql: "CREATE TABLE rows (number INTEGER, even INTEGER, text TEXT, blob BLOB, missing)", rows: sqliteRows(rows)},
+	})
+	if len(data)/sqliteWritePageSize < 4 {
+		t.Errorf("Expected several pages, got %d bytes", len(data))
+	}
+	db, err := openSQLite(data)
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	if empty, err := db.table("empty"); err != nil || len(empty) != 0 {
+		t.Errorf("Expected an empty table, got %v and %v", empty, err)
+	}
+	read, err := db.table("rows")
+	if err != nil {
+		t.Fatalf("Could not read table: %s", err)
+	}
+	if len(read) != len(rows) {
+		t.Fatalf("Expected %d rows, got %d", len(rows), len(read))
+	}
+	for i, row := range read {
+		even := int64(0)
+		if i%2 == 0 {
+			even = 1
+		}
+		expected := map[string]interface{}{"number": int64(i) * 1000003, "even": even, "text": "row", "blob": blob, "missing": nil}
+		if !reflect.DeepEqual(row, expected) {
+			t.Fatalf("Unexpected row %d: %v", i, row)
+		}
+	}
+
+	for _, v := range []uint64{0, 127, 128, 1<<56 - 1, 1 << 56, 1<<64 - 1} {
+		if decoded, n := sqliteVarint(appendSQLiteVarint(nil, v)); decoded != v || n == 0 {
+			t.Errorf("Could not round-trip varint %d, got %d", v, decoded)
+		}
+	}
+
+	// Rows larger than a page spill onto a chain of overflow pages
+	var large [][]interface{}
+	for _, size := range []int{sqliteWritePageSize - 36, sqliteWritePageSize, 140000, 3*sqliteWritePageSize + 17} {
+		large = append(large, []interface{}{int64(size), bytes.Repeat([]byte{byte(size)}, size)})
+	}
+	db, err = openSQLite(writeTestSQLite(t, []sqliteTable{{name: "large", sql: "CREATE TABLE large (size, x)", rows: sqliteRows(large)}}))
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	read, err = db.table("large")
+	if err != nil || len(read) != len(large) {
+		t.Fatalf("Expected %d large rows, got %d and %v", len(large), len(read), err)
+	}
+	for i, row := range read {
+		if !reflect.DeepEqual(row, map[string]interface{}{"size": large[i][0], "x": large[i][1]}) {
+			t.Errorf("Could not round-trip a row of %d bytes", large[i][0])
+		}
+	}
+}
+
+func TestWriteSQLitePrimaryKey(t *testing.T) {
+	t.Parallel()
+
+	// Enough keys to need interior index pages
+	var rows [][]interface{}
+	for i := 0; i < 3000; i++ {
+		rows = append(rows, []interface{}{fmt.Sprintf("%064d", i), int64(i)})
+	}
+	table := sqliteTable{name: "keyed", sql: "CREATE TABLE keyed (key TEXT PRIMARY KEY, value INTEGER)", rows: sqliteRows(rows), primaryKey: true}
+	db, err := openSQLite(writeTestSQLite(t, []sqliteTable{table}))
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	read, err := db.table("keyed")
+	if err != nil || len(read) != len(rows) {
+		t.Fatalf("Expected %d rows, got %d and %v", len(rows), len(read), err)
+	}
+
+	var indexes []string
+	db.rows(1, func(values []interface{}) {
+		if values[0] == "index" {
+			indexes = append(indexes, fmt.Sprintf("%s on %s", values[1], values[2]))
+		}
+	})
+	if !reflect.DeepEqual(indexes, []string{"sqlite_autoindex_keyed_1 on keyed"}) {
+		t.Errorf("Expected the primary key's index in the schema, got %v", indexes)
+	}
+
+	table.rows = sqliteRows([][]interface{}{{"b"}, {"a"}})
+	file, _ := ioutil.TempFile(t.TempDir(), "sqlite")
+	defer file.Close()
+	if err := writeSQLite(file, []sqliteTable{table}); err == nil {
+		t.Errorf("Expected an error for keys out of order")
+	}
+}
+
+// writeTestSQLite writes tables to a temporary file and returns its contents.
+func writeTestSQLite(t *testing.T, tables []sqliteTable) []byte {
+	file, err := ioutil.TempFile(t.TempDir(), "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := writeSQLite(file, tables); err != nil {
+		t.Fatalf("Could not write database: %s", err)
+	}
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
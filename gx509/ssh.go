@@ -0,0 +1,459 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenSSH certificate types, from PROTOCOL.certkeys.
+const (
+	SSHUserCert = 1
+	SSHHostCert = 2
+)
+
+const sshCertSuffix = "-cert-v01@openssh.com"
+
+// An SSHKey is an OpenSSH public key in its wire encoding.
+type SSHKey struct {
+	Type string
+	Raw  []byte
+}
+
+// An SSHCertificate is an OpenSSH certificate, as described in
+// PROTOCOL.certkeys.
+type SSHCertificate struct {
+	Raw  []byte
+	Key  SSHKey
+	Type uint32
+	// Serial and KeyID are chosen by the CA; KeyID is logged by sshd.
+	Serial     uint64
+	KeyID      string
+	Principals []string
+	ValidAfter time.Time
+	// ValidBefore is the zero time for certificates that never expire.
+	ValidBefore time.Time
+	// CriticalOptions maps each option to its value, which is empty for
+	// flags like verify-required.
+	CriticalOptions map[string]string
+	Extensions      []string
+	SignatureKey    SSHKey
+	// SignatureAlgorithm is the algorithm of the CA's signature, e.g.
+	// "rsa-sha2-512".
+	SignatureAlgorithm string
+}
+
+// sshReader reads the SSH wire encoding, remembering the first error.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("Truncated SSH data")
+	}
+	r.data = nil
+}
+
+func (r *sshReader) uint32() uint32 {
+	if len(r.data) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *sshReader) uint64() uint64 {
+	if len(r.data) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if uint64(n) > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *sshReader) string() string {
+	return string(r.bytes())
+}
+
+// strings reads a string holding a list of strings.
+func (r *sshReader) strings() []string {
+	inner := &sshReader{data: r.bytes()}
+	var values []string
+	for len(inner.data) > 0 {
+		values = append(values, inner.string())
+	}
+	if inner.err != nil && r.err == nil {
+		r.err = inner.err
+	}
+	return values
+}
+
+// skipKeyFields skips the public key fields that follow keyType's name.
+func (r *sshReader) skipKeyFields(keyType string) {
+	fields := map[string]int{
+		"ssh-rsa":                            2,
+		"ssh-dss":                            4,
+		"ecdsa-sha2-nistp256":                2,
+		"ecdsa-sha2-nistp384":                2,
+		"ecdsa-sha2-nistp521":                2,
+		"ssh-ed25519":                        1,
+		"sk-ecdsa-sha2-nistp256@openssh.com": 3,
+		"sk-ssh-ed25519@openssh.com":         2,
+	}[keyType]
+	if fields == 0 {
+		r.err = fmt.Errorf("Unknown SSH key type %s", keyType)
+		return
+	}
+	for i := 0; i < fields; i++ {
+		r.bytes()
+	}
+}
+
+func sshString(s []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+	return append(length[:], s...)
+}
+
+// certifiedKeyType returns the type of key a certificate type certifies.
+func certifiedKeyType(certType string) string {
+	keyType := strings.TrimSuffix(certType, sshCertSuffix)
+	if strings.HasPrefix(keyType, "sk-") {
+		keyType += "@openssh.com"
+	}
+	return keyType
+}
+
+// ParseSSHCertificate parses the wire encoding of an OpenSSH certificate.
+func ParseSSHCertificate(raw []byte) (*SSHCertificate, error) {
+	r := &sshReader{data: raw}
+	certType := r.string()
+	if r.err == nil && !strings.HasSuffix(certType, sshCertSuffix) {
+		return nil, fmt.Errorf("Not an SSH certificate: %s", certType)
+	}
+	r.bytes() // nonce
+
+	keyType := certifiedKeyType(certType)
+	start := r.data
+	r.skipKeyFields(keyType)
+	if r.err != nil {
+		return nil, r.err
+	}
+	fields := start[:len(start)-len(r.data)]
+
+	cert := &SSHCertificate{
+		Raw: raw,
+		Key: SSHKey{Type: keyType, Raw: append(sshString([]byte(keyType)), fields...)},
+	}
+	cert.Serial = r.uint64()
+	cert.Type = r.uint32()
+	cert.KeyID = r.string()
+	cert.Principals = r.strings()
+	cert.ValidAfter = sshTime(r.uint64())
+	if validBefore := r.uint64(); validBefore != math.MaxUint64 {
+		cert.ValidBefore = sshTime(validBefore)
+	}
+
+	options := r.bytes()
+	cert.CriticalOptions = make(map[string]string)
+	optionReader := &sshReader{data: options}
+	for len(optionReader.data) > 0 {
+		name := optionReader.string()
+		value := &sshReader{data: optionReader.bytes()}
+		if len(value.data) > 0 {
+			cert.CriticalOptions[name] = value.string()
+		} else {
+			cert.CriticalOptions[name] = ""
+		}
+	}
+	extensionReader := &sshReader{data: r.bytes()}
+	for len(extensionReader.data) > 0 {
+		cert.Extensions = append(cert.Extensions, extensionReader.string())
+		extensionReader.bytes()
+	}
+	r.bytes() // reserved
+
+	signatureKey := r.bytes()
+	cert.SignatureKey = SSHKey{Type: (&sshReader{data: signatureKey}).string(), Raw: signatureKey}
+	signature := &sshReader{data: r.bytes()}
+	cert.SignatureAlgorithm = signature.string()
+
+	for _, err := range []error{r.err, optionReader.err, extensionReader.err, signature.err} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("Trailing data after SSH certificate")
+	}
+	return cert, nil
+}
+
+func sshTime(seconds uint64) time.Time {
+	if seconds > math.MaxInt64 {
+		seconds = math.MaxInt64
+	}
+	return time.Unix(int64(seconds), 0).UTC()
+}
+
+// Fingerprint returns the key's fingerprint as ssh-keygen shows it.
+func (k SSHKey) Fingerprint() string {
+	digest := sha256.Sum256(k.Raw)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(digest[:])
+}
+
+// Describe names the algorithm and size of the key, e.g. "RSA 2048", and
+// reports whether it is weak by the same standards as DescribeKey.
+func (k SSHKey) Describe() (description string, weak bool) {
+	r := &sshReader{data: k.Raw}
+	r.string()
+	switch k.Type {
+	case "ssh-rsa":
+		r.bytes() // e
+		bits := new(big.Int).SetBytes(r.bytes()).BitLen()
+		return fmt.Sprintf("RSA %d", bits), bits < MinRSAKeyBits
+	case "ssh-dss":
+		bits := new(big.Int).SetBytes(r.bytes()).BitLen()
+		return fmt.Sprintf("DSA %d", bits), true
+	case "ecdsa-sha2-nistp256", "sk-ecdsa-sha2-nistp256@openssh.com":
+		description = "ECDSA P-256"
+	case "ecdsa-sha2-nistp384":
+		description = "ECDSA P-384"
+	case "ecdsa-sha2-nistp521":
+		description = "ECDSA P-521"
+	case "ssh-ed25519", "sk-ssh-ed25519@openssh.com":
+		description = "Ed25519"
+	default:
+		return k.Type, false
+	}
+	if strings.HasPrefix(k.Type, "sk-") {
+		description += " (security key)"
+	}
+	return description, false
+}
+
+// An SSHEntry is a key or certificate read from an OpenSSH file such as
+// authorized_keys, known_hosts, a *.pub public key or a *-cert.pub
+// certificate.
+type SSHEntry struct {
+	Line    int
+	Comment string
+	// Exactly one of Key and Cert is set.
+	Key  *SSHKey
+	Cert *SSHCertificate
+	// CertAuthority is set for keys trusted as CAs, with the cert-authority
+	// option in authorized_keys or the @cert-authority marker in
+	// known_hosts.
+	CertAuthority bool
+}
+
+// ParseSSHKeys reads every public key and certificate from an OpenSSH file,
+// skipping blank lines and comments. Lines may carry authorized_keys options
+// or known_hosts markers and host patterns.
+func ParseSSHKeys(r io.Reader) ([]SSHEntry, error) {
+	var entries []SSHEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		entry, err := parseSSHLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseSSHLine(text string) (SSHEntry, error) {
+	fields := strings.Fields(text)
+	var entry SSHEntry
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "@cert-authority" {
+			entry.CertAuthority = true
+		}
+		if optionsGrantCA(fields[i]) {
+			entry.CertAuthority = true
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			continue
+		}
+		keyType := (&sshReader{data: raw}).string()
+		if keyType != fields[i] {
+			continue
+		}
+
+		entry.Comment = strings.Join(fields[i+2:], " ")
+		if strings.HasSuffix(keyType, sshCertSuffix) {
+			entry.Cert, err = ParseSSHCertificate(raw)
+			return entry, err
+		}
+		r := &sshReader{data: raw}
+		r.string()
+		r.skipKeyFields(keyType)
+		if r.err != nil {
+			return entry, r.err
+		}
+		entry.Key = &SSHKey{Type: keyType, Raw: raw}
+		return entry, nil
+	}
+	return entry, fmt.Errorf("No SSH key found")
+}
+
+// optionsGrantCA reports whether an authorized_keys options field includes
+// cert-authority, ignoring commas inside quoted values.
+func optionsGrantCA(options string) bool {
+	quoted := false
+	start := 0
+	for i := 0; i <= len(options); i++ {
+		if i < len(options) && options[i] == '"' {
+			quoted = !quoted
+		}
+		if i == len(options) || (options[i] == ',' && !quoted) {
+			if strings.EqualFold(options[start:i], "cert-authority") {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
+
+// Extensions granting the holder of an SSH user certificate more than a
+// shell.
+var sshPermissiveExtensions = map[string]string{
+	"permit-agent-forwarding": "agent forwarding",
+	"permit-port-forwarding":  "port forwarding",
+	"permit-X11-forwarding":   "X11 forwarding",
+	"permit-user-rc":          "~/.ssh/rc",
+}
+
+// Critical options understood by OpenSSH; certificates with any other are
+// refused.
+var sshKnownCriticalOptions = map[string]bool{
+	"force-command":   true,
+	"source-address":  true,
+	"verify-required": true,
+}
+
+// DetermineIfSSHCertificateConstrained reports whether an SSH certificate is
+// limited in who may use it and for how long, analogously to
+// AnalyzeTechnicalConstraints: it must name principals and expire, and
+// user certificates must also be restricted to source addresses or a forced
+// command.
+func DetermineIfSSHCertificateConstrained(cert *SSHCertificate) (bool, string) {
+	if len(cert.Principals) == 0 {
+		return false, "No principals, so valid for any user or host"
+	}
+	if cert.ValidBefore.IsZero() {
+		return false, "Never expires"
+	}
+	if cert.Type == SSHUserCert {
+		_, hasSource := cert.CriticalOptions["source-address"]
+		_, hasCommand := cert.CriticalOptions["force-command"]
+		if !hasSource && !hasCommand {
+			return false, "Neither source-address nor force-command restricts use"
+		}
+	}
+	return true, fmt.Sprintf("Is constrained: principals=%v, validBefore=%s",
+		cert.Principals, cert.ValidBefore.Format(time.RFC3339))
+}
+
+// AnalyzeSSHCertificate lists, at the given time, the properties of an SSH
+// certificate that deserve attention.
+func AnalyzeSSHCertificate(cert *SSHCertificate, at time.Time) []string {
+	var problems []string
+	if constrained, reason := DetermineIfSSHCertificateConstrained(cert); !constrained {
+		problems = append(problems, "Unconstrained: "+reason)
+	}
+
+	switch {
+	case at.Before(cert.ValidAfter):
+		problems = append(problems, "Not yet valid")
+	case !cert.ValidBefore.IsZero() && !at.Before(cert.ValidBefore):
+		problems = append(problems, "Expired")
+	}
+	if cert.Type != SSHUserCert && cert.Type != SSHHostCert {
+		problems = append(problems, fmt.Sprintf("Unknown certificate type %d", cert.Type))
+	}
+
+	var options []string
+	for option := range cert.CriticalOptions {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	for _, option := range options {
+		if cert.Type == SSHHostCert {
+			problems = append(problems, fmt.Sprintf("Host certificate has critical option %s, which sshd will refuse", option))
+		} else if !sshKnownCriticalOptions[option] {
+			problems = append(problems, fmt.Sprintf("Unknown critical option %s, which sshd will refuse", option))
+		}
+	}
+
+	if cert.Type == SSHUserCert {
+		var grants []string
+		for _, extension := range cert.Extensions {
+			if grant, ok := sshPermissiveExtensions[extension]; ok {
+				grants = append(grants, grant)
+			}
+		}
+		if len(grants) > 0 {
+			problems = append(problems, "Permits "+strings.Join(grants, ", "))
+		}
+	}
+
+	if description, weak := cert.Key.Describe(); weak {
+		problems = append(problems, "Weak key: "+description)
+	}
+	if description, weak := cert.SignatureKey.Describe(); weak {
+		problems = append(problems, "Weak CA key: "+description)
+	}
+	if cert.SignatureAlgorithm == "ssh-rsa" || cert.SignatureAlgorithm == "ssh-dss" {
+		problems = append(problems, "Signed with SHA-1 ("+cert.SignatureAlgorithm+")")
+	}
+	return problems
+}
+
+// SignedBy reports whether ca is the key that signed cert. The signature
+// itself is not checked.
+func (cert *SSHCertificate) SignedBy(ca SSHKey) bool {
+	return bytes.Equal(cert.SignatureKey.Raw, ca.Raw)
+}
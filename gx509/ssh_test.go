@@ -0,0 +1,156 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Written by ssh-keygen: a user certificate for alice and root restricted to
+// 10.0.0.0/8 with only permit-pty, and a host certificate for a 1024-bit RSA
+// key that never expires, both signed by the Ed25519 CA key.
+const (
+	testSSHCAKey = "ssh-ed25519 " +
+		"AAAAC3NzaC1lZDI1NTE5AAAAIDSmX5Z1EIPOVckaJOOEHHJBBjUXmVtYVERBdads2fpW ca@example"
+	testSSHUserCert = "ecdsa-sha2-nistp256-cert-v01@openssh.com " +
+		"AAAAKGVjZHNhLXNoYTItbmlzdHAyNTYtY2VydC12MDFAb3BlbnNzaC5jb20AAAAg2LEr79iO" +
+		"i+GEZt/hag6W6JvQq8yJTj9jUPRiJzg1T+oAAAAIbmlzdHAyNTYAAABBBI9G2rE/ARtmWbWF" +
+		"4zR84GShC+5NeqQtd2jOoRmfYLMDmXHjbnP7jlZRmSVVtIzgLSJwJEt5m6y868+UndAK5zQA" +
+		"AAAAAAAAAAAAAAEAAAANYWxpY2VAZXhhbXBsZQAAABEAAAAFYWxpY2UAAAAEcm9vdAAAAABp" +
+		"VbkAAAAAAGs27IAAAAAkAAAADnNvdXJjZS1hZGRyZXNzAAAADgAAAAoxMC4wLjAuMC84AAAA" +
+		"EgAAAApwZXJtaXQtcHR5AAAAAAAAAAAAAAAzAAAAC3NzaC1lZDI1NTE5AAAAIDSmX5Z1EIPO" +
+		"VckaJOOEHHJBBjUXmVtYVERBdads2fpWAAAAUwAAAAtzc2gtZWQyNTUxOQAAAEA4/47ebAEU" +
+		"LqhxKIAbKCcxlPIFUdKhk6d8ruRmF2WWBsBSQKph17eU3aKmHFo0cE7Za7bmgi91KtT5HLUU" +
+		"VCgC alice"
+	testSSHHostCert = "ssh-rsa-cert-v01@openssh.com " +
+		"AAAAHHNzaC1yc2EtY2VydC12MDFAb3BlbnNzaC5jb20AAAAg6iwQ5Q034A3JD+MapDEPEvUR" +
+		"u98tXv9vcISlRaLqmFUAAAADAQABAAAAgQDNzy2+4A+rJLrlfDI3x+ojSPUEqvF1G9Hk9NHj" +
+		"Py7ekZkF2T7taXV8OwM3HW2ceKJ9SG9u0g9Bg3NJdNQXiFn0+NgBXMU9WTY8g+lVrTc/btuS" +
+		"/Vl10g7H3j4ILNOO1xRylvDqdHJa+NrmoV5oq3pK70cQq9vJ5mSYhSeoK5w2oQAAAAAAAAAA" +
+		"AAAAAgAAAAVob3N0MQAAAAAAAAAAAAAAAP//////////AAAAAAAAAAAAAAAAAAAAMwAAAAtz" +
+		"c2gtZWQyNTUxOQAAACA0pl+WdRCDzlXJGiTjhBxyQQY1F5lbWFREQXWnbNn6VgAAAFMAAAAL" +
+		"c3NoLWVkMjU1MTkAAABApM/X/umFau+ycsxpQHzURScWjrj5C7L/4z6d9YGuX9GnyUz+tykT" +
+		"PJRfIJVQfVGEBgM05RaubDAp+BjPEL3nDw=="
+)
+
+func testSSHEntries(t *testing.T) []SSHEntry {
+	file := strings.Join([]string{
+		"# A comment",
+		"",
+		"@cert-authority *.example.com " + testSSHCAKey,
+		testSSHUserCert,
+		`from="10.0.0.0/8",cert-authority,principals="alice,bob" ` + testSSHCAKey,
+		testSSHHostCert,
+	}, "\n")
+	entries, err := ParseSSHKeys(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Could not parse SSH keys: %s", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(entries))
+	}
+	return entries
+}
+
+func TestParseSSHKeys(t *testing.T) {
+	t.Parallel()
+
+	entries := testSSHEntries(t)
+	ca := entries[0]
+	if ca.Line != 3 || ca.Key == nil || !ca.CertAuthority || ca.Comment != "ca@example" {
+		t.Errorf("Unexpected CA entry: %+v", ca)
+	}
+	if fingerprint := ca.Key.Fingerprint(); fingerprint != "SHA256:jTk6eYaxrafV5gpIsanHmZ27KiUXNEAm+6yqbXmp8gY" {
+		t.Errorf("Unexpected fingerprint %s", fingerprint)
+	}
+	if !entries[2].CertAuthority || entries[1].CertAuthority {
+		t.Errorf("Expected cert-authority only where it is set")
+	}
+
+	if _, err := ParseSSHKeys(strings.NewReader("ssh-ed25519 AAAA")); err == nil {
+		t.Errorf("Expected an error for a truncated key")
+	}
+}
+
+func TestParseSSHCertificate(t *testing.T) {
+	t.Parallel()
+
+	entries := testSSHEntries(t)
+	user := entries[1].Cert
+	if user.Type != SSHUserCert || user.KeyID != "alice@example" || user.Serial != 0 {
+		t.Errorf("Unexpected certificate: %+v", user)
+	}
+	if !reflect.DeepEqual(user.Principals, []string{"alice", "root"}) {
+		t.Errorf("Unexpected principals %v", user.Principals)
+	}
+	if !user.ValidAfter.Equal(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)) ||
+		!user.ValidBefore.Equal(time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected validity %s to %s", user.ValidAfter, user.ValidBefore)
+	}
+	if !reflect.DeepEqual(user.CriticalOptions, map[string]string{"source-address": "10.0.0.0/8"}) {
+		t.Errorf("Unexpected critical options %v", user.CriticalOptions)
+	}
+	if !reflect.DeepEqual(user.Extensions, []string{"permit-pty"}) {
+		t.Errorf("Unexpected extensions %v", user.Extensions)
+	}
+	if user.Key.Fingerprint() != "SHA256:K6eqiGj7Fmf0Hohvwo2lpS5y/e3fdOo/QiH+ymrk3LE" {
+		t.Errorf("Unexpected key fingerprint %s", user.Key.Fingerprint())
+	}
+	if !user.SignedBy(*entries[0].Key) || user.SignatureAlgorithm != "ssh-ed25519" {
+		t.Errorf("Expected the user certificate to be signed by the CA")
+	}
+
+	host := entries[3].Cert
+	if host.Type != SSHHostCert || !host.ValidBefore.IsZero() || len(host.Principals) != 0 {
+		t.Errorf("Unexpected host certificate: %+v", host)
+	}
+	if description, weak := host.Key.Describe(); description != "RSA 1024" || !weak {
+		t.Errorf("Unexpected key description %s", description)
+	}
+	if host.Key.Fingerprint() != "SHA256:PObef28Kr/FnVR2YmCxMNuUvgE8yZvAkUA84kOdEEUE" {
+		t.Errorf("Unexpected key fingerprint %s", host.Key.Fingerprint())
+	}
+}
+
+func TestAnalyzeSSHCertificate(t *testing.T) {
+	t.Parallel()
+
+	entries := testSSHEntries(t)
+	at := time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	user := entries[1].Cert
+	if constrained, reason := DetermineIfSSHCertificateConstrained(user); !constrained {
+		t.Errorf("Expected the user certificate to be constrained: %s", reason)
+	}
+	if problems := AnalyzeSSHCertificate(user, at); len(problems) != 0 {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	if problems := AnalyzeSSHCertificate(user, at.AddDate(1, 0, 0)); !reflect.DeepEqual(problems, []string{"Expired"}) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	delete(user.CriticalOptions, "source-address")
+	user.CriticalOptions["no-such-option"] = ""
+	user.Extensions = append(user.Extensions, "permit-agent-forwarding", "permit-port-forwarding")
+	expected := []string{
+		"Unconstrained: Neither source-address nor force-command restricts use",
+		"Unknown critical option no-such-option, which sshd will refuse",
+		"Permits agent forwarding, port forwarding",
+	}
+	if problems := AnalyzeSSHCertificate(user, at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	expected = []string{
+		"Unconstrained: No principals, so valid for any user or host",
+		"Weak key: RSA 1024",
+	}
+	if problems := AnalyzeSSHCertificate(entries[3].Cert, at); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+}
@@ -0,0 +1,131 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// sstMagic begins a Windows serialized certificate store: a zero version and
+// "CERT".
+var sstMagic = []byte{0, 0, 0, 0, 'C', 'E', 'R', 'T'}
+
+// The serialized store elements and certificate properties read from SST
+// files.
+const (
+	sstEnhancedKeyUsage = 9
+	sstFriendlyName     = 11
+	sstCertificate      = 32
+	sstCRL              = 33
+	sstCTL              = 34
+)
+
+// sstTrust maps the extended key usages a store can restrict a root to onto
+// trust bits.
+var sstTrust = []struct {
+	oid   asn1.ObjectIdentifier
+	trust TrustBits
+}{
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, TrustServerAuth},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, TrustCodeSigning},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, TrustEmailProtection},
+}
+
+// IsSST reports whether data is a Windows serialized certificate store, as
+// certmgr and Export-Certificate -Type SST write.
+func IsSST(data []byte) bool {
+	return bytes.HasPrefix(data, sstMagic)
+}
+
+// ParseSST reads the certificates in a Windows serialized certificate store.
+// Each is labelled with its friendly name if the store gives one, and
+// trusted for the purposes the store limits it to, or for everything if it
+// does not. CRLs and CTLs in the store are skipped.
+func ParseSST(data []byte) ([]TrustedRoot, error) {
+	if !IsSST(data) {
+		return nil, fmt.Errorf("Not a serialized certificate store")
+	}
+	data = data[len(sstMagic):]
+
+	var roots []TrustedRoot
+	properties := make(map[uint32][]byte)
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, fmt.Errorf("Truncated store element")
+		}
+		id, length := binary.LittleEndian.Uint32(data), binary.LittleEndian.Uint32(data[8:])
+		data = data[12:]
+		if id == 0 && length == 0 {
+			break
+		}
+		if uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("Store element %d overruns the file", id)
+		}
+		value := data[:length]
+		data = data[length:]
+
+		switch id {
+		case sstCertificate:
+			cert, err := x509.ParseCertificate(value)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse certificate %d: %s", len(roots)+1, err)
+			}
+			root, err := sstRoot(cert, properties)
+			if err != nil {
+				return nil, fmt.Errorf("Certificate %d: %s", len(roots)+1, err)
+			}
+			roots = append(roots, root)
+			properties = make(map[uint32][]byte)
+		case sstCRL, sstCTL:
+			properties = make(map[uint32][]byte)
+		default:
+			// Properties come before the certificate they belong to
+			properties[id] = value
+		}
+	}
+	return roots, nil
+}
+
+// sstRoot labels and trusts cert according to its properties.
+func sstRoot(cert *x509.Certificate, properties map[uint32][]byte) (TrustedRoot, error) {
+	root := TrustedRoot{Cert: cert, Trust: TrustAll}
+
+	if name := properties[sstFriendlyName]; len(name) >= 2 {
+		units := make([]uint16, len(name)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(name[2*i:])
+		}
+		root.Label = strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	if len(root.Label) == 0 {
+		root.Label = cert.Subject.CommonName
+	}
+	if len(root.Label) == 0 {
+		root.Label = fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	}
+
+	if usage, ok := properties[sstEnhancedKeyUsage]; ok {
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(usage, &oids); err != nil || len(rest) > 0 {
+			return root, fmt.Errorf("Invalid enhanced key usage property")
+		}
+		root.Trust = 0
+		for _, oid := range oids {
+			for _, entry := range sstTrust {
+				if oid.Equal(entry.oid) {
+					root.Trust |= entry.trust
+				}
+			}
+		}
+	}
+	return root, nil
+}
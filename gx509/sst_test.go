@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func sstElement(id uint32, value []byte) []byte {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint32(header, id)
+	binary.LittleEndian.PutUint32(header[4:], 1)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(value)))
+	return append(header, value...)
+}
+
+func TestParseSST(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	var name []byte
+	for _, unit := range utf16.Encode([]rune("Acme Root\x00")) {
+		name = binary.LittleEndian.AppendUint16(name, unit)
+	}
+	usage, _ := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 1}, {1, 3, 6, 1, 5, 5, 7, 3, 2}})
+
+	store := bytes.Join([][]byte{
+		sstMagic,
+		sstElement(sstFriendlyName, name),
+		sstElement(sstEnhancedKeyUsage, usage),
+		sstElement(sstCertificate, chain[2].Raw),
+		sstElement(sstCTL, []byte{0x30, 0}),
+		sstElement(sstCertificate, chain[1].Raw),
+		sstElement(0, nil),
+	}, nil)
+	if !IsSST(store) || IsSST(chain[0].Raw) {
+		t.Errorf("Expected only the store to be detected as SST")
+	}
+
+	roots, err := ParseSST(store)
+	if err != nil {
+		t.Fatalf("Could not parse store: %s", err)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d", len(roots))
+	}
+	if roots[0].Label != "Acme Root" || roots[0].Trust != TrustServerAuth || !roots[0].Cert.Equal(chain[2]) {
+		t.Errorf("Unexpected first root %s with trust %s", roots[0].Label, roots[0].Trust)
+	}
+	if roots[1].Label != "Σ Acme Co Issuing CA" || roots[1].Trust != TrustAll || !roots[1].Cert.Equal(chain[1]) {
+		t.Errorf("Unexpected second root %s with trust %s", roots[1].Label, roots[1].Trust)
+	}
+}
+
+func TestParseSSTInvalid(t *testing.T) {
+	t.Parallel()
+
+	root := testChain(t, "www.example.com")[2]
+	for expected, elements := range map[string][]byte{
+		"Truncated":          {1, 2, 3},
+		"overruns":           sstElement(sstCertificate, []byte{0x30})[:12],
+		"Could not parse":    sstElement(sstCertificate, []byte{0x30, 0}),
+		"enhanced key usage": append(sstElement(sstEnhancedKeyUsage, []byte{1}), sstElement(sstCertificate, root.Raw)...),
+	} {
+		store := append(append([]byte{}, sstMagic...), elements...)
+		if _, err := ParseSST(store); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, err)
+		}
+	}
+	if _, err := ParseSST(root.Raw); err == nil {
+		t.Errorf("Expected an error for a certificate that is not a store")
+	}
+}
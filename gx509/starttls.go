@@ -0,0 +1,331 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// StartTLSProtocols are the protocols ScanTLS can negotiate STARTTLS in.
+var StartTLSProtocols = []string{"smtp", "imap", "pop3", "ftp", "ldap", "xmpp"}
+
+// startTLSUpgraders negotiate STARTTLS on a plaintext connection, leaving it
+// ready for the client's TLS handshake.
+var startTLSUpgraders = map[string]func(conn net.Conn, r *bufio.Reader, serverName string) error{
+	"smtp": startTLSSMTP,
+	"imap": startTLSIMAP,
+	"pop3": startTLSPOP3,
+	"ftp":  startTLSFTP,
+	"ldap": startTLSLDAP,
+	"xmpp": startTLSXMPP,
+}
+
+// startTLS negotiates STARTTLS in protocol on conn, announcing serverName
+// where the protocol calls for it.
+func startTLS(conn net.Conn, protocol, serverName string) error {
+	upgrade, ok := startTLSUpgraders[protocol]
+	if !ok {
+		return fmt.Errorf("Unknown STARTTLS protocol %q; use one of %s", protocol, strings.Join(StartTLSProtocols, ", "))
+	}
+	r := bufio.NewReader(conn)
+	if err := upgrade(conn, r, serverName); err != nil {
+		return err
+	}
+	// The server must wait for the ClientHello, so anything more is a
+	// protocol error that would corrupt the handshake
+	if r.Buffered() > 0 {
+		return fmt.Errorf("Server sent data after agreeing to STARTTLS")
+	}
+	return nil
+}
+
+// readReply reads a reply in the style of SMTP and FTP, where each line
+// starts with a three-digit code and all but the last have a hyphen after
+// it, and returns the code and the text of its lines.
+func readReply(r *bufio.Reader) (string, []string, error) {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 3 {
+			return "", nil, fmt.Errorf("Malformed reply %q", line)
+		}
+		lines = append(lines, strings.TrimSpace(line[3:]))
+		if len(line) == 3 || line[3] != '-' {
+			return line[:3], lines, nil
+		}
+	}
+}
+
+// startTLSCommand sends line and reads the reply, which must have code want.
+func startTLSCommand(conn net.Conn, r *bufio.Reader, line, want string) ([]string, error) {
+	if _, err := fmt.Fprintf(conn, "%s\r\n", line); err != nil {
+		return nil, err
+	}
+	code, lines, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+	if code != want {
+		return nil, fmt.Errorf("Server answered %s with %s %s", line, code, strings.Join(lines, " "))
+	}
+	return lines, nil
+}
+
+func startTLSSMTP(conn net.Conn, r *bufio.Reader, serverName string) error {
+	if code, lines, err := readReply(r); err != nil {
+		return err
+	} else if code != "220" {
+		return fmt.Errorf("Server greeted with %s %s", code, strings.Join(lines, " "))
+	}
+	capabilities, err := startTLSCommand(conn, r, "EHLO gx509", "250")
+	if err != nil {
+		return err
+	}
+	offered := false
+	for _, capability := range capabilities {
+		offered = offered || strings.EqualFold(capability, "STARTTLS")
+	}
+	if !offered {
+		return fmt.Errorf("Server does not offer STARTTLS")
+	}
+	_, err = startTLSCommand(conn, r, "STARTTLS", "220")
+	return err
+}
+
+func startTLSFTP(conn net.Conn, r *bufio.Reader, serverName string) error {
+	if code, lines, err := readReply(r); err != nil {
+		return err
+	} else if code != "220" {
+		return fmt.Errorf("Server greeted with %s %s", code, strings.Join(lines, " "))
+	}
+	_, err := startTLSCommand(conn, r, "AUTH TLS", "234")
+	return err
+}
+
+// readLine reads a line of a text protocol, without its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func startTLSIMAP(conn net.Conn, r *bufio.Reader, serverName string) error {
+	greeting, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("Server greeted with %q", greeting)
+	}
+	if _, err := fmt.Fprintf(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	// Untagged responses may come before the tagged one
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			if !strings.HasPrefix(line, "a1 OK") {
+				return fmt.Errorf("Server answered STARTTLS with %q", line)
+			}
+			return nil
+		}
+	}
+}
+
+func startTLSPOP3(conn net.Conn, r *bufio.Reader, serverName string) error {
+	greeting, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("Server greeted with %q", greeting)
+	}
+	if _, err := fmt.Fprintf(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("Server answered STLS with %q", line)
+	}
+	return nil
+}
+
+// ldapStartTLSOID is the name of the LDAP StartTLS extended operation, from
+// RFC 4511, section 4.14.
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ldapExtendedRequest and ldapExtendedResponse are the BER tags of the LDAP
+// ExtendedRequest and ExtendedResponse protocol operations.
+const (
+	ldapExtendedRequest  = 23
+	ldapExtendedResponse = 24
+)
+
+func startTLSLDAP(conn net.Conn, r *bufio.Reader, serverName string) error {
+	// LDAPMessage ::= SEQUENCE { messageID, ExtendedRequest { [0] requestName } }
+	requestName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte(ldapStartTLSOID)})
+	if err != nil {
+		return err
+	}
+	request, err := asn1.Marshal(struct {
+		MessageID int
+		Operation asn1.RawValue
+	}{1, asn1.RawValue{Class: asn1.ClassApplication, Tag: ldapExtendedRequest, IsCompound: true, Bytes: requestName}})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	message, err := readBERElement(r)
+	if err != nil {
+		return err
+	}
+	// Servers such as Active Directory encode lengths in long form where DER
+	// would not, which encoding/asn1 rejects, so walk the BER by hand
+	_, message, _, err = splitBER(message)
+	if err != nil {
+		return err
+	}
+	_, _, message, err = splitBER(message) // messageID
+	if err != nil {
+		return err
+	}
+	tag, operation, _, err := splitBER(message)
+	if err != nil {
+		return err
+	}
+	if tag != 0x60|ldapExtendedResponse {
+		return fmt.Errorf("Server answered StartTLS with LDAP operation 0x%02x", tag)
+	}
+	tag, resultCode, _, err := splitBER(operation)
+	if err != nil {
+		return err
+	}
+	if tag != asn1.TagEnum || len(resultCode) != 1 {
+		return fmt.Errorf("Could not decode LDAP result code")
+	}
+	if resultCode[0] != 0 {
+		return fmt.Errorf("Server refused StartTLS with LDAP result code %d", resultCode[0])
+	}
+	return nil
+}
+
+// splitBER splits the first BER element, of a low tag number and definite
+// length, from data, returning its tag, its contents and what follows it.
+func splitBER(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("Truncated BER element")
+	}
+	tag, length, data := data[0], int(data[1]), data[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(data) < n {
+			return 0, nil, nil, fmt.Errorf("Unsupported BER length")
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if len(data) < length {
+		return 0, nil, nil, fmt.Errorf("Truncated BER element")
+	}
+	return tag, data[:length], data[length:], nil
+}
+
+// maxStartTLSResponse is the longest response to STARTTLS negotiation read.
+const maxStartTLSResponse = 1 << 16
+
+// readBERElement reads one BER element with a definite length from r.
+func readBERElement(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		lengthBytes := make([]byte, length&0x7f)
+		if len(lengthBytes) == 0 || len(lengthBytes) > 3 {
+			return nil, fmt.Errorf("Unsupported BER length")
+		}
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxStartTLSResponse {
+		return nil, fmt.Errorf("LDAP message of %d bytes is too long", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// readUntil reads from r until it has read marker, returning everything
+// read.
+func readUntil(r *bufio.Reader, marker string) (string, error) {
+	var read bytes.Buffer
+	for !bytes.HasSuffix(read.Bytes(), []byte(marker)) {
+		if read.Len() > maxStartTLSResponse {
+			return "", fmt.Errorf("Server did not send %s", marker)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		read.WriteByte(b)
+	}
+	return read.String(), nil
+}
+
+func startTLSXMPP(conn net.Conn, r *bufio.Reader, serverName string) error {
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' to='%s' version='1.0'>", serverName)
+	if err != nil {
+		return err
+	}
+	features, err := readUntil(r, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "urn:ietf:params:xml:ns:xmpp-tls") {
+		return fmt.Errorf("Server does not offer STARTTLS")
+	}
+	if _, err := fmt.Fprintf(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	answer, err := readUntil(r, "/>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(answer, "<proceed") {
+		return fmt.Errorf("Server answered STARTTLS with %q", strings.TrimSpace(answer))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTLSServer serves one connection, on which it follows script then,
+// if script agrees to STARTTLS, completes a TLS handshake presenting cert.
+func startTLSServer(t *testing.T, cert tls.Certificate, script func(conn net.Conn, r *bufio.Reader) bool) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if script(conn, bufio.NewReader(conn)) {
+			tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestScanTLSStartTLS(t *testing.T) {
+	t.Parallel()
+
+	key, _ := testECKey(t)
+	leaf := certifyKey(t, "mail.example.com", &key.PublicKey)
+	cert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key}
+
+	scripts := map[string]func(conn net.Conn, r *bufio.Reader) bool{
+		"smtp": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "220 mail.example.com ESMTP\r\n")
+			if line, _ := r.ReadString('\n'); line != "EHLO gx509\r\n" {
+				return false
+			}
+			fmt.Fprintf(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+			r.ReadString('\n')
+			fmt.Fprintf(conn, "220 Go ahead\r\n")
+			return true
+		},
+		"imap": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "* OK IMAP4rev1 ready\r\n")
+			if line, _ := r.ReadString('\n'); line != "a1 STARTTLS\r\n" {
+				return false
+			}
+			fmt.Fprintf(conn, "* CAPABILITY IMAP4rev1\r\na1 OK Begin TLS negotiation now\r\n")
+			return true
+		},
+		"pop3": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "+OK POP3 ready\r\n")
+			if line, _ := r.ReadString('\n'); line != "STLS\r\n" {
+				return false
+			}
+			fmt.Fprintf(conn, "+OK Begin TLS negotiation\r\n")
+			return true
+		},
+		"ftp": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "220-Welcome\r\n220 FTP ready\r\n")
+			if line, _ := r.ReadString('\n'); line != "AUTH TLS\r\n" {
+				return false
+			}
+			fmt.Fprintf(conn, "234 Proceed with negotiation\r\n")
+			return true
+		},
+		"ldap": func(conn net.Conn, r *bufio.Reader) bool {
+			if request, err := readBERElement(r); err != nil || !strings.Contains(string(request), ldapStartTLSOID) {
+				return false
+			}
+			// A successful ExtendedResponse, with a needless long-form length
+			conn.Write([]byte{0x30, 0x81, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+			return true
+		},
+		"xmpp": func(conn net.Conn, r *bufio.Reader) bool {
+			if header, err := readUntil(r, "version='1.0'>"); err != nil || !strings.Contains(header, "to='mail.example.com'") {
+				return false
+			}
+			fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream from='mail.example.com' version='1.0'>"+
+				"<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+			readUntil(r, "/>")
+			fmt.Fprintf(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+			return true
+		},
+	}
+	if len(scripts) != len(StartTLSProtocols) {
+		t.Errorf("Expected a script for each of %s", StartTLSProtocols)
+	}
+	for protocol, script := range scripts {
+		address := startTLSServer(t, cert, script)
+		scan, err := ScanTLS(address, TLSScanOptions{ServerName: "mail.example.com", StartTLS: protocol, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Errorf("Could not scan %s: %s", protocol, err)
+			continue
+		}
+		if scan.StartTLS != protocol || len(scan.Certificates) != 1 || !scan.Certificates[0].Equal(leaf) {
+			t.Errorf("Unexpected %s scan %+v", protocol, scan)
+		}
+	}
+
+	refusals := map[string]func(conn net.Conn, r *bufio.Reader) bool{
+		"smtp": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "220 mail.example.com ESMTP\r\n")
+			r.ReadString('\n')
+			fmt.Fprintf(conn, "250-mail.example.com\r\n250 PIPELINING\r\n")
+			r.ReadString('\n')
+			return false
+		},
+		"pop3": func(conn net.Conn, r *bufio.Reader) bool {
+			fmt.Fprintf(conn, "+OK POP3 ready\r\n")
+			r.ReadString('\n')
+			fmt.Fprintf(conn, "-ERR Command not permitted\r\n")
+			return false
+		},
+		"ldap": func(conn net.Conn, r *bufio.Reader) bool {
+			readBERElement(r)
+			// protocolError
+			conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+			return false
+		},
+		"nntp": func(conn net.Conn, r *bufio.Reader) bool {
+			return false
+		},
+	}
+	for protocol, script := range refusals {
+		address := startTLSServer(t, cert, script)
+		if _, err := ScanTLS(address, TLSScanOptions{StartTLS: protocol, Timeout: 5 * time.Second}); err == nil {
+			t.Errorf("Expected an error negotiating STARTTLS with a refusing %s server", protocol)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// stepCADefaultMaxTLSCertDuration is how long step-ca lets certificates last
+// when no claim says otherwise.
+const stepCADefaultMaxTLSCertDuration = 24 * time.Hour
+
+type stepCAClaims struct {
+	MaxTLSCertDuration string `json:"maxTLSCertDuration"`
+}
+
+type stepCAPolicy struct {
+	X509 *struct {
+		Allow struct {
+			DNS []string `json:"dns"`
+			IP  []string `json:"ip"`
+		} `json:"allow"`
+	} `json:"x509"`
+}
+
+type stepCAConfigJSON struct {
+	// Root is a path, or a list of them
+	Root      json.RawMessage `json:"root"`
+	Crt       string          `json:"crt"`
+	Authority struct {
+		Claims       *stepCAClaims `json:"claims"`
+		Policy       *stepCAPolicy `json:"policy"`
+		Provisioners []struct {
+			Type    string        `json:"type"`
+			Name    string        `json:"name"`
+			Claims  *stepCAClaims `json:"claims"`
+			Policy  *stepCAPolicy `json:"policy"`
+			Options struct {
+				X509 struct {
+					Template     string `json:"template"`
+					TemplateFile string `json:"templateFile"`
+				} `json:"x509"`
+			} `json:"options"`
+		} `json:"provisioners"`
+	} `json:"authority"`
+}
+
+// A StepCAProvisioner is a provisioner of a step-ca authority, which issues
+// certificates to the clients it authenticates.
+type StepCAProvisioner struct {
+	Type string
+	Name string
+	// Template is the X.509 template, if it is inline; TemplateFile is the
+	// path to it otherwise, which the caller reads into Template.
+	Template     string
+	TemplateFile string
+	// AllowedDNSNames and AllowedIPs are the names the provisioner's x509
+	// policy allows, or the authority's if it has none of its own.
+	// HasPolicy is false if neither has an x509 policy.
+	AllowedDNSNames []string
+	AllowedIPs      []string
+	HasPolicy       bool
+	// MaxTLSCertDuration is the longest lifetime the provisioner issues for.
+	MaxTLSCertDuration time.Duration
+}
+
+// A StepCAConfig is the parts of a step-ca ca.json that decide what it can
+// issue.
+type StepCAConfig struct {
+	// Roots and Intermediate are the paths of the authority's certificates,
+	// as written in the configuration.
+	Roots        []string
+	Intermediate string
+	Provisioners []StepCAProvisioner
+}
+
+// ParseStepCAConfig decodes a step-ca ca.json.
+func ParseStepCAConfig(data []byte) (*StepCAConfig, error) {
+	var raw stepCAConfigJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Could not decode step-ca configuration: %s", err)
+	}
+
+	config := &StepCAConfig{Intermediate: raw.Crt}
+	if len(raw.Root) > 0 {
+		var root string
+		if err := json.Unmarshal(raw.Root, &root); err == nil {
+			config.Roots = []string{root}
+		} else if err := json.Unmarshal(raw.Root, &config.Roots); err != nil {
+			return nil, fmt.Errorf("Could not decode root: %s", err)
+		}
+	}
+
+	maxDuration := stepCADefaultMaxTLSCertDuration
+	if claims := raw.Authority.Claims; claims != nil && len(claims.MaxTLSCertDuration) > 0 {
+		var err error
+		if maxDuration, err = time.ParseDuration(claims.MaxTLSCertDuration); err != nil {
+			return nil, fmt.Errorf("Invalid maxTLSCertDuration: %s", err)
+		}
+	}
+
+	for _, entry := range raw.Authority.Provisioners {
+		provisioner := StepCAProvisioner{
+			Type:               entry.Type,
+			Name:               entry.Name,
+			Template:           entry.Options.X509.Template,
+			TemplateFile:       entry.Options.X509.TemplateFile,
+			MaxTLSCertDuration: maxDuration,
+		}
+		if entry.Claims != nil && len(entry.Claims.MaxTLSCertDuration) > 0 {
+			var err error
+			if provisioner.MaxTLSCertDuration, err = time.ParseDuration(entry.Claims.MaxTLSCertDuration); err != nil {
+				return nil, fmt.Errorf("Provisioner %s has an invalid maxTLSCertDuration: %s", entry.Name, err)
+			}
+		}
+		policy := entry.Policy
+		if policy == nil || policy.X509 == nil {
+			policy = raw.Authority.Policy
+		}
+		if policy != nil && policy.X509 != nil {
+			provisioner.HasPolicy = true
+			provisioner.AllowedDNSNames = policy.X509.Allow.DNS
+			provisioner.AllowedIPs = policy.X509.Allow.IP
+		}
+		config.Provisioners = append(config.Provisioners, provisioner)
+	}
+	return config, nil
+}
+
+var (
+	// stepCATemplateCA matches templates that issue CA certificates.
+	stepCATemplateCA = regexp.MustCompile(`"isCA"\s*:\s*true`)
+	// stepCATemplateInsecure matches templates that use the unvalidated
+	// .Insecure variables, which hold whatever the client sent.
+	stepCATemplateInsecure = regexp.MustCompile(`\.Insecure\.`)
+)
+
+// AuditStepCAProvisioner returns the ways certificates the provisioner issues
+// from intermediate, which may be nil, could fall outside the intermediate's
+// name constraints or browser requirements.
+func AuditStepCAProvisioner(provisioner StepCAProvisioner, intermediate *x509.Certificate) []string {
+	var problems []string
+	if !provisioner.HasPolicy {
+		problems = append(problems, "no x509 policy, so it can issue for any name")
+	}
+	if intermediate != nil {
+		for _, name := range provisioner.AllowedDNSNames {
+			if !dnsNamePermitted(intermediate, strings.TrimPrefix(name, "*."), false) {
+				problems = append(problems, fmt.Sprintf("policy allows %s, outside the intermediate's name constraints", name))
+			}
+		}
+		for _, allowed := range provisioner.AllowedIPs {
+			ip, _, err := net.ParseCIDR(allowed)
+			if err != nil {
+				ip = net.ParseIP(allowed)
+			}
+			if ip != nil && !ipAddressPermitted(intermediate, ip) {
+				problems = append(problems, fmt.Sprintf("policy allows %s, outside the intermediate's name constraints", allowed))
+			}
+		}
+	}
+	if stepCATemplateCA.MatchString(provisioner.Template) {
+		problems = append(problems, "its template issues CA certificates")
+	}
+	if stepCATemplateInsecure.MatchString(provisioner.Template) {
+		problems = append(problems, "its template uses .Insecure values the client controls")
+	}
+	if provisioner.MaxTLSCertDuration > maxServerLeafLifetime {
+		problems = append(problems, fmt.Sprintf("maxTLSCertDuration of %d days exceeds the %d day limit for TLS server certificates",
+			int(provisioner.MaxTLSCertDuration/(24*time.Hour)), int(maxServerLeafLifetime/(24*time.Hour))))
+	}
+	return problems
+}
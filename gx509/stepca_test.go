@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testStepCAConfig = `{
+	"root": "/home/step/certs/root_ca.crt",
+	"crt": "/home/step/certs/intermediate_ca.crt",
+	"authority": {
+		"claims": {"maxTLSCertDuration": "720h"},
+		"policy": {"x509": {"allow": {"dns": ["*.example.com"]}}},
+		"provisioners": [
+			{"type": "ACME", "name": "acme"},
+			{
+				"type": "JWK",
+				"name": "admin",
+				"claims": {"maxTLSCertDuration": "17520h"},
+				"policy": {"x509": {"allow": {"dns": ["*.example.net"], "ip": ["10.0.0.0/8"]}}},
+				"options": {"x509": {"template": "{\"subject\": {{ toJson .Insecure.CR.Subject }}, \"basicConstraints\": {\"isCA\": true}}"}}
+			},
+			{
+				"type": "OIDC",
+				"name": "sso",
+				"options": {"x509": {"templateFile": "templates/x509/leaf.tpl"}}
+			}
+		]
+	}
+}`
+
+func TestParseStepCAConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParseStepCAConfig([]byte(testStepCAConfig))
+	if err != nil {
+		t.Fatalf("Could not parse configuration: %s", err)
+	}
+	if !reflect.DeepEqual(config.Roots, []string{"/home/step/certs/root_ca.crt"}) || config.Intermediate != "/home/step/certs/intermediate_ca.crt" {
+		t.Errorf("Wrong certificate paths: %v %s", config.Roots, config.Intermediate)
+	}
+	if len(config.Provisioners) != 3 {
+		t.Fatalf("Expected 3 provisioners, got %d", len(config.Provisioners))
+	}
+
+	acme := config.Provisioners[0]
+	if !acme.HasPolicy || !reflect.DeepEqual(acme.AllowedDNSNames, []string{"*.example.com"}) || acme.MaxTLSCertDuration != 720*time.Hour {
+		t.Errorf("acme should inherit the authority's policy and claims: %+v", acme)
+	}
+	admin := config.Provisioners[1]
+	if !reflect.DeepEqual(admin.AllowedDNSNames, []string{"*.example.net"}) || admin.MaxTLSCertDuration != 17520*time.Hour {
+		t.Errorf("admin should use its own policy and claims: %+v", admin)
+	}
+	if sso := config.Provisioners[2]; sso.TemplateFile != "templates/x509/leaf.tpl" {
+		t.Errorf("Wrong template file %q", sso.TemplateFile)
+	}
+
+	config, err = ParseStepCAConfig([]byte(`{"root": ["a.crt", "b.crt"], "authority": {"provisioners": [{"name": "p"}]}}`))
+	if err != nil {
+		t.Fatalf("Could not parse configuration: %s", err)
+	}
+	if !reflect.DeepEqual(config.Roots, []string{"a.crt", "b.crt"}) {
+		t.Errorf("Wrong roots %v", config.Roots)
+	}
+	if p := config.Provisioners[0]; p.HasPolicy || p.MaxTLSCertDuration != stepCADefaultMaxTLSCertDuration {
+		t.Errorf("Expected step-ca defaults: %+v", p)
+	}
+
+	if _, err := ParseStepCAConfig([]byte(`{"authority": {"claims": {"maxTLSCertDuration": "forever"}}}`)); err == nil {
+		t.Errorf("Expected an error for an invalid duration")
+	}
+}
+
+func TestAuditStepCAProvisioner(t *testing.T) {
+	t.Parallel()
+
+	intermediate := testChain(t, "www.example.com")[1]
+	config, err := ParseStepCAConfig([]byte(testStepCAConfig))
+	if err != nil {
+		t.Fatalf("Could not parse configuration: %s", err)
+	}
+
+	if problems := AuditStepCAProvisioner(config.Provisioners[0], intermediate); len(problems) != 0 {
+		t.Errorf("acme should have no problems, got %v", problems)
+	}
+
+	expected := []string{
+		"policy allows *.example.net, outside the intermediate's name constraints",
+		"its template issues CA certificates",
+		"its template uses .Insecure values the client controls",
+		"maxTLSCertDuration of 730 days exceeds the 398 day limit for TLS server certificates",
+	}
+	if problems := AuditStepCAProvisioner(config.Provisioners[1], intermediate); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Expected %v, got %v", expected, problems)
+	}
+
+	unconstrained := StepCAProvisioner{Name: "open", MaxTLSCertDuration: time.Hour}
+	expected = []string{"no x509 policy, so it can issue for any name"}
+	if problems := AuditStepCAProvisioner(unconstrained, nil); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Expected %v, got %v", expected, problems)
+	}
+}
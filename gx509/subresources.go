@@ -0,0 +1,248 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ServerChain is the certificate chain a TLS server presented.
+type ServerChain struct {
+	// Address is the host and port connected to.
+	Address      string
+	Certificates []*x509.Certificate
+	// Err is set if the chain could not be fetched.
+	Err error
+}
+
+// FetchServerChain connects to the TLS server at address, a host and port,
+// and returns the certificates it presents. The chain is not verified.
+func FetchServerChain(address string, timeout time.Duration) ([]*x509.Certificate, error) {
+	scan, err := ScanTLS(address, TLSScanOptions{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	return scan.Certificates, nil
+}
+
+// HostAddress returns the host and port to connect to for s, which is an
+// HTTPS URL, a host, or a host and port. Port 443 is the default. It returns
+// false for URLs of other schemes.
+func HostAddress(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		parsed, err := url.Parse(s)
+		if err != nil || !strings.EqualFold(parsed.Scheme, "https") && !strings.EqualFold(parsed.Scheme, "wss") {
+			return "", false
+		}
+		s = parsed.Host
+	}
+	if len(s) == 0 {
+		return "", false
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), "443"
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil || len(host) == 0 || strings.ContainsAny(host, "/ \t;,") {
+		return "", false
+	}
+	return net.JoinHostPort(strings.ToLower(host), port), true
+}
+
+// CIDRExpansion permits a host list to include CIDR ranges, which expand to
+// each address in the range on each of Ports.
+type CIDRExpansion struct {
+	Ports []string
+	// Max is the most addresses the ranges may expand to in total.
+	Max int
+}
+
+// expand returns the addresses in cidr on each port, leaving out the network
+// and broadcast addresses of IPv4 ranges wider than /31. total counts the
+// addresses expanded so far.
+func (e *CIDRExpansion) expand(cidr string, total *int) ([]string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones > 24 || *total+len(e.Ports)<<uint(bits-ones) > e.Max {
+		return nil, fmt.Errorf("%s expands past the limit of %d addresses", cidr, e.Max)
+	}
+
+	var addresses []string
+	ip := append(net.IP{}, network.IP...)
+	for ; network.Contains(ip); incrementIP(ip) {
+		if bits == 32 && bits-ones > 1 {
+			if ip.Equal(network.IP) || !network.Contains(nextIP(ip)) {
+				continue
+			}
+		}
+		for _, port := range e.Ports {
+			addresses = append(addresses, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	*total += len(addresses)
+	return addresses, nil
+}
+
+func incrementIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		if ip[i]++; ip[i] != 0 {
+			return
+		}
+	}
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	incrementIP(next)
+	return next
+}
+
+// ParseHostList reads hosts to connect to, one per line, as accepted by
+// HostAddress. Blank lines and lines starting with # are ignored, as are
+// duplicates. CIDR ranges are only permitted with an expansion.
+func ParseHostList(r io.Reader, ranges *CIDRExpansion) ([]string, error) {
+	var addresses []string
+	seen := make(map[string]bool)
+	expanded := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var found []string
+		if prefix, _, ok := strings.Cut(text, "/"); ok && net.ParseIP(prefix) != nil {
+			if ranges == nil {
+				return nil, fmt.Errorf("Line %d: CIDR ranges are not permitted: %s", line, text)
+			}
+			var err error
+			if found, err = ranges.expand(text, &expanded); err != nil {
+				return nil, fmt.Errorf("Line %d: %s", line, err)
+			}
+		} else {
+			address, ok := HostAddress(text)
+			if !ok {
+				return nil, fmt.Errorf("Line %d: not an HTTPS URL or host: %s", line, text)
+			}
+			found = []string{address}
+		}
+
+		for _, address := range found {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, scanner.Err()
+}
+
+// ParseHAR reads the distinct hosts of the HTTPS requests in a HAR file, in
+// the order they were first requested.
+func ParseHAR(data []byte) ([]string, error) {
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("Could not decode HAR: %s", err)
+	}
+
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, entry := range har.Log.Entries {
+		if !strings.Contains(entry.Request.URL, "://") {
+			continue
+		}
+		if address, ok := HostAddress(entry.Request.URL); ok && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+// A CAExposure is an issuing CA and the hosts whose certificates it issued.
+type CAExposure struct {
+	// Issuer is nil if no host presented the issuing CA's certificate, in
+	// which case only its name is known.
+	Issuer     *x509.Certificate
+	IssuerName string
+	Owner      string
+	// Constrained is set if Issuer is technically constrained, as
+	// explained by Reason.
+	Constrained bool
+	Reason      string
+	Addresses   []string
+}
+
+// SummarizeCAExposure groups servers by the CA that issued their
+// certificates, most hosts first, so that a site's reliance on CAs outside
+// its own constrained intermediates stands out.
+func SummarizeCAExposure(servers []ServerChain, owners *OwnerTable) []CAExposure {
+	index := make(map[string]int)
+	var exposures []CAExposure
+	for _, server := range servers {
+		if len(server.Certificates) == 0 {
+			continue
+		}
+		leaf := server.Certificates[0]
+
+		var issuer *x509.Certificate
+		if issuers := FindIssuers(leaf, server.Certificates[1:]); len(issuers) > 0 {
+			issuer = issuers[0]
+		}
+		key := "name:" + string(leaf.RawIssuer)
+		if issuer != nil {
+			key = fmt.Sprintf("spki:%x", SubjectSPKIHash(issuer))
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(exposures)
+			index[key] = i
+			exposure := CAExposure{Issuer: issuer, IssuerName: leaf.Issuer.CommonName}
+			if issuer != nil {
+				exposure.Owner, _ = owners.Owner(issuer)
+				analysis := AnalyzeTechnicalConstraints(issuer)
+				exposure.Constrained, exposure.Reason = analysis.Constrained, analysis.Details()
+			} else {
+				exposure.Owner, _ = owners.IssuerOwner(leaf)
+				exposure.Reason = "Issuer certificate not presented"
+			}
+			if len(exposure.Owner) == 0 {
+				_, exposure.Owner = issuerOrganizationKey(leaf)
+			}
+			exposures = append(exposures, exposure)
+		}
+		exposures[i].Addresses = append(exposures[i].Addresses, server.Address)
+	}
+
+	sort.SliceStable(exposures, func(i, j int) bool {
+		return len(exposures[i].Addresses) > len(exposures[j].Addresses)
+	})
+	return exposures
+}
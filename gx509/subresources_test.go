@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostAddress(t *testing.T) {
+	t.Parallel()
+
+	for input, expected := range map[string]string{
+		"https://CDN.example.com/app.js?v=1": "cdn.example.com:443",
+		"https://example.com:8443/":          "example.com:8443",
+		"wss://socket.example.com/live":      "socket.example.com:443",
+		"static.example.com":                 "static.example.com:443",
+		"static.example.com:444":             "static.example.com:444",
+		"[2001:db8::1]":                      "[2001:db8::1]:443",
+		"http://example.com/":                "",
+		"example.com:https":                  "",
+		"data:image/png;base64,AAAA":         "",
+	} {
+		address, ok := HostAddress(input)
+		if !ok {
+			address = ""
+		}
+		if address != expected {
+			t.Errorf("HostAddress(%q) = %q, expected %q", input, address, expected)
+		}
+	}
+}
+
+func TestParseHostList(t *testing.T) {
+	t.Parallel()
+
+	addresses, err := ParseHostList(strings.NewReader("# CDNs\ncdn.example.com\n\nhttps://cdn.example.com/lib.js\nfonts.example.net:8443\n"), nil)
+	if err != nil {
+		t.Fatalf("Could not parse host list: %s", err)
+	}
+	if !reflect.DeepEqual(addresses, []string{"cdn.example.com:443", "fonts.example.net:8443"}) {
+		t.Errorf("Unexpected addresses %v", addresses)
+	}
+
+	if _, err := ParseHostList(strings.NewReader("cdn.example.com\nhttp://insecure.example.com/\n"), nil); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("Expected an error for line 2, got %v", err)
+	}
+}
+
+func TestParseHostListRanges(t *testing.T) {
+	t.Parallel()
+
+	list := "10.0.0.0/30\n10.0.0.1\n2001:db8::/127\n# 192.168.0.0/16\n"
+	if _, err := ParseHostList(strings.NewReader(list), nil); err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Errorf("Expected CIDR ranges to need an expansion, got %v", err)
+	}
+
+	addresses, err := ParseHostList(strings.NewReader(list), &CIDRExpansion{Ports: []string{"443", "8443"}, Max: 16})
+	if err != nil {
+		t.Fatalf("Could not parse host list: %s", err)
+	}
+	expected := []string{
+		"10.0.0.1:443", "10.0.0.1:8443", "10.0.0.2:443", "10.0.0.2:8443",
+		"[2001:db8::]:443", "[2001:db8::]:8443", "[2001:db8::1]:443", "[2001:db8::1]:8443",
+	}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("Unexpected addresses %v", addresses)
+	}
+
+	if _, err := ParseHostList(strings.NewReader("10.0.0.0/24\n"), &CIDRExpansion{Ports: []string{"443"}, Max: 100}); err == nil {
+		t.Errorf("Expected an error for a range past the limit")
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	t.Parallel()
+
+	addresses, err := ParseHAR([]byte(`{"log": {"entries": [
+		{"request": {"url": "https://www.example.com/"}},
+		{"request": {"url": "https://cdn.example.com/app.js"}},
+		{"request": {"url": "http://tracker.example.org/pixel.gif"}},
+		{"request": {"url": "data:image/png;base64,AAAA"}},
+		{"request": {"url": "https://www.example.com/style.css"}}
+	]}}`))
+	if err != nil {
+		t.Fatalf("Could not parse HAR: %s", err)
+	}
+	if !reflect.DeepEqual(addresses, []string{"www.example.com:443", "cdn.example.com:443"}) {
+		t.Errorf("Unexpected addresses %v", addresses)
+	}
+
+	if _, err := ParseHAR([]byte("not json")); err == nil {
+		t.Errorf("Expected an error for a HAR that is not JSON")
+	}
+}
+
+func TestSummarizeCAExposure(t *testing.T) {
+	t.Parallel()
+
+	own := testChain(t, "www.example.com", "cdn.example.com")
+	otherCA := testCA(t, "Other Issuing CA", nil, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+	other := []*x509.Certificate{issueAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "fonts.example.net"},
+		NotBefore:    time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}, otherCA), otherCA}
+	orphan := testChain(t, "ads.example.org")
+	servers := []ServerChain{
+		{Address: "www.example.com:443", Certificates: own[:2]},
+		{Address: "fonts.example.net:443", Certificates: other[:2]},
+		{Address: "cdn.example.com:443", Certificates: own[:2]},
+		{Address: "ads.example.org:443", Certificates: orphan[:1]},
+		{Address: "down.example.com:443"},
+	}
+
+	exposures := SummarizeCAExposure(servers, DefaultOwnerTable)
+	if len(exposures) != 3 {
+		t.Fatalf("Expected 3 issuing CAs, got %d", len(exposures))
+	}
+	if !exposures[0].Issuer.Equal(own[1]) || exposures[0].Constrained || exposures[0].Owner != "Σ Acme Co Issuing CA" ||
+		!reflect.DeepEqual(exposures[0].Addresses, []string{"www.example.com:443", "cdn.example.com:443"}) {
+		t.Errorf("Unexpected first exposure: %+v", exposures[0])
+	}
+	if !exposures[1].Issuer.Equal(otherCA) || exposures[1].Constrained || exposures[1].Reason != "ExtKeyUsage is required" {
+		t.Errorf("Unexpected second exposure: %+v", exposures[1])
+	}
+	if exposures[2].Issuer != nil || exposures[2].IssuerName != "Σ Acme Co Issuing CA" ||
+		exposures[2].Constrained || exposures[2].Reason != "Issuer certificate not presented" {
+		t.Errorf("Unexpected exposure without an issuer: %+v", exposures[2])
+	}
+}
+
+func TestFetchServerChain(t *testing.T) {
+	t.Parallel()
+
+	key, _ := testECKey(t)
+	leaf := certifyKey(t, "localhost", &key.PublicKey)
+	intermediate := testChain(t, "www.example.com")[1]
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, intermediate.Raw}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	certs, err := FetchServerChain(listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Could not fetch chain: %s", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(leaf) || !certs[1].Equal(intermediate) {
+		t.Errorf("Unexpected chain of %d certificates", len(certs))
+	}
+}
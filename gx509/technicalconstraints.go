@@ -8,9 +8,15 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 )
 
+// For certificates with a notBefore before 23 August 2016, the
+// id-Netscape-stepUp OID (aka Netscape Server Gated Crypto ("nsSGC")) is
+// treated as equivalent to id-kp-serverAuth.
+var nsSGCCutoff = policyDates.cutoffs["nsSGC"]
+
 // True if all bytes in the slice are zero.
 func isAllZeros(buf []byte, length int) bool {
 	if length > len(buf) {
@@ -24,73 +30,279 @@ func isAllZeros(buf []byte, length int) bool {
 	return true
 }
 
-// A certificate is technically constrained if it has the extendedKeyUsage
-// extension that does not contain anyExtendedKeyUsage and either does not
-// contain the serverAuth extended key usage or has the nameConstraints
-// extension with both dNSName and iPAddress entries.
-func DetermineIfTechnicallyConstrained(cert *x509.Certificate) (bool, string) {
-	// There must be Extended Key Usage flags
-	if len(cert.ExtKeyUsage) == 0 {
-		return false, "ExtKeyUsage is required"
+// A PolicyVersion is the set of rules a certificate is judged by, which
+// depends on the Policy and when the certificate was issued.
+type PolicyVersion int
+
+const (
+	// PolicyStepUp applies where id-Netscape-stepUp counts as serverAuth,
+	// such as to certificates issued before nsSGCCutoff.
+	PolicyStepUp PolicyVersion = iota
+	// PolicyServerAuth applies where certificates are only for TLS servers
+	// if they have serverAuth.
+	PolicyServerAuth
+)
+
+func (v PolicyVersion) String() string {
+	switch v {
+	case PolicyStepUp:
+		return "stepUp"
+	case PolicyServerAuth:
+		return "serverAuth"
+	}
+	return fmt.Sprintf("PolicyVersion(%d)", int(v))
+}
+
+// A Reason is one of the findings a ConstraintAnalysis reached its verdict
+// from.
+type Reason int
+
+const (
+	// ReasonNoExtKeyUsage means the certificate has no extendedKeyUsage
+	// extension, so it can issue for any purpose.
+	ReasonNoExtKeyUsage Reason = iota
+	// ReasonAnyExtKeyUsage means the extendedKeyUsage extension contains
+	// anyExtendedKeyUsage.
+	ReasonAnyExtKeyUsage
+	// ReasonNotServerAuth means the certificate cannot issue for TLS servers
+	// or for email.
+	ReasonNotServerAuth
+	// ReasonNoDNSNameConstraint means there are no dNSName name constraints.
+	ReasonNoDNSNameConstraint
+	// ReasonNoIPAddressConstraint means there are no permitted iPAddress
+	// subtrees, nor excluded subtrees covering all of IPv4 and IPv6.
+	ReasonNoIPAddressConstraint
+	// ReasonNoEmailConstraint means the certificate can issue for email, but
+	// has no permitted rfc822Name subtrees.
+	ReasonNoEmailConstraint
+	// ReasonNoDirectoryNameConstraint means the certificate can issue for
+	// email, but has no permitted directoryName subtrees.
+	ReasonNoDirectoryNameConstraint
+	// ReasonNameConstrained means the names are constrained for every
+	// purpose the certificate can issue for.
+	ReasonNameConstrained
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonNoExtKeyUsage:
+		return "no-ext-key-usage"
+	case ReasonAnyExtKeyUsage:
+		return "any-ext-key-usage"
+	case ReasonNotServerAuth:
+		return "not-server-auth"
+	case ReasonNoDNSNameConstraint:
+		return "no-dns-name-constraint"
+	case ReasonNoIPAddressConstraint:
+		return "no-ip-address-constraint"
+	case ReasonNoEmailConstraint:
+		return "no-email-constraint"
+	case ReasonNoDirectoryNameConstraint:
+		return "no-directory-name-constraint"
+	case ReasonNameConstrained:
+		return "name-constrained"
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+// A ConstraintAnalysis is the outcome of AnalyzeTechnicalConstraints, with
+// each property of the certificate the verdict depends on.
+type ConstraintAnalysis struct {
+	Constrained bool
+	// Policy is the policy the certificate was judged by.
+	Policy Policy
+
+	HasExtKeyUsage    bool
+	HasAnyExtKeyUsage bool
+	HasServerAuth     bool
+	HasStepUp         bool
+	PolicyVersion     PolicyVersion
+	// HasEmailProtection is whether the certificate can issue for S/MIME,
+	// which may require rfc822Name and directoryName constraints rather than
+	// dNSName and iPAddress ones, depending on the policy.
+	HasEmailProtection bool
+
+	HasDNSNameConstraint       bool
+	HasPermittedIPAddresses    bool
+	ExcludesAllIPv4            bool
+	ExcludesAllIPv6            bool
+	HasEmailConstraint         bool
+	HasDirectoryNameConstraint bool
+
+	// Reasons are why the certificate is or is not constrained.
+	Reasons []Reason
+}
+
+// serverAuthCapable is whether the certificate can issue for TLS servers.
+func (a ConstraintAnalysis) serverAuthCapable() bool {
+	return a.HasServerAuth || (a.PolicyVersion == PolicyStepUp && a.HasStepUp)
+}
+
+// emailCapable is whether the certificate can issue for S/MIME, where the
+// policy constrains that.
+func (a ConstraintAnalysis) emailCapable() bool {
+	return a.HasEmailProtection && a.Policy.RequireEmailConstraints
+}
+
+// Details describes the analysis in the same words as
+// DetermineIfTechnicallyConstrained.
+func (a ConstraintAnalysis) Details() string {
+	if !a.HasExtKeyUsage {
+		return "ExtKeyUsage is required"
+	}
+	if a.HasAnyExtKeyUsage {
+		return "ExtKeyUsageAny not permitted"
+	}
+	if !a.serverAuthCapable() && !a.emailCapable() {
+		return fmt.Sprintf(
+			"Is constrained: hasServerAuth=%v || (beforeStepUpCutoff=%v && hasStepUp=%v)",
+			a.HasServerAuth, a.PolicyVersion == PolicyStepUp, a.HasStepUp)
 	}
 
-	// For certificates with a notBefore before 23 August 2016, the
-	// id-Netscape-stepUp OID (aka Netscape Server Gated Crypto ("nsSGC")) is
-	// treated as equivalent to id-kp-serverAuth.
-	nsSGCCutoff := time.Date(2016, time.August, 23, 0, 0, 0, 0, time.UTC)
+	var constraints []string
+	if a.serverAuthCapable() {
+		constraints = append(constraints, fmt.Sprintf(
+			"hasDNSName=%v && (hasIPAddressInPermittedSubtrees=%v || hasIPAddressesInExcludedSubtrees=%v)",
+			a.HasDNSNameConstraint, a.HasPermittedIPAddresses, a.ExcludesAllIPv4 && a.ExcludesAllIPv6))
+	}
+	if a.emailCapable() {
+		constraints = append(constraints, fmt.Sprintf(
+			"hasRFC822NameInPermittedSubtrees=%v && hasDirectoryNameInPermittedSubtrees=%v",
+			a.HasEmailConstraint, a.HasDirectoryNameConstraint))
+	}
+	constraintsText := strings.Join(constraints, " && ")
+	if a.Constrained {
+		return fmt.Sprintf("Is constrained: %s", constraintsText)
+	}
+	return fmt.Sprintf("Is not constrained: %s)", constraintsText)
+}
 
-	stepUpEquivalentToServerAuth := cert.NotBefore.Before(nsSGCCutoff)
-	var hasServerAuth bool
-	var hasStepUp bool
+// AnalyzeTechnicalConstraints determines whether cert is technically
+// constrained, and why. A certificate is technically constrained if it has
+// the extendedKeyUsage extension that does not contain anyExtendedKeyUsage,
+// and has the nameConstraints extension with both dNSName and iPAddress
+// entries if it contains the serverAuth extended key usage, and with
+// permitted rfc822Name and directoryName entries if it contains
+// emailProtection. These are the rules of DefaultPolicy.
+func AnalyzeTechnicalConstraints(cert *x509.Certificate) ConstraintAnalysis {
+	return AnalyzeTechnicalConstraintsForPolicy(cert, DefaultPolicy)
+}
+
+// AnalyzeTechnicalConstraintsForPolicy determines whether cert is technically
+// constrained under policy, and why.
+func AnalyzeTechnicalConstraintsForPolicy(cert *x509.Certificate, policy Policy) ConstraintAnalysis {
+	a := ConstraintAnalysis{Policy: policy, PolicyVersion: PolicyServerAuth}
+	if policy.stepUpIsServerAuth(cert.NotBefore) {
+		a.PolicyVersion = PolicyStepUp
+	}
+
+	// There must be Extended Key Usage flags
+	a.HasExtKeyUsage = len(cert.ExtKeyUsage) > 0
+	if !a.HasExtKeyUsage {
+		a.Reasons = append(a.Reasons, ReasonNoExtKeyUsage)
+		return a
+	}
 
 	for _, usage := range cert.ExtKeyUsage {
 		switch usage {
 		case x509.ExtKeyUsageAny:
-			// Do not permit ExtKeyUsageAny
-			return false, "ExtKeyUsageAny not permitted"
+			a.HasAnyExtKeyUsage = true
 		case x509.ExtKeyUsageServerAuth:
-			hasServerAuth = true
+			a.HasServerAuth = true
 		case x509.ExtKeyUsageNetscapeServerGatedCrypto:
-			hasStepUp = true
+			a.HasStepUp = true
+		case x509.ExtKeyUsageEmailProtection:
+			a.HasEmailProtection = true
 		}
 	}
 
-	// Must be marked for Server Auth, or have StepUp and be from before the cutoff
-	if !(hasServerAuth || (stepUpEquivalentToServerAuth && hasStepUp)) {
-		return true, fmt.Sprintf(
-			"Is constrained: hasServerAuth=%v || (beforeStepUpCutoff=%v && hasStepUp=%v)",
-			hasServerAuth, stepUpEquivalentToServerAuth, hasStepUp)
+	// Do not permit ExtKeyUsageAny
+	if a.HasAnyExtKeyUsage {
+		a.Reasons = append(a.Reasons, ReasonAnyExtKeyUsage)
+		return a
 	}
 
-	// For iPAddresses in excludedSubtrees, both IPv4 and IPv6 must be present
-	// and the constraints must cover the entire range (0.0.0.0/0 for IPv4 and
-	// ::0/0 for IPv6).
-	var excludesIPv4 bool
-	var excludesIPv6 bool
-	for _, cidr := range cert.ExcludedIPAddresses {
-		if cidr.IP.Equal(net.IPv4zero) && isAllZeros(cidr.Mask, net.IPv4len) {
-			excludesIPv4 = true
+	// Must be marked for Server Auth, or have StepUp and be from before the
+	// cutoff, or be marked for Email Protection
+	if !a.serverAuthCapable() && !a.emailCapable() {
+		a.Constrained = true
+		a.Reasons = append(a.Reasons, ReasonNotServerAuth)
+		return a
+	}
+
+	// S/MIME CAs must have an rfc822Name in permittedSubtrees, and a
+	// directoryName if the policy says so. Constraints that cannot be
+	// decoded constrain nothing.
+	if a.emailCapable() {
+		constraints, _ := ParseNameConstraints(cert)
+		a.HasEmailConstraint = len(constraints.PermittedEmailAddresses) > 0
+		a.HasDirectoryNameConstraint = len(constraints.PermittedDirectoryNames) > 0
+		if !a.HasEmailConstraint {
+			a.Reasons = append(a.Reasons, ReasonNoEmailConstraint)
 		}
-		if cidr.IP.Equal(net.IPv6zero) && isAllZeros(cidr.Mask, net.IPv6len) {
-			excludesIPv6 = true
+		if !a.HasDirectoryNameConstraint && policy.RequireDirectoryNameConstraints {
+			a.Reasons = append(a.Reasons, ReasonNoDirectoryNameConstraint)
 		}
 	}
+	if a.serverAuthCapable() {
+		// For iPAddresses in excludedSubtrees, both IPv4 and IPv6 must be present
+		// and the constraints must cover the entire range (0.0.0.0/0 for IPv4 and
+		// ::0/0 for IPv6).
+		for _, cidr := range cert.ExcludedIPAddresses {
+			if cidr.IP.Equal(net.IPv4zero) && isAllZeros(cidr.Mask, net.IPv4len) {
+				a.ExcludesAllIPv4 = true
+			}
+			if cidr.IP.Equal(net.IPv6zero) && isAllZeros(cidr.Mask, net.IPv6len) {
+				a.ExcludesAllIPv6 = true
+			}
+		}
+		a.HasPermittedIPAddresses = len(cert.PermittedIPAddresses) > 0
 
-	hasIPAddressInPermittedSubtrees := len(cert.PermittedIPAddresses) > 0
-	hasIPAddressesInExcludedSubtrees := excludesIPv4 && excludesIPv6
+		// There must be at least one DNSname constraint
+		a.HasDNSNameConstraint = len(cert.PermittedDNSDomains) > 0 ||
+			len(cert.ExcludedDNSDomains) > 0
 
-	// There must be at least one DNSname constraint
-	hasDNSName := len(cert.PermittedDNSDomains) > 0 ||
-		len(cert.ExcludedDNSDomains) > 0
+		if !a.HasDNSNameConstraint {
+			a.Reasons = append(a.Reasons, ReasonNoDNSNameConstraint)
+		}
+		if policy.RequireIPConstraints && !a.HasPermittedIPAddresses && !(a.ExcludesAllIPv4 && a.ExcludesAllIPv6) {
+			a.Reasons = append(a.Reasons, ReasonNoIPAddressConstraint)
+		}
+	}
+	if len(a.Reasons) == 0 {
+		a.Constrained = true
+		a.Reasons = append(a.Reasons, ReasonNameConstrained)
+	}
+	return a
+}
 
-	constraintsText := fmt.Sprintf(
-		"hasDNSName=%v && (hasIPAddressInPermittedSubtrees=%v || hasIPAddressesInExcludedSubtrees=%v)",
-		hasDNSName, hasIPAddressInPermittedSubtrees, hasIPAddressesInExcludedSubtrees)
+// DetermineIfTechnicallyConstrained reports whether cert is technically
+// constrained, as AnalyzeTechnicalConstraints does, with the details of the
+// analysis.
+//
+// Deprecated: Use AnalyzeTechnicalConstraints. Its Constrained field is the
+// verdict and its Details method the details; its Reasons say why without
+// parsing them.
+func DetermineIfTechnicallyConstrained(cert *x509.Certificate) (bool, string) {
+	return DetermineIfTechnicallyConstrainedForPolicy(cert, DefaultPolicy)
+}
 
-	if hasDNSName && (hasIPAddressInPermittedSubtrees ||
-		hasIPAddressesInExcludedSubtrees) {
-		return true, fmt.Sprintf("Is constrained: %s", constraintsText)
-	}
+// DetermineIfTechnicallyConstrainedForPolicy is
+// DetermineIfTechnicallyConstrained under policy, such as the one in force
+// when cert was issued.
+//
+// Deprecated: Use AnalyzeTechnicalConstraintsForPolicy.
+func DetermineIfTechnicallyConstrainedForPolicy(cert *x509.Certificate, policy Policy) (bool, string) {
+	a := AnalyzeTechnicalConstraintsForPolicy(cert, policy)
+	return a.Constrained, a.Details()
+}
 
-	return false, fmt.Sprintf("Is not constrained: %s)", constraintsText)
+// DetermineIfTechnicallyConstrainedAt is DetermineIfTechnicallyConstrained
+// under the Mozilla policy in force at t, answering whether cert was
+// constrained under the rules of that date rather than today's.
+//
+// Deprecated: Use AnalyzeTechnicalConstraintsForPolicy with
+// MozillaPolicyAt(t).
+func DetermineIfTechnicallyConstrainedAt(cert *x509.Certificate, t time.Time) (bool, string) {
+	return DetermineIfTechnicallyConstrainedForPolicy(cert, MozillaPolicyAt(t))
 }
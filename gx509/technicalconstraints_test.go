@@ -9,9 +9,12 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"math/big"
 	"net"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -302,3 +305,367 @@ func TestNotACA(t *testing.T) {
 	cert := serialiseAndParse(t, template)
 	checkConstrained(t, false, cert)
 }
+
+func TestAnalyzeTechnicalConstraints(t *testing.T) {
+	t.Parallel()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co",
+		},
+		NotBefore: time.Date(2014, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2019, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA: true,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageNetscapeServerGatedCrypto},
+	}
+
+	a := AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || !a.HasStepUp || a.HasServerAuth || a.PolicyVersion != PolicyStepUp {
+		t.Errorf("Unexpected analysis of the 2014 stepUp certificate %+v", a)
+	}
+	if !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoDNSNameConstraint, ReasonNoIPAddressConstraint}) {
+		t.Errorf("Unexpected reasons %v", a.Reasons)
+	}
+
+	// After the cutoff, stepUp alone no longer allows issuing for servers
+	template.NotBefore = time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC)
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if !a.Constrained || a.PolicyVersion != PolicyServerAuth || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNotServerAuth}) {
+		t.Errorf("Unexpected analysis of the 2017 stepUp certificate %+v", a)
+	}
+
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	template.PermittedDNSDomains = []string{"example.com"}
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || !a.HasDNSNameConstraint || len(a.Reasons) != 1 || a.Reasons[0].String() != "no-ip-address-constraint" {
+		t.Errorf("Unexpected analysis of the serverAuth certificate %+v", a)
+	}
+	expected := "Is not constrained: hasDNSName=true && (hasIPAddressInPermittedSubtrees=false || hasIPAddressesInExcludedSubtrees=false))"
+	if details := a.Details(); details != expected {
+		t.Errorf("Expected details %q, got %q", expected, details)
+	}
+
+	template.ExtKeyUsage = nil
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || a.HasExtKeyUsage || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoExtKeyUsage}) {
+		t.Errorf("Unexpected analysis of the certificate without ExtKeyUsage %+v", a)
+	}
+}
+
+// emailConstraints returns a nameConstraints extension with rfc822Name
+// subtrees, and permitted directoryName subtrees for each of
+// permittedDirectoryNames, which crypto/x509 cannot write itself.
+func emailConstraints(t *testing.T, permitted, excluded []string, permittedDirectoryNames ...pkix.Name) pkix.Extension {
+	var constraints nameConstraintsASN1
+	for _, email := range permitted {
+		constraints.Permitted = append(constraints.Permitted, generalSubtree{
+			Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameRFC822Name, Bytes: []byte(email)}})
+	}
+	for _, email := range excluded {
+		constraints.Excluded = append(constraints.Excluded, generalSubtree{
+			Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameRFC822Name, Bytes: []byte(email)}})
+	}
+	for _, name := range permittedDirectoryNames {
+		der, err := asn1.Marshal(name.ToRDNSequence())
+		if err != nil {
+			t.Fatalf("Could not marshal directoryName: %s", err)
+		}
+		constraints.Permitted = append(constraints.Permitted, generalSubtree{
+			Base: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameDirectoryName, IsCompound: true, Bytes: der}})
+	}
+	value, err := asn1.Marshal(constraints)
+	if err != nil {
+		t.Fatalf("Could not marshal name constraints: %s", err)
+	}
+	return pkix.Extension{Id: oidExtensionNameConstraints, Value: value}
+}
+
+func TestParseNameConstraints(t *testing.T) {
+	t.Parallel()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co",
+		},
+		NotBefore: time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2019, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA: true,
+		ExtraExtensions: []pkix.Extension{
+			emailConstraints(t, []string{"example.com", ".example.com"}, []string{"ceo@example.com"},
+				pkix.Name{Organization: []string{"Acme Co"}, Country: []string{"US"}})},
+	}
+
+	constraints, err := ParseNameConstraints(serialiseAndParse(t, template))
+	if err != nil {
+		t.Fatalf("Could not parse name constraints: %s", err)
+	}
+	if !reflect.DeepEqual(constraints.PermittedEmailAddresses, []string{"example.com", ".example.com"}) ||
+		!reflect.DeepEqual(constraints.ExcludedEmailAddresses, []string{"ceo@example.com"}) {
+		t.Errorf("Unexpected constraints %+v", constraints)
+	}
+	if len(constraints.PermittedDirectoryNames) != 1 || len(constraints.ExcludedDirectoryNames) != 0 {
+		t.Fatalf("Expected a permitted directoryName, got %+v", constraints)
+	}
+	if name, err := FormatDistinguishedName(constraints.PermittedDirectoryNames[0]); err != nil || name != "O=Acme Co,C=US" {
+		t.Errorf("Unexpected directoryName %q: %v", name, err)
+	}
+
+	truncated := &x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionNameConstraints, Value: []byte{0x30, 0x03, 0xa0}}}}
+	if _, err := ParseNameConstraints(truncated); err == nil {
+		t.Errorf("Expected an error for truncated name constraints")
+	}
+}
+
+func TestEmailProtectionConstraints(t *testing.T) {
+	t.Parallel()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co",
+		},
+		NotBefore: time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2019, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA: true,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageEmailProtection},
+	}
+
+	a := AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || !a.HasEmailProtection || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoEmailConstraint, ReasonNoDirectoryNameConstraint}) {
+		t.Errorf("Unexpected analysis of the unconstrained S/MIME CA %+v", a)
+	}
+
+	template.ExtraExtensions = []pkix.Extension{emailConstraints(t, nil, []string{"example.org"})}
+	checkConstrained(t, false, serialiseAndParse(t, template))
+
+	// Mailboxes alone are not enough: the subject names must be limited too
+	template.ExtraExtensions = []pkix.Extension{emailConstraints(t, []string{"example.com"}, nil)}
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || !a.HasEmailConstraint || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoDirectoryNameConstraint}) {
+		t.Errorf("Unexpected analysis of the S/MIME CA without directoryNames %+v", a)
+	}
+
+	template.ExtraExtensions = []pkix.Extension{emailConstraints(t, []string{"example.com"}, nil, pkix.Name{Organization: []string{"Acme Co"}})}
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if !a.Constrained || !a.HasDirectoryNameConstraint || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNameConstrained}) {
+		t.Errorf("Unexpected analysis of the constrained S/MIME CA %+v", a)
+	}
+	if details := a.Details(); details != "Is constrained: hasRFC822NameInPermittedSubtrees=true && hasDirectoryNameInPermittedSubtrees=true" {
+		t.Errorf("Unexpected details %q", details)
+	}
+
+	// Email constraints do nothing to constrain TLS server certificates
+	template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	a = AnalyzeTechnicalConstraints(serialiseAndParse(t, template))
+	if a.Constrained || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoDNSNameConstraint, ReasonNoIPAddressConstraint}) {
+		t.Errorf("Unexpected analysis of the S/MIME and TLS CA %+v", a)
+	}
+}
+
+func TestConstraintPolicies(t *testing.T) {
+	t.Parallel()
+
+	// A stepUp CA from 2017 with only dNSName constraints
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co",
+		},
+		NotBefore: time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2019, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA: true,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageNetscapeServerGatedCrypto},
+		PermittedDNSDomains: []string{"example.com"},
+	}
+	cert := serialiseAndParse(t, template)
+
+	// Under 2.2 stepUp is serverAuth, but dNSName constraints are enough
+	if constrained, details := DetermineIfTechnicallyConstrainedForPolicy(cert, MozillaPolicy22); !constrained {
+		t.Errorf("Expected the CA constrained under 2.2: %s", details)
+	}
+	if a := AnalyzeTechnicalConstraintsForPolicy(cert, MozillaPolicy22); a.PolicyVersion != PolicyStepUp || a.Policy.Name != "mozilla-2.2" {
+		t.Errorf("Expected stepUp treated as serverAuth under 2.2, got %+v", a)
+	}
+	// Since 2.5 stepUp no longer counts after the cutoff
+	if a := AnalyzeTechnicalConstraintsForPolicy(cert, MozillaPolicy25); !a.Constrained || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNotServerAuth}) {
+		t.Errorf("Expected the CA constrained under 2.5 as it is not for servers, got %+v", a)
+	}
+
+	// With serverAuth, the Baseline Requirements need iPAddress constraints
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection}
+	cert = serialiseAndParse(t, template)
+	if a := AnalyzeTechnicalConstraintsForPolicy(cert, CABRBaseline); a.Constrained || !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoIPAddressConstraint}) {
+		t.Errorf("Unexpected analysis under the Baseline Requirements %+v", a)
+	}
+	if a := AnalyzeTechnicalConstraintsForPolicy(cert, MozillaPolicy22); !a.Constrained {
+		t.Errorf("Expected the CA constrained under 2.2, which ignores email, got %+v", a)
+	}
+	if a := AnalyzeTechnicalConstraintsForPolicy(cert, MozillaPolicy25); !reflect.DeepEqual(a.Reasons, []Reason{ReasonNoEmailConstraint, ReasonNoIPAddressConstraint}) {
+		t.Errorf("Unexpected reasons under 2.5 %v", a.Reasons)
+	}
+	if a := AnalyzeTechnicalConstraints(cert); a.Policy.Name != DefaultPolicy.Name || len(a.Reasons) != 3 {
+		t.Errorf("Unexpected analysis under the default policy %+v", a)
+	}
+
+	for at, expected := range map[time.Time]string{
+		time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC): "mozilla-2.2",
+		time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC): "mozilla-2.5",
+		MozillaPolicy27.Effective:                              "mozilla-2.7",
+	} {
+		if policy := MozillaPolicyAt(at); policy.Name != expected {
+			t.Errorf("Expected %s in force at %s, got %s", expected, at, policy.Name)
+		}
+	}
+	if policy, ok := LookupPolicy("cabr-baseline"); !ok || policy.Name != CABRBaseline.Name {
+		t.Errorf("Could not look up the Baseline Requirements")
+	}
+	if _, ok := LookupPolicy("mozilla-1.0"); ok {
+		t.Errorf("Expected no such policy")
+	}
+	if policy, ok := LookupPolicy("v2.5"); !ok || policy.Name != MozillaPolicy25.Name {
+		t.Errorf("Could not look up v2.5")
+	}
+	if _, ok := LookupPolicy("v1.0"); ok {
+		t.Errorf("Expected no such policy")
+	}
+}
+
+func TestDetermineIfTechnicallyConstrainedAt(t *testing.T) {
+	t.Parallel()
+
+	// A serverAuth CA with only dNSName constraints was constrained until
+	// policy 2.5 required iPAddress constraints too
+	cert := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Σ Acme Co",
+		},
+		NotBefore: time.Date(2015, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:  time.Date(2025, time.December, 1, 23, 59, 59, 59, time.UTC),
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"example.com"},
+	})
+
+	if constrained, details := DetermineIfTechnicallyConstrainedAt(cert, time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)); !constrained {
+		t.Errorf("Expected the CA constrained in 2016: %s", details)
+	}
+	if constrained, _ := DetermineIfTechnicallyConstrainedAt(cert, MozillaPolicy25.Effective); constrained {
+		t.Errorf("Expected the CA unconstrained once 2.5 was in force")
+	}
+}
+
+func TestPermitsNames(t *testing.T) {
+	t.Parallel()
+
+	cert := &x509.Certificate{
+		PermittedDNSDomains: []string{"example.com", ".example.net"},
+		ExcludedDNSDomains:  []string{"secret.example.com"},
+		PermittedIPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}},
+		ExcludedIPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(16, 32)}},
+	}
+
+	for name, expected := range map[string]bool{
+		"example.com":           true,
+		"WWW.Example.COM.":      true,
+		"*.example.com":         true,
+		"notexample.com":        false,
+		"secret.example.com":    false,
+		"db.secret.example.com": false,
+		"example.net":           false,
+		"www.example.net":       true,
+		"_acme.www.example.net": true,
+		"www.example.org":       false,
+	} {
+		permitted, err := PermitsDNSName(cert, name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if permitted != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, permitted)
+		}
+	}
+	for _, name := range []string{"", "a..example.com", "-a.example.com", "www.*.example.com", "exa mple.com", strings.Repeat("a", 64) + ".com"} {
+		if _, err := PermitsDNSName(cert, name); err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+
+	for ip, expected := range map[string]bool{
+		"10.2.3.4":    true,
+		"10.1.2.3":    false,
+		"192.168.0.1": false,
+		"2001:db8::1": false,
+	} {
+		if permitted, err := PermitsIPAddress(cert, net.ParseIP(ip)); err != nil || permitted != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", ip, expected, permitted, err)
+		}
+	}
+	if permitted, _ := PermitsIPAddress(cert, net.ParseIP("10.2.3.4").To4()); !permitted {
+		t.Errorf("Expected a 4-byte address permitted")
+	}
+	if _, err := PermitsIPAddress(cert, net.IP{10, 0}); err == nil {
+		t.Errorf("Expected an error for a truncated address")
+	}
+
+	// IPv4 addresses are matched as IPv4 whether they are 4 or 16 bytes
+	// long, and never against IPv6 subtrees or the reverse
+	for _, test := range []struct {
+		cert     *x509.Certificate
+		ip       string
+		expected bool
+	}{
+		{&x509.Certificate{
+			PermittedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+			ExcludedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}},
+		}, "10.1.2.3", true},
+		{&x509.Certificate{
+			ExcludedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}},
+		}, "2001:db8::1", false},
+		{&x509.Certificate{
+			PermittedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)}},
+		}, "10.1.2.3", false},
+		{&x509.Certificate{
+			ExcludedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("0.0.0.0").To4(), Mask: net.CIDRMask(0, 32)}},
+		}, "2001:db8::1", true},
+		{&x509.Certificate{
+			PermittedIPAddresses: []net.IPNet{
+				{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(104, 128)}},
+		}, "10.1.2.3", true},
+	} {
+		forms := []net.IP{net.ParseIP(test.ip)}
+		if v4 := forms[0].To4(); v4 != nil {
+			forms = append(forms, v4)
+		}
+		for _, ip := range forms {
+			if permitted, err := PermitsIPAddress(test.cert, ip); err != nil || permitted != test.expected {
+				t.Errorf("%s in %d bytes: expected %v, got %v (%v)", test.ip, len(ip), test.expected, permitted, err)
+			}
+		}
+	}
+
+	if permitted, _ := PermitsDNSName(&x509.Certificate{}, "anything.example"); !permitted {
+		t.Errorf("Expected everything permitted without constraints")
+	}
+}
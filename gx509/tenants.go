@@ -0,0 +1,220 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A Tenant is a team the analysis service serves, with its own rules.
+type Tenant struct {
+	Name string
+	// Policy judges whether certificates are technically constrained,
+	// unless ByIssuance is set, in which case the Mozilla policy in force
+	// when each was issued does.
+	Policy     Policy
+	ByIssuance bool
+	// Lints are the lints run on the tenant's certificates.
+	Lints []*Lint
+}
+
+// DefaultTenant is how the service treats callers when it has no tenants:
+// DefaultPolicy and every lint.
+var DefaultTenant = &Tenant{Name: "default", Policy: DefaultPolicy, Lints: Lints}
+
+// PolicyFor returns the policy the tenant judges cert by.
+func (t *Tenant) PolicyFor(cert *x509.Certificate) Policy {
+	if t.ByIssuance {
+		return MozillaPolicyAt(cert.NotBefore)
+	}
+	return t.Policy
+}
+
+// lintNames returns the names of lints.
+func lintNames(lints []*Lint) []string {
+	var names []string
+	for _, lint := range lints {
+		names = append(names, lint.Name)
+	}
+	return names
+}
+
+// ConfigHash identifies the tenant's policy and lints, for a VerdictRecord.
+func (t *Tenant) ConfigHash() string {
+	return ConfigHash(struct {
+		Policy     Policy
+		ByIssuance bool
+		Lints      []string
+	}{t.Policy, t.ByIssuance, lintNames(t.Lints)})
+}
+
+// Analyze analyzes and lints certs as of at under the tenant's rules.
+func (t *Tenant) Analyze(certs []*x509.Certificate, at time.Time) AnalysisResponse {
+	response := AnalysisResponse{Tenant: t.Name, Certificates: []AnalyzedCertificate{}}
+	for _, cert := range certs {
+		analyzed := AnalyzedCertificate{
+			ConstraintResult: NewConstraintResult("", cert, AnalyzeTechnicalConstraintsForPolicy(cert, t.PolicyFor(cert))),
+			Findings:         []LintResult{},
+		}
+		for _, lint := range t.Lints {
+			if passed, message, ok := lint.run(cert, at); ok {
+				analyzed.Findings = append(analyzed.Findings, LintResult{
+					Lint:     lint.Name,
+					Severity: lint.Severity.String(),
+					Passed:   passed,
+					Message:  message,
+				})
+			}
+		}
+		response.Certificates = append(response.Certificates, analyzed)
+	}
+	return response
+}
+
+// TenantConfig holds the tenants of the analysis service and the API keys
+// that identify them.
+type TenantConfig struct {
+	Tenants []*Tenant
+
+	byKeyHash map[[sha256.Size]byte]*Tenant
+}
+
+type tenantYAML struct {
+	Name          string   `yaml:"name"`
+	Keys          []string `yaml:"keys"`
+	Policy        string   `yaml:"policy,omitempty"`
+	Lints         []string `yaml:"lints,omitempty"`
+	DisabledLints []string `yaml:"disabledLints,omitempty"`
+}
+
+type tenantConfigYAML struct {
+	Tenants []tenantYAML `yaml:"tenants"`
+}
+
+// HashAPIKey returns the hash of key, as tenant configurations list keys,
+// hex-encoded.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// lookupLint returns the lint named name, or nil if there is none.
+func lookupLint(name string) *Lint {
+	for _, lint := range Lints {
+		if lint.Name == name {
+			return lint
+		}
+	}
+	return nil
+}
+
+// newTenant returns the tenant name with the policy, a preset or "issuance"
+// or DefaultPolicy if empty, and either only lints or all but disabledLints.
+func newTenant(name, policy string, lints, disabledLints []string) (*Tenant, error) {
+	tenant := &Tenant{Name: name, Policy: DefaultPolicy}
+	switch policy {
+	case "":
+	case "issuance":
+		tenant.ByIssuance = true
+	default:
+		var ok bool
+		if tenant.Policy, ok = LookupPolicy(policy); !ok {
+			return nil, fmt.Errorf("Tenant %s has unknown policy %s", name, policy)
+		}
+	}
+
+	if len(lints) > 0 && len(disabledLints) > 0 {
+		return nil, fmt.Errorf("Tenant %s has both lints and disabledLints", name)
+	}
+	named := make(map[string]bool)
+	for _, lint := range append(append([]string{}, lints...), disabledLints...) {
+		if lookupLint(lint) == nil {
+			return nil, fmt.Errorf("Tenant %s names unknown lint %s", name, lint)
+		}
+		named[lint] = true
+	}
+	for _, lint := range Lints {
+		// Named lints are the only ones enabled with lints, and the only
+		// ones disabled with disabledLints
+		if named[lint.Name] == (len(lints) > 0) {
+			tenant.Lints = append(tenant.Lints, lint)
+		}
+	}
+	return tenant, nil
+}
+
+// ParseTenantConfig decodes a YAML tenant configuration such as
+//
+//	tenants:
+//	  - name: web-pki
+//	    keys: [<HashAPIKey of each API key>]
+//	    policy: mozilla-2.7
+//	  - name: legacy-smime
+//	    keys: [...]
+//	    policy: issuance
+//	    disabledLints: [weak-signature]
+//
+// Keys are stored hashed, so the configuration holds no secrets. A tenant's
+// policy is a preset, "issuance", or DefaultPolicy if unset; its lints are
+// those listed in lints, or all but those in disabledLints.
+func ParseTenantConfig(data []byte) (*TenantConfig, error) {
+	var raw tenantConfigYAML
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	config := &TenantConfig{byKeyHash: make(map[[sha256.Size]byte]*Tenant)}
+	names := make(map[string]bool)
+	for i, rawTenant := range raw.Tenants {
+		if rawTenant.Name == "" {
+			return nil, fmt.Errorf("Tenant %d has no name", i)
+		}
+		if names[rawTenant.Name] {
+			return nil, fmt.Errorf("Tenant %s is defined twice", rawTenant.Name)
+		}
+		names[rawTenant.Name] = true
+
+		tenant, err := newTenant(rawTenant.Name, rawTenant.Policy, rawTenant.Lints, rawTenant.DisabledLints)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rawTenant.Keys) == 0 {
+			return nil, fmt.Errorf("Tenant %s has no API keys", tenant.Name)
+		}
+		for _, key := range rawTenant.Keys {
+			decoded, err := hex.DecodeString(key)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("Tenant %s has a key that is not a hex SHA-256 hash", tenant.Name)
+			}
+			var hash [sha256.Size]byte
+			copy(hash[:], decoded)
+			if other, ok := config.byKeyHash[hash]; ok {
+				return nil, fmt.Errorf("Tenants %s and %s share an API key", other.Name, tenant.Name)
+			}
+			config.byKeyHash[hash] = tenant
+		}
+		config.Tenants = append(config.Tenants, tenant)
+	}
+	if len(config.Tenants) == 0 {
+		return nil, fmt.Errorf("Tenant configuration has no tenants")
+	}
+	return config, nil
+}
+
+// Authenticate returns the tenant whose API key is key, or nil if there is
+// none. Keys are compared by hash, so the comparison reveals nothing of them
+// through timing.
+func (c *TenantConfig) Authenticate(key string) *Tenant {
+	if key == "" {
+		return nil
+	}
+	return c.byKeyHash[sha256.Sum256([]byte(key))]
+}
@@ -0,0 +1,82 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTenantConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParseTenantConfig([]byte(fmt.Sprintf(`
+tenants:
+  - name: web-pki
+    keys: [%s, %s]
+    policy: cabr-baseline
+    lints: [expired, weak-key]
+  - name: legacy
+    keys: [%s]
+    policy: issuance
+    disabledLints: [expired]
+  - name: everything
+    keys: [%s]
+`, HashAPIKey("web-1"), HashAPIKey("web-2"), HashAPIKey("legacy-1"), HashAPIKey("all-1"))))
+	if err != nil {
+		t.Fatalf("Could not parse tenant configuration: %s", err)
+	}
+
+	web := config.Authenticate("web-2")
+	if web == nil || web.Name != "web-pki" || web.Policy.Name != "cabr-baseline" || !reflect.DeepEqual(lintNames(web.Lints), []string{"expired", "weak-key"}) {
+		t.Errorf("Unexpected tenant %+v", web)
+	}
+	legacy := config.Authenticate("legacy-1")
+	if legacy == nil || !legacy.ByIssuance || len(legacy.Lints) != len(Lints)-1 || legacy.Lints[0].Name == "expired" {
+		t.Errorf("Unexpected tenant %+v", legacy)
+	}
+	if everything := config.Authenticate("all-1"); everything == nil || everything.Policy.Name != DefaultPolicy.Name || len(everything.Lints) != len(Lints) {
+		t.Errorf("Unexpected tenant %+v", everything)
+	}
+	for _, key := range []string{"", "web-3", HashAPIKey("web-1")} {
+		if tenant := config.Authenticate(key); tenant != nil {
+			t.Errorf("Expected %q not to authenticate, got %s", key, tenant.Name)
+		}
+	}
+
+	chain := testChain(t, "www.example.com")
+	if policy := legacy.PolicyFor(chain[1]); policy.Name != MozillaPolicyAt(chain[1].NotBefore).Name {
+		t.Errorf("Expected the policy in force at issuance, got %s", policy.Name)
+	}
+	response := web.Analyze(chain[:2], chain[0].NotBefore.Add(time.Hour))
+	if response.Tenant != "web-pki" || len(response.Certificates) != 2 || response.Certificates[1].Policy != "cabr-baseline" {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+	for _, finding := range response.Certificates[0].Findings {
+		if finding.Lint != "expired" && finding.Lint != "weak-key" {
+			t.Errorf("Expected only the tenant's lints, got %s", finding.Lint)
+		}
+	}
+
+	key := HashAPIKey("k")
+	for _, data := range []string{
+		"tenants: []\n",
+		"tenants:\n  - {keys: [" + key + "]}\n",
+		"tenants:\n  - {name: a}\n",
+		"tenants:\n  - {name: a, keys: [secret]}\n",
+		"tenants:\n  - {name: a, keys: [" + key + "]}\n  - {name: b, keys: [" + key + "]}\n",
+		"tenants:\n  - {name: a, keys: [" + key + "]}\n  - {name: a, keys: [" + HashAPIKey("j") + "]}\n",
+		"tenants:\n  - {name: a, keys: [" + key + "], policy: mozilla-9}\n",
+		"tenants:\n  - {name: a, keys: [" + key + "], lints: [no-such-lint]}\n",
+		"tenants:\n  - {name: a, keys: [" + key + "], lints: [expired], disabledLints: [weak-key]}\n",
+		"tenants:\n  - {name: a, key: [" + key + "]}\n",
+	} {
+		if _, err := ParseTenantConfig([]byte(data)); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+}
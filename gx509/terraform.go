@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+)
+
+// terraformCertificateAttributes are the attributes that hold PEM
+// certificates, for each type of resource that has them.
+var terraformCertificateAttributes = map[string][]string{
+	"tls_self_signed_cert":    {"cert_pem"},
+	"tls_locally_signed_cert": {"cert_pem", "ca_cert_pem"},
+	"acme_certificate":        {"certificate_pem", "issuer_pem"},
+}
+
+// A TerraformCertificate is a certificate held by a resource in Terraform or
+// OpenTofu state.
+type TerraformCertificate struct {
+	// Address is the resource's address, such as tls_self_signed_cert.ca or
+	// module.pki.acme_certificate.www["a"].
+	Address   string
+	Attribute string
+	Cert      *x509.Certificate
+}
+
+// terraformState is a state file, as written by terraform itself.
+type terraformState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// terraformModule is a module in the JSON output of terraform show.
+type terraformModule struct {
+	Resources []struct {
+		Address string                 `json:"address"`
+		Type    string                 `json:"type"`
+		Values  map[string]interface{} `json:"values"`
+	} `json:"resources"`
+	ChildModules []terraformModule `json:"child_modules"`
+}
+
+type terraformValues struct {
+	RootModule terraformModule `json:"root_module"`
+}
+
+// terraformShow is the output of terraform show -json, for a state or a plan.
+type terraformShow struct {
+	Values        *terraformValues `json:"values"`
+	PlannedValues *terraformValues `json:"planned_values"`
+	PriorState    *struct {
+		Values *terraformValues `json:"values"`
+	} `json:"prior_state"`
+}
+
+// terraformCertificates collects the certificates in the attributes of a
+// resource, skipping those seen already.
+type terraformCertificates struct {
+	found []TerraformCertificate
+	seen  map[string]bool
+}
+
+func (c *terraformCertificates) add(address string, resourceType string, attributes map[string]interface{}) error {
+	for _, attribute := range terraformCertificateAttributes[resourceType] {
+		// Attributes not yet known in a plan are missing or null
+		value, _ := attributes[attribute].(string)
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			key := address + "\x00" + attribute + "\x00" + string(block.Bytes)
+			if c.seen[key] {
+				continue
+			}
+			c.seen[key] = true
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("Could not parse %s.%s: %s", address, attribute, err)
+			}
+			c.found = append(c.found, TerraformCertificate{Address: address, Attribute: attribute, Cert: cert})
+		}
+	}
+	return nil
+}
+
+func (c *terraformCertificates) addModule(module terraformModule) error {
+	for _, resource := range module.Resources {
+		if err := c.add(resource.Address, resource.Type, resource.Values); err != nil {
+			return err
+		}
+	}
+	for _, child := range module.ChildModules {
+		if err := c.addModule(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseTerraform returns the certificates held by tls_self_signed_cert,
+// tls_locally_signed_cert and acme_certificate resources in Terraform or
+// OpenTofu JSON: either a state file, or the output of show -json for a
+// state or a plan. Certificates a plan has yet to create are not known, so
+// only those already in the state are returned.
+func ParseTerraform(data []byte) ([]TerraformCertificate, error) {
+	var state terraformState
+	var show terraformShow
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Could not decode JSON: %s", err)
+	}
+	if err := json.Unmarshal(data, &show); err != nil {
+		return nil, fmt.Errorf("Could not decode JSON: %s", err)
+	}
+
+	certs := terraformCertificates{seen: make(map[string]bool)}
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		address := resource.Type + "." + resource.Name
+		if len(resource.Module) > 0 {
+			address = resource.Module + "." + address
+		}
+		for _, instance := range resource.Instances {
+			instanceAddress := address
+			switch key := instance.IndexKey.(type) {
+			case string:
+				instanceAddress += fmt.Sprintf("[%q]", key)
+			case float64:
+				instanceAddress += fmt.Sprintf("[%d]", int(key))
+			}
+			if err := certs.add(instanceAddress, resource.Type, instance.Attributes); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	values := []*terraformValues{show.Values, show.PlannedValues}
+	if show.PriorState != nil {
+		values = append(values, show.PriorState.Values)
+	}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if err := certs.addModule(v.RootModule); err != nil {
+			return nil, err
+		}
+	}
+	return certs.found, nil
+}
@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseTerraform(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	encode := func(certs ...*x509.Certificate) string {
+		var out []byte
+		for _, cert := range certs {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+		quoted, _ := json.Marshal(string(out))
+		return string(quoted)
+	}
+
+	state := fmt.Sprintf(`{"version": 4, "resources": [
+		{"mode": "managed", "type": "tls_self_signed_cert", "name": "root", "instances": [{"attributes": {"cert_pem": %s}}]},
+		{"module": "module.www", "mode": "managed", "type": "acme_certificate", "name": "www", "instances": [
+			{"index_key": "a", "attributes": {"certificate_pem": %s, "issuer_pem": %s}}]},
+		{"mode": "data", "type": "tls_self_signed_cert", "name": "ignored", "instances": [{"attributes": {"cert_pem": %s}}]},
+		{"mode": "managed", "type": "tls_private_key", "name": "key", "instances": [{"index_key": 0, "attributes": {"private_key_pem": "x"}}]}
+	]}`, encode(chain[2]), encode(chain[0]), encode(chain[1], chain[2]), encode(chain[0]))
+	certs, err := ParseTerraform([]byte(state))
+	if err != nil {
+		t.Fatalf("Could not parse state: %s", err)
+	}
+	var found []string
+	for _, cert := range certs {
+		found = append(found, fmt.Sprintf("%s.%s %s", cert.Address, cert.Attribute, cert.Cert.Subject.CommonName))
+	}
+	expected := `tls_self_signed_cert.root.cert_pem Σ Acme Co Root
+module.www.acme_certificate.www["a"].certificate_pem www.example.com
+module.www.acme_certificate.www["a"].issuer_pem Σ Acme Co Issuing CA
+module.www.acme_certificate.www["a"].issuer_pem Σ Acme Co Root`
+	if strings.Join(found, "\n") != expected {
+		t.Errorf("Unexpected certificates in state:\n%s", strings.Join(found, "\n"))
+	}
+
+	// A plan lists the existing certificate in both the prior state and the
+	// planned values, and one yet to be created in neither
+	plan := fmt.Sprintf(`{"format_version": "1.2",
+		"planned_values": {"root_module": {"child_modules": [{"resources": [
+			{"address": "module.pki.tls_locally_signed_cert.issuing", "type": "tls_locally_signed_cert", "values": {"cert_pem": %s, "ca_cert_pem": null}},
+			{"address": "module.pki.tls_self_signed_cert.new", "type": "tls_self_signed_cert", "values": {}}]}]}},
+		"prior_state": {"values": {"root_module": {"child_modules": [{"resources": [
+			{"address": "module.pki.tls_locally_signed_cert.issuing", "type": "tls_locally_signed_cert", "values": {"cert_pem": %s}}]}]}}}
+	}`, encode(chain[1]), encode(chain[1]))
+	if certs, err = ParseTerraform([]byte(plan)); err != nil {
+		t.Fatalf("Could not parse plan: %s", err)
+	}
+	if len(certs) != 1 || certs[0].Address != "module.pki.tls_locally_signed_cert.issuing" || !certs[0].Cert.Equal(chain[1]) {
+		t.Errorf("Unexpected certificates in plan %+v", certs)
+	}
+
+	if _, err := ParseTerraform([]byte(`{"version": 4`)); err == nil {
+		t.Errorf("Expected an error for truncated JSON")
+	}
+	bad := `{"values": {"root_module": {"resources": [{"address": "tls_self_signed_cert.bad", "type": "tls_self_signed_cert", "values": {"cert_pem": "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"}}]}}}`
+	if _, err := ParseTerraform([]byte(bad)); err == nil || !strings.Contains(err.Error(), "tls_self_signed_cert.bad.cert_pem") {
+		t.Errorf("Expected an error naming the bad certificate, got %v", err)
+	}
+}
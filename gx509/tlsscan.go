@@ -0,0 +1,136 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+)
+
+// tlsVersions names the TLS versions a scan can ask for.
+var tlsVersions = []struct {
+	name    string
+	version uint16
+}{
+	{"1.0", tls.VersionTLS10},
+	{"1.1", tls.VersionTLS11},
+	{"1.2", tls.VersionTLS12},
+	{"1.3", tls.VersionTLS13},
+}
+
+// ParseTLSVersion returns the TLS version named s, such as "1.2".
+func ParseTLSVersion(s string) (uint16, error) {
+	for _, v := range tlsVersions {
+		if v.name == s {
+			return v.version, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown TLS version %q", s)
+}
+
+// TLSVersionName returns the name of TLS version, such as "TLS 1.2".
+func TLSVersionName(version uint16) string {
+	for _, v := range tlsVersions {
+		if v.version == version {
+			return "TLS " + v.name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// TLSScanOptions shape the handshake of ScanTLS.
+type TLSScanOptions struct {
+	// ServerName is the SNI to send, or the host of the address if empty.
+	ServerName string
+	// ALPN are the application protocols to offer, if any.
+	ALPN []string
+	// MinVersion and MaxVersion bound the TLS versions offered, or are the
+	// crypto/tls defaults if zero.
+	MinVersion uint16
+	MaxVersion uint16
+	// StartTLS is the protocol, one of StartTLSProtocols, in which to
+	// negotiate STARTTLS before the handshake, or empty for none.
+	StartTLS string
+	// Timeout bounds the whole scan, if set.
+	Timeout time.Duration
+}
+
+// A TLSScan is what a TLS server presented in a handshake.
+type TLSScan struct {
+	// Address is the host and port connected to, and ServerName the SNI sent.
+	Address    string
+	ServerName string
+	// StartTLS is the protocol STARTTLS was negotiated in, if any.
+	StartTLS string
+
+	Version     uint16
+	CipherSuite uint16
+	// ALPN is the application protocol negotiated, if any.
+	ALPN         string
+	Certificates []*x509.Certificate
+}
+
+// ScanTLS completes a TLS handshake with the server at address, a host and
+// port, after negotiating STARTTLS if asked to, and returns the chain it
+// presented and what was negotiated. The chain is not verified.
+func ScanTLS(address string, options TLSScanOptions) (*TLSScan, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	serverName := options.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	dialer := &net.Dialer{Timeout: options.Timeout}
+	raw, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+	if options.Timeout > 0 {
+		raw.SetDeadline(time.Now().Add(options.Timeout))
+	}
+	if len(options.StartTLS) > 0 {
+		if err := startTLS(raw, options.StartTLS, serverName); err != nil {
+			return nil, fmt.Errorf("Could not negotiate STARTTLS: %s", err)
+		}
+	}
+	conn := tls.Client(raw, &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         options.ALPN,
+		MinVersion:         options.MinVersion,
+		MaxVersion:         options.MaxVersion,
+		InsecureSkipVerify: true,
+	})
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := conn.ConnectionState()
+	scan := &TLSScan{
+		Address:     address,
+		ServerName:  serverName,
+		StartTLS:    options.StartTLS,
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ALPN:        state.NegotiatedProtocol,
+	}
+	// crypto/tls parses with the standard library, so parse them again here
+	for _, peer := range state.PeerCertificates {
+		cert, err := x509.ParseCertificate(peer.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse certificate: %s", err)
+		}
+		scan.Certificates = append(scan.Certificates, cert)
+	}
+	if len(scan.Certificates) == 0 {
+		return nil, fmt.Errorf("Server presented no certificates")
+	}
+	return scan, nil
+}
@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestScanTLS(t *testing.T) {
+	t.Parallel()
+
+	key, _ := testECKey(t)
+	leaf := certifyKey(t, "localhost", &key.PublicKey)
+	intermediate := testChain(t, "www.example.com")[1]
+	serverNames := make(chan string, 4)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			serverNames <- hello.ServerName
+			return &tls.Certificate{Certificate: [][]byte{leaf.Raw, intermediate.Raw}, PrivateKey: key}, nil
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	scan, err := ScanTLS(listener.Addr().String(), TLSScanOptions{
+		ServerName: "www.example.com",
+		ALPN:       []string{"http/1.1"},
+		MaxVersion: tls.VersionTLS12,
+		Timeout:    5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Could not scan: %s", err)
+	}
+	if scan.ServerName != "www.example.com" || <-serverNames != "www.example.com" {
+		t.Errorf("Expected to send SNI www.example.com")
+	}
+	if scan.Version != tls.VersionTLS12 || TLSVersionName(scan.Version) != "TLS 1.2" || scan.ALPN != "http/1.1" || scan.CipherSuite == 0 {
+		t.Errorf("Unexpected negotiation: %s, %q, cipher suite %x", TLSVersionName(scan.Version), scan.ALPN, scan.CipherSuite)
+	}
+	if len(scan.Certificates) != 2 || !scan.Certificates[0].Equal(leaf) || !scan.Certificates[1].Equal(intermediate) {
+		t.Errorf("Unexpected chain of %d certificates", len(scan.Certificates))
+	}
+
+	// Without SNI, the host is sent, though IP addresses are not
+	if scan, err = ScanTLS(listener.Addr().String(), TLSScanOptions{Timeout: 5 * time.Second}); err != nil || scan.ServerName != "127.0.0.1" {
+		t.Errorf("Expected to scan with the host as server name, got %v", err)
+	}
+	<-serverNames
+	if _, err := ScanTLS(listener.Addr().String(), TLSScanOptions{MaxVersion: tls.VersionTLS11, Timeout: 5 * time.Second}); err == nil {
+		t.Errorf("Expected the handshake to fail below the server's minimum version")
+	}
+
+	for _, name := range []string{"1.0", "1.1", "1.2", "1.3"} {
+		if version, err := ParseTLSVersion(name); err != nil || TLSVersionName(version) != "TLS "+name {
+			t.Errorf("Could not round-trip TLS %s", name)
+		}
+	}
+	if _, err := ParseTLSVersion("3.0"); err == nil {
+		t.Errorf("Expected an error parsing an unknown version")
+	}
+}
@@ -0,0 +1,135 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// A TrendPoint counts the certificates a warehouse held at the time of one
+// scan.
+type TrendPoint struct {
+	Time         time.Time `json:"time"`
+	Certificates int       `json:"certificates"`
+	// UnconstrainedIntermediates are judged by the Mozilla policy in force
+	// at Time.
+	UnconstrainedIntermediates int `json:"unconstrainedIntermediates"`
+	WeakKeys                   int `json:"weakKeys"`
+	// Expiring counts the certificates that expire within the window
+	// after Time.
+	Expiring int `json:"expiring"`
+}
+
+// Trends counts the certificates the warehouse held at each time a scan
+// stored one, oldest first. The warehouse keeps only when each certificate
+// was first and last seen, so a certificate counts as held at every scan
+// between the two.
+func (w *Warehouse) Trends(expiringWithin time.Duration) []TrendPoint {
+	entries := w.Entries()
+	seen := make(map[int64]bool)
+	var times []time.Time
+	for _, entry := range entries {
+		for _, t := range []time.Time{entry.FirstSeen, entry.LastSeen} {
+			if !seen[t.UnixNano()] {
+				seen[t.UnixNano()] = true
+				times = append(times, t)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	points := make([]TrendPoint, len(times))
+	for i, t := range times {
+		point := TrendPoint{Time: t}
+		for _, entry := range entries {
+			if t.Before(entry.FirstSeen) || t.After(entry.LastSeen) {
+				continue
+			}
+			cert := entry.Certificate
+			point.Certificates++
+			if cert.IsCA && !isSelfSigned(cert) {
+				if !AnalyzeTechnicalConstraintsForPolicy(cert, MozillaPolicyAt(t)).Constrained {
+					point.UnconstrainedIntermediates++
+				}
+			}
+			if _, weak := DescribeKey(cert.PublicKey); weak {
+				point.WeakKeys++
+			}
+			if t.Before(cert.NotAfter) && !t.Add(expiringWithin).Before(cert.NotAfter) {
+				point.Expiring++
+			}
+		}
+		points[i] = point
+	}
+	return points
+}
+
+// trendSeries are the series WriteTrendSVG plots, with their colours.
+var trendSeries = []struct {
+	name   string
+	colour string
+	value  func(TrendPoint) int
+}{
+	{"Unconstrained intermediates", "#d62728", func(p TrendPoint) int { return p.UnconstrainedIntermediates }},
+	{"Weak keys", "#ff7f0e", func(p TrendPoint) int { return p.WeakKeys }},
+	{"Expiring", "#1f77b4", func(p TrendPoint) int { return p.Expiring }},
+}
+
+// WriteTrendSVG charts points as a standalone SVG line chart.
+func WriteTrendSVG(w io.Writer, points []TrendPoint) error {
+	const width, height, margin = 800, 400, 50
+	plotWidth, plotHeight := float64(width-2*margin), float64(height-2*margin)
+
+	maximum := 1
+	for _, point := range points {
+		for _, series := range trendSeries {
+			if value := series.value(point); value > maximum {
+				maximum = value
+			}
+		}
+	}
+	x := func(t time.Time) float64 {
+		if len(points) < 2 || !points[len(points)-1].Time.After(points[0].Time) {
+			return margin + plotWidth/2
+		}
+		span := points[len(points)-1].Time.Sub(points[0].Time)
+		return margin + plotWidth*float64(t.Sub(points[0].Time))/float64(span)
+	}
+	y := func(value int) float64 {
+		return margin + plotHeight*(1-float64(value)/float64(maximum))
+	}
+
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"12\">\n", width, height)
+	printf("<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+	printf("<path d=\"M%d %d V%d H%d\" stroke=\"black\" fill=\"none\"/>\n", margin, margin, height-margin, width-margin)
+	printf("<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%d</text>\n", margin-5, margin+4, maximum)
+	printf("<text x=\"%d\" y=\"%d\" text-anchor=\"end\">0</text>\n", margin-5, height-margin+4)
+	if len(points) > 0 {
+		printf("<text x=\"%d\" y=\"%d\">%s</text>\n", margin, height-margin+18, points[0].Time.Format("2006-01-02"))
+		printf("<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%s</text>\n", width-margin, height-margin+18, points[len(points)-1].Time.Format("2006-01-02"))
+	}
+	for i, series := range trendSeries {
+		printf("<polyline stroke=\"%s\" stroke-width=\"2\" fill=\"none\" points=\"", series.colour)
+		for j, point := range points {
+			if j > 0 {
+				printf(" ")
+			}
+			printf("%.1f,%.1f", x(point.Time), y(series.value(point)))
+		}
+		printf("\"/>\n")
+		printf("<text x=\"%d\" y=\"%d\" fill=\"%s\">%s</text>\n", margin+10+200*i, margin-15, series.colour, series.name)
+	}
+	printf("</svg>\n")
+	return err
+}
@@ -0,0 +1,69 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarehouseTrends(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "warehouse.db")
+	w, _ := OpenWarehouse(path)
+	chain := testChain(t, "www.example.com")
+	first := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	third := time.Date(2018, time.July, 1, 0, 0, 0, 0, time.UTC)
+	w.Add(chain[0], "www.example.com:443", first)
+	w.Add(chain[0], "www.example.com:443", second)
+	w.Add(chain[1], "www.example.com:443", second)
+	w.Add(chain[2], "roots", third)
+	if err := w.Save(); err != nil {
+		t.Fatalf("Could not save warehouse: %s", err)
+	}
+	// Times read back from the file must still identify the same scans
+	w, err := OpenWarehouse(path)
+	if err != nil {
+		t.Fatalf("Could not reopen warehouse: %s", err)
+	}
+
+	// The test key is weak, the issuing CA has no iPAddress constraints and
+	// the leaf expires on 1 June
+	points := w.Trends(90 * 24 * time.Hour)
+	expected := []TrendPoint{
+		{Time: first, Certificates: 1, WeakKeys: 1, Expiring: 1},
+		{Time: second, Certificates: 2, UnconstrainedIntermediates: 1, WeakKeys: 2, Expiring: 1},
+		{Time: third, Certificates: 1, WeakKeys: 1},
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %+v", len(expected), points)
+	}
+	for i := range points {
+		if !points[i].Time.Equal(expected[i].Time) {
+			t.Errorf("Point %d: expected time %s, got %s", i, expected[i].Time, points[i].Time)
+		}
+		points[i].Time = expected[i].Time
+	}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, points)
+	}
+
+	var svg bytes.Buffer
+	if err := WriteTrendSVG(&svg, points); err != nil {
+		t.Fatalf("Could not write SVG: %s", err)
+	}
+	if !strings.HasPrefix(svg.String(), "<svg ") || strings.Count(svg.String(), "<polyline ") != 3 {
+		t.Errorf("Unexpected SVG %s", svg.String())
+	}
+	if !strings.Contains(svg.String(), "2018-04-01") || !strings.Contains(svg.String(), "2018-07-01") {
+		t.Errorf("Expected the first and last dates on the axis, got %s", svg.String())
+	}
+}
@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+// RootAge summarizes the health of one trust anchor.
+type RootAge struct {
+	Cert *x509.Certificate
+	// DaysRemaining is negative once the root has expired.
+	DaysRemaining int
+	Expired       bool
+	// ExpiringSoon is true if the root expires within the report horizon.
+	ExpiringSoon bool
+	Key          string
+	WeakKey      bool
+	// Constrained and ConstraintDetails are the verdict and details of
+	// AnalyzeTechnicalConstraints.
+	Constrained       bool
+	ConstraintDetails string
+}
+
+// AgeTrustStore reports on each root as of at, flagging those that have
+// expired or will expire within horizon, have weak keys, or are technically
+// constrained. The result is ordered by expiry date.
+func AgeTrustStore(roots []*x509.Certificate, at time.Time, horizon time.Duration) []RootAge {
+	report := make([]RootAge, 0, len(roots))
+	for _, root := range roots {
+		age := RootAge{
+			Cert:          root,
+			DaysRemaining: int(root.NotAfter.Sub(at).Hours() / 24),
+			Expired:       at.After(root.NotAfter),
+		}
+		age.ExpiringSoon = !age.Expired && root.NotAfter.Before(at.Add(horizon))
+		age.Key, age.WeakKey = DescribeKey(root.PublicKey)
+		analysis := AnalyzeTechnicalConstraints(root)
+		age.Constrained, age.ConstraintDetails = analysis.Constrained, analysis.Details()
+		report = append(report, age)
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Cert.NotAfter.Before(report[j].Cert.NotAfter)
+	})
+	return report
+}
+
+// ExpiryTimeline counts the roots in report by the year in which they expire.
+func ExpiryTimeline(report []RootAge) map[int]int {
+	timeline := make(map[int]int)
+	for _, age := range report {
+		timeline[age.Cert.NotAfter.Year()]++
+	}
+	return timeline
+}
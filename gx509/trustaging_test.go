@@ -0,0 +1,46 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestAgeTrustStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	expired := testCA(t, "Expired Root", nil, now.AddDate(0, -1, 0))
+	soon := testCA(t, "Soon Root", nil, now.AddDate(0, 6, 0))
+	later := testCA(t, "Later Root", nil, now.AddDate(10, 0, 0))
+
+	report := AgeTrustStore([]*x509.Certificate{later, soon, expired}, now, 365*24*time.Hour)
+	if len(report) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(report))
+	}
+
+	if report[0].Cert != expired || !report[0].Expired || report[0].DaysRemaining >= 0 {
+		t.Errorf("Expected the expired root first: %+v", report[0])
+	}
+	if report[1].Cert != soon || !report[1].ExpiringSoon || report[1].Expired {
+		t.Errorf("Expected the expiring root second: %+v", report[1])
+	}
+	if report[2].Cert != later || report[2].ExpiringSoon {
+		t.Errorf("Expected the long-lived root last: %+v", report[2])
+	}
+
+	for _, age := range report {
+		if !age.WeakKey || age.Key != "RSA 512" {
+			t.Errorf("Expected a weak 512-bit key, got %s", age.Key)
+		}
+	}
+
+	timeline := ExpiryTimeline(report)
+	if timeline[2019] != 1 || timeline[2020] != 1 || timeline[2030] != 1 {
+		t.Errorf("Unexpected timeline: %v", timeline)
+	}
+}
@@ -0,0 +1,287 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxServerLeafLifetime is the longest lifetime browsers accept for TLS
+// server certificates issued since September 2020.
+const maxServerLeafLifetime = 398 * 24 * time.Hour
+
+// VaultPKI reads a HashiCorp Vault PKI secrets engine through the HTTP API.
+type VaultPKI struct {
+	// Address is the Vault server, as in VAULT_ADDR.
+	Address   string
+	Token     string
+	Namespace string
+	// Mount is the path the secrets engine is mounted at, such as "pki".
+	Mount  string
+	Client *http.Client
+}
+
+// NewVaultPKI returns a client for the PKI secrets engine mounted at mount.
+func NewVaultPKI(address, token, mount string) *VaultPKI {
+	return &VaultPKI{
+		Address: strings.TrimSuffix(address, "/"),
+		Token:   token,
+		Mount:   strings.Trim(mount, "/"),
+		Client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// ErrVaultNotFound is returned for paths the secrets engine does not have,
+// such as the issuers of Vault versions before 1.11.
+var ErrVaultNotFound = errors.New("Not found in Vault")
+
+// read makes an API request with method, which is GET or LIST, for the path
+// under the mount and decodes the data of the response into data.
+func (v *VaultPKI) read(method, path string, data interface{}) error {
+	req, err := http.NewRequest(method, v.Address+"/v1/"+v.Mount+"/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if len(v.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrVaultNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Vault returned %s for %s", resp.Status, path)
+	}
+	response := struct {
+		Data interface{} `json:"data"`
+	}{data}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("Could not decode Vault response for %s: %s", path, err)
+	}
+	return nil
+}
+
+// list returns the keys under path, or none if there are none.
+func (v *VaultPKI) list(path string) ([]string, error) {
+	var data struct {
+		Keys []string `json:"keys"`
+	}
+	if err := v.read("LIST", path, &data); err == ErrVaultNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return data.Keys, nil
+}
+
+// readCertificate returns the first certificate in the PEM at path.
+func (v *VaultPKI) readCertificate(path string) (*x509.Certificate, error) {
+	var data struct {
+		Certificate string `json:"certificate"`
+	}
+	if err := v.read("GET", path, &data); err != nil {
+		return nil, err
+	}
+	certs, err := parseCertificatesPEM([]byte(data.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", path, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s has no certificate", path)
+	}
+	return certs[0], nil
+}
+
+// A VaultIssuer is a CA certificate the secrets engine issues from.
+type VaultIssuer struct {
+	ID   string
+	Name string
+	// Default is whether roles that do not name an issuer use this one.
+	Default bool
+	Cert    *x509.Certificate
+}
+
+// Issuers returns the mount's issuers. Before Vault 1.11 each mount has one,
+// which is returned with the ID "default".
+func (v *VaultPKI) Issuers() ([]VaultIssuer, error) {
+	ids, err := v.list("issuers")
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		cert, err := v.readCertificate("cert/ca")
+		if err == ErrVaultNotFound {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return []VaultIssuer{{ID: "default", Default: true, Cert: cert}}, nil
+	}
+
+	var config struct {
+		Default string `json:"default"`
+	}
+	if err := v.read("GET", "config/issuers", &config); err != nil && err != ErrVaultNotFound {
+		return nil, err
+	}
+	var issuers []VaultIssuer
+	for _, id := range ids {
+		var data struct {
+			Name        string `json:"issuer_name"`
+			Certificate string `json:"certificate"`
+		}
+		if err := v.read("GET", "issuer/"+url.PathEscape(id)+"/json", &data); err != nil {
+			return nil, err
+		}
+		certs, err := parseCertificatesPEM([]byte(data.Certificate))
+		if err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("Could not parse the certificate of issuer %s: %v", id, err)
+		}
+		issuers = append(issuers, VaultIssuer{ID: id, Name: data.Name, Default: id == config.Default, Cert: certs[0]})
+	}
+	return issuers, nil
+}
+
+// Certificates returns the certificates the mount has issued and stored,
+// which leaves out those issued by roles with no_store set.
+func (v *VaultPKI) Certificates() ([]*x509.Certificate, error) {
+	serials, err := v.list("certs")
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, serial := range serials {
+		cert, err := v.readCertificate("cert/" + url.PathEscape(serial))
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// A VaultRole is the configuration of a role that issues certificates.
+type VaultRole struct {
+	Name string `json:"-"`
+	// IssuerRef is the name or ID of the issuer the role uses, or "default".
+	IssuerRef        string        `json:"issuer_ref"`
+	AllowedDomains   []string      `json:"allowed_domains"`
+	AllowAnyName     bool          `json:"allow_any_name"`
+	AllowBareDomains bool          `json:"allow_bare_domains"`
+	AllowSubdomains  bool          `json:"allow_subdomains"`
+	AllowGlobDomains bool          `json:"allow_glob_domains"`
+	AllowIPSANs      bool          `json:"allow_ip_sans"`
+	EnforceHostnames bool          `json:"enforce_hostnames"`
+	ServerFlag       bool          `json:"server_flag"`
+	KeyType          string        `json:"key_type"`
+	KeyBits          int           `json:"key_bits"`
+	NoStore          bool          `json:"no_store"`
+	MaxTTL           time.Duration `json:"-"`
+}
+
+// Roles returns the mount's roles.
+func (v *VaultPKI) Roles() ([]VaultRole, error) {
+	names, err := v.list("roles")
+	if err != nil {
+		return nil, err
+	}
+	var roles []VaultRole
+	for _, name := range names {
+		var data struct {
+			VaultRole
+			// Seconds, or a duration string in older versions
+			MaxTTL interface{} `json:"max_ttl"`
+		}
+		if err := v.read("GET", "roles/"+url.PathEscape(name), &data); err != nil {
+			return nil, err
+		}
+		role := data.VaultRole
+		role.Name = name
+		switch maxTTL := data.MaxTTL.(type) {
+		case float64:
+			role.MaxTTL = time.Duration(maxTTL) * time.Second
+		case string:
+			if role.MaxTTL, err = time.ParseDuration(maxTTL); err != nil && maxTTL != "" {
+				return nil, fmt.Errorf("Role %s has an invalid max_ttl: %s", name, maxTTL)
+			}
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// Issuer returns the issuer the role uses, or nil if it is not one of
+// issuers.
+func (r VaultRole) Issuer(issuers []VaultIssuer) *VaultIssuer {
+	for i, issuer := range issuers {
+		if issuer.ID == r.IssuerRef || (len(issuer.Name) > 0 && issuer.Name == r.IssuerRef) ||
+			(issuer.Default && (r.IssuerRef == "default" || len(r.IssuerRef) == 0)) {
+			return &issuers[i]
+		}
+	}
+	return nil
+}
+
+// AuditVaultRole returns the ways certificates the role issues from issuer,
+// which may be nil, would violate the issuer's name constraints or browser
+// requirements.
+func AuditVaultRole(role VaultRole, issuer *x509.Certificate) []string {
+	var problems []string
+	if role.AllowAnyName {
+		problems = append(problems, "allow_any_name lets it issue for any name")
+	}
+	if !role.EnforceHostnames {
+		problems = append(problems, "enforce_hostnames is off, so names need not be valid hostnames")
+	}
+	if role.AllowGlobDomains {
+		for _, domain := range role.AllowedDomains {
+			if strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+				problems = append(problems, fmt.Sprintf("glob %s matches names in any domain", domain))
+			}
+		}
+	}
+
+	if issuer != nil {
+		for _, domain := range role.AllowedDomains {
+			name := strings.TrimPrefix(domain, "*.")
+			if !dnsNamePermitted(issuer, name, false) {
+				problems = append(problems, fmt.Sprintf("allowed domain %s is outside the issuer's name constraints", domain))
+			}
+		}
+		if analysis := AnalyzeTechnicalConstraints(issuer); role.AllowIPSANs && analysis.ExcludesAllIPv4 && analysis.ExcludesAllIPv6 {
+			problems = append(problems, "allow_ip_sans is on, but the issuer's name constraints exclude every IP address")
+		}
+	}
+
+	switch role.KeyType {
+	case "any":
+		problems = append(problems, "key_type any signs keys of any type and size")
+	case "rsa":
+		if role.KeyBits != 0 && role.KeyBits < 2048 {
+			problems = append(problems, fmt.Sprintf("key_bits %d allows weak RSA keys", role.KeyBits))
+		}
+	}
+	if role.ServerFlag && role.MaxTTL > maxServerLeafLifetime {
+		problems = append(problems, fmt.Sprintf("max_ttl of %d days exceeds the %d day limit for TLS server certificates",
+			int(role.MaxTTL/(24*time.Hour)), int(maxServerLeafLifetime/(24*time.Hour))))
+	}
+	if role.NoStore {
+		problems = append(problems, "no_store leaves the certificates it issues out of audits")
+	}
+	return problems
+}
@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeVault serves a PKI mount at pki with responses holding data for each
+// method and path.
+func fakeVault(t *testing.T, responses map[string]interface{}) (*VaultPKI, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		data, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	return NewVaultPKI(server.URL+"/", "s.token", "/pki/"), server
+}
+
+func certificatePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func TestVaultPKI(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	client, server := fakeVault(t, map[string]interface{}{
+		"LIST /v1/pki/issuers":       map[string]interface{}{"keys": []string{"a1", "b2"}},
+		"GET /v1/pki/config/issuers": map[string]interface{}{"default": "b2"},
+		"GET /v1/pki/issuer/a1/json": map[string]interface{}{"issuer_name": "root", "certificate": certificatePEM(chain[2])},
+		"GET /v1/pki/issuer/b2/json": map[string]interface{}{"issuer_name": "issuing", "certificate": certificatePEM(chain[1])},
+		"LIST /v1/pki/certs":         map[string]interface{}{"keys": []string{"01-02"}},
+		"GET /v1/pki/cert/01-02":     map[string]interface{}{"certificate": certificatePEM(chain[0])},
+		"LIST /v1/pki/roles":         map[string]interface{}{"keys": []string{"web"}},
+		"GET /v1/pki/roles/web":      map[string]interface{}{"allowed_domains": []string{"example.com"}, "allow_subdomains": true, "enforce_hostnames": true, "key_type": "rsa", "key_bits": 2048, "max_ttl": 2592000, "issuer_ref": "default"},
+	})
+	defer server.Close()
+
+	issuers, err := client.Issuers()
+	if err != nil {
+		t.Fatalf("Could not list issuers: %s", err)
+	}
+	if len(issuers) != 2 || issuers[0].Name != "root" || issuers[0].Default || !issuers[1].Default || !issuers[1].Cert.Equal(chain[1]) {
+		t.Errorf("Unexpected issuers %+v", issuers)
+	}
+
+	certs, err := client.Certificates()
+	if err != nil || len(certs) != 1 || !certs[0].Equal(chain[0]) {
+		t.Errorf("Unexpected certificates %v: %v", certs, err)
+	}
+
+	roles, err := client.Roles()
+	if err != nil {
+		t.Fatalf("Could not list roles: %s", err)
+	}
+	expected := VaultRole{Name: "web", IssuerRef: "default", AllowedDomains: []string{"example.com"}, AllowSubdomains: true,
+		EnforceHostnames: true, KeyType: "rsa", KeyBits: 2048, MaxTTL: 30 * 24 * time.Hour}
+	if len(roles) != 1 || !reflect.DeepEqual(roles[0], expected) {
+		t.Fatalf("Unexpected roles %+v", roles)
+	}
+	if issuer := roles[0].Issuer(issuers); issuer == nil || issuer.ID != "b2" {
+		t.Errorf("Expected the role to use the default issuer, got %+v", issuer)
+	}
+	if problems := AuditVaultRole(roles[0], chain[1]); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	client.Token = "s.wrong"
+	if _, err := client.Roles(); err == nil {
+		t.Errorf("Expected an error without permission")
+	}
+}
+
+func TestVaultPKIWithoutIssuers(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	client, server := fakeVault(t, map[string]interface{}{
+		"GET /v1/pki/cert/ca": map[string]interface{}{"certificate": certificatePEM(chain[1])},
+	})
+	defer server.Close()
+
+	issuers, err := client.Issuers()
+	if err != nil || len(issuers) != 1 || issuers[0].ID != "default" || !issuers[0].Cert.Equal(chain[1]) {
+		t.Errorf("Expected the mount's only CA, got %+v: %v", issuers, err)
+	}
+	if roles, err := client.Roles(); err != nil || len(roles) != 0 {
+		t.Errorf("Expected no roles, got %+v: %v", roles, err)
+	}
+}
+
+func TestAuditVaultRole(t *testing.T) {
+	t.Parallel()
+
+	issuer := serialiseAndParse(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Σ Acme Co Internal"},
+		NotBefore:             time.Date(2017, time.December, 1, 23, 59, 59, 59, time.UTC),
+		NotAfter:              time.Date(2029, time.December, 1, 23, 59, 59, 59, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomains:   []string{"internal.example.com"},
+	})
+
+	role := VaultRole{
+		Name:             "everything",
+		AllowedDomains:   []string{"*.internal.example.com", "www.example.org", "*"},
+		AllowAnyName:     true,
+		AllowGlobDomains: true,
+		ServerFlag:       true,
+		KeyType:          "rsa",
+		KeyBits:          1024,
+		MaxTTL:           825 * 24 * time.Hour,
+		NoStore:          true,
+	}
+	expected := []string{
+		"allow_any_name lets it issue for any name",
+		"enforce_hostnames is off, so names need not be valid hostnames",
+		"glob * matches names in any domain",
+		"allowed domain www.example.org is outside the issuer's name constraints",
+		"allowed domain * is outside the issuer's name constraints",
+		"key_bits 1024 allows weak RSA keys",
+		"max_ttl of 825 days exceeds the 398 day limit for TLS server certificates",
+		"no_store leaves the certificates it issues out of audits",
+	}
+	if problems := AuditVaultRole(role, issuer); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems:\n%v", problems)
+	}
+}
@@ -0,0 +1,170 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Verdict is what the service concluded about one certificate.
+type Verdict struct {
+	Fingerprint string `json:"fingerprint"`
+	Subject     string `json:"subject"`
+	Policy      string `json:"policy"`
+	Constrained bool   `json:"constrained"`
+	// FailedLints are the lints the certificate failed, and Alerts the
+	// alerts raised about it.
+	FailedLints []string `json:"failedLints,omitempty"`
+	Alerts      []string `json:"alerts,omitempty"`
+}
+
+// NewVerdict returns the verdict on cert under policy, with the constraint
+// analysis done.
+func NewVerdict(cert *x509.Certificate, policy Policy) Verdict {
+	return Verdict{
+		Fingerprint: fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+		Subject:     cert.Subject.CommonName,
+		Policy:      policy.Name,
+		Constrained: AnalyzeTechnicalConstraintsForPolicy(cert, policy).Constrained,
+	}
+}
+
+// A VerdictRecord is a line of a VerdictLog: the verdicts the service
+// rendered on one input, and enough to trace them later.
+type VerdictRecord struct {
+	Time time.Time `json:"time"`
+	// Caller is who asked: a tenant or a daemon job. Address is where a
+	// request came from.
+	Caller  string `json:"caller"`
+	Address string `json:"address,omitempty"`
+	// Source is where a daemon job found the input.
+	Source string `json:"source,omitempty"`
+	// InputHash is the SHA-256 hash of the input: a request body, or the
+	// concatenated DER of the certificates a job found.
+	InputHash string `json:"inputHash"`
+	// PolicyHash identifies the configuration the verdicts were reached
+	// under; see ConfigHash.
+	PolicyHash string    `json:"policyHash"`
+	Verdicts   []Verdict `json:"verdicts"`
+}
+
+// ConfigHash returns the SHA-256 hash of the JSON encoding of v, to record
+// in a VerdictRecord which configuration produced it.
+func ConfigHash(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("Could not encode configuration: %s", err))
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// CertificatesHash returns the SHA-256 hash of the concatenated DER of certs.
+func CertificatesHash(certs []*x509.Certificate) string {
+	h := sha256.New()
+	for _, cert := range certs {
+		h.Write(cert.Raw)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// A VerdictLog is an append-only audit log of verdicts, one JSON record a
+// line. Once the file would grow past MaxSize bytes it is rotated: renamed
+// to Path.1, shifting older files up to Path.<MaxBackups>, the oldest of
+// which is removed.
+type VerdictLog struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenVerdictLog opens, or creates, the log at path.
+func OpenVerdictLog(path string, maxSize int64, maxBackups int) (*VerdictLog, error) {
+	log := &VerdictLog{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := log.open(); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+func (l *VerdictLog) open() error {
+	file, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("Could not open verdict log: %s", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Could not open verdict log: %s", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one.
+func (l *VerdictLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if l.MaxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.Path, l.MaxBackups))
+		for i := l.MaxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.Path, i), fmt.Sprintf("%s.%d", l.Path, i+1))
+		}
+		if err := os.Rename(l.Path, l.Path+".1"); err != nil {
+			return fmt.Errorf("Could not rotate verdict log: %s", err)
+		}
+	} else if err := os.Remove(l.Path); err != nil {
+		return fmt.Errorf("Could not rotate verdict log: %s", err)
+	}
+	return l.open()
+}
+
+// Write appends record to the log, rotating it first if need be.
+func (l *VerdictLog) Write(record VerdictRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("Verdict log %s is closed", l.Path)
+	}
+	if l.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("Could not write verdict log: %s", err)
+	}
+	return l.file.Sync()
+}
+
+// Close closes the log.
+func (l *VerdictLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readVerdictLog(t *testing.T, path string) []VerdictRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open %s: %s", path, err)
+	}
+	defer file.Close()
+
+	records, err := ReadVerdictLog(file)
+	if err != nil {
+		t.Fatalf("Could not read %s: %s", path, err)
+	}
+	return records
+}
+
+func TestVerdictLog(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "verdictlog")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "verdicts.jsonl")
+
+	chain := testChain(t, "www.example.com")
+	record := VerdictRecord{
+		Time:       time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Caller:     "web-pki",
+		InputHash:  CertificatesHash(chain),
+		PolicyHash: ConfigHash(DefaultPolicy),
+		Verdicts:   []Verdict{NewVerdict(chain[1], DefaultPolicy)},
+	}
+	line, _ := json.Marshal(record)
+
+	// Room for two records a file
+	log, err := OpenVerdictLog(path, int64(2*len(line)+2), 2)
+	if err != nil {
+		t.Fatalf("Could not open log: %s", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := log.Write(record); err != nil {
+			t.Fatalf("Could not write record %d: %s", i, err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Could not close log: %s", err)
+	}
+
+	for _, test := range []struct {
+		path    string
+		records int
+	}{{path, 1}, {path + ".1", 2}, {path + ".2", 2}} {
+		if records := readVerdictLog(t, test.path); len(records) != test.records {
+			t.Errorf("Expected %d records in %s, got %d", test.records, test.path, len(records))
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups to be kept")
+	}
+
+	got := readVerdictLog(t, path)[0]
+	if got.Caller != "web-pki" || got.InputHash != record.InputHash || len(got.Verdicts) != 1 ||
+		got.Verdicts[0].Constrained || got.Verdicts[0].Policy != DefaultPolicy.Name || got.Verdicts[0].Subject != chain[1].Subject.CommonName {
+		t.Errorf("Unexpected record %+v", got)
+	}
+	if ConfigHash(DefaultPolicy) == ConfigHash(MozillaPolicyAt(time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC))) {
+		t.Errorf("Expected different policies to hash differently")
+	}
+	if err := log.Write(record); err == nil {
+		t.Errorf("Expected an error writing to a closed log")
+	}
+
+	// Reopening appends
+	if log, err = OpenVerdictLog(path, 0, 0); err != nil {
+		t.Fatalf("Could not reopen log: %s", err)
+	}
+	log.Write(record)
+	log.Close()
+	if records := readVerdictLog(t, path); len(records) != 2 {
+		t.Errorf("Expected 2 records after reopening, got %d", len(records))
+	}
+}
@@ -0,0 +1,296 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// warehouseVersion is the version of the warehouse format. Version 1 was a
+// single JSON file, which OpenWarehouse still reads.
+const warehouseVersion = 2
+
+// The tables a Warehouse is kept in: a single row giving its version and
+// retention policy, and a row per certificate, whose times are RFC 3339 and
+// whose sources are space-separated.
+const (
+	warehouseTableSQL    = `CREATE TABLE warehouse (version INTEGER, expired_days INTEGER, unseen_days INTEGER, keep_cas INTEGER)`
+	certificatesTableSQL = `CREATE TABLE certificates (fingerprint TEXT PRIMARY KEY, subject TEXT, issuer TEXT, ` +
+		`not_after TEXT, first_seen TEXT, last_seen TEXT, sources TEXT, der BLOB)`
+)
+
+// A WarehouseEntry is a certificate stored in a Warehouse along with when
+// and where it was seen.
+type WarehouseEntry struct {
+	Certificate *x509.Certificate `json:"-"`
+	Raw         []byte            `json:"der"`
+	FirstSeen   time.Time         `json:"firstSeen"`
+	LastSeen    time.Time         `json:"lastSeen"`
+	// Sources are the addresses or paths the certificate was found at.
+	Sources []string `json:"sources"`
+
+	// verdict, if set, is a stored constraint verdict, which queries use
+	// rather than analyzing the certificate afresh.
+	verdict *bool
+}
+
+// Fingerprint is the SHA-256 hash of the certificate.
+func (e *WarehouseEntry) Fingerprint() [sha256.Size]byte {
+	return sha256.Sum256(e.Raw)
+}
+
+// A RetentionPolicy says which certificates a warehouse drops when it is
+// compacted. The zero policy keeps everything.
+type RetentionPolicy struct {
+	// ExpiredDays drops certificates that expired more than this many days
+	// ago, if set.
+	ExpiredDays int `json:"expiredDays,omitempty"`
+	// UnseenDays drops certificates last seen more than this many days ago,
+	// if set.
+	UnseenDays int `json:"unseenDays,omitempty"`
+	// KeepCAs limits the policy to end-entity certificates, so that CA
+	// certificates are kept however old.
+	KeepCAs bool `json:"keepCAs,omitempty"`
+}
+
+// drops reports whether the policy drops entry as of at.
+func (p RetentionPolicy) drops(entry *WarehouseEntry, at time.Time) bool {
+	if p.KeepCAs && entry.Certificate.IsCA {
+		return false
+	}
+	if p.ExpiredDays > 0 && at.AddDate(0, 0, -p.ExpiredDays).After(entry.Certificate.NotAfter) {
+		return true
+	}
+	return p.UnseenDays > 0 && at.AddDate(0, 0, -p.UnseenDays).After(entry.LastSeen)
+}
+
+// A Warehouse accumulates every certificate harvested by scans, deduplicated
+// by fingerprint. It is kept in an SQLite database, keyed by fingerprint, so
+// it can be queried with any SQLite client. Like a ResultStore, it is read
+// whole and held in memory, and Save streams the whole database to disk and
+// replaces the file atomically.
+type Warehouse struct {
+	// Retention is the policy saved with the warehouse, for Compact.
+	Retention RetentionPolicy
+
+	path    string
+	entries map[[sha256.Size]byte]*WarehouseEntry
+}
+
+// warehouseFile is a version 1 warehouse.
+type warehouseFile struct {
+	Version      int               `json:"version"`
+	Retention    RetentionPolicy   `json:"retention"`
+	Certificates []*WarehouseEntry `json:"certificates"`
+}
+
+// OpenWarehouse reads the warehouse at path, which is empty if the file does
+// not exist yet.
+func OpenWarehouse(path string) (*Warehouse, error) {
+	w := &Warehouse{path: path, entries: make(map[[sha256.Size]byte]*WarehouseEntry)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sqliteMagic) {
+		return w, w.readJSON(data)
+	}
+
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := db.table("warehouse")
+	if err != nil {
+		return nil, err
+	}
+	if len(settings) != 1 {
+		return nil, fmt.Errorf("Expected one row of warehouse settings, got %d", len(settings))
+	}
+	integer := func(column string) int64 {
+		value, _ := settings[0][column].(int64)
+		return value
+	}
+	if version := integer("version"); version != warehouseVersion {
+		return nil, fmt.Errorf("Unsupported warehouse version %d", version)
+	}
+	w.Retention = RetentionPolicy{
+		ExpiredDays: int(integer("expired_days")),
+		UnseenDays:  int(integer("unseen_days")),
+		KeepCAs:     integer("keep_cas") != 0,
+	}
+
+	rows, err := db.table("certificates")
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		entry, err := warehouseEntryFromRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read certificate %d: %s", i+1, err)
+		}
+		w.entries[entry.Fingerprint()] = entry
+	}
+	return w, nil
+}
+
+// readJSON reads a version 1 warehouse into w, which Save then rewrites in
+// SQLite.
+func (w *Warehouse) readJSON(data []byte) error {
+	var file warehouseFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("Could not decode warehouse: %s", err)
+	}
+	if file.Version != 1 {
+		return fmt.Errorf("Unsupported warehouse version %d", file.Version)
+	}
+	w.Retention = file.Retention
+	for i, entry := range file.Certificates {
+		var err error
+		if entry.Certificate, err = x509.ParseCertificate(entry.Raw); err != nil {
+			return fmt.Errorf("Could not parse certificate %d: %s", i, err)
+		}
+		w.entries[entry.Fingerprint()] = entry
+	}
+	return nil
+}
+
+// warehouseEntryFromRow decodes the certificate, times and sources of a row
+// of the certificates or results table.
+func warehouseEntryFromRow(row map[string]interface{}) (*WarehouseEntry, error) {
+	text := func(column string) string {
+		value, _ := row[column].(string)
+		return value
+	}
+	der, _ := row["der"].([]byte)
+	cert, err := parseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	entry := &WarehouseEntry{Certificate: cert, Raw: der, Sources: strings.Fields(text("sources"))}
+	if entry.FirstSeen, err = time.Parse(time.RFC3339, text("first_seen")); err != nil {
+		return nil, err
+	}
+	if entry.LastSeen, err = time.Parse(time.RFC3339, text("last_seen")); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Add records that cert was seen at source and returns true if it is new to
+// the warehouse.
+func (w *Warehouse) Add(cert *x509.Certificate, source string, at time.Time) bool {
+	fingerprint := sha256.Sum256(cert.Raw)
+	entry, ok := w.entries[fingerprint]
+	if !ok {
+		entry = &WarehouseEntry{Certificate: cert, Raw: cert.Raw, FirstSeen: at, LastSeen: at}
+		w.entries[fingerprint] = entry
+	}
+	if at.Before(entry.FirstSeen) {
+		entry.FirstSeen = at
+	}
+	if at.After(entry.LastSeen) {
+		entry.LastSeen = at
+	}
+
+	i := sort.SearchStrings(entry.Sources, source)
+	if len(source) > 0 && (i == len(entry.Sources) || entry.Sources[i] != source) {
+		entry.Sources = append(entry.Sources, "")
+		copy(entry.Sources[i+1:], entry.Sources[i:])
+		entry.Sources[i] = source
+	}
+	return !ok
+}
+
+// Get returns the entry for the certificate with the given fingerprint.
+func (w *Warehouse) Get(fingerprint [sha256.Size]byte) (*WarehouseEntry, bool) {
+	entry, ok := w.entries[fingerprint]
+	return entry, ok
+}
+
+// Len is the number of certificates in the warehouse.
+func (w *Warehouse) Len() int {
+	return len(w.entries)
+}
+
+// Entries returns the certificates in the warehouse, in the order they were
+// first seen.
+func (w *Warehouse) Entries() []*WarehouseEntry {
+	entries := make([]*WarehouseEntry, 0, len(w.entries))
+	for _, entry := range w.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].FirstSeen.Equal(entries[j].FirstSeen) {
+			return entries[i].FirstSeen.Before(entries[j].FirstSeen)
+		}
+		a, b := entries[i].Fingerprint(), entries[j].Fingerprint()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return entries
+}
+
+// Compact drops the certificates that policy does not retain as of at, and
+// returns how many it dropped.
+func (w *Warehouse) Compact(policy RetentionPolicy, at time.Time) int {
+	dropped := 0
+	for fingerprint, entry := range w.entries {
+		if policy.drops(entry, at) {
+			delete(w.entries, fingerprint)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Save writes the warehouse back to its file, with the certificates in
+// order of fingerprint, their primary key.
+func (w *Warehouse) Save() error {
+	entries := make([]*WarehouseEntry, 0, len(w.entries))
+	for _, entry := range w.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Fingerprint(), entries[j].Fingerprint()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+
+	settings := []interface{}{int64(warehouseVersion), int64(w.Retention.ExpiredDays), int64(w.Retention.UnseenDays), w.Retention.KeepCAs}
+	certificates := sqliteTable{name: "certificates", sql: certificatesTableSQL, primaryKey: true, rows: func(emit func([]interface{}) error) error {
+		for _, entry := range entries {
+			cert := entry.Certificate
+			err := emit([]interface{}{
+				fmt.Sprintf("%x", entry.Fingerprint()),
+				cert.Subject.String(),
+				cert.Issuer.String(),
+				cert.NotAfter.UTC().Format(time.RFC3339),
+				entry.FirstSeen.UTC().Format(time.RFC3339),
+				entry.LastSeen.UTC().Format(time.RFC3339),
+				strings.Join(entry.Sources, " "),
+				entry.Raw,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+	return writeSQLiteFile(w.path, []sqliteTable{
+		{name: "warehouse", sql: warehouseTableSQL, rows: sqliteRows([][]interface{}{settings})},
+		certificates,
+	})
+}
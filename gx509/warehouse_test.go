@@ -0,0 +1,153 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWarehouse(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "warehouse.db")
+	w, err := OpenWarehouse(path)
+	if err != nil || w.Len() != 0 {
+		t.Fatalf("Expected an empty warehouse for a new file, got %d and %v", w.Len(), err)
+	}
+
+	chain := testChain(t, "www.example.com")
+	first := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	later := first.Add(24 * time.Hour)
+	if !w.Add(chain[0], "www.example.com:443", later) || !w.Add(chain[1], "www.example.com:443", later) {
+		t.Errorf("Expected new certificates to be added")
+	}
+	if w.Add(chain[0], "cdn.example.com:443", first) || w.Add(chain[0], "www.example.com:443", later) {
+		t.Errorf("Expected a certificate seen before not to be new")
+	}
+	if err := w.Save(); err != nil {
+		t.Fatalf("Could not save warehouse: %s", err)
+	}
+
+	reopened, err := OpenWarehouse(path)
+	if err != nil {
+		t.Fatalf("Could not reopen warehouse: %s", err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d", len(entries))
+	}
+	leaf := entries[0]
+	if !leaf.Certificate.Equal(chain[0]) || !leaf.FirstSeen.Equal(first) || !leaf.LastSeen.Equal(later) {
+		t.Errorf("Unexpected leaf entry %+v", leaf)
+	}
+	if !reflect.DeepEqual(leaf.Sources, []string{"cdn.example.com:443", "www.example.com:443"}) {
+		t.Errorf("Unexpected sources %v", leaf.Sources)
+	}
+	if !entries[1].Certificate.Equal(chain[1]) {
+		t.Errorf("Expected the intermediate second")
+	}
+	if entry, ok := reopened.Get(sha256.Sum256(chain[1].Raw)); !ok || !entry.Certificate.Equal(chain[1]) {
+		t.Errorf("Could not get the intermediate by fingerprint")
+	}
+	if _, ok := reopened.Get(sha256.Sum256(chain[2].Raw)); ok {
+		t.Errorf("Expected the root not to be in the warehouse")
+	}
+}
+
+func TestOpenWarehouseInvalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	version := writeTestSQLite(t, []sqliteTable{
+		{name: "warehouse", sql: warehouseTableSQL, rows: sqliteRows([][]interface{}{{int64(99), int64(0), int64(0), false}})},
+		{name: "certificates", sql: certificatesTableSQL},
+	})
+	der := writeTestSQLite(t, []sqliteTable{
+		{name: "warehouse", sql: warehouseTableSQL, rows: sqliteRows([][]interface{}{{int64(warehouseVersion), int64(0), int64(0), false}})},
+		{name: "certificates", sql: certificatesTableSQL, rows: sqliteRows([][]interface{}{{"00", "", "", "", "", "", "", []byte{0}}})},
+	})
+	for name, contents := range map[string]string{
+		"garbage.json": "not json",
+		"version.json": `{"version": 99, "certificates": []}`,
+		"der.json":     `{"version": 1, "certificates": [{"der": "AAAA"}]}`,
+		"truncated.db": string(version[:100]),
+		"version.db":   string(version),
+		"der.db":       string(der),
+	} {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(contents), 0644)
+		if _, err := OpenWarehouse(path); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestOpenWarehouseJSON(t *testing.T) {
+	t.Parallel()
+
+	cert := testChain(t, "www.example.com")[0]
+	data, _ := json.Marshal(warehouseFile{Version: 1, Retention: RetentionPolicy{UnseenDays: 7}, Certificates: []*WarehouseEntry{
+		{Raw: cert.Raw, FirstSeen: cert.NotBefore, LastSeen: cert.NotBefore, Sources: []string{"www.example.com:443"}},
+	}})
+	path := filepath.Join(t.TempDir(), "warehouse.json")
+	ioutil.WriteFile(path, data, 0644)
+	w, err := OpenWarehouse(path)
+	if err != nil || w.Len() != 1 || w.Retention.UnseenDays != 7 {
+		t.Fatalf("Could not read a version 1 warehouse: %v", err)
+	}
+
+	// Saving rewrites it in SQLite
+	if err := w.Save(); err != nil {
+		t.Fatalf("Could not save warehouse: %s", err)
+	}
+	data, _ = ioutil.ReadFile(path)
+	reopened, err := OpenWarehouse(path)
+	if !bytes.HasPrefix(data, sqliteMagic) || err != nil || reopened.Len() != 1 || reopened.Retention != w.Retention {
+		t.Errorf("Expected the warehouse rewritten in SQLite, got %v", err)
+	}
+}
+
+func TestWarehouseCompact(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "warehouse.db")
+	w, _ := OpenWarehouse(path)
+	chain := testChain(t, "www.example.com")
+	seen := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+	for _, cert := range chain {
+		w.Add(cert, "www.example.com:443", seen)
+	}
+
+	// The leaf expired on 1 June 2018
+	at := time.Date(2018, time.July, 1, 0, 0, 0, 0, time.UTC)
+	if dropped := w.Compact(RetentionPolicy{ExpiredDays: 60}, at); dropped != 0 {
+		t.Errorf("Expected nothing expired for over 60 days, dropped %d", dropped)
+	}
+	if dropped := w.Compact(RetentionPolicy{UnseenDays: 90, KeepCAs: true}, at.AddDate(0, 1, 0)); dropped != 1 || w.Len() != 2 {
+		t.Errorf("Expected only the leaf dropped, dropped %d of %d", dropped, w.Len()+dropped)
+	}
+	if dropped := w.Compact(RetentionPolicy{}, at.AddDate(50, 0, 0)); dropped != 0 {
+		t.Errorf("Expected the zero policy to keep everything, dropped %d", dropped)
+	}
+	if dropped := w.Compact(RetentionPolicy{ExpiredDays: 1}, at.AddDate(50, 0, 0)); dropped != 2 || w.Len() != 0 {
+		t.Errorf("Expected the CAs dropped once expired, dropped %d", dropped)
+	}
+
+	w.Retention = RetentionPolicy{ExpiredDays: 30, KeepCAs: true}
+	if err := w.Save(); err != nil {
+		t.Fatalf("Could not save warehouse: %s", err)
+	}
+	reopened, err := OpenWarehouse(path)
+	if err != nil || reopened.Retention != w.Retention {
+		t.Errorf("Expected the retention policy saved, got %+v and %v", reopened.Retention, err)
+	}
+}
@@ -0,0 +1,119 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type zgrab2Certificate struct {
+	Raw []byte `json:"raw"`
+}
+
+type zgrab2HandshakeLog struct {
+	ServerCertificates *struct {
+		Certificate zgrab2Certificate   `json:"certificate"`
+		Chain       []zgrab2Certificate `json:"chain"`
+	} `json:"server_certificates"`
+}
+
+// zgrab2Result holds the parts of a module's result that can carry a TLS
+// handshake: the tls module's own, and the http module's request.
+type zgrab2Result struct {
+	HandshakeLog *zgrab2HandshakeLog `json:"handshake_log"`
+	Response     *struct {
+		Request *struct {
+			TLSLog *struct {
+				HandshakeLog *zgrab2HandshakeLog `json:"handshake_log"`
+			} `json:"tls_log"`
+		} `json:"request"`
+	} `json:"response"`
+}
+
+func (r *zgrab2Result) handshakeLog() *zgrab2HandshakeLog {
+	if r.HandshakeLog != nil {
+		return r.HandshakeLog
+	}
+	if r.Response != nil && r.Response.Request != nil && r.Response.Request.TLSLog != nil {
+		return r.Response.Request.TLSLog.HandshakeLog
+	}
+	return nil
+}
+
+type zgrab2Record struct {
+	IP     string `json:"ip"`
+	Domain string `json:"domain"`
+	Data   map[string]struct {
+		Status string        `json:"status"`
+		Error  string        `json:"error"`
+		Result *zgrab2Result `json:"result"`
+	} `json:"data"`
+}
+
+// ParseZGrab2 reads zgrab2 output, one JSON record per scanned host, and
+// returns the chain each TLS handshake in it presented. Records from the tls
+// and http modules are understood, under whatever names they were run as;
+// hosts whose handshake failed are returned with Err set. The address of each
+// chain is the domain scanned, or the IP if there was none.
+func ParseZGrab2(r io.Reader) ([]ServerChain, error) {
+	var servers []ServerChain
+	decoder := json.NewDecoder(r)
+	for record := 1; ; record++ {
+		var entry zgrab2Record
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return servers, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not decode record %d: %s", record, err)
+		}
+
+		address := entry.Domain
+		if len(address) == 0 {
+			address = entry.IP
+		}
+		names := make([]string, 0, len(entry.Data))
+		for name := range entry.Data {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var failure error
+		found := false
+		for _, name := range names {
+			module := entry.Data[name]
+			var handshake *zgrab2HandshakeLog
+			if module.Result != nil {
+				handshake = module.Result.handshakeLog()
+			}
+			if handshake == nil || handshake.ServerCertificates == nil || len(handshake.ServerCertificates.Certificate.Raw) == 0 {
+				if failure == nil && len(module.Error) > 0 {
+					failure = fmt.Errorf("%s: %s", module.Status, module.Error)
+				}
+				continue
+			}
+
+			server := ServerChain{Address: address}
+			raws := append([]zgrab2Certificate{handshake.ServerCertificates.Certificate}, handshake.ServerCertificates.Chain...)
+			for _, raw := range raws {
+				cert, err := x509.ParseCertificate(raw.Raw)
+				if err != nil {
+					return nil, fmt.Errorf("Could not parse certificate in record %d: %s", record, err)
+				}
+				server.Certificates = append(server.Certificates, cert)
+			}
+			servers = append(servers, server)
+			found = true
+		}
+		if !found {
+			if failure == nil {
+				failure = fmt.Errorf("No TLS handshake recorded")
+			}
+			servers = append(servers, ServerChain{Address: address, Err: failure})
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package gx509
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseZGrab2(t *testing.T) {
+	t.Parallel()
+
+	chain := testChain(t, "www.example.com")
+	encode := func(i int) string {
+		return base64.StdEncoding.EncodeToString(chain[i].Raw)
+	}
+	certificates := fmt.Sprintf(`{"server_certificates": {"certificate": {"raw": %q, "parsed": {}}, "chain": [{"raw": %q}]}}`, encode(0), encode(1))
+	output := strings.Join([]string{
+		fmt.Sprintf(`{"ip": "192.0.2.1", "data": {"tls": {"status": "success", "protocol": "tls", "result": {"handshake_log": %s}}}}`, certificates),
+		fmt.Sprintf(`{"ip": "192.0.2.2", "domain": "www.example.com", "data": {"https": {"status": "success", "protocol": "http", "result": {"response": {"request": {"tls_log": {"handshake_log": %s}}}}}}}`, certificates),
+		`{"ip": "192.0.2.3", "data": {"tls": {"status": "io-timeout", "protocol": "tls", "error": "i/o timeout"}}}`,
+		`{"ip": "192.0.2.4", "data": {}}`,
+	}, "\n")
+
+	servers, err := ParseZGrab2(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("Could not parse zgrab2 output: %s", err)
+	}
+	if len(servers) != 4 {
+		t.Fatalf("Expected 4 servers, got %d", len(servers))
+	}
+	for i, address := range []string{"192.0.2.1", "www.example.com"} {
+		if servers[i].Address != address || servers[i].Err != nil || len(servers[i].Certificates) != 2 {
+			t.Errorf("Unexpected server %+v", servers[i])
+			continue
+		}
+		if !servers[i].Certificates[0].Equal(chain[0]) || !servers[i].Certificates[1].Equal(chain[1]) {
+			t.Errorf("Unexpected chain for %s", address)
+		}
+	}
+	if err := servers[2].Err; err == nil || err.Error() != "io-timeout: i/o timeout" {
+		t.Errorf("Expected the scan error for 192.0.2.3, got %v", err)
+	}
+	if err := servers[3].Err; err == nil || !strings.Contains(err.Error(), "No TLS handshake") {
+		t.Errorf("Expected no handshake for 192.0.2.4, got %v", err)
+	}
+}
+
+func TestParseZGrab2Invalid(t *testing.T) {
+	t.Parallel()
+
+	for output, expected := range map[string]string{
+		`{"ip": "192.0.2.1"} not json`: "record 2",
+		`{"ip": "192.0.2.1", "data": {"tls": {"result": {"handshake_log": {"server_certificates": {"certificate": {"raw": "AAAA"}}}}}}}`: "Could not parse certificate",
+	} {
+		if _, err := ParseZGrab2(strings.NewReader(output)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
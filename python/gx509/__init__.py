@@ -0,0 +1,112 @@
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+"""Python bindings for gx509's certificate analysis.
+
+The bindings call libgx509, the C shared library built from cmd/libgx509:
+
+    go build -buildmode=c-shared -o libgx509.so ./cmd/libgx509
+
+The library is found through the GX509_LIBRARY environment variable, then
+next to this package, then on the system library path.
+
+Certificates may be given as DER bytes or as PEM, in bytes or str.
+"""
+
+import ctypes
+import ctypes.util
+import json
+import os
+import ssl
+
+__all__ = ["GX509Error", "analyze", "lint", "verify_chain"]
+
+# The library ABI these bindings were written against.
+ABI_VERSION = 1
+
+
+class GX509Error(ValueError):
+    """An error reported by libgx509, such as a certificate it could not parse."""
+
+
+def _find_library():
+    if os.environ.get("GX509_LIBRARY"):
+        return os.environ["GX509_LIBRARY"]
+    here = os.path.dirname(os.path.abspath(__file__))
+    for name in ("libgx509.so", "libgx509.dylib", "gx509.dll"):
+        if os.path.exists(os.path.join(here, name)):
+            return os.path.join(here, name)
+    found = ctypes.util.find_library("gx509")
+    if found is None:
+        raise OSError("Could not find libgx509; build it from cmd/libgx509 or set GX509_LIBRARY")
+    return found
+
+
+_lib = None
+
+
+def _library():
+    global _lib
+    if _lib is None:
+        lib = ctypes.CDLL(_find_library())
+        lib.AnalysisABIVersion.restype = ctypes.c_int
+        for function, arguments in (
+            (lib.AnalyzeCertificate, 2),
+            (lib.LintCertificate, 2),
+            (lib.VerifyChain, 6),
+        ):
+            function.argtypes = [ctypes.c_char_p, ctypes.c_int] * (arguments // 2)
+            function.restype = ctypes.c_void_p
+        lib.FreeAnalysis.argtypes = [ctypes.c_void_p]
+        if lib.AnalysisABIVersion() != ABI_VERSION:
+            raise OSError("libgx509 has ABI version %d, expected %d" % (lib.AnalysisABIVersion(), ABI_VERSION))
+        _lib = lib
+    return _lib
+
+
+def _bytes(certificates):
+    if isinstance(certificates, str):
+        return certificates.encode("ascii")
+    return bytes(certificates)
+
+
+def _der(certificate):
+    data = _bytes(certificate)
+    if data.lstrip().startswith(b"-----BEGIN"):
+        return ssl.PEM_cert_to_DER_cert(data.decode("ascii"))
+    return data
+
+
+def _call(function, *arguments):
+    lib = _library()
+    args = []
+    for argument in arguments:
+        args += [argument, len(argument)]
+    pointer = function(*args)
+    try:
+        response = json.loads(ctypes.string_at(pointer).decode("utf-8"))
+    finally:
+        lib.FreeAnalysis(pointer)
+    if response.get("error"):
+        raise GX509Error(response["error"])
+    return response
+
+
+def analyze(certificate):
+    """Returns the technical constraint analysis of certificate as a dict,
+    with the fields gx509 -json writes, such as "constrained" and "reasons"."""
+    return _call(_library().AnalyzeCertificate, _der(certificate))["certificate"]
+
+
+def lint(certificate):
+    """Returns the outcome of each lint that applies to certificate, as dicts
+    of "lint", "severity", "passed" and "message"."""
+    return _call(_library().LintCertificate, _der(certificate))["findings"]
+
+
+def verify_chain(leaf, roots, intermediates=b""):
+    """Returns every chain from leaf through intermediates to roots, which are
+    PEM or concatenated DER. Each chain has its "certificates", leaf first and
+    marked if "constrained", whether it is "valid", and the "errors" if not."""
+    return _call(_library().VerifyChain, _der(leaf), _bytes(intermediates), _bytes(roots))["chains"]